@@ -3,7 +3,9 @@ package adder
 import (
 	"bytes"
 	"context"
+	"math/rand"
 	"mime/multipart"
+	"net/url"
 	"sync"
 	"testing"
 	"time"
@@ -130,6 +132,46 @@ func TestAdder_ContextCancelled(t *testing.T) {
 	wg.Wait()
 }
 
+// The expected roots are those that "ipfs add" produces with the same
+// options for 1MiB read from rand.NewSource(1).
+func TestAdder_DAGParams(t *testing.T) {
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	testcases := []struct {
+		query    string
+		expected string
+	}{
+		{"", "QmZYS9Y93xKF6USHRyFDbWqbxCcfXiHCTmNqU6CQCktjSg"},
+		{"chunker=size-1024", "QmdSofYHzkLJi8JbUXPHG4SCqJSdRbkcG1V1XsQFn49i9R"},
+		{"chunker=rabin-256-1024-4096", "QmT4FHAw8zKLGY5mRWRjm7hCjLVho31k8rzzi2dsYTH5Lw"},
+		{"chunker=size-1024&raw-leaves=true&cid-version=1", "bafybeiadon6vakqdyuob6ttem3ucsh2dhfznrvx4abardmqkurvu2cn23a"},
+		{"chunker=rabin&cid-version=1", "bafybeigjpv7f5fjsoq3nkjldb4oxeewgdhhgxhvpgypg6idauzmrteceka"},
+	}
+
+	for _, tc := range testcases {
+		q, err := url.ParseQuery(tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := api.AddParamsFromQuery(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dir := files.NewSliceDirectory([]files.DirEntry{
+			files.FileEntry("data", files.NewBytesFile(data)),
+		})
+		root, err := New(newMockCDAGServ(), p, nil).FromFiles(context.Background(), dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if root.String() != tc.expected {
+			t.Errorf("%q: expected root %s; got %s", tc.query, tc.expected, root)
+		}
+	}
+}
+
 func TestAdder_CAR(t *testing.T) {
 	// prepare a CAR file
 	ctx := context.Background()
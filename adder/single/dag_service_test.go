@@ -6,6 +6,7 @@ import (
 	"mime/multipart"
 	"sync"
 	"testing"
+	"time"
 
 	adder "github.com/ipfs/ipfs-cluster/adder"
 	"github.com/ipfs/ipfs-cluster/api"
@@ -133,3 +134,67 @@ func TestAdd(t *testing.T) {
 		}
 	})
 }
+
+// slowIPFSRPC puts blocks slowly and records how many are put at once.
+type slowIPFSRPC struct {
+	testIPFSRPC
+
+	mu      sync.Mutex
+	puts    int
+	maxPuts int
+}
+
+func (rpcs *slowIPFSRPC) BlockPut(ctx context.Context, in *api.NodeWithMeta, out *struct{}) error {
+	rpcs.mu.Lock()
+	rpcs.puts++
+	if rpcs.puts > rpcs.maxPuts {
+		rpcs.maxPuts = rpcs.puts
+	}
+	rpcs.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	rpcs.mu.Lock()
+	rpcs.puts--
+	rpcs.mu.Unlock()
+	return rpcs.testIPFSRPC.BlockPut(ctx, in, out)
+}
+
+func TestAddSlowIPFS(t *testing.T) {
+	clusterRPC := &testClusterRPC{}
+	ipfsRPC := &slowIPFSRPC{}
+	server := rpc.NewServer(nil, "mock")
+	err := server.RegisterName("Cluster", clusterRPC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.RegisterName("IPFSConnector", ipfsRPC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.NewClientWithServer(nil, "mock", server)
+	params := api.DefaultAddParams()
+	params.Wrap = true
+
+	dags := New(client, params.PinOptions, false)
+	add := adder.New(dags, params, nil)
+
+	sth := test.NewShardingTestHelper()
+	defer sth.Clean(t)
+	mr, closer := sth.GetTreeMultiReader(t)
+	defer closer.Close()
+	r := multipart.NewReader(mr, mr.Boundary())
+
+	rootCid, err := add.FromMultipart(context.Background(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rootCid.String() != test.ShardingDirBalancedRootCIDWrapped {
+		t.Fatal("bad root cid: ", rootCid)
+	}
+
+	// Reading waits for every block to be put.
+	if ipfsRPC.maxPuts != 1 {
+		t.Errorf("%d blocks were being put at once", ipfsRPC.maxPuts)
+	}
+}
@@ -34,7 +34,10 @@ func NewBlockAdder(rpcClient *rpc.Client, dests []peer.ID) *BlockAdder {
 	}
 }
 
-// Add puts an ipld node to the allocated destinations.
+// Add puts an ipld node to the allocated destinations. It returns once
+// the destinations have acknowledged the block, so the content being added
+// is not read any further while they are slower than the client sending it
+// and only one block is held in memory at a time.
 func (ba *BlockAdder) Add(ctx context.Context, node ipld.Node) error {
 	nodeSerial := ipldNodeToNodeWithMeta(node)
 
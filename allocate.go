@@ -4,13 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
+	humanize "github.com/dustin/go-humanize"
 	cid "github.com/ipfs/go-cid"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 
 	"go.opencensus.io/trace"
 
 	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/rpcutil"
 )
 
 // This file gathers allocation logic used when pinning or re-pinning
@@ -21,8 +25,12 @@ import (
 // The allocation process has several steps:
 //
 // * Find which peers are pinning a CID
-// * Obtain the last values for the configured informer metrics from the
-//   monitor component
+// * Drop the candidates not allowed by the placement rules of the pin.
+// * Try the configured allocator or, when it is a FallbackAllocator, each
+//   of the allocators in its chain until one of them provides enough
+//   allocations:
+// * Obtain the last values for the allocator metrics from the monitor
+//   component
 // * Divide the metrics between "current" (peers already pinning the CID)
 //   and "candidates" (peers that could pin the CID), as long as their metrics
 //   are valid.
@@ -37,7 +45,84 @@ import (
 //       order of preference.
 //     * Take as many final candidates from the list as we can, until
 //       ReplicationFactorMax is reached. Error if there are less than
-//       ReplicationFactorMin.
+//       ReplicationFactorMin, unless the allocator allows under-replication
+//       and there is at least one. With placement rules, including the
+//       affinity ones from the pin metadata, candidates are taken so that
+//       the per-tag-value minimums and maximums are respected.
+//
+// Pins with UserAllocations skip this process: they are allocated to exactly
+// those peers (see setupUserAllocations).
+
+// underReplicationAllower is implemented by the allocators which can be
+// configured to allow allocating pins to fewer peers than their replication
+// factor minimum, like the balanced allocator.
+type underReplicationAllower interface {
+	AllowUnderReplication() bool
+}
+
+// allowsUnderReplication returns true when the given allocator allows
+// under-replication.
+func allowsUnderReplication(alloc PinAllocator) bool {
+	a, ok := alloc.(underReplicationAllower)
+	return ok && a.AllowUnderReplication()
+}
+
+// setupUserAllocations checks that the peers a pin is explicitly allocated
+// to are cluster peers, removing duplicates, and sets its replication factors
+// to their number. Such pins are allocated to exactly those peers, without
+// consulting the allocator. Pins whose allocations are already set (i.e. by
+// the adder) are left untouched.
+func (c *Cluster) setupUserAllocations(ctx context.Context, pin *api.Pin) error {
+	if len(pin.UserAllocations) == 0 || len(pin.Allocations) > 0 {
+		return nil
+	}
+
+	peers, err := c.consensus.Peers(ctx)
+	if err != nil {
+		return err
+	}
+	var allocs []peer.ID
+	for _, p := range pin.UserAllocations {
+		if !containsPeer(peers, p) {
+			return fmt.Errorf("user allocation %s is not a cluster peer", p)
+		}
+		if !containsPeer(allocs, p) {
+			allocs = append(allocs, p)
+		}
+	}
+	pin.UserAllocations = allocs
+	pin.ReplicationFactorMin = len(allocs)
+	pin.ReplicationFactorMax = len(allocs)
+	return nil
+}
+
+// checkUserAllocations returns an error when any of the given user
+// allocations is blacklisted, either explicitly or because it is a read-only
+// peer, as the allocator would have done.
+func (c *Cluster) checkUserAllocations(ctx context.Context, allocs, blacklist []peer.ID) error {
+	// The blacklist is not appended to, as it belongs to the caller.
+	readOnly := c.readOnlyPeers(ctx)
+	for _, p := range allocs {
+		if containsPeer(blacklist, p) || containsPeer(readOnly, p) {
+			return fmt.Errorf("user allocation %s cannot be used: peer is blacklisted", p)
+		}
+	}
+	return nil
+}
+
+// dedupCandidates returns the peers which are alive and could be given a new
+// allocation: those not currently allocated nor blacklisted. Only these are
+// asked whether they already hold the content being allocated.
+func (c *Cluster) dedupCandidates(ctx context.Context, currentAllocs, blacklist []peer.ID) []peer.ID {
+	var candidates []peer.ID
+	for _, m := range c.monitor.LatestMetrics(ctx, pingMetricName) {
+		if m.Discard() || containsPeer(currentAllocs, m.Peer) || containsPeer(blacklist, m.Peer) {
+			continue
+		}
+		candidates = append(candidates, m.Peer)
+	}
+	return candidates
+}
 
 // A wrapper to carry peer metrics that have been classified.
 type classifiedMetrics struct {
@@ -56,8 +141,10 @@ type classifiedMetrics struct {
 // it will return the current ones. Note that allocate() does not take
 // into account if the given CID was previously in a "pin everywhere" mode,
 // and will consider such Pins as currently unallocated ones, providing
-// new allocations as available.
-func (c *Cluster) allocate(ctx context.Context, hash cid.Cid, currentPin *api.Pin, rplMin, rplMax int, blacklist []peer.ID, priorityList []peer.ID) ([]peer.ID, error) {
+// new allocations as available. The given placement expression further
+// constrains which peers can be allocated (see api.ParsePlacement). The
+// decision is recorded in the allocation audit unless dryRun is set.
+func (c *Cluster) allocate(ctx context.Context, hash cid.Cid, currentPin *api.Pin, rplMin, rplMax int, blacklist []peer.ID, priorityList []peer.ID, placement string, dryRun bool) ([]peer.ID, error) {
 	ctx, span := trace.StartSpan(ctx, "cluster/allocate")
 	defer span.End()
 
@@ -75,39 +162,234 @@ func (c *Cluster) allocate(ctx context.Context, hash cid.Cid, currentPin *api.Pi
 		currentAllocs = currentPin.Allocations
 	}
 
-	// Get Metrics that the allocator is interested on
-	mSet := make(api.MetricsSet)
-	metrics := c.allocator.Metrics()
-	for _, metricName := range metrics {
-		mSet[metricName] = c.monitor.LatestMetrics(ctx, metricName)
-	}
+	blacklist = append(blacklist, c.readOnlyPeers(ctx)...)
 
-	// Filter and divide metrics.  The resulting sets only have peers that
-	// have all the metrics needed and are not blacklisted.
-	classified := filterMetrics(
-		mSet,
-		len(metrics),
-		currentAllocs,
-		priorityList,
-		blacklist,
-	)
+	opts := c.config.reloadable()
+	if opts.CodecAwareAllocation {
+		blacklist = append(blacklist, c.codecUnsupportedPeers(ctx, hash)...)
+	}
 
-	newAllocs, err := c.obtainAllocations(
-		ctx,
-		hash,
-		rplMin,
-		rplMax,
-		classified,
-	)
+	plan, err := c.newPlacementPlan(ctx, placement)
 	if err != nil {
-		return newAllocs, err
+		return nil, err
+	}
+	if plan != nil {
+		blacklist = append(blacklist, plan.disallowed()...)
+		priorityList = append(priorityList, plan.preferred()...)
+	}
+
+	if opts.DedupAwareAllocation && (rplMax < 0 || len(currentAllocs) < rplMax) {
+		candidates := c.dedupCandidates(ctx, currentAllocs, blacklist)
+		priorityList = append(priorityList, c.blockHolders(ctx, hash, candidates)...)
+	}
+
+	// Try the allocators in the chain until one of them provides
+	// enough peers.
+	var newAllocs []peer.ID
+	var classified classifiedMetrics
+	chain := allocatorChain(c.allocator)
+	for i, alloc := range chain {
+		// Get Metrics that the allocator is interested on
+		mSet := make(api.MetricsSet)
+		metrics := alloc.Metrics()
+		for _, metricName := range metrics {
+			mSet[metricName] = c.monitor.LatestMetrics(ctx, metricName)
+		}
+		c.applyAllocationCooldown(mSet)
+
+		// Filter and divide metrics.  The resulting sets only have peers that
+		// have all the metrics needed and are not blacklisted.
+		classified = filterMetrics(
+			mSet,
+			len(metrics),
+			currentAllocs,
+			priorityList,
+			blacklist,
+		)
+
+		newAllocs, err = c.obtainAllocations(
+			ctx,
+			alloc,
+			hash,
+			rplMin,
+			rplMax,
+			classified,
+			plan,
+		)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, api.ErrUnderReplicated) || i == len(chain)-1 {
+			if !dryRun {
+				c.allocAudit.record(hash, rplMin, rplMax, classified, newAllocs, err)
+			}
+			return newAllocs, err
+		}
+		logger.Warnf("allocator %d could not allocate %s. Falling back to allocator %d", i, hash, i+1)
 	}
 	if newAllocs == nil {
 		newAllocs = currentAllocs
 	}
+	if !dryRun {
+		c.allocAudit.record(hash, rplMin, rplMax, classified, newAllocs, nil)
+	}
 	return newAllocs, nil
 }
 
+// readOnlyPeers returns the peers which announce being read-only (see
+// Config.ReadOnly). They are never allocated pins.
+func (c *Cluster) readOnlyPeers(ctx context.Context) []peer.ID {
+	var peers []peer.ID
+	for _, m := range c.monitor.LatestMetrics(ctx, readOnlyMetricName) {
+		peers = append(peers, m.Peer)
+	}
+	return peers
+}
+
+// codecUnsupportedPeers returns the cluster peers whose IPFS daemon reports
+// not supporting the codec of the given CID. Peers that cannot be asked are
+// not included.
+func (c *Cluster) codecUnsupportedPeers(ctx context.Context, h cid.Cid) []peer.ID {
+	ctx, span := trace.StartSpan(ctx, "cluster/codecUnsupportedPeers")
+	defer span.End()
+
+	members, err := c.consensus.Peers(ctx)
+	if err != nil {
+		logger.Error(err)
+		return nil
+	}
+
+	lenMembers := len(members)
+	replies := make([]bool, lenMembers)
+	ifaceReplies := make([]interface{}, lenMembers)
+	for i := range replies {
+		ifaceReplies[i] = &replies[i]
+	}
+
+	ctxs, cancels := rpcutil.CtxsWithTimeout(ctx, lenMembers, 15*time.Second)
+	defer rpcutil.MultiCancel(cancels)
+
+	errs := c.rpcClient.MultiCall(
+		ctxs,
+		members,
+		"IPFSConnector",
+		"SupportsCodec",
+		h.Type(),
+		ifaceReplies,
+	)
+
+	var unsupported []peer.ID
+	for i, err := range errs {
+		if err != nil {
+			logger.Debugf("%s: error checking codec support: %s", members[i], err)
+			continue
+		}
+		if !replies[i] {
+			unsupported = append(unsupported, members[i])
+		}
+	}
+	return unsupported
+}
+
+// capacityCheckTimeout bounds the size lookup made by checkCapacity, which
+// runs while the pin request waits.
+var capacityCheckTimeout = 5 * time.Second
+
+// checkCapacity returns an error when fewer than ReplicationFactorMin peers
+// have room for the given pin, according to the size of its DAG and the
+// last freespace metrics of the peers. The size is looked up offline, so it
+// is only known when the local IPFS daemon has the root block already, as
+// after adding the content to this peer. The pin is admitted when either
+// the size or the metrics are unknown.
+func (c *Cluster) checkCapacity(ctx context.Context, pin *api.Pin) error {
+	ctx, span := trace.StartSpan(ctx, "cluster/checkCapacity")
+	defer span.End()
+
+	rplMin := pin.ReplicationFactorMin
+	if rplMin <= 0 {
+		return nil
+	}
+
+	sizeCtx, cancel := context.WithTimeout(ctx, capacityCheckTimeout)
+	defer cancel()
+	size, err := c.ipfs.DAGSize(sizeCtx, pin.Cid)
+	if err != nil {
+		logger.Debugf("size of %s unknown. Skipping capacity check: %s", pin.Cid, err)
+		return nil
+	}
+
+	metrics := c.monitor.LatestMetrics(ctx, freespaceMetricName)
+	if len(metrics) == 0 {
+		logger.Debugf("no %s metrics. Skipping capacity check", freespaceMetricName)
+		return nil
+	}
+
+	withRoom := 0
+	for _, m := range metrics {
+		free, err := strconv.ParseUint(m.Value, 10, 64)
+		if err == nil && free >= size {
+			withRoom++
+		}
+	}
+	if withRoom >= rplMin {
+		return nil
+	}
+	return fmt.Errorf(
+		"%w: %s needs %s on %d peers but only %d have room",
+		api.ErrNoSpace,
+		pin.Cid,
+		humanize.Bytes(size),
+		rplMin,
+		withRoom,
+	)
+}
+
+// applyAllocationCooldown modifies the weights of the non-partitionable
+// metrics of peers which were seen for the first time less than
+// AllocationCooldown ago. Their weights are interpolated between the lowest
+// weight for the metric and their own, proportionally to the time elapsed
+// since we first saw them, thus making them progressively more attractive.
+func (c *Cluster) applyAllocationCooldown(mSet api.MetricsSet) {
+	cooldown := c.config.reloadable().AllocationCooldown
+	if cooldown <= 0 {
+		return
+	}
+
+	for name, metrics := range mSet {
+		var minWeight int64
+		for i, m := range metrics {
+			if w := m.GetWeight(); i == 0 || w < minWeight {
+				minWeight = w
+			}
+		}
+
+		for i, m := range metrics {
+			if m.Partitionable {
+				continue
+			}
+			seen := c.peerSeen(m.Peer)
+			if seen.IsZero() {
+				continue
+			}
+			elapsed := time.Since(seen)
+			if elapsed >= cooldown {
+				continue
+			}
+			factor := float64(elapsed) / float64(cooldown)
+			w := m.GetWeight()
+			// Copy as we should not modify the monitor's metrics.
+			mCopy := *m
+			mCopy.Weight = minWeight + int64(float64(w-minWeight)*factor)
+			if mCopy.Weight == 0 {
+				// Avoid GetWeight() falling back to the Value.
+				mCopy.Value = "0"
+			}
+			metrics[i] = &mCopy
+		}
+		mSet[name] = metrics
+	}
+}
+
 // Given metrics from all informers, split them into 3 MetricsSet:
 // - Those corresponding to currently allocated peers
 // - Those corresponding to priority allocations
@@ -181,19 +463,20 @@ func allocationError(hash cid.Cid, needed, wanted int, candidatesValid []peer.ID
 	for _, c := range candidatesValid {
 		logger.Errorf("    - %s", c.Pretty())
 	}
-	errorMsg := "not enough peers to allocate CID. "
-	errorMsg += fmt.Sprintf("Needed at least: %d. ", needed)
+	errorMsg := fmt.Sprintf("Needed at least: %d. ", needed)
 	errorMsg += fmt.Sprintf("Wanted at most: %d. ", wanted)
 	errorMsg += fmt.Sprintf("Available candidates: %d. ", len(candidatesValid))
 	errorMsg += "See logs for more info."
-	return errors.New(errorMsg)
+	return fmt.Errorf("%w CID. %s", api.ErrUnderReplicated, errorMsg)
 }
 
 func (c *Cluster) obtainAllocations(
 	ctx context.Context,
+	allocator PinAllocator,
 	hash cid.Cid,
 	rplMin, rplMax int,
 	metrics classifiedMetrics,
+	plan *placementPlan,
 ) ([]peer.ID, error) {
 	ctx, span := trace.StartSpan(ctx, "cluster/obtainAllocations")
 	defer span.End()
@@ -224,7 +507,13 @@ func (c *Cluster) obtainAllocations(
 		return nil, nil
 	}
 
-	if nAvailableValid < needed { // not enough candidates
+	// With under-replication allowed, any allocations are better than none.
+	allowUnder := allowsUnderReplication(allocator)
+	enough := func(got int) bool {
+		return got >= needed || (allowUnder && nCurrentValid+got > 0)
+	}
+
+	if !enough(nAvailableValid) { // not enough candidates
 		return nil, allocationError(hash, needed, wanted, append(metrics.priorityPeers, metrics.candidatePeers...))
 	}
 
@@ -232,7 +521,7 @@ func (c *Cluster) obtainAllocations(
 	// on the priority of candidates grab as many as "wanted"
 
 	// the allocator returns a list of peers ordered by priority
-	finalAllocs, err := c.allocator.Allocate(
+	finalAllocs, err := allocator.Allocate(
 		ctx,
 		hash,
 		metrics.current,
@@ -245,10 +534,17 @@ func (c *Cluster) obtainAllocations(
 
 	logger.Debugf("obtainAllocations: allocate(): %s", finalAllocs)
 
+	if plan != nil {
+		finalAllocs = plan.selectPeers(metrics.currentPeers, finalAllocs, wanted)
+		logger.Debugf("obtainAllocations: placement: %s", finalAllocs)
+	}
+
 	// check that we have enough as the allocator may have returned
 	// less candidates than provided.
-	if got := len(finalAllocs); got < needed {
+	if got := len(finalAllocs); !enough(got) {
 		return nil, allocationError(hash, needed, wanted, finalAllocs)
+	} else if got < needed {
+		logger.Warnf("allocating %s to %d peers only: %d are needed", hash, nCurrentValid+got, rplMin)
 	}
 
 	allocationsToUse := minInt(wanted, len(finalAllocs))
@@ -257,3 +553,29 @@ func (c *Cluster) obtainAllocations(
 	// along with the ones provided by the allocator
 	return append(metrics.currentPeers, finalAllocs[0:allocationsToUse]...), nil
 }
+
+// setUnderReplicatedMeta sets the api.UnderReplicatedMetaKey metadata of the
+// given pin when it has fewer allocations than its replication factor
+// minimum, and removes it otherwise.
+func setUnderReplicatedMeta(pin *api.Pin) {
+	_, wasUnder := pin.Metadata[api.UnderReplicatedMetaKey]
+	isUnder := pin.ReplicationFactorMin > 0 && len(pin.Allocations) < pin.ReplicationFactorMin
+	if !wasUnder && !isUnder {
+		return
+	}
+
+	// The metadata map may be shared with the existing pin.
+	meta := make(map[string]string, len(pin.Metadata)+1)
+	for k, v := range pin.Metadata {
+		meta[k] = v
+	}
+	delete(meta, api.UnderReplicatedMetaKey)
+	if isUnder {
+		meta[api.UnderReplicatedMetaKey] = fmt.Sprintf(
+			"allocated to %d peers: replication factor minimum is %d",
+			len(pin.Allocations),
+			pin.ReplicationFactorMin,
+		)
+	}
+	pin.Metadata = meta
+}
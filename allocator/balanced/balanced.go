@@ -10,6 +10,7 @@ package balanced
 import (
 	"context"
 	"fmt"
+	"math"
 	"sort"
 
 	cid "github.com/ipfs/go-cid"
@@ -21,6 +22,13 @@ import (
 
 var logger = logging.Logger("allocator")
 
+// compositeMetricName names the score that replaces, when partitioning, the
+// metrics combined according to CompositeWeights.
+const compositeMetricName = "composite"
+
+// compositeScale turns composite scores into integer weights.
+const compositeScale = 1e9
+
 // Allocator is an allocator that partitions metrics and orders
 // the final list of allocation by selecting for each partition.
 type Allocator struct {
@@ -69,8 +77,13 @@ type partition struct {
 
 // Returns a partitionedMetric which has partitions and subpartitions based
 // on the metrics and values given by the "by" slice. The partitions
-// are ordered based on the cumulative weight.
-func partitionMetrics(set api.MetricsSet, by []string) *partitionedMetric {
+// are ordered based on the cumulative weight. It returns the context error
+// as soon as it is cancelled.
+func partitionMetrics(ctx context.Context, set api.MetricsSet, by []string) (*partitionedMetric, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	rootMetric := by[0]
 	pnedMetric := &partitionedMetric{
 		metricName: rootMetric,
@@ -91,7 +104,7 @@ func partitionMetrics(set api.MetricsSet, by []string) *partitionedMetric {
 
 	if len(by) == 1 { // we are done
 		sort.Slice(pnedMetric.partitions, lessF)
-		return pnedMetric
+		return pnedMetric, nil
 	}
 
 	// process sub-partitions
@@ -109,14 +122,18 @@ func partitionMetrics(set api.MetricsSet, by []string) *partitionedMetric {
 			}
 		}
 
-		partition.sub = partitionMetrics(filteredSet, by[1:])
+		sub, err := partitionMetrics(ctx, filteredSet, by[1:])
+		if err != nil {
+			return nil, err
+		}
+		partition.sub = sub
 		// Add the weight of our subpartitions
 		for _, subp := range partition.sub.partitions {
 			partition.weight += subp.weight
 		}
 	}
 	sort.Slice(pnedMetric.partitions, lessF)
-	return pnedMetric
+	return pnedMetric, nil
 }
 
 func partitionValues(metrics []*api.Metric) []*partition {
@@ -178,17 +195,21 @@ func partitionValues(metrics []*api.Metric) []*partition {
 }
 
 // Returns a list of peers sorted by never choosing twice from the same
-// partition if there is some other partition to choose from.
-func (pnedm *partitionedMetric) sortedPeers() []peer.ID {
+// partition if there is some other partition to choose from. It returns the
+// context error as soon as it is cancelled.
+func (pnedm *partitionedMetric) sortedPeers(ctx context.Context) ([]peer.ID, error) {
 	peers := []peer.ID{}
 	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		peer := pnedm.chooseNext()
 		if peer == "" { // This means we are done.
 			break
 		}
 		peers = append(peers, peer)
 	}
-	return peers
+	return peers, nil
 }
 
 func (pnedm *partitionedMetric) chooseNext() peer.ID {
@@ -267,21 +288,141 @@ func (a *Allocator) Allocate(
 	//
 	// Otherwise, the sorting might be funny.
 
-	candidatePartition := partitionMetrics(candidates, a.config.AllocateBy)
-	priorityPartition := partitionMetrics(priority, a.config.AllocateBy)
+	opts := a.config.reloadable()
+	if len(opts.RequiredTags) > 0 {
+		candidates = filterByTags(candidates, opts.RequiredTags)
+		priority = filterByTags(priority, opts.RequiredTags)
+	}
+
+	by := opts.AllocateBy
+	if weights := opts.CompositeWeights; len(weights) > 0 {
+		by = compositeBy(by, weights)
+		candidates = compositeSet(candidates, weights)
+		priority = compositeSet(priority, weights)
+	}
+
+	candidatePartition, err := partitionMetrics(ctx, candidates, by)
+	if err != nil {
+		return nil, err
+	}
+	priorityPartition, err := partitionMetrics(ctx, priority, by)
+	if err != nil {
+		return nil, err
+	}
 
 	logger.Debugf("Balanced allocator partitions:\n%s\n", printPartition(candidatePartition, 0))
 
-	first := priorityPartition.sortedPeers()
-	last := candidatePartition.sortedPeers()
+	first, err := priorityPartition.sortedPeers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	last, err := candidatePartition.sortedPeers(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	return append(first, last...), nil
 }
 
+// filterByTags returns a MetricsSet with the metrics of the peers that have
+// at least one metric in the set carrying the given tags.
+func filterByTags(set api.MetricsSet, tags map[string]string) api.MetricsSet {
+	matching := make(map[peer.ID]bool)
+	for _, metrics := range set {
+		for _, m := range metrics {
+			if len(m.Tags) > 0 && m.MatchesTags(tags) {
+				matching[m.Peer] = true
+			}
+		}
+	}
+
+	filtered := make(api.MetricsSet, len(set))
+	for name, metrics := range set {
+		for _, m := range metrics {
+			if matching[m.Peer] {
+				filtered[name] = append(filtered[name], m)
+			}
+		}
+	}
+	return filtered
+}
+
+// compositeBy returns the given allocate_by list with the metrics that have
+// weights replaced by compositeMetricName, where the first of them appears.
+func compositeBy(by []string, weights map[string]float64) []string {
+	result := make([]string, 0, len(by))
+	added := false
+	for _, name := range by {
+		if _, ok := weights[name]; !ok {
+			result = append(result, name)
+			continue
+		}
+		if !added {
+			result = append(result, compositeMetricName)
+			added = true
+		}
+	}
+	return result
+}
+
+// compositeSet returns a MetricsSet where the metrics that have weights are
+// replaced by a non-partitionable compositeMetricName metric per peer. Its
+// weight is the sum of the weights of the metrics of the peer, normalized
+// between the lowest and highest among all peers, times the given factors.
+// Its value is the peer ID, so that peers with the same score are sorted in
+// a stable order.
+func compositeSet(set api.MetricsSet, weights map[string]float64) api.MetricsSet {
+	result := make(api.MetricsSet, len(set))
+	scores := make(map[peer.ID]float64)
+	for name, metrics := range set {
+		factor, ok := weights[name]
+		if !ok {
+			result[name] = metrics
+			continue
+		}
+
+		var min, max int64
+		for i, m := range metrics {
+			w := m.GetWeight()
+			if i == 0 || w < min {
+				min = w
+			}
+			if i == 0 || w > max {
+				max = w
+			}
+		}
+		for _, m := range metrics {
+			var normalized float64
+			if max > min {
+				normalized = float64(m.GetWeight()-min) / float64(max-min)
+			}
+			scores[m.Peer] += factor * normalized
+		}
+	}
+
+	for p, score := range scores {
+		result[compositeMetricName] = append(result[compositeMetricName], &api.Metric{
+			Name:   compositeMetricName,
+			Peer:   p,
+			Value:  peer.Encode(p),
+			Weight: int64(math.Round(score * compositeScale)),
+			Valid:  true,
+		})
+	}
+	return result
+}
+
+// AllowUnderReplication returns true when the allocator is configured to
+// allow pins to be allocated to fewer peers than their replication factor
+// minimum.
+func (a *Allocator) AllowUnderReplication() bool {
+	return a.config.reloadable().AllowUnderReplication
+}
+
 // Metrics returns the names of the metrics that have been registered
 // with this allocator.
 func (a *Allocator) Metrics() []string {
-	return a.config.AllocateBy
+	return a.config.reloadable().AllocateBy
 }
 
 func printPartition(m *partitionedMetric, ind int) string {
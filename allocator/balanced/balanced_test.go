@@ -2,6 +2,7 @@ package balanced
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
@@ -141,3 +142,148 @@ func TestAllocate(t *testing.T) {
 		}
 	}
 }
+
+func TestAllocateRequiredTags(t *testing.T) {
+	alloc, err := New(&Config{
+		AllocateBy:   []string{"tag:dc", "freespace"},
+		RequiredTags: map[string]string{"disk": "ssd"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tagged := func(pid peer.ID, dc, disk string) *api.Metric {
+		m := makeMetric("tag:dc", dc, 0, pid, true)
+		m.Tags = map[string]string{"dc": dc, "disk": disk}
+		return m
+	}
+
+	candidates := api.MetricsSet{
+		"tag:dc": []*api.Metric{
+			tagged(test.PeerID1, "a", "ssd"),
+			tagged(test.PeerID2, "a", "hdd"),
+			tagged(test.PeerID3, "b", "ssd"),
+			makeMetric("tag:dc", "b", 0, test.PeerID4, true), // no tags
+		},
+		"freespace": []*api.Metric{
+			makeMetric("freespace", "100", 100, test.PeerID1, false),
+			makeMetric("freespace", "500", 500, test.PeerID2, false),
+			makeMetric("freespace", "200", 200, test.PeerID3, false),
+			makeMetric("freespace", "900", 900, test.PeerID4, false),
+		},
+	}
+
+	res, err := alloc.Allocate(context.Background(), test.Cid1, nil, candidates, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 {
+		t.Fatalf("expected 2 allocations; got %v", res)
+	}
+	for _, pid := range res {
+		if pid != test.PeerID1 && pid != test.PeerID3 {
+			t.Errorf("%s does not have the required tags", pid)
+		}
+	}
+}
+
+// cancelAfterCtx is a context which becomes cancelled after its Err method
+// has been called n times.
+type cancelAfterCtx struct {
+	context.Context
+	n int
+}
+
+func (ctx *cancelAfterCtx) Err() error {
+	if ctx.n <= 0 {
+		return context.Canceled
+	}
+	ctx.n--
+	return nil
+}
+
+func TestAllocateCompositeWeights(t *testing.T) {
+	alloc, err := New(&Config{
+		AllocateBy: []string{"freespace", "numpin"},
+		CompositeWeights: map[string]float64{
+			"freespace": 0.7,
+			"numpin":    -0.3,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	candidates := api.MetricsSet{
+		"freespace": []*api.Metric{
+			makeMetric("freespace", "100", 100, test.PeerID1, false),
+			makeMetric("freespace", "200", 200, test.PeerID2, false),
+			makeMetric("freespace", "300", 300, test.PeerID3, false),
+			makeMetric("freespace", "400", 400, test.PeerID4, false),
+			makeMetric("freespace", "100", 100, test.PeerID5, false),
+		},
+		"numpin": []*api.Metric{
+			makeMetric("numpin", "0", 0, test.PeerID1, false),
+			makeMetric("numpin", "10", 10, test.PeerID2, false),
+			makeMetric("numpin", "30", 30, test.PeerID3, false),
+			makeMetric("numpin", "30", 30, test.PeerID4, false),
+			makeMetric("numpin", "0", 0, test.PeerID5, false),
+		},
+	}
+
+	// Scores: PeerID4 0.4, PeerID3 0.1667, PeerID2 0.1333, and 0 for
+	// PeerID1 and PeerID5, which are sorted by peer ID.
+	last1, last2 := test.PeerID1, test.PeerID5
+	if peer.Encode(last2) < peer.Encode(last1) {
+		last1, last2 = last2, last1
+	}
+	expected := []peer.ID{test.PeerID4, test.PeerID3, test.PeerID2, last1, last2}
+
+	for i := 0; i < 5; i++ {
+		res, err := alloc.Allocate(context.Background(), test.Cid1, nil, candidates, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(res) != fmt.Sprint(expected) {
+			t.Fatalf("expected %v; got %v", expected, res)
+		}
+	}
+}
+
+func TestAllocateCancel(t *testing.T) {
+	alloc, err := New(&Config{
+		AllocateBy: []string{"region", "freespace"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	candidates := api.MetricsSet{}
+	for i := 0; i < 1000; i++ {
+		p := peer.ID(fmt.Sprintf("peer%d", i))
+		region := fmt.Sprintf("region%d", i%10)
+		candidates["region"] = append(candidates["region"], makeMetric("region", region, 0, p, true))
+		candidates["freespace"] = append(candidates["freespace"], makeMetric("freespace", "", int64(i), p, false))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res, err := alloc.Allocate(ctx, test.Cid1, nil, candidates, nil)
+	if err != context.Canceled || res != nil {
+		t.Fatalf("expected no allocations and context.Canceled; got %d, %v", len(res), err)
+	}
+
+	// Cancel while sorting the candidate peers.
+	res, err = alloc.Allocate(&cancelAfterCtx{context.Background(), 500}, test.Cid1, nil, candidates, nil)
+	if err != context.Canceled || res != nil {
+		t.Fatalf("expected no allocations and context.Canceled; got %d, %v", len(res), err)
+	}
+
+	res, err = alloc.Allocate(context.Background(), test.Cid1, nil, candidates, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1000 {
+		t.Errorf("expected 1000 allocations; got %d", len(res))
+	}
+}
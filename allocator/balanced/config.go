@@ -3,6 +3,8 @@ package balanced
 import (
 	"encoding/json"
 	"errors"
+	"math"
+	"sync"
 
 	"github.com/ipfs/ipfs-cluster/config"
 	"github.com/kelseyhightower/envconfig"
@@ -20,11 +22,44 @@ var (
 type Config struct {
 	config.Saver
 
+	// reloadMux guards the options which Reload changes while
+	// allocations run. They are read with reloadable().
+	reloadMux sync.RWMutex
+
 	AllocateBy []string
+
+	// RequiredTags restricts allocations to the peers with metrics
+	// carrying all these tags with the same values, like those of the
+	// tags informer. Metrics carrying the tags must be among allocate_by.
+	RequiredTags map[string]string
+
+	// AllowUnderReplication makes pins which cannot get enough
+	// allocations for their replication_factor_min to be allocated to
+	// all the available peers (at least one) instead of failing. The
+	// fallbacks of an allocator allowing it are not tried.
+	AllowUnderReplication bool
+
+	// CompositeWeights combines the metrics it names, which must be
+	// among AllocateBy, into a single score per peer: the sum of their
+	// weights, normalized to [0, 1] among the peers, times the given
+	// factors. Negative factors favour peers with lower weights. The
+	// score takes the place of the first of these metrics in AllocateBy.
+	CompositeWeights map[string]float64
+
+	// Fallback is an ordered list of allocator configurations which are
+	// tried in sequence when this one cannot provide enough allocations
+	// to satisfy the replication factor of a pin. Fallbacks cannot have
+	// fallbacks themselves.
+	Fallback []*Config
 }
 
 type jsonConfig struct {
-	AllocateBy []string `json:"allocate_by"`
+	AllocateBy            []string          `json:"allocate_by"`
+	RequiredTags          map[string]string `json:"required_tags,omitempty" ignored:"true"`
+	AllowUnderReplication bool              `json:"allow_under_replication,omitempty"`
+	Fallback              []*jsonConfig     `json:"fallback,omitempty" ignored:"true"`
+
+	CompositeWeights map[string]float64 `json:"composite_weights,omitempty" ignored:"true"`
 }
 
 // ConfigKey returns a human-friendly identifier for this
@@ -36,6 +71,10 @@ func (cfg *Config) ConfigKey() string {
 // Default initializes this Config with sensible values.
 func (cfg *Config) Default() error {
 	cfg.AllocateBy = DefaultAllocateBy
+	cfg.RequiredTags = nil
+	cfg.AllowUnderReplication = false
+	cfg.CompositeWeights = nil
+	cfg.Fallback = nil
 	return nil
 }
 
@@ -59,9 +98,46 @@ func (cfg *Config) Validate() error {
 		return errors.New("metricalloc.allocate_by is invalid")
 	}
 
+	if !validCompositeWeights(cfg.CompositeWeights, cfg.AllocateBy) {
+		return errors.New("metricalloc.composite_weights is invalid")
+	}
+
+	for _, fcfg := range cfg.Fallback {
+		if fcfg == nil || len(fcfg.AllocateBy) <= 0 {
+			return errors.New("metricalloc.fallback.allocate_by is invalid")
+		}
+		if len(fcfg.Fallback) > 0 {
+			return errors.New("metricalloc.fallback cannot be nested")
+		}
+		if !validCompositeWeights(fcfg.CompositeWeights, fcfg.AllocateBy) {
+			return errors.New("metricalloc.fallback.composite_weights is invalid")
+		}
+	}
+
 	return nil
 }
 
+// validCompositeWeights checks that the weights are finite, non-zero and
+// given for metrics in allocateBy.
+func validCompositeWeights(weights map[string]float64, allocateBy []string) bool {
+	for name, w := range weights {
+		if w == 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+			return false
+		}
+		found := false
+		for _, by := range allocateBy {
+			if by == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
 // LoadJSON parses a raw JSON byte-slice as generated by ToJSON().
 func (cfg *Config) LoadJSON(raw []byte) error {
 	jcfg := &jsonConfig{}
@@ -81,9 +157,32 @@ func (cfg *Config) applyJSONConfig(jcfg *jsonConfig) error {
 		cfg.AllocateBy = jcfg.AllocateBy
 	}
 
+	cfg.RequiredTags = jcfg.RequiredTags
+	cfg.AllowUnderReplication = jcfg.AllowUnderReplication
+	cfg.CompositeWeights = jcfg.CompositeWeights
+	cfg.Fallback = fallbackFromJSON(jcfg.Fallback)
+
 	return cfg.Validate()
 }
 
+// fallbackFromJSON converts the given fallback configurations, without
+// applying defaults.
+func fallbackFromJSON(jcfgs []*jsonConfig) []*Config {
+	var cfgs []*Config
+	for _, jcfg := range jcfgs {
+		cfg := &Config{}
+		if jcfg != nil {
+			cfg.AllocateBy = jcfg.AllocateBy
+			cfg.RequiredTags = jcfg.RequiredTags
+			cfg.AllowUnderReplication = jcfg.AllowUnderReplication
+			cfg.CompositeWeights = jcfg.CompositeWeights
+			cfg.Fallback = fallbackFromJSON(jcfg.Fallback)
+		}
+		cfgs = append(cfgs, cfg)
+	}
+	return cfgs
+}
+
 // ToJSON generates a human-friendly JSON representation of this Config.
 func (cfg *Config) ToJSON() ([]byte, error) {
 	jcfg := cfg.toJSONConfig()
@@ -92,9 +191,67 @@ func (cfg *Config) ToJSON() ([]byte, error) {
 }
 
 func (cfg *Config) toJSONConfig() *jsonConfig {
-	return &jsonConfig{
-		AllocateBy: cfg.AllocateBy,
+	jcfg := &jsonConfig{
+		AllocateBy:            cfg.AllocateBy,
+		RequiredTags:          cfg.RequiredTags,
+		AllowUnderReplication: cfg.AllowUnderReplication,
+		CompositeWeights:      cfg.CompositeWeights,
+	}
+	for _, fcfg := range cfg.Fallback {
+		jcfg.Fallback = append(jcfg.Fallback, fcfg.toJSONConfig())
+	}
+	return jcfg
+}
+
+// reloadableOptions are the values of the options which Reload can change
+// while allocations run.
+type reloadableOptions struct {
+	AllocateBy            []string
+	RequiredTags          map[string]string
+	AllowUnderReplication bool
+	CompositeWeights      map[string]float64
+}
+
+// reloadable returns the current values of the options which Reload can
+// change.
+func (cfg *Config) reloadable() reloadableOptions {
+	cfg.reloadMux.RLock()
+	defer cfg.reloadMux.RUnlock()
+	return reloadableOptions{
+		AllocateBy:            cfg.AllocateBy,
+		RequiredTags:          cfg.RequiredTags,
+		AllowUnderReplication: cfg.AllowUnderReplication,
+		CompositeWeights:      cfg.CompositeWeights,
+	}
+}
+
+// set replaces the options which Reload can change.
+func (cfg *Config) set(opts reloadableOptions) {
+	cfg.reloadMux.Lock()
+	defer cfg.reloadMux.Unlock()
+	cfg.AllocateBy = opts.AllocateBy
+	cfg.RequiredTags = opts.RequiredTags
+	cfg.AllowUnderReplication = opts.AllowUnderReplication
+	cfg.CompositeWeights = opts.CompositeWeights
+}
+
+// Reload applies allocate_by, required_tags, allow_under_replication and
+// composite_weights from the given Config, as allocations always read the
+// current values, and those of the fallbacks when their number does not
+// change. It implements config.Reloadable.
+func (cfg *Config) Reload(newComp config.ComponentConfig) ([]string, error) {
+	newCfg, ok := newComp.(*Config)
+	if !ok {
+		return nil, errors.New("expected a balanced allocator configuration")
+	}
+	cfg.set(newCfg.reloadable())
+	if len(cfg.Fallback) != len(newCfg.Fallback) {
+		return []string{"fallback"}, nil
+	}
+	for i, fcfg := range cfg.Fallback {
+		fcfg.set(newCfg.Fallback[i].reloadable())
 	}
+	return nil, nil
 }
 
 // ToDisplayJSON returns JSON config as a string.
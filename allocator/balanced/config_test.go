@@ -59,3 +59,132 @@ func TestApplyEnvVars(t *testing.T) {
 		t.Fatal("failed to override allocate_by with env var")
 	}
 }
+
+func TestFallback(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON([]byte(`
+{
+      "allocate_by": ["tag:region", "freespace"],
+      "fallback": [
+            {"allocate_by": ["freespace"]}
+      ]
+}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Fallback) != 1 || cfg.Fallback[0].AllocateBy[0] != "freespace" {
+		t.Fatal("fallback was not loaded")
+	}
+
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Fallback) != 1 {
+		t.Error("fallback was lost in serialization/deserialization")
+	}
+
+	cfg.Fallback[0].AllocateBy = nil
+	if cfg.Validate() == nil {
+		t.Error("expected error validating")
+	}
+
+	cfg.Fallback[0] = &Config{
+		AllocateBy: []string{"freespace"},
+		Fallback:   []*Config{{AllocateBy: []string{"numpin"}}},
+	}
+	if cfg.Validate() == nil {
+		t.Error("expected error validating nested fallbacks")
+	}
+}
+
+func TestRequiredTags(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON([]byte(`
+{
+      "allocate_by": ["tag:dc", "freespace"],
+      "required_tags": {"disk": "ssd"}
+}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RequiredTags["disk"] != "ssd" {
+		t.Fatal("required_tags was not loaded")
+	}
+
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.RequiredTags) != 1 {
+		t.Error("required_tags was lost in serialization/deserialization")
+	}
+}
+
+func TestAllowUnderReplicationConfig(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON([]byte(`
+{
+      "allocate_by": ["freespace"],
+      "allow_under_replication": true,
+      "fallback": [{"allocate_by": ["numpin"], "allow_under_replication": true}]
+}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.AllowUnderReplication || !cfg.Fallback[0].AllowUnderReplication {
+		t.Fatal("allow_under_replication was not loaded")
+	}
+
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.AllowUnderReplication || !cfg.Fallback[0].AllowUnderReplication {
+		t.Error("allow_under_replication was lost in serialization/deserialization")
+	}
+}
+
+func TestCompositeWeightsConfig(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON([]byte(`
+{
+      "allocate_by": ["tag:group", "freespace", "numpin"],
+      "composite_weights": {"freespace": 0.7, "numpin": -0.3}
+}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CompositeWeights["numpin"] != -0.3 {
+		t.Fatal("composite_weights was not loaded")
+	}
+
+	cfg.CompositeWeights["disk"] = 1
+	if cfg.Validate() == nil {
+		t.Error("expected error validating weights for metrics not in allocate_by")
+	}
+	delete(cfg.CompositeWeights, "disk")
+	cfg.CompositeWeights["freespace"] = 0
+	if cfg.Validate() == nil {
+		t.Error("expected error validating zero weights")
+	}
+}
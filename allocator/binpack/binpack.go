@@ -0,0 +1,140 @@
+// Package binpack implements an allocator that fills peers, one after the
+// other, up to a target utilization of their repository before allocating
+// to the next ones, instead of spreading the pins across the cluster.
+//
+// The utilization of a peer is derived from its freespace metric and the
+// repository capacity that the disk informer sends along with it.
+package binpack
+
+import (
+	"context"
+	"sort"
+
+	cid "github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log/v2"
+	api "github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/informer/disk"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+)
+
+var logger = logging.Logger("allocator")
+
+// metricName is the metric used to compute utilizations.
+var metricName = disk.MetricFreeSpace.String()
+
+// Allocator is an allocator that orders peers so that the fullest peer
+// under the target utilization comes first.
+type Allocator struct {
+	config    *Config
+	rpcClient *rpc.Client
+}
+
+// New returns an initialized Allocator.
+func New(cfg *Config) (*Allocator, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Allocator{
+		config: cfg,
+	}, nil
+}
+
+// SetClient provides us with an rpc.Client which allows
+// contacting other components in the cluster.
+func (a *Allocator) SetClient(c *rpc.Client) {
+	a.rpcClient = c
+}
+
+// Shutdown is called on cluster shutdown. We just invalidate
+// any metrics from this point.
+func (a *Allocator) Shutdown(ctx context.Context) error {
+	a.rpcClient = nil
+	return nil
+}
+
+// Allocate returns the priority peers and then the candidates, each in
+// binpack order:
+//
+//   - First, the peers under the target utilization, the fullest first, so
+//     that new pins keep going to the same peer until it crosses the target.
+//   - Then, the peers over the target, the least utilized first.
+//
+// Peers whose capacity is unknown count as full. Ties are broken by peer ID
+// so that all peers make the same choices.
+func (a *Allocator) Allocate(
+	ctx context.Context,
+	c cid.Cid,
+	current, candidates, priority api.MetricsSet,
+) ([]peer.ID, error) {
+	target := a.config.targetUtilization()
+
+	first := a.sortedPeers(priority[metricName], target)
+	last := a.sortedPeers(candidates[metricName], target)
+	return append(first, last...), nil
+}
+
+func (a *Allocator) sortedPeers(metrics []*api.Metric, target float64) []peer.ID {
+	type peerUtilization struct {
+		peer  peer.ID
+		util  float64
+		under bool
+	}
+
+	peers := make([]peerUtilization, 0, len(metrics))
+	for _, m := range metrics {
+		u := utilization(m)
+		peers = append(peers, peerUtilization{
+			peer:  m.Peer,
+			util:  u,
+			under: u < target,
+		})
+	}
+
+	sort.Slice(peers, func(i, j int) bool {
+		pi, pj := peers[i], peers[j]
+		switch {
+		case pi.under != pj.under:
+			return pi.under
+		case pi.util != pj.util && pi.under:
+			return pi.util > pj.util
+		case pi.util != pj.util:
+			return pi.util < pj.util
+		default:
+			return pi.peer < pj.peer
+		}
+	})
+
+	result := make([]peer.ID, 0, len(peers))
+	for _, p := range peers {
+		result = append(result, p.peer)
+	}
+	return result
+}
+
+// utilization returns the used fraction of the repository of the peer which
+// sent the given freespace metric, or 1 when its capacity is unknown.
+func utilization(m *api.Metric) float64 {
+	capacity := m.Capacity
+	if capacity == 0 {
+		logger.Debugf("%s: unknown capacity for peer %s", metricName, m.Peer)
+		return 1
+	}
+	free := m.GetWeight()
+	if free < 0 {
+		free = 0
+	}
+	u := 1 - float64(free)/float64(capacity)
+	if u < 0 {
+		return 0
+	}
+	return u
+}
+
+// Metrics returns the names of the metrics that have been registered
+// with this allocator.
+func (a *Allocator) Metrics() []string {
+	return []string{metricName}
+}
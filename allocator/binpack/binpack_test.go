@@ -0,0 +1,119 @@
+package binpack
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	api "github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+func makeMetric(p peer.ID, free int64, capacity uint64) *api.Metric {
+	return &api.Metric{
+		Name:     metricName,
+		Value:    fmt.Sprintf("%d", free),
+		Weight:   free,
+		Peer:     p,
+		Valid:    true,
+		Expire:   time.Now().Add(time.Minute).UnixNano(),
+		Capacity: capacity,
+	}
+}
+
+func TestAllocateFillsFirstPeer(t *testing.T) {
+	ctx := context.Background()
+	alloc, err := New(&Config{TargetUtilization: 0.8})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two peers with the same capacity. Every pin uses 10 units on the
+	// peer it is allocated to.
+	free := map[peer.ID]int64{
+		test.PeerID1: 100,
+		test.PeerID2: 100,
+	}
+	var allocs []peer.ID
+	for i := 0; i < 12; i++ {
+		candidates := api.MetricsSet{
+			metricName: []*api.Metric{
+				makeMetric(test.PeerID1, free[test.PeerID1], 100),
+				makeMetric(test.PeerID2, free[test.PeerID2], 100),
+			},
+		}
+		res, err := alloc.Allocate(ctx, test.Cid1, nil, candidates, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) != 2 {
+			t.Fatal("expected 2 peers")
+		}
+		allocs = append(allocs, res[0])
+		free[res[0]] -= 10
+	}
+
+	// The first peer chosen gets 8 pins, until it reaches 80%, and the
+	// rest spill to the other one.
+	first, second := allocs[0], test.PeerID1
+	if first == test.PeerID1 {
+		second = test.PeerID2
+	}
+	for i, p := range allocs {
+		expected := first
+		if i >= 8 {
+			expected = second
+		}
+		if p != expected {
+			t.Errorf("pin %d: expected %s, got %s", i, expected, p)
+		}
+	}
+}
+
+func TestAllocateOrder(t *testing.T) {
+	ctx := context.Background()
+	alloc, err := New(&Config{TargetUtilization: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unknown := makeMetric(test.PeerID5, 100, 0)
+	unknown.Tags = nil
+	candidates := api.MetricsSet{
+		metricName: []*api.Metric{
+			makeMetric(test.PeerID1, 90, 100), // 10%
+			makeMetric(test.PeerID2, 60, 100), // 40%
+			makeMetric(test.PeerID3, 10, 100), // 90% over target
+			makeMetric(test.PeerID4, 30, 100), // 70% over target
+			unknown,
+		},
+	}
+	priority := api.MetricsSet{
+		metricName: []*api.Metric{
+			makeMetric(test.PeerID6, 5, 100),
+		},
+	}
+
+	res, err := alloc.Allocate(ctx, test.Cid1, nil, candidates, priority)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []peer.ID{
+		test.PeerID6,
+		test.PeerID2,
+		test.PeerID1,
+		test.PeerID4,
+		test.PeerID3,
+		test.PeerID5,
+	}
+	if len(res) != len(expected) {
+		t.Fatalf("expected %d peers, got %d", len(expected), len(res))
+	}
+	for i, p := range expected {
+		if res[i] != p {
+			t.Errorf("%d: expected %s, got %s", i, p, res[i])
+		}
+	}
+}
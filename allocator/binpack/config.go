@@ -0,0 +1,131 @@
+package binpack
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/ipfs/ipfs-cluster/config"
+	"github.com/kelseyhightower/envconfig"
+)
+
+const configKey = "binpack"
+const envConfigKey = "cluster_binpack"
+
+// These are the default values for a Config.
+const (
+	DefaultTargetUtilization = 0.0
+)
+
+// Config allows to initialize the Allocator.
+type Config struct {
+	config.Saver
+
+	// reloadMux guards TargetUtilization, which Reload changes while
+	// allocations run.
+	reloadMux sync.RWMutex
+
+	// TargetUtilization is the fraction of the repository capacity,
+	// between 0 and 1, up to which peers are filled before allocating to
+	// the next ones. 0 disables the binpack allocator, in favour of the
+	// balanced one.
+	TargetUtilization float64
+}
+
+type jsonConfig struct {
+	TargetUtilization float64 `json:"target_utilization"`
+}
+
+// ConfigKey returns a human-friendly identifier for this
+// Config's type.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default initializes this Config with sensible values.
+func (cfg *Config) Default() error {
+	cfg.TargetUtilization = DefaultTargetUtilization
+	return nil
+}
+
+// ApplyEnvVars fills in any Config fields found
+// as environment variables.
+func (cfg *Config) ApplyEnvVars() error {
+	jcfg := cfg.toJSONConfig()
+
+	err := envconfig.Process(envConfigKey, jcfg)
+	if err != nil {
+		return err
+	}
+
+	return cfg.applyJSONConfig(jcfg)
+}
+
+// Validate checks that the fields of this configuration have
+// sensible values.
+func (cfg *Config) Validate() error {
+	if !(cfg.TargetUtilization >= 0 && cfg.TargetUtilization <= 1) {
+		return errors.New("binpack.target_utilization is invalid")
+	}
+	return nil
+}
+
+// LoadJSON parses a raw JSON byte-slice as generated by ToJSON().
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		return err
+	}
+
+	cfg.Default()
+
+	return cfg.applyJSONConfig(jcfg)
+}
+
+func (cfg *Config) applyJSONConfig(jcfg *jsonConfig) error {
+	cfg.TargetUtilization = jcfg.TargetUtilization
+	return cfg.Validate()
+}
+
+// ToJSON generates a human-friendly JSON representation of this Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := cfg.toJSONConfig()
+
+	return config.DefaultJSONMarshal(jcfg)
+}
+
+func (cfg *Config) toJSONConfig() *jsonConfig {
+	return &jsonConfig{
+		TargetUtilization: cfg.TargetUtilization,
+	}
+}
+
+// Reload applies target_utilization from the given Config, as allocations
+// always read the current value. Enabling or disabling the allocator
+// requires a restart. It implements config.Reloadable.
+func (cfg *Config) Reload(newComp config.ComponentConfig) ([]string, error) {
+	newCfg, ok := newComp.(*Config)
+	if !ok {
+		return nil, errors.New("expected a binpack allocator configuration")
+	}
+	if (cfg.targetUtilization() == 0) != (newCfg.targetUtilization() == 0) {
+		return []string{"target_utilization"}, nil
+	}
+	cfg.reloadMux.Lock()
+	cfg.TargetUtilization = newCfg.TargetUtilization
+	cfg.reloadMux.Unlock()
+	return nil, nil
+}
+
+// targetUtilization returns the current TargetUtilization.
+func (cfg *Config) targetUtilization() float64 {
+	cfg.reloadMux.RLock()
+	defer cfg.reloadMux.RUnlock()
+	return cfg.TargetUtilization
+}
+
+// ToDisplayJSON returns JSON config as a string.
+func (cfg *Config) ToDisplayJSON() ([]byte, error) {
+	return config.DisplayJSON(cfg.toJSONConfig())
+}
@@ -0,0 +1,70 @@
+package binpack
+
+import (
+	"os"
+	"testing"
+)
+
+var cfgJSON = []byte(`
+{
+      "target_utilization": 0.7
+}
+`)
+
+func TestLoadJSON(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON(cfgJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TargetUtilization != 0.7 {
+		t.Error("target_utilization not loaded")
+	}
+
+	err = cfg.LoadJSON([]byte(`{"target_utilization": 1.5}`))
+	if err == nil {
+		t.Error("expected error loading a target_utilization over 1")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TargetUtilization != 0.7 {
+		t.Error("configuration was lost in serialization/deserialization")
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if cfg.Validate() != nil {
+		t.Fatal("error validating")
+	}
+
+	cfg.TargetUtilization = -0.1
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
+
+func TestApplyEnvVars(t *testing.T) {
+	os.Setenv("CLUSTER_BINPACK_TARGETUTILIZATION", "0.9")
+	defer os.Unsetenv("CLUSTER_BINPACK_TARGETUTILIZATION")
+	cfg := &Config{}
+	cfg.Default()
+	cfg.ApplyEnvVars()
+
+	if cfg.TargetUtilization != 0.9 {
+		t.Fatal("failed to override target_utilization with env var")
+	}
+}
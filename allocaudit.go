@@ -0,0 +1,118 @@
+package ipfscluster
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"go.opencensus.io/trace"
+)
+
+// allocationAudit keeps the last allocation decisions made by this peer in a
+// ring buffer of AllocationAuditSize entries. Allocations made for dry runs
+// are not recorded. It is not persisted. A nil allocationAudit records
+// nothing.
+type allocationAudit struct {
+	mu        sync.RWMutex
+	decisions []*api.AllocationDecision
+	last      uint64
+}
+
+func newAllocationAudit(size int) *allocationAudit {
+	if size <= 0 {
+		return nil
+	}
+	return &allocationAudit{
+		decisions: make([]*api.AllocationDecision, size),
+	}
+}
+
+// record records the allocation of the given CID from the given classified
+// metrics.
+func (a *allocationAudit) record(hash cid.Cid, rplMin, rplMax int, metrics classifiedMetrics, allocs []peer.ID, err error) {
+	if a == nil {
+		return
+	}
+
+	d := &api.AllocationDecision{
+		Cid:                  hash,
+		Timestamp:            time.Now(),
+		ReplicationFactorMin: rplMin,
+		ReplicationFactorMax: rplMax,
+		Allocations:          allocs,
+	}
+	if err != nil {
+		d.Error = err.Error()
+	}
+
+	candidates := make(map[peer.ID]*api.AllocationCandidate)
+	addCandidates := func(mSet api.MetricsSet, current, priority bool) {
+		for name, metrics := range mSet {
+			for _, m := range metrics {
+				cand, ok := candidates[m.Peer]
+				if !ok {
+					cand = &api.AllocationCandidate{
+						Peer:     m.Peer,
+						Current:  current,
+						Priority: priority,
+						Scores:   make(map[string]int64),
+					}
+					candidates[m.Peer] = cand
+				}
+				cand.Scores[name] = m.GetWeight()
+			}
+		}
+	}
+	addCandidates(metrics.current, true, false)
+	addCandidates(metrics.priority, false, true)
+	addCandidates(metrics.candidate, false, false)
+
+	d.Candidates = make([]*api.AllocationCandidate, 0, len(candidates))
+	for _, cand := range candidates {
+		d.Candidates = append(d.Candidates, cand)
+	}
+	sort.Slice(d.Candidates, func(i, j int) bool {
+		return d.Candidates[i].Peer < d.Candidates[j].Peer
+	})
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.last++
+	a.decisions[a.last%uint64(len(a.decisions))] = d
+}
+
+// recent returns the decisions retained, the most recent first.
+func (a *allocationAudit) recent() []*api.AllocationDecision {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	n := a.last
+	if size := uint64(len(a.decisions)); n > size {
+		n = size
+	}
+	decisions := make([]*api.AllocationDecision, 0, n)
+	for s := a.last; s > a.last-n; s-- {
+		decisions = append(decisions, a.decisions[s%uint64(len(a.decisions))])
+	}
+	return decisions
+}
+
+// AllocationsAudit returns the last allocation decisions made by this peer,
+// the most recent first, to explain why items were allocated to some peers.
+// Only the peer which allocates an item (the one receiving the pin request)
+// records the decision.
+func (c *Cluster) AllocationsAudit(ctx context.Context) ([]*api.AllocationDecision, error) {
+	_, span := trace.StartSpan(ctx, "cluster/AllocationsAudit")
+	defer span.End()
+
+	if c.allocAudit == nil {
+		return nil, errors.New("the allocation audit is disabled (allocation_audit_size is 0)")
+	}
+	return c.allocAudit.recent(), nil
+}
@@ -1,12 +1,16 @@
 package api
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"net/url"
 	"strconv"
+	"strings"
 
 	cid "github.com/ipfs/go-cid"
+	chunker "github.com/ipfs/go-ipfs-chunker"
+	multihash "github.com/multiformats/go-multihash"
 )
 
 // DefaultShardSize is the shard size for params objects created with DefaultParams().
@@ -21,6 +25,13 @@ type AddedOutput struct {
 	Size  uint64  `json:"size,omitempty" codec:"s,omitempty"`
 }
 
+// Upload describes a resumable upload to the REST API: the data received
+// so far (Offset bytes) is kept until the upload is complete and added.
+type Upload struct {
+	ID     string `json:"id"`
+	Offset int64  `json:"offset"`
+}
+
 // IPFSAddParams groups options specific to the ipfs-adder, which builds
 // UnixFS dags with the input files. This struct is embedded in AddParams.
 type IPFSAddParams struct {
@@ -178,7 +189,11 @@ func AddParamsFromQuery(query url.Values) (*AddParams, error) {
 		return nil, err
 	}
 
-	// This mimics go-ipfs behaviour.
+	// This mimics go-ipfs behaviour: hash functions other than sha2-256
+	// need CIDv1, and CIDv1 implies raw leaves unless told otherwise.
+	if query.Get("cid-version") == "" && strings.ToLower(params.HashFun) != "sha2-256" {
+		params.CidVersion = 1
+	}
 	if params.CidVersion > 0 {
 		params.RawLeaves = true
 	}
@@ -201,9 +216,35 @@ func AddParamsFromQuery(query url.Values) (*AddParams, error) {
 		return nil, err
 	}
 
+	err = params.validateDAGParams()
+	if err != nil {
+		return nil, err
+	}
+
 	return params, nil
 }
 
+// validateDAGParams returns an error for DAG-building parameters, or
+// combinations of them, which the adder cannot honor.
+func (p *AddParams) validateDAGParams() error {
+	if p.CidVersion != 0 && p.CidVersion != 1 {
+		return errors.New("cid-version must be 0 or 1")
+	}
+
+	hashF, ok := multihash.Names[strings.ToLower(p.HashFun)]
+	if !ok {
+		return fmt.Errorf("unrecognized hash function: %s", p.HashFun)
+	}
+	if p.CidVersion == 0 && hashF != multihash.SHA2_256 {
+		return errors.New("cid-version 0 only supports the sha2-256 hash function")
+	}
+
+	if _, err := chunker.FromString(bytes.NewReader(nil), p.Chunker); err != nil {
+		return fmt.Errorf("chunker parameter is invalid: %w", err)
+	}
+	return nil
+}
+
 // ToQueryString returns a url query string (key=value&key2=value2&...)
 func (p *AddParams) ToQueryString() (string, error) {
 	pinOptsQuery, err := p.PinOptions.ToQuery()
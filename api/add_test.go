@@ -75,6 +75,42 @@ func TestAddParams_FromQueryRawLeaves(t *testing.T) {
 	}
 }
 
+func TestAddParams_FromQueryDAGParams(t *testing.T) {
+	q, err := url.ParseQuery("chunker=rabin-256-1024-4096&hash=blake2b-256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := AddParamsFromQuery(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Chunker != "rabin-256-1024-4096" || p.HashFun != "blake2b-256" {
+		t.Error("did not parse the query correctly")
+	}
+	if p.CidVersion != 1 || !p.RawLeaves {
+		t.Error("a non-default hash function should imply cid-version=1 and raw-leaves")
+	}
+
+	badQueries := []string{
+		"chunker=size-0",
+		"chunker=size-2000000",
+		"chunker=rabin-64-32-128",
+		"chunker=buzzhash",
+		"cid-version=2",
+		"cid-version=0&hash=blake2b-256",
+		"hash=nohash",
+	}
+	for _, qStr := range badQueries {
+		q, err := url.ParseQuery(qStr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := AddParamsFromQuery(q); err == nil {
+			t.Errorf("expected an error parsing %s", qStr)
+		}
+	}
+}
+
 func TestAddParams_ToQueryString(t *testing.T) {
 	p := DefaultAddParams()
 	p.ReplicationFactorMin = 3
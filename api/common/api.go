@@ -16,6 +16,7 @@ package common
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -126,7 +127,12 @@ func NewAPIWithHost(ctx context.Context, cfg *Config, h host.Host, routes func(*
 	// Our handler is a gorilla router wrapped with:
 	// - a custom strictSlashHandler that uses 307 redirects (#1415)
 	// - the cors handler,
-	// - the basic auth handler.
+	// - the basic auth handler,
+	// - the client certificate handler.
+	//
+	// Requests from trusted proxies get their remote address replaced
+	// with the one of the original client before anything else, so that
+	// it is used for logging.
 	//
 	// Requests will need to have valid credentials first, except
 	// cors-preflight requests (OPTIONS). Then requests are handled by
@@ -134,12 +140,17 @@ func NewAPIWithHost(ctx context.Context, cfg *Config, h host.Host, routes func(*
 	// redirected if the path ends with a "/". Finally they hit one of our
 	// routes and handlers.
 	router := mux.NewRouter()
-	handler := basicAuthHandler(
-		cfg.BasicAuthCredentials,
-		cors.New(*cfg.CorsOptions()).
-			Handler(
-				strictSlashHandler(router),
-			),
+	handler := clientCertHandler(
+		cfg.TLS,
+		cfg.ClientCertIdentities,
+		basicAuthHandler(
+			cfg.BasicAuthCredentials,
+			cors.New(*cfg.CorsOptions()).
+				Handler(
+					strictSlashHandler(router),
+				),
+			cfg.Logger,
+		),
 		cfg.Logger,
 	)
 	if cfg.Tracing {
@@ -162,7 +173,7 @@ func NewAPIWithHost(ctx context.Context, cfg *Config, h host.Host, routes func(*
 		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
 		WriteTimeout:      cfg.WriteTimeout,
 		IdleTimeout:       cfg.IdleTimeout,
-		Handler:           handlers.LoggingHandler(writer, handler),
+		Handler:           forwardedHandler(cfg.TrustedProxies, handlers.LoggingHandler(writer, handler)),
 		MaxHeaderBytes:    cfg.MaxHeaderBytes,
 	}
 
@@ -321,11 +332,127 @@ func basicAuthHandler(credentials map[string]string, h http.Handler, lggr *loggi
 			http.Error(w, resp, http.StatusUnauthorized)
 			return
 		}
-		h.ServeHTTP(w, r)
+		ctx := context.WithValue(r.Context(), basicAuthUserKey{}, username)
+		h.ServeHTTP(w, r.WithContext(ctx))
+	}
+	return http.HandlerFunc(wrap)
+}
+
+type basicAuthUserKey struct{}
+
+type clientIdentityKey struct{}
+
+// ClientIdentity returns the identity the client of the request
+// authenticated with: its basic authentication username or, otherwise,
+// the identity of its client certificate. It is empty when the API does
+// not require authentication.
+func ClientIdentity(r *http.Request) string {
+	if user, ok := r.Context().Value(basicAuthUserKey{}).(string); ok {
+		return user
+	}
+	return ClientCertIdentity(r)
+}
+
+// ClientCertIdentity returns the identity of the client certificate which
+// authorized the request, or an empty string when client certificates are
+// not used.
+func ClientCertIdentity(r *http.Request) string {
+	id, _ := r.Context().Value(clientIdentityKey{}).(string)
+	return id
+}
+
+// clientCertHandler wraps a given handler so that only requests with a
+// client certificate signed by the authorities configured in the TLS
+// configuration and matching one of the given identities (if any) are
+// served.
+func clientCertHandler(tlsCfg *tls.Config, identities []string, h http.Handler, lggr *logging.ZapEventLogger) http.Handler {
+	if tlsCfg == nil || tlsCfg.ClientCAs == nil {
+		return h
+	}
+
+	allowed := make(map[string]struct{}, len(identities))
+	for _, id := range identities {
+		allowed[id] = struct{}{}
+	}
+
+	wrap := func(w http.ResponseWriter, r *http.Request) {
+		// We let CORS preflight requests pass through the next
+		// handler.
+		if r.Method == http.MethodOptions {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		id, err := verifyClientCert(r, tlsCfg.ClientCAs, allowed)
+		if err != nil {
+			lggr.Debugf("rejecting request from %s: %s", r.RemoteAddr, err)
+			resp, err := unauthorizedResp()
+			if err != nil {
+				lggr.Error(err)
+				return
+			}
+			http.Error(w, resp, http.StatusUnauthorized)
+			return
+		}
+		ctx := context.WithValue(r.Context(), clientIdentityKey{}, id)
+		h.ServeHTTP(w, r.WithContext(ctx))
 	}
 	return http.HandlerFunc(wrap)
 }
 
+// verifyClientCert checks the client certificate of a request and returns
+// the identity it has been authorized with.
+func verifyClientCert(r *http.Request, roots *x509.CertPool, allowed map[string]struct{}) (string, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return "", errors.New("no client certificate")
+	}
+
+	certs := r.TLS.PeerCertificates
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if _, err := certs[0].Verify(opts); err != nil {
+		return "", err
+	}
+
+	ids := certIdentities(certs[0])
+	if len(allowed) == 0 {
+		if len(ids) == 0 {
+			return "", nil
+		}
+		return ids[0], nil
+	}
+	for _, id := range ids {
+		if _, ok := allowed[id]; ok {
+			return id, nil
+		}
+	}
+	return "", errors.New("client certificate identity not authorized")
+}
+
+// certIdentities returns the Common Name and the Subject Alternative Names
+// of a certificate.
+func certIdentities(cert *x509.Certificate) []string {
+	var ids []string
+	if cn := cert.Subject.CommonName; cn != "" {
+		ids = append(ids, cn)
+	}
+	ids = append(ids, cert.DNSNames...)
+	ids = append(ids, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		ids = append(ids, ip.String())
+	}
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+	return ids
+}
+
 // The Gorilla muxer StrictSlash option uses a 301 permanent redirect, which
 // results in POST requests becoming GET requests in most clients.  Thus we
 // use our own middleware that performs a 307 redirect.  See issue #1415 for
@@ -473,14 +600,19 @@ func (api *API) ParsePinPathOrFail(w http.ResponseWriter, r *http.Request) *type
 	vars := mux.Vars(r)
 	urlpath := "/" + vars["keyType"] + "/" + strings.TrimSuffix(vars["path"], "/")
 
-	path, err := gopath.ParsePath(urlpath)
-	if err != nil {
-		api.SendResponse(w, http.StatusBadRequest, errors.New("error parsing path: "+err.Error()), nil)
-		return nil
+	var pinPath *types.PinPath
+	if mfs := types.MFSPath(urlpath); mfs != "" {
+		// MFS paths are resolved by the IPFS daemon as they are.
+		pinPath = &types.PinPath{Path: types.MFSPathPrefix + strings.TrimPrefix(mfs, "/")}
+	} else {
+		path, err := gopath.ParsePath(urlpath)
+		if err != nil {
+			api.SendResponse(w, http.StatusBadRequest, errors.New("error parsing path: "+err.Error()), nil)
+			return nil
+		}
+		pinPath = &types.PinPath{Path: path.String()}
 	}
-
-	pinPath := &types.PinPath{Path: path.String()}
-	err = pinPath.PinOptions.FromQuery(r.URL.Query())
+	err := pinPath.PinOptions.FromQuery(r.URL.Query())
 	if err != nil {
 		api.SendResponse(w, http.StatusBadRequest, err, nil)
 	}
@@ -503,9 +635,7 @@ func (api *API) ParseCidOrFail(w http.ResponseWriter, r *http.Request) *types.Pi
 	if err != nil {
 		api.SendResponse(w, http.StatusBadRequest, err, nil)
 	}
-	pin := types.PinWithOpts(c, opts)
-	pin.MaxDepth = -1 // For now, all pins are recursive
-	return pin
+	return types.PinWithOpts(c, opts)
 }
 
 // ParsePidOrFail parses a PID and returns it or makes the request fail.
@@ -537,14 +667,16 @@ func (api *API) SendResponse(
 
 	// Send an error
 	if err != nil {
+		kind := types.KindOf(err)
 		if status == SetStatusAutomatically || status < 400 { // set a default error status
-			status = http.StatusInternalServerError
+			status = errorStatus(kind)
 		}
 		w.WriteHeader(status)
 
 		errorResp := types.Error{
 			Code:    status,
 			Message: err.Error(),
+			Kind:    kind,
 		}
 		api.config.Logger.Errorf("sending error response: %d: %s", status, err.Error())
 
@@ -576,6 +708,27 @@ func (api *API) SendResponse(
 	w.WriteHeader(status)
 }
 
+// errorStatus returns the HTTP status used for errors of the given kind
+// when no explicit one is given.
+func errorStatus(kind types.ErrorKind) int {
+	switch kind {
+	case types.ErrorKindNotFound:
+		return http.StatusNotFound
+	case types.ErrorKindTimeout:
+		return http.StatusGatewayTimeout
+	case types.ErrorKindNoSpace:
+		return http.StatusInsufficientStorage
+	case types.ErrorKindExpired:
+		return http.StatusGone
+	case types.ErrorKindForbidden:
+		return http.StatusForbidden
+	case types.ErrorKindInvalidMetadata:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 // SetsHeaders sets all the headers that are common to all responses
 // from this API. Called automatically from SendResponse().
 func (api *API) SetHeaders(w http.ResponseWriter) {
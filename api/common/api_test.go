@@ -2,8 +2,17 @@ package common
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math/big"
 	"math/rand"
 	"net/http"
 	"net/http/httputil"
@@ -491,6 +500,138 @@ func TestBasicAuth(t *testing.T) {
 	}
 }
 
+// makeTestCert creates a certificate with the given common name, signed by
+// the given parent or self-signed (a CA) when nil.
+func makeTestCert(t *testing.T, cn string, parent *tls.Certificate) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(rand.Int63()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	signer, signerKey := tmpl, interface{}(key)
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(crand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+}
+
+func TestClientCertAuth(t *testing.T) {
+	ctx := context.Background()
+	ca := makeTestCert(t, "ca", nil)
+	untrustedCA := makeTestCert(t, "untrusted ca", nil)
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate[0]})
+	if err := ioutil.WriteFile(caFile, caPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := newDefaultTestConfig(t)
+	cfg.PathSSLCertFile = SSLCertFile
+	cfg.PathSSLKeyFile = SSLKeyFile
+	cfg.PathClientCAFile = caFile
+	cfg.ClientCertIdentities = []string{"client"}
+	var err error
+	cfg.TLS, err = newTLSConfig(SSLCertFile, SSLKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := loadCertPool(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setClientCAs(cfg.TLS, pool)
+
+	var gotID string
+	rest, err := NewAPIWithHost(ctx, cfg, nil, func(c *rpc.Client) []Route {
+		return []Route{
+			{
+				"Test",
+				"GET",
+				"/test",
+				func(w http.ResponseWriter, r *http.Request) {
+					gotID = ClientCertIdentity(r)
+					w.Write([]byte(`{}`))
+				},
+			},
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rest.Shutdown(ctx)
+	rest.SetClient(rpctest.NewMockRPCClient(t))
+
+	serverCert, err := ioutil.ReadFile(SSLCertFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(serverCert)
+	addrs, _ := rest.HTTPAddresses()
+	url := "https://" + addrs[0] + "/test"
+
+	get := func(certs ...tls.Certificate) int {
+		c := &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					RootCAs:      roots,
+					Certificates: certs,
+				},
+			},
+		}
+		resp, err := c.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := get(makeTestCert(t, "client", &ca)); code != http.StatusOK {
+		t.Errorf("expected 200 with a valid client certificate: %d", code)
+	}
+	if gotID != "client" {
+		t.Errorf("expected the certificate identity: %q", gotID)
+	}
+
+	for name, certs := range map[string][]tls.Certificate{
+		"no certificate":        nil,
+		"untrusted certificate": {makeTestCert(t, "client", &untrustedCA)},
+		"unknown identity":      {makeTestCert(t, "other", &ca)},
+	} {
+		if code := get(certs...); code != http.StatusUnauthorized {
+			t.Errorf("expected 401 with %s: %d", name, code)
+		}
+	}
+}
+
 func TestLimitMaxHeaderSize(t *testing.T) {
 	maxHeaderBytes := 4 * DefaultMaxHeaderBytes
 	cfg := newTestConfig()
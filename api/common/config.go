@@ -2,11 +2,14 @@ package common
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
 	"time"
@@ -57,6 +60,19 @@ type Config struct {
 	// SSLKeyFile. We track it so we can write it in the JSON.
 	PathSSLKeyFile string
 
+	// PathClientCAFile is a path to a file with the PEM certificates of
+	// the authorities signing the certificates of the API clients. When
+	// set, requests must be made over TLS with a valid client
+	// certificate, so they are rejected on the libp2p endpoint. The
+	// authorities are loaded in TLS.ClientCAs.
+	PathClientCAFile string
+
+	// ClientCertIdentities lists the identities (the Common Name or any
+	// of the Subject Alternative Names of a client certificate) which
+	// are authorized to use the API. When empty, any certificate signed
+	// by the client authorities is authorized.
+	ClientCertIdentities []string
+
 	// Maximum duration before timing out reading a full request
 	ReadTimeout time.Duration
 
@@ -104,6 +120,11 @@ type Config struct {
 	CORSAllowCredentials bool
 	CORSMaxAge           time.Duration
 
+	// TrustedProxies lists the addresses of reverse proxies (single IPs
+	// or CIDR ranges) whose Forwarded and X-Forwarded-For headers are
+	// used to identify the clients that originated the requests.
+	TrustedProxies []*net.IPNet
+
 	// Tracing flag used to skip tracing specific paths when not enabled.
 	Tracing bool
 }
@@ -112,6 +133,8 @@ type jsonConfig struct {
 	HTTPListenMultiaddress ipfsconfig.Strings `json:"http_listen_multiaddress"`
 	SSLCertFile            string             `json:"ssl_cert_file,omitempty"`
 	SSLKeyFile             string             `json:"ssl_key_file,omitempty"`
+	ClientCAFile           string             `json:"client_ca_file,omitempty"`
+	ClientCertIdentities   []string           `json:"client_cert_identities,omitempty"`
 	ReadTimeout            string             `json:"read_timeout"`
 	ReadHeaderTimeout      string             `json:"read_header_timeout"`
 	WriteTimeout           string             `json:"write_timeout"`
@@ -132,6 +155,8 @@ type jsonConfig struct {
 	CORSExposedHeaders   []string `json:"cors_exposed_headers"`
 	CORSAllowCredentials bool     `json:"cors_allow_credentials"`
 	CORSMaxAge           string   `json:"cors_max_age"`
+
+	TrustedProxies []string `json:"trusted_proxies"`
 }
 
 // GetHTTPLogPath gets full path of the file where http logs should be
@@ -182,8 +207,12 @@ func (cfg *Config) Validate() error {
 		return fmt.Errorf(cfg.ConfigKey+".max_header_bytes must be not less then %d", minMaxHeaderBytes)
 	case cfg.BasicAuthCredentials != nil && len(cfg.BasicAuthCredentials) == 0:
 		return errors.New(cfg.ConfigKey + ".basic_auth_creds should be null or have at least one entry")
-	case (cfg.PathSSLCertFile != "" || cfg.PathSSLKeyFile != "") && cfg.TLS == nil:
+	case (cfg.PathSSLCertFile != "" || cfg.PathSSLKeyFile != "" || cfg.PathClientCAFile != "") && cfg.TLS == nil:
 		return errors.New(cfg.ConfigKey + ": missing TLS configuration")
+	case cfg.PathClientCAFile != "" && cfg.TLS.ClientCAs == nil:
+		return errors.New(cfg.ConfigKey + ": missing client certificate authorities")
+	case len(cfg.ClientCertIdentities) > 0 && cfg.PathClientCAFile == "":
+		return errors.New(cfg.ConfigKey + ".client_cert_identities needs a client_ca_file")
 	case (cfg.CORSMaxAge < 0):
 		return errors.New(cfg.ConfigKey + ".cors_max_age is invalid")
 	}
@@ -238,6 +267,7 @@ func (cfg *Config) applyJSONConfig(jcfg *jsonConfig) error {
 	cfg.BasicAuthCredentials = jcfg.BasicAuthCredentials
 	cfg.HTTPLogFile = jcfg.HTTPLogFile
 	cfg.Headers = jcfg.Headers
+	cfg.ClientCertIdentities = jcfg.ClientCertIdentities
 
 	return cfg.Validate()
 }
@@ -276,6 +306,12 @@ func (cfg *Config) loadHTTPOptions(jcfg *jsonConfig) error {
 		jcfg.CORSMaxAge = "0s"
 	}
 
+	trusted, err := parseTrustedProxies(jcfg.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("error parsing %s.trusted_proxies: %s", cfg.ConfigKey, err)
+	}
+	cfg.TrustedProxies = trusted
+
 	return config.ParseDurations(
 		cfg.ConfigKey,
 		&config.DurationOpt{Duration: jcfg.ReadTimeout, Dst: &cfg.ReadTimeout, Name: "read_timeout"},
@@ -289,6 +325,10 @@ func (cfg *Config) loadHTTPOptions(jcfg *jsonConfig) error {
 func (cfg *Config) tlsOptions(jcfg *jsonConfig) error {
 	cert := jcfg.SSLCertFile
 	key := jcfg.SSLKeyFile
+	ca := jcfg.ClientCAFile
+
+	// Validate() complains if a CA is set without a certificate.
+	cfg.PathClientCAFile = ca
 
 	if cert+key == "" {
 		return nil
@@ -312,6 +352,18 @@ func (cfg *Config) tlsOptions(jcfg *jsonConfig) error {
 	if err != nil {
 		return err
 	}
+
+	if ca != "" {
+		if !filepath.IsAbs(ca) {
+			ca = filepath.Join(cfg.BaseDir, ca)
+		}
+		pool, err := loadCertPool(ca)
+		if err != nil {
+			return err
+		}
+		setClientCAs(tlsCfg, pool)
+	}
+
 	cfg.TLS = tlsCfg
 	return nil
 }
@@ -376,6 +428,11 @@ func (cfg *Config) toJSONConfig() (jcfg *jsonConfig, err error) {
 		httpAddresses = append(httpAddresses, addr.String())
 	}
 
+	trustedProxies := make([]string, 0, len(cfg.TrustedProxies))
+	for _, n := range cfg.TrustedProxies {
+		trustedProxies = append(trustedProxies, n.String())
+	}
+
 	libp2pAddresses := make([]string, 0, len(cfg.Libp2pListenAddr))
 	for _, addr := range cfg.Libp2pListenAddr {
 		libp2pAddresses = append(libp2pAddresses, addr.String())
@@ -385,6 +442,8 @@ func (cfg *Config) toJSONConfig() (jcfg *jsonConfig, err error) {
 		HTTPListenMultiaddress: httpAddresses,
 		SSLCertFile:            cfg.PathSSLCertFile,
 		SSLKeyFile:             cfg.PathSSLKeyFile,
+		ClientCAFile:           cfg.PathClientCAFile,
+		ClientCertIdentities:   cfg.ClientCertIdentities,
 		ReadTimeout:            cfg.ReadTimeout.String(),
 		ReadHeaderTimeout:      cfg.ReadHeaderTimeout.String(),
 		WriteTimeout:           cfg.WriteTimeout.String(),
@@ -399,6 +458,7 @@ func (cfg *Config) toJSONConfig() (jcfg *jsonConfig, err error) {
 		CORSExposedHeaders:     cfg.CORSExposedHeaders,
 		CORSAllowCredentials:   cfg.CORSAllowCredentials,
 		CORSMaxAge:             cfg.CORSMaxAge.String(),
+		TrustedProxies:         trustedProxies,
 	}
 
 	if cfg.ID != "" {
@@ -477,3 +537,24 @@ func newTLSConfig(certFile, keyFile string) (*tls.Config, error) {
 		Certificates: []tls.Certificate{cert},
 	}, nil
 }
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.New("Error loading client CA certificates: " + err.Error())
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("Error loading client CA certificates: no certificates found in " + file)
+	}
+	return pool, nil
+}
+
+// setClientCAs makes the TLS listener ask for client certificates signed by
+// the given authorities. They are verified by the clientCertHandler rather
+// than during the handshake, so that the clients with untrusted
+// certificates get a 401 response.
+func setClientCAs(tlsCfg *tls.Config, pool *x509.CertPool) {
+	tlsCfg.ClientCAs = pool
+	tlsCfg.ClientAuth = tls.RequestClientCert
+}
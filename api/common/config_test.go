@@ -2,6 +2,7 @@ package common
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"os"
 	"testing"
@@ -49,6 +50,8 @@ func defaultFunc(cfg *Config) error {
 	cfg.HTTPListenAddr = addrs
 	cfg.PathSSLCertFile = ""
 	cfg.PathSSLKeyFile = ""
+	cfg.PathClientCAFile = ""
+	cfg.ClientCertIdentities = nil
 	cfg.ReadTimeout = DefaultReadTimeout
 	cfg.ReadHeaderTimeout = DefaultReadHeaderTimeout
 	cfg.WriteTimeout = DefaultWriteTimeout
@@ -178,6 +181,47 @@ func TestLoadJSON(t *testing.T) {
 		t.Error("expected error with TLS configuration")
 	}
 
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.ClientCAFile = "test/server.crt"
+	j.ClientCertIdentities = []string{"client"}
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TLS.ClientCAs == nil || cfg.TLS.ClientAuth != tls.RequestClientCert {
+		t.Error("expected client certificate authorities")
+	}
+	if len(cfg.ClientCertIdentities) != 1 || cfg.ClientCertIdentities[0] != "client" {
+		t.Error("error parsing client_cert_identities")
+	}
+
+	j.ClientCAFile = "abc"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with client_ca_file")
+	}
+
+	j.ClientCAFile = ""
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with client_cert_identities and no client_ca_file")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.SSLCertFile = ""
+	j.SSLKeyFile = ""
+	j.ClientCAFile = "test/server.crt"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with client_ca_file and no TLS configuration")
+	}
+
 	j = &jsonConfig{}
 	json.Unmarshal(cfgJSON, j)
 	j.ID = "abc"
@@ -213,6 +257,25 @@ func TestLoadJSON(t *testing.T) {
 	if err == nil {
 		t.Error("expected error with MaxHeaderBytes")
 	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.TrustedProxies = []string{"10.0.0.1", "192.168.0.0/16"}
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.TrustedProxies) != 2 || cfg.TrustedProxies[0].String() != "10.0.0.1/32" {
+		t.Error("error parsing trusted_proxies")
+	}
+
+	j.TrustedProxies = []string{"10.0.0.x"}
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with trusted_proxies")
+	}
 }
 
 func TestApplyEnvVars(t *testing.T) {
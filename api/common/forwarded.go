@@ -0,0 +1,134 @@
+package common
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// forwardedHandler sets the RemoteAddr of requests coming from trusted
+// proxies to the address of the client that originated them, as reported
+// by the Forwarded or X-Forwarded-For headers. Headers in requests from any
+// other address are ignored.
+func forwardedHandler(trusted []*net.IPNet, h http.Handler) http.Handler {
+	if len(trusted) == 0 {
+		return h
+	}
+
+	wrap := func(w http.ResponseWriter, r *http.Request) {
+		if ip := clientIP(trusted, r); ip != nil {
+			r2 := new(http.Request)
+			*r2 = *r
+			r2.RemoteAddr = net.JoinHostPort(ip.String(), "0")
+			r = r2
+		}
+		h.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(wrap)
+}
+
+// clientIP returns the address of the client behind the trusted proxies, or
+// nil when the request does not come from a trusted proxy or does not carry
+// forwarding headers. The chain of forwarded addresses is walked from the
+// closest hop and the first untrusted address is the client.
+func clientIP(trusted []*net.IPNet, r *http.Request) net.IP {
+	remote := parseIP(r.RemoteAddr)
+	if remote == nil || !isTrusted(trusted, remote) {
+		return nil
+	}
+
+	chain := forwardedFor(r.Header.Values("Forwarded"))
+	if len(chain) == 0 {
+		chain = xForwardedFor(r.Header.Values("X-Forwarded-For"))
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := parseIP(chain[i])
+		if ip == nil {
+			// garbage in the chain: we cannot tell who is behind.
+			return nil
+		}
+		if !isTrusted(trusted, ip) || i == 0 {
+			return ip
+		}
+	}
+	return nil
+}
+
+func isTrusted(trusted []*net.IPNet, ip net.IP) bool {
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIP parses addresses in the forms "ip", "ip:port", "[ipv6]" and
+// "[ipv6]:port".
+func parseIP(addr string) net.IP {
+	addr = strings.TrimSpace(addr)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	return net.ParseIP(addr)
+}
+
+// forwardedFor returns the "for" parameters of the elements in the given
+// Forwarded (RFC 7239) headers.
+func forwardedFor(headers []string) []string {
+	var chain []string
+	for _, h := range headers {
+		for _, elem := range strings.Split(h, ",") {
+			for _, pair := range strings.Split(elem, ";") {
+				kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(kv) != 2 || !strings.EqualFold(kv[0], "for") {
+					continue
+				}
+				chain = append(chain, strings.Trim(kv[1], `"`))
+			}
+		}
+	}
+	return chain
+}
+
+// xForwardedFor returns the addresses in the given X-Forwarded-For headers.
+func xForwardedFor(headers []string) []string {
+	var chain []string
+	for _, h := range headers {
+		for _, addr := range strings.Split(h, ",") {
+			chain = append(chain, strings.TrimSpace(addr))
+		}
+	}
+	return chain
+}
+
+// parseTrustedProxies parses a list of IP addresses and CIDR ranges.
+func parseTrustedProxies(addrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(addrs))
+	for _, a := range addrs {
+		if !strings.Contains(a, "/") {
+			ip := net.ParseIP(a)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: a}
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(a)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
@@ -0,0 +1,49 @@
+package common
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := parseTrustedProxies([]string{"10.0.0.1", "192.168.0.0/16", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		remote  string
+		headers map[string]string
+		client  string
+	}{
+		// not from a trusted proxy
+		{"1.2.3.4:5000", map[string]string{"X-Forwarded-For": "5.6.7.8"}, ""},
+		// no forwarding headers
+		{"10.0.0.1:5000", nil, ""},
+		{"10.0.0.1:5000", map[string]string{"X-Forwarded-For": "5.6.7.8"}, "5.6.7.8"},
+		{"[::1]:5000", map[string]string{"X-Forwarded-For": "5.6.7.8"}, "5.6.7.8"},
+		// spoofed entries before the first untrusted hop are ignored
+		{"10.0.0.1:5000", map[string]string{"X-Forwarded-For": "6.6.6.6, 5.6.7.8, 192.168.1.1"}, "5.6.7.8"},
+		// only trusted hops
+		{"10.0.0.1:5000", map[string]string{"X-Forwarded-For": "192.168.1.2, 192.168.1.1"}, "192.168.1.2"},
+		{"10.0.0.1:5000", map[string]string{"Forwarded": `for=5.6.7.8;proto=https, for="[2001:db8::1]:4711"`}, "2001:db8::1"},
+		// Forwarded takes precedence
+		{"10.0.0.1:5000", map[string]string{"Forwarded": "for=5.6.7.8", "X-Forwarded-For": "1.1.1.1"}, "5.6.7.8"},
+		{"10.0.0.1:5000", map[string]string{"Forwarded": "for=unknown"}, ""},
+	}
+
+	for _, tc := range testcases {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tc.remote
+		for k, v := range tc.headers {
+			r.Header.Set(k, v)
+		}
+		ip := clientIP(trusted, r)
+		switch {
+		case tc.client == "" && ip != nil:
+			t.Errorf("%s %v: expected no client, got %s", tc.remote, tc.headers, ip)
+		case tc.client != "" && (ip == nil || ip.String() != tc.client):
+			t.Errorf("%s %v: expected %s, got %s", tc.remote, tc.headers, tc.client, ip)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrorKind classifies the errors returned by cluster components so that
+// callers can handle them without matching on their messages, which may
+// change between versions. Kinds are stable.
+type ErrorKind string
+
+// Error kinds.
+const (
+	ErrorKindUnknown         ErrorKind = ""
+	ErrorKindNotFound        ErrorKind = "not_found"
+	ErrorKindNotLeader       ErrorKind = "not_leader"
+	ErrorKindUnderReplicated ErrorKind = "under_replicated"
+	ErrorKindPeerFull        ErrorKind = "peer_full"
+	ErrorKindTimeout         ErrorKind = "timeout"
+	ErrorKindReadOnly        ErrorKind = "read_only"
+	ErrorKindNoSpace         ErrorKind = "no_space"
+	ErrorKindExpired         ErrorKind = "expired"
+	ErrorKindLeaderless      ErrorKind = "leaderless"
+	ErrorKindForbidden       ErrorKind = "forbidden"
+	ErrorKindInvalidMetadata ErrorKind = "invalid_metadata"
+)
+
+// Errors of a well-known kind. Components wrap them (i.e. with
+// fmt.Errorf("%w")) to provide context.
+var (
+	// ErrNotFound is returned when an item is not part of the pinset.
+	ErrNotFound = errors.New("pin is not part of the pinset")
+	// ErrNotLeader is returned when an operation needs a consensus
+	// leader and none is available.
+	ErrNotLeader = errors.New("no leader available")
+	// ErrUnderReplicated is returned when an item cannot be allocated to
+	// as many peers as its minimum replication factor.
+	ErrUnderReplicated = errors.New("not enough peers to allocate")
+	// ErrPeerFull is returned when a peer has no space left to store an
+	// item.
+	ErrPeerFull = errors.New("peer is out of space")
+	// ErrTimeout is returned when an operation takes too long.
+	ErrTimeout = errors.New("operation timed out")
+	// ErrReadOnly is returned when a peer is not allowed to perform write
+	// operations.
+	ErrReadOnly = errors.New("write operations are disabled")
+	// ErrNoSpace is returned when not enough peers have room to store an
+	// item as many times as its minimum replication factor.
+	ErrNoSpace = errors.New("not enough free space in the cluster")
+	// ErrExpired is returned when the requested entries of a log are
+	// no longer retained.
+	ErrExpired = errors.New("requested entries no longer available")
+	// ErrLeaderless is returned when asking for the leader of a
+	// consensus component which does not have one by design.
+	ErrLeaderless = errors.New("consensus component does not provide a leader")
+	// ErrForbidden is returned when a client is not allowed to modify
+	// a pin because it does not own it.
+	ErrForbidden = errors.New("pin is owned by another client")
+	// ErrInvalidMetadata is returned when the metadata of a pin does
+	// not follow the metadata schema of the cluster.
+	ErrInvalidMetadata = errors.New("pin metadata does not follow the schema")
+)
+
+var errorKinds = []struct {
+	err  error
+	kind ErrorKind
+}{
+	{ErrNotFound, ErrorKindNotFound},
+	{ErrNotLeader, ErrorKindNotLeader},
+	{ErrUnderReplicated, ErrorKindUnderReplicated},
+	{ErrPeerFull, ErrorKindPeerFull},
+	{ErrTimeout, ErrorKindTimeout},
+	{context.DeadlineExceeded, ErrorKindTimeout},
+	{ErrReadOnly, ErrorKindReadOnly},
+	{ErrNoSpace, ErrorKindNoSpace},
+	{ErrExpired, ErrorKindExpired},
+	{ErrLeaderless, ErrorKindLeaderless},
+	{ErrForbidden, ErrorKindForbidden},
+	{ErrInvalidMetadata, ErrorKindInvalidMetadata},
+}
+
+// KindOf returns the ErrorKind of the given error, or ErrorKindUnknown.
+// Errors are matched with errors.Is and, since error types do not survive
+// RPC calls, by the message of the well-known errors they wrap.
+func KindOf(err error) ErrorKind {
+	if err == nil {
+		return ErrorKindUnknown
+	}
+
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.Kind != ErrorKindUnknown {
+		return apiErr.Kind
+	}
+
+	for _, ek := range errorKinds {
+		if errors.Is(err, ek.err) {
+			return ek.kind
+		}
+	}
+
+	msg := err.Error()
+	for _, ek := range errorKinds {
+		if strings.Contains(msg, ek.err.Error()) {
+			return ek.kind
+		}
+	}
+	return ErrorKindUnknown
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestKindOf(t *testing.T) {
+	testcases := []struct {
+		err  error
+		kind ErrorKind
+	}{
+		{nil, ErrorKindUnknown},
+		{errors.New("something"), ErrorKindUnknown},
+		{ErrNotFound, ErrorKindNotFound},
+		{fmt.Errorf("%w CID. Needed at least: 2", ErrUnderReplicated), ErrorKindUnderReplicated},
+		{fmt.Errorf("pinning: %w", context.DeadlineExceeded), ErrorKindTimeout},
+		// as received from an RPC call
+		{errors.New("follower mode: " + ErrReadOnly.Error()), ErrorKindReadOnly},
+		{&Error{Code: 500, Message: "full", Kind: ErrorKindPeerFull}, ErrorKindPeerFull},
+	}
+
+	for _, tc := range testcases {
+		if k := KindOf(tc.err); k != tc.kind {
+			t.Errorf("%v: expected kind %q, got %q", tc.err, tc.kind, k)
+		}
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	err := fmt.Errorf("unpinning: %w", &Error{Code: 404, Message: "not here", Kind: ErrorKindNotFound})
+	if !errors.Is(err, ErrNotFound) {
+		t.Error("expected a not found error")
+	}
+	if errors.Is(err, ErrTimeout) {
+		t.Error("did not expect a timeout error")
+	}
+	if errors.Is(&Error{Code: 500, Message: "boom"}, ErrNotFound) {
+		t.Error("errors without kind should not match")
+	}
+}
@@ -0,0 +1,204 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	host "github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	gostream "github.com/libp2p/go-libp2p-gostream"
+	"google.golang.org/grpc"
+)
+
+// addChunkSize is the size of the data sent in every message of the Add
+// stream.
+const addChunkSize = 256 * 1024
+
+// Client talks to the gRPC API.
+type Client struct {
+	conn grpc.ClientConnInterface
+}
+
+// NewClient returns a Client using the given connection, which can be
+// obtained with grpc.Dial. Use the BasicAuth option when the API requires
+// credentials and Libp2pDialer to reach it over libp2p.
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{conn: conn}
+}
+
+type basicAuth struct {
+	username string
+	password string
+}
+
+func (ba basicAuth) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	auth := base64.StdEncoding.EncodeToString([]byte(ba.username + ":" + ba.password))
+	return map[string]string{"authorization": "Basic " + auth}, nil
+}
+
+// The REST API allows basic auth over plain HTTP too.
+func (ba basicAuth) RequireTransportSecurity() bool {
+	return false
+}
+
+// BasicAuth returns a dial option which sends the given credentials with
+// every request.
+func BasicAuth(username, password string) grpc.DialOption {
+	return grpc.WithPerRPCCredentials(basicAuth{username: username, password: password})
+}
+
+// Libp2pDialer returns a dial option which connects to the API served by
+// the given peer over libp2p, using the given Host. The dial target is then
+// only used as a name for the connection.
+func Libp2pDialer(h host.Host, p peer.ID) grpc.DialOption {
+	return grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return gostream.Dial(ctx, h, p, ProtocolID)
+	})
+}
+
+func (c *Client) invoke(ctx context.Context, method string, in, out interface{}) error {
+	return c.conn.Invoke(ctx, "/"+ServiceName+"/"+method, in, out, grpc.CallContentSubtype(codecName))
+}
+
+func (c *Client) newStream(ctx context.Context, desc *grpc.StreamDesc) (grpc.ClientStream, error) {
+	return c.conn.NewStream(ctx, desc, "/"+ServiceName+"/"+desc.StreamName, grpc.CallContentSubtype(codecName))
+}
+
+// Pin pins an item with the options in the given pin.
+func (c *Client) Pin(ctx context.Context, pin *api.Pin) (*api.Pin, error) {
+	var out api.Pin
+	err := c.invoke(ctx, "Pin", pin, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Unpin unpins an item.
+func (c *Client) Unpin(ctx context.Context, ci cid.Cid) (*api.Pin, error) {
+	var out api.Pin
+	err := c.invoke(ctx, "Unpin", api.PinCid(ci), &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Status returns the status of an item in all the peers or, when local is
+// set, only in the peer serving the request.
+func (c *Client) Status(ctx context.Context, ci cid.Cid, local bool) (*api.GlobalPinInfo, error) {
+	var out api.GlobalPinInfo
+	err := c.invoke(ctx, "Status", &StatusRequest{Cid: ci, Local: local}, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// StatusAll sends the status of the items matching the filter to the given
+// channel as they are received. The channel is closed when done.
+func (c *Client) StatusAll(ctx context.Context, filter api.TrackerStatus, local bool, out chan<- *api.GlobalPinInfo) error {
+	defer close(out)
+
+	stream, err := c.newStream(ctx, &serviceDesc.Streams[0])
+	if err != nil {
+		return err
+	}
+	err = stream.SendMsg(&StatusAllRequest{Filter: filter, Local: local})
+	if err != nil {
+		return err
+	}
+	err = stream.CloseSend()
+	if err != nil {
+		return err
+	}
+
+	for {
+		gpi := &api.GlobalPinInfo{}
+		err := stream.RecvMsg(gpi)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		select {
+		case out <- gpi:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Add adds the content read from r as a file with the given name, sending
+// the outputs for the added nodes to the given channel as they are
+// received. The channel is closed when done.
+func (c *Client) Add(ctx context.Context, name string, r io.Reader, params *api.AddParams, out chan<- *api.AddedOutput) error {
+	defer close(out)
+
+	query, err := params.ToQueryString()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.newStream(ctx, &serviceDesc.Streams[1])
+	if err != nil {
+		return err
+	}
+
+	// Outputs are received while sending, otherwise the server may stop
+	// reading when it cannot send them.
+	readErr := make(chan error, 1)
+	go func() {
+		// Send errors are received by RecvMsg.
+		if err := stream.SendMsg(&AddRequest{Params: query, Name: name}); err != nil {
+			return
+		}
+		buf := make([]byte, addChunkSize)
+		var err error
+		for err == nil {
+			var n int
+			n, err = r.Read(buf)
+			if n > 0 {
+				if err := stream.SendMsg(&AddRequest{Data: buf[:n]}); err != nil {
+					return
+				}
+			}
+		}
+		if err != io.EOF {
+			readErr <- err
+			cancel()
+			return
+		}
+		stream.CloseSend()
+	}()
+
+	for {
+		output := &api.AddedOutput{}
+		err := stream.RecvMsg(output)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			select {
+			case rerr := <-readErr:
+				return rerr
+			default:
+				return err
+			}
+		}
+		select {
+		case out <- output:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
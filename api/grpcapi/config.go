@@ -0,0 +1,163 @@
+package grpcapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	ipfsconfig "github.com/ipfs/go-ipfs-config"
+	"github.com/kelseyhightower/envconfig"
+	ma "github.com/multiformats/go-multiaddr"
+
+	"github.com/ipfs/ipfs-cluster/config"
+)
+
+const (
+	configKey    = "grpcapi"
+	envConfigKey = "cluster_grpcapi"
+)
+
+// DefaultListenAddrs contains the default listeners for the gRPC API.
+var DefaultListenAddrs = []string{
+	"/ip4/127.0.0.1/tcp/9097",
+}
+
+// Config allows to customize the behaviour of the gRPC API.
+// It implements the config.ComponentConfig interface.
+type Config struct {
+	config.Saver
+
+	// Listen parameters for the gRPC API.
+	ListenAddr []ma.Multiaddr
+
+	// BasicAuthCredentials is a map of username-password pairs which
+	// are authorized to use the API. When nil, any request is accepted.
+	BasicAuthCredentials map[string]string
+}
+
+type jsonConfig struct {
+	ListenMultiaddress   ipfsconfig.Strings `json:"listen_multiaddress"`
+	BasicAuthCredentials map[string]string  `json:"basic_auth_credentials" hidden:"true"`
+}
+
+// ConfigKey provides a human-friendly identifier for this type of Config.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default sets the fields of this Config to sensible default values.
+func (cfg *Config) Default() error {
+	listen := make([]ma.Multiaddr, 0, len(DefaultListenAddrs))
+	for _, def := range DefaultListenAddrs {
+		a, err := ma.NewMultiaddr(def)
+		if err != nil {
+			return err
+		}
+		listen = append(listen, a)
+	}
+	cfg.ListenAddr = listen
+	cfg.BasicAuthCredentials = nil
+	return nil
+}
+
+// ApplyEnvVars fills in any Config fields found
+// as environment variables.
+func (cfg *Config) ApplyEnvVars() error {
+	jcfg, err := cfg.toJSONConfig()
+	if err != nil {
+		return err
+	}
+
+	err = envconfig.Process(envConfigKey, jcfg)
+	if err != nil {
+		return err
+	}
+
+	return cfg.applyJSONConfig(jcfg)
+}
+
+// Validate checks that the fields of this Config have sensible values,
+// at least in appearance.
+func (cfg *Config) Validate() error {
+	if len(cfg.ListenAddr) == 0 {
+		return errors.New("grpcapi.listen_multiaddress not set")
+	}
+	if cfg.BasicAuthCredentials != nil && len(cfg.BasicAuthCredentials) == 0 {
+		return errors.New("grpcapi.basic_auth_creds should be null or have at least one entry")
+	}
+	return nil
+}
+
+// LoadJSON parses a JSON representation of this Config as generated by ToJSON.
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		logger.Error("Error unmarshaling grpcapi config")
+		return err
+	}
+
+	err = cfg.Default()
+	if err != nil {
+		return fmt.Errorf("error setting config to default values: %s", err)
+	}
+
+	return cfg.applyJSONConfig(jcfg)
+}
+
+func (cfg *Config) applyJSONConfig(jcfg *jsonConfig) error {
+	if addresses := jcfg.ListenMultiaddress; len(addresses) > 0 {
+		cfg.ListenAddr = make([]ma.Multiaddr, 0, len(addresses))
+		for _, a := range addresses {
+			listenAddr, err := ma.NewMultiaddr(a)
+			if err != nil {
+				return fmt.Errorf("error parsing grpcapi listen_multiaddress: %s", err)
+			}
+			cfg.ListenAddr = append(cfg.ListenAddr, listenAddr)
+		}
+	}
+	cfg.BasicAuthCredentials = jcfg.BasicAuthCredentials
+
+	return cfg.Validate()
+}
+
+// ToJSON generates a human-friendly JSON representation of this Config.
+func (cfg *Config) ToJSON() (raw []byte, err error) {
+	jcfg, err := cfg.toJSONConfig()
+	if err != nil {
+		return
+	}
+
+	raw, err = config.DefaultJSONMarshal(jcfg)
+	return
+}
+
+func (cfg *Config) toJSONConfig() (jcfg *jsonConfig, err error) {
+	// Multiaddress String() may panic
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s", r)
+		}
+	}()
+
+	addresses := make([]string, 0, len(cfg.ListenAddr))
+	for _, a := range cfg.ListenAddr {
+		addresses = append(addresses, a.String())
+	}
+
+	jcfg = &jsonConfig{
+		ListenMultiaddress:   addresses,
+		BasicAuthCredentials: cfg.BasicAuthCredentials,
+	}
+	return
+}
+
+// ToDisplayJSON returns JSON config as a string.
+func (cfg *Config) ToDisplayJSON() ([]byte, error) {
+	jcfg, err := cfg.toJSONConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return config.DisplayJSON(jcfg)
+}
@@ -0,0 +1,95 @@
+package grpcapi
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+var cfgJSON = []byte(`
+{
+	"listen_multiaddress": "/ip4/127.0.0.1/tcp/9097",
+	"basic_auth_credentials": {
+		"user": "pass"
+	}
+}
+`)
+
+func TestLoadEmptyJSON(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON([]byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	cfg := &Config{}
+	err := cfg.LoadJSON(cfgJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BasicAuthCredentials["user"] != "pass" {
+		t.Error("expected basic auth credentials")
+	}
+
+	j := &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.ListenMultiaddress = []string{"abc"}
+	tst, _ := json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error decoding listen_multiaddress")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.BasicAuthCredentials = map[string]string{}
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with empty basic_auth_credentials")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	cfg := &Config{}
+	cfg.LoadJSON(cfgJSON)
+	newjson, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{}
+	err = cfg.LoadJSON(newjson)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BasicAuthCredentials["user"] != "pass" {
+		t.Error("expected basic auth credentials")
+	}
+}
+
+func TestDefault(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	if cfg.Validate() != nil {
+		t.Fatal("error validating")
+	}
+
+	cfg.ListenAddr = nil
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
+
+func TestApplyEnvVars(t *testing.T) {
+	os.Setenv("CLUSTER_GRPCAPI_LISTENMULTIADDRESS", "/ip4/127.0.0.1/tcp/10097")
+	defer os.Unsetenv("CLUSTER_GRPCAPI_LISTENMULTIADDRESS")
+	cfg := &Config{}
+	cfg.Default()
+	cfg.ApplyEnvVars()
+
+	if len(cfg.ListenAddr) != 1 || cfg.ListenAddr[0].String() != "/ip4/127.0.0.1/tcp/10097" {
+		t.Error("failed to override listen_multiaddress with env var")
+	}
+}
@@ -0,0 +1,448 @@
+// Package grpcapi implements a gRPC API for IPFS Cluster. It offers a subset
+// of the operations of the REST API (pinning, unpinning, status and adding)
+// for clients which prefer gRPC and its streaming RPCs.
+//
+// The service is described by hand rather than generated from a protobuf
+// file: messages are the types from the api package encoded as JSON, using
+// the "json" content-subtype. The Client in this package takes care of it.
+package grpcapi
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/ipfs/ipfs-cluster/adder"
+	"github.com/ipfs/ipfs-cluster/adder/sharding"
+	"github.com/ipfs/ipfs-cluster/adder/single"
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/rpcutil"
+	"github.com/ipfs/ipfs-cluster/state"
+
+	cid "github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	logging "github.com/ipfs/go-log/v2"
+	host "github.com/libp2p/go-libp2p-core/host"
+	protocol "github.com/libp2p/go-libp2p-core/protocol"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+	gostream "github.com/libp2p/go-libp2p-gostream"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"go.opencensus.io/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var logger = logging.Logger("grpcapi")
+
+// ProtocolID is the libp2p protocol used to serve the gRPC API on a libp2p
+// host.
+const ProtocolID = protocol.ID("/ipfs-cluster/grpc/1.0.0")
+
+// Server offers the gRPC API. It implements the ipfscluster.API interface.
+type Server struct {
+	ctx    context.Context
+	cancel func()
+
+	config *Config
+
+	rpcClient *rpc.Client
+	rpcReady  chan struct{}
+
+	host           host.Host
+	server         *grpc.Server
+	listeners      []net.Listener
+	libp2pListener net.Listener
+
+	shutdownLock sync.Mutex
+	shutdown     bool
+	wg           sync.WaitGroup
+}
+
+// New returns a gRPC API component listening on the configured addresses.
+func New(ctx context.Context, cfg *Config) (*Server, error) {
+	return NewWithHost(ctx, cfg, nil)
+}
+
+// NewWithHost returns a gRPC API component which, besides the configured
+// addresses, serves the API on the given libp2p Host, if not nil, using
+// ProtocolID.
+func NewWithHost(ctx context.Context, cfg *Config, h host.Host) (*Server, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	s := &Server{
+		ctx:      ctx,
+		cancel:   cancel,
+		config:   cfg,
+		rpcReady: make(chan struct{}),
+		host:     h,
+	}
+	s.server = grpc.NewServer(
+		grpc.UnaryInterceptor(s.unaryAuthInterceptor),
+		grpc.StreamInterceptor(s.streamAuthInterceptor),
+	)
+	s.server.RegisterService(&serviceDesc, s)
+
+	for _, listenMAddr := range cfg.ListenAddr {
+		n, addr, err := manet.DialArgs(listenMAddr)
+		if err != nil {
+			s.closeListeners()
+			cancel()
+			return nil, err
+		}
+		l, err := net.Listen(n, addr)
+		if err != nil {
+			s.closeListeners()
+			cancel()
+			return nil, err
+		}
+		s.listeners = append(s.listeners, l)
+	}
+
+	if h != nil {
+		l, err := gostream.Listen(h, ProtocolID)
+		if err != nil {
+			s.closeListeners()
+			cancel()
+			return nil, err
+		}
+		s.libp2pListener = l
+	}
+
+	s.run()
+	return s, nil
+}
+
+func (s *Server) run() {
+	s.wg.Add(len(s.listeners))
+	for _, l := range s.listeners {
+		go func(l net.Listener) {
+			defer s.wg.Done()
+			s.serve(l, "gRPC")
+		}(l)
+	}
+
+	if s.libp2pListener != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serve(s.libp2pListener, "libp2p-gRPC")
+		}()
+	}
+}
+
+// runs in goroutine from run()
+func (s *Server) serve(l net.Listener, kind string) {
+	select {
+	case <-s.rpcReady:
+	case <-s.ctx.Done():
+		return
+	}
+
+	if kind == "gRPC" {
+		maddr, err := manet.FromNetAddr(l.Addr())
+		if err != nil {
+			logger.Error(err)
+		}
+		logger.Infof("GRPCAPI (%s): %s", kind, maddr)
+	} else {
+		logger.Infof("GRPCAPI (%s): ENABLED on %s/p2p/%s", kind, ProtocolID, s.host.ID())
+	}
+
+	err := s.server.Serve(l)
+	if err != nil && err != grpc.ErrServerStopped {
+		logger.Error(err)
+	}
+}
+
+func (s *Server) closeListeners() {
+	for _, l := range s.listeners {
+		l.Close()
+	}
+	if s.libp2pListener != nil {
+		s.libp2pListener.Close()
+	}
+}
+
+// SetClient makes the component ready to perform RPC requests.
+func (s *Server) SetClient(c *rpc.Client) {
+	s.rpcClient = c
+	close(s.rpcReady)
+}
+
+// Shutdown stops the API listeners and any ongoing requests.
+func (s *Server) Shutdown(ctx context.Context) error {
+	_, span := trace.StartSpan(ctx, "grpcapi/Shutdown")
+	defer span.End()
+
+	s.shutdownLock.Lock()
+	defer s.shutdownLock.Unlock()
+
+	if s.shutdown {
+		logger.Debug("already shutdown")
+		return nil
+	}
+
+	logger.Info("stopping gRPC API")
+
+	s.cancel()
+	s.server.Stop()
+	// Listeners which were never served are not closed by Stop().
+	s.closeListeners()
+	s.wg.Wait()
+	s.shutdown = true
+	return nil
+}
+
+// Addresses returns the addresses of the TCP listeners of the API.
+func (s *Server) Addresses() []string {
+	addrs := make([]string, 0, len(s.listeners))
+	for _, l := range s.listeners {
+		addrs = append(addrs, l.Addr().String())
+	}
+	return addrs
+}
+
+func (s *Server) unaryAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	user, err := s.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(api.WithClientIdentity(ctx, user), req)
+}
+
+func (s *Server) streamAuthInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if _, err := s.authorize(stream.Context()); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// authorize checks the basic auth credentials sent in the authorization
+// metadata of a request, like the REST API does with the Authorization
+// header, and returns the username they belong to.
+func (s *Server) authorize(ctx context.Context) (string, error) {
+	credentials := s.config.BasicAuthCredentials
+	if credentials == nil {
+		return "", nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, auth := range md.Get("authorization") {
+		username, password, ok := parseBasicAuth(auth)
+		if !ok {
+			continue
+		}
+		if p, found := credentials[username]; found && p == password {
+			return username, nil
+		}
+	}
+	return "", status.Error(codes.Unauthenticated, "Unauthorized")
+}
+
+func parseBasicAuth(auth string) (username, password string, ok bool) {
+	const prefix = "Basic "
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return
+	}
+	decoded, err := base64.StdEncoding.DecodeString(auth[len(prefix):])
+	if err != nil {
+		return
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return
+	}
+	return parts[0], parts[1], true
+}
+
+// rpcError converts the errors returned by RPC calls so that clients get
+// a meaningful code.
+func rpcError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if err.Error() == state.ErrNotFound.Error() {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	if api.KindOf(err) == api.ErrorKindForbidden {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+// Pin pins an item. Its options are taken from the given pin.
+func (s *Server) Pin(ctx context.Context, in *api.Pin) (*api.Pin, error) {
+	var pin api.Pin
+	err := s.rpcClient.CallContext(
+		ctx,
+		"",
+		"Cluster",
+		"Pin",
+		in,
+		&pin,
+	)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return &pin, nil
+}
+
+// Unpin unpins an item. The tombstone of the item records the user the
+// client authenticated with.
+func (s *Server) Unpin(ctx context.Context, in *api.Pin) (*api.Pin, error) {
+	var pin api.Pin
+	err := s.rpcClient.CallContext(
+		ctx,
+		"",
+		"Cluster",
+		"Unpin",
+		in,
+		&pin,
+	)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return &pin, nil
+}
+
+// Status returns the status of an item.
+func (s *Server) Status(ctx context.Context, in *StatusRequest) (*api.GlobalPinInfo, error) {
+	gpi, err := s.pinStatus(ctx, in.Cid, in.Local)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return gpi, nil
+}
+
+// StatusAll streams the status of all the items matching the filter as it
+// is obtained, a page at a time (see rpcutil.StatusAllPaged).
+func (s *Server) StatusAll(in *StatusAllRequest, stream grpc.ServerStream) error {
+	var sendErr error
+	err := rpcutil.StatusAllPaged(stream.Context(), s.rpcClient, in.Filter, in.Local, func(gpi *api.GlobalPinInfo) error {
+		sendErr = stream.SendMsg(gpi)
+		return sendErr
+	})
+	if sendErr != nil {
+		return sendErr
+	}
+	if err != nil {
+		return rpcError(err)
+	}
+	return nil
+}
+
+func (s *Server) pinStatus(ctx context.Context, c cid.Cid, local bool) (*api.GlobalPinInfo, error) {
+	if local {
+		var pinInfo api.PinInfo
+		err := s.rpcClient.CallContext(
+			ctx,
+			"",
+			"Cluster",
+			"StatusLocal",
+			c,
+			&pinInfo,
+		)
+		return pinInfo.ToGlobal(), err
+	}
+
+	var pinInfo api.GlobalPinInfo
+	err := s.rpcClient.CallContext(
+		ctx,
+		"",
+		"Cluster",
+		"Status",
+		c,
+		&pinInfo,
+	)
+	return &pinInfo, err
+}
+
+// Add adds the file sent in the stream of AddRequests, streaming back the
+// AddedOutput of the added nodes.
+func (s *Server) Add(stream grpc.ServerStream) error {
+	ctx := stream.Context()
+
+	first := &AddRequest{}
+	if err := stream.RecvMsg(first); err != nil {
+		return err
+	}
+	query, err := url.ParseQuery(first.Params)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	params, err := api.AddParamsFromQuery(query)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// The rest of the messages are piped into the file being added.
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		if _, err := pw.Write(first.Data); err != nil {
+			return
+		}
+		for {
+			req := &AddRequest{}
+			err := stream.RecvMsg(req)
+			if err == io.EOF {
+				pw.Close()
+				return
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			if _, err := pw.Write(req.Data); err != nil {
+				return
+			}
+		}
+	}()
+
+	name := first.Name
+	if name == "" {
+		name = "file"
+	}
+	dir := files.NewMapDirectory(map[string]files.Node{
+		name: files.NewReaderFile(pr),
+	})
+
+	output := make(chan *api.AddedOutput, 200)
+	var dags adder.ClusterDAGService
+	if params.Shard {
+		dags = sharding.New(s.rpcClient, params.PinOptions, output)
+	} else {
+		dags = single.New(s.rpcClient, params.PinOptions, params.Local)
+	}
+
+	var sendErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for out := range output {
+			if sendErr != nil {
+				continue // keep draining
+			}
+			sendErr = stream.SendMsg(out)
+		}
+	}()
+
+	_, err = adder.New(dags, params, output).FromFiles(ctx, dir)
+	<-done
+	if err != nil {
+		logger.Error(err)
+		return rpcError(err)
+	}
+	return sendErr
+}
@@ -0,0 +1,255 @@
+package grpcapi
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/rpcutil"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	cid "github.com/ipfs/go-cid"
+	libp2p "github.com/libp2p/go-libp2p"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func testServer(t *testing.T, creds map[string]string) *Server {
+	ctx := context.Background()
+	cfg := &Config{}
+	cfg.Default()
+	cfg.ListenAddr = []ma.Multiaddr{ma.StringCast("/ip4/127.0.0.1/tcp/0")}
+	cfg.BasicAuthCredentials = creds
+
+	s, err := New(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetClient(test.NewMockRPCClient(t))
+	return s
+}
+
+func testClient(t *testing.T, s *Server, opts ...grpc.DialOption) *Client {
+	opts = append(opts, grpc.WithInsecure())
+	conn, err := grpc.Dial(s.Addresses()[0], opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewClient(conn)
+}
+
+func TestPinUnpin(t *testing.T) {
+	ctx := context.Background()
+	s := testServer(t, nil)
+	defer s.Shutdown(ctx)
+	c := testClient(t, s)
+
+	pin := api.PinCid(test.Cid1)
+	pin.Name = "abc"
+	out, err := c.Pin(ctx, pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !out.Cid.Equals(test.Cid1) || out.Name != "abc" {
+		t.Errorf("unexpected pin: %+v", out)
+	}
+
+	_, err = c.Pin(ctx, api.PinCid(test.ErrorCid))
+	if err == nil {
+		t.Error("expected an error pinning")
+	}
+
+	out, err = c.Unpin(ctx, test.Cid1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !out.Cid.Equals(test.Cid1) {
+		t.Errorf("unexpected pin: %+v", out)
+	}
+
+	_, err = c.Unpin(ctx, test.NotFoundCid)
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound unpinning a missing item: %s", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	ctx := context.Background()
+	s := testServer(t, nil)
+	defer s.Shutdown(ctx)
+	c := testClient(t, s)
+
+	gpi, err := c.Status(ctx, test.Cid1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, ok := gpi.PeerMap[peer.Encode(test.PeerID1)]
+	if !gpi.Cid.Equals(test.Cid1) || !ok || info.Status != api.TrackerStatusPinned {
+		t.Errorf("unexpected status: %+v", gpi)
+	}
+
+	gpi, err = c.Status(ctx, test.Cid1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := gpi.PeerMap[peer.Encode(test.PeerID2)]; !ok {
+		t.Errorf("expected the local status: %+v", gpi)
+	}
+}
+
+func statusAll(t *testing.T, c *Client, filter api.TrackerStatus, local bool) []*api.GlobalPinInfo {
+	out := make(chan *api.GlobalPinInfo)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.StatusAll(context.Background(), filter, local, out)
+	}()
+
+	var gpis []*api.GlobalPinInfo
+	for gpi := range out {
+		gpis = append(gpis, gpi)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+	return gpis
+}
+
+func TestStatusAll(t *testing.T) {
+	ctx := context.Background()
+	defer func(n int) { rpcutil.StatusPageSize = n }(rpcutil.StatusPageSize)
+	rpcutil.StatusPageSize = 2 // more than one page
+	s := testServer(t, nil)
+	defer s.Shutdown(ctx)
+	c := testClient(t, s)
+
+	gpis := statusAll(t, c, api.TrackerStatusUndefined, false)
+	if len(gpis) != 3 {
+		t.Fatalf("expected 3 items; got %d", len(gpis))
+	}
+	for i, ci := range []cid.Cid{test.Cid1, test.Cid2, test.Cid3} {
+		if !gpis[i].Cid.Equals(ci) {
+			t.Errorf("unexpected item %d: %s", i, gpis[i].Cid)
+		}
+	}
+
+	gpis = statusAll(t, c, api.TrackerStatusPinned, true)
+	if len(gpis) != 1 {
+		t.Fatalf("expected 1 local item; got %d", len(gpis))
+	}
+	if _, ok := gpis[0].PeerMap[peer.Encode(test.PeerID1)]; !ok || !gpis[0].Cid.Equals(test.Cid1) {
+		t.Errorf("expected the local status: %+v", gpis[0])
+	}
+
+	gpis = statusAll(t, c, api.TrackerStatusPinError, false)
+	if len(gpis) != 1 || !gpis[0].Cid.Equals(test.Cid3) {
+		t.Errorf("expected one item in error; got %d", len(gpis))
+	}
+}
+
+func TestAdd(t *testing.T) {
+	ctx := context.Background()
+	s := testServer(t, nil)
+	defer s.Shutdown(ctx)
+	c := testClient(t, s)
+
+	data := make([]byte, 3*addChunkSize+100)
+	rand.Read(data)
+
+	params := api.DefaultAddParams()
+	params.Name = "random"
+	out := make(chan *api.AddedOutput, 10)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.Add(ctx, "random", bytes.NewReader(data), params, out)
+	}()
+
+	var last *api.AddedOutput
+	for o := range out {
+		last = o
+	}
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+	if last == nil || last.Name != "random" || !last.Cid.Defined() {
+		t.Fatalf("unexpected output: %+v", last)
+	}
+	if last.Size < uint64(len(data)) {
+		t.Errorf("expected the size of the file: %d", last.Size)
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	ctx := context.Background()
+	s := testServer(t, map[string]string{"user": "pass"})
+	defer s.Shutdown(ctx)
+
+	for _, c := range []*Client{
+		testClient(t, s),
+		testClient(t, s, BasicAuth("user", "wrong")),
+	} {
+		_, err := c.Status(ctx, test.Cid1, false)
+		if status.Code(err) != codes.Unauthenticated {
+			t.Errorf("expected Unauthenticated: %s", err)
+		}
+		out := make(chan *api.GlobalPinInfo)
+		go func() {
+			for range out {
+			}
+		}()
+		err = c.StatusAll(ctx, api.TrackerStatusUndefined, false, out)
+		if status.Code(err) != codes.Unauthenticated {
+			t.Errorf("expected Unauthenticated streaming: %s", err)
+		}
+	}
+
+	c := testClient(t, s, BasicAuth("user", "pass"))
+	if _, err := c.Status(ctx, test.Cid1, false); err != nil {
+		t.Error(err)
+	}
+	if gpis := statusAll(t, c, api.TrackerStatusUndefined, false); len(gpis) != 3 {
+		t.Errorf("expected 3 items; got %d", len(gpis))
+	}
+}
+
+func TestLibp2p(t *testing.T) {
+	ctx := context.Background()
+	listen := libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0")
+	h1, err := libp2p.New(listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h1.Close()
+	h2, err := libp2p.New(listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h2.Close()
+	h2.Peerstore().AddAddrs(h1.ID(), h1.Addrs(), time.Hour)
+
+	cfg := &Config{}
+	cfg.Default()
+	cfg.ListenAddr = []ma.Multiaddr{ma.StringCast("/ip4/127.0.0.1/tcp/0")}
+	s, err := NewWithHost(ctx, cfg, h1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(ctx)
+	s.SetClient(test.NewMockRPCClient(t))
+
+	conn, err := grpc.Dial(h1.ID().String(), grpc.WithInsecure(), Libp2pDialer(h2, h1.ID()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if gpis := statusAll(t, NewClient(conn), api.TrackerStatusUndefined, false); len(gpis) != 3 {
+		t.Errorf("expected 3 items; got %d", len(gpis))
+	}
+}
@@ -0,0 +1,158 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// ServiceName is the name of the gRPC service offered by the Server.
+const ServiceName = "ipfscluster.Cluster"
+
+// codecName is the content-subtype used by the service. Messages are the
+// api types encoded as JSON, like in the REST API, so that no generated
+// protobuf code is needed to talk to it.
+const codecName = "json"
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return codecName
+}
+
+// StatusRequest is the request of the Status method.
+type StatusRequest struct {
+	Cid cid.Cid `json:"cid"`
+	// Local only returns the status of the item in the peer serving the
+	// request.
+	Local bool `json:"local,omitempty"`
+}
+
+// StatusAllRequest is the request of the StatusAll method.
+type StatusAllRequest struct {
+	// Filter only returns the items with some peer in one of the given
+	// statuses.
+	Filter api.TrackerStatus `json:"filter,omitempty"`
+	// Local only returns the status of the items in the peer serving
+	// the request.
+	Local bool `json:"local,omitempty"`
+}
+
+// AddRequest is a message of the Add stream. The first message sets the
+// parameters and the name of the file, which are ignored afterwards. The
+// data of every message is appended to the file.
+type AddRequest struct {
+	// Params are the add parameters encoded as a query string, like for
+	// the /add endpoint of the REST API.
+	Params string `json:"params,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Data   []byte `json:"data,omitempty"`
+}
+
+// clusterServer is implemented by the Server.
+type clusterServer interface {
+	Pin(context.Context, *api.Pin) (*api.Pin, error)
+	Unpin(context.Context, *api.Pin) (*api.Pin, error)
+	Status(context.Context, *StatusRequest) (*api.GlobalPinInfo, error)
+	StatusAll(*StatusAllRequest, grpc.ServerStream) error
+	Add(grpc.ServerStream) error
+}
+
+func unaryHandler(
+	method string,
+	newIn func() interface{},
+	call func(clusterServer, context.Context, interface{}) (interface{}, error),
+) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := newIn()
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(srv.(clusterServer), ctx, req)
+		}
+		if interceptor == nil {
+			return handler(ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: "/" + ServiceName + "/" + method,
+		}
+		return interceptor(ctx, in, info, handler)
+	}
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*clusterServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Pin",
+			Handler: unaryHandler(
+				"Pin",
+				func() interface{} { return &api.Pin{} },
+				func(s clusterServer, ctx context.Context, in interface{}) (interface{}, error) {
+					return s.Pin(ctx, in.(*api.Pin))
+				},
+			),
+		},
+		{
+			MethodName: "Unpin",
+			Handler: unaryHandler(
+				"Unpin",
+				func() interface{} { return &api.Pin{} },
+				func(s clusterServer, ctx context.Context, in interface{}) (interface{}, error) {
+					return s.Unpin(ctx, in.(*api.Pin))
+				},
+			),
+		},
+		{
+			MethodName: "Status",
+			Handler: unaryHandler(
+				"Status",
+				func() interface{} { return &StatusRequest{} },
+				func(s clusterServer, ctx context.Context, in interface{}) (interface{}, error) {
+					return s.Status(ctx, in.(*StatusRequest))
+				},
+			),
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "StatusAll",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				in := &StatusAllRequest{}
+				if err := stream.RecvMsg(in); err != nil {
+					return err
+				}
+				return srv.(clusterServer).StatusAll(in, stream)
+			},
+			ServerStreams: true,
+		},
+		{
+			StreamName: "Add",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				return srv.(clusterServer).Add(stream)
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+}
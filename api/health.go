@@ -0,0 +1,52 @@
+package api
+
+import (
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// HealthStatus is the overall health of a cluster peer.
+type HealthStatus string
+
+// Health statuses.
+const (
+	// HealthOK means that IPFS and consensus work and that all the peers
+	// in the peerset are alive.
+	HealthOK HealthStatus = "OK"
+	// HealthDegraded means that this peer works but some peers in the
+	// peerset have stopped sending their ping metrics.
+	HealthDegraded HealthStatus = "DEGRADED"
+	// HealthDown means that IPFS is unreachable or consensus does not
+	// work, so this peer cannot pin.
+	HealthDown HealthStatus = "DOWN"
+)
+
+// Health summarizes the status of a cluster peer and of the components it
+// depends on.
+type Health struct {
+	Peer   peer.ID      `json:"peer" codec:"p,omitempty"`
+	Status HealthStatus `json:"status" codec:"s,omitempty"`
+	// IPFSError is set when the IPFS daemon cannot be reached.
+	IPFSError string `json:"ipfs_error,omitempty" codec:"ie,omitempty"`
+	// ConsensusError is set when the consensus component is not ready or
+	// fails to provide the peerset.
+	ConsensusError string `json:"consensus_error,omitempty" codec:"ce,omitempty"`
+	// Leader is the consensus leader, if the consensus component has
+	// one, and IsLeader whether it is this peer.
+	Leader   peer.ID `json:"leader,omitempty" codec:"l,omitempty"`
+	IsLeader bool    `json:"is_leader" codec:"il,omitempty"`
+	// AlertingPeers is the number of peers in the peerset without a
+	// valid ping metric.
+	AlertingPeers int `json:"alerting_peers" codec:"a,omitempty"`
+}
+
+// Rollup sets the Status from the rest of the fields.
+func (h *Health) Rollup() {
+	switch {
+	case h.IPFSError != "" || h.ConsensusError != "":
+		h.Status = HealthDown
+	case h.AlertingPeers > 0:
+		h.Status = HealthDegraded
+	default:
+		h.Status = HealthOK
+	}
+}
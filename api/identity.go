@@ -0,0 +1,40 @@
+package api
+
+import "context"
+
+type clientIdentityKey struct{}
+
+// WithClientIdentity returns a copy of ctx marking it as the context of a
+// request from an API client, which authenticated with the given identity
+// (empty when it did not authenticate). API components set it on the
+// context of the RPC calls they make on behalf of their clients, so that
+// the cluster can record it (i.e. in the Tombstone of the items it unpins)
+// and enforce pin ownership. Only local RPC calls carry context values:
+// neither other peers nor the arguments of a call can set it.
+func WithClientIdentity(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, clientIdentityKey{}, id)
+}
+
+// ClientIdentity returns the identity set in ctx with WithClientIdentity,
+// or an empty string.
+func ClientIdentity(ctx context.Context) string {
+	id, _ := ctx.Value(clientIdentityKey{}).(string)
+	return id
+}
+
+// IsClientRequest returns true when ctx has been marked with
+// WithClientIdentity as the context of a request from an API client.
+func IsClientRequest(ctx context.Context) bool {
+	_, ok := ctx.Value(clientIdentityKey{}).(string)
+	return ok
+}
+
+// CopyClientIdentity returns a copy of ctx carrying the client identity of
+// from, if it is the context of a request from an API client.
+func CopyClientIdentity(ctx, from context.Context) context.Context {
+	id, ok := from.Value(clientIdentityKey{}).(string)
+	if !ok {
+		return ctx
+	}
+	return WithClientIdentity(ctx, id)
+}
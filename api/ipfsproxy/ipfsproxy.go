@@ -354,8 +354,11 @@ func (proxy *Server) pinOpHandler(op string, w http.ResponseWriter, r *http.Requ
 	pinPath := &api.PinPath{Path: p.String()}
 	pinPath.Mode = api.PinModeFromString(q.Get("type"))
 
+	// The proxy does not authenticate its clients: they modify pins as
+	// anonymous API clients.
 	var pin api.Pin
-	err = proxy.rpcClient.Call(
+	err = proxy.rpcClient.CallContext(
+		api.WithClientIdentity(r.Context(), ""),
 		"",
 		"Cluster",
 		op,
@@ -440,6 +443,7 @@ func (proxy *Server) pinLsHandler(w http.ResponseWriter, r *http.Request) {
 func (proxy *Server) pinUpdateHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, span := trace.StartSpan(r.Context(), "ipfsproxy/pinUpdateHandler")
 	defer span.End()
+	ctx = api.WithClientIdentity(ctx, "") // see pinOpHandler
 
 	proxy.setHeaders(w.Header(), r)
 
@@ -492,7 +496,8 @@ func (proxy *Server) pinUpdateHandler(w http.ResponseWriter, r *http.Request) {
 	pinPath.PinUpdate = fromCid
 
 	var pin api.Pin
-	err = proxy.rpcClient.Call(
+	err = proxy.rpcClient.CallContext(
+		ctx,
 		"",
 		"Cluster",
 		"PinPath",
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// MetadataKeySchema constrains the value of a pin metadata key.
+type MetadataKeySchema struct {
+	// Required rejects pins without the key.
+	Required bool
+	// AllowedValues, when set, lists the only values the key can take.
+	AllowedValues []string
+	// Regexp, when set, must match the value of the key.
+	Regexp *regexp.Regexp
+}
+
+// MetadataSchema constrains the metadata of the pins, by key, so that all
+// clients of a cluster use the same keys and values. Keys not included in
+// the schema are allowed. Schemas are defined in the cluster configuration.
+type MetadataSchema map[string]*MetadataKeySchema
+
+// Check returns an error wrapping ErrInvalidMetadata when the given
+// metadata does not follow the schema. Keys are checked in order.
+func (s MetadataSchema) Check(meta map[string]string) error {
+	keys := make([]string, 0, len(s))
+	for k := range s {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		ks := s[k]
+		v, ok := meta[k]
+		if !ok {
+			if ks.Required {
+				return fmt.Errorf("%w: missing required key %q", ErrInvalidMetadata, k)
+			}
+			continue
+		}
+		if len(ks.AllowedValues) > 0 && !containsString(ks.AllowedValues, v) {
+			return fmt.Errorf("%w: %q is not an allowed value for key %q (allowed: %v)", ErrInvalidMetadata, v, k, ks.AllowedValues)
+		}
+		if ks.Regexp != nil && !ks.Regexp.MatchString(v) {
+			return fmt.Errorf("%w: value %q of key %q does not match %s", ErrInvalidMetadata, v, k, ks.Regexp)
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
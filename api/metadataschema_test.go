@@ -0,0 +1,42 @@
+package api
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+)
+
+func TestMetadataSchemaCheck(t *testing.T) {
+	schema := MetadataSchema{
+		"team": {Required: true, AllowedValues: []string{"media", "search"}},
+		"ttl":  {Regexp: regexp.MustCompile(`^[0-9]+d$`)},
+	}
+
+	valid := []map[string]string{
+		{"team": "media"},
+		{"team": "search", "ttl": "30d", "other": "anything"},
+	}
+	for _, meta := range valid {
+		if err := schema.Check(meta); err != nil {
+			t.Errorf("%v: %s", meta, err)
+		}
+	}
+
+	invalid := []map[string]string{
+		nil,
+		{"ttl": "30d"},
+		{"team": "ads"},
+		{"team": "media", "ttl": "forever"},
+	}
+	for _, meta := range invalid {
+		err := schema.Check(meta)
+		if !errors.Is(err, ErrInvalidMetadata) {
+			t.Errorf("%v: expected an invalid metadata error: %v", meta, err)
+		}
+	}
+
+	var none MetadataSchema
+	if err := none.Check(nil); err != nil {
+		t.Error("an empty schema should allow anything")
+	}
+}
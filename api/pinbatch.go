@@ -0,0 +1,39 @@
+package api
+
+import (
+	cid "github.com/ipfs/go-cid"
+)
+
+// PinBatch is a set of pins submitted together.
+type PinBatch struct {
+	// Pins are the items to pin, with their options. Other fields are
+	// ignored.
+	Pins []*Pin `json:"pins" codec:"p,omitempty"`
+	// Atomic makes the batch all-or-nothing: no pin is committed unless
+	// all of them are valid, and those committed are rolled back when
+	// committing one of them fails. Otherwise, the valid pins are
+	// committed and the failures reported.
+	Atomic bool `json:"atomic" codec:"a,omitempty"`
+}
+
+// PinBatchItem is the result of pinning one of the items of a batch.
+type PinBatchItem struct {
+	Cid cid.Cid `json:"cid" codec:"c"`
+	// Pin is the pin as committed, when it was.
+	Pin *Pin `json:"pin,omitempty" codec:"p,omitempty"`
+	// Error explains why the item was not pinned.
+	Error string `json:"error,omitempty" codec:"e,omitempty"`
+}
+
+// PinBatchResult is the result of pinning a batch.
+type PinBatchResult struct {
+	// Items holds the results of the pins of the batch, in order.
+	Items []PinBatchItem `json:"items" codec:"i,omitempty"`
+	// Pinned is the number of pins committed, and not rolled back.
+	Pinned int `json:"pinned" codec:"p,omitempty"`
+	// Failed is the number of pins which could not be committed.
+	Failed int `json:"failed" codec:"f,omitempty"`
+	// RolledBack is set when an atomic batch failed after some of its
+	// pins had been committed and these were reverted.
+	RolledBack bool `json:"rolled_back,omitempty" codec:"r,omitempty"`
+}
@@ -0,0 +1,43 @@
+package api
+
+// PinStatusSummary counts the statuses of the items in the pinset.
+type PinStatusSummary struct {
+	// Items is the number of items whose status was obtained.
+	Items int `json:"items"`
+	// Statuses counts the status of every item on every peer, indexed by
+	// the string form of the TrackerStatus.
+	Statuses map[string]int `json:"statuses"`
+	// Peers holds the same counts for each peer, when requested. Peers
+	// are indexed by their encoded ID.
+	Peers map[string]map[string]int `json:"peers,omitempty"`
+}
+
+// NewPinStatusSummary returns an empty summary. When byPeer is set, the
+// counts are broken down per peer too.
+func NewPinStatusSummary(byPeer bool) *PinStatusSummary {
+	s := &PinStatusSummary{
+		Statuses: make(map[string]int),
+	}
+	if byPeer {
+		s.Peers = make(map[string]map[string]int)
+	}
+	return s
+}
+
+// Add counts the statuses of the given item.
+func (s *PinStatusSummary) Add(gpi *GlobalPinInfo) {
+	s.Items++
+	for p, pi := range gpi.PeerMap {
+		st := pi.Status.String()
+		s.Statuses[st]++
+		if s.Peers == nil {
+			continue
+		}
+		counts, ok := s.Peers[p]
+		if !ok {
+			counts = make(map[string]int)
+			s.Peers[p] = counts
+		}
+		counts[st]++
+	}
+}
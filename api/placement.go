@@ -0,0 +1,235 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PlacementRuleKind identifies the type of a PlacementRule.
+type PlacementRuleKind int
+
+// Placement rule kinds.
+const (
+	// PlacementRequire only allows peers with the given tag value.
+	PlacementRequire PlacementRuleKind = iota
+	// PlacementExclude does not allow peers with the given tag value.
+	PlacementExclude
+	// PlacementPrefer allocates peers with the given tag value first.
+	PlacementPrefer
+	// PlacementMinPer asks for at least N replicas on peers with each of
+	// the values of the given tag.
+	PlacementMinPer
+	// PlacementMaxPer allows at most N replicas on peers with the same
+	// value of the given tag.
+	PlacementMaxPer
+	// PlacementSame puts all the replicas on peers with the same value
+	// of the given tag.
+	PlacementSame
+)
+
+// Pin metadata keys which add placement rules to those in the Placement
+// option. Their values are comma-separated lists of tags.
+const (
+	// AffinityMetaKey lists tags whose value must be the same for all
+	// the allocations of the pin.
+	AffinityMetaKey = "affinity"
+	// AntiAffinityMetaKey lists tags whose value must be different for
+	// every allocation of the pin.
+	AntiAffinityMetaKey = "anti_affinity"
+)
+
+// PlacementRule is a single constraint of a Placement expression.
+type PlacementRule struct {
+	Kind  PlacementRuleKind
+	Tag   string
+	Value string
+	N     int
+}
+
+// String returns the rule in the placement expression syntax.
+func (r PlacementRule) String() string {
+	switch r.Kind {
+	case PlacementRequire:
+		return r.Tag + "=" + r.Value
+	case PlacementExclude:
+		return r.Tag + "!=" + r.Value
+	case PlacementPrefer:
+		return "prefer " + r.Tag + "=" + r.Value
+	case PlacementMinPer:
+		return r.Tag + ">=" + strconv.Itoa(r.N)
+	case PlacementMaxPer:
+		return r.Tag + "<=" + strconv.Itoa(r.N)
+	case PlacementSame:
+		return "same " + r.Tag
+	default:
+		return ""
+	}
+}
+
+// Placement is a list of rules over the tags of the peers (as provided by
+// the tags informer) which constrain where the replicas of an item are
+// allocated.
+type Placement []PlacementRule
+
+// ParsePlacement parses a placement expression: a comma-separated list of
+// rules, each of them in one of these forms:
+//
+//	tag=value         only allocate to peers with this tag value
+//	tag!=value        do not allocate to peers with this tag value
+//	prefer tag=value  allocate to peers with this tag value first
+//	tag>=N            at least N replicas on every value of the tag
+//	tag<=N            at most N replicas on the same value of the tag
+//	same tag          all replicas on the same value of the tag
+//
+// For example: "region>=1,rack<=2,prefer disk=ssd".
+func ParsePlacement(expr string) (Placement, error) {
+	var placement Placement
+	for _, rule := range strings.Split(expr, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		r, err := parsePlacementRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("bad placement rule %q: %w", rule, err)
+		}
+		placement = append(placement, r)
+	}
+	return placement, nil
+}
+
+func parsePlacementRule(rule string) (PlacementRule, error) {
+	if strings.HasPrefix(rule, "same ") {
+		r := PlacementRule{
+			Kind: PlacementSame,
+			Tag:  strings.TrimSpace(strings.TrimPrefix(rule, "same ")),
+		}
+		if r.Tag == "" || strings.ContainsAny(r.Tag, " =!<>") {
+			return r, errors.New("bad tag name")
+		}
+		return r, nil
+	}
+
+	if strings.HasPrefix(rule, "prefer ") {
+		r, err := parsePlacementRule(strings.TrimSpace(strings.TrimPrefix(rule, "prefer ")))
+		if err != nil {
+			return r, err
+		}
+		if r.Kind != PlacementRequire {
+			return r, errors.New("prefer only supports tag=value")
+		}
+		r.Kind = PlacementPrefer
+		return r, nil
+	}
+
+	ops := []struct {
+		op   string
+		kind PlacementRuleKind
+	}{
+		{">=", PlacementMinPer},
+		{"<=", PlacementMaxPer},
+		{"!=", PlacementExclude},
+		{"=", PlacementRequire},
+	}
+	for _, o := range ops {
+		i := strings.Index(rule, o.op)
+		if i < 0 {
+			continue
+		}
+		r := PlacementRule{
+			Kind: o.kind,
+			Tag:  strings.TrimSpace(rule[:i]),
+		}
+		arg := strings.TrimSpace(rule[i+len(o.op):])
+		if r.Tag == "" || strings.ContainsAny(r.Tag, " =!<>") {
+			return r, errors.New("bad tag name")
+		}
+		if arg == "" {
+			return r, errors.New("missing value")
+		}
+
+		switch o.kind {
+		case PlacementMinPer, PlacementMaxPer:
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 1 {
+				return r, errors.New("the number of replicas must be a positive integer")
+			}
+			r.N = n
+		default:
+			r.Value = arg
+		}
+		return r, nil
+	}
+	return PlacementRule{}, errors.New("unknown operator")
+}
+
+// EffectivePlacement returns the Placement expression extended with the
+// rules given by the AffinityMetaKey ("same tag") and AntiAffinityMetaKey
+// ("tag<=1") metadata.
+func (po *PinOptions) EffectivePlacement() string {
+	rules := []string{}
+	if po.Placement != "" {
+		rules = append(rules, po.Placement)
+	}
+	metaTags := func(key string) []string {
+		var tags []string
+		for _, tag := range strings.Split(po.Metadata[key], ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		return tags
+	}
+	for _, tag := range metaTags(AffinityMetaKey) {
+		rules = append(rules, "same "+tag)
+	}
+	for _, tag := range metaTags(AntiAffinityMetaKey) {
+		rules = append(rules, tag+"<=1")
+	}
+	return strings.Join(rules, ",")
+}
+
+// Tags returns the names of the tags used by the placement rules.
+func (p Placement) Tags() []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, r := range p {
+		if !seen[r.Tag] {
+			seen[r.Tag] = true
+			tags = append(tags, r.Tag)
+		}
+	}
+	return tags
+}
+
+// Allows returns false when the given peer tags do not satisfy the require
+// or exclude rules.
+func (p Placement) Allows(tags map[string]string) bool {
+	for _, r := range p {
+		v, ok := tags[r.Tag]
+		switch r.Kind {
+		case PlacementRequire:
+			if !ok || v != r.Value {
+				return false
+			}
+		case PlacementExclude:
+			if ok && v == r.Value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Prefers returns true when the given peer tags match any of the prefer
+// rules.
+func (p Placement) Prefers(tags map[string]string) bool {
+	for _, r := range p {
+		if r.Kind == PlacementPrefer && tags[r.Tag] == r.Value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package api
+
+import "testing"
+
+func TestParsePlacement(t *testing.T) {
+	p, err := ParsePlacement(" region>=1, rack<=2,prefer disk=ssd,zone!=eu-1,tier=hot,")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []PlacementRule{
+		{Kind: PlacementMinPer, Tag: "region", N: 1},
+		{Kind: PlacementMaxPer, Tag: "rack", N: 2},
+		{Kind: PlacementPrefer, Tag: "disk", Value: "ssd"},
+		{Kind: PlacementExclude, Tag: "zone", Value: "eu-1"},
+		{Kind: PlacementRequire, Tag: "tier", Value: "hot"},
+	}
+	if len(p) != len(expected) {
+		t.Fatalf("expected %d rules, got %d", len(expected), len(p))
+	}
+	for i, r := range p {
+		if r != expected[i] {
+			t.Errorf("rule %d: expected %+v, got %+v", i, expected[i], r)
+		}
+		if r2, err := parsePlacementRule(r.String()); err != nil || r2 != r {
+			t.Errorf("rule %d does not round-trip: %s", i, r)
+		}
+	}
+
+	if tags := p.Tags(); len(tags) != 5 {
+		t.Error("expected 5 tags:", tags)
+	}
+
+	bad := []string{
+		"region",
+		"region>=0",
+		"rack<=x",
+		"=ssd",
+		"disk=",
+		"prefer rack<=2",
+	}
+	for _, b := range bad {
+		if _, err := ParsePlacement(b); err == nil {
+			t.Errorf("%q should not parse", b)
+		}
+	}
+}
+
+func TestPlacementAllows(t *testing.T) {
+	p, err := ParsePlacement("tier=hot,zone!=eu-1,prefer disk=ssd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		tags    map[string]string
+		allows  bool
+		prefers bool
+	}{
+		{map[string]string{"tier": "hot", "disk": "ssd"}, true, true},
+		{map[string]string{"tier": "hot", "zone": "eu-2"}, true, false},
+		{map[string]string{"tier": "hot", "zone": "eu-1"}, false, false},
+		{map[string]string{"tier": "cold", "disk": "ssd"}, false, true},
+		{map[string]string{}, false, false},
+	}
+	for i, tc := range tests {
+		if got := p.Allows(tc.tags); got != tc.allows {
+			t.Errorf("%d: expected Allows to be %t", i, tc.allows)
+		}
+		if got := p.Prefers(tc.tags); got != tc.prefers {
+			t.Errorf("%d: expected Prefers to be %t", i, tc.prefers)
+		}
+	}
+}
+
+func TestEffectivePlacement(t *testing.T) {
+	po := &PinOptions{
+		Placement: "region>=1",
+		Metadata: map[string]string{
+			AffinityMetaKey:     "dc",
+			AntiAffinityMetaKey: "rack, host",
+		},
+	}
+	expr := po.EffectivePlacement()
+	if expr != "region>=1,same dc,rack<=1,host<=1" {
+		t.Fatal("unexpected placement:", expr)
+	}
+	p, err := ParsePlacement(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p[1].Kind != PlacementSame || p[1].Tag != "dc" || p[1].String() != "same dc" {
+		t.Errorf("unexpected affinity rule: %+v", p[1])
+	}
+
+	if (&PinOptions{}).EffectivePlacement() != "" {
+		t.Error("expected an empty placement")
+	}
+
+	for _, b := range []string{"same", "same ", "same a=b"} {
+		if _, err := ParsePlacement(b); err == nil {
+			t.Errorf("%q should not parse", b)
+		}
+	}
+}
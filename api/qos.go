@@ -0,0 +1,68 @@
+package api
+
+import (
+	"fmt"
+	"time"
+)
+
+// QoSPriority sets how the pins of a QoSClass are queued by the pin
+// tracker.
+type QoSPriority string
+
+// QoS priorities.
+const (
+	// QoSPriorityDefault queues pins in the priority queue while they are
+	// recent and have not been retried too many times.
+	QoSPriorityDefault QoSPriority = ""
+	// QoSPriorityHigh always queues pins in the priority queue.
+	QoSPriorityHigh QoSPriority = "high"
+	// QoSPriorityLow never queues pins in the priority queue.
+	QoSPriorityLow QoSPriority = "low"
+)
+
+// QoSClass groups the settings applied to the pins which name it in their
+// PinOptions.QoSClass. Classes are defined in the cluster configuration.
+type QoSClass struct {
+	// Priority sets how pins are queued.
+	Priority QoSPriority
+	// MaxRetries is how many times a pin which failed is retried when
+	// recovering all pins (i.e. automatically every PinRecoverInterval)
+	// before it is left in error. 0 means no limit.
+	MaxRetries int
+	// ReallocationDelay is how long pins wait before being re-allocated
+	// away from a peer that went down, in case it comes back. 0
+	// re-allocates them right away.
+	ReallocationDelay time.Duration
+	// Alert records alerts when pins fail to pin and when they are
+	// re-allocated.
+	Alert bool
+	// CheckAvailability makes the pin tracker confirm that a recursive
+	// pin can be retrieved from the IPFS network before reporting it as
+	// pinned: the content routing of the IPFS daemon must find at least
+	// MinProviders peers, other than the daemon itself, providing it.
+	// Until then, the pin stays queued, with the reason in its error,
+	// and is checked again a few times before it is left in error.
+	CheckAvailability bool
+	// MinProviders is how many providers CheckAvailability requires. 0
+	// means 1.
+	MinProviders int
+}
+
+// Validate returns an error when the class settings are not valid.
+func (qc *QoSClass) Validate() error {
+	switch qc.Priority {
+	case QoSPriorityDefault, QoSPriorityHigh, QoSPriorityLow:
+	default:
+		return fmt.Errorf("unknown priority %q", qc.Priority)
+	}
+	if qc.MaxRetries < 0 {
+		return fmt.Errorf("max_retries cannot be negative")
+	}
+	if qc.ReallocationDelay < 0 {
+		return fmt.Errorf("reallocation_delay cannot be negative")
+	}
+	if qc.MinProviders < 0 {
+		return fmt.Errorf("min_providers cannot be negative")
+	}
+	return nil
+}
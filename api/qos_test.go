@@ -0,0 +1,29 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQoSClassValidate(t *testing.T) {
+	qc := &QoSClass{
+		Priority:          QoSPriorityHigh,
+		MaxRetries:        3,
+		ReallocationDelay: time.Minute,
+		Alert:             true,
+	}
+	if err := qc.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	bad := []*QoSClass{
+		{Priority: "urgent"},
+		{MaxRetries: -1},
+		{ReallocationDelay: -time.Second},
+	}
+	for i, qc := range bad {
+		if qc.Validate() == nil {
+			t.Errorf("%d: expected an error validating", i)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	crypto "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// PinReceipt is a statement, signed by a cluster peer, that an item was
+// pinned on the given peers at the given time.
+type PinReceipt struct {
+	Cid       cid.Cid   `json:"cid" codec:"c"`
+	Peers     []peer.ID `json:"peers" codec:"p,omitempty"`
+	Timestamp time.Time `json:"timestamp" codec:"t,omitempty"`
+	Signer    peer.ID   `json:"signer" codec:"s,omitempty"`
+	PublicKey []byte    `json:"public_key" codec:"k,omitempty"`
+	Signature []byte    `json:"signature" codec:"g,omitempty"`
+}
+
+// NewPinReceipt creates a receipt for the given Cid and peers, signed with
+// the given key.
+func NewPinReceipt(c cid.Cid, peers []peer.ID, ts time.Time, key crypto.PrivKey) (*PinReceipt, error) {
+	signer, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := crypto.MarshalPublicKey(key.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+
+	r := &PinReceipt{
+		Cid:       c,
+		Peers:     peers,
+		Timestamp: ts.UTC(),
+		Signer:    signer,
+		PublicKey: pubKey,
+	}
+	r.Signature, err = key.Sign(r.signedBytes())
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// signedBytes returns the canonical representation of the receipt which is
+// signed.
+func (r *PinReceipt) signedBytes() []byte {
+	peers := make([]string, 0, len(r.Peers))
+	for _, p := range r.Peers {
+		peers = append(peers, peer.Encode(p))
+	}
+	sort.Strings(peers)
+
+	return []byte(fmt.Sprintf(
+		"ipfs-cluster-pin-receipt\n%s\n%s\n%s\n%s",
+		r.Cid,
+		strings.Join(peers, ","),
+		r.Timestamp.UTC().Format(time.RFC3339Nano),
+		peer.Encode(r.Signer),
+	))
+}
+
+// Verify checks that the receipt was signed by its Signer with the key
+// embedded in it, and that the Signer is one of the given trusted peers,
+// usually the cluster peerset.
+func (r *PinReceipt) Verify(trusted []peer.ID) error {
+	isTrusted := false
+	for _, p := range trusted {
+		if p == r.Signer {
+			isTrusted = true
+			break
+		}
+	}
+	if !isTrusted {
+		return fmt.Errorf("the receipt signer %s is not trusted", r.Signer)
+	}
+
+	pubKey, err := crypto.UnmarshalPublicKey(r.PublicKey)
+	if err != nil {
+		return err
+	}
+	if !r.Signer.MatchesPublicKey(pubKey) {
+		return errors.New("the public key does not match the receipt signer")
+	}
+
+	ok, err := pubKey.Verify(r.signedBytes(), r.Signature)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("invalid receipt signature")
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	crypto "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestPinReceipt(t *testing.T) {
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCid1, _ := cid.Decode("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc")
+	testPeerID1, _ := peer.Decode("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc")
+	testPeerID2, _ := peer.Decode("QmUZ13osndQ5uL4tPWHXe3iBgBgq9gfewcBMSCAuMBsDJ6")
+
+	r, err := NewPinReceipt(testCid1, []peer.ID{testPeerID1, testPeerID2}, time.Now(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted := []peer.ID{testPeerID1, r.Signer}
+	if err := r.Verify(trusted); err != nil {
+		t.Fatal("the receipt should verify:", err)
+	}
+	if r.Verify([]peer.ID{testPeerID1, testPeerID2}) == nil {
+		t.Error("a receipt from an untrusted signer should not verify")
+	}
+
+	// Peer order does not matter
+	r.Peers = []peer.ID{testPeerID2, testPeerID1}
+	if err := r.Verify(trusted); err != nil {
+		t.Error("the receipt should verify with peers in any order:", err)
+	}
+
+	r.Peers = []peer.ID{testPeerID1}
+	if r.Verify(trusted) == nil {
+		t.Error("a receipt with modified peers should not verify")
+	}
+	r.Peers = []peer.ID{testPeerID1, testPeerID2}
+
+	ts := r.Timestamp
+	r.Timestamp = ts.Add(time.Second)
+	if r.Verify(trusted) == nil {
+		t.Error("a receipt with a modified timestamp should not verify")
+	}
+	r.Timestamp = ts
+
+	other, _, _ := crypto.GenerateEd25519Key(rand.Reader)
+	forged, _ := NewPinReceipt(testCid1, r.Peers, r.Timestamp, other)
+	forged.Signer = r.Signer
+	if forged.Verify(trusted) == nil {
+		t.Error("a receipt signed by a foreign key should not verify")
+	}
+
+	r.PublicKey, _ = crypto.MarshalPublicKey(other.GetPublic())
+	if r.Verify(trusted) == nil {
+		t.Error("a receipt with a foreign public key should not verify")
+	}
+}
@@ -6,6 +6,7 @@ package client
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"time"
@@ -38,6 +39,16 @@ var (
 	DefaultPort      = 9094
 )
 
+// DefaultUploadChunkSize is the size of the chunks sent by AddResumable when
+// none is given.
+const DefaultUploadChunkSize int64 = 8 << 20
+
+// How many times, and how long apart, AddResumable retries a chunk.
+var (
+	uploadRetries    = 5
+	uploadRetryDelay = time.Second
+)
+
 var loggingFacility = "apiclient"
 var logger = logging.Logger(loggingFacility)
 
@@ -56,17 +67,42 @@ type Client interface {
 	PeerAdd(ctx context.Context, pid peer.ID) (*api.ID, error)
 	// PeerRm removes a current peer from the cluster
 	PeerRm(ctx context.Context, pid peer.ID) error
+	// PeerPins returns the pins allocated to a peer, from the shared
+	// state, sorted by cid. It skips the first offset ones and returns
+	// up to limit, or all of them when limit is 0.
+	PeerPins(ctx context.Context, pid peer.ID, offset, limit int) ([]*api.Pin, error)
+	// PinsDiff returns the pins on which the shared state of the peer
+	// serving the request and that of the given one disagree.
+	PinsDiff(ctx context.Context, pid peer.ID) (*api.PinsDiff, error)
+
+	// PinsSLA returns the pins which were not pinned before their
+	// PinDeadline, in all the peers or only in the one serving the
+	// request when local is set.
+	PinsSLA(ctx context.Context, local bool) ([]*api.PinSLABreach, error)
 
 	// Add imports files to the cluster from the given paths.
 	Add(ctx context.Context, paths []string, params *api.AddParams, out chan<- *api.AddedOutput) error
 	// AddMultiFile imports new files from a MultiFileReader.
 	AddMultiFile(ctx context.Context, multiFileR *files.MultiFileReader, params *api.AddParams, out chan<- *api.AddedOutput) error
+	// AddResumable uploads the content of r in chunks of chunkSize bytes,
+	// retrying the chunks which fail, and then adds it to the cluster.
+	AddResumable(ctx context.Context, r io.ReadSeeker, chunkSize int64, params *api.AddParams, out chan<- *api.AddedOutput) error
 
 	// Pin tracks a Cid with the given replication factor and a name for
 	// human-friendliness.
 	Pin(ctx context.Context, ci cid.Cid, opts api.PinOptions) (*api.Pin, error)
+	// PinWait pins a Cid and waits, up to the given duration, for it to be
+	// pinned on its allocations. It returns the replication achieved.
+	PinWait(ctx context.Context, ci cid.Cid, opts api.PinOptions, wait time.Duration) (*api.PinAck, error)
 	// Unpin untracks a Cid from cluster.
 	Unpin(ctx context.Context, ci cid.Cid) (*api.Pin, error)
+	// PinBatch pins the pins of a batch together and returns the
+	// result of every one of them.
+	PinBatch(ctx context.Context, batch *api.PinBatch) (*api.PinBatchResult, error)
+	// UnpinFilter unpins all the pins matching the filter when
+	// filter.Confirm is set to the filter token. Otherwise, it only
+	// counts them and returns the token.
+	UnpinFilter(ctx context.Context, filter *api.UnpinFilter) (*api.UnpinFilterResult, error)
 
 	// PinPath resolves given path into a cid and performs the pin operation.
 	PinPath(ctx context.Context, path string, opts api.PinOptions) (*api.Pin, error)
@@ -79,13 +115,37 @@ type Client interface {
 	Allocations(ctx context.Context, filter api.PinType) ([]*api.Pin, error)
 	// Allocation returns the current allocations for a given Cid.
 	Allocation(ctx context.Context, ci cid.Cid) (*api.Pin, error)
+	// AllocationsLinearizable is like Allocations, but the list reflects
+	// every update committed to the shared state before the call, even
+	// when the peer is behind.
+	AllocationsLinearizable(ctx context.Context, filter api.PinType) ([]*api.Pin, error)
+	// AllocationLinearizable is like Allocation, but reflects every update
+	// committed to the shared state before the call.
+	AllocationLinearizable(ctx context.Context, ci cid.Cid) (*api.Pin, error)
+	// BlockHolders returns the peers whose IPFS daemons hold the given
+	// block. If all is true every cluster peer is asked, otherwise only
+	// the allocations for the Cid.
+	BlockHolders(ctx context.Context, ci cid.Cid, all bool) ([]peer.ID, error)
+	// PinReceipt returns a receipt, signed by the peer handling the
+	// request, stating that the given Cid is pinned on all its
+	// allocations.
+	PinReceipt(ctx context.Context, ci cid.Cid) (*api.PinReceipt, error)
 
 	// Status returns the current ipfs state for a given Cid. If local is true,
 	// the information affects only the current peer, otherwise the information
 	// is fetched from all cluster peers.
 	Status(ctx context.Context, ci cid.Cid, local bool) (*api.GlobalPinInfo, error)
+	// StatusCids returns the status of each of the given Cids, in the
+	// same order, with a single request.
+	StatusCids(ctx context.Context, cids []cid.Cid) ([]*api.GlobalPinInfo, error)
 	// StatusAll gathers Status() for all tracked items.
 	StatusAll(ctx context.Context, filter api.TrackerStatus, local bool) ([]*api.GlobalPinInfo, error)
+	// StatusAllStream is like StatusAll, but sends the items to the given
+	// channel as they are received. The channel is closed when done.
+	StatusAllStream(ctx context.Context, filter api.TrackerStatus, local bool, out chan<- *api.GlobalPinInfo) error
+	// PinsSummary counts the tracked items matching the filter by status.
+	// With byPeer, the counts are broken down per peer too.
+	PinsSummary(ctx context.Context, filter api.TrackerStatus, local, byPeer bool) (*api.PinStatusSummary, error)
 
 	// Recover retriggers pin or unpin ipfs operations for a Cid in error
 	// state.  If local is true, the operation is limited to the current
@@ -95,11 +155,33 @@ type Client interface {
 	// local is true, the operation is limited to the current peer.
 	// Otherwise, it happens everywhere.
 	RecoverAll(ctx context.Context, local bool) ([]*api.GlobalPinInfo, error)
+	// Verify checks that the IPFS daemons which pinned a Cid have all its
+	// blocks. Items with missing blocks are reported with the
+	// TrackerStatusPinDegraded status. If local is true, only the current
+	// peer is checked.
+	Verify(ctx context.Context, ci cid.Cid, local bool) (*api.GlobalPinInfo, error)
 
 	// Alerts returns information health events in the cluster (expired
 	// metrics etc.).
 	Alerts(ctx context.Context) ([]*api.Alert, error)
 
+	// AllocationsAudit returns the last allocation decisions made by the
+	// peer, the most recent first: the candidates considered, with the
+	// weights of their metrics, and the allocations chosen.
+	AllocationsAudit(ctx context.Context) ([]*api.AllocationDecision, error)
+
+	// DeletedPins returns the tombstones of the items unpinned through
+	// any peer after the given time (all of them for the zero time), the
+	// most recent first. Tombstones are gathered from every peer, so
+	// those of the peers which are down are missing.
+	DeletedPins(ctx context.Context, since time.Time) ([]*api.Tombstone, error)
+
+	// OpLog returns up to limit operations committed to the shared state
+	// after the given sequence number, which is not included, waiting up
+	// to wait for new ones when there are none. Sequence numbers are
+	// specific to the peer answering (see api.OpLogPage).
+	OpLog(ctx context.Context, after uint64, limit int, wait time.Duration) (*api.OpLogPage, error)
+
 	// Version returns the ipfs-cluster peer's version.
 	Version(context.Context) (*api.Version, error)
 
@@ -114,13 +196,35 @@ type Client interface {
 	// for the current cluster peers.
 	Metrics(ctx context.Context, name string) ([]*api.Metric, error)
 
+	// MetricsAt returns the metrics of matching name which were valid for
+	// each peer at the given time, as retained by the contacted peer.
+	MetricsAt(ctx context.Context, name string, t time.Time) ([]*api.Metric, error)
+	// PeerMetricAll returns the whole window of metrics of the given
+	// name that the contacted peer holds for the given peer, the most
+	// recent first, including the Stale ones.
+	PeerMetricAll(ctx context.Context, pid peer.ID, name string) ([]*api.Metric, error)
+
 	// MetricNames returns the list of metric types.
 	MetricNames(ctx context.Context) ([]string, error)
 
+	// RecentAlerts returns the alerts retained by the monitor of the
+	// peer which were triggered after the given time (all of them for
+	// the zero time), the most recent first.
+	RecentAlerts(ctx context.Context, since time.Time) ([]*api.Alert, error)
+
 	// RepoGC runs garbage collection on IPFS daemons of cluster peers and
 	// returns collected CIDs. If local is true, it would garbage collect
 	// only on contacted peer, otherwise on all peers' IPFS daemons.
 	RepoGC(ctx context.Context, local bool) (*api.GlobalRepoGC, error)
+
+	// SetMaintenance enables or disables maintenance mode on all cluster
+	// peers. Peers in maintenance mode do not trigger automatic actions.
+	SetMaintenance(ctx context.Context, enabled bool) error
+
+	// Sync performs a full state sync in the peer and returns a summary
+	// of the corrections made once it completes. Syncing large pinsets
+	// may take longer than the client Timeout.
+	Sync(ctx context.Context) (*api.SyncSummary, error)
 }
 
 // Config allows to configure the parameters to connect
@@ -2,7 +2,10 @@ package client
 
 import (
 	"context"
+	"io"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	cid "github.com/ipfs/go-cid"
 	shell "github.com/ipfs/go-ipfs-api"
@@ -62,6 +65,156 @@ func (f *Failover) SetClients(cl []Client) {
 	f.clients = cl
 }
 
+// DefaultWriteHintRefresh is how often the WriteHint strategy asks again for
+// the suggested peer, by default.
+var DefaultWriteHintRefresh = 30 * time.Second
+
+// writeHintTimeout bounds the requests made to refresh the hint.
+var writeHintTimeout = 10 * time.Second
+
+// WriteHint is a load balancing strategy that sends requests to the cluster
+// peer suggested in the WriteHint of the peer IDs (the leader, or the least
+// loaded peer in leaderless clusters), trying the others in sequence when a
+// call fails. When the peers also suggest WriteWeights, requests are spread
+// among them in proportion, with a weighted round-robin. It suits clients
+// which mostly write. The hint is refreshed in the background every Refresh
+// period (DefaultWriteHintRefresh when 0). Until a hint is known, it behaves
+// like Failover.
+type WriteHint struct {
+	Refresh time.Duration
+
+	mu         sync.Mutex
+	clients    []Client
+	ids        []peer.ID
+	preferred  int
+	weights    []int64
+	current    []int64
+	updated    time.Time
+	refreshing bool
+}
+
+// Next returns the next client to be used.
+func (w *WriteHint) Next(count int) Client {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	refresh := w.Refresh
+	if refresh <= 0 {
+		refresh = DefaultWriteHintRefresh
+	}
+	if count == 0 && !w.refreshing && time.Since(w.updated) > refresh {
+		w.refreshing = true
+		ids := make([]peer.ID, len(w.ids))
+		copy(ids, w.ids)
+		go w.update(w.clients, ids, w.preferred)
+	}
+	if count == 0 {
+		if i, ok := w.nextWeighted(); ok {
+			return w.clients[i]
+		}
+	}
+	return w.clients[(w.preferred+count)%len(w.clients)]
+}
+
+// nextWeighted picks a client with a smooth weighted round-robin: every
+// client gains its weight and the one with most is picked and loses the
+// total. It returns false when there are no weights.
+func (w *WriteHint) nextWeighted() (int, bool) {
+	var total int64
+	best := -1
+	for i, weight := range w.weights {
+		if weight <= 0 {
+			continue
+		}
+		total += weight
+		w.current[i] += weight
+		if best < 0 || w.current[i] > w.current[best] {
+			best = i
+		}
+	}
+	if best < 0 {
+		return 0, false
+	}
+	w.current[best] -= total
+	return best, true
+}
+
+// update asks the given peers for the write hint and weights and learns
+// their IDs, so that the client of the suggested peer can be picked. It
+// runs without holding the lock and only applies the results when the
+// clients did not change meanwhile.
+func (w *WriteHint) update(clients []Client, ids []peer.ID, preferred int) {
+	ctx, cancel := context.WithTimeout(context.Background(), writeHintTimeout)
+	defer cancel()
+
+	var hint peer.ID
+	var hintWeights map[string]int64
+	n := len(clients)
+	for i := 0; i < n; i++ {
+		j := (preferred + i) % n
+		if hint != "" && ids[j] != "" {
+			continue
+		}
+		id, err := clients[j].ID(ctx)
+		if err != nil || id.Error != "" {
+			continue
+		}
+		ids[j] = id.ID
+		if hint == "" {
+			hint = id.WriteHint
+			hintWeights = id.WriteWeights
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.refreshing = false
+	w.updated = time.Now()
+	if !sameClients(w.clients, clients) {
+		return
+	}
+	w.ids = ids
+
+	w.weights = make([]int64, n)
+	w.current = make([]int64, n)
+	for j, pid := range ids {
+		if pid != "" {
+			w.weights[j] = hintWeights[peer.Encode(pid)]
+		}
+	}
+	for j, pid := range ids {
+		if hint != "" && pid == hint {
+			w.preferred = j
+			return
+		}
+	}
+	logger.Debugf("no client for the suggested write peer %q", hint)
+}
+
+func sameClients(a, b []Client) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// SetClients sets a list of clients for this strategy.
+func (w *WriteHint) SetClients(cl []Client) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.clients = cl
+	w.ids = make([]peer.ID, len(cl))
+	w.preferred = 0
+	w.weights = nil
+	w.current = nil
+	w.updated = time.Time{}
+}
+
 // NewLBClient returns a new client that would load balance requests among
 // clients.
 func NewLBClient(strategy LBStrategy, cfgs []*Config, retries int) (Client, error) {
@@ -157,6 +310,49 @@ func (lc *loadBalancingClient) PeerRm(ctx context.Context, id peer.ID) error {
 	return lc.retry(0, call)
 }
 
+// PeerPins returns the pins allocated to a peer, from the shared state,
+// sorted by cid. It skips the first offset ones and returns up to limit, or
+// all of them when limit is 0.
+func (lc *loadBalancingClient) PeerPins(ctx context.Context, id peer.ID, offset, limit int) ([]*api.Pin, error) {
+	var pins []*api.Pin
+	call := func(c Client) error {
+		var err error
+		pins, err = c.PeerPins(ctx, id, offset, limit)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return pins, err
+}
+
+// PinsDiff returns the pins on which the shared state of the peer serving the
+// request and that of the given one disagree.
+func (lc *loadBalancingClient) PinsDiff(ctx context.Context, id peer.ID) (*api.PinsDiff, error) {
+	var diff *api.PinsDiff
+	call := func(c Client) error {
+		var err error
+		diff, err = c.PinsDiff(ctx, id)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return diff, err
+}
+
+// PinsSLA returns the pins which were not pinned before their PinDeadline, in
+// all the peers or only in the one serving the request when local is set.
+func (lc *loadBalancingClient) PinsSLA(ctx context.Context, local bool) ([]*api.PinSLABreach, error) {
+	var breaches []*api.PinSLABreach
+	call := func(c Client) error {
+		var err error
+		breaches, err = c.PinsSLA(ctx, local)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return breaches, err
+}
+
 // Pin tracks a Cid with the given replication factor and a name for
 // human-friendliness.
 func (lc *loadBalancingClient) Pin(ctx context.Context, ci cid.Cid, opts api.PinOptions) (*api.Pin, error) {
@@ -171,6 +367,20 @@ func (lc *loadBalancingClient) Pin(ctx context.Context, ci cid.Cid, opts api.Pin
 	return pin, err
 }
 
+// PinWait pins a Cid and waits, up to the given duration, for it to be
+// pinned on its allocations. It returns the replication achieved.
+func (lc *loadBalancingClient) PinWait(ctx context.Context, ci cid.Cid, opts api.PinOptions, wait time.Duration) (*api.PinAck, error) {
+	var ack *api.PinAck
+	call := func(c Client) error {
+		var err error
+		ack, err = c.PinWait(ctx, ci, opts, wait)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return ack, err
+}
+
 // Unpin untracks a Cid from cluster.
 func (lc *loadBalancingClient) Unpin(ctx context.Context, ci cid.Cid) (*api.Pin, error) {
 	var pin *api.Pin
@@ -184,6 +394,35 @@ func (lc *loadBalancingClient) Unpin(ctx context.Context, ci cid.Cid) (*api.Pin,
 	return pin, err
 }
 
+// PinBatch pins the pins of a batch together and returns the result of
+// every one of them.
+func (lc *loadBalancingClient) PinBatch(ctx context.Context, batch *api.PinBatch) (*api.PinBatchResult, error) {
+	var result *api.PinBatchResult
+	call := func(c Client) error {
+		var err error
+		result, err = c.PinBatch(ctx, batch)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return result, err
+}
+
+// UnpinFilter unpins all the pins matching the filter when filter.Confirm
+// is set to the filter token. Otherwise, it only counts them and returns
+// the token.
+func (lc *loadBalancingClient) UnpinFilter(ctx context.Context, filter *api.UnpinFilter) (*api.UnpinFilterResult, error) {
+	var result *api.UnpinFilterResult
+	call := func(c Client) error {
+		var err error
+		result, err = c.UnpinFilter(ctx, filter)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return result, err
+}
+
 // PinPath allows to pin an element by the given IPFS path.
 func (lc *loadBalancingClient) PinPath(ctx context.Context, path string, opts api.PinOptions) (*api.Pin, error) {
 	var pin *api.Pin
@@ -238,6 +477,63 @@ func (lc *loadBalancingClient) Allocation(ctx context.Context, ci cid.Cid) (*api
 	return pin, err
 }
 
+// AllocationsLinearizable is like Allocations, but the list reflects every
+// update committed to the shared state before the call.
+func (lc *loadBalancingClient) AllocationsLinearizable(ctx context.Context, filter api.PinType) ([]*api.Pin, error) {
+	var pins []*api.Pin
+	call := func(c Client) error {
+		var err error
+		pins, err = c.AllocationsLinearizable(ctx, filter)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return pins, err
+}
+
+// AllocationLinearizable is like Allocation, but reflects every update
+// committed to the shared state before the call.
+func (lc *loadBalancingClient) AllocationLinearizable(ctx context.Context, ci cid.Cid) (*api.Pin, error) {
+	var pin *api.Pin
+	call := func(c Client) error {
+		var err error
+		pin, err = c.AllocationLinearizable(ctx, ci)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return pin, err
+}
+
+// BlockHolders returns the peers whose IPFS daemons hold the given block. If
+// all is true every cluster peer is asked, otherwise only the allocations
+// for the Cid.
+func (lc *loadBalancingClient) BlockHolders(ctx context.Context, ci cid.Cid, all bool) ([]peer.ID, error) {
+	var holders []peer.ID
+	call := func(c Client) error {
+		var err error
+		holders, err = c.BlockHolders(ctx, ci, all)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return holders, err
+}
+
+// PinReceipt returns a receipt, signed by the peer handling the request,
+// stating that the given Cid is pinned on all its allocations.
+func (lc *loadBalancingClient) PinReceipt(ctx context.Context, ci cid.Cid) (*api.PinReceipt, error) {
+	var receipt *api.PinReceipt
+	call := func(c Client) error {
+		var err error
+		receipt, err = c.PinReceipt(ctx, ci)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return receipt, err
+}
+
 // Status returns the current ipfs state for a given Cid. If local is true,
 // the information affects only the current peer, otherwise the information
 // is fetched from all cluster peers.
@@ -253,6 +549,20 @@ func (lc *loadBalancingClient) Status(ctx context.Context, ci cid.Cid, local boo
 	return pinInfo, err
 }
 
+// StatusCids returns the status of each of the given Cids, in the same
+// order, with a single request.
+func (lc *loadBalancingClient) StatusCids(ctx context.Context, cids []cid.Cid) ([]*api.GlobalPinInfo, error) {
+	var pinInfos []*api.GlobalPinInfo
+	call := func(c Client) error {
+		var err error
+		pinInfos, err = c.StatusCids(ctx, cids)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return pinInfos, err
+}
+
 // StatusAll gathers Status() for all tracked items. If a filter is
 // provided, only entries matching the given filter statuses
 // will be returned. A filter can be built by merging TrackerStatuses with
@@ -270,6 +580,46 @@ func (lc *loadBalancingClient) StatusAll(ctx context.Context, filter api.Tracker
 	return pinInfos, err
 }
 
+// PinsSummary counts the tracked items matching the filter by status.
+// With byPeer, the counts are broken down per peer too.
+func (lc *loadBalancingClient) PinsSummary(ctx context.Context, filter api.TrackerStatus, local, byPeer bool) (*api.PinStatusSummary, error) {
+	var summary *api.PinStatusSummary
+	call := func(c Client) error {
+		var err error
+		summary, err = c.PinsSummary(ctx, filter, local, byPeer)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return summary, err
+}
+
+// StatusAllStream is like StatusAll, but sends the items to the given
+// channel as they are received. The channel is closed when done.
+func (lc *loadBalancingClient) StatusAllStream(ctx context.Context, filter api.TrackerStatus, local bool, out chan<- *api.GlobalPinInfo) error {
+	defer close(out)
+
+	// Every try closes its own channel.
+	call := func(c Client) error {
+		ch := make(chan *api.GlobalPinInfo)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for gpi := range ch {
+				select {
+				case out <- gpi:
+				case <-ctx.Done():
+				}
+			}
+		}()
+		err := c.StatusAllStream(ctx, filter, local, ch)
+		<-done
+		return err
+	}
+
+	return lc.retry(0, call)
+}
+
 // Recover retriggers pin or unpin ipfs operations for a Cid in error state.
 // If local is true, the operation is limited to the current peer, otherwise
 // it happens on every cluster peer.
@@ -285,6 +635,22 @@ func (lc *loadBalancingClient) Recover(ctx context.Context, ci cid.Cid, local bo
 	return pinInfo, err
 }
 
+// Verify checks that the IPFS daemons which pinned a Cid have all its
+// blocks. Items with missing blocks are reported with the
+// TrackerStatusPinDegraded status. If local is true, only the current peer
+// is checked.
+func (lc *loadBalancingClient) Verify(ctx context.Context, ci cid.Cid, local bool) (*api.GlobalPinInfo, error) {
+	var pinInfo *api.GlobalPinInfo
+	call := func(c Client) error {
+		var err error
+		pinInfo, err = c.Verify(ctx, ci, local)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return pinInfo, err
+}
+
 // RecoverAll triggers Recover() operations on all tracked items. If local is
 // true, the operation is limited to the current peer. Otherwise, it happens
 // everywhere.
@@ -313,6 +679,50 @@ func (lc *loadBalancingClient) Alerts(ctx context.Context) ([]*api.Alert, error)
 	return alerts, err
 }
 
+// DeletedPins returns the tombstones of the items unpinned through any peer
+// after the given time, the most recent first.
+func (lc *loadBalancingClient) DeletedPins(ctx context.Context, since time.Time) ([]*api.Tombstone, error) {
+	var tombstones []*api.Tombstone
+	call := func(c Client) error {
+		var err error
+		tombstones, err = c.DeletedPins(ctx, since)
+		return err
+	}
+
+	err := lc.retry(0, call)
+
+	return tombstones, err
+}
+
+// AllocationsAudit returns the last allocation decisions made by the peer.
+// Decisions are only recorded by the peer which made them.
+func (lc *loadBalancingClient) AllocationsAudit(ctx context.Context) ([]*api.AllocationDecision, error) {
+	var decisions []*api.AllocationDecision
+	call := func(c Client) error {
+		var err error
+		decisions, err = c.AllocationsAudit(ctx)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return decisions, err
+}
+
+// OpLog returns up to limit operations committed to the shared state after
+// the given sequence number. Since sequence numbers are specific to each
+// peer, consumers should check the Peer and InstanceID of the results.
+func (lc *loadBalancingClient) OpLog(ctx context.Context, after uint64, limit int, wait time.Duration) (*api.OpLogPage, error) {
+	var page *api.OpLogPage
+	call := func(c Client) error {
+		var err error
+		page, err = c.OpLog(ctx, after, limit, wait)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return page, err
+}
+
 // Version returns the ipfs-cluster peer's version.
 func (lc *loadBalancingClient) Version(ctx context.Context) (*api.Version, error) {
 	var v *api.Version
@@ -353,6 +763,35 @@ func (lc *loadBalancingClient) Metrics(ctx context.Context, name string) ([]*api
 	return metrics, err
 }
 
+// PeerMetricAll returns the whole window of metrics of the given name that
+// the contacted peer holds for the given peer, the most recent first,
+// including the Stale ones.
+func (lc *loadBalancingClient) PeerMetricAll(ctx context.Context, pid peer.ID, name string) ([]*api.Metric, error) {
+	var metrics []*api.Metric
+	call := func(c Client) error {
+		var err error
+		metrics, err = c.PeerMetricAll(ctx, pid, name)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return metrics, err
+}
+
+// MetricsAt returns the metrics of matching name which were valid for
+// each peer at the given time, as retained by the contacted peer.
+func (lc *loadBalancingClient) MetricsAt(ctx context.Context, name string, t time.Time) ([]*api.Metric, error) {
+	var metrics []*api.Metric
+	call := func(c Client) error {
+		var err error
+		metrics, err = c.MetricsAt(ctx, name, t)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return metrics, err
+}
+
 // MetricNames returns the list of metric types.
 func (lc *loadBalancingClient) MetricNames(ctx context.Context) ([]string, error) {
 	var metricNames []string
@@ -367,6 +806,21 @@ func (lc *loadBalancingClient) MetricNames(ctx context.Context) ([]string, error
 	return metricNames, err
 }
 
+// RecentAlerts returns the alerts retained by the monitor of the peer which
+// were triggered after the given time, the most recent first.
+func (lc *loadBalancingClient) RecentAlerts(ctx context.Context, since time.Time) ([]*api.Alert, error) {
+	var alerts []*api.Alert
+	call := func(c Client) error {
+		var err error
+		alerts, err = c.RecentAlerts(ctx, since)
+		return err
+	}
+
+	err := lc.retry(0, call)
+
+	return alerts, err
+}
+
 // RepoGC runs garbage collection on IPFS daemons of cluster peers and
 // returns collected CIDs. If local is true, it would garbage collect
 // only on contacted peer, otherwise on all peers' IPFS daemons.
@@ -383,6 +837,32 @@ func (lc *loadBalancingClient) RepoGC(ctx context.Context, local bool) (*api.Glo
 	return repoGC, err
 }
 
+// SetMaintenance enables or disables maintenance mode on all cluster
+// peers. Peers in maintenance mode do not trigger automatic actions.
+func (lc *loadBalancingClient) SetMaintenance(ctx context.Context, enabled bool) error {
+	call := func(c Client) error {
+		return c.SetMaintenance(ctx, enabled)
+	}
+
+	return lc.retry(0, call)
+}
+
+// Sync performs a full state sync in the peer and returns a summary
+// of the corrections made once it completes. Syncing large pinsets
+// may take longer than the client Timeout.
+func (lc *loadBalancingClient) Sync(ctx context.Context) (*api.SyncSummary, error) {
+	var summary *api.SyncSummary
+
+	call := func(c Client) error {
+		var err error
+		summary, err = c.Sync(ctx)
+		return err
+	}
+
+	err := lc.retry(0, call)
+	return summary, err
+}
+
 // Add imports files to the cluster from the given paths. A path can
 // either be a local filesystem location or an web url (http:// or https://).
 // In the latter case, the destination will be downloaded with a GET request.
@@ -417,6 +897,39 @@ func (lc *loadBalancingClient) AddMultiFile(
 	return lc.retry(0, call)
 }
 
+// AddResumable uploads the content of r in chunks of chunkSize bytes,
+// retrying the chunks which fail, and then adds it to the cluster. The whole
+// upload goes to a single cluster peer.
+func (lc *loadBalancingClient) AddResumable(
+	ctx context.Context,
+	r io.ReadSeeker,
+	chunkSize int64,
+	params *api.AddParams,
+	out chan<- *api.AddedOutput,
+) error {
+	defer close(out)
+
+	// Every try closes its own channel.
+	call := func(c Client) error {
+		ch := make(chan *api.AddedOutput)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for o := range ch {
+				select {
+				case out <- o:
+				case <-ctx.Done():
+				}
+			}
+		}()
+		err := c.AddResumable(ctx, r, chunkSize, params, ch)
+		<-done
+		return err
+	}
+
+	return lc.retry(0, call)
+}
+
 // IPFS returns an instance of go-ipfs-api's Shell, pointing to the
 // configured ProxyAddr (or to the default Cluster's IPFS proxy port).
 // It re-uses this Client's HTTP client, thus will be constrained by
@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
 	ma "github.com/multiformats/go-multiaddr"
 )
 
@@ -105,3 +109,120 @@ func testRunManyRequestsConcurrently(t *testing.T, cfgs []*Config, strategy LBSt
 	}
 	wg.Wait()
 }
+
+type hintClient struct {
+	defaultClient
+	mu      sync.Mutex
+	id      peer.ID
+	hint    peer.ID
+	weights map[string]int64
+	down    bool
+}
+
+func (h *hintClient) set(hint peer.ID, weights map[string]int64) {
+	h.mu.Lock()
+	h.hint = hint
+	h.weights = weights
+	h.mu.Unlock()
+}
+
+func (h *hintClient) ID(ctx context.Context) (*api.ID, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.down {
+		return nil, &api.Error{Message: "down"}
+	}
+	return &api.ID{
+		ID:           h.id,
+		WriteHint:    h.hint,
+		WriteWeights: h.weights,
+	}, nil
+}
+
+// waitNext waits for the strategy to pick the given client, as the hint is
+// refreshed in the background.
+func waitNext(t *testing.T, strategy LBStrategy, c Client) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for strategy.Next(0) != c {
+		if time.Now().After(deadline) {
+			t.Fatal("the suggested client was not picked")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWriteHint(t *testing.T) {
+	ctx := context.Background()
+	ids := []peer.ID{test.PeerID1, test.PeerID2, test.PeerID3, test.PeerID4}
+	var clients []Client
+	for _, id := range ids {
+		clients = append(clients, &hintClient{id: id, hint: test.PeerID3})
+	}
+	// The first peer does not answer, the others suggest the third one.
+	clients[0].(*hintClient).down = true
+
+	strategy := &WriteHint{}
+	strategy.SetClients(clients)
+	lc := loadBalancingClient{strategy: strategy, retries: 1}
+
+	waitNext(t, strategy, clients[2])
+	id, err := lc.ID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.ID != test.PeerID3 {
+		t.Errorf("expected the suggested peer to be used, got %s", id.ID)
+	}
+	if c := strategy.Next(1); c != clients[3] {
+		t.Error("expected failover to the next client")
+	}
+
+	// Until refreshed, the same peer is used.
+	for _, c := range clients {
+		c.(*hintClient).set(test.PeerID2, nil)
+	}
+	if c := strategy.Next(0); c != clients[2] {
+		t.Error("the hint should not have been refreshed yet")
+	}
+	setRefresh := func(d time.Duration) {
+		strategy.mu.Lock()
+		strategy.Refresh = d
+		strategy.mu.Unlock()
+	}
+	setRefresh(time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	waitNext(t, strategy, clients[1])
+
+	// Writes are spread by weight.
+	weights := map[string]int64{
+		peer.Encode(test.PeerID2): 3,
+		peer.Encode(test.PeerID3): 1,
+	}
+	for _, c := range clients {
+		c.(*hintClient).set(test.PeerID2, weights)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		strategy.mu.Lock()
+		ready := len(strategy.weights) > 0 && strategy.weights[1] == 3
+		strategy.mu.Unlock()
+		if ready {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the weights were not refreshed")
+		}
+		strategy.Next(0)
+		time.Sleep(10 * time.Millisecond)
+	}
+	setRefresh(time.Hour)
+
+	counts := make(map[Client]int)
+	for i := 0; i < 8; i++ {
+		counts[strategy.Next(0)]++
+	}
+	if counts[clients[1]] != 6 || counts[clients[2]] != 2 {
+		t.Errorf("expected writes to be spread 3 to 1: %d %d", counts[clients[1]], counts[clients[2]])
+	}
+}
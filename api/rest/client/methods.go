@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"path"
@@ -72,6 +73,40 @@ func (c *defaultClient) PeerRm(ctx context.Context, id peer.ID) error {
 	return c.do(ctx, "DELETE", fmt.Sprintf("/peers/%s", id.Pretty()), nil, nil, nil)
 }
 
+// PeerPins returns the pins allocated to a peer, from the shared state,
+// sorted by cid. It skips the first offset ones and returns up to limit, or
+// all of them when limit is 0.
+func (c *defaultClient) PeerPins(ctx context.Context, id peer.ID, offset, limit int) ([]*api.Pin, error) {
+	ctx, span := trace.StartSpan(ctx, "client/PeerPins")
+	defer span.End()
+
+	var pins []*api.Pin
+	err := c.do(ctx, "GET", fmt.Sprintf("/peers/%s/pins?offset=%d&limit=%d", id.Pretty(), offset, limit), nil, nil, &pins)
+	return pins, err
+}
+
+// PinsDiff returns the pins on which the shared state of the peer serving the
+// request and that of the given one disagree.
+func (c *defaultClient) PinsDiff(ctx context.Context, id peer.ID) (*api.PinsDiff, error) {
+	ctx, span := trace.StartSpan(ctx, "client/PinsDiff")
+	defer span.End()
+
+	var diff api.PinsDiff
+	err := c.do(ctx, "GET", fmt.Sprintf("/pins/diff/%s", id.Pretty()), nil, nil, &diff)
+	return &diff, err
+}
+
+// PinsSLA returns the pins which were not pinned before their PinDeadline, in
+// all the peers or only in the one serving the request when local is set.
+func (c *defaultClient) PinsSLA(ctx context.Context, local bool) ([]*api.PinSLABreach, error) {
+	ctx, span := trace.StartSpan(ctx, "client/PinsSLA")
+	defer span.End()
+
+	var breaches []*api.PinSLABreach
+	err := c.do(ctx, "GET", fmt.Sprintf("/pins/sla?local=%t", local), nil, nil, &breaches)
+	return breaches, err
+}
+
 // Pin tracks a Cid with the given replication factor and a name for
 // human-friendliness.
 func (c *defaultClient) Pin(ctx context.Context, ci cid.Cid, opts api.PinOptions) (*api.Pin, error) {
@@ -101,6 +136,36 @@ func (c *defaultClient) Pin(ctx context.Context, ci cid.Cid, opts api.PinOptions
 	return &pin, nil
 }
 
+// PinWait pins a Cid and waits, up to the given duration, for it to be
+// pinned on its allocations. It returns the replication achieved.
+func (c *defaultClient) PinWait(ctx context.Context, ci cid.Cid, opts api.PinOptions, wait time.Duration) (*api.PinAck, error) {
+	ctx, span := trace.StartSpan(ctx, "client/PinWait")
+	defer span.End()
+
+	query, err := opts.ToQuery()
+	if err != nil {
+		return nil, err
+	}
+	var ack api.PinAck
+	err = c.do(
+		ctx,
+		"POST",
+		fmt.Sprintf(
+			"/pins/%s?%s&wait-replication=%s",
+			ci.String(),
+			query,
+			wait,
+		),
+		nil,
+		nil,
+		&ack,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &ack, nil
+}
+
 // Unpin untracks a Cid from cluster.
 func (c *defaultClient) Unpin(ctx context.Context, ci cid.Cid) (*api.Pin, error) {
 	ctx, span := trace.StartSpan(ctx, "client/Unpin")
@@ -113,13 +178,64 @@ func (c *defaultClient) Unpin(ctx context.Context, ci cid.Cid) (*api.Pin, error)
 	return &pin, nil
 }
 
+// PinBatch pins the pins of a batch together and returns the result of
+// every one of them.
+func (c *defaultClient) PinBatch(ctx context.Context, batch *api.PinBatch) (*api.PinBatchResult, error) {
+	ctx, span := trace.StartSpan(ctx, "client/PinBatch")
+	defer span.End()
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.Encode(batch.Pins)
+
+	var result api.PinBatchResult
+	err := c.do(
+		ctx,
+		"POST",
+		fmt.Sprintf("/pins/batch?atomic=%t", batch.Atomic),
+		nil,
+		&buf,
+		&result,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// UnpinFilter unpins all the pins matching the filter when filter.Confirm
+// is set to the filter token. Otherwise, it only counts them and returns
+// the token.
+func (c *defaultClient) UnpinFilter(ctx context.Context, filter *api.UnpinFilter) (*api.UnpinFilterResult, error) {
+	ctx, span := trace.StartSpan(ctx, "client/UnpinFilter")
+	defer span.End()
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.Encode(filter)
+
+	var result api.UnpinFilterResult
+	err := c.do(
+		ctx,
+		"POST",
+		"/pins/unpin-filter?confirm="+url.QueryEscape(filter.Confirm),
+		nil,
+		&buf,
+		&result,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
 // PinPath allows to pin an element by the given IPFS path.
 func (c *defaultClient) PinPath(ctx context.Context, path string, opts api.PinOptions) (*api.Pin, error) {
 	ctx, span := trace.StartSpan(ctx, "client/PinPath")
 	defer span.End()
 
 	var pin api.Pin
-	ipfspath, err := gopath.ParsePath(path)
+	ipfspath, err := pinsPath(path)
 	if err != nil {
 		return nil, err
 	}
@@ -132,7 +248,7 @@ func (c *defaultClient) PinPath(ctx context.Context, path string, opts api.PinOp
 		"POST",
 		fmt.Sprintf(
 			"/pins%s?%s",
-			ipfspath.String(),
+			ipfspath,
 			query,
 		),
 		nil,
@@ -150,21 +266,49 @@ func (c *defaultClient) UnpinPath(ctx context.Context, p string) (*api.Pin, erro
 	defer span.End()
 
 	var pin api.Pin
-	ipfspath, err := gopath.ParsePath(p)
+	ipfspath, err := pinsPath(p)
 	if err != nil {
 		return nil, err
 	}
 
-	err = c.do(ctx, "DELETE", fmt.Sprintf("/pins%s", ipfspath.String()), nil, nil, &pin)
+	err = c.do(ctx, "DELETE", fmt.Sprintf("/pins%s", ipfspath), nil, nil, &pin)
 	return &pin, err
 }
 
+// pinsPath validates the path given to PinPath or UnpinPath and returns it
+// as used in the /pins/ endpoint. MFS paths (/mfs/...) are not IPFS paths,
+// so they are only escaped.
+func pinsPath(p string) (string, error) {
+	if mfs := api.MFSPath(p); mfs != "" {
+		u := url.URL{Path: strings.TrimSuffix(api.MFSPathPrefix, "/") + mfs}
+		return u.EscapedPath(), nil
+	}
+	ipfspath, err := gopath.ParsePath(p)
+	if err != nil {
+		return "", err
+	}
+	return ipfspath.String(), nil
+}
+
 // Allocations returns the consensus state listing all tracked items and
 // the peers that should be pinning them.
 func (c *defaultClient) Allocations(ctx context.Context, filter api.PinType) ([]*api.Pin, error) {
 	ctx, span := trace.StartSpan(ctx, "client/Allocations")
 	defer span.End()
 
+	return c.allocations(ctx, filter, false)
+}
+
+// AllocationsLinearizable is like Allocations, but the list reflects every
+// update committed to the shared state before the call.
+func (c *defaultClient) AllocationsLinearizable(ctx context.Context, filter api.PinType) ([]*api.Pin, error) {
+	ctx, span := trace.StartSpan(ctx, "client/AllocationsLinearizable")
+	defer span.End()
+
+	return c.allocations(ctx, filter, true)
+}
+
+func (c *defaultClient) allocations(ctx context.Context, filter api.PinType, linearizable bool) ([]*api.Pin, error) {
 	var pins []*api.Pin
 
 	types := []api.PinType{
@@ -187,7 +331,7 @@ func (c *defaultClient) Allocations(ctx context.Context, filter api.PinType) ([]
 	}
 
 	f := url.QueryEscape(strings.Join(strFilter, ","))
-	err := c.do(ctx, "GET", fmt.Sprintf("/allocations?filter=%s", f), nil, nil, &pins)
+	err := c.do(ctx, "GET", fmt.Sprintf("/allocations?filter=%s&linearizable=%t", f, linearizable), nil, nil, &pins)
 	return pins, err
 }
 
@@ -201,6 +345,47 @@ func (c *defaultClient) Allocation(ctx context.Context, ci cid.Cid) (*api.Pin, e
 	return &pin, err
 }
 
+// AllocationLinearizable is like Allocation, but reflects every update
+// committed to the shared state before the call.
+func (c *defaultClient) AllocationLinearizable(ctx context.Context, ci cid.Cid) (*api.Pin, error) {
+	ctx, span := trace.StartSpan(ctx, "client/AllocationLinearizable")
+	defer span.End()
+
+	var pin api.Pin
+	err := c.do(ctx, "GET", fmt.Sprintf("/allocations/%s?linearizable=true", ci.String()), nil, nil, &pin)
+	return &pin, err
+}
+
+// BlockHolders returns the peers whose IPFS daemons hold the given block. If
+// all is true every cluster peer is asked, otherwise only the allocations
+// for the Cid.
+func (c *defaultClient) BlockHolders(ctx context.Context, ci cid.Cid, all bool) ([]peer.ID, error) {
+	ctx, span := trace.StartSpan(ctx, "client/BlockHolders")
+	defer span.End()
+
+	var holders []peer.ID
+	err := c.do(
+		ctx,
+		"GET",
+		fmt.Sprintf("/pins/%s/holders?all=%t", ci.String(), all),
+		nil,
+		nil,
+		&holders,
+	)
+	return holders, err
+}
+
+// PinReceipt returns a receipt, signed by the peer handling the request,
+// stating that the given Cid is pinned on all its allocations.
+func (c *defaultClient) PinReceipt(ctx context.Context, ci cid.Cid) (*api.PinReceipt, error) {
+	ctx, span := trace.StartSpan(ctx, "client/PinReceipt")
+	defer span.End()
+
+	var receipt api.PinReceipt
+	err := c.do(ctx, "GET", fmt.Sprintf("/pins/%s/receipt", ci.String()), nil, nil, &receipt)
+	return &receipt, err
+}
+
 // Status returns the current ipfs state for a given Cid. If local is true,
 // the information affects only the current peer, otherwise the information
 // is fetched from all cluster peers.
@@ -220,6 +405,26 @@ func (c *defaultClient) Status(ctx context.Context, ci cid.Cid, local bool) (*ap
 	return &gpi, err
 }
 
+// StatusCids returns the status of each of the given Cids, in the same
+// order, with a single request. Cids which are not pinned are reported
+// unpinned.
+func (c *defaultClient) StatusCids(ctx context.Context, cids []cid.Cid) ([]*api.GlobalPinInfo, error) {
+	ctx, span := trace.StartSpan(ctx, "client/StatusCids")
+	defer span.End()
+
+	strs := make([]string, len(cids))
+	for i, ci := range cids {
+		strs[i] = ci.String()
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.Encode(strs)
+
+	var gpis []*api.GlobalPinInfo
+	err := c.do(ctx, "POST", "/pins/status", nil, &buf, &gpis)
+	return gpis, err
+}
+
 // StatusAll gathers Status() for all tracked items. If a filter is
 // provided, only entries matching the given filter statuses
 // will be returned. A filter can be built by merging TrackerStatuses with
@@ -250,6 +455,76 @@ func (c *defaultClient) StatusAll(ctx context.Context, filter api.TrackerStatus,
 	return gpis, err
 }
 
+// PinsSummary counts the tracked items matching the filter by status, on
+// all the peers or on the current one only. With byPeer, the counts are
+// broken down per peer too.
+func (c *defaultClient) PinsSummary(ctx context.Context, filter api.TrackerStatus, local, byPeer bool) (*api.PinStatusSummary, error) {
+	ctx, span := trace.StartSpan(ctx, "client/PinsSummary")
+	defer span.End()
+
+	filterStr := ""
+	if filter != api.TrackerStatusUndefined { // undefined filter means "all"
+		filterStr = filter.String()
+		if filterStr == "" {
+			return nil, errors.New("invalid filter value")
+		}
+	}
+
+	var summary api.PinStatusSummary
+	err := c.do(
+		ctx,
+		"GET",
+		fmt.Sprintf("/pins/summary?local=%t&peers=%t&filter=%s", local, byPeer, url.QueryEscape(filterStr)),
+		nil,
+		nil,
+		&summary,
+	)
+	return &summary, err
+}
+
+// StatusAllStream is like StatusAll, but the API streams the items, which
+// are sent to the given channel as soon as they are received, rather than
+// holding the full list in memory. The channel is closed when the stream
+// ends, when the context is cancelled or when an error happens, including
+// errors reported by the API half-way through the stream.
+func (c *defaultClient) StatusAllStream(ctx context.Context, filter api.TrackerStatus, local bool, out chan<- *api.GlobalPinInfo) error {
+	ctx, span := trace.StartSpan(ctx, "client/StatusAllStream")
+	defer span.End()
+
+	defer close(out)
+
+	filterStr := ""
+	if filter != api.TrackerStatusUndefined { // undefined filter means "all"
+		filterStr = filter.String()
+		if filterStr == "" {
+			return errors.New("invalid filter value")
+		}
+	}
+
+	handler := func(dec *json.Decoder) error {
+		var obj api.GlobalPinInfo
+		err := dec.Decode(&obj)
+		if err != nil {
+			return err
+		}
+		select {
+		case out <- &obj:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return c.doStream(
+		ctx,
+		"GET",
+		fmt.Sprintf("/pins?stream=true&local=%t&filter=%s", local, url.QueryEscape(filterStr)),
+		nil,
+		nil,
+		handler,
+	)
+}
+
 // Recover retriggers pin or unpin ipfs operations for a Cid in error state.
 // If local is true, the operation is limited to the current peer, otherwise
 // it happens on every cluster peer.
@@ -262,6 +537,19 @@ func (c *defaultClient) Recover(ctx context.Context, ci cid.Cid, local bool) (*a
 	return &gpi, err
 }
 
+// Verify checks that the IPFS daemons which pinned a Cid have all its
+// blocks. Items with missing blocks are reported with the
+// TrackerStatusPinDegraded status. If local is true, only the current peer
+// is checked.
+func (c *defaultClient) Verify(ctx context.Context, ci cid.Cid, local bool) (*api.GlobalPinInfo, error) {
+	ctx, span := trace.StartSpan(ctx, "client/Verify")
+	defer span.End()
+
+	var gpi api.GlobalPinInfo
+	err := c.do(ctx, "POST", fmt.Sprintf("/pins/%s/verify?local=%t", ci.String(), local), nil, nil, &gpi)
+	return &gpi, err
+}
+
 // RecoverAll triggers Recover() operations on all tracked items. If local is
 // true, the operation is limited to the current peer. Otherwise, it happens
 // everywhere.
@@ -285,6 +573,56 @@ func (c *defaultClient) Alerts(ctx context.Context) ([]*api.Alert, error) {
 	return alerts, err
 }
 
+// DeletedPins returns the tombstones of the items unpinned through any peer
+// after the given time, the most recent first.
+func (c *defaultClient) DeletedPins(ctx context.Context, since time.Time) ([]*api.Tombstone, error) {
+	ctx, span := trace.StartSpan(ctx, "client/DeletedPins")
+	defer span.End()
+
+	path := "/pins/deleted"
+	if !since.IsZero() {
+		s, err := since.MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		path += "?since=" + url.QueryEscape(string(s))
+	}
+
+	var tombstones []*api.Tombstone
+	err := c.do(ctx, "GET", path, nil, nil, &tombstones)
+	return tombstones, err
+}
+
+// AllocationsAudit returns the last allocation decisions made by the peer,
+// the most recent first.
+func (c *defaultClient) AllocationsAudit(ctx context.Context) ([]*api.AllocationDecision, error) {
+	ctx, span := trace.StartSpan(ctx, "client/AllocationsAudit")
+	defer span.End()
+
+	var decisions []*api.AllocationDecision
+	err := c.do(ctx, "GET", "/allocations/audit", nil, nil, &decisions)
+	return decisions, err
+}
+
+// OpLog returns up to limit operations committed to the shared state after
+// the given sequence number, which is not included, waiting up to wait for
+// new ones when there are none.
+func (c *defaultClient) OpLog(ctx context.Context, after uint64, limit int, wait time.Duration) (*api.OpLogPage, error) {
+	ctx, span := trace.StartSpan(ctx, "client/OpLog")
+	defer span.End()
+
+	var page api.OpLogPage
+	err := c.do(
+		ctx,
+		"GET",
+		fmt.Sprintf("/oplog?after=%d&limit=%d&wait=%s", after, limit, wait),
+		nil,
+		nil,
+		&page,
+	)
+	return &page, err
+}
+
 // Version returns the ipfs-cluster peer's version.
 func (c *defaultClient) Version(ctx context.Context) (*api.Version, error) {
 	ctx, span := trace.StartSpan(ctx, "client/Version")
@@ -320,6 +658,53 @@ func (c *defaultClient) Metrics(ctx context.Context, name string) ([]*api.Metric
 	return metrics, err
 }
 
+// MetricsAt returns the metrics of matching name which were valid for
+// each peer at the given time, as retained by the contacted peer.
+func (c *defaultClient) MetricsAt(ctx context.Context, name string, t time.Time) ([]*api.Metric, error) {
+	ctx, span := trace.StartSpan(ctx, "client/MetricsAt")
+	defer span.End()
+
+	if name == "" {
+		return nil, errors.New("bad metric name")
+	}
+	at, err := t.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	var metrics []*api.Metric
+	err = c.do(
+		ctx,
+		"GET",
+		fmt.Sprintf("/monitor/metrics/%s?at=%s", name, url.QueryEscape(string(at))),
+		nil,
+		nil,
+		&metrics,
+	)
+	return metrics, err
+}
+
+// PeerMetricAll returns the whole window of metrics of the given name that
+// the contacted peer holds for the given peer, the most recent first,
+// including the Stale ones.
+func (c *defaultClient) PeerMetricAll(ctx context.Context, pid peer.ID, name string) ([]*api.Metric, error) {
+	ctx, span := trace.StartSpan(ctx, "client/PeerMetricAll")
+	defer span.End()
+
+	if name == "" {
+		return nil, errors.New("bad metric name")
+	}
+	var metrics []*api.Metric
+	err := c.do(
+		ctx,
+		"GET",
+		fmt.Sprintf("/monitor/metrics/%s/window/%s", name, peer.Encode(pid)),
+		nil,
+		nil,
+		&metrics,
+	)
+	return metrics, err
+}
+
 // MetricNames lists names of all metrics.
 func (c *defaultClient) MetricNames(ctx context.Context) ([]string, error) {
 	ctx, span := trace.StartSpan(ctx, "client/MetricNames")
@@ -330,6 +715,26 @@ func (c *defaultClient) MetricNames(ctx context.Context) ([]string, error) {
 	return metricsNames, err
 }
 
+// RecentAlerts returns the alerts retained by the monitor of the peer which
+// were triggered after the given time, the most recent first.
+func (c *defaultClient) RecentAlerts(ctx context.Context, since time.Time) ([]*api.Alert, error) {
+	ctx, span := trace.StartSpan(ctx, "client/RecentAlerts")
+	defer span.End()
+
+	path := "/monitor/alerts"
+	if !since.IsZero() {
+		s, err := since.MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		path += "?since=" + url.QueryEscape(string(s))
+	}
+
+	var alerts []*api.Alert
+	err := c.do(ctx, "GET", path, nil, nil, &alerts)
+	return alerts, err
+}
+
 // RepoGC runs garbage collection on IPFS daemons of cluster peers and
 // returns collected CIDs. If local is true, it would garbage collect
 // only on contacted peer, otherwise on all peers' IPFS daemons.
@@ -350,6 +755,31 @@ func (c *defaultClient) RepoGC(ctx context.Context, local bool) (*api.GlobalRepo
 	return &repoGC, err
 }
 
+// SetMaintenance enables or disables maintenance mode on all cluster
+// peers. Peers in maintenance mode do not trigger automatic actions.
+func (c *defaultClient) SetMaintenance(ctx context.Context, enabled bool) error {
+	ctx, span := trace.StartSpan(ctx, "client/SetMaintenance")
+	defer span.End()
+
+	method := "DELETE"
+	if enabled {
+		method = "POST"
+	}
+	return c.do(ctx, method, "/health/maintenance", nil, nil, nil)
+}
+
+// Sync performs a full state sync in the peer and returns a summary
+// of the corrections made once it completes. Syncing large pinsets
+// may take longer than the client Timeout.
+func (c *defaultClient) Sync(ctx context.Context) (*api.SyncSummary, error) {
+	ctx, span := trace.StartSpan(ctx, "client/Sync")
+	defer span.End()
+
+	var summary api.SyncSummary
+	err := c.do(ctx, "POST", "/sync", nil, nil, &summary)
+	return &summary, err
+}
+
 // WaitFor is a utility function that allows for a caller to wait until a CID
 // status target is reached (as given in StatusFilterParams).
 // It returns the final status for that CID and an error, if there was one.
@@ -592,6 +1022,103 @@ func (c *defaultClient) Add(
 	return c.AddMultiFile(ctx, files.NewMultiFileReader(sliceFile, true), params, out)
 }
 
+// AddResumable uploads the content of r in chunks of chunkSize bytes and
+// then adds it to the cluster, like Add does with a file. Chunks which
+// fail are sent again, from wherever the API stopped receiving data, up to
+// a few times.
+func (c *defaultClient) AddResumable(
+	ctx context.Context,
+	r io.ReadSeeker,
+	chunkSize int64,
+	params *api.AddParams,
+	out chan<- *api.AddedOutput,
+) error {
+	ctx, span := trace.StartSpan(ctx, "client/AddResumable")
+	defer span.End()
+
+	defer close(out)
+
+	if chunkSize <= 0 {
+		chunkSize = DefaultUploadChunkSize
+	}
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	var upload api.Upload
+	err = c.do(ctx, "POST", "/add/uploads", nil, nil, &upload)
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{"Content-Type": "application/octet-stream"}
+	failures := 0
+	for upload.Offset < size {
+		if _, err := r.Seek(upload.Offset, io.SeekStart); err != nil {
+			return err
+		}
+		err := c.do(
+			ctx,
+			"POST",
+			fmt.Sprintf("/add/uploads/%s?offset=%d", upload.ID, upload.Offset),
+			headers,
+			io.LimitReader(r, chunkSize),
+			&upload,
+		)
+		if err == nil {
+			failures = 0
+			continue
+		}
+
+		failures++
+		if failures > uploadRetries || ctx.Err() != nil {
+			return err
+		}
+		logger.Warnf("error uploading chunk at offset %d (retrying): %s", upload.Offset, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(uploadRetryDelay):
+		}
+
+		// Continue from wherever the API stopped receiving data.
+		var current api.Upload
+		err = c.do(ctx, "GET", "/add/uploads/"+upload.ID, nil, nil, &current)
+		if err == nil {
+			upload = current
+		}
+	}
+
+	// This method must run with StreamChannels set.
+	params.StreamChannels = true
+	queryStr, err := params.ToQueryString()
+	if err != nil {
+		return err
+	}
+
+	handler := func(dec *json.Decoder) error {
+		if out == nil {
+			return nil
+		}
+		var obj api.AddedOutput
+		err := dec.Decode(&obj)
+		if err != nil {
+			return err
+		}
+		out <- &obj
+		return nil
+	}
+
+	return c.doStream(ctx,
+		"POST",
+		fmt.Sprintf("/add/uploads/%s/add?%s", upload.ID, queryStr),
+		nil,
+		nil,
+		handler,
+	)
+}
+
 // AddMultiFile imports new files from a MultiFileReader. See Add().
 func (c *defaultClient) AddMultiFile(
 	ctx context.Context,
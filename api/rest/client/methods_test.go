@@ -1,17 +1,23 @@
 package client
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"io"
+	"math/rand"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	types "github.com/ipfs/ipfs-cluster/api"
 	rest "github.com/ipfs/ipfs-cluster/api/rest"
+	"github.com/ipfs/ipfs-cluster/rpcutil"
 	test "github.com/ipfs/ipfs-cluster/test"
 
 	cid "github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	rpc "github.com/libp2p/go-libp2p-gorpc"
 	ma "github.com/multiformats/go-multiaddr"
@@ -60,6 +66,9 @@ func TestID(t *testing.T) {
 		if id.ID == "" {
 			t.Error("bad id")
 		}
+		if id.Leader != test.PeerID1 {
+			t.Error("expected the leader in the id")
+		}
 	}
 
 	testClients(t, api, testF)
@@ -137,6 +146,103 @@ func TestPeerRm(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+func TestPeerPins(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		pins, err := c.PeerPins(ctx, test.PeerID2, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pins) != 2 {
+			t.Fatal("expected 2 pins allocated to PeerID2: ", pins)
+		}
+
+		pins, err = c.PeerPins(ctx, test.PeerID1, 2, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pins) != 1 {
+			t.Error("expected the last of 3 pins: ", pins)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestPinsDiff(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		diff, err := c.PinsDiff(ctx, test.PeerID2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(diff.Added) != 1 || len(diff.Removed) != 1 || len(diff.Changed) != 0 {
+			t.Errorf("unexpected diff: %+v", diff)
+		}
+
+		diff, err = c.PinsDiff(ctx, test.PeerID3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff.Error == "" {
+			t.Error("expected an error note for an unreachable peer")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestPinsSLA(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		breaches, err := c.PinsSLA(ctx, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(breaches) != 2 {
+			t.Errorf("unexpected breaches: %+v", breaches)
+		}
+
+		breaches, err = c.PinsSLA(ctx, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(breaches) != 1 || !breaches[0].Cid.Equals(test.Cid1) {
+			t.Errorf("unexpected local breaches: %+v", breaches)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestSetMaintenance(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		err := c.SetMaintenance(ctx, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.SetMaintenance(ctx, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
 func TestPin(t *testing.T) {
 	ctx := context.Background()
 	api := testAPI(t)
@@ -157,6 +263,27 @@ func TestPin(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+func TestPinWait(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		ack, err := c.PinWait(ctx, test.Cid1, types.PinOptions{}, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ack.Pin.Cid.Equals(test.Cid1) {
+			t.Error("bad pin in ack")
+		}
+		if !ack.Replication.Complete() {
+			t.Errorf("expected complete replication: %s", ack.Replication)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
 func TestUnpin(t *testing.T) {
 	ctx := context.Background()
 	api := testAPI(t)
@@ -204,6 +331,11 @@ var pathTestCases = []pathCase{
 		false,
 		"QmaNJ5acV31sx8jq626qTpAWW4DXKw34aGhx53dECLvXbY",
 	},
+	{
+		test.PathMFS1,
+		false,
+		test.CidMFS.String(),
+	},
 	{
 		test.InvalidPath1,
 		true,
@@ -309,6 +441,71 @@ func TestAllocation(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+func TestAllocationsLinearizable(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		pins, err := c.AllocationsLinearizable(ctx, types.DataType|types.MetaType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pins) == 0 {
+			t.Error("should be some pins")
+		}
+
+		pin, err := c.AllocationLinearizable(ctx, test.Cid1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pin.Cid.Equals(test.Cid1) {
+			t.Error("should be same pin")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestPinReceipt(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		receipt, err := c.PinReceipt(ctx, test.Cid1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !receipt.Cid.Equals(test.Cid1) {
+			t.Error("expected a receipt for the same cid")
+		}
+		if err := receipt.Verify([]peer.ID{receipt.Signer}); err != nil {
+			t.Error("the receipt should verify:", err)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestBlockHolders(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		holders, err := c.BlockHolders(ctx, test.Cid1, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(holders) != 1 || holders[0] != test.PeerID1 {
+			t.Error("expected PeerID1 as the only holder")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
 func TestStatus(t *testing.T) {
 	ctx := context.Background()
 	api := testAPI(t)
@@ -327,6 +524,24 @@ func TestStatus(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+func TestStatusCids(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		gpis, err := c.StatusCids(ctx, []cid.Cid{test.Cid1, test.NotFoundCid})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(gpis) != 2 || !gpis[0].Cid.Equals(test.Cid1) || !gpis[1].Cid.Equals(test.NotFoundCid) {
+			t.Errorf("unexpected statuses: %+v", gpis)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
 func TestStatusAll(t *testing.T) {
 	ctx := context.Background()
 	api := testAPI(t)
@@ -377,6 +592,209 @@ func TestStatusAll(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+func TestPinsSummary(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		summary, err := c.PinsSummary(ctx, 0, false, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if summary.Items != 3 || summary.Statuses["pinning"] != 1 {
+			t.Errorf("unexpected summary: %+v", summary)
+		}
+		if len(summary.Peers) != 1 {
+			t.Error("expected the counts of one peer")
+		}
+
+		summary, err = c.PinsSummary(ctx, types.TrackerStatusPinned, true, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if summary.Items != 1 || summary.Statuses["pinned"] != 1 || summary.Peers != nil {
+			t.Errorf("unexpected local summary: %+v", summary)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestPinBatch(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		batch := &types.PinBatch{
+			Pins: []*types.Pin{
+				types.PinWithOpts(test.Cid1, types.PinOptions{Name: "a"}),
+				types.PinCid(test.ErrorCid),
+			},
+		}
+		result, err := c.PinBatch(ctx, batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Pinned != 1 || result.Failed != 1 || len(result.Items) != 2 {
+			t.Fatalf("unexpected result: %+v", result)
+		}
+		if result.Items[0].Pin == nil || result.Items[0].Pin.Name != "a" || result.Items[1].Error == "" {
+			t.Errorf("unexpected items: %+v", result.Items)
+		}
+
+		batch.Atomic = true
+		result, err = c.PinBatch(ctx, batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Pinned != 0 || !result.RolledBack || result.Items[0].Pin != nil {
+			t.Errorf("unexpected atomic result: %+v", result)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestUnpinFilter(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		filter := &types.UnpinFilter{NamePrefix: ""}
+		_, err := c.UnpinFilter(ctx, filter)
+		if err == nil {
+			t.Error("expected an error with an empty filter")
+		}
+
+		filter.Allocation = test.PeerID1
+		result, err := c.UnpinFilter(ctx, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Unpinned != 0 || result.Token != filter.Token() {
+			t.Errorf("unexpected unconfirmed result: %+v", result)
+		}
+
+		filter.Confirm = result.Token
+		result2, err := c.UnpinFilter(ctx, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result2.Unpinned != result.Matched {
+			t.Errorf("unexpected confirmed result: %+v", result2)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestStatusAllStream(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		out := make(chan *types.GlobalPinInfo, 10)
+		err := c.StatusAllStream(ctx, 0, false, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pins []*types.GlobalPinInfo
+		for gpi := range out {
+			pins = append(pins, gpi)
+		}
+		if len(pins) != 3 {
+			t.Error("there should be three pins")
+		}
+
+		out = make(chan *types.GlobalPinInfo, 10)
+		err = c.StatusAllStream(ctx, types.TrackerStatusPinning, false, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out) != 1 {
+			t.Error("there should be one pin pinning")
+		}
+
+		// Cancel after receiving the first item.
+		cctx, cancel := context.WithCancel(ctx)
+		out = make(chan *types.GlobalPinInfo)
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- c.StatusAllStream(cctx, 0, false, out)
+		}()
+		<-out
+		cancel()
+		if err := <-errCh; err == nil {
+			t.Error("expected an error after cancelling the context")
+		}
+		for range out {
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+// failingStatusService serves a pinset whose status cannot be obtained for
+// the items after the first one.
+type failingStatusService struct{}
+
+func (s *failingStatusService) Pins(ctx context.Context, in struct{}, out *[]*types.Pin) error {
+	*out = []*types.Pin{types.PinCid(test.Cid1), types.PinCid(test.Cid2)}
+	return nil
+}
+
+func (s *failingStatusService) StatusCids(ctx context.Context, in []cid.Cid, out *[]*types.GlobalPinInfo) error {
+	if !in[0].Equals(test.Cid1) {
+		return errors.New("status failed")
+	}
+	*out = []*types.GlobalPinInfo{
+		{
+			Cid: test.Cid1,
+			PeerMap: map[string]*types.PinInfoShort{
+				peer.Encode(test.PeerID1): {
+					Status: types.TrackerStatusPinned,
+					TS:     time.Now(),
+				},
+			},
+		},
+	}
+	return nil
+}
+
+func TestStatusAllStreamError(t *testing.T) {
+	ctx := context.Background()
+	tapi := testAPI(t)
+	defer shutdown(tapi)
+
+	defer func(n int) { rpcutil.StatusPageSize = n }(rpcutil.StatusPageSize)
+	rpcutil.StatusPageSize = 1
+
+	rpcS := rpc.NewServer(nil, "status")
+	rpcC := rpc.NewClientWithServer(nil, "status", rpcS)
+	err := rpcS.RegisterName("Cluster", &failingStatusService{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tapi.SetClient(rpcC)
+
+	testF := func(t *testing.T, c Client) {
+		out := make(chan *types.GlobalPinInfo, 10)
+		err := c.StatusAllStream(ctx, 0, false, out)
+		if err == nil || !strings.Contains(err.Error(), "status failed") {
+			t.Errorf("expected the error after the first item: %v", err)
+		}
+		if len(out) != 1 {
+			t.Errorf("the first item should have been received: %d", len(out))
+		}
+	}
+
+	testClients(t, tapi, testF)
+}
+
 func TestRecover(t *testing.T) {
 	ctx := context.Background()
 	api := testAPI(t)
@@ -395,6 +813,44 @@ func TestRecover(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		gpi, err := c.Verify(ctx, test.DegradedCid, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pi := range gpi.PeerMap {
+			if pi.Status != types.TrackerStatusPinDegraded || len(pi.MissingBlocks) != 1 {
+				t.Errorf("expected a degraded pin: %+v", pi)
+			}
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		summary, err := c.Sync(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if summary.Peer != test.PeerID1 || len(summary.Repinned) != 1 {
+			t.Errorf("unexpected summary: %+v", summary)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
 func TestRecoverAll(t *testing.T) {
 	ctx := context.Background()
 	api := testAPI(t)
@@ -437,6 +893,133 @@ func TestAlerts(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+func TestPinIdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		kctx := WithIdempotencyKey(ctx, "retry-"+t.Name())
+		pin1, err := c.Pin(kctx, test.Cid1, types.PinOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pin2, err := c.Pin(kctx, test.Cid1, types.PinOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pin1.Cid.Equals(pin2.Cid) || !pin1.Timestamp.Equal(pin2.Timestamp) {
+			t.Error("expected the original result for the retry")
+		}
+
+		_, err = c.Pin(kctx, test.Cid2, types.PinOptions{})
+		if apiErr, ok := err.(*types.Error); !ok || apiErr.Code != 422 {
+			t.Errorf("expected an error reusing the key for another pin: %v", err)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestDeletedPins(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		tombstones, err := c.DeletedPins(ctx, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tombstones) != 1 || !tombstones[0].Cid.Equals(test.Cid1) {
+			t.Fatal("expected 1 tombstone")
+		}
+
+		tombstones, err = c.DeletedPins(ctx, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tombstones) != 0 {
+			t.Error("expected no tombstones since now")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestRecentAlerts(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		alerts, err := c.RecentAlerts(ctx, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(alerts) != 1 || alerts[0].Peer != test.PeerID2 {
+			t.Fatal("expected 1 alert")
+		}
+
+		alerts, err = c.RecentAlerts(ctx, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(alerts) != 0 {
+			t.Error("expected no alerts since the future")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestOpLog(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		page, err := c.OpLog(ctx, 0, 10, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Operations) != 2 {
+			t.Fatal("expected 2 operations")
+		}
+		if !page.Operations[0].Cid.Equals(test.Cid1) {
+			t.Error("unexpected operation cid")
+		}
+
+		_, err = c.OpLog(ctx, 11, 10, 0)
+		if err == nil {
+			t.Error("expected an error for expired entries")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestAllocationsAudit(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		decisions, err := c.AllocationsAudit(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(decisions) != 1 || len(decisions[0].Allocations) != 1 {
+			t.Fatal("expected 1 allocation decision")
+		}
+		if decisions[0].Allocations[0] != test.PeerID1 {
+			t.Error("unexpected allocation")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
 func TestGetConnectGraph(t *testing.T) {
 	ctx := context.Background()
 	api := testAPI(t)
@@ -475,6 +1058,52 @@ func TestMetrics(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+func TestMetricsAt(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	at := time.Now().Add(-time.Hour)
+	testF := func(t *testing.T, c Client) {
+		m, err := c.MetricsAt(ctx, "somemetricstype", at)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m) != 1 {
+			t.Fatal("expected one metric")
+		}
+		if m[0].ReceivedAt != at.UnixNano() {
+			t.Error("the time was not passed correctly")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
+func TestPeerMetricAll(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer shutdown(api)
+
+	testF := func(t *testing.T, c Client) {
+		m, err := c.PeerMetricAll(ctx, test.PeerID2, "somemetricstype")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(m) != 3 || m[0].Peer != test.PeerID2 {
+			t.Fatalf("unexpected window: %+v", m)
+		}
+
+		_, err = c.PeerMetricAll(ctx, test.PeerID2, "")
+		if err == nil {
+			t.Error("expected an error with an empty metric name")
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
 func TestMetricNames(t *testing.T) {
 	ctx := context.Background()
 	api := testAPI(t)
@@ -787,6 +1416,87 @@ func TestAddMultiFile(t *testing.T) {
 	testClients(t, api, testF)
 }
 
+// failingReader fails once after reading failAt bytes.
+type failingReader struct {
+	io.ReadSeeker
+	pos    int64
+	failAt int64
+	failed bool
+}
+
+func (fr *failingReader) Read(p []byte) (int, error) {
+	if !fr.failed && fr.pos < fr.failAt && fr.pos+int64(len(p)) > fr.failAt {
+		p = p[:fr.failAt-fr.pos]
+	} else if !fr.failed && fr.pos == fr.failAt {
+		fr.failed = true
+		return 0, errors.New("simulated connection failure")
+	}
+	n, err := fr.ReadSeeker.Read(p)
+	fr.pos += int64(n)
+	return n, err
+}
+
+func (fr *failingReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := fr.ReadSeeker.Seek(offset, whence)
+	fr.pos = pos
+	return pos, err
+}
+
+func TestAddResumable(t *testing.T) {
+	ctx := context.Background()
+	api := testAPI(t)
+	defer api.Shutdown(ctx)
+
+	uploadRetryDelay = 10 * time.Millisecond
+	data := make([]byte, 100*1024)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	lastCid := func(t *testing.T, add func(out chan *types.AddedOutput) error) cid.Cid {
+		out := make(chan *types.AddedOutput, 1)
+		var last cid.Cid
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for v := range out {
+				last = v.Cid
+			}
+		}()
+		if err := add(out); err != nil {
+			t.Fatal(err)
+		}
+		<-done
+		return last
+	}
+
+	testF := func(t *testing.T, c Client) {
+		p := types.DefaultAddParams()
+
+		// The second chunk fails half-way and is retried.
+		r := &failingReader{
+			ReadSeeker: bytes.NewReader(data),
+			failAt:     48 * 1024,
+		}
+		resumed := lastCid(t, func(out chan *types.AddedOutput) error {
+			return c.AddResumable(ctx, r, 32*1024, p, out)
+		})
+		if !r.failed {
+			t.Fatal("the upload should have failed once")
+		}
+
+		direct := lastCid(t, func(out chan *types.AddedOutput) error {
+			dir := files.NewSliceDirectory([]files.DirEntry{
+				files.FileEntry("data", files.NewBytesFile(data)),
+			})
+			return c.AddMultiFile(ctx, files.NewMultiFileReader(dir, true), types.DefaultAddParams(), out)
+		})
+		if !resumed.Defined() || !resumed.Equals(direct) {
+			t.Errorf("resumed upload added as %s; expected %s", resumed, direct)
+		}
+	}
+
+	testClients(t, api, testF)
+}
+
 func TestRepoGC(t *testing.T) {
 	ctx := context.Background()
 	api := testAPI(t)
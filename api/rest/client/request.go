@@ -15,6 +15,18 @@ import (
 
 type responseDecoder func(d *json.Decoder) error
 
+type idempotencyKeyCtxKey struct{}
+
+// WithIdempotencyKey returns a context making the pin and unpin requests
+// issued with it carry the given idempotency key, so that when they are
+// retried with the same key, the peer that received them returns the
+// original result instead of processing them again. Keys are not shared
+// among peers, so the retries that the load-balancing client sends to a
+// different peer are processed again.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtxKey{}, key)
+}
+
 func (c *defaultClient) do(
 	ctx context.Context,
 	method, path string,
@@ -77,6 +89,10 @@ func (c *defaultClient) doRequest(
 		r.Header.Set(k, v)
 	}
 
+	if key, ok := ctx.Value(idempotencyKeyCtxKey{}).(string); ok && key != "" {
+		r.Header.Set("Idempotency-Key", key)
+	}
+
 	if body != nil {
 		r.ContentLength = -1 // this lets go use "chunked".
 	}
@@ -92,6 +92,8 @@ func defaultFunc(cfg *common.Config) error {
 	cfg.HTTPListenAddr = addrs
 	cfg.PathSSLCertFile = ""
 	cfg.PathSSLKeyFile = ""
+	cfg.PathClientCAFile = ""
+	cfg.ClientCertIdentities = nil
 	cfg.ReadTimeout = DefaultReadTimeout
 	cfg.ReadHeaderTimeout = DefaultReadHeaderTimeout
 	cfg.WriteTimeout = DefaultWriteTimeout
@@ -0,0 +1,130 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	types "github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/api/common"
+
+	trace "go.opencensus.io/trace"
+)
+
+// IdempotencyKeyHeader is the request header carrying the idempotency key of
+// a pin or unpin request. Requests repeating the key of a recent request
+// get its original result, including its error, instead of being processed
+// again, so that clients can safely retry requests that timed out.
+//
+// Keys are only known to the peer that received the request: a retry sent
+// to a different peer, as the load-balancing client does on failover, is
+// processed again.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyKeyTTL is how long the results of requests with an idempotency
+// key are kept, and IdempotencyCacheSize how many of them at most.
+var (
+	IdempotencyKeyTTL    = 10 * time.Minute
+	IdempotencyCacheSize = 1000
+)
+
+var errIdempotencyKeyReused = errors.New("the idempotency key was used for a different request")
+
+type idempotentResult struct {
+	key     string
+	request string // method and URI
+	pin     types.Pin
+	err     error
+	expire  time.Time
+	done    chan struct{}
+}
+
+// idempotencyCache keeps the results of the recent requests by their
+// idempotency key.
+type idempotencyCache struct {
+	mu      sync.Mutex
+	results map[string]*idempotentResult
+	order   []*idempotentResult // oldest first
+}
+
+func newIdempotencyCache() *idempotencyCache {
+	return &idempotencyCache{
+		results: make(map[string]*idempotentResult),
+	}
+}
+
+// expire removes the results that expired and the oldest ones over
+// IdempotencyCacheSize. ic.mu must be held.
+func (ic *idempotencyCache) expire(now time.Time) {
+	i := 0
+	for ; i < len(ic.order); i++ {
+		res := ic.order[i]
+		current := ic.results[res.key] == res
+		if current && len(ic.order)-i <= IdempotencyCacheSize && now.Before(res.expire) {
+			break
+		}
+		if current {
+			delete(ic.results, res.key)
+		}
+	}
+	if i > 0 {
+		ic.order = append(ic.order[:0], ic.order[i:]...)
+	}
+}
+
+// do runs fn, unless a request with the same key ran it already, in which
+// case its result is returned. Concurrent requests with the same key wait
+// for the first one. Failed requests are remembered too, as the update may
+// have been committed anyway (i.e. after a commit timeout): retrying them
+// needs a new key.
+func (ic *idempotencyCache) do(ctx context.Context, key, request string, fn func() (types.Pin, error)) (types.Pin, error) {
+	now := time.Now()
+	ic.mu.Lock()
+	ic.expire(now)
+	res, ok := ic.results[key]
+	if !ok {
+		res = &idempotentResult{
+			key:     key,
+			request: request,
+			expire:  now.Add(IdempotencyKeyTTL),
+			done:    make(chan struct{}),
+		}
+		ic.results[key] = res
+		ic.order = append(ic.order, res)
+	}
+	ic.mu.Unlock()
+
+	if ok {
+		if res.request != request {
+			return types.Pin{}, errIdempotencyKeyReused
+		}
+		select {
+		case <-res.done:
+		case <-ctx.Done():
+			return types.Pin{}, ctx.Err()
+		}
+		return res.pin, res.err
+	}
+
+	res.pin, res.err = fn()
+	close(res.done)
+	return res.pin, res.err
+}
+
+// idempotent runs fn for the given request, deduplicating it with the
+// requests carrying the same idempotency key, if any. When there is a key,
+// fn is not cancelled when the request is, since its result is kept for
+// the retries. The context given to fn carries the identity of the client.
+func (api *API) idempotent(r *http.Request, fn func(ctx context.Context) (types.Pin, error)) (types.Pin, error) {
+	id := common.ClientIdentity(r)
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if key == "" {
+		return fn(types.WithClientIdentity(r.Context(), id))
+	}
+	ctx := trace.NewContext(types.WithClientIdentity(api.ctx, id), trace.FromContext(r.Context()))
+	return api.idempotency.do(r.Context(), key, r.Method+" "+r.URL.RequestURI(), func() (types.Pin, error) {
+		return fn(ctx)
+	})
+}
@@ -0,0 +1,98 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	types "github.com/ipfs/ipfs-cluster/api"
+	clustertest "github.com/ipfs/ipfs-cluster/test"
+)
+
+func TestIdempotencyCache(t *testing.T) {
+	ctx := context.Background()
+	ic := newIdempotencyCache()
+
+	var calls int32
+	pin := func() (types.Pin, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return types.Pin{Cid: clustertest.Cid1}, nil
+	}
+
+	// The same key submitted twice, concurrently and again afterwards,
+	// pins once.
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := ic.do(ctx, "key1", "POST /pins/a", pin)
+			if err != nil || !res.Cid.Equals(clustertest.Cid1) {
+				t.Errorf("unexpected result: %v, %v", res, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if _, err := ic.do(ctx, "key1", "POST /pins/a", pin); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("expected a single pin; got %d", n)
+	}
+
+	if _, err := ic.do(ctx, "key1", "POST /pins/b", pin); err != errIdempotencyKeyReused {
+		t.Errorf("expected errIdempotencyKeyReused; got %v", err)
+	}
+
+	// Failures are remembered, as the update may have been applied.
+	failed := 0
+	fail := func() (types.Pin, error) {
+		failed++
+		return types.Pin{}, errors.New("timeout")
+	}
+	ic.do(ctx, "key2", "POST /pins/a", fail)
+	if _, err := ic.do(ctx, "key2", "POST /pins/a", fail); err == nil {
+		t.Error("expected the error of the first request")
+	}
+	if failed != 1 {
+		t.Error("failed requests should not be processed again")
+	}
+}
+
+func TestIdempotencyCacheExpire(t *testing.T) {
+	ctx := context.Background()
+	defer func(ttl time.Duration, size int) {
+		IdempotencyKeyTTL = ttl
+		IdempotencyCacheSize = size
+	}(IdempotencyKeyTTL, IdempotencyCacheSize)
+
+	calls := 0
+	pin := func() (types.Pin, error) {
+		calls++
+		return types.Pin{}, nil
+	}
+
+	IdempotencyCacheSize = 2
+	ic := newIdempotencyCache()
+	for _, key := range []string{"a", "b", "c", "a"} {
+		ic.do(ctx, key, "POST /pins/a", pin)
+	}
+	if calls != 4 {
+		t.Errorf("the oldest key should have been evicted: %d calls", calls)
+	}
+
+	IdempotencyCacheSize = 10
+	IdempotencyKeyTTL = 10 * time.Millisecond
+	ic = newIdempotencyCache()
+	calls = 0
+	ic.do(ctx, "a", "POST /pins/a", pin)
+	time.Sleep(20 * time.Millisecond)
+	ic.do(ctx, "a", "POST /pins/a", pin)
+	if calls != 2 {
+		t.Errorf("the key should have expired: %d calls", calls)
+	}
+}
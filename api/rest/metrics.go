@@ -0,0 +1,109 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	types "github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/api/common"
+	"github.com/ipfs/ipfs-cluster/observations"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// monitorMetricsNamespace prefixes the names of the monitor metrics exported
+// by the /metrics endpoint.
+const monitorMetricsNamespace = "ipfscluster_monitor"
+
+// constCollector is a prometheus.Collector for a fixed set of metrics. It
+// does not describe them, so it is registered as unchecked.
+type constCollector []prom.Metric
+
+func (cc constCollector) Describe(chan<- *prom.Desc) {}
+
+func (cc constCollector) Collect(ch chan<- prom.Metric) {
+	for _, m := range cc {
+		ch <- m
+	}
+}
+
+// prometheusMetricsHandler renders, in the Prometheus text format (or
+// OpenMetrics, when requested), the latest monitor metrics of every peer
+// followed by the stats of this process when stats collection is enabled.
+// Every monitor metric is exported as a gauge named after it and labeled with
+// the peer. Metrics whose value is not a number are left out. Names which
+// are the same once sanitized get a numeric suffix, in the order of the
+// original names, since Prometheus rejects duplicate series.
+func (api *API) prometheusMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	var metricNames []string
+	err := api.rpcClient.CallContext(
+		r.Context(),
+		"",
+		"PeerMonitor",
+		"MetricNames",
+		struct{}{},
+		&metricNames,
+	)
+	if err != nil {
+		api.SendResponse(w, common.SetStatusAutomatically, err, nil)
+		return
+	}
+
+	sort.Strings(metricNames)
+	used := make(map[string]bool, len(metricNames))
+	var collector constCollector
+	for _, name := range metricNames {
+		var metrics []*types.Metric
+		err := api.rpcClient.CallContext(
+			r.Context(),
+			"",
+			"PeerMonitor",
+			"LatestMetrics",
+			name,
+			&metrics,
+		)
+		if err != nil {
+			api.SendResponse(w, common.SetStatusAutomatically, err, nil)
+			return
+		}
+
+		promName := monitorMetricsNamespace + "_" + observations.PrometheusName(name)
+		for i := 2; used[promName]; i++ {
+			promName = fmt.Sprintf("%s_%s_%d", monitorMetricsNamespace, observations.PrometheusName(name), i)
+		}
+		used[promName] = true
+
+		desc := prom.NewDesc(
+			promName,
+			"Latest value of the "+name+" metric of every peer",
+			[]string{"peer"},
+			nil,
+		)
+		for _, m := range metrics {
+			v, err := strconv.ParseFloat(m.Value, 64)
+			if err != nil {
+				continue
+			}
+			pm, err := prom.NewConstMetric(desc, prom.GaugeValue, v, m.Peer.String())
+			if err != nil {
+				logger.Error(err)
+				continue
+			}
+			collector = append(collector, pm)
+		}
+	}
+
+	registry := prom.NewRegistry()
+	registry.MustRegister(collector)
+	gatherers := prom.Gatherers{registry}
+	if g := observations.Gatherer(); g != nil {
+		gatherers = append(gatherers, g)
+	}
+	promhttp.HandlerFor(
+		gatherers,
+		promhttp.HandlerOpts{EnableOpenMetrics: true},
+	).ServeHTTP(w, r)
+}
@@ -10,16 +10,23 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"math/rand"
+	"mime/multipart"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/ipfs/ipfs-cluster/adder/adderutils"
 	types "github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/api/common"
+	"github.com/ipfs/ipfs-cluster/rpcutil"
 	"github.com/ipfs/ipfs-cluster/state"
 
+	cid "github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/libp2p/go-libp2p-core/host"
 	peer "github.com/libp2p/go-libp2p-core/peer"
@@ -37,6 +44,10 @@ var (
 	apiLogger = logging.Logger("restapilog")
 )
 
+// replicationCheckInterval is how often Pin requests which wait for
+// replication check the status of the item.
+var replicationCheckInterval = time.Second
+
 type peerAddBody struct {
 	PeerID string `json:"peer_id"`
 }
@@ -48,6 +59,12 @@ type API struct {
 
 	rpcClient *rpc.Client
 	config    *Config
+	uploads   *uploadStore
+
+	idempotency *idempotencyCache
+	// ctx outlives the requests. Idempotent requests are processed with
+	// it.
+	ctx context.Context
 }
 
 // NewAPI creates a new REST API component.
@@ -58,13 +75,28 @@ func NewAPI(ctx context.Context, cfg *Config) (*API, error) {
 // NewAPI creates a new REST API component using the given libp2p Host.
 func NewAPIWithHost(ctx context.Context, cfg *Config, h host.Host) (*API, error) {
 	api := API{
-		config: cfg,
+		config:      cfg,
+		uploads:     newUploadStore(),
+		idempotency: newIdempotencyCache(),
+		ctx:         ctx,
 	}
 	capi, err := common.NewAPIWithHost(ctx, &cfg.Config, h, api.routes)
+	if err != nil {
+		api.uploads.close()
+	}
 	api.API = capi
 	return &api, err
 }
 
+// Shutdown stops the API and removes any partial uploads.
+func (api *API) Shutdown(ctx context.Context) error {
+	err := api.API.Shutdown(ctx)
+	if uerr := api.uploads.close(); uerr != nil {
+		logger.Error(uerr)
+	}
+	return err
+}
+
 // Routes returns endpoints supported by this API.
 func (api *API) routes(c *rpc.Client) []common.Route {
 	api.rpcClient = c
@@ -101,18 +133,78 @@ func (api *API) routes(c *rpc.Client) []common.Route {
 			Pattern:     "/peers/{peer}",
 			HandlerFunc: api.peerRemoveHandler,
 		},
+		{
+			Name:        "PeerPins",
+			Method:      "GET",
+			Pattern:     "/peers/{peer}/pins",
+			HandlerFunc: api.peerPinsHandler,
+		},
+		{
+			Name:        "PinsDiff",
+			Method:      "GET",
+			Pattern:     "/pins/diff/{peer}",
+			HandlerFunc: api.pinsDiffHandler,
+		},
+		{
+			Name:        "PinsSLA",
+			Method:      "GET",
+			Pattern:     "/pins/sla",
+			HandlerFunc: api.pinsSLAHandler,
+		},
+		{
+			Name:        "PinsSummary",
+			Method:      "GET",
+			Pattern:     "/pins/summary",
+			HandlerFunc: api.pinsSummaryHandler,
+		},
 		{
 			Name:        "Add",
 			Method:      "POST",
 			Pattern:     "/add",
 			HandlerFunc: api.addHandler,
 		},
+		{
+			Name:        "UploadCreate",
+			Method:      "POST",
+			Pattern:     "/add/uploads",
+			HandlerFunc: api.uploadCreateHandler,
+		},
+		{
+			Name:        "UploadGet",
+			Method:      "GET",
+			Pattern:     "/add/uploads/{id}",
+			HandlerFunc: api.uploadGetHandler,
+		},
+		{
+			Name:        "UploadWrite",
+			Method:      "POST",
+			Pattern:     "/add/uploads/{id}",
+			HandlerFunc: api.uploadWriteHandler,
+		},
+		{
+			Name:        "UploadAdd",
+			Method:      "POST",
+			Pattern:     "/add/uploads/{id}/add",
+			HandlerFunc: api.uploadAddHandler,
+		},
+		{
+			Name:        "UploadDelete",
+			Method:      "DELETE",
+			Pattern:     "/add/uploads/{id}",
+			HandlerFunc: api.uploadDeleteHandler,
+		},
 		{
 			Name:        "Allocations",
 			Method:      "GET",
 			Pattern:     "/allocations",
 			HandlerFunc: api.allocationsHandler,
 		},
+		{
+			Name:        "AllocationsAudit",
+			Method:      "GET",
+			Pattern:     "/allocations/audit",
+			HandlerFunc: api.allocationsAuditHandler,
+		},
 		{
 			Name:        "Allocation",
 			Method:      "GET",
@@ -131,12 +223,60 @@ func (api *API) routes(c *rpc.Client) []common.Route {
 			Pattern:     "/pins/{hash}/recover",
 			HandlerFunc: api.recoverHandler,
 		},
+		{
+			Name:        "BlockHolders",
+			Method:      "GET",
+			Pattern:     "/pins/{hash}/holders",
+			HandlerFunc: api.blockHoldersHandler,
+		},
+		{
+			Name:        "PinReceipt",
+			Method:      "GET",
+			Pattern:     "/pins/{hash}/receipt",
+			HandlerFunc: api.pinReceiptHandler,
+		},
+		{
+			Name:        "Update",
+			Method:      "POST",
+			Pattern:     "/pins/{hash}/update",
+			HandlerFunc: api.updateHandler,
+		},
+		{
+			Name:        "Verify",
+			Method:      "POST",
+			Pattern:     "/pins/{hash}/verify",
+			HandlerFunc: api.verifyHandler,
+		},
 		{
 			Name:        "RecoverAll",
 			Method:      "POST",
 			Pattern:     "/pins/recover",
 			HandlerFunc: api.recoverAllHandler,
 		},
+		{
+			Name:        "PinBatch",
+			Method:      "POST",
+			Pattern:     "/pins/batch",
+			HandlerFunc: api.pinBatchHandler,
+		},
+		{
+			Name:        "StatusCids",
+			Method:      "POST",
+			Pattern:     "/pins/status",
+			HandlerFunc: api.statusCidsHandler,
+		},
+		{
+			Name:        "DeletedPins",
+			Method:      "GET",
+			Pattern:     "/pins/deleted",
+			HandlerFunc: api.deletedPinsHandler,
+		},
+		{
+			Name:        "UnpinFilter",
+			Method:      "POST",
+			Pattern:     "/pins/unpin-filter",
+			HandlerFunc: api.unpinFilterHandler,
+		},
 		{
 			Name:        "Status",
 			Method:      "GET",
@@ -152,7 +292,7 @@ func (api *API) routes(c *rpc.Client) []common.Route {
 		{
 			Name:        "PinPath",
 			Method:      "POST",
-			Pattern:     "/pins/{keyType:ipfs|ipns|ipld}/{path:.*}",
+			Pattern:     "/pins/{keyType:ipfs|ipns|ipld|mfs}/{path:.*}",
 			HandlerFunc: api.pinPathHandler,
 		},
 		{
@@ -164,7 +304,7 @@ func (api *API) routes(c *rpc.Client) []common.Route {
 		{
 			Name:        "UnpinPath",
 			Method:      "DELETE",
-			Pattern:     "/pins/{keyType:ipfs|ipns|ipld}/{path:.*}",
+			Pattern:     "/pins/{keyType:ipfs|ipns|ipld|mfs}/{path:.*}",
 			HandlerFunc: api.unpinPathHandler,
 		},
 		{
@@ -173,6 +313,18 @@ func (api *API) routes(c *rpc.Client) []common.Route {
 			Pattern:     "/ipfs/gc",
 			HandlerFunc: api.repoGCHandler,
 		},
+		{
+			Name:        "Sync",
+			Method:      "POST",
+			Pattern:     "/sync",
+			HandlerFunc: api.syncHandler,
+		},
+		{
+			Name:        "Health",
+			Method:      "GET",
+			Pattern:     "/health",
+			HandlerFunc: api.healthHandler,
+		},
 		{
 			Name:        "ConnectionGraph",
 			Method:      "GET",
@@ -185,18 +337,54 @@ func (api *API) routes(c *rpc.Client) []common.Route {
 			Pattern:     "/health/alerts",
 			HandlerFunc: api.alertsHandler,
 		},
+		{
+			Name:        "MaintenanceEnable",
+			Method:      "POST",
+			Pattern:     "/health/maintenance",
+			HandlerFunc: api.maintenanceHandler,
+		},
+		{
+			Name:        "MaintenanceDisable",
+			Method:      "DELETE",
+			Pattern:     "/health/maintenance",
+			HandlerFunc: api.maintenanceHandler,
+		},
+		{
+			Name:        "OpLog",
+			Method:      "GET",
+			Pattern:     "/oplog",
+			HandlerFunc: api.opLogHandler,
+		},
 		{
 			Name:        "Metrics",
 			Method:      "GET",
 			Pattern:     "/monitor/metrics/{name}",
 			HandlerFunc: api.metricsHandler,
 		},
+		{
+			Name:        "RecentAlerts",
+			Method:      "GET",
+			Pattern:     "/monitor/alerts",
+			HandlerFunc: api.recentAlertsHandler,
+		},
+		{
+			Name:        "PeerMetricAll",
+			Method:      "GET",
+			Pattern:     "/monitor/metrics/{name}/window/{peer}",
+			HandlerFunc: api.peerMetricAllHandler,
+		},
 		{
 			Name:        "MetricNames",
 			Method:      "GET",
 			Pattern:     "/monitor/metrics",
 			HandlerFunc: api.metricNamesHandler,
 		},
+		{
+			Name:        "PrometheusMetrics",
+			Method:      "GET",
+			Pattern:     "/metrics",
+			HandlerFunc: api.prometheusMetricsHandler,
+		},
 	}
 }
 
@@ -228,6 +416,42 @@ func (api *API) versionHandler(w http.ResponseWriter, r *http.Request) {
 	api.SendResponse(w, common.SetStatusAutomatically, err, v)
 }
 
+func (api *API) syncHandler(w http.ResponseWriter, r *http.Request) {
+	var summary types.SyncSummary
+	err := api.rpcClient.CallContext(
+		r.Context(),
+		"",
+		"Cluster",
+		"Sync",
+		struct{}{},
+		&summary,
+	)
+	api.SendResponse(w, common.SetStatusAutomatically, err, summary)
+}
+
+func (api *API) healthHandler(w http.ResponseWriter, r *http.Request) {
+	var health types.Health
+	err := api.rpcClient.CallContext(
+		r.Context(),
+		"",
+		"Cluster",
+		"Health",
+		struct{}{},
+		&health,
+	)
+	if err != nil {
+		api.SendResponse(w, common.SetStatusAutomatically, err, nil)
+		return
+	}
+
+	// Let load balancers take DOWN peers out of rotation.
+	status := http.StatusOK
+	if health.Status == types.HealthDown {
+		status = http.StatusServiceUnavailable
+	}
+	api.SendResponse(w, status, nil, health)
+}
+
 func (api *API) graphHandler(w http.ResponseWriter, r *http.Request) {
 	var graph types.ConnectGraph
 	err := api.rpcClient.CallContext(
@@ -246,6 +470,24 @@ func (api *API) metricsHandler(w http.ResponseWriter, r *http.Request) {
 	name := vars["name"]
 
 	var metrics []*types.Metric
+	if at := r.URL.Query().Get("at"); at != "" {
+		var t time.Time
+		if err := t.UnmarshalText([]byte(at)); err != nil {
+			api.SendResponse(w, http.StatusBadRequest, errors.New("error decoding at parameter: "+err.Error()), nil)
+			return
+		}
+		err := api.rpcClient.CallContext(
+			r.Context(),
+			"",
+			"PeerMonitor",
+			"MetricsAt",
+			&types.MetricsAtRequest{Name: name, Time: t},
+			&metrics,
+		)
+		api.SendResponse(w, common.SetStatusAutomatically, err, metrics)
+		return
+	}
+
 	err := api.rpcClient.CallContext(
 		r.Context(),
 		"",
@@ -257,6 +499,27 @@ func (api *API) metricsHandler(w http.ResponseWriter, r *http.Request) {
 	api.SendResponse(w, common.SetStatusAutomatically, err, metrics)
 }
 
+// peerMetricAllHandler returns the whole window of metrics of a given name
+// that the monitor of this peer holds for the given peer, to help debugging
+// allocations.
+func (api *API) peerMetricAllHandler(w http.ResponseWriter, r *http.Request) {
+	p := api.ParsePidOrFail(w, r)
+	if p == "" {
+		return
+	}
+
+	var metrics []*types.Metric
+	err := api.rpcClient.CallContext(
+		r.Context(),
+		"",
+		"PeerMonitor",
+		"PeerMetricAll",
+		&types.PeerMetricRequest{Peer: p, Name: mux.Vars(r)["name"]},
+		&metrics,
+	)
+	api.SendResponse(w, common.SetStatusAutomatically, err, metrics)
+}
+
 func (api *API) metricNamesHandler(w http.ResponseWriter, r *http.Request) {
 	var metricNames []string
 	err := api.rpcClient.CallContext(
@@ -270,6 +533,30 @@ func (api *API) metricNamesHandler(w http.ResponseWriter, r *http.Request) {
 	api.SendResponse(w, common.SetStatusAutomatically, err, metricNames)
 }
 
+// recentAlertsHandler returns the alerts retained by the monitor of this
+// peer, optionally only those triggered after the time given in the since
+// parameter.
+func (api *API) recentAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	var since time.Time
+	if s := r.URL.Query().Get("since"); s != "" {
+		if err := since.UnmarshalText([]byte(s)); err != nil {
+			api.SendResponse(w, http.StatusBadRequest, errors.New("error decoding since parameter: "+err.Error()), nil)
+			return
+		}
+	}
+
+	var alerts []*types.Alert
+	err := api.rpcClient.CallContext(
+		r.Context(),
+		"",
+		"PeerMonitor",
+		"RecentAlerts",
+		since,
+		&alerts,
+	)
+	api.SendResponse(w, common.SetStatusAutomatically, err, alerts)
+}
+
 func (api *API) alertsHandler(w http.ResponseWriter, r *http.Request) {
 	var alerts []types.Alert
 	err := api.rpcClient.CallContext(
@@ -283,6 +570,86 @@ func (api *API) alertsHandler(w http.ResponseWriter, r *http.Request) {
 	api.SendResponse(w, common.SetStatusAutomatically, err, alerts)
 }
 
+func (api *API) allocationsAuditHandler(w http.ResponseWriter, r *http.Request) {
+	var decisions []*types.AllocationDecision
+	err := api.rpcClient.CallContext(
+		r.Context(),
+		"",
+		"Cluster",
+		"AllocationsAudit",
+		struct{}{},
+		&decisions,
+	)
+	api.SendResponse(w, common.SetStatusAutomatically, err, decisions)
+}
+
+// deletedPinsHandler returns the tombstones of the items unpinned through
+// any peer, optionally only those unpinned after the time given in the since
+// parameter.
+func (api *API) deletedPinsHandler(w http.ResponseWriter, r *http.Request) {
+	var since time.Time
+	if s := r.URL.Query().Get("since"); s != "" {
+		if err := since.UnmarshalText([]byte(s)); err != nil {
+			api.SendResponse(w, http.StatusBadRequest, errors.New("error decoding since parameter: "+err.Error()), nil)
+			return
+		}
+	}
+
+	var tombstones []*types.Tombstone
+	err := api.rpcClient.CallContext(
+		r.Context(),
+		"",
+		"Cluster",
+		"DeletedPins",
+		since,
+		&tombstones,
+	)
+	api.SendResponse(w, common.SetStatusAutomatically, err, tombstones)
+}
+
+func (api *API) opLogHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	req := &types.OpLogRequest{}
+
+	if after := q.Get("after"); after != "" {
+		n, err := strconv.ParseUint(after, 10, 64)
+		if err != nil {
+			api.SendResponse(w, http.StatusBadRequest, errors.New("error decoding after parameter: "+err.Error()), nil)
+			return
+		}
+		req.After = n
+	}
+
+	if limit := q.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			api.SendResponse(w, http.StatusBadRequest, errors.New("error decoding limit parameter: "+err.Error()), nil)
+			return
+		}
+		req.Limit = n
+	}
+
+	if wait := q.Get("wait"); wait != "" {
+		d, err := time.ParseDuration(wait)
+		if err != nil {
+			api.SendResponse(w, http.StatusBadRequest, errors.New("error decoding wait parameter: "+err.Error()), nil)
+			return
+		}
+		req.Wait = d
+	}
+
+	var page types.OpLogPage
+	err := api.rpcClient.CallContext(
+		r.Context(),
+		"",
+		"Cluster",
+		"OpLog",
+		req,
+		&page,
+	)
+	api.SendResponse(w, common.SetStatusAutomatically, err, page)
+}
+
 func (api *API) addHandler(w http.ResponseWriter, r *http.Request) {
 	reader, err := r.MultipartReader()
 	if err != nil {
@@ -309,6 +676,98 @@ func (api *API) addHandler(w http.ResponseWriter, r *http.Request) {
 	)
 }
 
+func (api *API) uploadCreateHandler(w http.ResponseWriter, r *http.Request) {
+	upload, err := api.uploads.create()
+	api.SendResponse(w, common.SetStatusAutomatically, err, upload)
+}
+
+func (api *API) uploadGetHandler(w http.ResponseWriter, r *http.Request) {
+	upload, err := api.uploads.get(mux.Vars(r)["id"])
+	api.sendUploadResponse(w, err, upload)
+}
+
+// uploadWriteHandler appends the request body to an upload. The offset
+// parameter must match the size of the data received so far.
+func (api *API) uploadWriteHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil {
+		api.SendResponse(w, http.StatusBadRequest, errors.New("error decoding offset parameter: "+err.Error()), nil)
+		return
+	}
+
+	upload, err := api.uploads.write(mux.Vars(r)["id"], offset, r.Body)
+	api.sendUploadResponse(w, err, upload)
+}
+
+// uploadAddHandler adds the data of a complete upload, like addHandler does
+// with a multipart request, and removes the upload. Uploads which fail to
+// be added are kept, so that they can be added again.
+func (api *API) uploadAddHandler(w http.ResponseWriter, r *http.Request) {
+	params, err := types.AddParamsFromQuery(r.URL.Query())
+	if err != nil {
+		api.SendResponse(w, http.StatusBadRequest, err, nil)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	upload, f, err := api.uploads.open(id)
+	if err != nil {
+		api.sendUploadResponse(w, err, nil)
+		return
+	}
+	defer f.Close()
+
+	name := params.Name
+	if name == "" {
+		name = id
+	}
+	dir := files.NewSliceDirectory([]files.DirEntry{
+		files.FileEntry(name, files.NewReaderFile(f)),
+	})
+	mfr := files.NewMultiFileReader(dir, true)
+
+	api.SetHeaders(w)
+
+	// any errors sent as trailer
+	_, err = adderutils.AddMultipartHTTPHandler(
+		r.Context(),
+		api.rpcClient,
+		params,
+		multipart.NewReader(mfr, mfr.Boundary()),
+		w,
+		nil,
+	)
+	if err != nil {
+		logger.Warnf("upload %s could not be added. It is kept until it expires: %s", id, err)
+		api.uploads.release(upload)
+		return
+	}
+	if err := api.uploads.remove(id); err != nil {
+		logger.Error(err)
+	}
+}
+
+func (api *API) uploadDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	err := api.uploads.remove(mux.Vars(r)["id"])
+	api.sendUploadResponse(w, err, nil)
+}
+
+func (api *API) sendUploadResponse(w http.ResponseWriter, err error, upload *types.Upload) {
+	var offsetErr errUploadOffset
+	switch {
+	case err == errUploadNotFound:
+		api.SendResponse(w, http.StatusNotFound, err, nil)
+	case err == errUploadBusy, errors.As(err, &offsetErr):
+		api.SendResponse(w, http.StatusConflict, err, nil)
+	case err == errUploadQuota:
+		api.SendResponse(w, http.StatusInsufficientStorage, err, nil)
+	default:
+		api.SendResponse(w, common.SetStatusAutomatically, err, upload)
+	}
+}
+
 func (api *API) peerListHandler(w http.ResponseWriter, r *http.Request) {
 	var peers []*types.ID
 	err := api.rpcClient.CallContext(
@@ -352,48 +811,210 @@ func (api *API) peerAddHandler(w http.ResponseWriter, r *http.Request) {
 	api.SendResponse(w, common.SetStatusAutomatically, err, &id)
 }
 
-func (api *API) peerRemoveHandler(w http.ResponseWriter, r *http.Request) {
-	if p := api.ParsePidOrFail(w, r); p != "" {
-		err := api.rpcClient.CallContext(
-			r.Context(),
-			"",
-			"Cluster",
-			"PeerRemove",
-			p,
-			&struct{}{},
-		)
-		api.SendResponse(w, common.SetStatusAutomatically, err, nil)
+// peerPinsHandler lists the pins allocated to a peer, including those pinned
+// everywhere, from the shared state. They are sorted by cid and can be paged
+// with the offset and limit parameters.
+func (api *API) peerPinsHandler(w http.ResponseWriter, r *http.Request) {
+	p := api.ParsePidOrFail(w, r)
+	if p == "" {
+		return
 	}
-}
 
-func (api *API) pinHandler(w http.ResponseWriter, r *http.Request) {
-	if pin := api.ParseCidOrFail(w, r); pin != nil {
-		api.config.Logger.Debugf("rest api pinHandler: %s", pin.Cid)
-		// span.AddAttributes(trace.StringAttribute("cid", pin.Cid))
-		var pinObj types.Pin
-		err := api.rpcClient.CallContext(
-			r.Context(),
-			"",
-			"Cluster",
-			"Pin",
-			pin,
-			&pinObj,
-		)
-		api.SendResponse(w, common.SetStatusAutomatically, err, pinObj)
-		api.config.Logger.Debug("rest api pinHandler done")
-	}
+	q := r.URL.Query()
+	offset := 0
+	if o := q.Get("offset"); o != "" {
+		n, err := strconv.Atoi(o)
+		if err != nil || n < 0 {
+			api.SendResponse(w, http.StatusBadRequest, errors.New("error decoding offset parameter"), nil)
+			return
+		}
+		offset = n
+	}
+	limit := 0
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			api.SendResponse(w, http.StatusBadRequest, errors.New("error decoding limit parameter"), nil)
+			return
+		}
+		limit = n
+	}
+
+	var pins []*types.Pin
+	err := api.rpcClient.CallContext(
+		r.Context(),
+		"",
+		"Cluster",
+		"Pins",
+		struct{}{},
+		&pins,
+	)
+	if err != nil {
+		api.SendResponse(w, common.SetStatusAutomatically, err, nil)
+		return
+	}
+
+	peerPins := make([]*types.Pin, 0)
+	for _, pin := range pins {
+		if pin.IsPinEverywhere() || containsPeer(pin.Allocations, p) {
+			peerPins = append(peerPins, pin)
+		}
+	}
+	sort.Slice(peerPins, func(i, j int) bool {
+		return peerPins[i].Cid.KeyString() < peerPins[j].Cid.KeyString()
+	})
+
+	if offset > len(peerPins) {
+		offset = len(peerPins)
+	}
+	peerPins = peerPins[offset:]
+	if limit > 0 && limit < len(peerPins) {
+		peerPins = peerPins[:limit]
+	}
+	api.SendResponse(w, common.SetStatusAutomatically, nil, peerPins)
+}
+
+// pinsDiffHandler compares the shared state of this peer with that of the
+// given one.
+func (api *API) pinsDiffHandler(w http.ResponseWriter, r *http.Request) {
+	p := api.ParsePidOrFail(w, r)
+	if p == "" {
+		return
+	}
+
+	var diff types.PinsDiff
+	err := api.rpcClient.CallContext(
+		r.Context(),
+		"",
+		"Cluster",
+		"PinsDiff",
+		p,
+		&diff,
+	)
+	api.SendResponse(w, common.SetStatusAutomatically, err, &diff)
+}
+
+func (api *API) pinsSLAHandler(w http.ResponseWriter, r *http.Request) {
+	breaches := []*types.PinSLABreach{}
+	var err error
+	if r.URL.Query().Get("local") == "true" {
+		err = api.rpcClient.CallContext(
+			r.Context(),
+			"",
+			"PinTracker",
+			"SLABreaches",
+			struct{}{},
+			&breaches,
+		)
+	} else {
+		err = api.rpcClient.CallContext(
+			r.Context(),
+			"",
+			"Cluster",
+			"SLABreaches",
+			struct{}{},
+			&breaches,
+		)
+	}
+	api.SendResponse(w, common.SetStatusAutomatically, err, breaches)
+}
+
+func containsPeer(peers []peer.ID, p peer.ID) bool {
+	for _, pid := range peers {
+		if pid == p {
+			return true
+		}
+	}
+	return false
+}
+
+func (api *API) peerRemoveHandler(w http.ResponseWriter, r *http.Request) {
+	if p := api.ParsePidOrFail(w, r); p != "" {
+		err := api.rpcClient.CallContext(
+			r.Context(),
+			"",
+			"Cluster",
+			"PeerRemove",
+			p,
+			&struct{}{},
+		)
+		api.SendResponse(w, common.SetStatusAutomatically, err, nil)
+	}
+}
+
+func (api *API) maintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	err := api.rpcClient.CallContext(
+		r.Context(),
+		"",
+		"Cluster",
+		"SetMaintenance",
+		r.Method == http.MethodPost,
+		&struct{}{},
+	)
+	api.SendResponse(w, common.SetStatusAutomatically, err, nil)
+}
+
+func (api *API) pinHandler(w http.ResponseWriter, r *http.Request) {
+	if pin := api.ParseCidOrFail(w, r); pin != nil {
+		api.config.Logger.Debugf("rest api pinHandler: %s", pin.Cid)
+		// span.AddAttributes(trace.StringAttribute("cid", pin.Cid))
+		wait, ok := api.parseWaitReplicationOrFail(w, r)
+		if !ok {
+			return
+		}
+		pinObj, err := api.idempotent(r, func(ctx context.Context) (types.Pin, error) {
+			var pinObj types.Pin
+			err := api.rpcClient.CallContext(
+				ctx,
+				"",
+				"Cluster",
+				"Pin",
+				pin,
+				&pinObj,
+			)
+			return pinObj, err
+		})
+		api.sendPinResponse(w, r, err, &pinObj, wait)
+		api.config.Logger.Debug("rest api pinHandler done")
+	}
 }
 
 func (api *API) unpinHandler(w http.ResponseWriter, r *http.Request) {
 	if pin := api.ParseCidOrFail(w, r); pin != nil {
 		api.config.Logger.Debugf("rest api unpinHandler: %s", pin.Cid)
 		// span.AddAttributes(trace.StringAttribute("cid", pin.Cid))
+		pinObj, err := api.idempotent(r, func(ctx context.Context) (types.Pin, error) {
+			var pinObj types.Pin
+			err := api.rpcClient.CallContext(
+				ctx,
+				"",
+				"Cluster",
+				"Unpin",
+				pin,
+				&pinObj,
+			)
+			return pinObj, err
+		})
+		if err != nil && err.Error() == state.ErrNotFound.Error() {
+			api.SendResponse(w, http.StatusNotFound, err, nil)
+			return
+		}
+		api.sendPinResponse(w, r, err, &pinObj, 0)
+		api.config.Logger.Debug("rest api unpinHandler done")
+	}
+}
+
+// updateHandler changes the options of an existing pin, given in the query
+// like when pinning, without unpinning it.
+func (api *API) updateHandler(w http.ResponseWriter, r *http.Request) {
+	if pin := api.ParseCidOrFail(w, r); pin != nil {
+		api.config.Logger.Debugf("rest api updateHandler: %s", pin.Cid)
 		var pinObj types.Pin
 		err := api.rpcClient.CallContext(
-			r.Context(),
+			types.WithClientIdentity(r.Context(), common.ClientIdentity(r)),
 			"",
 			"Cluster",
-			"Unpin",
+			"Update",
 			pin,
 			&pinObj,
 		)
@@ -402,45 +1023,190 @@ func (api *API) unpinHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		api.SendResponse(w, common.SetStatusAutomatically, err, pinObj)
-		api.config.Logger.Debug("rest api unpinHandler done")
+		api.config.Logger.Debug("rest api updateHandler done")
+	}
+}
+
+// unpinFilterHandler unpins the pins matching the filter in the body. The
+// confirm parameter must be set to the token returned when calling it
+// without one, which only counts the matching pins.
+func (api *API) unpinFilterHandler(w http.ResponseWriter, r *http.Request) {
+	var filter types.UnpinFilter
+	if err := json.NewDecoder(r.Body).Decode(&filter); err != nil {
+		api.SendResponse(w, http.StatusBadRequest, errors.New("error decoding the unpin filter: "+err.Error()), nil)
+		return
 	}
+	filter.Confirm = r.URL.Query().Get("confirm")
+
+	var result types.UnpinFilterResult
+	err := api.rpcClient.CallContext(
+		types.WithClientIdentity(r.Context(), common.ClientIdentity(r)),
+		"",
+		"Cluster",
+		"UnpinFilter",
+		&filter,
+		&result,
+	)
+	api.SendResponse(w, common.SetStatusAutomatically, err, result)
+}
+
+// pinBatchHandler pins the array of pins in the body together. When the
+// atomic parameter is true, either all of them are pinned or none is.
+func (api *API) pinBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var pins []*types.Pin
+	if err := json.NewDecoder(r.Body).Decode(&pins); err != nil {
+		api.SendResponse(w, http.StatusBadRequest, errors.New("error decoding the pin batch: "+err.Error()), nil)
+		return
+	}
+	if len(pins) == 0 {
+		api.SendResponse(w, http.StatusBadRequest, errors.New("the pin batch is empty"), nil)
+		return
+	}
+
+	for _, pin := range pins {
+		if pin == nil {
+			api.SendResponse(w, http.StatusBadRequest, errors.New("error decoding the pin batch: null pin"), nil)
+			return
+		}
+	}
+
+	batch := types.PinBatch{
+		Pins:   pins,
+		Atomic: r.URL.Query().Get("atomic") == "true",
+	}
+	var result types.PinBatchResult
+	err := api.rpcClient.CallContext(
+		types.WithClientIdentity(r.Context(), common.ClientIdentity(r)),
+		"",
+		"Cluster",
+		"PinBatch",
+		&batch,
+		&result,
+	)
+	api.SendResponse(w, common.SetStatusAutomatically, err, result)
 }
 
 func (api *API) pinPathHandler(w http.ResponseWriter, r *http.Request) {
-	var pin types.Pin
 	if pinpath := api.ParsePinPathOrFail(w, r); pinpath != nil {
 		api.config.Logger.Debugf("rest api pinPathHandler: %s", pinpath.Path)
+		wait, ok := api.parseWaitReplicationOrFail(w, r)
+		if !ok {
+			return
+		}
+		pin, err := api.idempotent(r, func(ctx context.Context) (types.Pin, error) {
+			var pin types.Pin
+			err := api.rpcClient.CallContext(
+				ctx,
+				"",
+				"Cluster",
+				"PinPath",
+				pinpath,
+				&pin,
+			)
+			return pin, err
+		})
+		api.sendPinResponse(w, r, err, &pin, wait)
+		api.config.Logger.Debug("rest api pinPathHandler done")
+	}
+}
+
+// parseWaitReplicationOrFail parses the wait-replication query parameter,
+// which sets how long Pin requests wait for the item to be replicated.
+func (api *API) parseWaitReplicationOrFail(w http.ResponseWriter, r *http.Request) (time.Duration, bool) {
+	waitStr := r.URL.Query().Get("wait-replication")
+	if waitStr == "" {
+		return 0, true
+	}
+	wait, err := time.ParseDuration(waitStr)
+	if err != nil || wait < 0 {
+		api.SendResponse(w, http.StatusBadRequest, errors.New("error decoding wait-replication parameter"), nil)
+		return 0, false
+	}
+	return wait, true
+}
+
+// sendPinResponse responds to a Pin or Unpin request with the pin or, when
+// the request asked to wait for replication, with a PinAck reporting how
+// many allocations pinned the item before the wait expired. Requests reusing
+// an idempotency key for a different request get 422 Unprocessable Entity.
+func (api *API) sendPinResponse(w http.ResponseWriter, r *http.Request, err error, pin *types.Pin, wait time.Duration) {
+	if err == errIdempotencyKeyReused {
+		api.SendResponse(w, http.StatusUnprocessableEntity, err, nil)
+		return
+	}
+	if err != nil || wait == 0 || pin.DryRun {
+		api.SendResponse(w, common.SetStatusAutomatically, err, pin)
+		return
+	}
+
+	ack := types.PinAck{
+		Pin:         *pin,
+		Replication: api.waitForReplication(r.Context(), pin, wait),
+	}
+	api.SendResponse(w, common.SetStatusAutomatically, nil, ack)
+}
+
+// waitForReplication polls the status of the given pin until all its
+// allocations have pinned it or the wait expires, and returns the
+// replication achieved.
+func (api *API) waitForReplication(ctx context.Context, pin *types.Pin, wait time.Duration) types.PinReplication {
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	ticker := time.NewTicker(replicationCheckInterval)
+	defer ticker.Stop()
+
+	var rpl types.PinReplication
+	for {
+		var gpi types.GlobalPinInfo
 		err := api.rpcClient.CallContext(
-			r.Context(),
+			ctx,
 			"",
 			"Cluster",
-			"PinPath",
-			pinpath,
-			&pin,
+			"Status",
+			pin.Cid,
+			&gpi,
 		)
+		if err != nil {
+			if ctx.Err() != nil {
+				return rpl
+			}
+			logger.Error(err)
+		} else {
+			rpl = gpi.Replication(pin.Allocations)
+			if rpl.Complete() {
+				return rpl
+			}
+		}
 
-		api.SendResponse(w, common.SetStatusAutomatically, err, pin)
-		api.config.Logger.Debug("rest api pinPathHandler done")
+		select {
+		case <-ctx.Done():
+			return rpl
+		case <-ticker.C:
+		}
 	}
 }
 
 func (api *API) unpinPathHandler(w http.ResponseWriter, r *http.Request) {
-	var pin types.Pin
 	if pinpath := api.ParsePinPathOrFail(w, r); pinpath != nil {
 		api.config.Logger.Debugf("rest api unpinPathHandler: %s", pinpath.Path)
-		err := api.rpcClient.CallContext(
-			r.Context(),
-			"",
-			"Cluster",
-			"UnpinPath",
-			pinpath,
-			&pin,
-		)
+		pin, err := api.idempotent(r, func(ctx context.Context) (types.Pin, error) {
+			var pin types.Pin
+			err := api.rpcClient.CallContext(
+				ctx,
+				"",
+				"Cluster",
+				"UnpinPath",
+				pinpath,
+				&pin,
+			)
+			return pin, err
+		})
 		if err != nil && err.Error() == state.ErrNotFound.Error() {
 			api.SendResponse(w, http.StatusNotFound, err, nil)
 			return
 		}
-		api.SendResponse(w, common.SetStatusAutomatically, err, pin)
+		api.sendPinResponse(w, r, err, &pin, 0)
 		api.config.Logger.Debug("rest api unpinPathHandler done")
 	}
 }
@@ -458,12 +1224,17 @@ func (api *API) allocationsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	method := "Pins"
+	if queryValues.Get("linearizable") == "true" {
+		method = "PinsLinearizable"
+	}
+
 	var pins []*types.Pin
 	err := api.rpcClient.CallContext(
 		r.Context(),
 		"",
 		"Cluster",
-		"Pins",
+		method,
 		struct{}{},
 		&pins,
 	)
@@ -486,12 +1257,17 @@ func (api *API) allocationsHandler(w http.ResponseWriter, r *http.Request) {
 
 func (api *API) allocationHandler(w http.ResponseWriter, r *http.Request) {
 	if pin := api.ParseCidOrFail(w, r); pin != nil {
+		method := "PinGet"
+		if r.URL.Query().Get("linearizable") == "true" {
+			method = "PinGetLinearizable"
+		}
+
 		var pinResp types.Pin
 		err := api.rpcClient.CallContext(
 			r.Context(),
 			"",
 			"Cluster",
-			"PinGet",
+			method,
 			pin.Cid,
 			&pinResp,
 		)
@@ -507,20 +1283,32 @@ func (api *API) statusAllHandler(w http.ResponseWriter, r *http.Request) {
 	queryValues := r.URL.Query()
 	local := queryValues.Get("local")
 
-	var globalPinInfos []*types.GlobalPinInfo
+	filter, ok := api.parseFilterOrFail(w, queryValues.Get("filter"))
+	if !ok {
+		return
+	}
 
-	filterStr := queryValues.Get("filter")
-	filter := types.TrackerStatusFromString(filterStr)
-	if filter == types.TrackerStatusUndefined && filterStr != "" {
-		api.SendResponse(w, http.StatusBadRequest, errors.New("invalid filter value"), nil)
+	if queryValues.Get("stream") == "true" || r.Header.Get("Accept") == "application/x-ndjson" {
+		api.streamStatusAll(w, r, filter, local == "true")
 		return
 	}
 
-	if local == "true" {
-		var pinInfos []*types.PinInfo
+	globalPinInfos, err := api.statusAll(r.Context(), filter, local == "true")
+	if err != nil {
+		api.SendResponse(w, common.SetStatusAutomatically, err, nil)
+		return
+	}
+
+	api.SendResponse(w, common.SetStatusAutomatically, nil, globalPinInfos)
+}
 
+// statusAll obtains the status of the items in the pinset matching the
+// filter, on all peers or only on this one.
+func (api *API) statusAll(ctx context.Context, filter types.TrackerStatus, local bool) ([]*types.GlobalPinInfo, error) {
+	if local {
+		var pinInfos []*types.PinInfo
 		err := api.rpcClient.CallContext(
-			r.Context(),
+			ctx,
 			"",
 			"Cluster",
 			"StatusAllLocal",
@@ -528,26 +1316,100 @@ func (api *API) statusAllHandler(w http.ResponseWriter, r *http.Request) {
 			&pinInfos,
 		)
 		if err != nil {
-			api.SendResponse(w, common.SetStatusAutomatically, err, nil)
-			return
+			return nil, err
 		}
-		globalPinInfos = pinInfosToGlobal(pinInfos)
-	} else {
-		err := api.rpcClient.CallContext(
-			r.Context(),
-			"",
-			"Cluster",
-			"StatusAll",
-			filter,
-			&globalPinInfos,
-		)
-		if err != nil {
-			api.SendResponse(w, common.SetStatusAutomatically, err, nil)
-			return
+		return pinInfosToGlobal(pinInfos), nil
+	}
+
+	var globalPinInfos []*types.GlobalPinInfo
+	err := api.rpcClient.CallContext(
+		ctx,
+		"",
+		"Cluster",
+		"StatusAll",
+		filter,
+		&globalPinInfos,
+	)
+	return globalPinInfos, err
+}
+
+// pinsSummaryHandler counts the items in the pinset by status, across all
+// peers or on this one only ("local"). With "peers=true", the counts are
+// broken down per peer as well. It accepts the same filter as GET /pins.
+func (api *API) pinsSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	queryValues := r.URL.Query()
+	filter, ok := api.parseFilterOrFail(w, queryValues.Get("filter"))
+	if !ok {
+		return
+	}
+
+	// The items are counted as they are received (see
+	// rpcutil.StatusAllPaged) so that the pinset is never held in memory.
+	summary := types.NewPinStatusSummary(queryValues.Get("peers") == "true")
+	err := rpcutil.StatusAllPaged(r.Context(), api.rpcClient, filter, queryValues.Get("local") == "true", func(gpi *types.GlobalPinInfo) error {
+		summary.Add(gpi)
+		return nil
+	})
+	if err != nil {
+		api.SendResponse(w, common.SetStatusAutomatically, err, nil)
+		return
+	}
+	api.SendResponse(w, common.SetStatusAutomatically, nil, summary)
+}
+
+// parseFilterOrFail parses a comma-separated list of tracker statuses. On
+// error, it sends a bad request response and returns false.
+func (api *API) parseFilterOrFail(w http.ResponseWriter, filterStr string) (types.TrackerStatus, bool) {
+	filter := types.TrackerStatusFromString(filterStr)
+	if filter == types.TrackerStatusUndefined && filterStr != "" {
+		api.SendResponse(w, http.StatusBadRequest, errors.New("invalid filter value"), nil)
+		return filter, false
+	}
+	// Do not silently ignore unknown values in a list of filters.
+	for _, f := range strings.Split(filterStr, ",") {
+		if f := strings.TrimSpace(f); f != "" && types.TrackerStatusFromString(f) == types.TrackerStatusUndefined {
+			api.SendResponse(w, http.StatusBadRequest, errors.New("invalid filter value: "+f), nil)
+			return filter, false
 		}
 	}
+	return filter, true
+}
 
-	api.SendResponse(w, common.SetStatusAutomatically, nil, globalPinInfos)
+// streamStatusAll sends the status of the items in the pinset as
+// newline-delimited JSON, flushing them one by one as they are obtained, a
+// page at a time (see rpcutil.StatusAllPaged), so that clients can process
+// them as they are decoded. Errors after the response started are sent in
+// the X-Stream-Error trailer.
+func (api *API) streamStatusAll(w http.ResponseWriter, r *http.Request, filter types.TrackerStatus, local bool) {
+	api.SetHeaders(w)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Trailer", "X-Stream-Error")
+
+	flusher, flush := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	started := false
+	err := rpcutil.StatusAllPaged(r.Context(), api.rpcClient, filter, local, func(gpi *types.GlobalPinInfo) error {
+		if !started {
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		if err := enc.Encode(gpi); err != nil {
+			return err
+		}
+		if flush {
+			flusher.Flush()
+		}
+		return nil
+	})
+	switch {
+	case err != nil && !started:
+		api.SendResponse(w, common.SetStatusAutomatically, err, nil)
+	case err != nil:
+		logger.Error(err)
+		w.Header().Set("X-Stream-Error", err.Error())
+	case !started:
+		w.WriteHeader(http.StatusOK)
+	}
 }
 
 func (api *API) statusHandler(w http.ResponseWriter, r *http.Request) {
@@ -581,9 +1443,49 @@ func (api *API) statusHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// statusCidsHandler returns the status of every CID in the JSON list in the
+// body, in the same order, including those which are not pinned.
+func (api *API) statusCidsHandler(w http.ResponseWriter, r *http.Request) {
+	var strs []string
+	if err := json.NewDecoder(r.Body).Decode(&strs); err != nil {
+		api.SendResponse(w, http.StatusBadRequest, errors.New("error decoding the list of CIDs: "+err.Error()), nil)
+		return
+	}
+	cids := make([]cid.Cid, len(strs))
+	for i, s := range strs {
+		c, err := cid.Decode(s)
+		if err != nil {
+			api.SendResponse(w, http.StatusBadRequest, errors.New("error decoding CID "+s+": "+err.Error()), nil)
+			return
+		}
+		cids[i] = c
+	}
+
+	var pinInfos []*types.GlobalPinInfo
+	err := api.rpcClient.CallContext(
+		r.Context(),
+		"",
+		"Cluster",
+		"StatusCids",
+		cids,
+		&pinInfos,
+	)
+	api.SendResponse(w, common.SetStatusAutomatically, err, pinInfos)
+}
+
 func (api *API) recoverAllHandler(w http.ResponseWriter, r *http.Request) {
 	queryValues := r.URL.Query()
 	local := queryValues.Get("local")
+
+	if statusStr := queryValues.Get("status"); statusStr != "" {
+		filter, ok := api.parseFilterOrFail(w, statusStr)
+		if !ok {
+			return
+		}
+		api.recoverByStatus(w, r, filter, local == "true")
+		return
+	}
+
 	if local == "true" {
 		var pinInfos []*types.PinInfo
 		err := api.rpcClient.CallContext(
@@ -609,6 +1511,92 @@ func (api *API) recoverAllHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// recoverByStatus triggers a recover operation for every item whose status
+// in some peer (or, when local is set, in this one) matches the filter. The
+// pinset is walked a page at a time and the resulting status of every item
+// is sent as newline-delimited JSON as soon as it is recovered, so a client
+// can follow the progress and stop the operation by closing the request.
+// Items which cannot be recovered are skipped and reported, along with any
+// other error happening once the response has started, in the
+// X-Stream-Error trailer.
+func (api *API) recoverByStatus(w http.ResponseWriter, r *http.Request, filter types.TrackerStatus, local bool) {
+	ctx := r.Context()
+
+	api.SetHeaders(w)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Trailer", "X-Stream-Error")
+
+	flusher, flush := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	started := false
+	failed := 0
+	var lastErr error
+	err := rpcutil.StatusAllPaged(ctx, api.rpcClient, filter, local, func(gpi *types.GlobalPinInfo) error {
+		if !started {
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		recovered, err := api.recoverPin(ctx, gpi.Cid, local)
+		if ctx.Err() != nil {
+			logger.Info("recover cancelled by the client")
+			return ctx.Err()
+		}
+		if err != nil {
+			logger.Errorf("error recovering %s: %s", gpi.Cid, err)
+			failed++
+			lastErr = err
+			return nil
+		}
+		if err := enc.Encode(recovered); err != nil {
+			return err
+		}
+		if flush {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err == nil && failed > 0 {
+		err = fmt.Errorf("%d items could not be recovered. Last error: %w", failed, lastErr)
+	}
+	switch {
+	case err != nil && !started:
+		api.SendResponse(w, common.SetStatusAutomatically, err, nil)
+	case err != nil:
+		logger.Error(err)
+		w.Header().Set("X-Stream-Error", err.Error())
+	case !started:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// recoverPin triggers a recover operation for the given item in all the
+// peers or, when local is set, only in this one.
+func (api *API) recoverPin(ctx context.Context, c cid.Cid, local bool) (*types.GlobalPinInfo, error) {
+	if local {
+		var pinInfo types.PinInfo
+		err := api.rpcClient.CallContext(
+			ctx,
+			"",
+			"Cluster",
+			"RecoverLocal",
+			c,
+			&pinInfo,
+		)
+		return pinInfo.ToGlobal(), err
+	}
+
+	var pinInfo types.GlobalPinInfo
+	err := api.rpcClient.CallContext(
+		ctx,
+		"",
+		"Cluster",
+		"Recover",
+		c,
+		&pinInfo,
+	)
+	return &pinInfo, err
+}
+
 func (api *API) recoverHandler(w http.ResponseWriter, r *http.Request) {
 	queryValues := r.URL.Query()
 	local := queryValues.Get("local")
@@ -640,6 +1628,76 @@ func (api *API) recoverHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// verifyHandler checks that the IPFS daemons which pinned an item have all
+// its blocks. Pins with missing blocks are reported with the pin_degraded
+// status. With local=true, only this peer is checked.
+func (api *API) verifyHandler(w http.ResponseWriter, r *http.Request) {
+	queryValues := r.URL.Query()
+	local := queryValues.Get("local")
+
+	if pin := api.ParseCidOrFail(w, r); pin != nil {
+		if local == "true" {
+			var pinInfo types.PinInfo
+			err := api.rpcClient.CallContext(
+				r.Context(),
+				"",
+				"Cluster",
+				"VerifyLocal",
+				pin.Cid,
+				&pinInfo,
+			)
+			api.SendResponse(w, common.SetStatusAutomatically, err, pinInfo.ToGlobal())
+		} else {
+			var pinInfo types.GlobalPinInfo
+			err := api.rpcClient.CallContext(
+				r.Context(),
+				"",
+				"Cluster",
+				"Verify",
+				pin.Cid,
+				&pinInfo,
+			)
+			api.SendResponse(w, common.SetStatusAutomatically, err, pinInfo)
+		}
+	}
+}
+
+func (api *API) blockHoldersHandler(w http.ResponseWriter, r *http.Request) {
+	queryValues := r.URL.Query()
+	all := queryValues.Get("all")
+
+	if pin := api.ParseCidOrFail(w, r); pin != nil {
+		var holders []peer.ID
+		err := api.rpcClient.CallContext(
+			r.Context(),
+			"",
+			"Cluster",
+			"BlockHolders",
+			&types.BlockHoldersRequest{
+				Cid: pin.Cid,
+				All: all == "true",
+			},
+			&holders,
+		)
+		api.SendResponse(w, common.SetStatusAutomatically, err, holders)
+	}
+}
+
+func (api *API) pinReceiptHandler(w http.ResponseWriter, r *http.Request) {
+	if pin := api.ParseCidOrFail(w, r); pin != nil {
+		var receipt types.PinReceipt
+		err := api.rpcClient.CallContext(
+			r.Context(),
+			"",
+			"Cluster",
+			"PinReceipt",
+			pin.Cid,
+			&receipt,
+		)
+		api.SendResponse(w, common.SetStatusAutomatically, err, &receipt)
+	}
+}
+
 func (api *API) repoGCHandler(w http.ResponseWriter, r *http.Request) {
 	queryValues := r.URL.Query()
 	local := queryValues.Get("local")
@@ -2,9 +2,12 @@ package rest
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -15,6 +18,7 @@ import (
 	cid "github.com/ipfs/go-cid"
 	libp2p "github.com/libp2p/go-libp2p"
 	peer "github.com/libp2p/go-libp2p-core/peer"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
 	ma "github.com/multiformats/go-multiaddr"
 )
 
@@ -168,6 +172,33 @@ func TestAPIAddFileEndpointBadContentType(t *testing.T) {
 	test.BothEndpoints(t, tf)
 }
 
+func TestAPIAddFileEndpointBadParams(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	badQueries := []string{
+		"chunker=size-0",
+		"chunker=rabin-64-32-128",
+		"chunker=fancy",
+		"cid-version=2",
+		"cid-version=0&hash=sha3-256",
+		"hash=nohash",
+	}
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		for _, q := range badQueries {
+			errResp := api.Error{}
+			test.MakePostWithContentType(t, rest, url(rest)+"/add?"+q, []byte{}, "multipart/form-data; boundary=xyz", &errResp)
+			if errResp.Code != http.StatusBadRequest {
+				t.Errorf("expected 400 adding with %s", q)
+			}
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
 func TestAPIAddFileEndpointLocal(t *testing.T) {
 	ctx := context.Background()
 	rest := testAPI(t)
@@ -201,6 +232,62 @@ func TestAPIAddFileEndpointLocal(t *testing.T) {
 	test.BothEndpoints(t, tf)
 }
 
+func TestAPIUploadEndpoints(t *testing.T) {
+	ctx := context.Background()
+	defer func(max int64) {
+		UploadMaxTotalSize = max
+	}(UploadMaxTotalSize)
+	UploadMaxTotalSize = 11
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		var upload api.Upload
+		test.MakePost(t, rest, url(rest)+"/add/uploads", []byte{}, &upload)
+		if upload.ID == "" || upload.Offset != 0 {
+			t.Fatal("unexpected new upload: ", upload)
+		}
+		uploadURL := url(rest) + "/add/uploads/" + upload.ID
+
+		test.MakePostWithContentType(t, rest, uploadURL+"?offset=0", []byte("hello "), "application/octet-stream", &upload)
+		if upload.Offset != 6 {
+			t.Fatal("expected offset 6 after the first chunk: ", upload)
+		}
+
+		errResp := api.Error{}
+		test.MakePostWithContentType(t, rest, uploadURL+"?offset=2", []byte("world"), "application/octet-stream", &errResp)
+		if errResp.Code != http.StatusConflict {
+			t.Error("a chunk at the wrong offset should 409")
+		}
+
+		test.MakePostWithContentType(t, rest, uploadURL+"?offset=6", []byte("world"), "application/octet-stream", &upload)
+		test.MakeGet(t, rest, uploadURL, &upload)
+		if upload.Offset != 11 {
+			t.Fatal("expected offset 11: ", upload)
+		}
+
+		errResp = api.Error{}
+		test.MakePostWithContentType(t, rest, uploadURL+"?offset=11", []byte("!"), "application/octet-stream", &errResp)
+		if errResp.Code != http.StatusInsufficientStorage {
+			t.Error("a chunk over the quota should 507")
+		}
+
+		resp := api.AddedOutput{}
+		test.MakeStreamingPost(t, rest, uploadURL+"/add?stream-channels=true", nil, "", &resp)
+		if !resp.Cid.Defined() {
+			t.Error("expected the upload to be added: ", resp)
+		}
+
+		errResp = api.Error{}
+		test.MakeGet(t, rest, uploadURL, &errResp)
+		if errResp.Code != http.StatusNotFound {
+			t.Error("the upload should be removed once added")
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
 func TestAPIAddFileEndpointShard(t *testing.T) {
 	ctx := context.Background()
 	rest := testAPI(t)
@@ -336,6 +423,42 @@ func TestAPIPinEndpoint(t *testing.T) {
 	test.BothEndpoints(t, tf)
 }
 
+func TestAPIPinEndpointWaitReplication(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	defer func(interval time.Duration) { replicationCheckInterval = interval }(replicationCheckInterval)
+	replicationCheckInterval = 50 * time.Millisecond
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		var ack api.PinAck
+		test.MakePost(t, rest, url(rest)+"/pins/"+clustertest.Cid1.String()+"?wait-replication=1s", []byte{}, &ack)
+		if !ack.Pin.Cid.Equals(clustertest.Cid1) {
+			t.Error("expected the pin in the response")
+		}
+		if !ack.Replication.Complete() {
+			t.Errorf("expected complete replication: %s", ack.Replication)
+		}
+
+		// The mock status only reports PeerID1 as pinned.
+		ack = api.PinAck{}
+		allocs := clustertest.PeerID1.String() + "," + clustertest.PeerID2.String()
+		test.MakePost(t, rest, url(rest)+"/pins/"+clustertest.Cid1.String()+"?user-allocations="+allocs+"&wait-replication=200ms", []byte{}, &ack)
+		if ack.Replication.Confirmed != 1 || ack.Replication.Expected != 2 {
+			t.Errorf("expected 1/2 replicas confirmed: %s", ack.Replication)
+		}
+
+		errResp := api.Error{}
+		test.MakePost(t, rest, url(rest)+"/pins/"+clustertest.Cid1.String()+"?wait-replication=abc", []byte{}, &errResp)
+		if errResp.Code != http.StatusBadRequest {
+			t.Error("should fail with bad wait-replication")
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
 type pathCase struct {
 	path        string
 	opts        api.PinOptions
@@ -389,6 +512,13 @@ var pathTestCases = []pathCase{
 		http.StatusNotFound,
 		"",
 	},
+	{
+		clustertest.PathMFS1,
+		testPinOpts,
+		false,
+		http.StatusOK,
+		clustertest.CidMFS.String(),
+	},
 	// TODO: A case with trailing slash with paths
 	// clustertest.PathIPNS2, clustertest.PathIPLD2, clustertest.InvalidPath1
 }
@@ -453,6 +583,9 @@ func TestAPIUnpinEndpoint(t *testing.T) {
 		if errResp.Code != http.StatusNotFound {
 			t.Error("expected different error code: ", errResp.Code)
 		}
+		if errResp.Kind != api.ErrorKindNotFound {
+			t.Error("expected a not_found error kind: ", errResp.Kind)
+		}
 
 		test.MakeDelete(t, rest, url(rest)+"/pins/abcd", &errResp)
 		if errResp.Code != 400 {
@@ -463,6 +596,28 @@ func TestAPIUnpinEndpoint(t *testing.T) {
 	test.BothEndpoints(t, tf)
 }
 
+func TestAPIUpdateEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		pin := api.Pin{}
+		test.MakePost(t, rest, url(rest)+"/pins/"+clustertest.Cid1.String()+"/update?replication-min=3&replication-max=3", []byte{}, &pin)
+		if !pin.Cid.Equals(clustertest.Cid1) || pin.ReplicationFactorMin != 3 || pin.ReplicationFactorMax != 3 {
+			t.Errorf("unexpected pin: %+v", pin)
+		}
+
+		errResp := api.Error{}
+		test.MakePost(t, rest, url(rest)+"/pins/"+clustertest.NotFoundCid.String()+"/update", []byte{}, &errResp)
+		if errResp.Code != http.StatusNotFound {
+			t.Error("expected different error code: ", errResp.Code)
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
 func TestAPIUnpinEndpointWithPath(t *testing.T) {
 	ctx := context.Background()
 	rest := testAPI(t)
@@ -499,6 +654,45 @@ func TestAPIUnpinEndpointWithPath(t *testing.T) {
 	test.BothEndpoints(t, tf)
 }
 
+func TestAPIPinBatchEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		body, _ := json.Marshal([]*api.Pin{
+			api.PinCid(clustertest.Cid1),
+			api.PinCid(clustertest.ErrorCid),
+		})
+
+		result := api.PinBatchResult{}
+		test.MakePost(t, rest, url(rest)+"/pins/batch", body, &result)
+		if result.Pinned != 1 || result.Failed != 1 || result.RolledBack {
+			t.Errorf("unexpected best-effort result: %+v", result)
+		}
+
+		result = api.PinBatchResult{}
+		test.MakePost(t, rest, url(rest)+"/pins/batch?atomic=true", body, &result)
+		if result.Pinned != 0 || result.Failed != 2 || !result.RolledBack {
+			t.Errorf("unexpected atomic result: %+v", result)
+		}
+
+		errResp := api.Error{}
+		test.MakePost(t, rest, url(rest)+"/pins/batch", []byte("{}"), &errResp)
+		if errResp.Code != http.StatusBadRequest {
+			t.Error("expected a bad request error: ", errResp.Code)
+		}
+
+		errResp = api.Error{}
+		test.MakePost(t, rest, url(rest)+"/pins/batch", []byte("[]"), &errResp)
+		if errResp.Code != http.StatusBadRequest {
+			t.Error("expected a bad request error for an empty batch: ", errResp.Code)
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
 func TestAPIAllocationsEndpoint(t *testing.T) {
 	ctx := context.Background()
 	rest := testAPI(t)
@@ -530,6 +724,106 @@ func TestAPIAllocationsEndpoint(t *testing.T) {
 	test.BothEndpoints(t, tf)
 }
 
+func TestAPIPinsSLAEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		var breaches []*api.PinSLABreach
+		test.MakeGet(t, rest, url(rest)+"/pins/sla", &breaches)
+		if len(breaches) != 2 {
+			t.Fatal("expected the breaches of all the peers: ", breaches)
+		}
+		if !breaches[1].Cid.Equals(clustertest.Cid2) || !breaches[1].PinnedAt.IsZero() {
+			t.Error("expected Cid2 not to be pinned yet: ", breaches[1])
+		}
+
+		breaches = nil
+		test.MakeGet(t, rest, url(rest)+"/pins/sla?local=true", &breaches)
+		if len(breaches) != 1 || breaches[0].Peer != clustertest.PeerID1 || breaches[0].PinnedAt.IsZero() {
+			t.Error("expected the local breach of Cid1: ", breaches)
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
+func TestAPIPinsDiffEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		var diff api.PinsDiff
+		test.MakeGet(t, rest, url(rest)+"/pins/diff/"+clustertest.PeerID2.String(), &diff)
+		if diff.Peer != clustertest.PeerID2 || diff.Error != "" {
+			t.Fatal("unexpected diff: ", diff)
+		}
+		if len(diff.Added) != 1 || !diff.Added[0].Cid.Equals(clustertest.Cid4) {
+			t.Error("expected Cid4 to be added: ", diff.Added)
+		}
+		if len(diff.Removed) != 1 || !diff.Removed[0].Cid.Equals(clustertest.Cid1) {
+			t.Error("expected Cid1 to be removed: ", diff.Removed)
+		}
+
+		diff = api.PinsDiff{}
+		test.MakeGet(t, rest, url(rest)+"/pins/diff/"+clustertest.PeerID3.String(), &diff)
+		if diff.Error == "" {
+			t.Error("expected an error note for an unreachable peer")
+		}
+
+		errResp := api.Error{}
+		test.MakeGet(t, rest, url(rest)+"/pins/diff/abcd", &errResp)
+		if errResp.Code != http.StatusBadRequest {
+			t.Error("expected 400 with a bad peer ID")
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
+func TestAPIPeerPinsEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		// Cid2 is allocated to PeerID1 only. Cid1 and Cid3 are
+		// pinned everywhere.
+		var all []*api.Pin
+		test.MakeGet(t, rest, url(rest)+"/peers/"+clustertest.PeerID1.String()+"/pins", &all)
+		if len(all) != 3 {
+			t.Fatal("expected 3 pins for PeerID1: ", all)
+		}
+
+		var resp []*api.Pin
+		test.MakeGet(t, rest, url(rest)+"/peers/"+clustertest.PeerID2.String()+"/pins", &resp)
+		if len(resp) != 2 {
+			t.Fatal("expected 2 pins for PeerID2: ", resp)
+		}
+		for _, pin := range resp {
+			if pin.Cid.Equals(clustertest.Cid2) {
+				t.Error("Cid2 is not allocated to PeerID2")
+			}
+		}
+
+		resp = nil
+		test.MakeGet(t, rest, url(rest)+"/peers/"+clustertest.PeerID1.String()+"/pins?offset=1&limit=1", &resp)
+		if len(resp) != 1 || !resp[0].Cid.Equals(all[1].Cid) {
+			t.Error("unexpected page: ", resp)
+		}
+
+		errResp := api.Error{}
+		test.MakeGet(t, rest, url(rest)+"/peers/"+clustertest.PeerID1.String()+"/pins?limit=abc", &errResp)
+		if errResp.Code != http.StatusBadRequest {
+			t.Error("an invalid limit should 400")
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
 func TestAPIAllocationEndpoint(t *testing.T) {
 	ctx := context.Background()
 	rest := testAPI(t)
@@ -552,6 +846,90 @@ func TestAPIAllocationEndpoint(t *testing.T) {
 	test.BothEndpoints(t, tf)
 }
 
+func TestAPIOpLogEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		var resp api.OpLogPage
+		test.MakeGet(t, rest, url(rest)+"/oplog?after=0&limit=10&wait=1s", &resp)
+		if len(resp.Operations) != 2 || resp.Last != 2 {
+			t.Fatal("expected 2 operations")
+		}
+		if resp.Operations[1].Type != api.OperationUnpin {
+			t.Error("expected an unpin operation")
+		}
+
+		errResp := api.Error{}
+		test.MakeGet(t, rest, url(rest)+"/oplog?after=abc", &errResp)
+		if errResp.Code != http.StatusBadRequest {
+			t.Error("an invalid after value should 400")
+		}
+
+		errResp = api.Error{}
+		test.MakeGet(t, rest, url(rest)+"/oplog?after=11", &errResp)
+		if errResp.Code != http.StatusGone {
+			t.Error("expired entries should 410")
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
+func TestAPIAllocationsAuditEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		var resp []*api.AllocationDecision
+		test.MakeGet(t, rest, url(rest)+"/allocations/audit", &resp)
+		if len(resp) != 1 {
+			t.Fatal("expected 1 allocation decision")
+		}
+		if !resp[0].Cid.Equals(clustertest.Cid1) || len(resp[0].Candidates) != 2 {
+			t.Errorf("unexpected decision: %+v", resp[0])
+		}
+		if resp[0].Candidates[0].Scores["numpin"] != 2 {
+			t.Error("expected the candidate scores")
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
+func TestAPIDeletedPinsEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		var resp []*api.Tombstone
+		test.MakeGet(t, rest, url(rest)+"/pins/deleted", &resp)
+		if len(resp) != 1 || !resp[0].Cid.Equals(clustertest.Cid1) {
+			t.Fatalf("expected one tombstone: %v", resp)
+		}
+		if resp[0].UnpinnedBy != clustertest.PinOwner {
+			t.Errorf("unexpected tombstone: %+v", resp[0])
+		}
+
+		now := time.Now().UTC().Format(time.RFC3339Nano)
+		test.MakeGet(t, rest, url(rest)+"/pins/deleted?since="+now, &resp)
+		if len(resp) != 0 {
+			t.Error("expected no tombstones since now")
+		}
+
+		errResp := api.Error{}
+		test.MakeGet(t, rest, url(rest)+"/pins/deleted?since=abc", &errResp)
+		if errResp.Code != 400 {
+			t.Error("expected a bad request error")
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
 func TestAPIMetricsEndpoint(t *testing.T) {
 	ctx := context.Background()
 	rest := testAPI(t)
@@ -571,6 +949,48 @@ func TestAPIMetricsEndpoint(t *testing.T) {
 				t.Error("Unexpected peer id: ", m.Peer)
 			}
 		}
+
+		var respAt []*api.Metric
+		test.MakeGet(t, rest, url(rest)+"/monitor/metrics/somemetricstype?at=2021-01-02T15:04:05Z", &respAt)
+		if len(respAt) != 1 || respAt[0].Name != "somemetricstype" {
+			t.Fatal("expected the metrics at the given time")
+		}
+
+		errResp := api.Error{}
+		test.MakeGet(t, rest, url(rest)+"/monitor/metrics/somemetricstype?at=yesterday", &errResp)
+		if errResp.Code != http.StatusBadRequest {
+			t.Error("expected a bad request error")
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
+func TestAPIPeerMetricAllEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		var resp []*api.Metric
+		test.MakeGet(t, rest, url(rest)+"/monitor/metrics/somemetricstype/window/"+clustertest.PeerID2.String(), &resp)
+		if len(resp) != 3 {
+			t.Fatal("expected the whole window")
+		}
+		for _, m := range resp {
+			if m.Name != "somemetricstype" || m.Peer != clustertest.PeerID2 {
+				t.Errorf("unexpected metric: %+v", m)
+			}
+		}
+		if !resp[2].Stale || resp[0].Stale {
+			t.Error("expected only the expired metric to be stale")
+		}
+
+		errResp := api.Error{}
+		test.MakeGet(t, rest, url(rest)+"/monitor/metrics/somemetricstype/window/abc", &errResp)
+		if errResp.Code != http.StatusBadRequest {
+			t.Error("expected a bad request error")
+		}
 	}
 
 	test.BothEndpoints(t, tf)
@@ -592,6 +1012,163 @@ func TestAPIMetricNamesEndpoint(t *testing.T) {
 	test.BothEndpoints(t, tf)
 }
 
+func TestAPIPrometheusMetricsEndpoint(t *testing.T) {
+	ctx := context.Background()
+	cfg := NewConfig()
+	cfg.Default()
+	cfg.BasicAuthCredentials = map[string]string{
+		validUserName: validUserPassword,
+	}
+	rest := testAPIwithConfig(t, cfg, "metrics")
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		h := test.MakeHost(t, rest)
+		defer h.Close()
+		c := test.HTTPClient(t, h, test.IsHTTPS(url(rest)))
+
+		httpResp, err := c.Get(url(rest) + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpResp.Body.Close()
+		if httpResp.StatusCode != http.StatusUnauthorized {
+			t.Error("expected 401 without credentials:", httpResp.StatusCode)
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, url(rest)+"/metrics", nil)
+		req.SetBasicAuth(validUserName, validUserPassword)
+		httpResp, err = c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer httpResp.Body.Close()
+		if httpResp.StatusCode != http.StatusOK {
+			t.Fatal("unexpected status:", httpResp.StatusCode)
+		}
+		if ct := httpResp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+			t.Error("unexpected content type:", ct)
+		}
+		body, err := ioutil.ReadAll(httpResp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{
+			"# TYPE ipfscluster_monitor_freespace gauge\n",
+			`ipfscluster_monitor_freespace{peer="` + clustertest.PeerID1.String() + `"} 0` + "\n",
+		}
+		for _, e := range expected {
+			if !strings.Contains(string(body), e) {
+				t.Errorf("expected %q in:\n%s", e, body)
+			}
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
+// collidingMonitor is a PeerMonitor RPC service with metric names which are
+// the same once sanitized for Prometheus.
+type collidingMonitor struct{}
+
+func (mon *collidingMonitor) MetricNames(ctx context.Context, in struct{}, out *[]string) error {
+	*out = []string{"free.space", "free-space"}
+	return nil
+}
+
+func (mon *collidingMonitor) LatestMetrics(ctx context.Context, in string, out *[]*api.Metric) error {
+	*out = []*api.Metric{{Name: in, Peer: clustertest.PeerID1, Value: "1", Valid: true}}
+	return nil
+}
+
+func TestAPIPrometheusMetricsCollidingNames(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	s := rpc.NewServer(nil, "mock")
+	if err := s.RegisterName("PeerMonitor", &collidingMonitor{}); err != nil {
+		t.Fatal(err)
+	}
+	rest.SetClient(rpc.NewClientWithServer(nil, "mock", s))
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		h := test.MakeHost(t, rest)
+		defer h.Close()
+		c := test.HTTPClient(t, h, test.IsHTTPS(url(rest)))
+		httpResp, err := c.Get(url(rest) + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer httpResp.Body.Close()
+		body, err := ioutil.ReadAll(httpResp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if httpResp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status %d: %s", httpResp.StatusCode, body)
+		}
+		for _, e := range []string{
+			"# TYPE ipfscluster_monitor_free_space gauge\n",
+			"# TYPE ipfscluster_monitor_free_space_2 gauge\n",
+		} {
+			if !strings.Contains(string(body), e) {
+				t.Errorf("expected %q in:\n%s", e, body)
+			}
+		}
+	}
+	test.BothEndpoints(t, tf)
+}
+
+// ipfsDownCluster is a Cluster RPC service reporting that IPFS is down.
+type ipfsDownCluster struct{}
+
+func (c *ipfsDownCluster) Health(ctx context.Context, in struct{}, out *api.Health) error {
+	*out = api.Health{
+		Peer:      clustertest.PeerID1,
+		IPFSError: "connection refused",
+	}
+	out.Rollup()
+	return nil
+}
+
+func TestAPIHealthEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		var resp api.Health
+		test.MakeGet(t, rest, url(rest)+"/health", &resp)
+		if resp.Status != api.HealthOK || !resp.IsLeader {
+			t.Errorf("unexpected health: %+v", resp)
+		}
+	}
+	test.BothEndpoints(t, tf)
+
+	s := rpc.NewServer(nil, "mock")
+	if err := s.RegisterName("Cluster", &ipfsDownCluster{}); err != nil {
+		t.Fatal(err)
+	}
+	rest.SetClient(rpc.NewClientWithServer(nil, "mock", s))
+
+	tf = func(t *testing.T, url test.URLFunc) {
+		h := test.MakeHost(t, rest)
+		defer h.Close()
+		c := test.HTTPClient(t, h, test.IsHTTPS(url(rest)))
+		httpResp, err := c.Get(url(rest) + "/health")
+		var resp api.Health
+		test.ProcessResp(t, httpResp, err, &resp)
+		if httpResp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("expected 503 with IPFS down; got %d", httpResp.StatusCode)
+		}
+		if resp.Status != api.HealthDown || resp.IPFSError == "" {
+			t.Errorf("unexpected health: %+v", resp)
+		}
+	}
+	test.BothEndpoints(t, tf)
+}
+
 func TestAPIAlertsEndpoint(t *testing.T) {
 	ctx := context.Background()
 	rest := testAPI(t)
@@ -608,6 +1185,47 @@ func TestAPIAlertsEndpoint(t *testing.T) {
 	test.BothEndpoints(t, tf)
 }
 
+func TestAPIRecentAlertsEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		var resp []*api.Alert
+		test.MakeGet(t, rest, url(rest)+"/monitor/alerts", &resp)
+		if len(resp) != 1 || resp[0].Peer != clustertest.PeerID2 {
+			t.Errorf("expected one alert: %v", resp)
+		}
+
+		future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		test.MakeGet(t, rest, url(rest)+"/monitor/alerts?since="+future, &resp)
+		if len(resp) != 0 {
+			t.Error("expected no alerts since the future")
+		}
+
+		errResp := api.Error{}
+		test.MakeGet(t, rest, url(rest)+"/monitor/alerts?since=abc", &errResp)
+		if errResp.Code != 400 {
+			t.Error("expected a bad request error")
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
+func TestAPIMaintenanceEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		test.MakePost(t, rest, url(rest)+"/health/maintenance", []byte{}, &struct{}{})
+		test.MakeDelete(t, rest, url(rest)+"/health/maintenance", &struct{}{})
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
 func TestAPIStatusAllEndpoint(t *testing.T) {
 	ctx := context.Background()
 	rest := testAPI(t)
@@ -666,6 +1284,66 @@ func TestAPIStatusAllEndpoint(t *testing.T) {
 		if errorResp.Code != http.StatusBadRequest {
 			t.Error("an invalid filter value should 400")
 		}
+
+		errorResp = api.Error{}
+		test.MakeGet(t, rest, url(rest)+"/pins?filter=pinned,invalid", &errorResp)
+		if errorResp.Code != http.StatusBadRequest {
+			t.Error("an invalid value in a list of filters should 400")
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
+func TestAPIPinsSummaryEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		pid := peer.Encode(clustertest.PeerID1)
+
+		var resp api.PinStatusSummary
+		test.MakeGet(t, rest, url(rest)+"/pins/summary", &resp)
+		if resp.Items != 3 {
+			t.Errorf("expected 3 items, got %d", resp.Items)
+		}
+		for _, st := range []string{"pinned", "pinning", "pin_error"} {
+			if resp.Statuses[st] != 1 {
+				t.Errorf("expected 1 %s item, got %d", st, resp.Statuses[st])
+			}
+		}
+		if len(resp.Statuses) != 3 {
+			t.Errorf("unexpected statuses: %v", resp.Statuses)
+		}
+		if resp.Peers != nil {
+			t.Error("the per-peer breakdown was not requested")
+		}
+
+		var resp2 api.PinStatusSummary
+		test.MakeGet(t, rest, url(rest)+"/pins/summary?peers=true", &resp2)
+		if len(resp2.Peers) != 1 || resp2.Peers[pid]["pinning"] != 1 || resp2.Peers[pid]["pinned"] != 1 {
+			t.Errorf("unexpected per-peer summary: %v", resp2.Peers)
+		}
+
+		var resp3 api.PinStatusSummary
+		test.MakeGet(t, rest, url(rest)+"/pins/summary?local=true", &resp3)
+		// Cid2 is not tracked by the local mock tracker.
+		if resp3.Items != 3 || resp3.Statuses["pinned"] != 1 || resp3.Statuses["pin_error"] != 1 || resp3.Statuses["unpinned"] != 1 {
+			t.Errorf("unexpected local summary: %+v", resp3)
+		}
+
+		var resp4 api.PinStatusSummary
+		test.MakeGet(t, rest, url(rest)+"/pins/summary?filter=pin_error", &resp4)
+		if resp4.Items != 1 || resp4.Statuses["pin_error"] != 1 {
+			t.Errorf("unexpected filtered summary: %+v", resp4)
+		}
+
+		var errResp api.Error
+		test.MakeGet(t, rest, url(rest)+"/pins/summary?filter=abc", &errResp)
+		if errResp.Code != http.StatusBadRequest {
+			t.Error("an invalid filter should be rejected")
+		}
 	}
 
 	test.BothEndpoints(t, tf)
@@ -710,6 +1388,48 @@ func TestAPIStatusEndpoint(t *testing.T) {
 	test.BothEndpoints(t, tf)
 }
 
+func TestAPIStatusCidsEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		cids := []cid.Cid{clustertest.Cid1, clustertest.NotFoundCid, clustertest.Cid3}
+		body, _ := json.Marshal([]string{cids[0].String(), cids[1].String(), cids[2].String()})
+
+		var resp []*api.GlobalPinInfo
+		test.MakePost(t, rest, url(rest)+"/pins/status", body, &resp)
+		if len(resp) != len(cids) {
+			t.Fatalf("expected %d results, got %d", len(cids), len(resp))
+		}
+		expected := []api.TrackerStatus{
+			api.TrackerStatusPinned,
+			api.TrackerStatusUnpinned,
+			api.TrackerStatusPinError,
+		}
+		for i, gpi := range resp {
+			if !gpi.Cid.Equals(cids[i]) {
+				t.Errorf("result %d: expected %s, got %s", i, cids[i], gpi.Cid)
+			}
+			info, ok := gpi.PeerMap[peer.Encode(clustertest.PeerID1)]
+			if !ok {
+				t.Fatal("expected info for clustertest.PeerID1")
+			}
+			if info.Status != expected[i] {
+				t.Errorf("%s: expected %s, got %s", cids[i], expected[i], info.Status)
+			}
+		}
+
+		errResp := api.Error{}
+		test.MakePost(t, rest, url(rest)+"/pins/status", []byte(`["notacid"]`), &errResp)
+		if errResp.Code != http.StatusBadRequest {
+			t.Error("expected a bad request error: ", errResp.Code)
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
 func TestAPIRecoverEndpoint(t *testing.T) {
 	ctx := context.Background()
 	rest := testAPI(t)
@@ -734,6 +1454,105 @@ func TestAPIRecoverEndpoint(t *testing.T) {
 	test.BothEndpoints(t, tf)
 }
 
+func TestAPISyncEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		var resp api.SyncSummary
+		test.MakePost(t, rest, url(rest)+"/sync", []byte{}, &resp)
+		if resp.Peer != clustertest.PeerID1 {
+			t.Error("expected the summary of clustertest.PeerID1:", resp.Peer)
+		}
+		if len(resp.Repinned) != 1 || !resp.Repinned[0].Equals(clustertest.Cid1) {
+			t.Error("expected the repinned item:", resp.Repinned)
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
+func TestAPIVerifyEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		var resp api.GlobalPinInfo
+		test.MakePost(t, rest, url(rest)+"/pins/"+clustertest.DegradedCid.String()+"/verify", []byte{}, &resp)
+		info, ok := resp.PeerMap[peer.Encode(clustertest.PeerID2)]
+		if !ok {
+			t.Fatal("expected info for clustertest.PeerID2")
+		}
+		if info.Status != api.TrackerStatusPinDegraded {
+			t.Error("expected a degraded status:", info.Status)
+		}
+		if len(info.MissingBlocks) != 1 || !info.MissingBlocks[0].Equals(clustertest.Cid2) {
+			t.Error("expected the missing block:", info.MissingBlocks)
+		}
+
+		var localResp api.GlobalPinInfo
+		test.MakePost(t, rest, url(rest)+"/pins/"+clustertest.Cid1.String()+"/verify?local=true", []byte{}, &localResp)
+		info, ok = localResp.PeerMap[peer.Encode(clustertest.PeerID2)]
+		if !ok {
+			t.Fatal("expected info for clustertest.PeerID2")
+		}
+		if info.Status != api.TrackerStatusPinned || len(info.MissingBlocks) != 0 {
+			t.Errorf("expected a healthy pin: %+v", info)
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
+func TestAPIPinReceiptEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		var receipt api.PinReceipt
+		test.MakeGet(t, rest, url(rest)+"/pins/"+clustertest.Cid1.String()+"/receipt", &receipt)
+		if !receipt.Cid.Equals(clustertest.Cid1) {
+			t.Error("expected a receipt for the same cid")
+		}
+		if err := receipt.Verify([]peer.ID{receipt.Signer}); err != nil {
+			t.Error("the receipt should verify:", err)
+		}
+
+		errResp := api.Error{}
+		test.MakeGet(t, rest, url(rest)+"/pins/"+clustertest.NotFoundCid.String()+"/receipt", &errResp)
+		if errResp.Code != http.StatusNotFound {
+			t.Error("expected a not found error:", errResp.Code)
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
+func TestAPIBlockHoldersEndpoint(t *testing.T) {
+	ctx := context.Background()
+	rest := testAPI(t)
+	defer rest.Shutdown(ctx)
+
+	tf := func(t *testing.T, url test.URLFunc) {
+		var resp []peer.ID
+		test.MakeGet(t, rest, url(rest)+"/pins/"+clustertest.Cid1.String()+"/holders?all=true", &resp)
+		if len(resp) != 1 || resp[0] != clustertest.PeerID1 {
+			t.Errorf("unexpected holders: %v", resp)
+		}
+
+		errResp := api.Error{}
+		test.MakeGet(t, rest, url(rest)+"/pins/"+clustertest.ErrorCid.String()+"/holders", &errResp)
+		if errResp.Message != clustertest.ErrBadCid.Error() {
+			t.Errorf("expected %s but got %s", clustertest.ErrBadCid.Error(), errResp.Message)
+		}
+	}
+
+	test.BothEndpoints(t, tf)
+}
+
 func TestAPIRecoverAllEndpoint(t *testing.T) {
 	ctx := context.Background()
 	rest := testAPI(t)
@@ -751,6 +1570,44 @@ func TestAPIRecoverAllEndpoint(t *testing.T) {
 		if len(resp1) == 0 {
 			t.Fatal("bad response length")
 		}
+
+		// Only the item in error is recovered.
+		h := test.MakeHost(t, rest)
+		defer h.Close()
+		c := test.HTTPClient(t, h, test.IsHTTPS(url(rest)))
+		httpResp, err := c.Post(url(rest)+"/pins/recover?status=pin_error", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer httpResp.Body.Close()
+		if ct := httpResp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Error("unexpected content type:", ct)
+		}
+		var recovered []*api.GlobalPinInfo
+		dec := json.NewDecoder(httpResp.Body)
+		for {
+			gpi := &api.GlobalPinInfo{}
+			err := dec.Decode(gpi)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			recovered = append(recovered, gpi)
+		}
+		if len(recovered) != 1 || !recovered[0].Cid.Equals(clustertest.Cid3) {
+			t.Errorf("expected only the item in error to be recovered: %+v", recovered)
+		}
+		if e := httpResp.Trailer.Get("X-Stream-Error"); e != "" {
+			t.Error("unexpected stream error:", e)
+		}
+
+		var errResp api.Error
+		test.MakePost(t, rest, url(rest)+"/pins/recover?status=invalid", []byte{}, &errResp)
+		if errResp.Code != http.StatusBadRequest {
+			t.Error("an invalid status should fail")
+		}
 	}
 
 	test.BothEndpoints(t, tf)
@@ -0,0 +1,289 @@
+package rest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	types "github.com/ipfs/ipfs-cluster/api"
+)
+
+// UploadTTL is how long resumable uploads are kept after they last
+// received data, and UploadMaxAge how long after they were created, even
+// if they keep receiving it. Expired uploads are removed.
+// UploadMaxTotalSize is the number of bytes that all the uploads kept may
+// take together: chunks which do not fit are rejected.
+var (
+	UploadTTL                = time.Hour
+	UploadMaxAge             = 24 * time.Hour
+	UploadMaxTotalSize int64 = 10 << 30 // 10 GiB
+)
+
+var (
+	errUploadNotFound = errors.New("upload not found")
+	errUploadBusy     = errors.New("upload is busy with another request")
+	errUploadQuota    = errors.New("not enough room left for uploads")
+)
+
+// errUploadOffset is returned when a chunk does not start where the data
+// received so far ends.
+type errUploadOffset struct {
+	offset int64
+}
+
+func (e errUploadOffset) Error() string {
+	return fmt.Sprintf("chunk does not start at the upload offset: %d", e.offset)
+}
+
+type upload struct {
+	id         string
+	path       string
+	size       int64
+	created    time.Time
+	lastActive time.Time
+	busy       bool
+}
+
+// uploadStore keeps the data of resumable uploads in files in a temporary
+// directory, created on first use.
+type uploadStore struct {
+	mu      sync.Mutex
+	dir     string
+	uploads map[string]*upload
+	total   int64 // sum of the sizes of the uploads
+	closed  bool
+	done    chan struct{}
+}
+
+// newUploadStore returns an uploadStore which removes expired uploads
+// until closed.
+func newUploadStore() *uploadStore {
+	us := &uploadStore{
+		uploads: make(map[string]*upload),
+		done:    make(chan struct{}),
+	}
+	go us.watchExpired()
+	return us
+}
+
+func (us *uploadStore) watchExpired() {
+	ticker := time.NewTicker(UploadTTL / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-us.done:
+			return
+		case <-ticker.C:
+			us.mu.Lock()
+			us.expire()
+			us.mu.Unlock()
+		}
+	}
+}
+
+// create starts a new, empty upload.
+func (us *uploadStore) create() (*types.Upload, error) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	if us.closed {
+		return nil, errors.New("the API is shutting down")
+	}
+	us.expire()
+
+	if us.dir == "" {
+		dir, err := ioutil.TempDir("", "ipfs-cluster-uploads")
+		if err != nil {
+			return nil, err
+		}
+		us.dir = dir
+	}
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, err
+	}
+	id := hex.EncodeToString(idBytes)
+	path := filepath.Join(us.dir, id)
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	now := time.Now()
+	us.uploads[id] = &upload{
+		id:         id,
+		path:       path,
+		created:    now,
+		lastActive: now,
+	}
+	return &types.Upload{ID: id}, nil
+}
+
+// get returns the current state of an upload.
+func (us *uploadStore) get(id string) (*types.Upload, error) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	us.expire()
+
+	u, ok := us.uploads[id]
+	if !ok {
+		return nil, errUploadNotFound
+	}
+	return &types.Upload{ID: id, Offset: u.size}, nil
+}
+
+// acquire marks an upload as busy, so that a single request handles it at a
+// time.
+func (us *uploadStore) acquire(id string) (*upload, error) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	us.expire()
+
+	u, ok := us.uploads[id]
+	if !ok {
+		return nil, errUploadNotFound
+	}
+	if u.busy {
+		return nil, errUploadBusy
+	}
+	u.busy = true
+	return u, nil
+}
+
+func (us *uploadStore) release(u *upload) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	u.busy = false
+	u.lastActive = time.Now()
+}
+
+// room returns how many bytes can still be added to the uploads.
+func (us *uploadStore) room() int64 {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	return UploadMaxTotalSize - us.total
+}
+
+// grow accounts for n more bytes in the given upload, unless they do not
+// fit in UploadMaxTotalSize.
+func (us *uploadStore) grow(u *upload, n int64) error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	if us.total+n > UploadMaxTotalSize {
+		return errUploadQuota
+	}
+	us.total += n
+	u.size += n
+	return nil
+}
+
+// write appends a chunk, which must start at the given offset, to the
+// upload. Chunks are written entirely or not at all.
+func (us *uploadStore) write(id string, offset int64, chunk io.Reader) (*types.Upload, error) {
+	u, err := us.acquire(id)
+	if err != nil {
+		return nil, err
+	}
+	defer us.release(u)
+
+	if offset != u.size {
+		return nil, errUploadOffset{offset: u.size}
+	}
+
+	f, err := os.OpenFile(u.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Read one byte over the room left to tell whether the chunk fits.
+	room := us.room()
+	n, err := io.Copy(f, io.LimitReader(chunk, room+1))
+	if err == nil && n > room {
+		err = errUploadQuota
+	}
+	if err == nil {
+		err = us.grow(u, n)
+	}
+	if err != nil {
+		logger.Warnf("upload %s: discarding chunk: %s", id, err)
+		if terr := f.Truncate(u.size); terr != nil {
+			logger.Error(terr)
+		}
+		return nil, err
+	}
+	return &types.Upload{ID: id, Offset: u.size}, nil
+}
+
+// open returns the upload for reading its data. It stays busy until
+// released or removed.
+func (us *uploadStore) open(id string) (*upload, *os.File, error) {
+	u, err := us.acquire(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(u.path)
+	if err != nil {
+		us.release(u)
+		return nil, nil, err
+	}
+	return u, f, nil
+}
+
+// remove deletes an upload and its data.
+func (us *uploadStore) remove(id string) error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	u, ok := us.uploads[id]
+	if !ok {
+		return errUploadNotFound
+	}
+	delete(us.uploads, id)
+	us.total -= u.size
+	return os.Remove(u.path)
+}
+
+// expire removes the uploads which have not received data for UploadTTL
+// or were created more than UploadMaxAge ago. It must be called with the
+// lock held.
+func (us *uploadStore) expire() {
+	for id, u := range us.uploads {
+		if u.busy || (time.Since(u.lastActive) < UploadTTL && time.Since(u.created) < UploadMaxAge) {
+			continue
+		}
+		logger.Infof("removing expired upload %s", id)
+		delete(us.uploads, id)
+		us.total -= u.size
+		if err := os.Remove(u.path); err != nil {
+			logger.Error(err)
+		}
+	}
+}
+
+// close removes all the uploads.
+func (us *uploadStore) close() error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	if us.closed {
+		return nil
+	}
+	us.closed = true
+	close(us.done)
+	us.uploads = make(map[string]*upload)
+	us.total = 0
+	if us.dir == "" {
+		return nil
+	}
+	return os.RemoveAll(us.dir)
+}
@@ -12,6 +12,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"path"
 	"sort"
 	"strconv"
 	"strings"
@@ -77,6 +78,9 @@ const (
 	// The item is in the state and should be pinned, but
 	// it is however not pinned and not queued/pinning.
 	TrackerStatusUnexpectedlyUnpinned
+	// The IPFS daemon reports the item as pinned but some of its blocks
+	// are missing. Only a verification reports it.
+	TrackerStatusPinDegraded
 )
 
 // Composite TrackerStatus.
@@ -104,6 +108,7 @@ var trackerStatusString = map[TrackerStatus]string{
 	TrackerStatusQueued:               "queued",
 	TrackerStatusSharded:              "sharded",
 	TrackerStatusUnexpectedlyUnpinned: "unexpectedly_unpinned",
+	TrackerStatusPinDegraded:          "pin_degraded",
 }
 
 // values autofilled in init()
@@ -256,6 +261,10 @@ type GlobalPinInfo struct {
 	// Peer IDs are of string Kind(). We can't use peer IDs here
 	// as Go ignores TextMarshaler.
 	PeerMap map[string]*PinInfoShort `json:"peer_map" codec:"pm,omitempty"`
+	// When the pin was created and last modified in the pinset. Zero
+	// when unknown.
+	CreatedAt time.Time `json:"created_at" codec:"ca,omitempty"`
+	UpdatedAt time.Time `json:"updated_at" codec:"ua,omitempty"`
 }
 
 // String returns the string representation of a GlobalPinInfo.
@@ -282,6 +291,56 @@ func (gpi *GlobalPinInfo) Add(pi *PinInfo) {
 	gpi.PeerMap[peer.Encode(pi.Peer)] = &pi.PinInfoShort
 }
 
+// Replication returns how many of the given allocations have pinned the
+// item. With no allocations (pin everywhere), all the peers in the PeerMap
+// are expected to pin it.
+func (gpi *GlobalPinInfo) Replication(allocs []peer.ID) PinReplication {
+	var rpl PinReplication
+	if len(allocs) == 0 {
+		rpl.Expected = len(gpi.PeerMap)
+		for _, pi := range gpi.PeerMap {
+			if pi.Status == TrackerStatusPinned {
+				rpl.Confirmed++
+			}
+		}
+		return rpl
+	}
+
+	rpl.Expected = len(allocs)
+	for _, p := range allocs {
+		pi, ok := gpi.PeerMap[peer.Encode(p)]
+		if ok && pi.Status == TrackerStatusPinned {
+			rpl.Confirmed++
+		}
+	}
+	return rpl
+}
+
+// PinReplication counts the peers which have pinned an item out of those
+// expected to pin it.
+type PinReplication struct {
+	Confirmed int `json:"confirmed" codec:"c,omitempty"`
+	Expected  int `json:"expected" codec:"e,omitempty"`
+}
+
+// Complete returns true when all the expected peers have pinned the item.
+func (rpl PinReplication) Complete() bool {
+	return rpl.Expected > 0 && rpl.Confirmed >= rpl.Expected
+}
+
+// String returns a human-readable representation of the PinReplication.
+func (rpl PinReplication) String() string {
+	return fmt.Sprintf("%d/%d replicas confirmed", rpl.Confirmed, rpl.Expected)
+}
+
+// PinAck is the response to a Pin request which waited for the item to be
+// replicated. Replication holds the state reached by the time the request
+// returned.
+type PinAck struct {
+	Pin         Pin            `json:"pin"`
+	Replication PinReplication `json:"replication"`
+}
+
 // PinInfoShort is a subset of PinInfo which is embedded in GlobalPinInfo
 // objects and does not carry redundant information as PinInfo would.
 type PinInfoShort struct {
@@ -291,6 +350,25 @@ type PinInfoShort struct {
 	Error        string        `json:"error" codec:"e,omitempty"`
 	AttemptCount int           `json:"attempt_count" codec:"a,omitempty"`
 	PriorityPin  bool          `json:"priority_pin" codec:"y,omitempty"`
+	// Since is when the ongoing or last operation on the item started.
+	Since time.Time `json:"since,omitempty" codec:"sn,omitempty"`
+	// Duration is how long the last operation took, once it has
+	// finished.
+	Duration time.Duration `json:"duration,omitempty" codec:"du,omitempty"`
+	// BlocksFetched is how many blocks an ongoing pin has fetched so
+	// far, when IPFS reports it.
+	BlocksFetched int `json:"blocks_fetched,omitempty" codec:"bf,omitempty"`
+	// MissingBlocks lists the blocks of a degraded pin which the IPFS
+	// daemon was found not to have. The DAG walk stops at the first
+	// missing block, so it holds one block and others may be missing
+	// as well.
+	MissingBlocks []cid.Cid `json:"missing_blocks,omitempty" codec:"mb,omitempty"`
+}
+
+// PinProgress reports how many blocks an ongoing pin has fetched.
+type PinProgress struct {
+	Cid    cid.Cid `json:"cid" codec:"c"`
+	Blocks int     `json:"blocks" codec:"b"`
 }
 
 // PinInfo holds information about local pins. This is used by the Pin
@@ -311,6 +389,20 @@ func (pi *PinInfo) ToGlobal() *GlobalPinInfo {
 	return &gpi
 }
 
+// PinSLABreach describes a pin which was not pinned by a peer within the
+// PinDeadline set in its options.
+type PinSLABreach struct {
+	Cid      cid.Cid `json:"cid" codec:"c"`
+	Name     string  `json:"name" codec:"m,omitempty"`
+	Peer     peer.ID `json:"peer" codec:"p,omitempty"`
+	PeerName string  `json:"peername" codec:"pn,omitempty"`
+	// Deadline is when the item should have been pinned.
+	Deadline time.Time `json:"deadline" codec:"d,omitempty"`
+	// PinnedAt is when the item was pinned. It is zero while the peer
+	// has not pinned it yet.
+	PinnedAt time.Time `json:"pinned_at" codec:"pa,omitempty"`
+}
+
 // Version holds version information
 type Version struct {
 	Version string `json:"version" codec:"v"`
@@ -402,6 +494,20 @@ type ID struct {
 	Error                 string      `json:"error" codec:"e,omitempty"`
 	IPFS                  *IPFSID     `json:"ipfs,omitempty" codec:"ip,omitempty"`
 	Peername              string      `json:"peername" codec:"pn,omitempty"`
+	Maintenance           bool        `json:"maintenance,omitempty" codec:"mm,omitempty"`
+	// Leader is the current consensus leader, if known. Leaderless is
+	// set instead when the consensus component does not have leaders
+	// (i.e. CRDT), so that any peer can take writes.
+	Leader     peer.ID `json:"leader,omitempty" codec:"l,omitempty"`
+	Leaderless bool    `json:"leaderless,omitempty" codec:"ll,omitempty"`
+	// WriteHint is the peer to which clients should preferably send
+	// writes: the leader or, in leaderless clusters, the least loaded
+	// peer according to the metric set in the cluster configuration.
+	WriteHint peer.ID `json:"write_hint,omitempty" codec:"wh,omitempty"`
+	// WriteWeights is, in leaderless clusters with a write hint metric,
+	// the share of the writes that every peer should take, indexed by
+	// encoded peer ID, so that clients can spread them.
+	WriteWeights map[string]int64 `json:"write_weights,omitempty" codec:"ww,omitempty"`
 	//PublicKey          crypto.PubKey
 }
 
@@ -564,6 +670,15 @@ func (pm PinMode) ToPinDepth() PinDepth {
 	}
 }
 
+// UnderReplicatedMetaKey is the pin metadata key that Cluster sets, with a
+// warning as value, on pins allocated to fewer peers than their
+// ReplicationFactorMin because the allocator allows under-replication.
+const UnderReplicatedMetaKey = "under_replicated"
+
+// OwnerMetaKey is the pin metadata key that the REST API sets, with the
+// identity the client authenticated with, on the pins it creates.
+const OwnerMetaKey = "owner"
+
 // PinOptions wraps user-defined options for Pins
 type PinOptions struct {
 	ReplicationFactorMin int               `json:"replication_factor_min" codec:"rn,omitempty"`
@@ -576,6 +691,23 @@ type PinOptions struct {
 	Metadata             map[string]string `json:"metadata" codec:"m,omitempty"`
 	PinUpdate            cid.Cid           `json:"pin_update,omitempty" codec:"pu,omitempty"`
 	Origins              []Multiaddr       `json:"origins" codec:"g,omitempty"`
+	DependsOn            cid.Cid           `json:"depends_on,omitempty" codec:"do,omitempty"`
+	ExcludeLinks         []string          `json:"exclude_links,omitempty" codec:"xl,omitempty"`
+	Placement            string            `json:"placement,omitempty" codec:"pl,omitempty"`
+	QoSClass             string            `json:"qos_class,omitempty" codec:"qc,omitempty"`
+	// MaxDepth associated to this pin. -1 means recursive and 0 means
+	// direct. Positive values pin only that many levels of the DAG
+	// below the root. As an option, it is only honored for recursive
+	// pins and otherwise derived from the Mode (see PinWithOpts).
+	MaxDepth PinDepth `json:"max_depth" codec:"d,omitempty"`
+	// PinDeadline is the time by which the allocated peers are expected
+	// to have pinned the item. Peers pinning it later report a breach
+	// (see PinSLABreach). When given as a duration (pin-deadline-in), it
+	// counts from the moment the request is accepted.
+	PinDeadline time.Time `json:"pin_deadline" codec:"pd,omitempty"`
+	// DryRun makes Cluster return the pin as it would be committed,
+	// allocations included, without committing it. It is never stored.
+	DryRun bool `json:"dry_run,omitempty" codec:"dr,omitempty"`
 }
 
 // Equals returns true if two PinOption objects are equivalent. po and po2 may
@@ -637,6 +769,30 @@ func (po *PinOptions) Equals(po2 *PinOptions) bool {
 
 	// deliberately ignore Update
 
+	if !po.DependsOn.Equals(po2.DependsOn) {
+		return false
+	}
+
+	if strings.Join(po.ExcludeLinks, ",") != strings.Join(po2.ExcludeLinks, ",") {
+		return false
+	}
+
+	if po.Placement != po2.Placement {
+		return false
+	}
+
+	if po.QoSClass != po2.QoSClass {
+		return false
+	}
+
+	if !po.PinDeadline.Equal(po2.PinDeadline) {
+		return false
+	}
+
+	if po.MaxDepth != po2.MaxDepth {
+		return false
+	}
+
 	lenOrigins1 := len(po.Origins)
 	lenOrigins2 := len(po2.Origins)
 	if lenOrigins1 != lenOrigins2 {
@@ -658,6 +814,49 @@ func (po *PinOptions) Equals(po2 *PinOptions) bool {
 	return true
 }
 
+// ValidateLinkPattern checks that an ExcludeLinks pattern is well formed.
+// Patterns follow the path.Match syntax and are matched against the path of
+// link names from the root of the DAG (i.e. "thumbs" or "*/thumb_*.jpg").
+func ValidateLinkPattern(pattern string) error {
+	if pattern == "" {
+		return errors.New("exclude-links pattern cannot be empty")
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("bad exclude-links pattern %q: %w", pattern, err)
+	}
+	return nil
+}
+
+// ExcludesLink returns true when the given link path, relative to the root of
+// the DAG, matches any of the ExcludeLinks patterns. Excluded links are not
+// pinned (and neither is anything below them).
+func (po *PinOptions) ExcludesLink(linkPath string) bool {
+	for _, pattern := range po.ExcludeLinks {
+		if ok, _ := path.Match(pattern, linkPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ExcludesBelow returns true when some of the ExcludeLinks patterns may match
+// links found below the given link path. Otherwise, the sub-DAG under that
+// link can be pinned recursively as a whole.
+func (po *PinOptions) ExcludesBelow(linkPath string) bool {
+	depth := strings.Count(linkPath, "/") + 1
+	for _, pattern := range po.ExcludeLinks {
+		segments := strings.Split(pattern, "/")
+		if len(segments) <= depth {
+			continue
+		}
+		prefix := strings.Join(segments[:depth], "/")
+		if ok, _ := path.Match(prefix, linkPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
 // ToQuery returns the PinOption as query arguments.
 func (po *PinOptions) ToQuery() (string, error) {
 	q := url.Values{}
@@ -692,6 +891,38 @@ func (po *PinOptions) ToQuery() (string, error) {
 		q.Set("origins", strings.Join(origins, ","))
 	}
 
+	if po.DependsOn != cid.Undef {
+		q.Set("depends-on", po.DependsOn.String())
+	}
+
+	if len(po.ExcludeLinks) > 0 {
+		q.Set("exclude-links", strings.Join(po.ExcludeLinks, ","))
+	}
+
+	if po.Placement != "" {
+		q.Set("placement", po.Placement)
+	}
+
+	if po.QoSClass != "" {
+		q.Set("qos-class", po.QoSClass)
+	}
+
+	if !po.PinDeadline.IsZero() {
+		v, err := po.PinDeadline.MarshalText()
+		if err != nil {
+			return "", err
+		}
+		q.Set("pin-deadline", string(v))
+	}
+
+	if po.MaxDepth > 0 {
+		q.Set("max-depth", fmt.Sprintf("%d", po.MaxDepth))
+	}
+
+	if po.DryRun {
+		q.Set("dry-run", "true")
+	}
+
 	return q.Encode(), nil
 }
 
@@ -725,7 +956,11 @@ func (po *PinOptions) FromQuery(q url.Values) error {
 		po.ShardSize = shardSize
 	}
 
-	if allocs := q.Get("user-allocations"); allocs != "" {
+	allocs := q.Get("user-allocations")
+	if allocs == "" {
+		allocs = q.Get("allocations")
+	}
+	if allocs != "" {
 		po.UserAllocations = StringsToPeers(strings.Split(allocs, ","))
 	}
 
@@ -787,6 +1022,63 @@ func (po *PinOptions) FromQuery(q url.Values) error {
 		po.Origins = maOrigins
 	}
 
+	dependsOnStr := q.Get("depends-on")
+	if dependsOnStr != "" {
+		dependsOn, err := cid.Decode(dependsOnStr)
+		if err != nil {
+			return fmt.Errorf("error decoding depends-on parameter: %s", err)
+		}
+		po.DependsOn = dependsOn
+	}
+
+	if excludeStr := q.Get("exclude-links"); excludeStr != "" {
+		patterns := strings.Split(excludeStr, ",")
+		for _, p := range patterns {
+			if err := ValidateLinkPattern(p); err != nil {
+				return err
+			}
+		}
+		po.ExcludeLinks = patterns
+	}
+
+	po.Placement = q.Get("placement")
+	if _, err := ParsePlacement(po.EffectivePlacement()); err != nil {
+		return err
+	}
+
+	po.QoSClass = q.Get("qos-class")
+
+	if v := q.Get("pin-deadline"); v != "" {
+		var tm time.Time
+		err := tm.UnmarshalText([]byte(v))
+		if err != nil {
+			return errors.Wrap(err, "pin-deadline cannot be parsed")
+		}
+		po.PinDeadline = tm
+	} else if v = q.Get("pin-deadline-in"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return errors.New("parameter pin-deadline-in is invalid")
+		}
+		po.PinDeadline = time.Now().Add(d)
+	}
+
+	if v := q.Get("max-depth"); v != "" {
+		depth, err := strconv.Atoi(v)
+		if err != nil || depth < -1 {
+			return errors.New("parameter max-depth is invalid")
+		}
+		po.MaxDepth = PinDepth(depth)
+	}
+
+	if v := q.Get("dry-run"); v != "" {
+		dryRun, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.New("parameter dry-run is invalid")
+		}
+		po.DryRun = dryRun
+	}
+
 	return nil
 }
 
@@ -796,11 +1088,13 @@ type PinDepth int
 
 // ToPinMode converts PinDepth to PinMode
 func (pd PinDepth) ToPinMode() PinMode {
-	switch pd {
-	case -1:
+	switch {
+	case pd == -1:
 		return PinModeRecursive
-	case 0:
+	case pd == 0:
 		return PinModeDirect
+	case pd > 0: // partial recursive pin
+		return PinModeRecursive
 	default:
 		logger.Warnf("bad pin depth: %d", pd)
 		return PinModeRecursive
@@ -821,10 +1115,6 @@ type Pin struct {
 	// The peers to which this pin is allocated
 	Allocations []peer.ID `json:"allocations" codec:"a,omitempty"`
 
-	// MaxDepth associated to this pin. -1 means
-	// recursive.
-	MaxDepth PinDepth `json:"max_depth" codec:"d,omitempty"`
-
 	// We carry a reference CID to this pin. For
 	// ClusterDAGs, it is the MetaPin CID. For the
 	// MetaPin it is the ClusterDAG CID. For Shards,
@@ -832,8 +1122,28 @@ type Pin struct {
 	// When not needed the pointer is nil
 	Reference *cid.Cid `json:"reference" codec:"r,omitempty"`
 
-	// The time that the pin was submitted to the consensus layer.
+	// The time that the pin was submitted to the consensus layer. As
+	// it is set every time the pin is (re)submitted, it also tells when
+	// the pin was last modified.
 	Timestamp time.Time `json:"timestamp" codec:"i,omitempty"`
+
+	// The time that the pin was first submitted to the consensus layer.
+	// It is zero (unknown) for pins created by older versions.
+	CreatedAt time.Time `json:"created_at" codec:"ca,omitempty"`
+
+	// IPNSName is the /ipns/ path which resolved to Cid when the pin was
+	// made from it. The path is re-resolved periodically and the pin is
+	// moved to the new CID when it changes (see the cluster
+	// IPNSResolveInterval option).
+	IPNSName string `json:"ipns_name,omitempty" codec:"in,omitempty"`
+
+	// MFSPath is the path in the MFS (files API) of the IPFS daemon of
+	// MFSPeer which resolved to Cid when the pin was made from a /mfs/
+	// path. Only MFSPeer can resolve it again, which it does periodically,
+	// moving the pin to the new CID when it changes (see the cluster
+	// MFSResolveInterval option).
+	MFSPath string  `json:"mfs_path,omitempty" codec:"mp,omitempty"`
+	MFSPeer peer.ID `json:"mfs_peer,omitempty" codec:"mr,omitempty"`
 }
 
 // String is a string representation of a Pin.
@@ -846,6 +1156,12 @@ func (pin *Pin) String() string {
 	if pin.Reference != nil {
 		fmt.Fprintf(&b, "reference: %s\n", pin.Reference)
 	}
+	if pin.IPNSName != "" {
+		fmt.Fprintf(&b, "ipns name: %s\n", pin.IPNSName)
+	}
+	if pin.MFSPath != "" {
+		fmt.Fprintf(&b, "mfs path: %s (%s)\n", pin.MFSPath, pin.MFSPeer)
+	}
 	return b.String()
 }
 
@@ -860,25 +1176,52 @@ type PinPath struct {
 	Path string `json:"path"`
 }
 
+// MFSPathPrefix prefixes the paths given to PinPath which are resolved in the
+// MFS (files API) of the IPFS daemon, rather than as IPFS paths. For example,
+// /mfs/my/dir pins the CID of the /my/dir folder.
+const MFSPathPrefix = "/mfs/"
+
+// MFSPath returns the MFS path in the given /mfs/ path, or an empty string
+// otherwise.
+func MFSPath(p string) string {
+	if !strings.HasPrefix(p, MFSPathPrefix) {
+		return ""
+	}
+	return path.Clean("/" + strings.TrimPrefix(p, MFSPathPrefix))
+}
+
+// BlockHoldersRequest wraps the arguments to find which peers hold a
+// block in their IPFS daemon. When All is false, only the peers allocated
+// to the pin are asked.
+type BlockHoldersRequest struct {
+	Cid cid.Cid `json:"cid" codec:"c"`
+	All bool    `json:"all" codec:"a,omitempty"`
+}
+
 // PinCid is a shortcut to create a Pin only with a Cid.  Default is for pin to
 // be recursive and the pin to be of DataType.
 func PinCid(c cid.Cid) *Pin {
 	return &Pin{
+		PinOptions: PinOptions{
+			MaxDepth: -1, // Recursive
+		},
 		Cid:         c,
 		Type:        DataType,
 		Allocations: []peer.ID{},
-		MaxDepth:    -1, // Recursive
 		Timestamp:   time.Now(),
 	}
 }
 
 // PinWithOpts creates a new Pin calling PinCid(c) and then sets its
-// PinOptions fields with the given options. Pin fields that are linked to
-// options are set accordingly (MaxDepth from Mode).
+// PinOptions fields with the given options. Options that are linked are set
+// accordingly: MaxDepth is derived from Mode, unless a positive MaxDepth is
+// given for a recursive pin.
 func PinWithOpts(c cid.Cid, opts PinOptions) *Pin {
 	p := PinCid(c)
 	p.PinOptions = opts
-	p.MaxDepth = p.Mode.ToPinDepth()
+	if p.Mode != PinModeRecursive || p.MaxDepth <= 0 {
+		p.MaxDepth = p.Mode.ToPinDepth()
+	}
 	return p
 }
 
@@ -918,12 +1261,22 @@ func (pin *Pin) ProtoMarshal() ([]byte, error) {
 		expireAtProto = uint64(pin.ExpireAt.Unix())
 	}
 
+	var pinDeadlineProto int64
+	if !pin.PinDeadline.IsZero() {
+		pinDeadlineProto = pin.PinDeadline.UnixNano()
+	}
+
 	var timestampProto uint64
 	// Only set the protobuf field with non-zero times.
 	if !(pin.Timestamp.IsZero() || pin.Timestamp.Equal(unixZero)) {
 		timestampProto = uint64(pin.Timestamp.Unix())
 	}
 
+	var createdAtProto uint64
+	if !(pin.CreatedAt.IsZero() || pin.CreatedAt.Equal(unixZero)) {
+		createdAtProto = uint64(pin.CreatedAt.Unix())
+	}
+
 	opts := &pb.PinOptions{
 		ReplicationFactorMin: int32(pin.ReplicationFactorMin),
 		ReplicationFactorMax: int32(pin.ReplicationFactorMax),
@@ -934,7 +1287,12 @@ func (pin *Pin) ProtoMarshal() ([]byte, error) {
 		ExpireAt:             expireAtProto,
 		// Mode:                 pin.Mode,
 		// UserAllocations:      pin.UserAllocations,
-		Origins: origins,
+		Origins:      origins,
+		DependsOn:    pin.DependsOn.Bytes(),
+		ExcludeLinks: pin.ExcludeLinks,
+		Placement:    pin.Placement,
+		QoSClass:     pin.QoSClass,
+		PinDeadline:  pinDeadlineProto,
 	}
 
 	pbPin := &pb.Pin{
@@ -944,6 +1302,12 @@ func (pin *Pin) ProtoMarshal() ([]byte, error) {
 		MaxDepth:    int32(pin.MaxDepth),
 		Options:     opts,
 		Timestamp:   timestampProto,
+		CreatedAt:   createdAtProto,
+		IPNSName:    pin.IPNSName,
+		MFSPath:     pin.MFSPath,
+	}
+	if pin.MFSPeer != "" {
+		pbPin.MFSPeer = []byte(pin.MFSPeer)
 	}
 	if ref := pin.Reference; ref != nil {
 		pbPin.Reference = ref.Bytes()
@@ -993,6 +1357,17 @@ func (pin *Pin) ProtoUnmarshal(data []byte) error {
 		pin.Timestamp = time.Unix(int64(ts), 0)
 	}
 
+	createdAt := pbPin.GetCreatedAt()
+	if createdAt > 0 {
+		pin.CreatedAt = time.Unix(int64(createdAt), 0)
+	}
+
+	pin.IPNSName = pbPin.GetIPNSName()
+	pin.MFSPath = pbPin.GetMFSPath()
+	if mfsPeer, err := peer.IDFromBytes(pbPin.GetMFSPeer()); err == nil {
+		pin.MFSPeer = mfsPeer
+	}
+
 	opts := pbPin.GetOptions()
 	pin.ReplicationFactorMin = int(opts.GetReplicationFactorMin())
 	pin.ReplicationFactorMax = int(opts.GetReplicationFactorMax())
@@ -1025,6 +1400,18 @@ func (pin *Pin) ProtoUnmarshal(data []byte) error {
 	}
 	pin.Origins = origins
 
+	dependsOn, err := cid.Cast(opts.GetDependsOn())
+	if err == nil {
+		pin.DependsOn = dependsOn
+	}
+
+	pin.ExcludeLinks = opts.GetExcludeLinks()
+	pin.Placement = opts.GetPlacement()
+	pin.QoSClass = opts.GetQoSClass()
+	if deadline := opts.GetPinDeadline(); deadline != 0 {
+		pin.PinDeadline = time.Unix(0, deadline)
+	}
+
 	return nil
 }
 
@@ -1056,6 +1443,14 @@ func (pin *Pin) Equals(pin2 *Pin) bool {
 		return false
 	}
 
+	if pin.IPNSName != pin2.IPNSName {
+		return false
+	}
+
+	if pin.MFSPath != pin2.MFSPath || pin.MFSPeer != pin2.MFSPeer {
+		return false
+	}
+
 	if pin.Reference != nil && pin2.Reference == nil ||
 		pin.Reference == nil && pin2.Reference != nil {
 		return false
@@ -1133,6 +1528,170 @@ type Metric struct {
 	Weight        int64   `json:"weight" codec:"w,omitempty"`
 	Partitionable bool    `json:"partitionable" codec:"o,omitempty"`
 	ReceivedAt    int64   `json:"received_at" codec:"t,omitempty"` // ReceivedAt contains a UnixNano timestamp
+	// Tags are arbitrary key/values describing the peer which sent the
+	// metric (i.e. its datacenter or disk type). They are not sent by
+	// peers in older versions.
+	Tags map[string]string `json:"tags,omitempty" codec:"g,omitempty"`
+	// Capacity is the total that the metric value is a part of (i.e. the
+	// repository size limit for freespace metrics), when the informer
+	// knows it. It is not sent by peers in older versions.
+	Capacity uint64 `json:"capacity,omitempty" codec:"c,omitempty"`
+	// Stale flags, in the windows returned by PeerMetricAll, the metrics
+	// which have expired but have not been removed yet.
+	Stale bool `json:"stale,omitempty" codec:"s,omitempty"`
+}
+
+// StateDigest summarizes the view that a peer has of the shared state, so
+// that peers can tell whether they agree on it.
+type StateDigest struct {
+	Peer   peer.ID `json:"peer" codec:"p,omitempty"`
+	Digest string  `json:"digest" codec:"d,omitempty"`
+	Leader peer.ID `json:"leader,omitempty" codec:"l,omitempty"`
+}
+
+// PinsDiff lists the pins on which the shared state of this peer and that of
+// another peer disagree.
+type PinsDiff struct {
+	Peer peer.ID `json:"peer" codec:"p,omitempty"`
+	// Added are the pins that the other peer has and this one does not.
+	Added []*Pin `json:"added" codec:"a,omitempty"`
+	// Removed are the pins that this peer has and the other one does not.
+	Removed []*Pin `json:"removed" codec:"r,omitempty"`
+	// Changed are the pins that both have with different options or
+	// allocations, as the other peer has them.
+	Changed []*Pin `json:"changed" codec:"c,omitempty"`
+	// Error is set when the state of the other peer could not be
+	// obtained, in which case the diff is empty.
+	Error string `json:"error,omitempty" codec:"e,omitempty"`
+}
+
+// OperationType identifies the changes to the shared state recorded in the
+// operation log.
+type OperationType string
+
+// Operation types.
+const (
+	// OperationPin is recorded when an item is added to the pinset.
+	OperationPin OperationType = "pin"
+	// OperationUpdate is recorded when an item already in the pinset is
+	// pinned again (i.e. with different options).
+	OperationUpdate OperationType = "update"
+	// OperationUnpin is recorded when an item is removed from the pinset.
+	OperationUnpin OperationType = "unpin"
+)
+
+// Operation is an entry of the operation log: a change to the shared state
+// committed by the consensus component. Operations are numbered by the peer
+// recording them, starting at 1.
+type Operation struct {
+	Seq       uint64        `json:"seq" codec:"s"`
+	Type      OperationType `json:"type" codec:"t,omitempty"`
+	Cid       cid.Cid       `json:"cid" codec:"c"`
+	Pin       *Pin          `json:"pin,omitempty" codec:"p,omitempty"`
+	Timestamp time.Time     `json:"timestamp" codec:"ts,omitempty"`
+}
+
+// OpLogRequest asks for up to Limit operations following the After sequence
+// number, which is not included, waiting up to Wait for new ones when there
+// are none.
+type OpLogRequest struct {
+	After uint64        `json:"after" codec:"a,omitempty"`
+	Limit int           `json:"limit" codec:"l,omitempty"`
+	Wait  time.Duration `json:"wait" codec:"w,omitempty"`
+}
+
+// OpLogPage is a sequence of operations from the operation log of a peer,
+// along with the sequence numbers of the oldest operation retained (First)
+// and of the latest one recorded (Last). Sequence numbers start again when
+// the peer restarts, and its InstanceID changes.
+type OpLogPage struct {
+	Peer       peer.ID      `json:"peer" codec:"p,omitempty"`
+	InstanceID string       `json:"instance_id" codec:"i,omitempty"`
+	First      uint64       `json:"first" codec:"f,omitempty"`
+	Last       uint64       `json:"last" codec:"l,omitempty"`
+	Operations []*Operation `json:"operations" codec:"o,omitempty"`
+}
+
+// AllocationCandidate is a peer which was considered when allocating an
+// item, along with the weights of the metrics that the allocator used to
+// sort the candidates, indexed by metric name.
+type AllocationCandidate struct {
+	Peer peer.ID `json:"peer" codec:"p,omitempty"`
+	// Current is set for the peers already allocated to the item.
+	Current bool `json:"current,omitempty" codec:"c,omitempty"`
+	// Priority is set for the peers which were preferred (i.e. because
+	// they hold the item already or the placement rules say so).
+	Priority bool             `json:"priority,omitempty" codec:"r,omitempty"`
+	Scores   map[string]int64 `json:"scores" codec:"s,omitempty"`
+}
+
+// AllocationDecision records how a peer allocated an item: the candidates
+// the last allocator tried was given and the allocations which resulted,
+// or the error when there were not enough.
+type AllocationDecision struct {
+	Cid                  cid.Cid                `json:"cid" codec:"c"`
+	Timestamp            time.Time              `json:"timestamp" codec:"ts,omitempty"`
+	ReplicationFactorMin int                    `json:"replication_factor_min" codec:"rn,omitempty"`
+	ReplicationFactorMax int                    `json:"replication_factor_max" codec:"rx,omitempty"`
+	Candidates           []*AllocationCandidate `json:"candidates" codec:"cs,omitempty"`
+	Allocations          []peer.ID              `json:"allocations" codec:"a,omitempty"`
+	Error                string                 `json:"error,omitempty" codec:"e,omitempty"`
+}
+
+// Tombstone records that an item was unpinned through a peer, for auditing.
+type Tombstone struct {
+	Cid        cid.Cid   `json:"cid" codec:"c"`
+	Name       string    `json:"name,omitempty" codec:"n,omitempty"`
+	UnpinnedAt time.Time `json:"unpinned_at" codec:"t,omitempty"`
+	// UnpinnedBy is the identity of the API client which requested the
+	// unpin, when known.
+	UnpinnedBy string `json:"unpinned_by,omitempty" codec:"b,omitempty"`
+	// Peer is the peer which handled the unpin request.
+	Peer peer.ID `json:"peer" codec:"p,omitempty"`
+}
+
+// SyncSummary reports the corrections made by a full state sync in a peer.
+type SyncSummary struct {
+	Peer       peer.ID   `json:"peer" codec:"p,omitempty"`
+	StartedAt  time.Time `json:"started_at" codec:"s,omitempty"`
+	FinishedAt time.Time `json:"finished_at" codec:"f,omitempty"`
+	// ExpiredUnpinned lists the expired items which were unpinned.
+	ExpiredUnpinned []cid.Cid `json:"expired_unpinned" codec:"e,omitempty"`
+	// Repinned lists the items in error or unexpectedly unpinned which
+	// were pinned again.
+	Repinned []cid.Cid `json:"repinned" codec:"r,omitempty"`
+	// Unpinned lists the items in unpin error which were unpinned
+	// again.
+	Unpinned []cid.Cid `json:"unpinned" codec:"u,omitempty"`
+	// Failed lists the items which remain in error.
+	Failed []cid.Cid `json:"failed" codec:"x,omitempty"`
+}
+
+// MetricsAtRequest wraps the arguments to obtain the metrics of a given
+// name which were valid at a given time.
+type MetricsAtRequest struct {
+	Name string    `json:"name" codec:"n"`
+	Time time.Time `json:"time" codec:"t"`
+}
+
+// PeerMetricRequest wraps the arguments to obtain the metrics of a given name
+// retained for a given peer.
+type PeerMetricRequest struct {
+	Peer peer.ID `json:"peer" codec:"p"`
+	Name string  `json:"name" codec:"n"`
+}
+
+// MetricStats summarizes the valid metrics of a given name retained for a
+// peer. Min, Max, Avg and P95 are computed over the values which are
+// numeric, and are zero when Samples is 0. Latest is the value of the last
+// valid metric, numeric or not.
+type MetricStats struct {
+	Samples int     `json:"samples" codec:"s,omitempty"`
+	Min     float64 `json:"min" codec:"mi,omitempty"`
+	Max     float64 `json:"max" codec:"ma,omitempty"`
+	Avg     float64 `json:"avg" codec:"a,omitempty"`
+	P95     float64 `json:"p95" codec:"p,omitempty"`
+	Latest  string  `json:"latest" codec:"l,omitempty"`
 }
 
 // SetTTL sets Metric to expire after the given time.Duration
@@ -1162,6 +1721,17 @@ func (m *Metric) Discard() bool {
 	return !m.Valid || m.Expired()
 }
 
+// MatchesTags returns true when the metric carries all the given tags with
+// the same values.
+func (m *Metric) MatchesTags(tags map[string]string) bool {
+	for k, v := range tags {
+		if mv, ok := m.Tags[k]; !ok || mv != v {
+			return false
+		}
+	}
+	return true
+}
+
 // GetWeight returns the weight of the metric. When it is 0,
 // it tries to parse the Value and use it as weight.
 // This is for compatiblity.
@@ -1193,12 +1763,16 @@ func (es MetricSlice) Less(i, j int) bool {
 type Alert struct {
 	Metric
 	TriggeredAt time.Time `json:"triggered_at" codec:"r,omitempty"`
+	// Recovered is set on the alerts sent when a valid metric arrives
+	// again for a name and peer that triggered an alert before.
+	Recovered bool `json:"recovered,omitempty" codec:"rc,omitempty"`
 }
 
 // Error can be used by APIs to return errors.
 type Error struct {
-	Code    int    `json:"code" codec:"o,omitempty"`
-	Message string `json:"message" codec:"m,omitempty"`
+	Code    int       `json:"code" codec:"o,omitempty"`
+	Message string    `json:"message" codec:"m,omitempty"`
+	Kind    ErrorKind `json:"kind,omitempty" codec:"k,omitempty"`
 }
 
 // Error implements the error interface and returns the error's message.
@@ -1206,12 +1780,25 @@ func (e *Error) Error() string {
 	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
 }
 
+// Is returns true when the target is a well-known error of the same kind,
+// so that errors.Is(err, ErrNotFound) works on errors received from the API.
+func (e *Error) Is(target error) bool {
+	return e.Kind != ErrorKindUnknown && KindOf(target) == e.Kind
+}
+
 // IPFSRepoStat wraps information about the IPFS repository.
 type IPFSRepoStat struct {
 	RepoSize   uint64 `codec:"r,omitempty"`
 	StorageMax uint64 `codec:"s, omitempty"`
 }
 
+// FindProvidersRequest asks the IPFS daemon for up to Count peers, other
+// than itself, which provide the given Cid.
+type FindProvidersRequest struct {
+	Cid   cid.Cid `codec:"c,omitempty"`
+	Count int     `codec:"n,omitempty"`
+}
+
 // IPFSRepoGC represents the streaming response sent from repo gc API of IPFS.
 type IPFSRepoGC struct {
 	Key   cid.Cid `json:"key,omitempty" codec:"k,omitempty"`
@@ -84,6 +84,48 @@ func TestMetric(t *testing.T) {
 	}
 }
 
+func TestMetricTags(t *testing.T) {
+	m := &Metric{
+		Name: "tag:region",
+		Tags: map[string]string{"region": "eu", "disk": "ssd"},
+	}
+	if !m.MatchesTags(map[string]string{"region": "eu"}) || !m.MatchesTags(nil) {
+		t.Error("metric should match")
+	}
+	if m.MatchesTags(map[string]string{"region": "eu", "disk": "hdd"}) {
+		t.Error("metric should not match")
+	}
+
+	// Metrics of peers which do not send tags decode with no tags.
+	old := struct {
+		Name  string `codec:"n,omitempty"`
+		Value string `codec:"v,omitempty"`
+	}{"freespace", "100"}
+	var b []byte
+	if err := codec.NewEncoderBytes(&b, &codec.MsgpackHandle{}).Encode(old); err != nil {
+		t.Fatal(err)
+	}
+	var m2 Metric
+	if err := codec.NewDecoderBytes(b, &codec.MsgpackHandle{}).Decode(&m2); err != nil {
+		t.Fatal(err)
+	}
+	if m2.Name != "freespace" || m2.Value != "100" || m2.Tags != nil {
+		t.Errorf("unexpected metric: %+v", m2)
+	}
+
+	b = nil
+	if err := codec.NewEncoderBytes(&b, &codec.MsgpackHandle{}).Encode(m); err != nil {
+		t.Fatal(err)
+	}
+	var m3 Metric
+	if err := codec.NewDecoderBytes(b, &codec.MsgpackHandle{}).Decode(&m3); err != nil {
+		t.Fatal(err)
+	}
+	if m3.Tags["disk"] != "ssd" || len(m3.Tags) != 2 {
+		t.Error("tags should be serialized")
+	}
+}
+
 func TestConvertPinType(t *testing.T) {
 	for _, t1 := range []PinType{BadType, ShardType} {
 		i := convertPinType(t1)
@@ -158,7 +200,35 @@ func TestDupTags(t *testing.T) {
 	checkDupTags(t, "codec", typ, nil)
 }
 
+func TestGlobalPinInfoReplication(t *testing.T) {
+	TestPeerID1, _ := peer.Decode("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc")
+	TestPeerID2, _ := peer.Decode("QmUZ13osndQ5uL4tPWHXe3iBgBgq9gfewcBMSCAuMBsDJ6")
+	TestPeerID3, _ := peer.Decode("QmPGDFvBkgWhvzEK9qaTWrWurSwqXNmhnK3hgELPdZZNPa")
+	gpi := &GlobalPinInfo{
+		PeerMap: map[string]*PinInfoShort{
+			peer.Encode(TestPeerID1): {Status: TrackerStatusPinned},
+			peer.Encode(TestPeerID2): {Status: TrackerStatusPinning},
+		},
+	}
+
+	rpl := gpi.Replication(nil)
+	if rpl.Confirmed != 1 || rpl.Expected != 2 || rpl.Complete() {
+		t.Errorf("unexpected replication for pin everywhere: %s", rpl)
+	}
+
+	rpl = gpi.Replication([]peer.ID{TestPeerID1, TestPeerID3})
+	if rpl.Confirmed != 1 || rpl.Expected != 2 || rpl.Complete() {
+		t.Errorf("unexpected replication: %s", rpl)
+	}
+
+	rpl = gpi.Replication([]peer.ID{TestPeerID1})
+	if !rpl.Complete() {
+		t.Errorf("expected complete replication: %s", rpl)
+	}
+}
+
 func TestPinOptionsQuery(t *testing.T) {
+	dependsOn, _ := cid.Decode("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc")
 	testcases := []*PinOptions{
 		{
 			ReplicationFactorMax: 3,
@@ -178,6 +248,13 @@ func TestPinOptionsQuery(t *testing.T) {
 				NewMultiaddrWithValue(multiaddr.StringCast("/ip4/1.2.3.4/tcp/1234/p2p/12D3KooWKewdAMAU3WjYHm8qkAJc5eW6KHbHWNigWraXXtE1UCng")),
 				NewMultiaddrWithValue(multiaddr.StringCast("/ip4/2.3.3.4/tcp/1234/p2p/12D3KooWF6BgwX966ge5AVFs9Gd2wVTBmypxZVvaBR12eYnUmXkR")),
 			},
+			DependsOn:    dependsOn,
+			ExcludeLinks: []string{"thumbs", "*/thumb_*.jpg"},
+			Placement:    "region>=1,rack<=2,prefer disk=ssd",
+			QoSClass:     "critical",
+			PinDeadline:  time.Date(2030, 1, 2, 3, 4, 5, 6, time.UTC),
+			MaxDepth:     2,
+			DryRun:       true,
 		},
 		{
 			ReplicationFactorMax: -1,
@@ -219,6 +296,20 @@ func TestPinOptionsQuery(t *testing.T) {
 			t.Errorf("%+v\n", tc)
 			t.Errorf("%+v\n", po2)
 		}
+		if tc.DryRun != po2.DryRun {
+			t.Error("expected the same dry-run option")
+		}
+	}
+}
+
+func TestPinOptionsQueryAllocations(t *testing.T) {
+	q, _ := url.ParseQuery("allocations=QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc,QmUZ13osndQ5uL4tPWHXe3iBgBgq9gfewcBMSCAuMBsDJ6")
+	po := &PinOptions{}
+	if err := po.FromQuery(q); err != nil {
+		t.Fatal(err)
+	}
+	if len(po.UserAllocations) != 2 {
+		t.Errorf("expected 2 user allocations; got %v", po.UserAllocations)
 	}
 }
 
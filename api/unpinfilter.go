@@ -0,0 +1,74 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// UnpinFilter selects the pins to remove in a bulk unpin. A pin matches when
+// it matches all the criteria set.
+type UnpinFilter struct {
+	// NamePrefix matches the pins whose name starts with it.
+	NamePrefix string `json:"name_prefix,omitempty" codec:"n,omitempty"`
+	// Metadata matches the pins with all these metadata keys and values.
+	Metadata map[string]string `json:"metadata,omitempty" codec:"m,omitempty"`
+	// Allocation matches the pins allocated to this peer.
+	Allocation peer.ID `json:"allocation,omitempty" codec:"a,omitempty"`
+	// Confirm must be the Token of the filter for the pins to be
+	// unpinned. Otherwise, they are only counted.
+	Confirm string `json:"confirm,omitempty" codec:"c,omitempty"`
+}
+
+// Empty returns true when the filter sets no criteria, and would match all
+// the pins.
+func (uf *UnpinFilter) Empty() bool {
+	return uf.NamePrefix == "" && len(uf.Metadata) == 0 && uf.Allocation == ""
+}
+
+// Match returns true when the given pin matches all the criteria of the
+// filter.
+func (uf *UnpinFilter) Match(pin *Pin) bool {
+	if !strings.HasPrefix(pin.Name, uf.NamePrefix) {
+		return false
+	}
+	for k, v := range uf.Metadata {
+		if pv, ok := pin.Metadata[k]; !ok || pv != v {
+			return false
+		}
+	}
+	if uf.Allocation != "" {
+		for _, p := range pin.Allocations {
+			if p == uf.Allocation {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Token returns the confirmation token of the filter, which depends only on
+// its criteria.
+func (uf *UnpinFilter) Token() string {
+	criteria := *uf
+	criteria.Confirm = ""
+	// Map keys are sorted when encoding, so the result is stable.
+	b, _ := json.Marshal(criteria)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// UnpinFilterResult is the result of a bulk unpin.
+type UnpinFilterResult struct {
+	// Matched is the number of pins matching the filter.
+	Matched int `json:"matched" codec:"m,omitempty"`
+	// Unpinned is the number of pins unpinned, which is 0 unless the
+	// filter was confirmed.
+	Unpinned int `json:"unpinned" codec:"u,omitempty"`
+	// Token is the token to confirm the filter with.
+	Token string `json:"token" codec:"t,omitempty"`
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestUnpinFilterMatch(t *testing.T) {
+	p1 := peer.ID("peer1")
+	p2 := peer.ID("peer2")
+
+	c, _ := cid.Decode("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc")
+	pin := PinCid(c)
+	pin.Name = "tmp-backup"
+	pin.Metadata = map[string]string{"team": "a", "env": "staging"}
+	pin.Allocations = []peer.ID{p1}
+
+	testcases := []struct {
+		filter UnpinFilter
+		match  bool
+	}{
+		{UnpinFilter{NamePrefix: "tmp-"}, true},
+		{UnpinFilter{NamePrefix: "backup"}, false},
+		{UnpinFilter{Metadata: map[string]string{"env": "staging"}}, true},
+		{UnpinFilter{Metadata: map[string]string{"env": "prod"}}, false},
+		{UnpinFilter{Metadata: map[string]string{"owner": ""}}, false},
+		{UnpinFilter{Allocation: p1}, true},
+		{UnpinFilter{Allocation: p2}, false},
+		{UnpinFilter{NamePrefix: "tmp-", Allocation: p2}, false},
+	}
+	for i, tc := range testcases {
+		if tc.filter.Empty() {
+			t.Errorf("%d: the filter should not be empty", i)
+		}
+		if m := tc.filter.Match(pin); m != tc.match {
+			t.Errorf("%d: expected match to be %t", i, tc.match)
+		}
+	}
+
+	if !(&UnpinFilter{}).Empty() {
+		t.Error("the filter should be empty")
+	}
+}
+
+func TestUnpinFilterToken(t *testing.T) {
+	uf := &UnpinFilter{Metadata: map[string]string{"a": "1", "b": "2"}}
+	token := uf.Token()
+
+	uf2 := &UnpinFilter{
+		Metadata: map[string]string{"b": "2", "a": "1"},
+		Confirm:  token,
+	}
+	if uf2.Token() != token {
+		t.Error("the token should only depend on the criteria")
+	}
+
+	uf2.Metadata["a"] = "2"
+	if uf2.Token() == token {
+		t.Error("different criteria should have different tokens")
+	}
+}
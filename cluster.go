@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"mime/multipart"
+	"sort"
 	"sync"
 	"time"
 
@@ -40,13 +41,32 @@ var ReadyTimeout = 30 * time.Second
 
 const (
 	pingMetricName      = "ping"
+	readOnlyMetricName  = "readonly"
+	freespaceMetricName = "freespace"
 	bootstrapCount      = 3
 	reBootstrapInterval = 30 * time.Second
 	mdnsServiceTag      = "_ipfs-cluster-discovery._udp"
 	maxAlerts           = 1000
+
+	// minWatchPingsInterval is the shortest interval with which
+	// watchPings inspects the ping metrics.
+	minWatchPingsInterval = 100 * time.Millisecond
+
+	// globalPinInfoTimeout bounds how long each peer is waited for
+	// when asking for the status of an item.
+	globalPinInfoTimeout = 15 * time.Second
+)
+
+// rebalanceTimeout bounds how long PeerRemove waits, with
+// RebalanceOnPeerRemoval, for the pins moved away from the departing peer to
+// be pinned on their new allocations. rebalanceCheckInterval is how often
+// their status is checked meanwhile.
+var (
+	rebalanceTimeout       = 10 * time.Minute
+	rebalanceCheckInterval = 5 * time.Second
 )
 
-var errFollowerMode = errors.New("this peer is configured to be in follower mode. Write operations are disabled")
+var errFollowerMode = fmt.Errorf("this peer is configured to be in follower mode: %w", api.ErrReadOnly)
 
 // Cluster is the main IPFS cluster component. It provides
 // the go-API for it and orchestrates the components that make up the system.
@@ -74,8 +94,49 @@ type Cluster struct {
 	informers []Informer
 	tracer    Tracer
 
-	alerts    []api.Alert
-	alertsMux sync.Mutex
+	alertSinks []AlertSink
+	alerts     []api.Alert
+	alertsMux  sync.Mutex
+
+	// instanceID is sent as value of the ping metric and allows other
+	// peers to detect several processes running with our peer ID.
+	instanceID    string
+	pingNonces    map[peer.ID][]string
+	pingNoncesMux sync.Mutex
+
+	// when we first saw other peers, used for allocation cooldowns.
+	startTime    time.Time
+	peersSeen    map[peer.ID]time.Time
+	peersSeenMux sync.Mutex
+
+	// reallocations waiting for a slot (MaxConcurrentReallocations) and
+	// the CIDs queued or being re-allocated.
+	reallocQueue []reallocation
+	reallocating map[cid.Cid]struct{}
+	reallocMux   sync.Mutex
+	reallocCh    chan struct{}
+
+	// QoS alerts already recorded, so that they are recorded only once.
+	qosAlerted    map[qosAlertKey]struct{}
+	qosAlertedMux sync.Mutex
+
+	// pins waiting to be committed before the commit hooks run.
+	commits    map[cid.Cid]*pendingCommit
+	commitsMux sync.Mutex
+
+	// maintenance mode suspends automatic actions.
+	maintenance    bool
+	maintenanceMux sync.RWMutex
+
+	// the last operations committed to the shared state.
+	oplog *opLog
+	// the last allocation decisions made by this peer.
+	allocAudit *allocationAudit
+	// the items recently unpinned through this peer.
+	tombstones *tombstones
+	// the running Sync(), which concurrent calls wait for.
+	syncing    *syncRun
+	syncingMux sync.Mutex
 
 	doneCh  chan struct{}
 	readyCh chan struct{}
@@ -110,13 +171,13 @@ func NewCluster(
 	monitor PeerMonitor,
 	allocator PinAllocator,
 	informers []Informer,
+	alertSinks []AlertSink,
 	tracer Tracer,
 ) (*Cluster, error) {
 	err := cfg.Validate()
 	if err != nil {
 		return nil, err
 	}
-
 	if host == nil {
 		return nil, errors.New("cluster host is nil")
 	}
@@ -161,8 +222,17 @@ func NewCluster(
 		monitor:     monitor,
 		allocator:   allocator,
 		informers:   informers,
+		alertSinks:  alertSinks,
 		tracer:      tracer,
 		alerts:      []api.Alert{},
+		instanceID:  fmt.Sprint(time.Now().UnixNano()),
+		pingNonces:  make(map[peer.ID][]string),
+		startTime:   time.Now(),
+		peersSeen:   make(map[peer.ID]time.Time),
+		reallocCh:   make(chan struct{}, 1),
+		oplog:       newOpLog(cfg.OpLogSize),
+		allocAudit:  newAllocationAudit(cfg.AllocationAuditSize),
+		tombstones:  newTombstones(datastore, cfg.TombstoneRetention),
 		peerManager: peerManager,
 		shutdownB:   false,
 		removed:     false,
@@ -170,6 +240,17 @@ func NewCluster(
 		readyCh:     make(chan struct{}),
 		readyB:      false,
 	}
+	c.reallocating = make(map[cid.Cid]struct{})
+	c.qosAlerted = make(map[qosAlertKey]struct{})
+	c.commits = make(map[cid.Cid]*pendingCommit)
+
+	if qt, ok := tracker.(QoSPinTracker); ok {
+		qt.SetQoSClasses(cfg.QoSClasses)
+	}
+
+	if c.loadMaintenance(ctx) {
+		logger.Warn("starting in maintenance mode: automatic actions are suspended")
+	}
 
 	// Import known cluster peers from peerstore file and config. Set
 	// a non permanent TTL.
@@ -209,6 +290,12 @@ func NewCluster(
 	return c, nil
 }
 
+// followerMode returns whether this peer works in follower mode, as
+// read-only peers do everything followers do.
+func (c *Cluster) followerMode() bool {
+	return c.config.FollowerMode || c.config.ReadOnly
+}
+
 func (c *Cluster) setupRPC() error {
 	rpcServer, err := newRPCServer(c)
 	if err != nil {
@@ -257,18 +344,33 @@ func (c *Cluster) watchPinset() {
 	// as PinError when doing a Status, we should proceed to recover
 	// (try pinning) all of those right away.
 	recoverTimer := time.NewTimer(0) // 0 so that it does an initial recover right away
+	initialRecover := true
 
 	// This prevents doing an StateSync while doing a RecoverAllLocal,
 	// which is intended behaviour as for very large pinsets
 	for {
 		select {
 		case <-stateSyncTimer.C:
-			logger.Debug("auto-triggering StateSync()")
-			c.StateSync(ctx)
+			if c.InMaintenance() {
+				logger.Debug("maintenance mode: skipping StateSync()")
+			} else {
+				logger.Debug("auto-triggering StateSync()")
+				c.StateSync(ctx)
+			}
 			stateSyncTimer.Reset(c.config.StateSyncInterval)
 		case <-recoverTimer.C:
-			logger.Debug("auto-triggering RecoverAllLocal()")
-			c.RecoverAllLocal(ctx)
+			if c.InMaintenance() {
+				logger.Debug("maintenance mode: skipping RecoverAllLocal()")
+			} else {
+				c.alertQoSErrors(ctx)
+				logger.Debug("auto-triggering RecoverAllLocal()")
+				if initialRecover {
+					c.resumeRecoverAllLocal(ctx)
+				} else {
+					c.RecoverAllLocal(ctx)
+				}
+			}
+			initialRecover = false
 			recoverTimer.Reset(c.config.PinRecoverInterval)
 		case <-c.ctx.Done():
 			if !stateSyncTimer.Stop() {
@@ -282,19 +384,28 @@ func (c *Cluster) watchPinset() {
 	}
 }
 
-// returns the smallest ttl from the metrics pushed by the informer.
-func (c *Cluster) sendInformerMetrics(ctx context.Context, informer Informer) (time.Duration, error) {
+// sendInformerMetrics publishes the metrics produced by the given informer,
+// in a single batch, and returns their minimum TTL. When an informerInterval
+// is given, the TTL of the metrics is set from the interval it chooses.
+func (c *Cluster) sendInformerMetrics(ctx context.Context, informer Informer, ival *informerInterval) (time.Duration, error) {
 	ctx, span := trace.StartSpan(ctx, "cluster/sendInformerMetric")
 	defer span.End()
 
 	var minTTL time.Duration
-	var errors error
 	metrics := informer.GetMetrics(ctx)
 	if len(metrics) == 0 {
 		logger.Errorf("informer %s produced no metrics", informer.Name())
 		return minTTL, nil
 	}
 
+	if ival != nil {
+		ttl := 2 * ival.next(metrics)
+		for _, metric := range metrics {
+			metric.SetTTL(ttl)
+		}
+	}
+
+	batch := make([]*api.Metric, 0, len(metrics))
 	for _, metric := range metrics {
 		if metric.Discard() { // do not publish invalid metrics
 			// the tags informer creates an invalid metric
@@ -306,13 +417,18 @@ func (c *Cluster) sendInformerMetrics(ctx context.Context, informer Informer) (t
 		if ttl > 0 && (ttl < minTTL || minTTL == 0) {
 			minTTL = ttl
 		}
-		err := c.monitor.PublishMetric(ctx, metric)
+		batch = append(batch, metric)
+	}
+	if len(batch) == 0 {
+		return minTTL, nil
+	}
 
-		if multierr.AppendInto(&errors, err) {
-			logger.Warnf("error sending metric %s: %s", metric.Name, err)
-		}
+	// All the metrics of the informer go in a single message.
+	err := c.monitor.PublishMetrics(ctx, batch)
+	if err != nil {
+		logger.Warnf("error sending the metrics of informer %s: %s", informer.Name(), err)
 	}
-	return minTTL, errors
+	return minTTL, err
 }
 
 func (c *Cluster) sendInformersMetrics(ctx context.Context) error {
@@ -321,7 +437,7 @@ func (c *Cluster) sendInformersMetrics(ctx context.Context) error {
 
 	var errors error
 	for _, informer := range c.informers {
-		_, err := c.sendInformerMetrics(ctx, informer)
+		_, err := c.sendInformerMetrics(ctx, informer, nil)
 		if multierr.AppendInto(&errors, err) {
 			logger.Warnf("informer %s did not send all metrics", informer.Name())
 		}
@@ -331,7 +447,9 @@ func (c *Cluster) sendInformersMetrics(ctx context.Context) error {
 
 // pushInformerMetrics loops and publishes informers metrics using the
 // cluster monitor. Metrics are pushed normally at a TTL/2 rate. If an error
-// occurs, they are pushed at a TTL/4 rate.
+// occurs, they are pushed at a TTL/4 rate. With AdaptiveInformerInterval,
+// the TTL is set to twice the interval chosen by an informerInterval, so
+// metrics are pushed at that interval.
 func (c *Cluster) pushInformerMetrics(ctx context.Context, informer Informer) {
 	ctx, span := trace.StartSpan(ctx, "cluster/pushInformerMetrics")
 	defer span.End()
@@ -346,6 +464,11 @@ func (c *Cluster) pushInformerMetrics(ctx context.Context, informer Informer) {
 	// 10th.
 	retryWarnMod := 10
 
+	var ival *informerInterval
+	if c.config.AdaptiveInformerInterval {
+		ival = newInformerInterval(c.config.InformerIntervalMin, c.config.InformerIntervalMax)
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -354,7 +477,7 @@ func (c *Cluster) pushInformerMetrics(ctx context.Context, informer Informer) {
 			// wait
 		}
 
-		minTTL, err := c.sendInformerMetrics(ctx, informer)
+		minTTL, err := c.sendInformerMetrics(ctx, informer, ival)
 		if minTTL == 0 {
 			minTTL = 30 * time.Second
 			logger.Warningf("informer %s reported a min metric ttl of 0s.", informer.Name())
@@ -382,9 +505,26 @@ func (c *Cluster) sendPingMetric(ctx context.Context) (*api.Metric, error) {
 	metric := &api.Metric{
 		Name:  pingMetricName,
 		Peer:  c.id,
+		Value: c.instanceID,
 		Valid: true,
 	}
 	metric.SetTTL(c.config.MonitorPingInterval * 2)
+	if !c.config.ReadOnly {
+		return metric, c.monitor.PublishMetric(ctx, metric)
+	}
+
+	// Read-only peers announce it with every ping, so that the
+	// announcement expires when they stop being read-only.
+	readOnly := &api.Metric{
+		Name:  readOnlyMetricName,
+		Peer:  c.id,
+		Value: "true",
+		Valid: true,
+	}
+	readOnly.SetTTL(c.config.MonitorPingInterval * 2)
+	if err := c.monitor.PublishMetric(ctx, readOnly); err != nil {
+		logger.Error(err)
+	}
 	return metric, c.monitor.PublishMetric(ctx, metric)
 }
 
@@ -425,6 +565,108 @@ func (c *Cluster) pushPingMetrics(ctx context.Context) {
 	}
 }
 
+// watchPings regularly inspects the latest ping metrics to take note of new
+// peers and to look for peers which are alternating between several
+// instance IDs.
+func (c *Cluster) watchPings(ctx context.Context) {
+	ctx, span := trace.StartSpan(ctx, "cluster/watchPings")
+	defer span.End()
+
+	// Check more often than pings are sent so that we have a chance
+	// to see the pings from every process using the same ID.
+	interval := c.config.MonitorPingInterval / 4
+	if interval < minWatchPingsInterval {
+		interval = minWatchPingsInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, m := range c.monitor.LatestMetrics(ctx, pingMetricName) {
+				c.peerSeen(m.Peer)
+				if c.detectDuplicatePeer(m) {
+					c.handleDuplicatePeer(ctx, m.Peer)
+				}
+			}
+		}
+	}
+}
+
+// peerSeen returns the time when we first saw the given peer, recording it
+// if this is the first time. Peers seen right after this peer started are
+// considered to be long-time members of the cluster and the zero time is
+// returned for them.
+func (c *Cluster) peerSeen(pid peer.ID) time.Time {
+	c.peersSeenMux.Lock()
+	defer c.peersSeenMux.Unlock()
+
+	t, ok := c.peersSeen[pid]
+	if ok {
+		return t
+	}
+	if time.Since(c.startTime) > 2*c.config.MonitorPingInterval {
+		t = time.Now()
+	}
+	c.peersSeen[pid] = t
+	return t
+}
+
+// detectDuplicatePeer records the instance ID carried by a ping metric and
+// returns true when the peer went back to an instance ID that had already
+// been replaced by a different one. A restarted peer changes its instance
+// ID once, while two processes sharing a peer ID keep alternating.
+func (c *Cluster) detectDuplicatePeer(m *api.Metric) bool {
+	if m.Peer == c.id || m.Value == "" {
+		return false
+	}
+
+	c.pingNoncesMux.Lock()
+	defer c.pingNoncesMux.Unlock()
+
+	nonces := c.pingNonces[m.Peer]
+	n := len(nonces)
+	switch {
+	case n > 0 && nonces[n-1] == m.Value:
+		return false
+	case n > 1 && nonces[n-2] == m.Value:
+		// start over so that we only complain again when
+		// the alternation persists.
+		delete(c.pingNonces, m.Peer)
+		return true
+	case n > 1:
+		nonces = nonces[1:]
+	}
+	c.pingNonces[m.Peer] = append(nonces, m.Value)
+	return false
+}
+
+// handleDuplicatePeer reacts to a duplicate peer ID according to
+// the DuplicatePeerAction configuration option.
+func (c *Cluster) handleDuplicatePeer(ctx context.Context, pid peer.ID) {
+	logger.Errorf(
+		"DUPLICATE PEER ID: several running peers are using the peer ID %s. "+
+			"This is a dangerous misconfiguration which can corrupt the shared state. "+
+			"Make sure every cluster peer uses a different identity.json.",
+		pid,
+	)
+	if c.config.reloadable().DuplicatePeerAction != DuplicatePeerIsolate {
+		return
+	}
+
+	logger.Warnf("isolating %s: disconnecting and removing it from the peerset", pid)
+	err := c.consensus.RmPeer(ctx, pid)
+	if err != nil {
+		logger.Warnf("could not remove %s from the peerset: %s", pid, err)
+	}
+	err = c.host.Network().ClosePeer(pid)
+	if err != nil {
+		logger.Warnf("error closing connections to %s: %s", pid, err)
+	}
+}
+
 // Alerts returns the last alerts recorded by this cluster peer with the most
 // recent first.
 func (c *Cluster) Alerts() []api.Alert {
@@ -441,6 +683,21 @@ func (c *Cluster) Alerts() []api.Alert {
 	return alerts
 }
 
+// recordAlert stores an alert so that it is returned by Alerts() and
+// forwards it to the alert sinks.
+func (c *Cluster) recordAlert(alrt *api.Alert) {
+	c.alertsMux.Lock()
+	if len(c.alerts) > maxAlerts {
+		c.alerts = c.alerts[:0]
+	}
+	c.alerts = append(c.alerts, *alrt)
+	c.alertsMux.Unlock()
+
+	for _, sink := range c.alertSinks {
+		sink.Alert(c.ctx, alrt)
+	}
+}
+
 // read the alerts channel from the monitor and triggers repins
 func (c *Cluster) alertsHandler() {
 	for {
@@ -450,52 +707,60 @@ func (c *Cluster) alertsHandler() {
 		case alrt := <-c.monitor.Alerts():
 			// Follower peers do not care about alerts.
 			// They can do nothing about them.
-			if c.config.FollowerMode {
+			if c.followerMode() {
 				continue
 			}
 
-			logger.Warnf("metric alert for %s: Peer: %s.", alrt.Name, alrt.Peer)
-			c.alertsMux.Lock()
-			{
-				if len(c.alerts) > maxAlerts {
-					c.alerts = c.alerts[:0]
+			if alrt.Recovered {
+				logger.Infof("metric %s recovered: Peer: %s.", alrt.Name, alrt.Peer)
+				c.recordAlert(alrt)
+				if alrt.Name == pingMetricName {
+					c.clearQoSAlerts(qosReplicaLostAlertName, alrt.Peer, nil)
 				}
-
-				c.alerts = append(c.alerts, *alrt)
+				continue
 			}
-			c.alertsMux.Unlock()
+
+			logger.Warnf("metric alert for %s: Peer: %s.", alrt.Name, alrt.Peer)
+			c.recordAlert(alrt)
 
 			if alrt.Name != pingMetricName {
 				continue // only handle ping alerts
 			}
 
-			if c.config.DisableRepinning {
+			if c.config.reloadable().DisableRepinning {
 				logger.Debugf("repinning is disabled. Will not re-allocate pins on alerts")
-				return
+				continue
+			}
+
+			if c.InMaintenance() {
+				logger.Infof("maintenance mode: not re-allocating pins from %s", alrt.Peer)
+				continue
 			}
 
 			cState, err := c.consensus.State(c.ctx)
 			if err != nil {
 				logger.Warn(err)
-				return
+				continue
 			}
 			list, err := cState.List(c.ctx)
 			if err != nil {
 				logger.Warn(err)
-				return
+				continue
 			}
 
 			distance, err := c.distances(c.ctx, alrt.Peer)
 			if err != nil {
 				logger.Warn(err)
-				return
+				continue
 			}
 
+			var pins []*api.Pin
 			for _, pin := range list {
 				if containsPeer(pin.Allocations, alrt.Peer) && distance.isClosest(pin.Cid) {
-					c.repinFromPeer(c.ctx, alrt.Peer, pin)
+					pins = append(pins, pin)
 				}
 			}
+			c.reallocateFromDownPeer(alrt.Peer, pins)
 		}
 	}
 }
@@ -562,7 +827,7 @@ func (c *Cluster) vacatePeer(ctx context.Context, p peer.ID) {
 	ctx, span := trace.StartSpan(ctx, "cluster/vacatePeer")
 	defer span.End()
 
-	if c.config.DisableRepinning {
+	if c.config.reloadable().DisableRepinning {
 		logger.Warnf("repinning is disabled. Will not re-allocate cids from %s", p.Pretty())
 		return
 	}
@@ -584,17 +849,101 @@ func (c *Cluster) vacatePeer(ctx context.Context, p peer.ID) {
 	}
 }
 
+// rebalancePeer re-allocates all the pins allocated to the given peer,
+// regardless of DisableRepinning, and waits until they are pinned on their
+// new allocations. It returns an error when any of them could not be moved,
+// or was not pinned within rebalanceTimeout. Moved pins are not allocated to
+// the peer anymore, so calling it again resumes the work.
+func (c *Cluster) rebalancePeer(ctx context.Context, p peer.ID) error {
+	ctx, span := trace.StartSpan(ctx, "cluster/rebalancePeer")
+	defer span.End()
+
+	cState, err := c.consensus.State(ctx)
+	if err != nil {
+		return err
+	}
+	list, err := cState.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	var moved []*api.Pin
+	failed := 0
+	for _, pin := range list {
+		if !containsPeer(pin.Allocations, p) {
+			continue
+		}
+		newPin, ok := c.repinFromPeer(ctx, p, pin)
+		if !ok {
+			failed++
+			continue
+		}
+		moved = append(moved, newPin)
+	}
+	logger.Infof("re-allocated %d pins away from %s", len(moved), p)
+	if failed > 0 {
+		return fmt.Errorf("%d pins could not be re-allocated away from %s: not removing it", failed, p)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, rebalanceTimeout)
+	defer cancel()
+	if pending := c.waitPinned(waitCtx, moved); pending > 0 {
+		return fmt.Errorf("%d pins re-allocated away from %s are not pinned yet: not removing it", pending, p)
+	}
+	return nil
+}
+
+// waitPinned waits until the given pins are pinned on all their allocations
+// and returns how many were not when the context is done. Only the status of
+// the pins still pending is checked.
+func (c *Cluster) waitPinned(ctx context.Context, pins []*api.Pin) int {
+	pending := make(map[cid.Cid]*api.Pin, len(pins))
+	for _, pin := range pins {
+		pending[pin.Cid] = pin
+	}
+
+	ticker := time.NewTicker(rebalanceCheckInterval)
+	defer ticker.Stop()
+	for len(pending) > 0 {
+		cids := make([]cid.Cid, 0, len(pending))
+		for ci := range pending {
+			cids = append(cids, ci)
+		}
+		gpis, err := c.StatusCids(ctx, cids)
+		if err != nil {
+			logger.Warnf("checking the status of re-allocated pins: %s", err)
+		}
+		for _, gpi := range gpis {
+			pin, ok := pending[gpi.Cid]
+			if ok && gpi.Replication(pin.Allocations).Complete() {
+				delete(pending, gpi.Cid)
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return len(pending)
+		case <-ticker.C:
+		}
+	}
+	return 0
+}
+
 // repinFromPeer triggers a repin on a given pin object blacklisting one of the
 // allocations.
-func (c *Cluster) repinFromPeer(ctx context.Context, p peer.ID, pin *api.Pin) {
+func (c *Cluster) repinFromPeer(ctx context.Context, p peer.ID, pin *api.Pin) (*api.Pin, bool) {
 	ctx, span := trace.StartSpan(ctx, "cluster/repinFromPeer")
 	defer span.End()
 
 	pin.Allocations = nil // force re-allocations
-	_, ok, err := c.pin(ctx, pin, []peer.ID{p})
+	newPin, ok, err := c.pin(ctx, pin, []peer.ID{p})
 	if ok && err == nil {
 		logger.Infof("repinned %s out of %s", pin.Cid, p.Pretty())
+		return newPin, true
 	}
+	return newPin, false
 }
 
 // run launches some go-routines which live throughout the cluster's life
@@ -611,6 +960,60 @@ func (c *Cluster) run() {
 		c.pushPingMetrics(c.ctx)
 	}()
 
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.watchPings(c.ctx)
+	}()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.watchReallocations()
+	}()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.watchCommits()
+	}()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.watchSplitBrain()
+	}()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.watchScrub()
+	}()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.watchIPNS()
+	}()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.watchMFS()
+	}()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.watchReprovide()
+	}()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.watchTombstones()
+	}()
+
 	c.wg.Add(len(c.informers))
 	for _, informer := range c.informers {
 		go func(inf Informer) {
@@ -747,13 +1150,15 @@ func (c *Cluster) Shutdown(ctx context.Context) error {
 	// - We are not removed already (means watchPeers() called us)
 	if c.consensus != nil && c.config.LeaveOnShutdown && c.readyB && !c.removed {
 		c.removed = true
-		_, err := c.consensus.Peers(ctx)
+		members, err := c.consensus.Peers(ctx)
 		if err == nil {
 			// best effort
 			logger.Warn("attempting to leave the cluster. This may take some seconds")
 			err := c.consensus.RmPeer(ctx, c.id)
 			if err != nil {
 				logger.Error("leaving cluster: " + err.Error())
+			} else {
+				c.announcePeerLeft(ctx, members, c.id)
 			}
 		}
 	}
@@ -803,6 +1208,13 @@ func (c *Cluster) Shutdown(ctx context.Context) error {
 		}
 	}
 
+	for _, sink := range c.alertSinks {
+		if err := sink.Shutdown(ctx); err != nil {
+			logger.Errorf("error stopping alert sink: %s", err)
+			return err
+		}
+	}
+
 	if err := c.tracer.Shutdown(ctx); err != nil {
 		logger.Errorf("error stopping Tracer: %s", err)
 		return err
@@ -845,10 +1257,15 @@ func (c *Cluster) ID(ctx context.Context) *api.ID {
 	}
 
 	peers := []peer.ID{}
+	var leader peer.ID
+	var leaderless bool
 	// This method might get called very early by a remote peer
 	// and might catch us when consensus is not set
 	if c.consensus != nil {
 		peers, _ = c.consensus.Peers(ctx)
+		l, lerr := c.consensus.Leader(ctx)
+		leader = l
+		leaderless = errors.Is(lerr, api.ErrLeaderless)
 	}
 
 	clusterPeerInfos := c.peerManager.PeerInfos(peers)
@@ -873,6 +1290,15 @@ func (c *Cluster) ID(ctx context.Context) *api.ID {
 		RPCProtocolVersion:    version.RPCProtocol,
 		IPFS:                  ipfsID,
 		Peername:              c.config.Peername,
+		Maintenance:           c.InMaintenance(),
+		Leader:                leader,
+		Leaderless:            leaderless,
+		WriteHint:             leader,
+	}
+	if hintMetric := c.config.reloadable().WriteHintMetric; leaderless && hintMetric != "" && c.monitor != nil {
+		metrics := c.monitor.LatestMetrics(ctx, hintMetric)
+		id.WriteHint = writeHint(metrics)
+		id.WriteWeights = writeWeights(metrics)
 	}
 	if err != nil {
 		id.Error = err.Error()
@@ -881,6 +1307,51 @@ func (c *Cluster) ID(ctx context.Context) *api.ID {
 	return id
 }
 
+// Health returns the health of this peer: whether IPFS and consensus work
+// and how many peers in the peerset have stopped sending pings, rolled up
+// in an overall status.
+func (c *Cluster) Health(ctx context.Context) *api.Health {
+	_, span := trace.StartSpan(ctx, "cluster/Health")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	h := &api.Health{Peer: c.id}
+
+	if _, err := c.ipfs.ID(ctx); err != nil {
+		h.IPFSError = err.Error()
+	}
+
+	// the peer becomes ready once consensus is.
+	select {
+	case <-c.readyCh:
+		peers, err := c.consensus.Peers(ctx)
+		if err != nil {
+			h.ConsensusError = err.Error()
+			break
+		}
+		alive := make(map[peer.ID]struct{})
+		for _, m := range c.monitor.LatestMetrics(ctx, pingMetricName) {
+			alive[m.Peer] = struct{}{}
+		}
+		for _, p := range peers {
+			if _, ok := alive[p]; !ok {
+				h.AlertingPeers++
+			}
+		}
+	default:
+		h.ConsensusError = "consensus is not ready"
+	}
+
+	// Not all consensus components have a leader.
+	if leader, err := c.consensus.Leader(ctx); err == nil {
+		h.Leader = leader
+		h.IsLeader = leader == c.id
+	}
+
+	h.Rollup()
+	return h
+}
+
 // PeerAdd adds a new peer to this Cluster.
 //
 // For it to work well, the new peer should be discoverable
@@ -931,20 +1402,77 @@ func (c *Cluster) PeerRemove(ctx context.Context, pid peer.ID) error {
 	defer span.End()
 	ctx = trace.NewContext(c.ctx, span)
 
-	// We need to repin before removing the peer, otherwise, it won't
-	// be able to submit the pins.
-	logger.Infof("re-allocating all CIDs directly associated to %s", pid)
-	c.vacatePeer(ctx, pid)
+	if c.config.RebalanceOnPeerRemoval {
+		// Let a single peer move the pins, the leader when there is
+		// one.
+		leader, err := c.consensus.Leader(ctx)
+		if err == nil && leader != c.id && leader != pid {
+			logger.Infof("forwarding the removal of %s to the leader %s", pid, leader)
+			return c.rpcClient.CallContext(
+				ctx,
+				leader,
+				"Cluster",
+				"PeerRemove",
+				pid,
+				&struct{}{},
+			)
+		}
 
-	err := c.consensus.RmPeer(ctx, pid)
+		logger.Infof("re-allocating all CIDs directly associated to %s", pid)
+		if err := c.rebalancePeer(ctx, pid); err != nil {
+			logger.Error(err)
+			return err
+		}
+	} else {
+		// We need to repin before removing the peer, otherwise, it won't
+		// be able to submit the pins.
+		logger.Infof("re-allocating all CIDs directly associated to %s", pid)
+		c.vacatePeer(ctx, pid)
+	}
+
+	// The peers to tell, before the removed one is gone from the
+	// peerset.
+	members, err := c.consensus.Peers(ctx)
+	if err != nil {
+		logger.Error(err)
+	}
+
+	err = c.consensus.RmPeer(ctx, pid)
 	if err != nil {
 		logger.Error(err)
 		return err
 	}
+	c.announcePeerLeft(ctx, members, pid)
 	logger.Info("Peer removed ", pid.Pretty())
 	return nil
 }
 
+// announcePeerLeft informs the peer monitors of the given cluster members
+// that a peer has left, so that its metrics stop being used right away.
+func (c *Cluster) announcePeerLeft(ctx context.Context, members []peer.ID, pid peer.ID) {
+	ctx, span := trace.StartSpan(ctx, "cluster/announcePeerLeft")
+	defer span.End()
+
+	lenMembers := len(members)
+
+	ctxs, cancels := rpcutil.CtxsWithTimeout(ctx, lenMembers, 15*time.Second)
+	defer rpcutil.MultiCancel(cancels)
+
+	errs := c.rpcClient.MultiCall(
+		ctxs,
+		members,
+		"PeerMonitor",
+		"PeerLeft",
+		pid,
+		rpcutil.RPCDiscardReplies(lenMembers),
+	)
+	for i, err := range errs {
+		if err != nil && !rpc.IsAuthorizationError(err) {
+			logger.Warnf("error announcing that %s left to %s: %s", pid, members[i], err)
+		}
+	}
+}
+
 // Join adds this peer to an existing cluster by bootstrapping to a
 // given multiaddress. It works by calling PeerAdd on the destination
 // cluster and making sure that the new peer is ready to discover and contact
@@ -982,6 +1510,22 @@ func (c *Cluster) Join(ctx context.Context, addr ma.Multiaddr) error {
 		return err
 	}
 
+	// Follow the maintenance mode of the cluster we join.
+	var remoteID api.ID
+	err = c.rpcClient.CallContext(
+		ctx,
+		pid,
+		"Cluster",
+		"ID",
+		struct{}{},
+		&remoteID,
+	)
+	if err != nil {
+		logger.Warn(err)
+	} else {
+		c.SetMaintenanceLocal(ctx, remoteID.Maintenance)
+	}
+
 	// Log a fake but valid metric from the peer we are
 	// contacting. This will signal a CRDT component that
 	// we know that peer since we have metrics for it without
@@ -1079,19 +1623,26 @@ func (c *Cluster) StateSync(ctx context.Context) error {
 	defer span.End()
 	ctx = trace.NewContext(c.ctx, span)
 
-	if c.config.FollowerMode {
-		return nil
+	_, err := c.stateSync(ctx)
+	return err
+}
+
+// stateSync performs the StateSync tasks and returns the expired items it
+// unpinned.
+func (c *Cluster) stateSync(ctx context.Context) ([]cid.Cid, error) {
+	if c.followerMode() {
+		return nil, nil
 	}
 
 	cState, err := c.consensus.State(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	timeNow := time.Now()
 	clusterPins, err := cState.List(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Only trigger pin operations if we are the closest with respect to
@@ -1100,20 +1651,23 @@ func (c *Cluster) StateSync(ctx context.Context) error {
 	// is a way to assume the opposite and skip this completely.
 	distance, err := c.distances(ctx, "")
 	if err != nil {
-		return err // could not list peers
+		return nil, err // could not list peers
 	}
 
 	// Unpin expired items when we are the closest peer to them.
+	var expired []cid.Cid
 	for _, p := range clusterPins {
 		if p.ExpiredAt(timeNow) && distance.isClosest(p.Cid) {
 			logger.Infof("Unpinning %s: pin expired at %s", p.Cid, p.ExpireAt)
 			if _, err := c.Unpin(ctx, p.Cid); err != nil {
 				logger.Error(err)
+				continue
 			}
+			expired = append(expired, p.Cid)
 		}
 	}
 
-	return nil
+	return expired, nil
 }
 
 // StatusAll returns the GlobalPinInfo for all tracked Cids in all peers.
@@ -1127,13 +1681,65 @@ func (c *Cluster) StatusAll(ctx context.Context, filter api.TrackerStatus) ([]*a
 	return c.globalPinInfoSlice(ctx, "PinTracker", "StatusAll", filter)
 }
 
-// StatusAllLocal returns the PinInfo for all the tracked Cids in this peer.
-func (c *Cluster) StatusAllLocal(ctx context.Context, filter api.TrackerStatus) []*api.PinInfo {
-	_, span := trace.StartSpan(ctx, "cluster/StatusAllLocal")
+// PinReceipt returns a receipt, signed with this peer's key, stating that
+// the given Cid is pinned on all its allocations at the current time. It
+// fails when it is not.
+func (c *Cluster) PinReceipt(ctx context.Context, h cid.Cid) (*api.PinReceipt, error) {
+	_, span := trace.StartSpan(ctx, "cluster/PinReceipt")
 	defer span.End()
 	ctx = trace.NewContext(c.ctx, span)
 
-	return c.tracker.StatusAll(ctx, filter)
+	pin, err := c.PinGet(ctx, h)
+	if err != nil {
+		return nil, err
+	}
+	gpi, err := c.Status(ctx, h)
+	if err != nil {
+		return nil, err
+	}
+	if !pinCommitted(pin.Allocations, gpi) {
+		return nil, fmt.Errorf("%w: %s is not pinned on all its allocations", api.ErrUnderReplicated, h)
+	}
+
+	peers := pin.Allocations
+	if len(peers) == 0 { // pin everywhere
+		for pid := range gpi.PeerMap {
+			p, err := peer.Decode(pid)
+			if err != nil {
+				return nil, err
+			}
+			peers = append(peers, p)
+		}
+	}
+
+	key := c.host.Peerstore().PrivKey(c.host.ID())
+	if key == nil {
+		return nil, errors.New("cannot sign receipts without a private key")
+	}
+	return api.NewPinReceipt(h, peers, time.Now(), key)
+}
+
+// VerifyReceipt checks that the given receipt is valid and was signed by a
+// current cluster peer.
+func (c *Cluster) VerifyReceipt(ctx context.Context, r *api.PinReceipt) error {
+	_, span := trace.StartSpan(ctx, "cluster/VerifyReceipt")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	peers, err := c.consensus.Peers(ctx)
+	if err != nil {
+		return err
+	}
+	return r.Verify(peers)
+}
+
+// StatusAllLocal returns the PinInfo for all the tracked Cids in this peer.
+func (c *Cluster) StatusAllLocal(ctx context.Context, filter api.TrackerStatus) []*api.PinInfo {
+	_, span := trace.StartSpan(ctx, "cluster/StatusAllLocal")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	return c.tracker.StatusAll(ctx, filter)
 }
 
 // Status returns the GlobalPinInfo for a given Cid as fetched from all
@@ -1144,7 +1750,48 @@ func (c *Cluster) Status(ctx context.Context, h cid.Cid) (*api.GlobalPinInfo, er
 	defer span.End()
 	ctx = trace.NewContext(c.ctx, span)
 
-	return c.globalPinInfoCid(ctx, "PinTracker", "Status", h)
+	return c.globalPinInfoCid(ctx, "PinTracker", "Status", h, globalPinInfoTimeout)
+}
+
+// StatusCids returns the GlobalPinInfo for each of the given Cids, in the
+// same order, with a single request to every peer instead of one per Cid.
+// Cids which are not in the pinset are reported unpinned, like Status does.
+func (c *Cluster) StatusCids(ctx context.Context, cids []cid.Cid) ([]*api.GlobalPinInfo, error) {
+	_, span := trace.StartSpan(ctx, "cluster/StatusCids")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	unique := make([]cid.Cid, 0, len(cids))
+	seen := make(map[cid.Cid]struct{}, len(cids))
+	for _, ci := range cids {
+		if _, ok := seen[ci]; ok {
+			continue
+		}
+		seen[ci] = struct{}{}
+		unique = append(unique, ci)
+	}
+
+	infos, err := c.globalPinInfoSlice(ctx, "PinTracker", "StatusCids", unique)
+	if err != nil {
+		return nil, err
+	}
+	byCid := make(map[cid.Cid]*api.GlobalPinInfo, len(infos))
+	for _, gpi := range infos {
+		byCid[gpi.Cid] = gpi
+	}
+
+	result := make([]*api.GlobalPinInfo, len(cids))
+	for i, ci := range cids {
+		gpi, ok := byCid[ci]
+		if !ok { // no peer answered
+			gpi = &api.GlobalPinInfo{
+				Cid:     ci,
+				PeerMap: make(map[string]*api.PinInfoShort),
+			}
+		}
+		result[i] = gpi
+	}
+	return result, nil
 }
 
 // StatusLocal returns this peer's PinInfo for a given Cid.
@@ -1156,6 +1803,123 @@ func (c *Cluster) StatusLocal(ctx context.Context, h cid.Cid) *api.PinInfo {
 	return c.tracker.Status(ctx, h)
 }
 
+// BlockHolders asks the IPFS daemons of the cluster peers whether they
+// have the root block of the given CID, and returns the peers that
+// confirmed it. Unlike Status, which reports on what the pin trackers
+// intend, this checks what is actually present. When all is false, only the
+// peers allocated to the pin are asked. Otherwise, every cluster peer is.
+func (c *Cluster) BlockHolders(ctx context.Context, h cid.Cid, all bool) ([]peer.ID, error) {
+	_, span := trace.StartSpan(ctx, "cluster/BlockHolders")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	var dests []peer.ID
+	switch {
+	case c.followerMode():
+		dests = []peer.ID{c.host.ID()}
+	case !all:
+		pin, err := c.PinGet(ctx, h)
+		if err != nil {
+			return nil, err
+		}
+		if !pin.IsPinEverywhere() {
+			dests = pin.Allocations
+			break
+		}
+		fallthrough
+	default:
+		members, err := c.consensus.Peers(ctx)
+		if err != nil {
+			logger.Error(err)
+			return nil, err
+		}
+		dests = members
+	}
+	return c.blockHolders(ctx, h, dests), nil
+}
+
+// blockHolders asks the IPFS daemons of the given peers whether they have
+// the root block of the given CID and returns those that confirmed it.
+func (c *Cluster) blockHolders(ctx context.Context, h cid.Cid, dests []peer.ID) []peer.ID {
+	lenDests := len(dests)
+	replies := make([]bool, lenDests)
+	ifaceReplies := make([]interface{}, lenDests)
+	for i := range replies {
+		ifaceReplies[i] = &replies[i]
+	}
+
+	timeout := 15 * time.Second
+	ctxs, cancels := rpcutil.CtxsWithTimeout(ctx, lenDests, timeout)
+	defer rpcutil.MultiCancel(cancels)
+
+	errs := c.rpcClient.MultiCall(
+		ctxs,
+		dests,
+		"IPFSConnector",
+		"BlockHas",
+		h,
+		ifaceReplies,
+	)
+
+	holders := []peer.ID{}
+	for i, has := range replies {
+		if e := errs[i]; e != nil {
+			logger.Warnf("error checking %s on %s: %s", h, dests[i], e)
+			continue
+		}
+		if has {
+			holders = append(holders, dests[i])
+		}
+	}
+	return holders
+}
+
+// SLABreaches returns, from all the peers, the pins which were pinned after
+// their deadline or which are not pinned yet and their deadline has passed.
+// Peers which cannot be contacted are ignored.
+func (c *Cluster) SLABreaches(ctx context.Context) ([]*api.PinSLABreach, error) {
+	_, span := trace.StartSpan(ctx, "cluster/SLABreaches")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	members, err := c.consensus.Peers(ctx)
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	lenMembers := len(members)
+	replies := make([][]*api.PinSLABreach, lenMembers)
+	ifaceReplies := make([]interface{}, lenMembers)
+	for i := range replies {
+		ifaceReplies[i] = &replies[i]
+	}
+
+	ctxs, cancels := rpcutil.CtxsWithTimeout(ctx, lenMembers, 15*time.Second)
+	defer rpcutil.MultiCancel(cancels)
+
+	errs := c.rpcClient.MultiCall(
+		ctxs,
+		members,
+		"PinTracker",
+		"SLABreaches",
+		struct{}{},
+		ifaceReplies,
+	)
+
+	breaches := []*api.PinSLABreach{}
+	for i, r := range replies {
+		if e := errs[i]; e != nil {
+			if !rpc.IsAuthorizationError(e) {
+				logger.Warnf("error getting the SLA breaches of %s: %s", members[i], e)
+			}
+			continue
+		}
+		breaches = append(breaches, r...)
+	}
+	return breaches, nil
+}
+
 // used for RecoverLocal and SyncLocal.
 func (c *Cluster) localPinInfoOp(
 	ctx context.Context,
@@ -1207,6 +1971,27 @@ func (c *Cluster) RecoverAllLocal(ctx context.Context) ([]*api.PinInfo, error) {
 	return c.tracker.RecoverAll(ctx)
 }
 
+// resumableRecoverer is implemented by the pin trackers which can resume, on
+// start, a RecoverAll pass interrupted by a restart, like the stateless
+// tracker.
+type resumableRecoverer interface {
+	ResumeRecoverAll(ctx context.Context) ([]*api.PinInfo, error)
+}
+
+// resumeRecoverAllLocal runs the recover pass done when the peer starts,
+// resuming the previous one when the tracker supports it.
+func (c *Cluster) resumeRecoverAllLocal(ctx context.Context) ([]*api.PinInfo, error) {
+	r, ok := c.tracker.(resumableRecoverer)
+	if !ok {
+		return c.RecoverAllLocal(ctx)
+	}
+	_, span := trace.StartSpan(ctx, "cluster/resumeRecoverAllLocal")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	return r.ResumeRecoverAll(ctx)
+}
+
 // Recover triggers a recover operation for a given Cid in all
 // cluster peers.
 //
@@ -1218,7 +2003,7 @@ func (c *Cluster) Recover(ctx context.Context, h cid.Cid) (*api.GlobalPinInfo, e
 	defer span.End()
 	ctx = trace.NewContext(c.ctx, span)
 
-	return c.globalPinInfoCid(ctx, "PinTracker", "Recover", h)
+	return c.globalPinInfoCid(ctx, "PinTracker", "Recover", h, globalPinInfoTimeout)
 }
 
 // RecoverLocal triggers a recover operation for a given Cid in this peer only.
@@ -1252,6 +2037,21 @@ func (c *Cluster) Pins(ctx context.Context) ([]*api.Pin, error) {
 	return cState.List(ctx)
 }
 
+// PinsLinearizable is like Pins, but the list reflects every pin and unpin
+// committed before the call, even when it is not up to date on this peer.
+func (c *Cluster) PinsLinearizable(ctx context.Context) ([]*api.Pin, error) {
+	_, span := trace.StartSpan(ctx, "cluster/PinsLinearizable")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	cState, err := c.consensus.GetLinearizable(ctx)
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+	return cState.List(ctx)
+}
+
 // PinGet returns information for a single Cid managed by Cluster.
 // The information is obtained from the current global state. The
 // returned api.Pin provides information about the allocations
@@ -1274,6 +2074,21 @@ func (c *Cluster) PinGet(ctx context.Context, h cid.Cid) (*api.Pin, error) {
 	return pin, nil
 }
 
+// PinGetLinearizable is like PinGet, but the returned pin reflects every
+// update committed before the call, even when it is not up to date on this
+// peer.
+func (c *Cluster) PinGetLinearizable(ctx context.Context, h cid.Cid) (*api.Pin, error) {
+	_, span := trace.StartSpan(ctx, "cluster/PinGetLinearizable")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	st, err := c.consensus.GetLinearizable(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return st.Get(ctx, h)
+}
+
 // Pin makes the cluster Pin a Cid. This implies adding the Cid
 // to the IPFS Cluster peers shared-state. Depending on the cluster
 // pinning strategy, the PinTracker may then request the IPFS daemon
@@ -1284,38 +2099,41 @@ func (c *Cluster) PinGet(ctx context.Context, h cid.Cid) (*api.Pin, error) {
 // not reflect the success or failure of underlying IPFS daemon pinning
 // operations which happen in async fashion.
 //
-// If the options UserAllocations are non-empty then these peers are pinned
-// with priority over other peers in the cluster.  If the max repl factor is
-// less than the size of the specified peerset then peers are chosen from this
-// set in allocation order.  If the minimum repl factor is greater than the
-// size of this set then the remaining peers are allocated in order from the
-// rest of the cluster. Priority allocations are best effort. If any priority
-// peers are unavailable then Pin will simply allocate from the rest of the
-// cluster.
+// If the options UserAllocations are non-empty then the pin is allocated to
+// exactly these peers, without consulting the allocator, and its replication
+// factors are set to their number. They must all be cluster peers, and
+// none of them can be read-only.
 //
 // If the Update option is set, the pin options (including allocations) will
 // be copied from an existing one. This is equivalent to running PinUpdate.
+//
+// If the DryRun option is set, Pin returns the pin with the allocations it
+// would have, but does not commit it to the shared state.
 func (c *Cluster) Pin(ctx context.Context, h cid.Cid, opts api.PinOptions) (*api.Pin, error) {
 	_, span := trace.StartSpan(ctx, "cluster/Pin")
 	defer span.End()
 
-	ctx = trace.NewContext(c.ctx, span)
+	ctx = api.CopyClientIdentity(trace.NewContext(c.ctx, span), ctx)
 	pin := api.PinWithOpts(h, opts)
 
-	result, _, err := c.pin(ctx, pin, []peer.ID{})
+	result, changed, err := c.pin(ctx, pin, []peer.ID{})
+	if err == nil && changed {
+		c.watchCommit(result)
+	}
 	return result, err
 }
 
 // sets the default replication factor in a pin when it's set to 0
 func (c *Cluster) setupReplicationFactor(pin *api.Pin) error {
+	opts := c.config.reloadable()
 	rplMin := pin.ReplicationFactorMin
 	rplMax := pin.ReplicationFactorMax
 	if rplMin == 0 {
-		rplMin = c.config.ReplicationFactorMin
+		rplMin = opts.ReplicationFactorMin
 		pin.ReplicationFactorMin = rplMin
 	}
 	if rplMax == 0 {
-		rplMax = c.config.ReplicationFactorMax
+		rplMax = opts.ReplicationFactorMax
 		pin.ReplicationFactorMax = rplMax
 	}
 
@@ -1380,16 +2198,60 @@ func (c *Cluster) setupPin(ctx context.Context, pin, existing *api.Pin) error {
 	// Set the Pin timestamp to now(). This is not an user-controllable
 	// "option".
 	pin.Timestamp = time.Now()
+	if existing != nil {
+		pin.CreatedAt = existing.CreatedAt
+	} else {
+		pin.CreatedAt = pin.Timestamp
+	}
 
 	err := c.setupReplicationFactor(pin)
 	if err != nil {
 		return err
 	}
 
+	// Pins replicated everywhere are allocated to every peer, so there
+	// is nothing to place.
+	if pin.Placement != "" && pin.IsPinEverywhere() {
+		return errors.New("placement rules cannot be used with a replication factor of -1")
+	}
+
+	err = c.setupUserAllocations(ctx, pin)
+	if err != nil {
+		return err
+	}
+
 	if !pin.ExpireAt.IsZero() && pin.ExpireAt.Before(time.Now()) {
 		return errors.New("pin.ExpireAt set before current time")
 	}
 
+	err = checkExcludeLinks(pin)
+	if err != nil {
+		return err
+	}
+
+	err = c.checkPinDependency(ctx, pin)
+	if err != nil {
+		return err
+	}
+
+	// Internal pins (i.e. shards) carry the metadata of the item they are
+	// part of, which was checked already. Pins whose metadata does not
+	// change are not checked again, so that those created before the
+	// schema can still be re-allocated and followed.
+	metaChanged := existing == nil || !metadataEqual(existing.Metadata, pin.Metadata)
+	if metaChanged && (pin.Type == api.DataType || pin.Type == api.MetaType) {
+		if err := c.config.reloadable().MetadataSchema.Check(pin.Metadata); err != nil {
+			return err
+		}
+	}
+
+	// Pins keep their QoS class even when it is no longer defined.
+	if pin.QoSClass != "" && (existing == nil || existing.QoSClass != pin.QoSClass) {
+		if _, ok := c.config.QoSClasses[pin.QoSClass]; !ok {
+			return fmt.Errorf("unknown QoS class: %s", pin.QoSClass)
+		}
+	}
+
 	if existing == nil {
 		return nil
 	}
@@ -1411,10 +2273,61 @@ func (c *Cluster) setupPin(ctx context.Context, pin, existing *api.Pin) error {
 	return checkPinType(pin)
 }
 
+// checkExcludeLinks verifies that links are only excluded from recursive
+// pins and that the given patterns are valid.
+func checkExcludeLinks(pin *api.Pin) error {
+	if len(pin.ExcludeLinks) == 0 {
+		return nil
+	}
+	if pin.Type != api.DataType || pin.MaxDepth >= 0 {
+		return errors.New("links can only be excluded from recursive pins")
+	}
+	for _, pattern := range pin.ExcludeLinks {
+		if err := api.ValidateLinkPattern(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPinDependency verifies that the item a pin depends on, if any, is
+// part of the pinset and that following the chain of dependencies does not
+// lead back to the pin itself.
+func (c *Cluster) checkPinDependency(ctx context.Context, pin *api.Pin) error {
+	dep := pin.DependsOn
+	if dep == cid.Undef {
+		return nil
+	}
+
+	seen := make(map[cid.Cid]struct{})
+	for dep != cid.Undef {
+		if dep.Equals(pin.Cid) {
+			return fmt.Errorf("cyclic dependency: %s depends on itself", pin.Cid)
+		}
+		if _, ok := seen[dep]; ok {
+			return nil
+		}
+		seen[dep] = struct{}{}
+
+		depPin, err := c.PinGet(ctx, dep)
+		if err == state.ErrNotFound {
+			if dep.Equals(pin.DependsOn) {
+				return fmt.Errorf("dependency %s is not in the pinset", dep)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		dep = depPin.DependsOn
+	}
+	return nil
+}
+
 // pin performs the actual pinning and supports a blacklist to be able to
 // evacuate a node and returns the pin object that it tried to pin, whether
-// the pin was submitted to the consensus layer or skipped (due to error or to
-// the fact that it was already valid) and error.
+// the pin was submitted to the consensus layer or skipped (due to error, to
+// a dry-run or to the fact that it was already valid) and error.
 //
 // This is the method called by the Cluster.Pin RPC endpoint.
 func (c *Cluster) pin(
@@ -1425,7 +2338,7 @@ func (c *Cluster) pin(
 	ctx, span := trace.StartSpan(ctx, "cluster/pin")
 	defer span.End()
 
-	if c.config.FollowerMode {
+	if c.followerMode() {
 		return nil, false, errFollowerMode
 	}
 
@@ -1433,16 +2346,23 @@ func (c *Cluster) pin(
 		return pin, false, errors.New("bad pin object")
 	}
 
-	// Handle pin updates when the option is set
-	if update := pin.PinUpdate; update != cid.Undef && !update.Equals(pin.Cid) {
-		pin, err := c.PinUpdate(ctx, update, pin.Cid, pin.PinOptions)
-		return pin, true, err
-	}
+	// The pin may be replaced by the existing one below.
+	dryRun := pin.DryRun
 
 	existing, err := c.PinGet(ctx, pin.Cid)
 	if err != nil && err != state.ErrNotFound {
 		return pin, false, err
 	}
+	if err := c.checkPinOwner(ctx, existing); err != nil {
+		return pin, false, err
+	}
+	c.setPinOwner(ctx, pin, existing)
+
+	// Handle pin updates when the option is set
+	if update := pin.PinUpdate; update != cid.Undef && !update.Equals(pin.Cid) {
+		pin, err := c.PinUpdate(ctx, update, pin.Cid, pin.PinOptions)
+		return pin, !dryRun, err
+	}
 
 	// setup pin might produce some side-effects to our pin
 	err = c.setupPin(ctx, pin, existing)
@@ -1450,6 +2370,9 @@ func (c *Cluster) pin(
 		return pin, false, err
 	}
 	if pin.Type == api.MetaType {
+		if dryRun {
+			return pin, false, nil
+		}
 		return pin, true, c.consensus.LogPin(ctx, pin)
 	}
 
@@ -1460,6 +2383,8 @@ func (c *Cluster) pin(
 	// without having to use recover, which is naturally expected.
 	if existing != nil &&
 		pin.PinOptions.Equals(&existing.PinOptions) &&
+		pin.IPNSName == existing.IPNSName &&
+		pin.MFSPath == existing.MFSPath &&
 		len(blacklist) == 0 {
 		pin = existing
 	}
@@ -1471,21 +2396,45 @@ func (c *Cluster) pin(
 	// allocate() will check which peers are currently allocated
 	// and try to respect them.
 	if len(pin.Allocations) == 0 {
-		// If replication factor is -1, this will return empty
-		// allocations.
-		allocs, err := c.allocate(
-			ctx,
-			pin.Cid,
-			existing,
-			pin.ReplicationFactorMin,
-			pin.ReplicationFactorMax,
-			blacklist,
-			pin.UserAllocations,
-		)
-		if err != nil {
-			return pin, false, err
+		if c.config.reloadable().CapacityAdmission && existing == nil {
+			if err := c.checkCapacity(ctx, pin); err != nil {
+				return pin, false, err
+			}
+		}
+
+		if len(pin.UserAllocations) > 0 {
+			// Validated by setupPin.
+			err := c.checkUserAllocations(ctx, pin.UserAllocations, blacklist)
+			if err != nil {
+				return pin, false, err
+			}
+			pin.Allocations = pin.UserAllocations
+		} else {
+			// If replication factor is -1, this will return empty
+			// allocations.
+			allocs, err := c.allocate(
+				ctx,
+				pin.Cid,
+				existing,
+				pin.ReplicationFactorMin,
+				pin.ReplicationFactorMax,
+				blacklist,
+				nil,
+				pin.EffectivePlacement(),
+				dryRun,
+			)
+			if err != nil {
+				return pin, false, err
+			}
+			pin.Allocations = allocs
+			setUnderReplicatedMeta(pin)
 		}
-		pin.Allocations = allocs
+	}
+
+	if dryRun {
+		logger.Infof("dry-run: %s would be pinned on %s", pin.Cid, pin.Allocations)
+		pin.DryRun = true
+		return pin, false, nil
 	}
 
 	// If this is true, replication factor should be -1.
@@ -1505,11 +2454,17 @@ func (c *Cluster) pin(
 // Unpin does not reflect the success or failure of underlying IPFS daemon
 // unpinning operations, which happen in async fashion.
 func (c *Cluster) Unpin(ctx context.Context, h cid.Cid) (*api.Pin, error) {
+	return c.unpin(ctx, h, "")
+}
+
+// unpin performs Unpin, recording the given API client identity, when
+// known, as the one which requested the unpin in the tombstone of the item.
+func (c *Cluster) unpin(ctx context.Context, h cid.Cid, unpinnedBy string) (*api.Pin, error) {
 	_, span := trace.StartSpan(ctx, "cluster/Unpin")
 	defer span.End()
-	ctx = trace.NewContext(c.ctx, span)
+	ctx = api.CopyClientIdentity(trace.NewContext(c.ctx, span), ctx)
 
-	if c.config.FollowerMode {
+	if c.followerMode() {
 		return nil, errFollowerMode
 	}
 
@@ -1518,10 +2473,12 @@ func (c *Cluster) Unpin(ctx context.Context, h cid.Cid) (*api.Pin, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := c.checkPinOwner(ctx, pin); err != nil {
+		return nil, err
+	}
 
 	switch pin.Type {
 	case api.DataType:
-		return pin, c.consensus.LogUnpin(ctx, pin)
 	case api.ShardType:
 		err := "cannot unpin a shard directly. Unpin content root CID instead"
 		return pin, errors.New(err)
@@ -1531,13 +2488,103 @@ func (c *Cluster) Unpin(ctx context.Context, h cid.Cid) (*api.Pin, error) {
 		if err != nil {
 			return pin, err
 		}
-		return pin, c.consensus.LogUnpin(ctx, pin)
 	case api.ClusterDAGType:
 		err := "cannot unpin a Cluster DAG directly. Unpin content root CID instead"
 		return pin, errors.New(err)
 	default:
 		return pin, errors.New("unrecognized pin type")
 	}
+
+	if err := c.consensus.LogUnpin(ctx, pin); err != nil {
+		return pin, err
+	}
+	c.recordTombstone(ctx, pin, unpinnedBy)
+	return pin, nil
+}
+
+// UnpinFilter unpins all the pins matching the given filter, which cannot
+// be empty. Unless the filter is confirmed with its token, the matching pins
+// are only counted. Shards and cluster DAGs are not matched, but the content
+// root pins which reference them are. When pin ownership is enforced, only
+// the pins owned by the API client of the request match, unless it is an
+// admin.
+func (c *Cluster) UnpinFilter(ctx context.Context, filter *api.UnpinFilter) (*api.UnpinFilterResult, error) {
+	_, span := trace.StartSpan(ctx, "cluster/UnpinFilter")
+	defer span.End()
+	ctx = api.CopyClientIdentity(trace.NewContext(c.ctx, span), ctx)
+
+	if c.followerMode() {
+		return nil, errFollowerMode
+	}
+
+	if filter.Empty() {
+		return nil, errors.New("the unpin filter cannot be empty")
+	}
+	if id := api.ClientIdentity(ctx); c.config.EnforcePinOwnership && api.IsClientRequest(ctx) && !c.isAdmin(id) {
+		owned := *filter
+		owned.Metadata = make(map[string]string, len(filter.Metadata)+1)
+		for k, v := range filter.Metadata {
+			owned.Metadata[k] = v
+		}
+		owned.Metadata[api.OwnerMetaKey] = id
+		filter = &owned
+	}
+	token := filter.Token()
+	if filter.Confirm != "" && filter.Confirm != token {
+		return nil, errors.New("the confirmation token does not match the filter")
+	}
+
+	cState, err := c.consensus.State(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pins, err := filterCandidates(ctx, cState, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &api.UnpinFilterResult{Token: token}
+	for _, pin := range pins {
+		if pin.Type != api.DataType && pin.Type != api.MetaType {
+			continue
+		}
+		if !filter.Match(pin) {
+			continue
+		}
+		result.Matched++
+		if filter.Confirm == "" {
+			continue
+		}
+
+		_, err := c.unpin(ctx, pin.Cid, api.ClientIdentity(ctx))
+		switch err {
+		case nil:
+			result.Unpinned++
+		case state.ErrNotFound: // unpinned in the meantime
+		default:
+			return result, err
+		}
+	}
+
+	logger.Infof("unpin filter: %d pins matched, %d unpinned", result.Matched, result.Unpinned)
+	return result, nil
+}
+
+// filterCandidates returns the pins which may match the given filter. When
+// the filter has metadata and the state indexes it, only the pins with the
+// first of its metadata keys are returned. Otherwise, all the pins are.
+func filterCandidates(ctx context.Context, st state.ReadOnly, filter *api.UnpinFilter) ([]*api.Pin, error) {
+	indexer, ok := st.(state.MetadataIndexer)
+	if !ok || len(filter.Metadata) == 0 {
+		return st.List(ctx)
+	}
+
+	keys := make([]string, 0, len(filter.Metadata))
+	for k := range filter.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return indexer.PinsByMetadata(ctx, keys[0], filter.Metadata[keys[0]])
 }
 
 // unpinClusterDag unpins the clusterDAG metadata node and the shard metadata
@@ -1566,8 +2613,9 @@ func (c *Cluster) unpinClusterDag(metaPin *api.Pin) error {
 
 // PinUpdate pins a new CID based on an existing cluster Pin. The allocations
 // and most pin options (replication factors) are copied from the existing
-// Pin.  The options object can be used to set the Name for the new pin and
-// might support additional options in the future.
+// Pin.  The options object can be used to set the Name and the owner (see
+// api.OwnerMetaKey) for the new pin and might support additional options in
+// the future.
 //
 // The from pin is NOT unpinned upon completion. The new pin might take
 // advantage of efficient pin/update operation on IPFS-side (if the
@@ -1589,43 +2637,263 @@ func (c *Cluster) PinUpdate(ctx context.Context, from cid.Cid, to cid.Cid, opts
 	existing.Cid = to
 	existing.PinUpdate = from
 	existing.Timestamp = time.Now()
+	// The new item is not what the IPNS name or MFS path resolves to, so
+	// it does not follow them.
+	existing.IPNSName = ""
+	existing.MFSPath = ""
+	existing.MFSPeer = ""
 	if opts.Name != "" {
 		existing.Name = opts.Name
 	}
+	if owner := opts.Metadata[api.OwnerMetaKey]; owner != "" && owner != existing.Metadata[api.OwnerMetaKey] {
+		meta := make(map[string]string, len(existing.Metadata)+1)
+		for k, v := range existing.Metadata {
+			meta[k] = v
+		}
+		meta[api.OwnerMetaKey] = owner
+		existing.Metadata = meta
+	}
 	if !opts.ExpireAt.IsZero() && opts.ExpireAt.After(time.Now()) {
 		existing.ExpireAt = opts.ExpireAt
 	}
+	if opts.DryRun {
+		existing.DryRun = true
+		return existing, nil
+	}
 	return existing, c.consensus.LogPin(ctx, existing)
 }
 
+// Update changes the options of an existing pin in place. Unlike unpinning
+// and pinning again, the pin stays in the shared state all along and keeps
+// its current allocations as long as they are valid: new peers are only
+// allocated when the replication factors grow or the placement changes, and
+// peers are only removed when they shrink. The trackers of the peers which
+// keep the pin have nothing to do, as their IPFS daemons have it pinned
+// already.
+//
+// Only the options which are given are changed; the rest keep their current
+// values. Metadata keys are merged into the existing ones, and a key given
+// with an empty value is removed. Update returns state.ErrNotFound when the
+// item is not pinned. The PinUpdate option is not allowed, use PinUpdate for
+// that.
+func (c *Cluster) Update(ctx context.Context, h cid.Cid, opts api.PinOptions) (*api.Pin, error) {
+	_, span := trace.StartSpan(ctx, "cluster/Update")
+	defer span.End()
+	ctx = api.CopyClientIdentity(trace.NewContext(c.ctx, span), ctx)
+
+	if c.followerMode() {
+		return nil, errFollowerMode
+	}
+
+	if opts.PinUpdate != cid.Undef {
+		return nil, errors.New("the pin-update option cannot be used when updating a pin")
+	}
+
+	existing, err := c.PinGet(ctx, h)
+	if err != nil { // including when the existing pin is not found
+		return nil, err
+	}
+
+	pin := api.PinCid(h)
+	pin.PinOptions = overlayPinOptions(existing.PinOptions, opts)
+	pin.Type = existing.Type
+	pin.Reference = existing.Reference
+	pin.IPNSName = existing.IPNSName
+	pin.MFSPath = existing.MFSPath
+	pin.MFSPeer = existing.MFSPeer
+	if existing.Type != api.DataType {
+		pin.MaxDepth = existing.MaxDepth
+	}
+
+	err = c.setupReplicationFactor(pin)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the allocations when nothing that affects them changes.
+	// Otherwise allocate() keeps the valid ones among them and finds
+	// the rest.
+	if pin.ReplicationFactorMin == existing.ReplicationFactorMin &&
+		pin.ReplicationFactorMax == existing.ReplicationFactorMax &&
+		pin.EffectivePlacement() == existing.EffectivePlacement() &&
+		len(pin.UserAllocations) == 0 && len(existing.UserAllocations) == 0 {
+		pin.Allocations = existing.Allocations
+	}
+
+	result, changed, err := c.pin(ctx, pin, []peer.ID{})
+	if err == nil && changed {
+		c.watchCommit(result)
+	}
+	return result, err
+}
+
+// overlayPinOptions returns the current options of a pin with the given
+// options set on top. Zero values mean "not given" and keep the current
+// value. As PinModeRecursive is the zero Mode, a pin becomes recursive again
+// by giving a non-zero MaxDepth.
+func overlayPinOptions(current, opts api.PinOptions) api.PinOptions {
+	po := current
+	if opts.ReplicationFactorMin != 0 {
+		po.ReplicationFactorMin = opts.ReplicationFactorMin
+	}
+	if opts.ReplicationFactorMax != 0 {
+		po.ReplicationFactorMax = opts.ReplicationFactorMax
+	}
+	if opts.Name != "" {
+		po.Name = opts.Name
+	}
+	if opts.ShardSize != 0 {
+		po.ShardSize = opts.ShardSize
+	}
+	if len(opts.UserAllocations) > 0 {
+		po.UserAllocations = opts.UserAllocations
+	}
+	if !opts.ExpireAt.IsZero() {
+		po.ExpireAt = opts.ExpireAt
+	}
+	if len(opts.Origins) > 0 {
+		po.Origins = opts.Origins
+	}
+	if opts.DependsOn.Defined() {
+		po.DependsOn = opts.DependsOn
+	}
+	if len(opts.ExcludeLinks) > 0 {
+		po.ExcludeLinks = opts.ExcludeLinks
+	}
+	if opts.Placement != "" {
+		po.Placement = opts.Placement
+	}
+	if opts.QoSClass != "" {
+		po.QoSClass = opts.QoSClass
+	}
+	if !opts.PinDeadline.IsZero() {
+		po.PinDeadline = opts.PinDeadline
+	}
+	switch {
+	case opts.Mode == api.PinModeDirect:
+		po.Mode = api.PinModeDirect
+		po.MaxDepth = api.PinModeDirect.ToPinDepth()
+	case opts.MaxDepth != 0:
+		po.Mode = api.PinModeRecursive
+		po.MaxDepth = opts.MaxDepth
+	}
+	if len(opts.Metadata) > 0 {
+		meta := make(map[string]string, len(current.Metadata)+len(opts.Metadata))
+		for k, v := range current.Metadata {
+			meta[k] = v
+		}
+		for k, v := range opts.Metadata {
+			if v == "" {
+				delete(meta, k)
+				continue
+			}
+			meta[k] = v
+		}
+		po.Metadata = meta
+	}
+	po.PinUpdate = cid.Undef
+	po.DryRun = opts.DryRun
+	return po
+}
+
 // PinPath pins an CID resolved from its IPFS Path. It returns the resolved
 // Pin object.
 func (c *Cluster) PinPath(ctx context.Context, path string, opts api.PinOptions) (*api.Pin, error) {
 	_, span := trace.StartSpan(ctx, "cluster/PinPath")
 	defer span.End()
 
-	ctx = trace.NewContext(c.ctx, span)
+	ctx = api.CopyClientIdentity(trace.NewContext(c.ctx, span), ctx)
+	if mfs := api.MFSPath(path); mfs != "" {
+		return c.pinMFS(ctx, mfs, opts)
+	}
+
 	ci, err := c.ipfs.Resolve(ctx, path)
 	if err != nil {
 		return nil, err
 	}
 
-	return c.Pin(ctx, ci, opts)
+	name := ipnsName(path)
+	if name == "" {
+		return c.Pin(ctx, ci, opts)
+	}
+
+	// Pins made from IPNS names remember them so that they can follow
+	// them (see watchIPNS).
+	pin := api.PinWithOpts(ci, opts)
+	pin.IPNSName = name
+	result, changed, err := c.pin(ctx, pin, []peer.ID{})
+	if err == nil && changed {
+		c.watchCommit(result)
+	}
+	return result, err
 }
 
 // UnpinPath unpins a CID resolved from its IPFS Path. If returns the
 // previously pinned Pin object.
 func (c *Cluster) UnpinPath(ctx context.Context, path string) (*api.Pin, error) {
+	return c.unpinPath(ctx, path, "")
+}
+
+// unpinPath performs UnpinPath like unpin does Unpin.
+func (c *Cluster) unpinPath(ctx context.Context, path string, unpinnedBy string) (*api.Pin, error) {
 	_, span := trace.StartSpan(ctx, "cluster/UnpinPath")
 	defer span.End()
 
-	ctx = trace.NewContext(c.ctx, span)
-	ci, err := c.ipfs.Resolve(ctx, path)
+	ctx = api.CopyClientIdentity(trace.NewContext(c.ctx, span), ctx)
+	resolve := c.ipfs.Resolve
+	if mfs := api.MFSPath(path); mfs != "" {
+		pins, err := c.mfsPins(ctx, mfs)
+		if err != nil {
+			return nil, err
+		}
+		if len(pins) > 0 {
+			return c.unpinAll(ctx, pins, unpinnedBy)
+		}
+		path = mfs
+		resolve = c.ipfs.ResolveMFS
+	}
+	ci, err := resolve(ctx, path)
 	if err != nil {
 		return nil, err
 	}
 
-	return c.Unpin(ctx, ci)
+	return c.unpin(ctx, ci, unpinnedBy)
+}
+
+// mfsPins returns the pins which follow the given MFS path of this peer.
+// While a followed path moves to a new CID (see followPin), both the old
+// and the new pins follow it.
+func (c *Cluster) mfsPins(ctx context.Context, mfsPath string) ([]*api.Pin, error) {
+	cState, err := c.consensus.State(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pins, err := cState.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var found []*api.Pin
+	for _, p := range pins {
+		if p.MFSPath == mfsPath && p.MFSPeer == c.id {
+			found = append(found, p)
+		}
+	}
+	return found, nil
+}
+
+// unpinAll unpins the given pins and returns the most recent one.
+func (c *Cluster) unpinAll(ctx context.Context, pins []*api.Pin, unpinnedBy string) (*api.Pin, error) {
+	var latest *api.Pin
+	for _, p := range pins {
+		unpinned, err := c.unpin(ctx, p.Cid, unpinnedBy)
+		if err != nil {
+			return nil, err
+		}
+		if latest == nil || unpinned.Timestamp.After(latest.Timestamp) {
+			latest = unpinned
+		}
+	}
+	return latest, nil
 }
 
 // AddFile adds a file to the ipfs daemons of the cluster.  The ipfs importer
@@ -1737,7 +3005,7 @@ func setTrackerStatus(gpin *api.GlobalPinInfo, h cid.Cid, peers []peer.ID, statu
 	}
 }
 
-func (c *Cluster) globalPinInfoCid(ctx context.Context, comp, method string, h cid.Cid) (*api.GlobalPinInfo, error) {
+func (c *Cluster) globalPinInfoCid(ctx context.Context, comp, method string, h cid.Cid, timeout time.Duration) (*api.GlobalPinInfo, error) {
 	ctx, span := trace.StartSpan(ctx, "cluster/globalPinInfoCid")
 	defer span.End()
 
@@ -1761,7 +3029,7 @@ func (c *Cluster) globalPinInfoCid(ctx context.Context, comp, method string, h c
 	// status.
 	if err == state.ErrNotFound {
 		var members []peer.ID
-		if c.config.FollowerMode {
+		if c.followerMode() {
 			members = []peer.ID{c.host.ID()}
 		} else {
 			members, err = c.consensus.Peers(ctx)
@@ -1785,9 +3053,11 @@ func (c *Cluster) globalPinInfoCid(ctx context.Context, comp, method string, h c
 	// The pin exists.
 	gpin.Cid = h
 	gpin.Name = pin.Name
+	gpin.CreatedAt = pin.CreatedAt
+	gpin.UpdatedAt = pin.Timestamp
 
 	// Make the list of peers that will receive the request.
-	if c.config.FollowerMode {
+	if c.followerMode() {
 		// during follower mode return only local status.
 		dests = []peer.ID{c.host.ID()}
 		remote = []peer.ID{}
@@ -1814,9 +3084,15 @@ func (c *Cluster) globalPinInfoCid(ctx context.Context, comp, method string, h c
 	replies := make([]*api.PinInfo, lenDests)
 
 	// a globalPinInfo type of request should be relatively fast. We
-	// cannot block response indefinitely due to an unresponsive node.
-	timeout := 15 * time.Second
-	ctxs, cancels := rpcutil.CtxsWithTimeout(ctx, lenDests, timeout)
+	// cannot block response indefinitely due to an unresponsive node,
+	// unless the method bounds its own duration (timeout 0).
+	var ctxs []context.Context
+	var cancels []context.CancelFunc
+	if timeout > 0 {
+		ctxs, cancels = rpcutil.CtxsWithTimeout(ctx, lenDests, timeout)
+	} else {
+		ctxs, cancels = rpcutil.CtxsWithCancel(ctx, lenDests)
+	}
 	defer rpcutil.MultiCancel(cancels)
 
 	errs := c.rpcClient.MultiCall(
@@ -1873,7 +3149,7 @@ func (c *Cluster) globalPinInfoSlice(ctx context.Context, comp, method string, a
 
 	var members []peer.ID
 	var err error
-	if c.config.FollowerMode {
+	if c.followerMode() {
 		members = []peer.ID{c.host.ID()}
 	} else {
 		members, err = c.consensus.Peers(ctx)
@@ -1946,6 +3222,8 @@ func (c *Cluster) globalPinInfoSlice(ctx context.Context, comp, method string, a
 		}
 	}
 
+	c.setPinTimestamps(ctx, fullMap)
+
 	for _, v := range fullMap {
 		infos = append(infos, v)
 	}
@@ -1953,6 +3231,30 @@ func (c *Cluster) globalPinInfoSlice(ctx context.Context, comp, method string, a
 	return infos, nil
 }
 
+// setPinTimestamps fills in the creation and modification times of the
+// given GlobalPinInfos using the pinset.
+func (c *Cluster) setPinTimestamps(ctx context.Context, infos map[cid.Cid]*api.GlobalPinInfo) {
+	if len(infos) == 0 {
+		return
+	}
+	st, err := c.consensus.State(ctx)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	pins, err := st.List(ctx)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	for _, pin := range pins {
+		if gpi, ok := infos[pin.Cid]; ok {
+			gpi.CreatedAt = pin.CreatedAt
+			gpi.UpdatedAt = pin.Timestamp
+		}
+	}
+}
+
 func (c *Cluster) getIDForPeer(ctx context.Context, pid peer.ID) (*api.ID, error) {
 	ctx, span := trace.StartSpan(ctx, "cluster/getIDForPeer")
 	defer span.End()
@@ -2128,3 +3430,109 @@ func (c *Cluster) RepoGCLocal(ctx context.Context) (*api.RepoGC, error) {
 	resp.Peername = c.config.Peername
 	return resp, nil
 }
+
+// SetMaintenance enables or disables maintenance mode in all the peers of the
+// cluster. During maintenance, peers do not trigger any automatic actions
+// (re-allocations, pin recovery and expiry sweeps), but keep serving reads
+// and explicit requests. Every peer keeps the mode in its datastore, so it
+// survives restarts, and peers joining the cluster take the mode of the peer
+// they join.
+func (c *Cluster) SetMaintenance(ctx context.Context, enabled bool) error {
+	_, span := trace.StartSpan(ctx, "cluster/SetMaintenance")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	members, err := c.consensus.Peers(ctx)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	lenMembers := len(members)
+	timeout := 15 * time.Second
+	ctxs, cancels := rpcutil.CtxsWithTimeout(ctx, lenMembers, timeout)
+	defer rpcutil.MultiCancel(cancels)
+
+	errs := c.rpcClient.MultiCall(
+		ctxs,
+		members,
+		"Cluster",
+		"SetMaintenanceLocal",
+		enabled,
+		rpcutil.RPCDiscardReplies(lenMembers),
+	)
+
+	var errors error
+	for i, e := range errs {
+		if e == nil {
+			continue
+		}
+		logger.Errorf("%s: error setting maintenance mode on %s: %s", c.id, members[i], e)
+		errors = multierr.Append(errors, fmt.Errorf("%s: %w", members[i], e))
+	}
+	return errors
+}
+
+// SetMaintenanceLocal enables or disables maintenance mode in this peer only.
+func (c *Cluster) SetMaintenanceLocal(ctx context.Context, enabled bool) {
+	_, span := trace.StartSpan(ctx, "cluster/SetMaintenanceLocal")
+	defer span.End()
+
+	c.maintenanceMux.Lock()
+	changed := c.maintenance != enabled
+	c.maintenance = enabled
+	c.maintenanceMux.Unlock()
+
+	if !changed {
+		return
+	}
+	c.storeMaintenance(ctx, enabled)
+	if enabled {
+		logger.Warn("entering maintenance mode: automatic actions are suspended")
+		return
+	}
+	logger.Info("leaving maintenance mode: automatic actions are resumed")
+	// kick any queued reallocations.
+	select {
+	case c.reallocCh <- struct{}{}:
+	default:
+	}
+}
+
+// maintenanceKey is the key of the peer datastore which is set while the
+// peer is in maintenance mode.
+var maintenanceKey = ds.NewKey("/maintenance")
+
+// storeMaintenance persists the maintenance mode in the peer datastore.
+func (c *Cluster) storeMaintenance(ctx context.Context, enabled bool) {
+	var err error
+	if enabled {
+		err = c.datastore.Put(ctx, maintenanceKey, []byte{1})
+	} else {
+		err = c.datastore.Delete(ctx, maintenanceKey)
+	}
+	if err != nil {
+		logger.Errorf("error persisting the maintenance mode: %s", err)
+	}
+}
+
+// loadMaintenance restores the maintenance mode persisted in the peer
+// datastore and returns it.
+func (c *Cluster) loadMaintenance(ctx context.Context) bool {
+	enabled, err := c.datastore.Has(ctx, maintenanceKey)
+	if err != nil {
+		logger.Errorf("error reading the maintenance mode: %s", err)
+		return false
+	}
+	c.maintenanceMux.Lock()
+	c.maintenance = enabled
+	c.maintenanceMux.Unlock()
+	return enabled
+}
+
+// InMaintenance returns true when this peer is in maintenance mode.
+func (c *Cluster) InMaintenance() bool {
+	c.maintenanceMux.RLock()
+	defer c.maintenanceMux.RUnlock()
+	return c.maintenance
+}
@@ -6,11 +6,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"sync"
 	"time"
 
+	"github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/config"
 
 	ipfsconfig "github.com/ipfs/go-ipfs-config"
@@ -30,21 +34,66 @@ var DefaultListenAddrs = []string{
 
 // Configuration defaults
 const (
-	DefaultEnableRelayHop      = true
-	DefaultStateSyncInterval   = 5 * time.Minute
-	DefaultPinRecoverInterval  = 12 * time.Minute
-	DefaultMonitorPingInterval = 15 * time.Second
-	DefaultPeerWatchInterval   = 5 * time.Second
-	DefaultReplicationFactor   = -1
-	DefaultLeaveOnShutdown     = false
-	DefaultDisableRepinning    = true
-	DefaultPeerstoreFile       = "peerstore"
-	DefaultConnMgrHighWater    = 400
-	DefaultConnMgrLowWater     = 100
-	DefaultConnMgrGracePeriod  = 2 * time.Minute
-	DefaultDialPeerTimeout     = 3 * time.Second
-	DefaultFollowerMode        = false
-	DefaultMDNSInterval        = 10 * time.Second
+	DefaultEnableRelayHop             = true
+	DefaultStateSyncInterval          = 5 * time.Minute
+	DefaultPinRecoverInterval         = 12 * time.Minute
+	DefaultMonitorPingInterval        = 15 * time.Second
+	DefaultPeerWatchInterval          = 5 * time.Second
+	DefaultReplicationFactor          = -1
+	DefaultLeaveOnShutdown            = false
+	DefaultDisableRepinning           = true
+	DefaultPeerstoreFile              = "peerstore"
+	DefaultConnMgrHighWater           = 400
+	DefaultConnMgrLowWater            = 100
+	DefaultConnMgrGracePeriod         = 2 * time.Minute
+	DefaultDialPeerTimeout            = 3 * time.Second
+	DefaultFollowerMode               = false
+	DefaultMDNSInterval               = 10 * time.Second
+	DefaultDuplicatePeerAction        = DuplicatePeerLog
+	DefaultAllocationCooldown         = 0
+	DefaultReloadOnSIGHUP             = false
+	DefaultMaxConcurrentReallocations = 0
+	DefaultCodecAwareAllocation       = false
+	DefaultDedupAwareAllocation       = false
+	DefaultCommitHookRetries          = 3
+	DefaultSplitBrainCheckInterval    = 0
+	DefaultCapacityAdmission          = false
+	DefaultAdaptiveInformerInterval   = false
+	DefaultInformerIntervalMin        = 5 * time.Second
+	DefaultInformerIntervalMax        = 5 * time.Minute
+	DefaultScrubInterval              = 0
+	DefaultScrubBatchSize             = 10
+	DefaultIPNSResolveInterval        = 0
+	DefaultMFSResolveInterval         = 0
+	DefaultOpLogSize                  = 10000
+	DefaultAllocationAuditSize        = 100
+	DefaultTombstoneRetention         = 0
+	DefaultRebalanceOnPeerRemoval     = false
+	DefaultReprovideStrategy          = ReprovideNone
+	DefaultReprovideInterval          = 12 * time.Hour
+	DefaultReprovidePeers             = 1
+	DefaultWriteHintMetric            = ""
+)
+
+// Possible values for the DuplicatePeerAction option.
+const (
+	// DuplicatePeerLog logs an error when a duplicate peer ID is detected.
+	DuplicatePeerLog = "log"
+	// DuplicatePeerIsolate logs an error, disconnects from the peer ID
+	// and attempts to remove it from the consensus peerset.
+	DuplicatePeerIsolate = "isolate"
+)
+
+// Possible values for the ReprovideStrategy option.
+const (
+	// ReprovideNone leaves reproviding to the IPFS daemons.
+	ReprovideNone = ""
+	// ReprovideAll makes every peer reprovide all the items allocated
+	// to it.
+	ReprovideAll = "all"
+	// ReprovideRotate makes only ReprovidePeers of the peers allocated
+	// to an item reprovide it, taking turns every ReprovideInterval.
+	ReprovideRotate = "rotate"
 )
 
 // ConnMgrConfig configures the libp2p host connection manager.
@@ -60,6 +109,10 @@ type ConnMgrConfig struct {
 type Config struct {
 	config.Saver
 
+	// reloadMux guards the options which Reload changes while the peer
+	// runs. They are read with reloadable().
+	reloadMux sync.RWMutex
+
 	// User-defined peername for use as human-readable identifier.
 	Peername string
 
@@ -133,8 +186,10 @@ type Config struct {
 	PeerWatchInterval time.Duration
 
 	// MDNSInterval controls the time between mDNS broadcasts to the
-	// network announcing the peer addresses. Set to 0 to disable
-	// mDNS.
+	// network announcing the peer addresses. Peers discovered in the
+	// local network are connected to, so that, in clusters using CRDT,
+	// they start exchanging metrics (and are monitored) without any
+	// bootstrap. Set to 0 to disable mDNS.
 	MDNSInterval time.Duration
 
 	// If true, DisableRepinning, ensures that no repinning happens
@@ -148,6 +203,187 @@ type Config struct {
 	// operations (Pin/Unpin).
 	FollowerMode bool
 
+	// ReadOnly makes this peer an observer: it works in FollowerMode
+	// and, in addition, announces itself as read-only so that other
+	// peers never allocate pins to it. It still tracks the items pinned
+	// everywhere, reports their status and publishes its metrics. It is
+	// only supported with the CRDT consensus, as Raft peers always vote.
+	ReadOnly bool
+
+	// AllocationCooldown sets a period after a new peer is first seen
+	// during which its allocation weights are scaled, growing linearly
+	// from those of the least attractive candidate to their actual
+	// values. This prevents new peers from receiving all new pins at
+	// once. 0 disables it.
+	AllocationCooldown time.Duration
+
+	// DuplicatePeerAction controls what happens when this peer detects
+	// that several running peers are using the same peer ID (i.e. a
+	// copied identity.json). It can be "log" or "isolate".
+	DuplicatePeerAction string
+
+	// MaxConcurrentReallocations limits how many items can be in the
+	// process of being re-allocated away from failed peers at the same
+	// time, across the whole cluster. Each peer takes a share of the
+	// limit and queues any reallocations beyond it. When there are fewer
+	// slots than peers, the slots rotate among peers every 10 minutes. 0
+	// means no limit.
+	MaxConcurrentReallocations int
+
+	// CodecAwareAllocation makes allocations skip peers whose IPFS
+	// daemon does not support the codec of the CID being pinned.
+	CodecAwareAllocation bool
+
+	// DedupAwareAllocation makes allocations prefer peers whose IPFS
+	// daemon already has the root block of the CID being pinned, i.e.
+	// because it is part of other pinned content, so that less data
+	// needs to be fetched. Only the peers which could be given a new
+	// allocation are asked, and only when one is needed.
+	DedupAwareAllocation bool
+
+	// CapacityAdmission makes new pins fail unless at least as many
+	// peers as their minimum replication factor have enough free space
+	// for them, according to the size of the DAG reported by IPFS and
+	// the "freespace" metrics. Only pins whose root block is available
+	// locally can be checked: the others are admitted.
+	CapacityAdmission bool
+
+	// CommitHookCommand is a command run every time a pin submitted
+	// through this peer becomes pinned on all its allocations. The pin
+	// is passed as JSON on its standard input and its CID in the
+	// CLUSTER_PIN_CID environment variable.
+	CommitHookCommand string
+
+	// CommitHookURL is an URL to which the pin is POSTed, as JSON,
+	// every time a pin submitted through this peer becomes pinned on all
+	// its allocations.
+	CommitHookURL string
+
+	// CommitHookRetries is how many more times failed commit hooks are
+	// attempted.
+	CommitHookRetries int
+
+	// AdaptiveInformerInterval makes informer metrics be published more
+	// often while their values change and less often while they stay
+	// the same, between InformerIntervalMin and InformerIntervalMax.
+	// The TTL of the published metrics is set to twice the interval.
+	AdaptiveInformerInterval bool
+	InformerIntervalMin      time.Duration
+	InformerIntervalMax      time.Duration
+
+	// SplitBrainCheckInterval is how often this peer compares its view
+	// of the shared state with that of the other peers, to detect peers
+	// which diverged after a network partition. Detected divergences are
+	// recorded as alerts and the consensus component is asked to
+	// reconcile them. 0 disables the check.
+	SplitBrainCheckInterval time.Duration
+
+	// ScrubInterval is how often this peer checks that the IPFS daemons
+	// of the peers reporting a sample of ScrubBatchSize pins as pinned
+	// hold every block of them. Pins failing the check are re-allocated
+	// away from those peers. Every pin is checked by a single peer. 0
+	// disables scrubbing.
+	ScrubInterval  time.Duration
+	ScrubBatchSize int
+
+	// IPNSResolveInterval is how often the IPNS names of the pins made
+	// from /ipns/ paths are resolved again. When a name points to a new
+	// CID, the new CID is pinned with the same options and allocations
+	// and the old one is unpinned. Every pin is followed by a single
+	// peer. 0 disables re-resolving.
+	IPNSResolveInterval time.Duration
+
+	// MFSResolveInterval is how often the MFS paths of the pins made from
+	// /mfs/ paths by this peer are resolved again in its IPFS daemon.
+	// When a path points to a new CID, the pin moves to it like IPNS
+	// pins do. 0 disables re-resolving.
+	MFSResolveInterval time.Duration
+
+	// OpLogSize is the number of operations on the shared state that
+	// this peer retains in memory for external consumers of the
+	// operation log (see Cluster.OpLog). The log is lost when the peer
+	// restarts. 0 disables the log.
+	OpLogSize int
+
+	// AllocationAuditSize is the number of allocation decisions made by
+	// this peer which are retained in memory, to explain why items were
+	// allocated to some peers (see Cluster.AllocationsAudit). 0 disables
+	// the audit.
+	AllocationAuditSize int
+
+	// TombstoneRetention is how long this peer keeps a record (a
+	// tombstone) of every item unpinned through it, with the time of the
+	// unpin and the API client which requested it, for auditing (see
+	// Cluster.DeletedPins). Tombstones are kept in the peer datastore,
+	// not in the shared state: each peer records the unpins it handles
+	// and DeletedPins gathers them from all peers. 0 disables
+	// tombstones.
+	TombstoneRetention time.Duration
+
+	// RebalanceOnPeerRemoval makes PeerRemove re-allocate all the pins
+	// allocated to the departing peer, even when DisableRepinning is set,
+	// and wait for them to be pinned on their new allocations. It fails
+	// without removing the peer when any of them cannot be moved or is
+	// not pinned in time. The removal is coordinated by the consensus
+	// leader, when there is one, and can be retried to resume it.
+	RebalanceOnPeerRemoval bool
+
+	// EnforcePinOwnership makes this peer reject the requests of API
+	// clients to update or unpin a pin which do not come from its owner
+	// (the client which pinned it, see api.OwnerMetaKey) or from one of
+	// the AdminIdentities. Owners are recorded regardless, so that it
+	// can be enabled once existing pins have them. It applies to every
+	// API of the peer (REST, gRPC and the IPFS proxy), whose clients
+	// should authenticate: the pins of unauthenticated clients have no
+	// owner and only admins can modify them. Calls from other cluster
+	// peers are not restricted.
+	EnforcePinOwnership bool
+
+	// AdminIdentities lists the API client identities (basic
+	// authentication usernames or client certificate identities) allowed
+	// to modify any pin and to set the owner of pins explicitly.
+	AdminIdentities []string
+
+	// ReprovideStrategy makes this peer announce to the DHT, when it
+	// starts and every ReprovideInterval, every block of the items
+	// allocated to it, a few items at a time. With ReprovideRotate, only
+	// ReprovidePeers of the peers allocated to an item do so, chosen from
+	// the allocations in the shared state which are not down and rotating
+	// every interval, so that items pinned by many peers are not
+	// announced by all of them. The IPFS daemons should then be
+	// configured not to reprovide pinned content themselves
+	// (Reprovider.Strategy). The peers of a cluster should use the same
+	// values. ReprovideNone disables it.
+	ReprovideStrategy string
+	ReprovideInterval time.Duration
+	ReprovidePeers    int
+
+	// WriteHintMetric names the metric used, in leaderless clusters, to
+	// suggest to clients the peer to send writes to (the WriteHint in
+	// the peer ID): the peer whose latest valid metric weighs the most,
+	// as allocators would prefer it. For the "queuedepth" metric, that is
+	// the peer with the shortest pinning queue. Empty disables it.
+	WriteHintMetric string
+
+	// QoSClasses defines, by name, the QoS classes which pins can be
+	// tagged with (PinOptions.QoSClass). Each class sets how its pins
+	// are queued and retried by the pin tracker, how soon they are
+	// re-allocated when a peer goes down and whether their failures
+	// produce alerts.
+	QoSClasses map[string]*api.QoSClass
+
+	// MetadataSchema constrains the metadata of the pins submitted to
+	// this peer: the keys which are required, and the values allowed for
+	// each key. Pins which do not follow it are rejected. Empty disables
+	// the validation.
+	MetadataSchema api.MetadataSchema
+
+	// ReloadOnSIGHUP makes the peer re-read its configuration file when
+	// it receives a SIGHUP signal, instead of shutting down. Only some
+	// options can be changed this way (see Reload()). Changes to any
+	// other option are logged and take effect on the next restart.
+	ReloadOnSIGHUP bool
+
 	// Peerstore file specifies the file on which we persist the
 	// libp2p host peerstore addresses. This file is regularly saved.
 	PeerstoreFile string
@@ -165,26 +401,80 @@ type Config struct {
 // saved using JSON. Most configuration keys are converted into simple types
 // like strings, and key names aim to be self-explanatory for the user.
 type configJSON struct {
-	ID                   string             `json:"id,omitempty"`
-	Peername             string             `json:"peername"`
-	PrivateKey           string             `json:"private_key,omitempty" hidden:"true"`
-	Secret               string             `json:"secret" hidden:"true"`
-	LeaveOnShutdown      bool               `json:"leave_on_shutdown"`
-	ListenMultiaddress   ipfsconfig.Strings `json:"listen_multiaddress"`
-	EnableRelayHop       bool               `json:"enable_relay_hop"`
-	ConnectionManager    *connMgrConfigJSON `json:"connection_manager"`
-	DialPeerTimeout      string             `json:"dial_peer_timeout"`
-	StateSyncInterval    string             `json:"state_sync_interval"`
-	PinRecoverInterval   string             `json:"pin_recover_interval"`
-	ReplicationFactorMin int                `json:"replication_factor_min"`
-	ReplicationFactorMax int                `json:"replication_factor_max"`
-	MonitorPingInterval  string             `json:"monitor_ping_interval"`
-	PeerWatchInterval    string             `json:"peer_watch_interval"`
-	MDNSInterval         string             `json:"mdns_interval"`
-	DisableRepinning     bool               `json:"disable_repinning"`
-	FollowerMode         bool               `json:"follower_mode,omitempty"`
-	PeerstoreFile        string             `json:"peerstore_file,omitempty"`
-	PeerAddresses        []string           `json:"peer_addresses"`
+	ID                         string             `json:"id,omitempty"`
+	Peername                   string             `json:"peername"`
+	PrivateKey                 string             `json:"private_key,omitempty" hidden:"true"`
+	Secret                     string             `json:"secret" hidden:"true"`
+	LeaveOnShutdown            bool               `json:"leave_on_shutdown"`
+	ListenMultiaddress         ipfsconfig.Strings `json:"listen_multiaddress"`
+	EnableRelayHop             bool               `json:"enable_relay_hop"`
+	ConnectionManager          *connMgrConfigJSON `json:"connection_manager"`
+	DialPeerTimeout            string             `json:"dial_peer_timeout"`
+	StateSyncInterval          string             `json:"state_sync_interval"`
+	PinRecoverInterval         string             `json:"pin_recover_interval"`
+	ReplicationFactorMin       int                `json:"replication_factor_min"`
+	ReplicationFactorMax       int                `json:"replication_factor_max"`
+	MonitorPingInterval        string             `json:"monitor_ping_interval"`
+	PeerWatchInterval          string             `json:"peer_watch_interval"`
+	MDNSInterval               string             `json:"mdns_interval"`
+	DisableRepinning           bool               `json:"disable_repinning"`
+	FollowerMode               bool               `json:"follower_mode,omitempty"`
+	ReadOnly                   bool               `json:"read_only,omitempty"`
+	AllocationCooldown         string             `json:"allocation_cooldown"`
+	DuplicatePeerAction        string             `json:"duplicate_peer_action"`
+	ReloadOnSIGHUP             bool               `json:"reload_on_sighup"`
+	MaxConcurrentReallocations int                `json:"max_concurrent_reallocations"`
+	CodecAwareAllocation       bool               `json:"codec_aware_allocation"`
+	DedupAwareAllocation       bool               `json:"dedup_aware_allocation"`
+	CapacityAdmission          bool               `json:"capacity_admission"`
+	CommitHookCommand          string             `json:"commit_hook_command,omitempty"`
+	CommitHookURL              string             `json:"commit_hook_url,omitempty"`
+	CommitHookRetries          int                `json:"commit_hook_retries"`
+	SplitBrainCheckInterval    string             `json:"split_brain_check_interval"`
+	AdaptiveInformerInterval   bool               `json:"adaptive_informer_interval"`
+	InformerIntervalMin        string             `json:"informer_interval_min"`
+	InformerIntervalMax        string             `json:"informer_interval_max"`
+	ScrubInterval              string             `json:"scrub_interval"`
+	ScrubBatchSize             int                `json:"scrub_batch_size"`
+	IPNSResolveInterval        string             `json:"ipns_resolve_interval"`
+	MFSResolveInterval         string             `json:"mfs_resolve_interval,omitempty"`
+	OpLogSize                  *int               `json:"oplog_size"`
+	AllocationAuditSize        *int               `json:"allocation_audit_size"`
+	TombstoneRetention         string             `json:"tombstone_retention,omitempty"`
+	RebalanceOnPeerRemoval     bool               `json:"rebalance_on_peer_removal,omitempty"`
+	EnforcePinOwnership        bool               `json:"enforce_pin_ownership,omitempty"`
+	AdminIdentities            []string           `json:"admin_identities,omitempty"`
+	ReprovideStrategy          string             `json:"reprovide_strategy,omitempty"`
+	ReprovideInterval          string             `json:"reprovide_interval,omitempty"`
+	ReprovidePeers             int                `json:"reprovide_peers,omitempty"`
+	WriteHintMetric            string             `json:"write_hint_metric,omitempty"`
+	QoSClasses                 qosClassesJSON     `json:"qos_classes,omitempty" ignored:"true"`
+	MetadataSchema             metadataSchemaJSON `json:"metadata_schema,omitempty" ignored:"true"`
+	PeerstoreFile              string             `json:"peerstore_file,omitempty"`
+	PeerAddresses              []string           `json:"peer_addresses"`
+}
+
+// qosClassesJSON defines the QoS classes by name.
+type qosClassesJSON map[string]*qosClassJSON
+
+// qosClassJSON defines a QoS class.
+type qosClassJSON struct {
+	Priority          string `json:"priority,omitempty"`
+	MaxRetries        int    `json:"max_retries"`
+	ReallocationDelay string `json:"reallocation_delay"`
+	Alert             bool   `json:"alert"`
+	CheckAvailability bool   `json:"check_availability,omitempty"`
+	MinProviders      int    `json:"min_providers,omitempty"`
+}
+
+// metadataSchemaJSON defines the metadata schema by key.
+type metadataSchemaJSON map[string]*metadataKeySchemaJSON
+
+// metadataKeySchemaJSON constrains the value of a metadata key.
+type metadataKeySchemaJSON struct {
+	Required      bool     `json:"required,omitempty"`
+	AllowedValues []string `json:"allowed_values,omitempty"`
+	Regexp        string   `json:"regexp,omitempty"`
 }
 
 // connMgrConfigJSON configures the libp2p host connection manager.
@@ -282,6 +572,99 @@ func (cfg *Config) Validate() error {
 		return errors.New("cluster.peer_watch_interval is invalid")
 	}
 
+	if cfg.AllocationCooldown < 0 {
+		return errors.New("cluster.allocation_cooldown is invalid")
+	}
+
+	switch cfg.DuplicatePeerAction {
+	case DuplicatePeerLog, DuplicatePeerIsolate:
+	default:
+		return errors.New("cluster.duplicate_peer_action is invalid")
+	}
+
+	if cfg.MaxConcurrentReallocations < 0 {
+		return errors.New("cluster.max_concurrent_reallocations is invalid")
+	}
+
+	if cfg.CommitHookURL != "" {
+		if u, err := url.Parse(cfg.CommitHookURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.New("cluster.commit_hook_url is invalid")
+		}
+	}
+
+	if cfg.CommitHookRetries < 0 {
+		return errors.New("cluster.commit_hook_retries is invalid")
+	}
+
+	if cfg.SplitBrainCheckInterval < 0 {
+		return errors.New("cluster.split_brain_check_interval is invalid")
+	}
+
+	if cfg.ScrubInterval < 0 {
+		return errors.New("cluster.scrub_interval is invalid")
+	}
+
+	if cfg.ScrubBatchSize <= 0 {
+		return errors.New("cluster.scrub_batch_size should be larger than 0")
+	}
+
+	if cfg.IPNSResolveInterval < 0 {
+		return errors.New("cluster.ipns_resolve_interval is invalid")
+	}
+
+	if cfg.MFSResolveInterval < 0 {
+		return errors.New("cluster.mfs_resolve_interval is invalid")
+	}
+
+	if cfg.OpLogSize < 0 {
+		return errors.New("cluster.oplog_size is invalid")
+	}
+
+	if cfg.AllocationAuditSize < 0 {
+		return errors.New("cluster.allocation_audit_size is invalid")
+	}
+
+	if cfg.TombstoneRetention < 0 {
+		return errors.New("cluster.tombstone_retention is invalid")
+	}
+
+	switch cfg.ReprovideStrategy {
+	case ReprovideNone, ReprovideAll, ReprovideRotate:
+	default:
+		return errors.New("cluster.reprovide_strategy is invalid")
+	}
+
+	if cfg.ReprovideInterval <= 0 {
+		return errors.New("cluster.reprovide_interval is invalid")
+	}
+
+	if cfg.ReprovidePeers <= 0 {
+		return errors.New("cluster.reprovide_peers should be larger than 0")
+	}
+
+	for k, ks := range cfg.MetadataSchema {
+		if k == "" || ks == nil {
+			return errors.New("cluster.metadata_schema is invalid")
+		}
+	}
+
+	for name, qc := range cfg.QoSClasses {
+		if name == "" || qc == nil {
+			return errors.New("cluster.qos_classes is invalid")
+		}
+		if err := qc.Validate(); err != nil {
+			return fmt.Errorf("cluster.qos_classes.%s: %w", name, err)
+		}
+	}
+
+	if cfg.InformerIntervalMin <= 0 {
+		return errors.New("cluster.informer_interval_min is invalid")
+	}
+
+	if cfg.InformerIntervalMax < cfg.InformerIntervalMin {
+		return errors.New("cluster.informer_interval_max is lower than the minimum")
+	}
+
 	rfMax := cfg.ReplicationFactorMax
 	rfMin := cfg.ReplicationFactorMin
 
@@ -375,6 +758,37 @@ func (cfg *Config) setDefaults() {
 	cfg.MDNSInterval = DefaultMDNSInterval
 	cfg.DisableRepinning = DefaultDisableRepinning
 	cfg.FollowerMode = DefaultFollowerMode
+	cfg.ReadOnly = false
+	cfg.AllocationCooldown = DefaultAllocationCooldown
+	cfg.DuplicatePeerAction = DefaultDuplicatePeerAction
+	cfg.ReloadOnSIGHUP = DefaultReloadOnSIGHUP
+	cfg.MaxConcurrentReallocations = DefaultMaxConcurrentReallocations
+	cfg.CodecAwareAllocation = DefaultCodecAwareAllocation
+	cfg.DedupAwareAllocation = DefaultDedupAwareAllocation
+	cfg.CapacityAdmission = DefaultCapacityAdmission
+	cfg.CommitHookCommand = ""
+	cfg.CommitHookURL = ""
+	cfg.CommitHookRetries = DefaultCommitHookRetries
+	cfg.SplitBrainCheckInterval = DefaultSplitBrainCheckInterval
+	cfg.AdaptiveInformerInterval = DefaultAdaptiveInformerInterval
+	cfg.InformerIntervalMin = DefaultInformerIntervalMin
+	cfg.InformerIntervalMax = DefaultInformerIntervalMax
+	cfg.ScrubInterval = DefaultScrubInterval
+	cfg.ScrubBatchSize = DefaultScrubBatchSize
+	cfg.IPNSResolveInterval = DefaultIPNSResolveInterval
+	cfg.MFSResolveInterval = DefaultMFSResolveInterval
+	cfg.OpLogSize = DefaultOpLogSize
+	cfg.AllocationAuditSize = DefaultAllocationAuditSize
+	cfg.TombstoneRetention = DefaultTombstoneRetention
+	cfg.RebalanceOnPeerRemoval = DefaultRebalanceOnPeerRemoval
+	cfg.EnforcePinOwnership = false
+	cfg.AdminIdentities = nil
+	cfg.ReprovideStrategy = DefaultReprovideStrategy
+	cfg.ReprovideInterval = DefaultReprovideInterval
+	cfg.ReprovidePeers = DefaultReprovidePeers
+	cfg.WriteHintMetric = DefaultWriteHintMetric
+	cfg.QoSClasses = nil
+	cfg.MetadataSchema = nil
 	cfg.PeerstoreFile = "" // empty so it gets omitted.
 	cfg.PeerAddresses = []ma.Multiaddr{}
 	cfg.RPCPolicy = DefaultRPCPolicy
@@ -400,6 +814,68 @@ func (cfg *Config) applyConfigJSON(jcfg *configJSON) error {
 	config.SetIfNotDefault(jcfg.PeerstoreFile, &cfg.PeerstoreFile)
 
 	config.SetIfNotDefault(jcfg.Peername, &cfg.Peername)
+	config.SetIfNotDefault(jcfg.DuplicatePeerAction, &cfg.DuplicatePeerAction)
+	config.SetIfNotDefault(jcfg.MaxConcurrentReallocations, &cfg.MaxConcurrentReallocations)
+	config.SetIfNotDefault(jcfg.CommitHookCommand, &cfg.CommitHookCommand)
+	config.SetIfNotDefault(jcfg.CommitHookURL, &cfg.CommitHookURL)
+	config.SetIfNotDefault(jcfg.CommitHookRetries, &cfg.CommitHookRetries)
+	config.SetIfNotDefault(jcfg.ScrubBatchSize, &cfg.ScrubBatchSize)
+	if jcfg.OpLogSize != nil {
+		cfg.OpLogSize = *jcfg.OpLogSize
+	}
+	if jcfg.AllocationAuditSize != nil {
+		cfg.AllocationAuditSize = *jcfg.AllocationAuditSize
+	}
+	cfg.RebalanceOnPeerRemoval = jcfg.RebalanceOnPeerRemoval
+	cfg.EnforcePinOwnership = jcfg.EnforcePinOwnership
+	cfg.AdminIdentities = jcfg.AdminIdentities
+	cfg.ReprovideStrategy = jcfg.ReprovideStrategy
+	config.SetIfNotDefault(jcfg.ReprovidePeers, &cfg.ReprovidePeers)
+	cfg.WriteHintMetric = jcfg.WriteHintMetric
+
+	if len(jcfg.QoSClasses) > 0 {
+		cfg.QoSClasses = make(map[string]*api.QoSClass, len(jcfg.QoSClasses))
+	}
+	for name, jqc := range jcfg.QoSClasses {
+		if jqc == nil {
+			return fmt.Errorf("cluster.qos_classes.%s is empty", name)
+		}
+		qc := &api.QoSClass{
+			Priority:          api.QoSPriority(jqc.Priority),
+			MaxRetries:        jqc.MaxRetries,
+			Alert:             jqc.Alert,
+			CheckAvailability: jqc.CheckAvailability,
+			MinProviders:      jqc.MinProviders,
+		}
+		err := config.ParseDurations("cluster",
+			&config.DurationOpt{Duration: jqc.ReallocationDelay, Dst: &qc.ReallocationDelay, Name: "qos_classes." + name + ".reallocation_delay"},
+		)
+		if err != nil {
+			return err
+		}
+		cfg.QoSClasses[name] = qc
+	}
+
+	if len(jcfg.MetadataSchema) > 0 {
+		cfg.MetadataSchema = make(api.MetadataSchema, len(jcfg.MetadataSchema))
+	}
+	for k, jks := range jcfg.MetadataSchema {
+		if jks == nil {
+			return fmt.Errorf("cluster.metadata_schema.%s is empty", k)
+		}
+		ks := &api.MetadataKeySchema{
+			Required:      jks.Required,
+			AllowedValues: jks.AllowedValues,
+		}
+		if jks.Regexp != "" {
+			re, err := regexp.Compile(jks.Regexp)
+			if err != nil {
+				return fmt.Errorf("error parsing cluster.metadata_schema.%s.regexp: %w", k, err)
+			}
+			ks.Regexp = re
+		}
+		cfg.MetadataSchema[k] = ks
+	}
 
 	clusterSecret, err := DecodeClusterSecret(jcfg.Secret)
 	if err != nil {
@@ -445,6 +921,15 @@ func (cfg *Config) applyConfigJSON(jcfg *configJSON) error {
 		&config.DurationOpt{Duration: jcfg.MonitorPingInterval, Dst: &cfg.MonitorPingInterval, Name: "monitor_ping_interval"},
 		&config.DurationOpt{Duration: jcfg.PeerWatchInterval, Dst: &cfg.PeerWatchInterval, Name: "peer_watch_interval"},
 		&config.DurationOpt{Duration: jcfg.MDNSInterval, Dst: &cfg.MDNSInterval, Name: "mdns_interval"},
+		&config.DurationOpt{Duration: jcfg.AllocationCooldown, Dst: &cfg.AllocationCooldown, Name: "allocation_cooldown"},
+		&config.DurationOpt{Duration: jcfg.SplitBrainCheckInterval, Dst: &cfg.SplitBrainCheckInterval, Name: "split_brain_check_interval"},
+		&config.DurationOpt{Duration: jcfg.InformerIntervalMin, Dst: &cfg.InformerIntervalMin, Name: "informer_interval_min"},
+		&config.DurationOpt{Duration: jcfg.InformerIntervalMax, Dst: &cfg.InformerIntervalMax, Name: "informer_interval_max"},
+		&config.DurationOpt{Duration: jcfg.ScrubInterval, Dst: &cfg.ScrubInterval, Name: "scrub_interval"},
+		&config.DurationOpt{Duration: jcfg.IPNSResolveInterval, Dst: &cfg.IPNSResolveInterval, Name: "ipns_resolve_interval"},
+		&config.DurationOpt{Duration: jcfg.MFSResolveInterval, Dst: &cfg.MFSResolveInterval, Name: "mfs_resolve_interval"},
+		&config.DurationOpt{Duration: jcfg.ReprovideInterval, Dst: &cfg.ReprovideInterval, Name: "reprovide_interval"},
+		&config.DurationOpt{Duration: jcfg.TombstoneRetention, Dst: &cfg.TombstoneRetention, Name: "tombstone_retention"},
 	)
 	if err != nil {
 		return err
@@ -464,6 +949,12 @@ func (cfg *Config) applyConfigJSON(jcfg *configJSON) error {
 	cfg.LeaveOnShutdown = jcfg.LeaveOnShutdown
 	cfg.DisableRepinning = jcfg.DisableRepinning
 	cfg.FollowerMode = jcfg.FollowerMode
+	cfg.ReadOnly = jcfg.ReadOnly
+	cfg.ReloadOnSIGHUP = jcfg.ReloadOnSIGHUP
+	cfg.CodecAwareAllocation = jcfg.CodecAwareAllocation
+	cfg.DedupAwareAllocation = jcfg.DedupAwareAllocation
+	cfg.CapacityAdmission = jcfg.CapacityAdmission
+	cfg.AdaptiveInformerInterval = jcfg.AdaptiveInformerInterval
 
 	return cfg.Validate()
 }
@@ -519,10 +1010,177 @@ func (cfg *Config) toConfigJSON() (jcfg *configJSON, err error) {
 		jcfg.PeerAddresses = append(jcfg.PeerAddresses, addr.String())
 	}
 	jcfg.FollowerMode = cfg.FollowerMode
+	jcfg.ReadOnly = cfg.ReadOnly
+	jcfg.AllocationCooldown = cfg.AllocationCooldown.String()
+	jcfg.DuplicatePeerAction = cfg.DuplicatePeerAction
+	jcfg.ReloadOnSIGHUP = cfg.ReloadOnSIGHUP
+	jcfg.MaxConcurrentReallocations = cfg.MaxConcurrentReallocations
+	jcfg.CodecAwareAllocation = cfg.CodecAwareAllocation
+	jcfg.DedupAwareAllocation = cfg.DedupAwareAllocation
+	jcfg.CapacityAdmission = cfg.CapacityAdmission
+	jcfg.CommitHookCommand = cfg.CommitHookCommand
+	jcfg.CommitHookURL = cfg.CommitHookURL
+	jcfg.CommitHookRetries = cfg.CommitHookRetries
+	jcfg.SplitBrainCheckInterval = cfg.SplitBrainCheckInterval.String()
+	jcfg.AdaptiveInformerInterval = cfg.AdaptiveInformerInterval
+	jcfg.InformerIntervalMin = cfg.InformerIntervalMin.String()
+	jcfg.InformerIntervalMax = cfg.InformerIntervalMax.String()
+	jcfg.ScrubInterval = cfg.ScrubInterval.String()
+	jcfg.ScrubBatchSize = cfg.ScrubBatchSize
+	jcfg.IPNSResolveInterval = cfg.IPNSResolveInterval.String()
+	if cfg.MFSResolveInterval > 0 {
+		jcfg.MFSResolveInterval = cfg.MFSResolveInterval.String()
+	}
+	jcfg.OpLogSize = &cfg.OpLogSize
+	jcfg.AllocationAuditSize = &cfg.AllocationAuditSize
+	if cfg.TombstoneRetention > 0 {
+		jcfg.TombstoneRetention = cfg.TombstoneRetention.String()
+	}
+	jcfg.RebalanceOnPeerRemoval = cfg.RebalanceOnPeerRemoval
+	jcfg.EnforcePinOwnership = cfg.EnforcePinOwnership
+	jcfg.AdminIdentities = cfg.AdminIdentities
+	if cfg.ReprovideStrategy != ReprovideNone {
+		jcfg.ReprovideStrategy = cfg.ReprovideStrategy
+		jcfg.ReprovideInterval = cfg.ReprovideInterval.String()
+		jcfg.ReprovidePeers = cfg.ReprovidePeers
+	}
+	jcfg.WriteHintMetric = cfg.WriteHintMetric
+	if len(cfg.QoSClasses) > 0 {
+		jcfg.QoSClasses = make(qosClassesJSON, len(cfg.QoSClasses))
+	}
+	for name, qc := range cfg.QoSClasses {
+		jcfg.QoSClasses[name] = &qosClassJSON{
+			Priority:          string(qc.Priority),
+			MaxRetries:        qc.MaxRetries,
+			ReallocationDelay: qc.ReallocationDelay.String(),
+			Alert:             qc.Alert,
+			CheckAvailability: qc.CheckAvailability,
+			MinProviders:      qc.MinProviders,
+		}
+	}
+	if len(cfg.MetadataSchema) > 0 {
+		jcfg.MetadataSchema = make(metadataSchemaJSON, len(cfg.MetadataSchema))
+	}
+	for k, ks := range cfg.MetadataSchema {
+		jks := &metadataKeySchemaJSON{
+			Required:      ks.Required,
+			AllowedValues: ks.AllowedValues,
+		}
+		if ks.Regexp != nil {
+			jks.Regexp = ks.Regexp.String()
+		}
+		jcfg.MetadataSchema[k] = jks
+	}
 
 	return
 }
 
+// reloadableOptions are the values of the options which Reload can change
+// while the peer is running.
+type reloadableOptions struct {
+	ReplicationFactorMin       int
+	ReplicationFactorMax       int
+	DisableRepinning           bool
+	AllocationCooldown         time.Duration
+	DuplicatePeerAction        string
+	MaxConcurrentReallocations int
+	CodecAwareAllocation       bool
+	DedupAwareAllocation       bool
+	CapacityAdmission          bool
+	CommitHookCommand          string
+	CommitHookURL              string
+	CommitHookRetries          int
+	WriteHintMetric            string
+	MetadataSchema             api.MetadataSchema
+}
+
+// reloadable returns the current values of the options which Reload can
+// change. Components running while the configuration may be reloaded must
+// read those options through it.
+func (cfg *Config) reloadable() reloadableOptions {
+	cfg.reloadMux.RLock()
+	defer cfg.reloadMux.RUnlock()
+	return reloadableOptions{
+		ReplicationFactorMin:       cfg.ReplicationFactorMin,
+		ReplicationFactorMax:       cfg.ReplicationFactorMax,
+		DisableRepinning:           cfg.DisableRepinning,
+		AllocationCooldown:         cfg.AllocationCooldown,
+		DuplicatePeerAction:        cfg.DuplicatePeerAction,
+		MaxConcurrentReallocations: cfg.MaxConcurrentReallocations,
+		CodecAwareAllocation:       cfg.CodecAwareAllocation,
+		DedupAwareAllocation:       cfg.DedupAwareAllocation,
+		CapacityAdmission:          cfg.CapacityAdmission,
+		CommitHookCommand:          cfg.CommitHookCommand,
+		CommitHookURL:              cfg.CommitHookURL,
+		CommitHookRetries:          cfg.CommitHookRetries,
+		WriteHintMetric:            cfg.WriteHintMetric,
+		MetadataSchema:             cfg.MetadataSchema,
+	}
+}
+
+// Reload applies the options from the given Config which can be changed
+// while the peer is running: replication_factor_min,
+// replication_factor_max, disable_repinning, allocation_cooldown,
+// duplicate_peer_action, max_concurrent_reallocations,
+// codec_aware_allocation, dedup_aware_allocation, capacity_admission, the
+// commit_hook options, reload_on_sighup, write_hint_metric and
+// metadata_schema. It returns the keys of any other options that differ,
+// which are left untouched since they are only read on start. It implements
+// config.Reloadable.
+func (cfg *Config) Reload(newComp config.ComponentConfig) ([]string, error) {
+	newCfg, ok := newComp.(*Config)
+	if !ok {
+		return nil, errors.New("expected a cluster configuration")
+	}
+
+	keys, err := config.ChangedKeys(cfg, newCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.reloadMux.Lock()
+	defer cfg.reloadMux.Unlock()
+
+	var restartOnly []string
+	for _, k := range keys {
+		switch k {
+		case "replication_factor_min":
+			cfg.ReplicationFactorMin = newCfg.ReplicationFactorMin
+		case "replication_factor_max":
+			cfg.ReplicationFactorMax = newCfg.ReplicationFactorMax
+		case "disable_repinning":
+			cfg.DisableRepinning = newCfg.DisableRepinning
+		case "allocation_cooldown":
+			cfg.AllocationCooldown = newCfg.AllocationCooldown
+		case "duplicate_peer_action":
+			cfg.DuplicatePeerAction = newCfg.DuplicatePeerAction
+		case "max_concurrent_reallocations":
+			cfg.MaxConcurrentReallocations = newCfg.MaxConcurrentReallocations
+		case "codec_aware_allocation":
+			cfg.CodecAwareAllocation = newCfg.CodecAwareAllocation
+		case "dedup_aware_allocation":
+			cfg.DedupAwareAllocation = newCfg.DedupAwareAllocation
+		case "capacity_admission":
+			cfg.CapacityAdmission = newCfg.CapacityAdmission
+		case "commit_hook_command":
+			cfg.CommitHookCommand = newCfg.CommitHookCommand
+		case "commit_hook_url":
+			cfg.CommitHookURL = newCfg.CommitHookURL
+		case "commit_hook_retries":
+			cfg.CommitHookRetries = newCfg.CommitHookRetries
+		case "reload_on_sighup":
+			cfg.ReloadOnSIGHUP = newCfg.ReloadOnSIGHUP
+		case "write_hint_metric":
+			cfg.WriteHintMetric = newCfg.WriteHintMetric
+		case "metadata_schema":
+			cfg.MetadataSchema = newCfg.MetadataSchema
+		default:
+			restartOnly = append(restartOnly, k)
+		}
+	}
+	return restartOnly, nil
+}
+
 // GetPeerstorePath returns the full path of the
 // PeerstoreFile, obtained by concatenating that value
 // with BaseDir of the configuration, if set.
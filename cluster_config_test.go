@@ -6,6 +6,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ipfs/ipfs-cluster/api"
+
 	ipfsconfig "github.com/ipfs/go-ipfs-config"
 )
 
@@ -205,6 +207,71 @@ func TestLoadJSON(t *testing.T) {
 			t.Error("default conn manager values not set")
 		}
 	})
+
+	t.Run("qos classes", func(t *testing.T) {
+		cfg, err := loadJSON2(
+			t,
+			func(j *configJSON) {
+				j.QoSClasses = qosClassesJSON{
+					"critical": {
+						Priority:          "high",
+						ReallocationDelay: "10s",
+						Alert:             true,
+						CheckAvailability: true,
+					},
+				}
+			},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		qc := cfg.QoSClasses["critical"]
+		if qc == nil || qc.Priority != api.QoSPriorityHigh || qc.ReallocationDelay != 10*time.Second || !qc.Alert || !qc.CheckAvailability {
+			t.Error("qos classes not loaded:", qc)
+		}
+
+		_, err = loadJSON2(
+			t,
+			func(j *configJSON) {
+				j.QoSClasses = qosClassesJSON{"bulk": {Priority: "lowest"}}
+			},
+		)
+		if err == nil {
+			t.Error("expected an error with an unknown priority")
+		}
+	})
+
+	t.Run("metadata schema", func(t *testing.T) {
+		cfg, err := loadJSON2(
+			t,
+			func(j *configJSON) {
+				j.MetadataSchema = metadataSchemaJSON{
+					"team": {
+						Required:      true,
+						AllowedValues: []string{"media"},
+						Regexp:        "^[a-z]+$",
+					},
+				}
+			},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ks := cfg.MetadataSchema["team"]
+		if ks == nil || !ks.Required || len(ks.AllowedValues) != 1 || ks.Regexp.String() != "^[a-z]+$" {
+			t.Error("metadata schema not loaded:", ks)
+		}
+
+		_, err = loadJSON2(
+			t,
+			func(j *configJSON) {
+				j.MetadataSchema = metadataSchemaJSON{"team": {Regexp: "[a-z"}}
+			},
+		)
+		if err == nil {
+			t.Error("expected an error with an invalid regexp")
+		}
+	})
 }
 
 func TestToJSON(t *testing.T) {
@@ -275,4 +342,136 @@ func TestValidate(t *testing.T) {
 	if cfg.Validate() == nil {
 		t.Fatal("expected error validating")
 	}
+
+	cfg.Default()
+	cfg.DuplicatePeerAction = "ignore"
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.CommitHookURL = "localhost/hook"
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.SplitBrainCheckInterval = -time.Second
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.ScrubInterval = -time.Second
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.ScrubBatchSize = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.IPNSResolveInterval = -time.Second
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.MFSResolveInterval = -time.Second
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.OpLogSize = -1
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.AllocationAuditSize = -1
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.TombstoneRetention = -time.Second
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.ReprovideStrategy = "some"
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.ReprovideStrategy = ReprovideRotate
+	cfg.ReprovidePeers = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.QoSClasses = map[string]*api.QoSClass{"bulk": {MaxRetries: -1}}
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.InformerIntervalMin = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.InformerIntervalMax = cfg.InformerIntervalMin / 2
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+}
+
+func TestReload(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	raw, err := cfg.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newCfg := &Config{}
+	err = newCfg.LoadJSON(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newCfg.ReplicationFactorMin = 2
+	newCfg.ReplicationFactorMax = 3
+	newCfg.PeerWatchInterval = time.Hour
+
+	// Reading the reloadable options while reloading is safe.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = cfg.reloadable().ReplicationFactorMin
+		}
+	}()
+	restartOnly, err := cfg.Reload(newCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if len(restartOnly) != 1 || restartOnly[0] != "peer_watch_interval" {
+		t.Errorf("expected only peer_watch_interval to need a restart: %v", restartOnly)
+	}
+	if cfg.ReplicationFactorMin != 2 || cfg.ReplicationFactorMax != 3 {
+		t.Error("replication factors should have been reloaded")
+	}
+	if cfg.PeerWatchInterval == time.Hour {
+		t.Error("peer_watch_interval should not have been reloaded")
+	}
 }
@@ -2,12 +2,17 @@ package ipfscluster
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -15,7 +20,9 @@ import (
 	"github.com/ipfs/ipfs-cluster/allocator/balanced"
 	"github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/config"
+	"github.com/ipfs/ipfs-cluster/informer/disk"
 	"github.com/ipfs/ipfs-cluster/informer/numpin"
+	"github.com/ipfs/ipfs-cluster/informer/tags"
 	"github.com/ipfs/ipfs-cluster/monitor/pubsubmon"
 	"github.com/ipfs/ipfs-cluster/pintracker/stateless"
 	"github.com/ipfs/ipfs-cluster/state"
@@ -53,6 +60,13 @@ type mockConnector struct {
 
 	pins   sync.Map
 	blocks sync.Map
+	// lost holds pinned items whose blocks went missing.
+	lost sync.Map
+	// provided holds the items announced with Provide.
+	provided sync.Map
+	// pinLsGate, when set to a channel, holds PinLs calls until it is
+	// closed.
+	pinLsGate atomic.Value
 }
 
 func (ipfs *mockConnector) ID(ctx context.Context) (*api.IPFSID, error) {
@@ -62,12 +76,15 @@ func (ipfs *mockConnector) ID(ctx context.Context) (*api.IPFSID, error) {
 }
 
 func (ipfs *mockConnector) Pin(ctx context.Context, pin *api.Pin) error {
+	if pin.Cid.Equals(test.ErrorCid) {
+		return errors.New("error pinning cid")
+	}
 	ipfs.pins.Store(pin.Cid.String(), pin.MaxDepth)
 	return nil
 }
 
-func (ipfs *mockConnector) Unpin(ctx context.Context, c cid.Cid) error {
-	ipfs.pins.Delete(c.String())
+func (ipfs *mockConnector) Unpin(ctx context.Context, pin *api.Pin) error {
+	ipfs.pins.Delete(pin.Cid.String())
 	return nil
 }
 
@@ -84,6 +101,14 @@ func (ipfs *mockConnector) PinLsCid(ctx context.Context, pin *api.Pin) (api.IPFS
 }
 
 func (ipfs *mockConnector) PinLs(ctx context.Context, filter string) (map[string]api.IPFSPinStatus, error) {
+	if gate, ok := ipfs.pinLsGate.Load().(chan struct{}); ok {
+		select {
+		case <-gate:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
 	m := make(map[string]api.IPFSPinStatus)
 	var st api.IPFSPinStatus
 	ipfs.pins.Range(func(k, v interface{}) bool {
@@ -127,6 +152,11 @@ func (ipfs *mockConnector) Resolve(ctx context.Context, path string) (cid.Cid, e
 
 	return test.CidResolved, nil
 }
+
+func (ipfs *mockConnector) ResolveMFS(ctx context.Context, path string) (cid.Cid, error) {
+	return test.CidMFS, nil
+}
+
 func (ipfs *mockConnector) ConnectSwarms(ctx context.Context) error       { return nil }
 func (ipfs *mockConnector) ConfigKey(keypath string) (interface{}, error) { return nil, nil }
 
@@ -143,11 +173,64 @@ func (ipfs *mockConnector) BlockGet(ctx context.Context, c cid.Cid) ([]byte, err
 	return d.([]byte), nil
 }
 
+func (ipfs *mockConnector) BlockHas(ctx context.Context, c cid.Cid) (bool, error) {
+	if _, ok := ipfs.lost.Load(c.String()); ok {
+		return false, nil
+	}
+	if _, ok := ipfs.pins.Load(c.String()); ok {
+		return true, nil
+	}
+	_, ok := ipfs.blocks.Load(c.String())
+	return ok, nil
+}
+
+func (ipfs *mockConnector) SupportsCodec(ctx context.Context, codec uint64) (bool, error) {
+	return codec != cid.GitRaw, nil
+}
+
+func (ipfs *mockConnector) Provide(ctx context.Context, c cid.Cid) error {
+	ipfs.provided.Store(c.String(), struct{}{})
+	return nil
+}
+
+func (ipfs *mockConnector) MissingRefs(ctx context.Context, c cid.Cid) ([]cid.Cid, error) {
+	if _, ok := ipfs.lost.Load(c.String()); ok {
+		return []cid.Cid{c}, nil
+	}
+	return []cid.Cid{}, nil
+}
+
+func (ipfs *mockConnector) FindProviders(ctx context.Context, c cid.Cid, n int) ([]peer.ID, error) {
+	return []peer.ID{}, nil
+}
+
+func (ipfs *mockConnector) DAGSize(ctx context.Context, c cid.Cid) (uint64, error) {
+	if c.Equals(test.HugeCid) {
+		return 20000000000, nil
+	}
+	return 1000, nil
+}
+
 type mockTracer struct {
 	mockComponent
 }
 
 func testingCluster(t *testing.T) (*Cluster, *mockAPI, *mockConnector, PinTracker) {
+	ipfs := &mockConnector{}
+	cl, api, tracker := testingClusterWith(t, testingClusterOptions{ipfs: ipfs})
+	return cl, api, ipfs, tracker
+}
+
+// testingClusterOptions sets the components which testingClusterWith uses
+// instead of the default ones.
+type testingClusterOptions struct {
+	ipfs IPFSConnector
+	// wrapMonitor, when set, wraps the peer monitor.
+	wrapMonitor func(PeerMonitor) PeerMonitor
+	alertSinks  []AlertSink
+}
+
+func testingClusterWith(t *testing.T, opts testingClusterOptions) (*Cluster, *mockAPI, PinTracker) {
 	ident, clusterCfg, _, _, _, badgerCfg, levelDBCfg, raftCfg, crdtCfg, statelesstrackerCfg, psmonCfg, _, _, _ := testingConfigs()
 	ctx := context.Background()
 
@@ -162,7 +245,10 @@ func testingCluster(t *testing.T) (*Cluster, *mockAPI, *mockConnector, PinTracke
 
 	api := &mockAPI{}
 	proxy := &mockProxy{}
-	ipfs := &mockConnector{}
+	var ipfs IPFSConnector = &mockConnector{}
+	if opts.ipfs != nil {
+		ipfs = opts.ipfs
+	}
 
 	tracer := &mockTracer{}
 
@@ -175,10 +261,14 @@ func testingCluster(t *testing.T) (*Cluster, *mockAPI, *mockConnector, PinTracke
 		peersF = cons.Peers
 	}
 	psmonCfg.CheckInterval = 2 * time.Second
-	mon, err := pubsubmon.New(ctx, psmonCfg, pubsub, peersF)
+	psmon, err := pubsubmon.New(ctx, psmonCfg, pubsub, host, peersF, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
+	var mon PeerMonitor = psmon
+	if opts.wrapMonitor != nil {
+		mon = opts.wrapMonitor(mon)
+	}
 
 	alloc, err := balanced.New(&balanced.Config{
 		AllocateBy: []string{"numpin"},
@@ -205,13 +295,14 @@ func testingCluster(t *testing.T) (*Cluster, *mockAPI, *mockConnector, PinTracke
 		mon,
 		alloc,
 		[]Informer{inf},
+		opts.alertSinks,
 		tracer,
 	)
 	if err != nil {
 		t.Fatal("cannot create cluster:", err)
 	}
 	<-cl.Ready()
-	return cl, api, ipfs, tracker
+	return cl, api, tracker
 }
 
 func cleanState() {
@@ -279,11 +370,168 @@ func TestClusterID(t *testing.T) {
 	if id.Version != version.Version.String() {
 		t.Error("version should match current version")
 	}
+	switch consensus {
+	case "crdt":
+		if !id.Leaderless || id.Leader != "" {
+			t.Error("crdt peers should report no leader")
+		}
+	case "raft":
+		if id.Leaderless || id.Leader != cl.id {
+			t.Errorf("expected to be the raft leader: %s", id.Leader)
+		}
+	}
 	//if id.PublicKey == nil {
 	//	t.Error("publicKey should not be empty")
 	//}
 }
 
+// downConnector is a mockConnector which cannot reach IPFS.
+type downConnector struct {
+	*mockConnector
+}
+
+func (ipfs *downConnector) ID(ctx context.Context) (*api.IPFSID, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestClusterHealth(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	<-cl.Ready()
+
+	h := cl.Health(ctx)
+	if h.Peer != cl.id || h.IPFSError != "" || h.ConsensusError != "" {
+		t.Errorf("unexpected health: %+v", h)
+	}
+	if h.Status == api.HealthDown {
+		t.Error("the peer should not be down")
+	}
+	cl.Shutdown(ctx)
+	cleanState()
+
+	cl, _, _ = testingClusterWith(t, testingClusterOptions{
+		ipfs: &downConnector{&mockConnector{}},
+	})
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	h = cl.Health(ctx)
+	if h.Status != api.HealthDown || h.IPFSError == "" {
+		t.Errorf("expected the peer to be down without IPFS: %+v", h)
+	}
+}
+
+// countingAllocator counts the calls to the wrapped allocator.
+type countingAllocator struct {
+	PinAllocator
+	calls int
+}
+
+func (alloc *countingAllocator) Allocate(ctx context.Context, c cid.Cid, current, candidates, priority api.MetricsSet) ([]peer.ID, error) {
+	alloc.calls++
+	return alloc.PinAllocator.Allocate(ctx, c, current, candidates, priority)
+}
+
+func TestClusterPinUserAllocations(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	alloc := &countingAllocator{PinAllocator: cl.allocator}
+	cl.allocator = alloc
+
+	opts := api.PinOptions{
+		ReplicationFactorMin: -1,
+		ReplicationFactorMax: -1,
+		UserAllocations:      []peer.ID{cl.id, cl.id},
+	}
+	pin, err := cl.Pin(ctx, test.Cid1, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alloc.calls != 0 {
+		t.Error("the allocator should not be used with user allocations")
+	}
+	if len(pin.Allocations) != 1 || pin.Allocations[0] != cl.id {
+		t.Errorf("expected the pin to be allocated to the user allocations: %v", pin.Allocations)
+	}
+	if pin.ReplicationFactorMin != 1 || pin.ReplicationFactorMax != 1 {
+		t.Errorf("expected the replication factors to match the allocations: %d/%d", pin.ReplicationFactorMin, pin.ReplicationFactorMax)
+	}
+
+	opts.UserAllocations = []peer.ID{test.PeerID2}
+	if _, err := cl.Pin(ctx, test.Cid2, opts); err == nil {
+		t.Error("expected an error with user allocations which are not cluster peers")
+	}
+
+	opts.UserAllocations = []peer.ID{cl.id}
+	blPin := api.PinWithOpts(test.Cid2, opts)
+	if _, _, err := cl.pin(ctx, blPin, []peer.ID{cl.id}); err == nil {
+		t.Error("expected an error with user allocations which are blacklisted")
+	}
+}
+
+func TestClusterUpdate(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	_, err := cl.Update(ctx, test.Cid1, api.PinOptions{})
+	if err != state.ErrNotFound {
+		t.Fatal("expected ErrNotFound updating a missing pin:", err)
+	}
+
+	_, err = cl.Pin(ctx, test.Cid1, api.PinOptions{Name: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinDelay()
+
+	alloc := &countingAllocator{PinAllocator: cl.allocator}
+	cl.allocator = alloc
+
+	pin, err := cl.Update(ctx, test.Cid1, api.PinOptions{Name: "b", Metadata: map[string]string{"k": "v"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alloc.calls != 0 {
+		t.Error("the allocator should not be used when the allocations do not change")
+	}
+	pinDelay()
+
+	pin, err = cl.PinGet(ctx, test.Cid1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.Name != "b" || pin.Metadata["k"] != "v" {
+		t.Errorf("expected the options to be updated: %+v", pin.PinOptions)
+	}
+
+	_, err = cl.Update(ctx, test.Cid1, api.PinOptions{Metadata: map[string]string{"k": "", "k2": "v2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinDelay()
+
+	pin, err = cl.PinGet(ctx, test.Cid1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.Name != "b" {
+		t.Error("options which are not given should be kept:", pin.Name)
+	}
+	if _, ok := pin.Metadata["k"]; ok || pin.Metadata["k2"] != "v2" {
+		t.Errorf("expected the metadata to be merged: %v", pin.Metadata)
+	}
+
+	_, err = cl.Update(ctx, test.Cid1, api.PinOptions{PinUpdate: test.Cid2})
+	if err == nil {
+		t.Error("expected an error with the pin-update option")
+	}
+}
+
 func TestClusterPin(t *testing.T) {
 	ctx := context.Background()
 	cl, _, _, _ := testingCluster(t)
@@ -353,6 +601,133 @@ func TestClusterPinPath(t *testing.T) {
 	}
 }
 
+// ipnsConnector is a mockConnector whose IPNS names resolve to another CID.
+type ipnsConnector struct {
+	*mockConnector
+	resolved cid.Cid
+}
+
+func (ipfs *ipnsConnector) Resolve(ctx context.Context, path string) (cid.Cid, error) {
+	return ipfs.resolved, nil
+}
+
+func TestClusterPinPathIPNS(t *testing.T) {
+	ctx := context.Background()
+	cl, _, ipfs, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	_, err := cl.PinPath(ctx, test.PathIPNS1, api.PinOptions{Name: "followed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinDelay()
+
+	pin, err := cl.PinGet(ctx, test.CidResolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.IPNSName != test.PathIPNS1 {
+		t.Fatal("expected the IPNS name in the pin:", pin.IPNSName)
+	}
+
+	// Nothing changes while the name resolves to the same CID.
+	cl.resolveIPNS(ctx)
+	pinDelay()
+	if _, err := cl.PinGet(ctx, test.CidResolved); err != nil {
+		t.Fatal(err)
+	}
+
+	// The old CID is kept while the new one cannot be pinned.
+	cl.ipfs = &ipnsConnector{ipfs, test.ErrorCid}
+	cl.resolveIPNS(ctx)
+	pinDelay()
+	cl.resolveIPNS(ctx)
+	pinDelay()
+	if _, err := cl.PinGet(ctx, test.CidResolved); err != nil {
+		t.Fatal("the old CID should be kept until the new one is pinned:", err)
+	}
+
+	cl.ipfs = &ipnsConnector{ipfs, test.Cid2}
+	cl.resolveIPNS(ctx)
+	pinDelay()
+
+	pin, err = cl.PinGet(ctx, test.Cid2)
+	if err != nil {
+		t.Fatal("expected the new CID to be pinned:", err)
+	}
+	if pin.IPNSName != test.PathIPNS1 || pin.Name != "followed" || !pin.PinUpdate.Equals(test.CidResolved) {
+		t.Errorf("unexpected pin: %+v", pin)
+	}
+	if _, err := cl.PinGet(ctx, test.CidResolved); err != state.ErrNotFound {
+		t.Error("expected the old CID to be unpinned:", err)
+	}
+}
+
+// mfsConnector is a mockConnector whose MFS paths resolve to another CID.
+type mfsConnector struct {
+	*mockConnector
+	resolved cid.Cid
+}
+
+func (ipfs *mfsConnector) ResolveMFS(ctx context.Context, path string) (cid.Cid, error) {
+	return ipfs.resolved, nil
+}
+
+func TestClusterPinPathMFS(t *testing.T) {
+	ctx := context.Background()
+	cl, _, ipfs, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	_, err := cl.PinPath(ctx, test.PathMFS1, api.PinOptions{Name: "site"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinDelay()
+
+	pin, err := cl.PinGet(ctx, test.CidMFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.MFSPath != "/site/www" || pin.MFSPeer != cl.id {
+		t.Fatalf("expected the MFS path and peer in the pin: %s %s", pin.MFSPath, pin.MFSPeer)
+	}
+
+	// Nothing changes while the path resolves to the same CID.
+	cl.resolveMFS(ctx)
+	pinDelay()
+	if _, err := cl.PinGet(ctx, test.CidMFS); err != nil {
+		t.Fatal(err)
+	}
+
+	cl.ipfs = &mfsConnector{ipfs, test.Cid2}
+	cl.resolveMFS(ctx)
+	pinDelay()
+
+	pin, err = cl.PinGet(ctx, test.Cid2)
+	if err != nil {
+		t.Fatal("expected the new CID to be pinned:", err)
+	}
+	if pin.MFSPath != "/site/www" || pin.Name != "site" || !pin.PinUpdate.Equals(test.CidMFS) {
+		t.Errorf("unexpected pin: %+v", pin)
+	}
+	if _, err := cl.PinGet(ctx, test.CidMFS); err != state.ErrNotFound {
+		t.Error("expected the old CID to be unpinned:", err)
+	}
+
+	// Unpinning the path unpins the pin following it, even when the
+	// path changed since it was last resolved.
+	cl.ipfs = &mfsConnector{ipfs, test.Cid3}
+	pin, err = cl.UnpinPath(ctx, test.PathMFS1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pin.Cid.Equals(test.Cid2) {
+		t.Error("expected Cid2 to be unpinned:", pin.Cid)
+	}
+}
+
 func TestAddFile(t *testing.T) {
 	ctx := context.Background()
 	cl, _, _, _ := testingCluster(t)
@@ -805,7 +1180,7 @@ func TestClusterPins(t *testing.T) {
 	}
 }
 
-func TestClusterPinGet(t *testing.T) {
+func TestClusterPinsLinearizable(t *testing.T) {
 	ctx := context.Background()
 	cl, _, _, _ := testingCluster(t)
 	defer cleanState()
@@ -817,198 +1192,2247 @@ func TestClusterPinGet(t *testing.T) {
 		t.Fatal("pin should have worked:", err)
 	}
 
-	pin, err := cl.PinGet(ctx, c)
+	pins, err := cl.PinsLinearizable(ctx)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if !pin.Cid.Equals(c) || pin.ReplicationFactorMin != -1 || pin.ReplicationFactorMax != -1 {
-		t.Error("the Pin does not look as expected")
+	if len(pins) != 1 || !pins[0].Cid.Equals(c) {
+		t.Fatal("pin should be part of the state")
 	}
 
-	_, err = cl.PinGet(ctx, test.Cid2)
-	if err == nil {
-		t.Fatal("expected an error")
+	pin, err := cl.PinGetLinearizable(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pin.Cid.Equals(c) {
+		t.Error("the Pin does not look as expected")
 	}
 }
 
-func TestClusterUnpin(t *testing.T) {
+func TestClusterPinGet(t *testing.T) {
 	ctx := context.Background()
 	cl, _, _, _ := testingCluster(t)
 	defer cleanState()
 	defer cl.Shutdown(ctx)
 
 	c := test.Cid1
-	// Unpin should error without pin being committed to state
-	_, err := cl.Unpin(ctx, c)
-	if err == nil {
-		t.Error("unpin should have failed")
-	}
-
-	// Unpin after pin should succeed
-	_, err = cl.Pin(ctx, c, api.PinOptions{})
+	_, err := cl.Pin(ctx, c, api.PinOptions{})
 	if err != nil {
 		t.Fatal("pin should have worked:", err)
 	}
-	res, err := cl.Unpin(ctx, c)
+
+	pin, err := cl.PinGet(ctx, c)
 	if err != nil {
-		t.Error("unpin should have worked:", err)
+		t.Fatal(err)
 	}
-
-	if res.Type != api.DataType {
-		t.Error("unexpected pin type returned")
+	if !pin.Cid.Equals(c) || pin.ReplicationFactorMin != -1 || pin.ReplicationFactorMax != -1 {
+		t.Error("the Pin does not look as expected")
 	}
 
-	// test another error case
-	cl.consensus.Shutdown(ctx)
-	_, err = cl.Unpin(ctx, c)
+	_, err = cl.PinGet(ctx, test.Cid2)
 	if err == nil {
-		t.Error("expected an error but things worked")
+		t.Fatal("expected an error")
 	}
 }
 
-func TestClusterUnpinPath(t *testing.T) {
+func TestClusterBlockHolders(t *testing.T) {
 	ctx := context.Background()
-	cl, _, _, _ := testingCluster(t)
+	cl, _, ipfs, _ := testingCluster(t)
 	defer cleanState()
 	defer cl.Shutdown(ctx)
 
-	// Unpin should error without pin being committed to state
-	_, err := cl.UnpinPath(ctx, test.PathIPFS2)
+	c := test.Cid1
+	_, err := cl.BlockHolders(ctx, c, false)
 	if err == nil {
-		t.Error("unpin with path should have failed")
+		t.Error("expected an error for an item not in the pinset")
 	}
 
-	// Unpin after pin should succeed
-	pin, err := cl.PinPath(ctx, test.PathIPFS2, api.PinOptions{})
+	holders, err := cl.BlockHolders(ctx, c, true)
 	if err != nil {
-		t.Fatal("pin with path should have worked:", err)
+		t.Fatal(err)
 	}
-	if !pin.Cid.Equals(test.CidResolved) {
-		t.Error("expected a different cid, found", pin.Cid.String())
+	if len(holders) != 0 {
+		t.Error("expected no holders")
 	}
 
-	pin, err = cl.UnpinPath(ctx, test.PathIPFS2)
+	_, err = cl.Pin(ctx, c, api.PinOptions{})
 	if err != nil {
-		t.Error("unpin with path should have worked:", err)
+		t.Fatal("pin should have worked:", err)
 	}
-	if !pin.Cid.Equals(test.CidResolved) {
-		t.Error("expected a different cid, found", pin.Cid.String())
+	ipfs.blocks.Store(c.String(), []byte{})
+
+	holders, err = cl.BlockHolders(ctx, c, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holders) != 1 || holders[0] != cl.id {
+		t.Error("expected this peer to be the only holder")
 	}
 }
 
-func TestClusterPeers(t *testing.T) {
+func TestClusterPinDependency(t *testing.T) {
 	ctx := context.Background()
 	cl, _, _, _ := testingCluster(t)
 	defer cleanState()
 	defer cl.Shutdown(ctx)
-	peers := cl.Peers(ctx)
-	if len(peers) != 1 {
-		t.Fatal("expected 1 peer")
+
+	_, err := cl.Pin(ctx, test.Cid1, api.PinOptions{DependsOn: test.Cid2})
+	if err == nil {
+		t.Error("expected an error as the dependency is not in the pinset")
+	}
+
+	_, err = cl.Pin(ctx, test.Cid1, api.PinOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cl.Pin(ctx, test.Cid2, api.PinOptions{DependsOn: test.Cid1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cl.Pin(ctx, test.Cid1, api.PinOptions{DependsOn: test.Cid2})
+	if err == nil {
+		t.Error("expected an error as the dependency is cyclic")
+	}
+
+	_, err = cl.Pin(ctx, test.Cid3, api.PinOptions{DependsOn: test.Cid3})
+	if err == nil {
+		t.Error("expected an error as the item depends on itself")
+	}
+}
+
+func TestClusterPinExcludeLinks(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	_, err := cl.Pin(ctx, test.Cid1, api.PinOptions{
+		Mode:         api.PinModeDirect,
+		ExcludeLinks: []string{"thumbs"},
+	})
+	if err == nil {
+		t.Error("expected an error excluding links from a direct pin")
+	}
+
+	_, err = cl.Pin(ctx, test.Cid1, api.PinOptions{ExcludeLinks: []string{"[thumbs"}})
+	if err == nil {
+		t.Error("expected an error with a bad pattern")
+	}
+
+	pin, err := cl.Pin(ctx, test.Cid1, api.PinOptions{ExcludeLinks: []string{"thumbs"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pin.ExcludeLinks) != 1 {
+		t.Error("the pin should exclude links")
+	}
+}
+
+func TestClusterPinBatch(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	invalid := api.PinOptions{ReplicationFactorMin: 2, ReplicationFactorMax: 1}
+
+	// Best-effort: the valid pins are committed.
+	result, err := cl.PinBatch(ctx, &api.PinBatch{
+		Pins: []*api.Pin{
+			api.PinCid(test.Cid1),
+			api.PinWithOpts(test.Cid2, invalid),
+			api.PinCid(test.Cid3),
+			api.PinCid(test.Cid1),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Pinned != 2 || result.Failed != 2 || result.RolledBack {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if result.Items[0].Pin == nil || result.Items[1].Error == "" || result.Items[3].Error == "" {
+		t.Errorf("unexpected items: %+v", result.Items)
+	}
+	for _, c := range []cid.Cid{test.Cid1, test.Cid3} {
+		if _, err := cl.PinGet(ctx, c); err != nil {
+			t.Error("expected the valid pins to be committed:", err)
+		}
+	}
+	if _, err := cl.PinGet(ctx, test.Cid2); err != state.ErrNotFound {
+		t.Error("expected the invalid pin not to be committed")
+	}
+
+	// Atomic: nothing is committed when a pin is invalid.
+	result, err = cl.PinBatch(ctx, &api.PinBatch{
+		Pins: []*api.Pin{
+			api.PinCid(test.Cid4),
+			api.PinWithOpts(test.Cid5, invalid),
+		},
+		Atomic: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Pinned != 0 || result.Failed != 2 || result.RolledBack {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if _, err := cl.PinGet(ctx, test.Cid4); err != state.ErrNotFound {
+		t.Error("expected no pin of the atomic batch to be committed")
+	}
+
+	_, err = cl.PinBatch(ctx, &api.PinBatch{})
+	if err == nil {
+		t.Error("expected an error with an empty batch")
+	}
+}
+
+func TestClusterPinBatchRollback(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	_, err := cl.Pin(ctx, test.Cid1, api.PinOptions{Name: "before"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous, err := cl.PinGet(ctx, test.Cid1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pin1, err := cl.Pin(ctx, test.Cid1, api.PinOptions{Name: "after"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pin2, err := cl.Pin(ctx, test.Cid2, api.PinOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := &api.PinBatchResult{
+		Items: []api.PinBatchItem{
+			{Cid: test.Cid1, Pin: pin1},
+			{Cid: test.Cid2, Pin: pin2},
+			{Cid: test.Cid3, Error: "failed"},
+		},
+	}
+	cl.rollbackPinBatch(ctx, result, []*api.Pin{previous, nil, nil})
+	failBatch(result)
+
+	if !result.RolledBack || result.Pinned != 0 || result.Failed != 3 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	pin, err := cl.PinGet(ctx, test.Cid1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.Name != "before" {
+		t.Error("expected the previous pin to be restored:", pin.Name)
+	}
+	if _, err := cl.PinGet(ctx, test.Cid2); err != state.ErrNotFound {
+		t.Error("expected the new pin to be unpinned")
+	}
+}
+
+func TestClusterPinMaxDepth(t *testing.T) {
+	ctx := context.Background()
+	cl, _, ipfs, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	pin, err := cl.Pin(ctx, test.Cid1, api.PinOptions{Mode: api.PinModeDirect, MaxDepth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.MaxDepth != 0 {
+		t.Error("direct pins should ignore the max depth")
+	}
+
+	pin, err = cl.Pin(ctx, test.Cid1, api.PinOptions{MaxDepth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.MaxDepth != 2 || pin.Mode != api.PinModeRecursive {
+		t.Errorf("expected a recursive pin with max depth 2: %+v", pin)
+	}
+
+	pinDelay()
+
+	depth, ok := ipfs.pins.Load(test.Cid1.String())
+	if !ok || depth.(api.PinDepth) != 2 {
+		t.Errorf("expected ipfs to pin with max depth 2; got %v", depth)
+	}
+
+	info := cl.StatusLocal(ctx, test.Cid1)
+	if info.Status != api.TrackerStatusPinned {
+		t.Errorf("the shallow pin should be pinned: %s", info.Status)
+	}
+
+	pinget, err := cl.PinGet(ctx, test.Cid1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pinget.MaxDepth != 2 {
+		t.Errorf("expected the stored pin to keep max depth 2; got %d", pinget.MaxDepth)
+	}
+}
+
+func TestClusterCodecUnsupportedPeers(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	if peers := cl.codecUnsupportedPeers(ctx, test.Cid1); len(peers) != 0 {
+		t.Error("the codec should be supported by all peers")
+	}
+
+	gitCid := cid.NewCidV1(cid.GitRaw, test.Cid1.Hash())
+	peers := cl.codecUnsupportedPeers(ctx, gitCid)
+	if len(peers) != 1 || peers[0] != cl.id {
+		t.Error("expected the local peer not to support the codec")
+	}
+}
+
+func TestWriteHint(t *testing.T) {
+	metric := func(p peer.ID, weight int64, valid bool) *api.Metric {
+		m := &api.Metric{
+			Name:   "queuedepth",
+			Peer:   p,
+			Valid:  valid,
+			Weight: weight,
+		}
+		m.SetTTL(time.Minute)
+		return m
+	}
+
+	metrics := []*api.Metric{
+		metric(test.PeerID1, -20, true),
+		metric(test.PeerID2, -3, true),
+		metric(test.PeerID3, 0, false), // invalid
+		metric(test.PeerID4, -10, true),
+	}
+	if hint := writeHint(metrics); hint != test.PeerID2 {
+		t.Errorf("expected the least loaded peer to be suggested, got %s", hint)
+	}
+	weights := writeWeights(metrics)
+	if len(weights) != 3 ||
+		weights[peer.Encode(test.PeerID1)] != 1 ||
+		weights[peer.Encode(test.PeerID2)] != maxWriteWeight ||
+		weights[peer.Encode(test.PeerID4)] != 6 {
+		t.Errorf("unexpected write weights: %v", weights)
+	}
+
+	// Shares are capped however far apart the weights are.
+	weights = writeWeights([]*api.Metric{
+		metric(test.PeerID1, 0, true),
+		metric(test.PeerID2, 1<<40, true),
+	})
+	if weights[peer.Encode(test.PeerID1)] != 1 || weights[peer.Encode(test.PeerID2)] != maxWriteWeight {
+		t.Errorf("unexpected write weights with a large peer: %v", weights)
+	}
+
+	if hint := writeHint([]*api.Metric{metric(test.PeerID1, 0, false)}); hint != "" {
+		t.Errorf("expected no hint without valid metrics, got %s", hint)
+	}
+}
+
+func TestClusterIDWriteHint(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	id := cl.ID(ctx)
+	if !id.Leaderless {
+		if id.WriteHint != id.Leader {
+			t.Errorf("the leader should be suggested: %s", id.WriteHint)
+		}
+		return
+	}
+	if id.WriteHint != "" {
+		t.Errorf("no peer should be suggested without a write_hint_metric: %s", id.WriteHint)
+	}
+
+	cl.config.WriteHintMetric = "queuedepth"
+	m := &api.Metric{
+		Name:   "queuedepth",
+		Peer:   cl.id,
+		Valid:  true,
+		Weight: -1,
+	}
+	m.SetTTL(time.Minute)
+	if err := cl.monitor.PublishMetric(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	id = cl.ID(ctx)
+	if id.WriteHint != cl.id {
+		t.Errorf("expected this peer to be suggested, got %s", id.WriteHint)
+	}
+}
+
+func TestReprovidePeers(t *testing.T) {
+	candidates := []peer.ID{test.PeerID1, test.PeerID2, test.PeerID3}
+	reversed := []peer.ID{test.PeerID3, test.PeerID2, test.PeerID1}
+
+	counts := make(map[peer.ID]int)
+	for epoch := int64(0); epoch < 3; epoch++ {
+		designated := reprovidePeers(test.Cid1, candidates, 1, epoch)
+		if len(designated) != 1 {
+			t.Fatalf("expected one designated peer, got %d", len(designated))
+		}
+		other := reprovidePeers(test.Cid1, reversed, 1, epoch)
+		if other[0] != designated[0] {
+			t.Error("the order of the candidates should not matter")
+		}
+		counts[designated[0]]++
+	}
+	for _, p := range candidates {
+		if counts[p] != 1 {
+			t.Errorf("%s should have been designated once in 3 epochs: %d", p, counts[p])
+		}
+	}
+
+	if len(reprovidePeers(test.Cid1, candidates, 2, 0)) != 2 {
+		t.Error("expected two designated peers")
+	}
+	if len(reprovidePeers(test.Cid1, candidates, 5, 0)) != 3 {
+		t.Error("all the candidates should be designated")
+	}
+}
+
+func TestClusterReprovide(t *testing.T) {
+	ctx := context.Background()
+	cl, _, ipfs, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	cl.config.ReprovideStrategy = ReprovideRotate
+	cl.config.ReprovidePeers = 1
+
+	other := test.PeerID2
+	if other == cl.id {
+		other = test.PeerID3
+	}
+	shared := api.PinWithOpts(test.Cid1, api.PinOptions{
+		ReplicationFactorMin: 2,
+		ReplicationFactorMax: 2,
+	})
+	shared.Allocations = []peer.ID{cl.id, other}
+	remote := api.PinWithOpts(test.Cid2, api.PinOptions{
+		ReplicationFactorMin: 1,
+		ReplicationFactorMax: 1,
+	})
+	remote.Allocations = []peer.ID{other}
+	for _, p := range []*api.Pin{shared, remote} {
+		if err := cl.consensus.LogPin(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pinDelay()
+
+	ping := func(ttl time.Duration) {
+		m := &api.Metric{
+			Name:  pingMetricName,
+			Peer:  other,
+			Valid: true,
+		}
+		m.SetTTL(ttl)
+		cl.monitor.LogMetric(ctx, m)
+	}
+	ping(time.Minute)
+
+	interval := cl.config.ReprovideInterval
+	for epoch := int64(0); epoch < 2; epoch++ {
+		ipfs.provided = sync.Map{}
+		designated := reprovidePeers(test.Cid1, shared.Allocations, 1, epoch)[0]
+
+		cl.reprovide(ctx, time.Unix(0, epoch*int64(interval)))
+		_, provided := ipfs.provided.Load(test.Cid1.String())
+		if provided != (designated == cl.id) {
+			t.Errorf("epoch %d: %s designated, but this peer provided: %t", epoch, designated, provided)
+		}
+		if _, ok := ipfs.provided.Load(test.Cid2.String()); ok {
+			t.Error("items not allocated to this peer should not be provided")
+		}
+	}
+
+	// The peers which are down are skipped.
+	ping(0)
+	for epoch := int64(0); epoch < 2; epoch++ {
+		ipfs.provided = sync.Map{}
+		cl.reprovide(ctx, time.Unix(0, epoch*int64(interval)))
+		if _, ok := ipfs.provided.Load(test.Cid1.String()); !ok {
+			t.Errorf("epoch %d: the item should be provided when the other peer is down", epoch)
+		}
+	}
+
+	cl.config.ReprovideStrategy = ReprovideAll
+	ipfs.provided = sync.Map{}
+	cl.reprovide(ctx, time.Now())
+	if _, ok := ipfs.provided.Load(test.Cid1.String()); !ok {
+		t.Error("all the allocated items should be provided")
+	}
+}
+
+func TestClusterScrub(t *testing.T) {
+	ctx := context.Background()
+	cl, _, ipfs, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	_, err := cl.Pin(ctx, test.Cid1, api.PinOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinDelay()
+
+	pin, err := cl.PinGet(ctx, test.Cid1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed := cl.scrubPin(ctx, pin); len(failed) != 0 {
+		t.Fatal("no replicas should fail:", failed)
+	}
+
+	ipfs.lost.Store(test.Cid1.String(), struct{}{})
+	failed := cl.scrubPin(ctx, pin)
+	if len(failed) != 1 || failed[0] != cl.id {
+		t.Fatal("expected this peer to fail the check:", failed)
+	}
+
+	found := false
+	for _, alrt := range cl.Alerts() {
+		if alrt.Name == scrubAlertName && alrt.Peer == cl.id {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("expected a scrub alert")
+	}
+}
+
+// syncWaiters returns the number of callers waiting for the running Sync().
+func syncWaiters(cl *Cluster) int {
+	cl.syncingMux.Lock()
+	defer cl.syncingMux.Unlock()
+	if cl.syncing == nil {
+		return 0
+	}
+	return cl.syncing.waiters
+}
+
+func TestClusterSync(t *testing.T) {
+	ctx := context.Background()
+	cl, _, ipfs, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	_, err := cl.Pin(ctx, test.Cid1, api.PinOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinDelay()
+	ipfs.pins.Delete(test.Cid1.String())
+
+	gate := make(chan struct{})
+	ipfs.pinLsGate.Store(gate)
+
+	const n = 3
+	summaries := make([]*api.SyncSummary, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			summaries[i], errs[i] = cl.Sync(ctx)
+		}(i)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for syncWaiters(cl) != n {
+		if time.Now().After(deadline) {
+			t.Fatal("the calls did not wait for the same sync")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(gate)
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if summaries[i] != summaries[0] {
+			t.Error("expected all calls to get the same summary")
+		}
+	}
+	summary := summaries[0]
+	if summary.Peer != cl.id || summary.FinishedAt.Before(summary.StartedAt) {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+	if len(summary.Repinned) != 1 || !summary.Repinned[0].Equals(test.Cid1) {
+		t.Error("expected the unexpectedly unpinned item to be repinned:", summary.Repinned)
+	}
+
+	// A new sync runs once the last one is done.
+	summary2, err := cl.Sync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary2 == summary {
+		t.Error("expected a new sync")
+	}
+}
+
+func TestClusterSyncCancel(t *testing.T) {
+	ctx := context.Background()
+	cl, _, ipfs, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	gate := make(chan struct{})
+	ipfs.pinLsGate.Store(gate)
+	defer close(gate)
+
+	tctx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	_, err := cl.Sync(tctx)
+	if err != context.DeadlineExceeded {
+		t.Fatal("expected the sync to time out:", err)
+	}
+	if syncWaiters(cl) != 0 {
+		t.Error("expected the cancelled sync to be discarded")
+	}
+}
+
+func TestClusterVerify(t *testing.T) {
+	ctx := context.Background()
+	cl, _, ipfs, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	_, err := cl.Pin(ctx, test.Cid1, api.PinOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinDelay()
+
+	pinfo, err := cl.VerifyLocal(ctx, test.Cid1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pinfo.Status != api.TrackerStatusPinned {
+		t.Fatal("expected a healthy pin:", pinfo.Status)
+	}
+
+	ipfs.lost.Store(test.Cid1.String(), struct{}{})
+	gpi, err := cl.Verify(ctx, test.Cid1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, ok := gpi.PeerMap[peer.Encode(cl.id)]
+	if !ok {
+		t.Fatal("expected info for this peer")
+	}
+	if info.Status != api.TrackerStatusPinDegraded {
+		t.Fatal("expected a degraded pin:", info.Status)
+	}
+	if len(info.MissingBlocks) != 1 || !info.MissingBlocks[0].Equals(test.Cid1) {
+		t.Error("expected the missing block:", info.MissingBlocks)
+	}
+
+	// The tracker does not keep the degraded status.
+	if st := cl.StatusLocal(ctx, test.Cid1).Status; st != api.TrackerStatusPinned {
+		t.Error("expected the tracker status to remain pinned:", st)
+	}
+}
+
+func TestClusterSplitBrain(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	_, err := cl.Pin(ctx, test.Cid1, api.PinOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinDelay()
+
+	self, err := cl.stateDigest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if self.Digest == "" || self.Peer != cl.id {
+		t.Errorf("unexpected digest: %+v", self)
+	}
+
+	_, err = cl.Pin(ctx, test.Cid2, api.PinOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinDelay()
+
+	updated, err := cl.stateDigest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Digest == self.Digest {
+		t.Error("the digest should change when the state changes")
+	}
+	self = updated
+
+	if fp := cl.checkSplitBrain(ctx, ""); fp != "" {
+		t.Error("a single peer cannot be in split brain")
+	}
+
+	same := &api.StateDigest{Peer: test.PeerID2, Digest: self.Digest, Leader: self.Leader}
+	other := &api.StateDigest{Peer: test.PeerID3, Digest: "abcd", Leader: self.Leader}
+	diverged := divergedPeers(self, []*api.StateDigest{self, same, other})
+	if len(diverged) != 1 || diverged[0].Peer != test.PeerID3 {
+		t.Errorf("expected only %s to diverge: %v", test.PeerID3, diverged)
+	}
+
+	// A follower of a different leader, or of none, is stranded when we
+	// have a leader.
+	leaderSelf := &api.StateDigest{Peer: cl.id, Digest: self.Digest, Leader: cl.id}
+	stranded := &api.StateDigest{Peer: test.PeerID2, Digest: self.Digest}
+	if len(divergedPeers(leaderSelf, []*api.StateDigest{stranded})) != 1 {
+		t.Error("expected a peer without leader to be reported")
+	}
+	if len(divergedPeers(stranded, []*api.StateDigest{leaderSelf})) != 0 {
+		t.Error("leaderless peers cannot tell about leaders")
+	}
+}
+
+func TestClusterPinsDiff(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	opts := api.PinOptions{ReplicationFactorMin: -1, ReplicationFactorMax: -1}
+	changedOpts := opts
+	changedOpts.Name = "changed"
+	local := []*api.Pin{
+		api.PinWithOpts(test.Cid1, opts),
+		api.PinWithOpts(test.Cid2, opts),
+		api.PinWithOpts(test.Cid3, opts),
+	}
+	remote := []*api.Pin{
+		api.PinWithOpts(test.Cid2, opts),
+		api.PinWithOpts(test.Cid3, changedOpts),
+		api.PinWithOpts(test.Cid4, opts),
+	}
+	diff := diffPins(local, remote)
+	if len(diff.Added) != 1 || !diff.Added[0].Cid.Equals(test.Cid4) {
+		t.Errorf("expected Cid4 to be added: %v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || !diff.Removed[0].Cid.Equals(test.Cid1) {
+		t.Errorf("expected Cid1 to be removed: %v", diff.Removed)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].Name != "changed" {
+		t.Errorf("expected the remote version of Cid3 to be changed: %v", diff.Changed)
+	}
+	same := []*api.Pin{
+		api.PinWithOpts(test.Cid1, opts),
+		api.PinWithOpts(test.Cid2, opts),
+		api.PinWithOpts(test.Cid3, opts),
+	}
+	if d := diffPins(local, same); len(d.Added)+len(d.Removed)+len(d.Changed) != 0 {
+		t.Errorf("identical states should not differ: %+v", d)
+	}
+
+	_, err := cl.Pin(ctx, test.Cid1, api.PinOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinDelay()
+
+	// Diffing against ourselves goes through a local RPC call.
+	diff, err = cl.PinsDiff(ctx, cl.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.Error != "" || len(diff.Added)+len(diff.Removed)+len(diff.Changed) != 0 {
+		t.Errorf("a peer should agree with itself: %+v", diff)
+	}
+
+	diff, err = cl.PinsDiff(ctx, test.PeerID2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.Error == "" || diff.Peer != test.PeerID2 {
+		t.Errorf("expected an error note for an unreachable peer: %+v", diff)
+	}
+}
+
+func TestClusterCommitHooks(t *testing.T) {
+	ctx := context.Background()
+	commitHookCheckInterval = 100 * time.Millisecond
+	commitHookRetryDelay = 100 * time.Millisecond
+	defer func() {
+		commitHookCheckInterval = 5 * time.Second
+		commitHookRetryDelay = 5 * time.Second
+	}()
+
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	received := make(chan *api.Pin, 1)
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var pin api.Pin
+		if err := json.NewDecoder(r.Body).Decode(&pin); err != nil {
+			t.Error(err)
+		}
+		received <- &pin
+	}))
+	defer srv.Close()
+
+	cl.config.CommitHookURL = srv.URL
+	_, err := cl.Pin(ctx, test.Cid1, api.PinOptions{Name: "hooked"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case pin := <-received:
+		if !pin.Cid.Equals(test.Cid1) || pin.Name != "hooked" {
+			t.Error("unexpected pin in commit hook")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the commit hook did not run")
+	}
+
+	cl.commitsMux.Lock()
+	defer cl.commitsMux.Unlock()
+	if len(cl.commits) != 0 {
+		t.Error("committed pins should not be watched anymore")
+	}
+}
+
+func TestClusterPinReceipt(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	_, err := cl.PinReceipt(ctx, test.Cid1)
+	if err == nil {
+		t.Error("expected an error for an item which is not pinned")
+	}
+
+	_, err = cl.Pin(ctx, test.Cid1, api.PinOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinDelay()
+
+	receipt, err := cl.PinReceipt(ctx, test.Cid1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Signer != cl.id {
+		t.Error("the receipt should be signed by the peer")
+	}
+	if len(receipt.Peers) != 1 || receipt.Peers[0] != cl.id {
+		t.Error("unexpected peers in the receipt")
+	}
+	if err := cl.VerifyReceipt(ctx, receipt); err != nil {
+		t.Error("the receipt should verify:", err)
+	}
+}
+
+func TestClusterMaintenance(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	err := cl.SetMaintenance(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cl.InMaintenance() || !cl.ID(ctx).Maintenance {
+		t.Error("cluster should be in maintenance")
+	}
+
+	// the mode is restored from the datastore
+	cl.maintenanceMux.Lock()
+	cl.maintenance = false
+	cl.maintenanceMux.Unlock()
+	if !cl.loadMaintenance(ctx) || !cl.InMaintenance() {
+		t.Error("maintenance mode should have been persisted")
+	}
+
+	// explicit operations keep working
+	_, err = cl.Pin(ctx, test.Cid1, api.PinOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cl.SetMaintenance(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cl.InMaintenance() {
+		t.Error("cluster should not be in maintenance")
+	}
+	if cl.loadMaintenance(ctx) {
+		t.Error("maintenance mode should have been cleared from the datastore")
+	}
+}
+
+func TestClusterPinTimestamps(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	c := test.Cid1
+	_, err := cl.Pin(ctx, c, api.PinOptions{Name: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pin, err := cl.PinGet(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.CreatedAt.IsZero() || !pin.CreatedAt.Equal(pin.Timestamp) {
+		t.Error("a new pin should have matching creation and update times")
+	}
+	createdAt := pin.CreatedAt
+
+	_, err = cl.Pin(ctx, c, api.PinOptions{Name: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pin, err = cl.PinGet(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pin.CreatedAt.Equal(createdAt) {
+		t.Error("modifying a pin should keep the creation time")
+	}
+	if pin.Timestamp.Before(createdAt) || pin.Name != "b" {
+		t.Error("modifying a pin should update it")
+	}
+
+	gpi, err := cl.Status(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gpi.CreatedAt.Equal(createdAt) || !gpi.UpdatedAt.Equal(pin.Timestamp) {
+		t.Error("status should include the pin timestamps")
+	}
+}
+
+func TestClusterUnpin(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	c := test.Cid1
+	// Unpin should error without pin being committed to state
+	_, err := cl.Unpin(ctx, c)
+	if err == nil {
+		t.Error("unpin should have failed")
+	}
+
+	// Unpin after pin should succeed
+	_, err = cl.Pin(ctx, c, api.PinOptions{})
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+	res, err := cl.Unpin(ctx, c)
+	if err != nil {
+		t.Error("unpin should have worked:", err)
+	}
+
+	if res.Type != api.DataType {
+		t.Error("unexpected pin type returned")
+	}
+
+	// test another error case
+	cl.consensus.Shutdown(ctx)
+	_, err = cl.Unpin(ctx, c)
+	if err == nil {
+		t.Error("expected an error but things worked")
+	}
+}
+
+func TestClusterUnpinPath(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	// Unpin should error without pin being committed to state
+	_, err := cl.UnpinPath(ctx, test.PathIPFS2)
+	if err == nil {
+		t.Error("unpin with path should have failed")
+	}
+
+	// Unpin after pin should succeed
+	pin, err := cl.PinPath(ctx, test.PathIPFS2, api.PinOptions{})
+	if err != nil {
+		t.Fatal("pin with path should have worked:", err)
+	}
+	if !pin.Cid.Equals(test.CidResolved) {
+		t.Error("expected a different cid, found", pin.Cid.String())
+	}
+
+	pin, err = cl.UnpinPath(ctx, test.PathIPFS2)
+	if err != nil {
+		t.Error("unpin with path should have worked:", err)
+	}
+	if !pin.Cid.Equals(test.CidResolved) {
+		t.Error("expected a different cid, found", pin.Cid.String())
+	}
+}
+
+func TestClusterPeers(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+	peers := cl.Peers(ctx)
+	if len(peers) != 1 {
+		t.Fatal("expected 1 peer")
+	}
+
+	ident := &config.Identity{}
+	err := ident.LoadJSON(testingIdentity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if peers[0].ID != ident.ID {
+		fmt.Println(peers[0].ID)
+		fmt.Println(ident.ID)
+		t.Error("bad member")
+	}
+}
+
+func TestVersion(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+	if cl.Version() != version.Version.String() {
+		t.Error("bad Version()")
+	}
+}
+
+func TestClusterRecoverAllLocal(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	_, err := cl.Pin(ctx, test.Cid1, api.PinOptions{})
+	if err != nil {
+		t.Fatal("pin should have worked:", err)
+	}
+
+	pinDelay()
+
+	recov, err := cl.RecoverAllLocal(ctx)
+	if err != nil {
+		t.Error("did not expect an error")
+	}
+	if len(recov) != 1 {
+		t.Fatalf("there should be only one pin, got = %d", len(recov))
+	}
+	if recov[0].Status != api.TrackerStatusPinned {
+		t.Errorf("the pin should have been recovered, got = %v", recov[0].Status)
+	}
+}
+
+func TestClusterRepoGC(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	gRepoGC, err := cl.RepoGC(ctx)
+	if err != nil {
+		t.Fatal("gc should have worked:", err)
+	}
+
+	if gRepoGC.PeerMap == nil {
+		t.Fatal("expected a non-nil peer map")
+	}
+
+	if len(gRepoGC.PeerMap) != 1 {
+		t.Error("expected repo gc information for one peer")
+	}
+	for _, repoGC := range gRepoGC.PeerMap {
+		testRepoGC(t, repoGC)
+	}
+
+}
+
+func TestClusterRepoGCLocal(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	repoGC, err := cl.RepoGCLocal(ctx)
+	if err != nil {
+		t.Fatal("gc should have worked:", err)
+	}
+
+	testRepoGC(t, repoGC)
+}
+
+func TestClusterDetectDuplicatePeer(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	ping := func(p peer.ID, v string) *api.Metric {
+		return &api.Metric{Name: pingMetricName, Peer: p, Value: v, Valid: true}
+	}
+
+	// A restarting peer changes its instance ID only once.
+	for _, v := range []string{"a", "a", "b", "b", "c"} {
+		if cl.detectDuplicatePeer(ping(test.PeerID2, v)) {
+			t.Fatal("restarted peer should not be detected as duplicate")
+		}
+	}
+
+	// Our own pings and pings without instance ID are ignored.
+	for _, v := range []string{"a", "b", "a"} {
+		if cl.detectDuplicatePeer(ping(cl.id, v)) {
+			t.Fatal("our own pings should be ignored")
+		}
+		if cl.detectDuplicatePeer(ping(test.PeerID3, "")) {
+			t.Fatal("empty pings should be ignored")
+		}
+	}
+
+	// Two processes alternate between their IDs.
+	cl.detectDuplicatePeer(ping(test.PeerID4, "a"))
+	cl.detectDuplicatePeer(ping(test.PeerID4, "b"))
+	if !cl.detectDuplicatePeer(ping(test.PeerID4, "a")) {
+		t.Error("duplicate peer should have been detected")
+	}
+}
+
+func TestClusterAllocationCooldown(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.AllocationCooldown = time.Minute
+	cl := &Cluster{
+		config:    cfg,
+		startTime: time.Now().Add(-time.Hour),
+		peersSeen: map[peer.ID]time.Time{
+			test.PeerID1: {}, // long-time peer
+			test.PeerID2: time.Now().Add(-30 * time.Second),
+		},
+	}
+
+	m1 := &api.Metric{Name: "freespace", Peer: test.PeerID1, Weight: 100}
+	m2 := &api.Metric{Name: "freespace", Peer: test.PeerID2, Weight: 300}
+	m3 := &api.Metric{Name: "freespace", Peer: test.PeerID3, Weight: 300}
+	mSet := api.MetricsSet{
+		"freespace": []*api.Metric{m1, m2, m3},
+	}
+	cl.applyAllocationCooldown(mSet)
+
+	metrics := mSet["freespace"]
+	if w := metrics[0].GetWeight(); w != 100 {
+		t.Error("long-time peer weight should not change:", w)
+	}
+	if w := metrics[1].GetWeight(); w < 190 || w > 210 {
+		t.Error("peer half-way through cooldown should have half the weight:", w)
+	}
+	if w := metrics[2].GetWeight(); w != 100 {
+		t.Error("peer seen for the first time should have the lowest weight:", w)
+	}
+	if m2.Weight != 300 {
+		t.Error("original metrics should not be modified")
+	}
+}
+
+func testRepoGC(t *testing.T, repoGC *api.RepoGC) {
+	if repoGC.Peer == "" {
+		t.Error("expected a cluster ID")
+	}
+	if repoGC.Error != "" {
+		t.Error("did not expect any error")
+	}
+
+	if repoGC.Keys == nil {
+		t.Fatal("expected a non-nil array of IPFSRepoGC")
+	}
+
+	if len(repoGC.Keys) == 0 {
+		t.Fatal("expected at least one key, but found none")
+	}
+
+	if !repoGC.Keys[0].Key.Equals(test.Cid1) {
+		t.Errorf("expected a different cid, expected: %s, found: %s", test.Cid1, repoGC.Keys[0].Key)
+	}
+}
+
+func TestReallocationShare(t *testing.T) {
+	peers := []peer.ID{test.PeerID1, test.PeerID2, test.PeerID3, test.PeerID4, test.PeerID5}
+
+	for _, total := range []int{1, 3, 5, 12} {
+		gotSlot := make(map[peer.ID]bool)
+		for w := 0; w < len(peers); w++ {
+			now := time.Unix(0, 0).Add(time.Duration(w) * reallocationSlotWindow)
+			sum := 0
+			for _, p := range peers {
+				share := reallocationShare(total, peers, p, now)
+				if share > 0 {
+					gotSlot[p] = true
+				}
+				sum += share
+			}
+			if sum != total {
+				t.Errorf("total %d: shares add up to %d", total, sum)
+			}
+
+			// slots do not move before the window ends
+			end := reallocationWindowEnd(now.Add(time.Second))
+			last := end.Add(-time.Nanosecond)
+			for _, p := range peers {
+				if reallocationShare(total, peers, p, now) != reallocationShare(total, peers, p, last) {
+					t.Errorf("total %d: share of %s changed within a window", total, p)
+				}
+			}
+			if !end.Equal(now.Add(reallocationSlotWindow)) {
+				t.Errorf("unexpected end of window: %s", end)
+			}
+		}
+		if len(gotSlot) != len(peers) {
+			t.Errorf("total %d: every peer should get a slot eventually", total)
+		}
+	}
+
+	if reallocationShare(3, peers, test.PeerID6, time.Now()) != 0 {
+		t.Error("peers outside the peerset should get no slots")
+	}
+}
+
+func TestInformerInterval(t *testing.T) {
+	ival := newInformerInterval(time.Second, 8*time.Second)
+	metric := func(v string) []*api.Metric {
+		return []*api.Metric{{Name: "freespace", Value: v}}
+	}
+
+	steps := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"1000", time.Second},     // first value
+		{"1000", 2 * time.Second}, // stable
+		{"1005", 4 * time.Second}, // within tolerance
+		{"1009", 8 * time.Second}, // within tolerance
+		{"1009", 8 * time.Second}, // capped at max
+		{"1011", 4 * time.Second}, // drifted over the tolerance
+		{"2000", 2 * time.Second},
+		{"abc", time.Second},
+		{"def", time.Second}, // capped at min
+	}
+	for i, s := range steps {
+		if d := ival.next(metric(s.value)); d != s.expected {
+			t.Errorf("step %d: expected %s, got %s", i, s.expected, d)
+		}
+	}
+}
+
+func TestClusterPinPlacementEverywhere(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	_, err := cl.Pin(ctx, test.Cid1, api.PinOptions{
+		ReplicationFactorMin: -1,
+		ReplicationFactorMax: -1,
+		Placement:            "region>=1",
+	})
+	if err == nil {
+		t.Error("expected an error with placement rules and replication -1")
+	}
+}
+
+func TestPlacementPlanSelectPeers(t *testing.T) {
+	rules, err := api.ParsePlacement("region>=1,rack<=1,tier!=cold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := &placementPlan{
+		rules: rules,
+		tags: map[peer.ID]map[string]string{
+			test.PeerID1: {"region": "eu", "rack": "a"},
+			test.PeerID2: {"region": "eu", "rack": "a"},
+			test.PeerID3: {"region": "eu", "rack": "b"},
+			test.PeerID4: {"region": "us", "rack": "c"},
+			test.PeerID5: {"region": "ap", "rack": "d", "tier": "cold"},
+		},
+	}
+
+	disallowed := plan.disallowed()
+	if len(disallowed) != 1 || disallowed[0] != test.PeerID5 {
+		t.Fatal("only PeerID5 should be disallowed:", disallowed)
+	}
+
+	// the allocator prefers eu peers, but one replica must go to us and
+	// a rack can only hold one.
+	candidates := []peer.ID{test.PeerID1, test.PeerID2, test.PeerID3, test.PeerID4}
+	selected := plan.selectPeers(nil, candidates, 3)
+	expected := []peer.ID{test.PeerID1, test.PeerID4, test.PeerID3}
+	if len(selected) != len(expected) {
+		t.Fatalf("expected %s, got %s", expected, selected)
+	}
+	for i := range expected {
+		if selected[i] != expected[i] {
+			t.Fatalf("expected %s, got %s", expected, selected)
+		}
+	}
+
+	// current allocations count towards the limits.
+	selected = plan.selectPeers([]peer.ID{test.PeerID3}, []peer.ID{test.PeerID1, test.PeerID2}, 2)
+	if len(selected) != 1 || selected[0] != test.PeerID1 {
+		t.Error("expected only PeerID1 to be selected:", selected)
+	}
+}
+
+func TestPlacementPlanAffinity(t *testing.T) {
+	tags := map[peer.ID]map[string]string{
+		test.PeerID1: {"dc": "a", "rack": "a1"},
+		test.PeerID2: {"dc": "a", "rack": "a1"},
+		test.PeerID3: {"dc": "a", "rack": "a2"},
+		test.PeerID4: {"dc": "b", "rack": "b1"},
+		test.PeerID5: {"dc": "b", "rack": "b2"},
+		test.PeerID6: {"dc": "b", "rack": "b3"},
+	}
+	candidates := []peer.ID{test.PeerID1, test.PeerID2, test.PeerID3, test.PeerID4, test.PeerID5, test.PeerID6}
+
+	planFor := func(meta map[string]string) *placementPlan {
+		po := &api.PinOptions{Metadata: meta}
+		rules, err := api.ParsePlacement(po.EffectivePlacement())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &placementPlan{rules: rules, tags: tags}
+	}
+
+	// No two replicas on the same rack.
+	plan := planFor(map[string]string{api.AntiAffinityMetaKey: "rack"})
+	selected := plan.selectPeers(nil, candidates, 4)
+	racks := make(map[string]bool)
+	for _, p := range selected {
+		racks[tags[p]["rack"]] = true
+	}
+	if len(selected) != 4 || len(racks) != 4 {
+		t.Errorf("expected 4 replicas on different racks: %s", selected)
+	}
+
+	// All replicas in the same dc, on different racks: "a" is preferred
+	// but only "b" has 3 racks.
+	plan = planFor(map[string]string{
+		api.AffinityMetaKey:     "dc",
+		api.AntiAffinityMetaKey: "rack",
+	})
+	selected = plan.selectPeers(nil, candidates, 3)
+	expected := []peer.ID{test.PeerID4, test.PeerID5, test.PeerID6}
+	if fmt.Sprint(selected) != fmt.Sprint(expected) {
+		t.Errorf("expected %s, got %s", expected, selected)
+	}
+	selected = plan.selectPeers(nil, candidates, 2)
+	if len(selected) != 2 || tags[selected[0]]["dc"] != "a" {
+		t.Errorf("expected 2 replicas in dc a: %s", selected)
+	}
+	selected = plan.selectPeers([]peer.ID{test.PeerID4}, candidates, 2)
+	if len(selected) != 2 {
+		t.Fatalf("expected 2 more replicas in dc b: %s", selected)
+	}
+	for _, p := range selected {
+		if tags[p]["dc"] != "b" {
+			t.Errorf("expected replicas along with the current one in dc b: %s", selected)
+		}
+	}
+
+	// Constraints that cannot be satisfied leave the pin under-replicated.
+	plan = planFor(map[string]string{api.AffinityMetaKey: "zone"})
+	if selected := plan.selectPeers(nil, candidates, 2); len(selected) != 0 {
+		t.Errorf("no peer has a zone tag: %s", selected)
+	}
+}
+
+func TestOpLog(t *testing.T) {
+	if newOpLog(0) != nil {
+		t.Fatal("a zero-sized oplog should be disabled")
+	}
+
+	l := newOpLog(3)
+	pin := api.PinCid(test.Cid1)
+	pin.CreatedAt = pin.Timestamp
+	l.recordPin(pin)
+	updated := *pin
+	updated.Timestamp = pin.Timestamp.Add(time.Second)
+	l.recordPin(&updated)
+	l.recordUnpin(test.Cid1)
+
+	ops, first, last, _, err := l.after(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != 1 || last != 3 || len(ops) != 3 {
+		t.Fatalf("unexpected log: first %d, last %d, %d ops", first, last, len(ops))
+	}
+	types := []api.OperationType{api.OperationPin, api.OperationUpdate, api.OperationUnpin}
+	for i, op := range ops {
+		if op.Seq != uint64(i+1) || op.Type != types[i] {
+			t.Errorf("op %d: unexpected seq %d or type %s", i, op.Seq, op.Type)
+		}
+	}
+
+	ops, _, _, _, _ = l.after(1, 1)
+	if len(ops) != 1 || ops[0].Seq != 2 {
+		t.Error("expected only the operation after 1")
+	}
+	ops, _, _, _, _ = l.after(3, 10)
+	if len(ops) != 0 {
+		t.Error("expected no operations after the last one")
+	}
+
+	// Overwrite the first entry.
+	l.recordPin(api.PinCid(test.Cid2))
+	_, _, _, _, err = l.after(0, 10)
+	if api.KindOf(err) != api.ErrorKindExpired {
+		t.Error("expected an expired error:", err)
+	}
+	ops, first, last, updatedCh, err := l.after(1, 10)
+	if err != nil || first != 2 || last != 4 || len(ops) != 3 {
+		t.Fatal("unexpected log after wrapping around:", err)
+	}
+
+	go l.recordUnpin(test.Cid2)
+	select {
+	case <-updatedCh:
+	case <-time.After(time.Second):
+		t.Fatal("expected to be notified of new operations")
+	}
+}
+
+func TestFallbackAllocator(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	strict, err := balanced.New(&balanced.Config{
+		AllocateBy: []string{"tag:region", "numpin"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	numpinMetric := &api.Metric{
+		Name:  "numpin",
+		Peer:  cl.id,
+		Value: "0",
+		Valid: true,
+	}
+	numpinMetric.SetTTL(time.Minute)
+	cl.monitor.LogMetric(ctx, numpinMetric)
+
+	// No peer has a region tag.
+	opts := api.PinOptions{
+		ReplicationFactorMin: 1,
+		ReplicationFactorMax: 1,
+	}
+	numpin := cl.allocator
+	cl.allocator = strict
+	_, err = cl.Pin(ctx, test.Cid1, opts)
+	if !errors.Is(err, api.ErrUnderReplicated) {
+		t.Fatal("expected an under-replicated error:", err)
+	}
+
+	cl.allocator = NewFallbackAllocator(strict, numpin)
+	pin, err := cl.Pin(ctx, test.Cid1, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pin.Allocations) != 1 || pin.Allocations[0] != cl.id {
+		t.Error("expected the pin to be allocated by the fallback allocator:", pin.Allocations)
+	}
+}
+
+func TestClusterAllocationsAudit(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	other := test.PeerID1
+	if other == cl.id {
+		other = test.PeerID2
+	}
+	weights := map[peer.ID]int64{cl.id: 5, other: 3}
+	for p, w := range weights {
+		m := &api.Metric{
+			Name:   "numpin",
+			Peer:   p,
+			Value:  "0",
+			Weight: w,
+			Valid:  true,
+		}
+		m.SetTTL(time.Minute)
+		cl.monitor.LogMetric(ctx, m)
+	}
+
+	pin, err := cl.Pin(ctx, test.Cid1, api.PinOptions{
+		ReplicationFactorMin: 1,
+		ReplicationFactorMax: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decisions, err := cl.AllocationsAudit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decisions) != 1 {
+		t.Fatal("expected 1 allocation decision:", len(decisions))
+	}
+	d := decisions[0]
+	if !d.Cid.Equals(test.Cid1) || d.ReplicationFactorMin != 1 || d.Error != "" {
+		t.Errorf("unexpected decision: %+v", d)
+	}
+	if len(d.Allocations) != 1 || d.Allocations[0] != pin.Allocations[0] {
+		t.Errorf("expected the chosen allocations %s: %s", pin.Allocations, d.Allocations)
+	}
+	if len(d.Candidates) != 2 {
+		t.Fatal("expected 2 candidates:", len(d.Candidates))
+	}
+	for _, cand := range d.Candidates {
+		if w, ok := weights[cand.Peer]; !ok || cand.Scores["numpin"] != w {
+			t.Errorf("unexpected candidate %s with scores %v", cand.Peer, cand.Scores)
+		}
+	}
+
+	// Failed allocations are recorded too, and come first.
+	_, err = cl.Pin(ctx, test.Cid2, api.PinOptions{
+		ReplicationFactorMin: 3,
+		ReplicationFactorMax: 3,
+	})
+	if err == nil {
+		t.Fatal("expected an allocation error")
+	}
+	decisions, _ = cl.AllocationsAudit(ctx)
+	if len(decisions) != 2 || !decisions[0].Cid.Equals(test.Cid2) || decisions[0].Error == "" {
+		t.Error("expected the failed allocation to be recorded first")
+	}
+
+	// Dry runs are not recorded.
+	_, err = cl.Pin(ctx, test.Cid3, api.PinOptions{
+		ReplicationFactorMin: 1,
+		ReplicationFactorMax: 1,
+		DryRun:               true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decisions, _ = cl.AllocationsAudit(ctx)
+	if len(decisions) != 2 {
+		t.Error("dry-run allocations should not be recorded:", len(decisions))
+	}
+}
+
+func TestAllocationAuditSize(t *testing.T) {
+	audit := newAllocationAudit(2)
+	for _, c := range []cid.Cid{test.Cid1, test.Cid2, test.Cid3} {
+		audit.record(c, 1, 1, classifiedMetrics{}, nil, nil)
+	}
+	decisions := audit.recent()
+	if len(decisions) != 2 || !decisions[0].Cid.Equals(test.Cid3) || !decisions[1].Cid.Equals(test.Cid2) {
+		t.Error("expected the last 2 decisions, most recent first")
+	}
+
+	if newAllocationAudit(0) != nil {
+		t.Error("the audit should be disabled")
+	}
+}
+
+func TestClusterDeletedPins(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	ts := cl.tombstones
+	cl.tombstones = nil
+	if _, err := cl.DeletedPins(ctx, time.Time{}); err == nil {
+		t.Fatal("expected an error with tombstones disabled")
+	}
+	cl.tombstones = ts
+
+	_, err := cl.Pin(ctx, test.Cid1, api.PinOptions{Name: "first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinDelay()
+	if _, err := cl.unpin(ctx, test.Cid1, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	tombstones, err := cl.DeletedPins(ctx, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tombstones) != 1 {
+		t.Fatal("expected 1 tombstone:", len(tombstones))
+	}
+	first := tombstones[0]
+	if !first.Cid.Equals(test.Cid1) || first.Name != "first" || first.UnpinnedBy != "alice" || first.Peer != cl.id {
+		t.Errorf("unexpected tombstone: %+v", first)
+	}
+
+	// Tombstones do not prevent pinning the item again.
+	pinDelay()
+	_, err = cl.Pin(ctx, test.Cid1, api.PinOptions{Name: "second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinDelay()
+	if _, err := cl.PinGet(ctx, test.Cid1); err != nil {
+		t.Fatal("the item should be pinned again:", err)
+	}
+	// Unpins through the RPC record the identity in the context, not
+	// one in the metadata of the request.
+	forged := api.PinCid(test.Cid1)
+	forged.Metadata = map[string]string{"unpinned_by": "mallory"}
+	if err := cl.rpcClient.CallContext(ctx, "", "Cluster", "Unpin", forged, &api.Pin{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tombstones, _ = cl.DeletedPins(ctx, time.Time{})
+	if len(tombstones) != 2 || tombstones[0].Name != "second" || tombstones[0].UnpinnedBy != "" {
+		t.Fatalf("expected the last tombstone first: %+v", tombstones)
+	}
+	tombstones, _ = cl.DeletedPins(ctx, first.UnpinnedAt)
+	if len(tombstones) != 1 || tombstones[0].Name != "second" {
+		t.Errorf("expected only the tombstone after the first one: %+v", tombstones)
+	}
+
+	// Tombstones expire after the retention.
+	later := time.Now().Add(2 * time.Hour)
+	tombstones, _ = cl.tombstones.since(ctx, time.Time{}, later)
+	if len(tombstones) != 0 {
+		t.Error("expired tombstones should not be returned")
+	}
+	if err := cl.tombstones.purge(ctx, later); err != nil {
+		t.Fatal(err)
+	}
+	tombstones, _ = cl.DeletedPins(ctx, time.Time{})
+	if len(tombstones) != 0 {
+		t.Error("expired tombstones should have been purged")
+	}
+}
+
+func TestAllowUnderReplication(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	for _, p := range []peer.ID{cl.id, test.PeerID1} {
+		m := &api.Metric{
+			Name:  "numpin",
+			Peer:  p,
+			Value: "0",
+			Valid: true,
+		}
+		m.SetTTL(time.Minute)
+		cl.monitor.LogMetric(ctx, m)
 	}
 
-	ident := &config.Identity{}
-	err := ident.LoadJSON(testingIdentity)
+	opts := api.PinOptions{
+		ReplicationFactorMin: 3,
+		ReplicationFactorMax: 3,
+	}
+	_, err := cl.Pin(ctx, test.Cid1, opts)
+	if !errors.Is(err, api.ErrUnderReplicated) {
+		t.Fatal("expected an under-replicated error:", err)
+	}
+
+	cl.allocator, err = balanced.New(&balanced.Config{
+		AllocateBy:            []string{"numpin"},
+		AllowUnderReplication: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pin, err := cl.Pin(ctx, test.Cid1, opts)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if len(pin.Allocations) != 2 {
+		t.Error("expected the pin to be allocated to the 2 available peers:", pin.Allocations)
+	}
+	if pin.Metadata[api.UnderReplicatedMetaKey] == "" {
+		t.Error("expected an under-replication warning in the pin metadata")
+	}
 
-	if peers[0].ID != ident.ID {
-		fmt.Println(peers[0].ID)
-		fmt.Println(ident.ID)
-		t.Error("bad member")
+	opts.ReplicationFactorMin = 2
+	pin, err = cl.Pin(ctx, test.Cid1, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := pin.Metadata[api.UnderReplicatedMetaKey]; ok {
+		t.Error("the under-replication warning should be removed:", pin.Metadata)
 	}
 }
 
-func TestVersion(t *testing.T) {
+func TestClusterPinDryRun(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, pt := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	numpinMetric := &api.Metric{
+		Name:  "numpin",
+		Peer:  cl.id,
+		Value: "0",
+		Valid: true,
+	}
+	numpinMetric.SetTTL(time.Minute)
+	cl.monitor.LogMetric(ctx, numpinMetric)
+
+	opts := api.PinOptions{
+		ReplicationFactorMin: 1,
+		ReplicationFactorMax: 1,
+		DryRun:               true,
+	}
+	pin, err := cl.Pin(ctx, test.Cid1, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pin.DryRun {
+		t.Error("the pin should be marked as a dry-run")
+	}
+	if len(pin.Allocations) != 1 || pin.Allocations[0] != cl.id {
+		t.Error("expected the would-be allocations:", pin.Allocations)
+	}
+
+	pinDelay()
+
+	if _, err := cl.PinGet(ctx, test.Cid1); err != state.ErrNotFound {
+		t.Error("a dry-run pin should not be in the state:", err)
+	}
+	if pt.Status(ctx, test.Cid1).Status != api.TrackerStatusUnpinned {
+		t.Error("a dry-run pin should not be tracked")
+	}
+}
+
+func TestClusterUnpinFilter(t *testing.T) {
 	ctx := context.Background()
 	cl, _, _, _ := testingCluster(t)
 	defer cleanState()
 	defer cl.Shutdown(ctx)
-	if cl.Version() != version.Version.String() {
-		t.Error("bad Version()")
+
+	for c, team := range map[cid.Cid]string{test.Cid1: "a", test.Cid2: "b"} {
+		opts := api.PinOptions{
+			ReplicationFactorMin: -1,
+			ReplicationFactorMax: -1,
+			Metadata:             map[string]string{"app": "x", "team": team},
+		}
+		if _, err := cl.Pin(ctx, c, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pinDelay()
+
+	if _, err := cl.UnpinFilter(ctx, &api.UnpinFilter{}); err == nil {
+		t.Error("an empty filter should not be accepted")
+	}
+
+	// Pins found through the metadata index match all the keys.
+	result, err := cl.UnpinFilter(ctx, &api.UnpinFilter{Metadata: map[string]string{"app": "x", "team": "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Matched != 1 {
+		t.Errorf("expected one pin to match both keys: %+v", result)
+	}
+
+	filter := &api.UnpinFilter{Metadata: map[string]string{"team": "a"}}
+	result, err = cl.UnpinFilter(ctx, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Matched != 1 || result.Unpinned != 0 || result.Token == "" {
+		t.Fatalf("unexpected unconfirmed result: %+v", result)
+	}
+	if _, err := cl.PinGet(ctx, test.Cid1); err != nil {
+		t.Fatal("nothing should be unpinned without confirmation:", err)
+	}
+
+	filter.Confirm = "wrong"
+	if _, err := cl.UnpinFilter(ctx, filter); err == nil {
+		t.Error("a wrong token should not be accepted")
+	}
+
+	filter.Confirm = result.Token
+	result, err = cl.UnpinFilter(ctx, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Matched != 1 || result.Unpinned != 1 {
+		t.Fatalf("unexpected confirmed result: %+v", result)
+	}
+	pinDelay()
+
+	if _, err := cl.PinGet(ctx, test.Cid1); err != state.ErrNotFound {
+		t.Error("the matching pin should be unpinned:", err)
+	}
+	if _, err := cl.PinGet(ctx, test.Cid2); err != nil {
+		t.Error("other pins should be kept:", err)
+	}
+
+	// Unpinning again changes nothing.
+	result, err = cl.UnpinFilter(ctx, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Matched != 0 || result.Unpinned != 0 {
+		t.Errorf("unexpected result when unpinning again: %+v", result)
 	}
 }
 
-func TestClusterRecoverAllLocal(t *testing.T) {
+func TestClusterPinOwnership(t *testing.T) {
 	ctx := context.Background()
 	cl, _, _, _ := testingCluster(t)
 	defer cleanState()
 	defer cl.Shutdown(ctx)
+	cl.config.EnforcePinOwnership = true
+	cl.config.AdminIdentities = []string{"admin"}
+
+	alice := api.WithClientIdentity(ctx, "alice")
+	bob := api.WithClientIdentity(ctx, "bob")
+	admin := api.WithClientIdentity(ctx, "admin")
+	anonymous := api.WithClientIdentity(ctx, "")
+
+	checkForbidden := func(err error) {
+		t.Helper()
+		if api.KindOf(err) != api.ErrorKindForbidden {
+			t.Error("expected a forbidden error:", err)
+		}
+	}
 
-	_, err := cl.Pin(ctx, test.Cid1, api.PinOptions{})
+	opts := api.PinOptions{
+		Metadata: map[string]string{"app": "x", api.OwnerMetaKey: "someone"},
+	}
+	pin, err := cl.Pin(alice, test.Cid1, opts)
 	if err != nil {
-		t.Fatal("pin should have worked:", err)
+		t.Fatal(err)
+	}
+	if pin.Metadata[api.OwnerMetaKey] != "alice" || opts.Metadata[api.OwnerMetaKey] != "someone" {
+		t.Error("new pins should be owned by their client:", pin.Metadata)
+	}
+	pinDelay()
+
+	// Only the owner and admins can modify the pin, whatever the API.
+	_, err = cl.Pin(bob, test.Cid1, api.PinOptions{Name: "mine"})
+	checkForbidden(err)
+	_, err = cl.Update(bob, test.Cid1, api.PinOptions{Name: "mine"})
+	checkForbidden(err)
+	err = cl.rpcClient.CallContext(anonymous, "", "Cluster", "Unpin", api.PinCid(test.Cid1), &api.Pin{})
+	checkForbidden(err)
+
+	pin, err = cl.Update(alice, test.Cid1, api.PinOptions{Name: "renamed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.Metadata[api.OwnerMetaKey] != "alice" {
+		t.Error("updating should keep the owner:", pin.Metadata)
 	}
+	pinDelay()
 
+	// In a batch, only the items which cannot be modified fail.
+	result, err := cl.PinBatch(bob, &api.PinBatch{Pins: []*api.Pin{
+		api.PinWithOpts(test.Cid1, opts),
+		api.PinWithOpts(test.Cid2, opts),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Pinned != 1 || result.Items[0].Error == "" || result.Items[1].Pin.Metadata[api.OwnerMetaKey] != "bob" {
+		t.Errorf("expected only the owned item to fail: %+v", result)
+	}
 	pinDelay()
 
-	recov, err := cl.RecoverAllLocal(ctx)
+	// Only the pins of the client match the filter.
+	filter := &api.UnpinFilter{Metadata: map[string]string{"app": "x"}}
+	fr, err := cl.UnpinFilter(bob, filter)
 	if err != nil {
-		t.Error("did not expect an error")
+		t.Fatal(err)
 	}
-	if len(recov) != 1 {
-		t.Fatalf("there should be only one pin, got = %d", len(recov))
+	if fr.Matched != 1 || len(filter.Metadata) != 1 {
+		t.Errorf("expected only the pin of the client to match: %+v", fr)
 	}
-	if recov[0].Status != api.TrackerStatusPinned {
-		t.Errorf("the pin should have been recovered, got = %v", recov[0].Status)
+	fr, err = cl.UnpinFilter(admin, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fr.Matched != 2 {
+		t.Errorf("expected all pins to match for admins: %+v", fr)
+	}
+
+	_, err = cl.PinPath(alice, "/ipfs/"+test.CidResolved.String(), api.PinOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinDelay()
+	err = cl.rpcClient.CallContext(bob, "", "Cluster", "UnpinPath", &api.PinPath{Path: "/ipfs/" + test.CidResolved.String()}, &api.Pin{})
+	checkForbidden(err)
+
+	if _, err := cl.unpin(admin, test.Cid1, "admin"); err != nil {
+		t.Error("admins should be able to unpin:", err)
+	}
+	// The cluster itself is not restricted.
+	if _, err := cl.Unpin(ctx, test.Cid2); err != nil {
+		t.Error("internal unpins should not be restricted:", err)
+	}
+
+	pin, err = cl.Pin(admin, test.Cid3, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.Metadata[api.OwnerMetaKey] != "someone" {
+		t.Error("admins should be able to set the owner:", pin.Metadata)
+	}
+	pinDelay()
+
+	cl.config.EnforcePinOwnership = false
+	if _, err := cl.Unpin(bob, test.Cid3); err != nil {
+		t.Error("anyone should be able to unpin when ownership is not enforced:", err)
 	}
 }
 
-func TestClusterRepoGC(t *testing.T) {
+func TestClusterMinFreeSpace(t *testing.T) {
 	ctx := context.Background()
 	cl, _, _, _ := testingCluster(t)
 	defer cleanState()
 	defer cl.Shutdown(ctx)
 
-	gRepoGC, err := cl.RepoGC(ctx)
+	// The mock connector reports 900 bytes free out of 1000.
+	diskCfg := &disk.Config{}
+	diskCfg.Default()
+	diskCfg.MinFreeSpacePercent = 95
+	inf, err := disk.NewInformer(diskCfg)
 	if err != nil {
-		t.Fatal("gc should have worked:", err)
+		t.Fatal(err)
 	}
+	inf.SetClient(cl.rpcClient)
 
-	if gRepoGC.PeerMap == nil {
-		t.Fatal("expected a non-nil peer map")
+	cl.allocator, err = balanced.New(&balanced.Config{
+		AllocateBy: []string{"freespace"},
+	})
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	if len(gRepoGC.PeerMap) != 1 {
-		t.Error("expected repo gc information for one peer")
+	opts := api.PinOptions{
+		ReplicationFactorMin: 1,
+		ReplicationFactorMax: 1,
 	}
-	for _, repoGC := range gRepoGC.PeerMap {
-		testRepoGC(t, repoGC)
+
+	_, err = cl.sendInformerMetrics(ctx, inf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	_, err = cl.Pin(ctx, test.Cid1, opts)
+	if !errors.Is(err, api.ErrUnderReplicated) {
+		t.Fatal("the peer should not be allocatable under min_free_space:", err)
 	}
 
+	diskCfg.MinFreeSpacePercent = 0
+	diskCfg.MinFreeSpace = 100
+	_, err = cl.sendInformerMetrics(ctx, inf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	pin, err := cl.Pin(ctx, test.Cid1, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pin.Allocations) != 1 || pin.Allocations[0] != cl.id {
+		t.Error("expected the pin to be allocated to the peer:", pin.Allocations)
+	}
 }
 
-func TestClusterRepoGCLocal(t *testing.T) {
+func TestClusterInformerMetricTTL(t *testing.T) {
 	ctx := context.Background()
 	cl, _, _, _ := testingCluster(t)
 	defer cleanState()
 	defer cl.Shutdown(ctx)
 
-	repoGC, err := cl.RepoGCLocal(ctx)
+	diskCfg := &disk.Config{}
+	diskCfg.Default()
+	diskCfg.MetricTTL = 40 * time.Second
+	diskInf, err := disk.NewInformer(diskCfg)
 	if err != nil {
-		t.Fatal("gc should have worked:", err)
+		t.Fatal(err)
 	}
+	diskInf.SetClient(cl.rpcClient)
 
-	testRepoGC(t, repoGC)
+	tagsCfg := &tags.Config{}
+	tagsCfg.Default()
+	tagsCfg.MetricTTL = 20 * time.Second
+	tagsInf, err := tags.New(tagsCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		inf Informer
+		ttl time.Duration
+	}{
+		{diskInf, diskCfg.MetricTTL},
+		{tagsInf, tagsCfg.MetricTTL},
+	} {
+		minTTL, err := cl.sendInformerMetrics(ctx, tc.inf, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if minTTL > tc.ttl || minTTL < tc.ttl-time.Second {
+			t.Errorf("%s: expected a ttl of %s, got %s", tc.inf.Name(), tc.ttl, minTTL)
+		}
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	for _, tc := range []struct {
+		name string
+		ttl  time.Duration
+	}{
+		{diskInf.Name(), diskCfg.MetricTTL},
+		{"tag:group", tagsCfg.MetricTTL},
+	} {
+		metrics := cl.monitor.LatestMetrics(ctx, tc.name)
+		if len(metrics) != 1 {
+			t.Fatalf("%s: expected 1 metric, got %d", tc.name, len(metrics))
+		}
+		ttl := metrics[0].GetTTL()
+		if ttl > tc.ttl || ttl < tc.ttl-2*time.Second {
+			t.Errorf("%s: expected a ttl of %s, got %s", tc.name, tc.ttl, ttl)
+		}
+	}
 }
 
-func testRepoGC(t *testing.T, repoGC *api.RepoGC) {
-	if repoGC.Peer == "" {
-		t.Error("expected a cluster ID")
+func TestClusterPinMetadataSchema(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	// Pinned before the schema was introduced.
+	if _, err := cl.Pin(ctx, test.Cid3, api.PinOptions{}); err != nil {
+		t.Fatal(err)
 	}
-	if repoGC.Error != "" {
-		t.Error("did not expect any error")
+
+	cl.config.MetadataSchema = api.MetadataSchema{
+		"team":  {Required: true},
+		"owner": {Regexp: regexp.MustCompile(`^[a-z]+@example\.org$`)},
 	}
 
-	if repoGC.Keys == nil {
-		t.Fatal("expected a non-nil array of IPFSRepoGC")
+	_, err := cl.Pin(ctx, test.Cid1, api.PinOptions{
+		Metadata: map[string]string{"team": "media", "owner": "alice@example.org"},
+	})
+	if err != nil {
+		t.Fatal("a valid pin should be accepted:", err)
 	}
 
-	if len(repoGC.Keys) == 0 {
-		t.Fatal("expected at least one key, but found none")
+	_, err = cl.Pin(ctx, test.Cid2, api.PinOptions{
+		Metadata: map[string]string{"owner": "alice@example.org"},
+	})
+	if !errors.Is(err, api.ErrInvalidMetadata) {
+		t.Error("expected a missing required key to be rejected:", err)
 	}
 
-	if !repoGC.Keys[0].Key.Equals(test.Cid1) {
-		t.Errorf("expected a different cid, expected: %s, found: %s", test.Cid1, repoGC.Keys[0].Key)
+	_, err = cl.Pin(ctx, test.Cid2, api.PinOptions{
+		Metadata: map[string]string{"team": "media", "owner": "alice"},
+	})
+	if !errors.Is(err, api.ErrInvalidMetadata) {
+		t.Error("expected a value not matching the regexp to be rejected:", err)
+	}
+	if _, err := cl.PinGet(ctx, test.Cid2); err == nil {
+		t.Error("rejected pins should not be part of the pinset")
+	}
+
+	// Existing pins are not checked again unless their metadata changes.
+	if _, err := cl.Pin(ctx, test.Cid3, api.PinOptions{}); err != nil {
+		t.Error("re-pinning with the same metadata should be accepted:", err)
+	}
+	_, err = cl.Pin(ctx, test.Cid3, api.PinOptions{
+		Metadata: map[string]string{"owner": "alice@example.org"},
+	})
+	if !errors.Is(err, api.ErrInvalidMetadata) {
+		t.Error("expected changed metadata to be checked:", err)
+	}
+}
+
+func TestClusterPinQoSClass(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	cl.config.QoSClasses = map[string]*api.QoSClass{
+		"critical": {Priority: api.QoSPriorityHigh},
+	}
+
+	_, err := cl.Pin(ctx, test.Cid1, api.PinOptions{QoSClass: "unknown"})
+	if err == nil {
+		t.Fatal("expected an error pinning with an unknown QoS class")
+	}
+
+	pin, err := cl.Pin(ctx, test.Cid1, api.PinOptions{QoSClass: "critical"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin.QoSClass != "critical" {
+		t.Error("expected the QoS class to be set")
+	}
+
+	// Re-allocations queue high priority pins first. Maintenance mode
+	// keeps them queued.
+	cl.SetMaintenanceLocal(ctx, true)
+	cl.config.MaxConcurrentReallocations = 1
+	low := api.PinCid(test.Cid2)
+	high := api.PinCid(test.Cid3)
+	high.QoSClass = "critical"
+	cl.reallocate(test.PeerID2, low)
+	cl.reallocate(test.PeerID2, high)
+	cl.reallocate(test.PeerID3, low)
+
+	cl.reallocMux.Lock()
+	defer cl.reallocMux.Unlock()
+	if len(cl.reallocQueue) != 2 || !cl.reallocQueue[0].pin.Cid.Equals(test.Cid3) {
+		t.Error("expected the critical pin to be queued first")
+	}
+}
+
+// alertsMonitor delivers the alerts sent on its channel instead of those of
+// the wrapped monitor.
+type alertsMonitor struct {
+	PeerMonitor
+	alerts chan *api.Alert
+}
+
+func (mon *alertsMonitor) Alerts() <-chan *api.Alert {
+	return mon.alerts
+}
+
+// recordingSink keeps the alerts it receives.
+type recordingSink struct {
+	mu     sync.Mutex
+	alerts []*api.Alert
+}
+
+func (sink *recordingSink) Alert(ctx context.Context, alrt *api.Alert) {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	sink.alerts = append(sink.alerts, alrt)
+}
+
+func (sink *recordingSink) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (sink *recordingSink) received() int {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	return len(sink.alerts)
+}
+
+func TestClusterAlertsRepinningDisabled(t *testing.T) {
+	ctx := context.Background()
+	alerts := make(chan *api.Alert)
+	sink := &recordingSink{}
+	cl, _, _ := testingClusterWith(t, testingClusterOptions{
+		wrapMonitor: func(mon PeerMonitor) PeerMonitor {
+			return &alertsMonitor{PeerMonitor: mon, alerts: alerts}
+		},
+		alertSinks: []AlertSink{sink},
+	})
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	cl.config.reloadMux.Lock()
+	cl.config.DisableRepinning = true
+	cl.config.reloadMux.Unlock()
+
+	for i := 0; i < 2; i++ {
+		alrt := &api.Alert{
+			Metric: api.Metric{
+				Name:  pingMetricName,
+				Peer:  test.PeerID2,
+				Valid: true,
+			},
+			TriggeredAt: time.Now(),
+		}
+		select {
+		case alerts <- alrt:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("alert %d was not read", i)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for sink.received() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected both alerts to reach the sink: %d", sink.received())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(cl.Alerts()) != 2 {
+		t.Error("expected both alerts to be recorded:", len(cl.Alerts()))
+	}
+}
+
+func TestClusterQoSAlertsOnce(t *testing.T) {
+	ctx := context.Background()
+	cl, _, _, _ := testingCluster(t)
+	defer cleanState()
+	defer cl.Shutdown(ctx)
+
+	pin := api.PinCid(test.Cid1)
+	cl.recordQoSAlert(qosReplicaLostAlertName, test.PeerID2, pin)
+	cl.recordQoSAlert(qosReplicaLostAlertName, test.PeerID2, pin)
+	if n := len(cl.Alerts()); n != 1 {
+		t.Fatalf("expected the alert to be recorded once: %d alerts", n)
+	}
+
+	cl.clearQoSAlerts(qosReplicaLostAlertName, test.PeerID2, nil)
+	cl.recordQoSAlert(qosReplicaLostAlertName, test.PeerID2, pin)
+	if n := len(cl.Alerts()); n != 2 {
+		t.Errorf("expected the alert to be recorded again once cleared: %d alerts", n)
 	}
 }
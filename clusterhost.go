@@ -46,12 +46,14 @@ func init() {
 // the provided cluster configuration. Using that host, it creates pubsub and
 // a DHT instances (persisting to the given datastore), for shared use by all
 // cluster components. The returned host uses the DHT for routing. Relay and
-// NATService are additionally setup for this host.
+// NATService are additionally setup for this host. The given pubsub options
+// (i.e. the monitor GossipSub parameters) are applied to the pubsub instance.
 func NewClusterHost(
 	ctx context.Context,
 	ident *config.Identity,
 	cfg *Config,
 	ds ds.Datastore,
+	psubOpts ...pubsub.Option,
 ) (host.Host, *pubsub.PubSub, *dual.DHT, error) {
 
 	// Set the default dial timeout for all libp2p connections.  It is not
@@ -92,7 +94,7 @@ func NewClusterHost(
 		return nil, nil, nil, err
 	}
 
-	psub, err := newPubSub(ctx, h)
+	psub, err := newPubSub(ctx, h, psubOpts...)
 	if err != nil {
 		h.Close()
 		return nil, nil, nil, err
@@ -152,13 +154,13 @@ func newDHT(ctx context.Context, h host.Host, store ds.Datastore, extraopts ...d
 	return dual.New(ctx, h, opts...)
 }
 
-func newPubSub(ctx context.Context, h host.Host) (*pubsub.PubSub, error) {
-	return pubsub.NewGossipSub(
-		ctx,
-		h,
+func newPubSub(ctx context.Context, h host.Host, extraopts ...pubsub.Option) (*pubsub.PubSub, error) {
+	opts := []pubsub.Option{
 		pubsub.WithMessageSigning(true),
 		pubsub.WithStrictSignatureVerification(true),
-	)
+	}
+	opts = append(opts, extraopts...)
+	return pubsub.NewGossipSub(ctx, h, opts...)
 }
 
 // EncodeProtectorKey converts a byte slice to its hex string representation.
@@ -10,11 +10,19 @@ import (
 
 	"github.com/ipfs/ipfs-cluster/api"
 
+	cid "github.com/ipfs/go-cid"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 
 	humanize "github.com/dustin/go-humanize"
 )
 
+// receiptWithPeers is a receipt along with the cluster peers trusted to
+// sign it.
+type receiptWithPeers struct {
+	*api.PinReceipt
+	peers []peer.ID
+}
+
 type addedOutputQuiet struct {
 	*api.AddedOutput
 	quiet bool
@@ -32,6 +40,8 @@ func jsonFormatObject(resp interface{}) {
 			actual = append(actual, s.AddedOutput)
 		}
 		jsonFormatPrint(actual)
+	case *receiptWithPeers:
+		jsonFormatPrint(r.PinReceipt)
 	default:
 		jsonFormatPrint(resp)
 	}
@@ -67,6 +77,10 @@ func textFormatObject(resp interface{}) {
 		textFormatPrintMetric(r)
 	case *api.Alert:
 		textFormatPrintAlert(r)
+	case *receiptWithPeers:
+		textFormatPrintPinReceipt(r)
+	case *api.SyncSummary:
+		textFormatPrintSyncSummary(r)
 	case []*api.ID:
 		for _, item := range r {
 			textFormatObject(item)
@@ -112,11 +126,16 @@ func textFormatPrintID(obj *api.ID) {
 		return
 	}
 
+	var maintenance string
+	if obj.Maintenance {
+		maintenance = " | IN MAINTENANCE"
+	}
 	fmt.Printf(
-		"%s | %s | Sees %d other peers\n",
+		"%s | %s | Sees %d other peers%s\n",
 		obj.ID.Pretty(),
 		obj.Peername,
 		len(obj.ClusterPeers)-1,
+		maintenance,
 	)
 
 	addrs := make(sort.StringSlice, 0, len(obj.Addresses))
@@ -128,6 +147,15 @@ func textFormatPrintID(obj *api.ID) {
 	for _, a := range addrs {
 		fmt.Printf("    - %s\n", a)
 	}
+	switch {
+	case obj.Leaderless:
+		fmt.Println("  > Leader: none (leaderless consensus)")
+	case obj.Leader != "":
+		fmt.Printf("  > Leader: %s\n", obj.Leader.Pretty())
+	}
+	if obj.Leaderless && obj.WriteHint != "" {
+		fmt.Printf("  > Suggested peer for writes: %s\n", obj.WriteHint.Pretty())
+	}
 	if obj.IPFS.Error != "" {
 		fmt.Printf("  > IPFS ERROR: %s\n", obj.IPFS.Error)
 		return
@@ -157,6 +185,12 @@ func textFormatPrintGPInfo(obj *api.GlobalPinInfo) {
 	if obj.Name != "" {
 		fmt.Fprintf(&b, " | %s", obj.Name)
 	}
+	if !obj.CreatedAt.IsZero() {
+		fmt.Fprintf(&b, " | Added: %s", obj.CreatedAt.Format("2006-01-02 15:04:05"))
+	}
+	if !obj.UpdatedAt.IsZero() {
+		fmt.Fprintf(&b, " | Updated: %s", obj.UpdatedAt.Format("2006-01-02 15:04:05"))
+	}
 
 	b.WriteString(":\n")
 
@@ -174,6 +208,17 @@ func textFormatPrintGPInfo(obj *api.GlobalPinInfo) {
 		fmt.Fprintf(&b, " | %s", txt)
 		fmt.Fprintf(&b, " | Attempts: %d", v.AttemptCount)
 		fmt.Fprintf(&b, " | Priority: %t", v.PriorityPin)
+		if v.BlocksFetched > 0 {
+			fmt.Fprintf(&b, " | Blocks: %d", v.BlocksFetched)
+		}
+		if len(v.MissingBlocks) > 0 {
+			fmt.Fprintf(&b, " | Missing blocks: %d", len(v.MissingBlocks))
+		}
+		if v.Duration > 0 {
+			fmt.Fprintf(&b, " | Took: %s", v.Duration)
+		} else if !v.Since.IsZero() {
+			fmt.Fprintf(&b, " | Since: %s", v.Since.Format("2006-01-02 15:04:05"))
+		}
 		fmt.Fprintf(&b, "\n")
 	}
 	fmt.Print(b.String())
@@ -225,10 +270,16 @@ func textFormatPrintPin(obj *api.Pin) {
 	fmt.Printf(" | Exp: %s", expireAt)
 
 	added := "unknown"
+	if !obj.CreatedAt.IsZero() {
+		added = obj.CreatedAt.Format("2006-01-02 15:04:05")
+	}
+	fmt.Printf(" | Added: %s", added)
+
+	updated := "unknown"
 	if !obj.Timestamp.IsZero() {
-		added = obj.Timestamp.Format("2006-01-02 15:04:05")
+		updated = obj.Timestamp.Format("2006-01-02 15:04:05")
 	}
-	fmt.Printf(" | Added: %s\n", added)
+	fmt.Printf(" | Updated: %s\n", updated)
 }
 
 func textFormatPrintAddedOutput(obj *api.AddedOutput) {
@@ -253,6 +304,14 @@ func textFormatPrintMetric(obj *api.Metric) {
 }
 
 func textFormatPrintAlert(obj *api.Alert) {
+	if obj.Recovered {
+		fmt.Printf("%s: %s. Recovered at: %s\n",
+			obj.Peer,
+			obj.Name,
+			humanize.Time(obj.TriggeredAt),
+		)
+		return
+	}
 	fmt.Printf("%s: %s. Expired at: %s. Triggered at: %s\n",
 		obj.Peer,
 		obj.Name,
@@ -261,6 +320,33 @@ func textFormatPrintAlert(obj *api.Alert) {
 	)
 }
 
+func textFormatPrintPinReceipt(obj *receiptWithPeers) {
+	peers := make([]string, 0, len(obj.Peers))
+	for _, p := range obj.Peers {
+		peers = append(peers, peer.Encode(p))
+	}
+	valid := "valid"
+	if err := obj.Verify(obj.peers); err != nil {
+		valid = "INVALID: " + err.Error()
+	}
+	fmt.Printf("%s: pinned on [%s] at %s\n", obj.Cid, strings.Join(peers, " "), obj.Timestamp.Format(time.RFC3339))
+	fmt.Printf("  > Signed by %s (%s)\n", obj.Signer, valid)
+}
+
+func textFormatPrintSyncSummary(obj *api.SyncSummary) {
+	fmt.Printf("%s: synced in %s\n", obj.Peer, obj.FinishedAt.Sub(obj.StartedAt).Round(time.Millisecond))
+	printCids := func(what string, cids []cid.Cid) {
+		fmt.Printf("  > %s: %d\n", what, len(cids))
+		for _, c := range cids {
+			fmt.Printf("    - %s\n", c)
+		}
+	}
+	printCids("Expired and unpinned", obj.ExpiredUnpinned)
+	printCids("Repinned", obj.Repinned)
+	printCids("Unpinned", obj.Unpinned)
+	printCids("Failed", obj.Failed)
+}
+
 func textFormatPrintGlobalRepoGC(obj *api.GlobalRepoGC) {
 	peers := make(sort.StringSlice, 0, len(obj.PeerMap))
 	for peer := range obj.PeerMap {
@@ -580,9 +580,8 @@ and 0 means use cluster's default setting (i.e., replication factor set in
 config). Positive values indicate how many peers should pin this content.
 
 An optional allocations argument can be provided, allocations should be a
-comma-separated list of peer IDs on which we want to pin. Peers in allocations
-are prioritized over automatically-determined ones, but replication factors
-would still be respected.
+comma-separated list of cluster peer IDs on which we want to pin. The content
+is then pinned on exactly those peers, regardless of replication factors.
 `,
 					ArgsUsage: "<CID|Path>",
 					Flags: []cli.Flag{
@@ -615,6 +614,10 @@ would still be respected.
 							Value: "recursive",
 							Usage: "Select a way to pin: recursive or direct",
 						},
+						cli.IntFlag{
+							Name:  "max-depth",
+							Usage: "Pin only this number of levels below the root (recursive mode)",
+						},
 						cli.StringFlag{
 							Name:  "expire-in",
 							Usage: "Duration after which pin should be unpinned automatically",
@@ -623,6 +626,26 @@ would still be respected.
 							Name:  "metadata",
 							Usage: "Pin metadata: key=value. Can be added multiple times",
 						},
+						cli.StringFlag{
+							Name:  "depends-on",
+							Usage: "CID which must be pinned before this item is pinned",
+						},
+						cli.StringFlag{
+							Name:  "exclude-links",
+							Usage: "Optional comma-separated list of link path patterns which should not be pinned",
+						},
+						cli.StringFlag{
+							Name:  "placement",
+							Usage: "Placement rules over peer tags, i.e. \"region>=1,rack<=2,prefer disk=ssd\". Not allowed with a replication factor of -1",
+						},
+						cli.StringFlag{
+							Name:  "qos-class",
+							Usage: "QoS class of the pin, as defined in the cluster configuration",
+						},
+						cli.DurationFlag{
+							Name:  "pin-deadline",
+							Usage: "Time allowed for the pin to reach PINNED before it is reported as an SLA breach",
+						},
 						cli.BoolFlag{
 							Name:  "no-status, ns",
 							Usage: "Prevents fetching pin status after pinning (faster, quieter)",
@@ -664,15 +687,40 @@ would still be respected.
 							checkErr("parsing expire-in", err)
 							expireAt = time.Now().Add(d)
 						}
+						var pinDeadline time.Time
+						if d := c.Duration("pin-deadline"); d > 0 {
+							pinDeadline = time.Now().Add(d)
+						}
+
+						var dependsOn cid.Cid
+						if dep := c.String("depends-on"); dep != "" {
+							var err error
+							dependsOn, err = cid.Decode(dep)
+							checkErr("parsing depends-on", err)
+						}
+
+						var excludeLinks []string
+						if excl := c.String("exclude-links"); excl != "" {
+							excludeLinks = strings.Split(excl, ",")
+							for i := range excludeLinks {
+								excludeLinks[i] = strings.TrimSpace(excludeLinks[i])
+							}
+						}
 
 						opts := api.PinOptions{
 							ReplicationFactorMin: rplMin,
 							ReplicationFactorMax: rplMax,
 							Name:                 c.String("name"),
 							Mode:                 api.PinModeFromString(c.String("mode")),
+							MaxDepth:             api.PinDepth(c.Int("max-depth")),
 							UserAllocations:      userAllocs,
 							ExpireAt:             expireAt,
 							Metadata:             parseMetadata(c.StringSlice("metadata")),
+							DependsOn:            dependsOn,
+							ExcludeLinks:         excludeLinks,
+							Placement:            c.String("placement"),
+							QoSClass:             c.String("qos-class"),
+							PinDeadline:          pinDeadline,
 						}
 
 						pin, cerr := globalClient.PinPath(ctx, arg, opts)
@@ -831,13 +879,24 @@ The filter only takes effect when listing all pins. The possible values are:
 							Usage: "Comma separated list of pin types. See help above.",
 							Value: "all",
 						},
+						cli.BoolFlag{
+							Name:  "linearizable",
+							Usage: "reflect every update committed before the request, even on Raft followers which are behind",
+						},
 					},
 					Action: func(c *cli.Context) error {
 						cidStr := c.Args().First()
+						linearizable := c.Bool("linearizable")
 						if cidStr != "" {
 							ci, err := cid.Decode(cidStr)
 							checkErr("parsing cid", err)
-							resp, cerr := globalClient.Allocation(ctx, ci)
+							var resp *api.Pin
+							var cerr error
+							if linearizable {
+								resp, cerr = globalClient.AllocationLinearizable(ctx, ci)
+							} else {
+								resp, cerr = globalClient.Allocation(ctx, ci)
+							}
 							formatResponse(c, resp, cerr)
 						} else {
 							var filter api.PinType
@@ -846,12 +905,102 @@ The filter only takes effect when listing all pins. The possible values are:
 								filter |= api.PinTypeFromString(f)
 							}
 
-							resp, cerr := globalClient.Allocations(ctx, filter)
+							var resp []*api.Pin
+							var cerr error
+							if linearizable {
+								resp, cerr = globalClient.AllocationsLinearizable(ctx, filter)
+							} else {
+								resp, cerr = globalClient.Allocations(ctx, filter)
+							}
 							formatResponse(c, resp, cerr)
 						}
 						return nil
 					},
 				},
+				{
+					Name:  "holders",
+					Usage: "List the peers whose IPFS daemons hold a CID",
+					Description: `
+This command asks the IPFS daemons of the peers allocated to the given CID
+whether they hold its root block in their local repository, and lists
+those that do. The check happens offline, so it does not trigger any
+fetching.
+
+When the --all flag is passed, every cluster peer is asked, regardless of
+the allocations.
+`,
+					ArgsUsage: "<CID>",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "all",
+							Usage: "ask every cluster peer and not only the allocations",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						ci, err := cid.Decode(c.Args().First())
+						checkErr("parsing cid", err)
+						holders, cerr := globalClient.BlockHolders(ctx, ci, c.Bool("all"))
+						resp := make([]string, 0, len(holders))
+						for _, h := range holders {
+							resp = append(resp, peer.Encode(h))
+						}
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
+				{
+					Name:  "receipt",
+					Usage: "Obtain a signed receipt for a fully replicated CID",
+					Description: `
+This command returns a receipt stating that the given CID is pinned on all
+the peers it is allocated to at the current time. The receipt is signed with
+the key of the peer handling the request and includes its public key, so
+that it can be verified later. The text output shows whether the signature
+is valid and the signer is a current cluster peer. It fails if the CID is
+not pinned on all its allocations.
+`,
+					ArgsUsage: "<CID>",
+					Action: func(c *cli.Context) error {
+						ci, err := cid.Decode(c.Args().First())
+						checkErr("parsing cid", err)
+						receipt, cerr := globalClient.PinReceipt(ctx, ci)
+						if cerr != nil {
+							formatResponse(c, nil, cerr)
+							return nil
+						}
+						ids, err := globalClient.Peers(ctx)
+						checkErr("listing cluster peers", err)
+						var peers []peer.ID
+						for _, id := range ids {
+							peers = append(peers, id.ID)
+						}
+						formatResponse(c, &receiptWithPeers{receipt, peers}, nil)
+						return nil
+					},
+				},
+				{
+					Name:  "verify",
+					Usage: "Check that the peers pinning a CID have all its blocks",
+					Description: `
+This command asks the peers allocated to the given CID to walk its DAG in
+their IPFS daemons, offline, and report the blocks that are missing. Peers
+whose IPFS daemon reports the item as pinned while missing some blocks show
+the PIN_DEGRADED status. Walking the full DAG may take long for large items.
+
+When the --local flag is passed, only the contacted peer is checked.
+`,
+					ArgsUsage: "<CID>",
+					Flags: []cli.Flag{
+						localFlag(),
+					},
+					Action: func(c *cli.Context) error {
+						ci, err := cid.Decode(c.Args().First())
+						checkErr("parsing cid", err)
+						resp, cerr := globalClient.Verify(ctx, ci, c.Bool("local"))
+						formatResponse(c, resp, cerr)
+						return nil
+					},
+				},
 			},
 		},
 		{
@@ -930,6 +1079,23 @@ operations on the contacted peer (as opposed to on every peer).
 				return nil
 			},
 		},
+		{
+			Name:  "sync",
+			Usage: "Perform a full state sync in the contacted peer",
+			Description: `
+This command asks the contacted peer to catch up with the shared state, unpin
+expired items and recover the items in error, as it does periodically. It
+waits for the sync to complete and prints a summary of the corrections made.
+
+Concurrent requests wait for the sync already running. Note that, for large
+pinsets, it may take a considerably long time.
+`,
+			Action: func(c *cli.Context) error {
+				resp, cerr := globalClient.Sync(ctx)
+				formatResponse(c, resp, cerr)
+				return nil
+			},
+		},
 
 		{
 			Name:  "version",
@@ -998,6 +1164,10 @@ graph of the connections.  Output is a dot file encoding the cluster's connectio
 This commands displays the latest valid metrics of the given type logged
 by this peer for all current cluster peers.
 
+With --at, it displays the metrics which were valid at the given time instead,
+as long as they are still retained by this peer. Numeric values are
+interpolated between the retained metrics.
+
 If no argument is provided, the command retrieves all currently existing metric types.
 
 Currently supported metrics depend on the informer component used,
@@ -1007,6 +1177,12 @@ but usually are:
 - ping
 `,
 					ArgsUsage: "<metric name>",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "at",
+							Usage: "show the metrics which were valid at the given time (RFC3339)",
+						},
+					},
 					Action: func(c *cli.Context) error {
 						metric := c.Args().First()
 						if metric == "" {
@@ -1015,6 +1191,14 @@ but usually are:
 							return nil
 						}
 
+						if at := c.String("at"); at != "" {
+							t, err := time.Parse(time.RFC3339, at)
+							checkErr("parsing at", err)
+							resp, cerr := globalClient.MetricsAt(ctx, metric, t)
+							formatResponse(c, resp, cerr)
+							return nil
+						}
+
 						resp, cerr := globalClient.Metrics(ctx, metric)
 						formatResponse(c, resp, cerr)
 						return nil
@@ -1038,6 +1222,36 @@ trigger automatic repinnings if configured.
 						return nil
 					},
 				},
+				{
+					Name:  "maintenance",
+					Usage: "Enable or disable maintenance mode in all cluster peers",
+					Description: `
+This command enables ("on") or disables ("off") maintenance mode in all the
+current cluster peers.
+
+While in maintenance mode, peers do not trigger any automatic actions: pins
+are not re-allocated on alerts, failed pins are not automatically recovered
+and expired pins are not unpinned. Reads and explicit commands work as usual.
+
+Maintenance mode is persisted: restarted peers stay in maintenance mode until
+it is disabled. The status of each peer is shown by "peers ls".
+`,
+					ArgsUsage: "<on|off>",
+					Action: func(c *cli.Context) error {
+						var enabled bool
+						switch c.Args().First() {
+						case "on":
+							enabled = true
+						case "off":
+							enabled = false
+						default:
+							checkErr("parsing arguments", errors.New("expected \"on\" or \"off\""))
+						}
+						cerr := globalClient.SetMaintenance(ctx, enabled)
+						formatResponse(c, nil, cerr)
+						return nil
+					},
+				},
 			},
 		},
 		{
@@ -302,7 +302,7 @@ func runCmd(c *cli.Context) error {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	host, pubsub, dht, err := ipfscluster.NewClusterHost(ctx, cfgHelper.Identity(), cfgs.Cluster, store)
+	host, pubsub, dht, err := ipfscluster.NewClusterHost(ctx, cfgHelper.Identity(), cfgs.Cluster, store, cfgs.Pubsubmon.GossipSubOptions()...)
 	if err != nil {
 		return cli.Exit(errors.Wrap(err, "error creating libp2p components"), 1)
 	}
@@ -360,8 +360,9 @@ func runCmd(c *cli.Context) error {
 	}
 
 	tracker := stateless.New(cfgs.Statelesstracker, host.ID(), cfgs.Cluster.Peername, crdtcons.State)
+	tracker.SetDatastore(store)
 
-	mon, err := pubsubmon.New(ctx, cfgs.Pubsubmon, pubsub, nil)
+	mon, err := pubsubmon.New(ctx, cfgs.Pubsubmon, pubsub, host, nil, nil)
 	if err != nil {
 		store.Close()
 		return cli.Exit(errors.Wrap(err, "setting up PeerMonitor"), 1)
@@ -404,6 +405,7 @@ func runCmd(c *cli.Context) error {
 		mon,
 		alloc,
 		[]ipfscluster.Informer{informer},
+		nil,
 		tracer,
 	)
 	if err != nil {
@@ -411,7 +413,7 @@ func runCmd(c *cli.Context) error {
 		return cli.Exit(errors.Wrap(err, "error creating cluster peer"), 1)
 	}
 
-	return cmdutils.HandleSignals(ctx, cancel, cluster, host, dht, store)
+	return cmdutils.HandleSignals(ctx, cancel, cfgHelper, cluster, host, dht, store)
 }
 
 // List
@@ -2,11 +2,14 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"strings"
 	"time"
 
 	ipfscluster "github.com/ipfs/ipfs-cluster"
 	"github.com/ipfs/ipfs-cluster/allocator/balanced"
+	"github.com/ipfs/ipfs-cluster/allocator/binpack"
+	"github.com/ipfs/ipfs-cluster/api/grpcapi"
 	"github.com/ipfs/ipfs-cluster/api/ipfsproxy"
 	"github.com/ipfs/ipfs-cluster/api/rest"
 	"github.com/ipfs/ipfs-cluster/cmdutils"
@@ -14,9 +17,13 @@ import (
 	"github.com/ipfs/ipfs-cluster/consensus/crdt"
 	"github.com/ipfs/ipfs-cluster/consensus/raft"
 	"github.com/ipfs/ipfs-cluster/informer/disk"
+	"github.com/ipfs/ipfs-cluster/informer/queuedepth"
+	"github.com/ipfs/ipfs-cluster/informer/swarmpeers"
+	"github.com/ipfs/ipfs-cluster/informer/synclag"
 	"github.com/ipfs/ipfs-cluster/informer/tags"
 	"github.com/ipfs/ipfs-cluster/ipfsconn/ipfshttp"
 	"github.com/ipfs/ipfs-cluster/monitor/pubsubmon"
+	"github.com/ipfs/ipfs-cluster/monitor/webhook"
 	"github.com/ipfs/ipfs-cluster/observations"
 	"github.com/ipfs/ipfs-cluster/pintracker/stateless"
 	"go.opencensus.io/tag"
@@ -90,7 +97,7 @@ func daemon(c *cli.Context) error {
 
 	store := setupDatastore(cfgHelper)
 
-	host, pubsub, dht, err := ipfscluster.NewClusterHost(ctx, cfgHelper.Identity(), cfgs.Cluster, store)
+	host, pubsub, dht, err := ipfscluster.NewClusterHost(ctx, cfgHelper.Identity(), cfgs.Cluster, store, cfgs.Pubsubmon.GossipSubOptions()...)
 	checkErr("creating libp2p host", err)
 
 	cluster, err := createCluster(ctx, c, cfgHelper, host, pubsub, dht, store, raftStaging)
@@ -103,7 +110,7 @@ func daemon(c *cli.Context) error {
 	// will realize).
 	go bootstrap(ctx, cluster, bootstraps)
 
-	return cmdutils.HandleSignals(ctx, cancel, cluster, host, dht, store)
+	return cmdutils.HandleSignals(ctx, cancel, cfgHelper, cluster, host, dht, store)
 }
 
 // createCluster creates all the necessary things to produce the cluster
@@ -126,6 +133,10 @@ func createCluster(
 	checkErr("getting configuration string", err)
 	logger.Debugf("Configuration:\n%s\n", cfgBytes)
 
+	if cfgs.Cluster.ReadOnly && cfgHelper.GetConsensus() == cfgs.Raft.ConfigKey() {
+		checkErr("checking the configuration", errors.New("read_only peers are not supported with raft consensus"))
+	}
+
 	ctx, err = tag.New(ctx, tag.Upsert(observations.HostKey, host.ID().Pretty()))
 	checkErr("tag context with host id", err)
 
@@ -153,6 +164,19 @@ func createCluster(
 		apis = append(apis, proxy)
 	}
 
+	if cfgMgr.IsLoadedFromJSON(config.API, cfgs.Grpcapi.ConfigKey()) {
+		var grpcAPI *grpcapi.Server
+		// As with the REST API, the libp2p endpoint is only enabled
+		// on Raft clusters.
+		if cfgHelper.GetConsensus() == cfgs.Raft.ConfigKey() {
+			grpcAPI, err = grpcapi.NewWithHost(ctx, cfgs.Grpcapi, host)
+		} else {
+			grpcAPI, err = grpcapi.New(ctx, cfgs.Grpcapi)
+		}
+		checkErr("creating gRPC API component", err)
+		apis = append(apis, grpcAPI)
+	}
+
 	connector, err := ipfshttp.NewConnector(cfgs.Ipfshttp)
 	checkErr("creating IPFS Connector component", err)
 
@@ -160,13 +184,35 @@ func createCluster(
 	if cfgMgr.IsLoadedFromJSON(config.Informer, cfgs.Diskinf.ConfigKey()) {
 		diskinf, err := disk.NewInformer(cfgs.Diskinf)
 		checkErr("creating disk informer", err)
+		checkMetricTTL(cfgs, cfgs.Diskinf.ConfigKey(), cfgs.Diskinf.MetricTTL)
 		informers = append(informers, diskinf)
 	}
 	if cfgMgr.IsLoadedFromJSON(config.Informer, cfgs.Tagsinf.ConfigKey()) {
 		tagsinf, err := tags.New(cfgs.Tagsinf)
 		checkErr("creating numpin informer", err)
+		checkMetricTTL(cfgs, cfgs.Tagsinf.ConfigKey(), cfgs.Tagsinf.MetricTTL)
 		informers = append(informers, tagsinf)
 	}
+	if cfgMgr.IsLoadedFromJSON(config.Informer, cfgs.Queuedepthinf.ConfigKey()) {
+		queuedepthinf, err := queuedepth.NewInformer(cfgs.Queuedepthinf)
+		checkErr("creating queuedepth informer", err)
+		checkMetricTTL(cfgs, cfgs.Queuedepthinf.ConfigKey(), cfgs.Queuedepthinf.MetricTTL)
+		informers = append(informers, queuedepthinf)
+	}
+	if cfgMgr.IsLoadedFromJSON(config.Informer, cfgs.Swarmpeersinf.ConfigKey()) {
+		swarmpeersinf, err := swarmpeers.NewInformer(cfgs.Swarmpeersinf)
+		checkErr("creating swarmpeers informer", err)
+		checkMetricTTL(cfgs, cfgs.Swarmpeersinf.ConfigKey(), cfgs.Swarmpeersinf.MetricTTL)
+		informers = append(informers, swarmpeersinf)
+	}
+	// Only CRDT peers have a sync lag.
+	if cfgMgr.IsLoadedFromJSON(config.Informer, cfgs.Synclaginf.ConfigKey()) &&
+		cfgHelper.GetConsensus() == cfgs.Crdt.ConfigKey() {
+		synclaginf, err := synclag.NewInformer(cfgs.Synclaginf)
+		checkErr("creating synclag informer", err)
+		checkMetricTTL(cfgs, cfgs.Synclaginf.ConfigKey(), cfgs.Synclaginf.MetricTTL)
+		informers = append(informers, synclaginf)
+	}
 
 	// For legacy compatibility we need to make the allocator
 	// automatically compatible with informers that have been loaded. For
@@ -175,8 +221,25 @@ func createCluster(
 	if !cfgMgr.IsLoadedFromJSON(config.Allocator, cfgs.BalancedAlloc.ConfigKey()) {
 		cfgs.BalancedAlloc.AllocateBy = []string{"freespace"}
 	}
-	alloc, err := balanced.New(cfgs.BalancedAlloc)
+	var alloc ipfscluster.PinAllocator
+	alloc, err = balanced.New(cfgs.BalancedAlloc)
 	checkErr("creating allocator", err)
+	if len(cfgs.BalancedAlloc.Fallback) > 0 {
+		var fallbacks []ipfscluster.PinAllocator
+		for _, fcfg := range cfgs.BalancedAlloc.Fallback {
+			fallback, err := balanced.New(fcfg)
+			checkErr("creating fallback allocator", err)
+			fallbacks = append(fallbacks, fallback)
+		}
+		alloc = ipfscluster.NewFallbackAllocator(alloc, fallbacks...)
+	}
+	// The binpack allocator, when configured with a target utilization,
+	// comes first and falls back to the balanced ones.
+	if cfgMgr.IsLoadedFromJSON(config.Allocator, cfgs.BinpackAlloc.ConfigKey()) && cfgs.BinpackAlloc.TargetUtilization > 0 {
+		binpackAlloc, err := binpack.New(cfgs.BinpackAlloc)
+		checkErr("creating binpack allocator", err)
+		alloc = ipfscluster.NewFallbackAllocator(binpackAlloc, alloc)
+	}
 
 	ipfscluster.ReadyTimeout = cfgs.Raft.WaitForLeaderTimeout + 5*time.Second
 
@@ -205,14 +268,22 @@ func createCluster(
 	}
 
 	tracker := stateless.New(cfgs.Statelesstracker, host.ID(), cfgs.Cluster.Peername, cons.State)
+	tracker.SetDatastore(store)
 	logger.Debug("stateless pintracker loaded")
 
-	mon, err := pubsubmon.New(ctx, cfgs.Pubsubmon, pubsub, peersF)
+	mon, err := pubsubmon.New(ctx, cfgs.Pubsubmon, pubsub, host, peersF, pubsubmon.NewDatastoreMetricsStore(store))
 	if err != nil {
 		store.Close()
 		checkErr("setting up PeerMonitor", err)
 	}
 
+	var alertSinks []ipfscluster.AlertSink
+	if cfgMgr.IsLoadedFromJSON(config.Monitor, cfgs.Webhook.ConfigKey()) && cfgs.Webhook.URL != "" {
+		sink, err := webhook.New(cfgs.Webhook)
+		checkErr("creating webhook alert sink", err)
+		alertSinks = append(alertSinks, sink)
+	}
+
 	return ipfscluster.NewCluster(
 		ctx,
 		host,
@@ -226,6 +297,7 @@ func createCluster(
 		mon,
 		alloc,
 		informers,
+		alertSinks,
 		tracer,
 	)
 }
@@ -292,3 +364,15 @@ func setupConsensus(
 		return nil, errors.New("unknown consensus component")
 	}
 }
+
+// checkMetricTTL exits when the metrics of an informer would expire before
+// the monitor gets to check them.
+func checkMetricTTL(cfgs *cmdutils.Configs, informer string, ttl time.Duration) {
+	if ttl <= cfgs.Pubsubmon.CheckInterval {
+		checkErr(
+			"validating the %s informer",
+			fmt.Errorf("metric_ttl (%s) must be larger than pubsubmon.check_interval (%s)", ttl, cfgs.Pubsubmon.CheckInterval),
+			informer,
+		)
+	}
+}
@@ -354,6 +354,8 @@ the peer IDs in the given multiaddresses.
 					checkErr("randomizing ports", err)
 					cfgs.Ipfsproxy.ListenAddr, err = cmdutils.RandomizePorts(cfgs.Ipfsproxy.ListenAddr)
 					checkErr("randomizing ports", err)
+					cfgs.Grpcapi.ListenAddr, err = cmdutils.RandomizePorts(cfgs.Grpcapi.ListenAddr)
+					checkErr("randomizing ports", err)
 				}
 				err = cfgHelper.Manager().ApplyEnvVars()
 				checkErr("applying environment variables to configuration", err)
@@ -459,6 +461,10 @@ the peer IDs in the given multiaddresses.
 This command dumps the current cluster pinset (state) as a JSON file. The
 resulting file can be used to migrate, restore or backup a Cluster peer.
 By default, the state will be printed to stdout.
+
+With "--format stream", the state is written in a compressed, versioned
+binary format instead, without loading the whole pinset in memory. This is
+recommended for large pinsets.
 `,
 					Flags: []cli.Flag{
 						cli.StringFlag{
@@ -466,6 +472,11 @@ By default, the state will be printed to stdout.
 							Value: "",
 							Usage: "writes to an output file",
 						},
+						cli.StringFlag{
+							Name:  "format",
+							Value: cmdutils.ExportJSON,
+							Usage: "export format: json or stream",
+						},
 					},
 					Action: func(c *cli.Context) error {
 						locker.lock()
@@ -486,7 +497,7 @@ By default, the state will be printed to stdout.
 						}
 						defer w.Close()
 
-						checkErr("exporting state", mgr.ExportState(w))
+						checkErr("exporting state", mgr.ExportState(w, c.String("format")))
 						logger.Info("state successfully exported")
 						return nil
 					},
@@ -500,7 +511,8 @@ existing one. This can be used, for example, to restore a Cluster peer from a
 backup.
 
 If an argument is provided, it will be treated it as the path of the file
-to import. If no argument is provided, stdin will be used.
+to import. If no argument is provided, stdin will be used. Both the JSON and
+the streaming export formats are accepted.
 `,
 					Flags: []cli.Flag{
 						cli.BoolFlag{
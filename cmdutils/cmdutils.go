@@ -101,10 +101,12 @@ func listenUDP(name, ip string) (io.Closer, int, error) {
 
 // HandleSignals orderly shuts down an IPFS Cluster peer
 // on SIGINT, SIGTERM, SIGHUP. It forces command termination
-// on the 3rd-signal count.
+// on the 3rd-signal count. When the cluster configuration has
+// ReloadOnSIGHUP set, SIGHUP reloads the configuration instead.
 func HandleSignals(
 	ctx context.Context,
 	cancel context.CancelFunc,
+	cfgHelper *ConfigHelper,
 	cluster *ipfscluster.Cluster,
 	host host.Host,
 	dht *dual.DHT,
@@ -121,7 +123,12 @@ func HandleSignals(
 	var ctrlcCount int
 	for {
 		select {
-		case <-signalChan:
+		case sig := <-signalChan:
+			if sig == syscall.SIGHUP && ctrlcCount == 0 &&
+				cfgHelper.Configs().Cluster.ReloadOnSIGHUP {
+				reloadConfig(cfgHelper)
+				continue
+			}
 			ctrlcCount++
 			handleCtrlC(ctx, cluster, ctrlcCount)
 		case <-cluster.Done():
@@ -135,6 +142,18 @@ func HandleSignals(
 	}
 }
 
+func reloadConfig(cfgHelper *ConfigHelper) {
+	restartOnly, err := cfgHelper.ReloadConfigFromDisk()
+	if err != nil {
+		ErrorOut("error reloading the configuration, keeping the current one: %s\n", err)
+		return
+	}
+	for _, opt := range restartOnly {
+		ErrorOut("WARNING: %s changed, but it cannot be reloaded and needs a restart to take effect\n", opt)
+	}
+	ErrorOut("configuration reloaded\n")
+}
+
 func handleCtrlC(ctx context.Context, cluster *ipfscluster.Cluster, ctrlcCount int) {
 	switch ctrlcCount {
 	case 1:
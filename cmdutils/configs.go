@@ -9,6 +9,8 @@ import (
 
 	ipfscluster "github.com/ipfs/ipfs-cluster"
 	"github.com/ipfs/ipfs-cluster/allocator/balanced"
+	"github.com/ipfs/ipfs-cluster/allocator/binpack"
+	"github.com/ipfs/ipfs-cluster/api/grpcapi"
 	"github.com/ipfs/ipfs-cluster/api/ipfsproxy"
 	"github.com/ipfs/ipfs-cluster/api/rest"
 	"github.com/ipfs/ipfs-cluster/config"
@@ -18,9 +20,13 @@ import (
 	"github.com/ipfs/ipfs-cluster/datastore/leveldb"
 	"github.com/ipfs/ipfs-cluster/informer/disk"
 	"github.com/ipfs/ipfs-cluster/informer/numpin"
+	"github.com/ipfs/ipfs-cluster/informer/queuedepth"
+	"github.com/ipfs/ipfs-cluster/informer/swarmpeers"
+	"github.com/ipfs/ipfs-cluster/informer/synclag"
 	"github.com/ipfs/ipfs-cluster/informer/tags"
 	"github.com/ipfs/ipfs-cluster/ipfsconn/ipfshttp"
 	"github.com/ipfs/ipfs-cluster/monitor/pubsubmon"
+	"github.com/ipfs/ipfs-cluster/monitor/webhook"
 	"github.com/ipfs/ipfs-cluster/observations"
 	"github.com/ipfs/ipfs-cluster/pintracker/stateless"
 )
@@ -30,14 +36,20 @@ type Configs struct {
 	Cluster          *ipfscluster.Config
 	Restapi          *rest.Config
 	Ipfsproxy        *ipfsproxy.Config
+	Grpcapi          *grpcapi.Config
 	Ipfshttp         *ipfshttp.Config
 	Raft             *raft.Config
 	Crdt             *crdt.Config
 	Statelesstracker *stateless.Config
 	Pubsubmon        *pubsubmon.Config
+	Webhook          *webhook.Config
 	BalancedAlloc    *balanced.Config
+	BinpackAlloc     *binpack.Config
 	Diskinf          *disk.Config
 	Numpininf        *numpin.Config
+	Queuedepthinf    *queuedepth.Config
+	Swarmpeersinf    *swarmpeers.Config
+	Synclaginf       *synclag.Config
 	Tagsinf          *tags.Config
 	Metrics          *observations.MetricsConfig
 	Tracing          *observations.TracingConfig
@@ -86,6 +98,20 @@ func (ch *ConfigHelper) LoadConfigFromDisk() error {
 	return ch.manager.LoadJSONFileAndEnv(ch.configPath)
 }
 
+// ReloadConfigFromDisk parses the configuration from disk again and applies
+// the options that can be changed at runtime to the current configurations
+// (see config.Manager.Reload()). It returns the options that changed on
+// disk but need a restart to take effect.
+func (ch *ConfigHelper) ReloadConfigFromDisk() ([]string, error) {
+	newCh := NewConfigHelper(ch.configPath, ch.identityPath, ch.consensus, ch.datastore)
+	defer newCh.Manager().Shutdown()
+	err := newCh.LoadConfigFromDisk()
+	if err != nil {
+		return nil, err
+	}
+	return ch.manager.Reload(newCh.manager)
+}
+
 // LoadIdentityFromDisk parses the identity from disk.
 func (ch *ConfigHelper) LoadIdentityFromDisk() error {
 	// load identity with hack for 0.11.0 - identity separation.
@@ -219,14 +245,20 @@ func (ch *ConfigHelper) init() {
 		Cluster:          &ipfscluster.Config{},
 		Restapi:          rest.NewConfig(),
 		Ipfsproxy:        &ipfsproxy.Config{},
+		Grpcapi:          &grpcapi.Config{},
 		Ipfshttp:         &ipfshttp.Config{},
 		Raft:             &raft.Config{},
 		Crdt:             &crdt.Config{},
 		Statelesstracker: &stateless.Config{},
 		Pubsubmon:        &pubsubmon.Config{},
+		Webhook:          &webhook.Config{},
 		BalancedAlloc:    &balanced.Config{},
+		BinpackAlloc:     &binpack.Config{},
 		Diskinf:          &disk.Config{},
 		Numpininf:        &numpin.Config{},
+		Queuedepthinf:    &queuedepth.Config{},
+		Swarmpeersinf:    &swarmpeers.Config{},
+		Synclaginf:       &synclag.Config{},
 		Tagsinf:          &tags.Config{},
 		Metrics:          &observations.MetricsConfig{},
 		Tracing:          &observations.TracingConfig{},
@@ -236,13 +268,19 @@ func (ch *ConfigHelper) init() {
 	man.RegisterComponent(config.Cluster, cfgs.Cluster)
 	man.RegisterComponent(config.API, cfgs.Restapi)
 	man.RegisterComponent(config.API, cfgs.Ipfsproxy)
+	man.RegisterOptionalComponent(config.API, cfgs.Grpcapi)
 	man.RegisterComponent(config.IPFSConn, cfgs.Ipfshttp)
 	man.RegisterComponent(config.PinTracker, cfgs.Statelesstracker)
 	man.RegisterComponent(config.Monitor, cfgs.Pubsubmon)
+	man.RegisterComponent(config.Monitor, cfgs.Webhook)
 	man.RegisterComponent(config.Allocator, cfgs.BalancedAlloc)
+	man.RegisterOptionalComponent(config.Allocator, cfgs.BinpackAlloc)
 	man.RegisterComponent(config.Informer, cfgs.Diskinf)
 	// man.RegisterComponent(config.Informer, cfgs.Numpininf)
 	man.RegisterComponent(config.Informer, cfgs.Tagsinf)
+	man.RegisterOptionalComponent(config.Informer, cfgs.Queuedepthinf)
+	man.RegisterOptionalComponent(config.Informer, cfgs.Swarmpeersinf)
+	man.RegisterOptionalComponent(config.Informer, cfgs.Synclaginf)
 	man.RegisterComponent(config.Observations, cfgs.Metrics)
 	man.RegisterComponent(config.Observations, cfgs.Tracing)
 
@@ -1,6 +1,7 @@
 package cmdutils
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
@@ -25,12 +26,22 @@ import (
 // different cluster states depending on the consensus component used.
 type StateManager interface {
 	ImportState(io.Reader, api.PinOptions) error
-	ExportState(io.Writer) error
+	ExportState(io.Writer, string) error
 	GetStore() (ds.Datastore, error)
 	GetOfflineState(ds.Datastore) (state.State, error)
 	Clean() error
 }
 
+// Formats in which the state can be exported. Imports detect the format
+// automatically.
+const (
+	// ExportJSON writes a JSON object per pin.
+	ExportJSON = "json"
+	// ExportStream writes the gzip-compressed, versioned streaming
+	// format (see state.Export).
+	ExportStream = "stream"
+)
+
 // NewStateManager returns an state manager implementation for the given
 // consensus ("raft" or "crdt"). It will need initialized configs.
 func NewStateManager(consensus string, datastore string, ident *config.Identity, cfgs *Configs) (StateManager, error) {
@@ -100,7 +111,7 @@ func (raftsm *raftStateManager) ImportState(r io.Reader, opts api.PinOptions) er
 	return raft.SnapshotSave(raftsm.cfgs.Raft, st, raftPeers)
 }
 
-func (raftsm *raftStateManager) ExportState(w io.Writer) error {
+func (raftsm *raftStateManager) ExportState(w io.Writer, format string) error {
 	store, err := raftsm.GetStore()
 	if err != nil {
 		return err
@@ -110,7 +121,7 @@ func (raftsm *raftStateManager) ExportState(w io.Writer) error {
 	if err != nil {
 		return err
 	}
-	return exportState(w, st)
+	return exportState(w, st, format)
 }
 
 func (raftsm *raftStateManager) Clean() error {
@@ -163,7 +174,7 @@ func (crdtsm *crdtStateManager) ImportState(r io.Reader, opts api.PinOptions) er
 	return batchingSt.Commit(context.Background())
 }
 
-func (crdtsm *crdtStateManager) ExportState(w io.Writer) error {
+func (crdtsm *crdtStateManager) ExportState(w io.Writer, format string) error {
 	store, err := crdtsm.GetStore()
 	if err != nil {
 		return err
@@ -173,7 +184,7 @@ func (crdtsm *crdtStateManager) ExportState(w io.Writer) error {
 	if err != nil {
 		return err
 	}
-	return exportState(w, st)
+	return exportState(w, st, format)
 }
 
 func (crdtsm *crdtStateManager) Clean() error {
@@ -187,17 +198,7 @@ func (crdtsm *crdtStateManager) Clean() error {
 
 func importState(r io.Reader, st state.State, opts api.PinOptions) error {
 	ctx := context.Background()
-	dec := json.NewDecoder(r)
-	for {
-		var pin api.Pin
-		err := dec.Decode(&pin)
-		if err == io.EOF {
-			return nil
-		}
-		if err != nil {
-			return err
-		}
-
+	addPin := func(pin *api.Pin) error {
 		if opts.ReplicationFactorMax > 0 {
 			pin.ReplicationFactorMax = opts.ReplicationFactorMax
 		}
@@ -213,15 +214,40 @@ func importState(r io.Reader, st state.State, opts api.PinOptions) error {
 			pin.Allocations = opts.UserAllocations
 		}
 
-		err = st.Add(ctx, &pin)
+		return st.Add(ctx, pin)
+	}
+
+	br := bufio.NewReader(r)
+	if state.IsExport(br) {
+		return state.Import(ctx, br, addPin)
+	}
+
+	dec := json.NewDecoder(br)
+	for {
+		var pin api.Pin
+		err := dec.Decode(&pin)
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
 			return err
 		}
+		if err := addPin(&pin); err != nil {
+			return err
+		}
 	}
 }
 
-// ExportState saves a json representation of a state
-func exportState(w io.Writer, st state.State) error {
+// exportState saves a representation of a state in the given format.
+func exportState(w io.Writer, st state.State, format string) error {
+	switch format {
+	case ExportStream:
+		return state.Export(context.Background(), w, st)
+	case ExportJSON, "":
+	default:
+		return fmt.Errorf("unknown export format '%s'", format)
+	}
+
 	pins, err := st.List(context.Background())
 	if err != nil {
 		return err
@@ -0,0 +1,249 @@
+package ipfscluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"go.opencensus.io/trace"
+)
+
+var (
+	// commitHookCheckInterval is how often we check whether a pin has
+	// reached its allocations.
+	commitHookCheckInterval = 5 * time.Second
+	// commitHookWaitTimeout is how long we wait for a pin to be pinned on
+	// all its allocations before giving up on running the commit hooks.
+	commitHookWaitTimeout = time.Hour
+	// commitHookTimeout is the maximum duration of a single commit hook
+	// attempt.
+	commitHookTimeout = time.Minute
+	// commitHookRetryDelay is the wait before the first retry of a failed
+	// commit hook. It doubles with every attempt.
+	commitHookRetryDelay = 5 * time.Second
+)
+
+// commitHooksEnabled returns true when a commit hook command or URL is set.
+func (c *Cluster) commitHooksEnabled() bool {
+	opts := c.config.reloadable()
+	return opts.CommitHookCommand != "" || opts.CommitHookURL != ""
+}
+
+// pendingCommit is a pin waiting to be pinned on all its allocations before
+// the commit hooks run.
+type pendingCommit struct {
+	pin   *api.Pin
+	since time.Time
+}
+
+// watchCommit makes watchCommits run the configured commit hooks once the
+// given pin is pinned on all its allocations. It replaces any earlier pin
+// watched for the same Cid.
+func (c *Cluster) watchCommit(pin *api.Pin) {
+	if !c.commitHooksEnabled() || pin.Type != api.DataType {
+		return
+	}
+
+	c.commitsMux.Lock()
+	c.commits[pin.Cid] = &pendingCommit{pin: pin, since: time.Now()}
+	c.commitsMux.Unlock()
+}
+
+// watchCommits checks, every commitHookCheckInterval, whether the pins
+// given to watchCommit have been pinned on all their allocations, with a
+// single status request to every peer for all of them.
+func (c *Cluster) watchCommits() {
+	ticker := time.NewTicker(commitHookCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			c.checkCommits(c.ctx)
+		}
+	}
+}
+
+// checkCommits runs the commit hooks of the watched pins which have been
+// pinned on all their allocations and stops watching them, as well as those
+// unpinned, updated or watched for longer than commitHookWaitTimeout.
+func (c *Cluster) checkCommits(ctx context.Context) {
+	ctx, span := trace.StartSpan(ctx, "cluster/checkCommits")
+	defer span.End()
+
+	c.commitsMux.Lock()
+	pending := make([]*pendingCommit, 0, len(c.commits))
+	for _, pc := range c.commits {
+		pending = append(pending, pc)
+	}
+	c.commitsMux.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	done := func(pc *pendingCommit) {
+		c.commitsMux.Lock()
+		if c.commits[pc.pin.Cid] == pc {
+			delete(c.commits, pc.pin.Cid)
+		}
+		c.commitsMux.Unlock()
+	}
+
+	var cids []cid.Cid
+	var pins []*api.Pin
+	for _, pc := range pending {
+		if time.Since(pc.since) > commitHookWaitTimeout {
+			logger.Warnf("%s was not pinned on time. Not running commit hooks", pc.pin.Cid)
+			done(pc)
+			continue
+		}
+		current, err := c.PinGet(ctx, pc.pin.Cid)
+		if err != nil || current.Timestamp.Unix() != pc.pin.Timestamp.Unix() {
+			// unpinned or pinned again, in which case that other
+			// pin will run the hooks.
+			done(pc)
+			continue
+		}
+		cids = append(cids, current.Cid)
+		pins = append(pins, current)
+	}
+	if len(cids) == 0 {
+		return
+	}
+
+	gpis, err := c.StatusCids(ctx, cids)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	for i, gpi := range gpis {
+		current := pins[i]
+		if !pinCommitted(current.Allocations, gpi) {
+			continue
+		}
+		// it may have been watched again meanwhile.
+		c.commitsMux.Lock()
+		pc, ok := c.commits[current.Cid]
+		ok = ok && pc.pin.Timestamp.Unix() == current.Timestamp.Unix()
+		if ok {
+			delete(c.commits, current.Cid)
+		}
+		c.commitsMux.Unlock()
+		if !ok {
+			continue
+		}
+
+		c.wg.Add(1)
+		go func(pin *api.Pin) {
+			defer c.wg.Done()
+			c.runCommitHooks(ctx, pin)
+		}(pc.pin)
+	}
+}
+
+// pinCommitted returns true when all the allocated peers have pinned the
+// item. With no allocations (pin everywhere), all the peers in the status
+// must have pinned it.
+func pinCommitted(allocs []peer.ID, gpi *api.GlobalPinInfo) bool {
+	return gpi.Replication(allocs).Complete()
+}
+
+// runCommitHooks runs the configured commit hooks for the given pin,
+// retrying each of them up to CommitHookRetries times.
+func (c *Cluster) runCommitHooks(ctx context.Context, pin *api.Pin) {
+	ctx, span := trace.StartSpan(ctx, "cluster/runCommitHooks")
+	defer span.End()
+
+	payload, err := json.Marshal(pin)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	opts := c.config.reloadable()
+	if cmd := opts.CommitHookCommand; cmd != "" {
+		c.retryCommitHook(ctx, pin, "command", func(ctx context.Context) error {
+			return runCommitHookCommand(ctx, cmd, pin, payload)
+		})
+	}
+
+	if u := opts.CommitHookURL; u != "" {
+		c.retryCommitHook(ctx, pin, "webhook", func(ctx context.Context) error {
+			return postCommitHook(ctx, u, payload)
+		})
+	}
+}
+
+func (c *Cluster) retryCommitHook(ctx context.Context, pin *api.Pin, kind string, hook func(context.Context) error) {
+	delay := commitHookRetryDelay
+	retries := c.config.reloadable().CommitHookRetries
+	for i := 0; ; i++ {
+		hctx, cancel := context.WithTimeout(ctx, commitHookTimeout)
+		err := hook(hctx)
+		cancel()
+		if err == nil {
+			logger.Debugf("commit %s ran for %s", kind, pin.Cid)
+			return
+		}
+		if i >= retries {
+			logger.Errorf("commit %s failed for %s: %s. Giving up", kind, pin.Cid, err)
+			return
+		}
+		logger.Warnf("commit %s failed for %s: %s. Retrying in %s", kind, pin.Cid, err, delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func runCommitHookCommand(ctx context.Context, command string, pin *api.Pin, payload []byte) error {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return errors.New("empty command")
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), "CLUSTER_PIN_CID="+pin.Cid.String())
+	cmd.Stdin = bytes.NewReader(payload)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+func postCommitHook(ctx context.Context, url string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
@@ -62,6 +62,16 @@ type ComponentConfig interface {
 	ToDisplayJSON() ([]byte, error)
 }
 
+// Reloadable is an optional interface for ComponentConfigs which support
+// changing some of their options while the component is running.
+type Reloadable interface {
+	// Reload takes a freshly loaded configuration of the same type and
+	// applies the options that are safe to change at runtime. It
+	// returns the keys of any other options that differ, as they need
+	// a restart to take effect.
+	Reload(ComponentConfig) ([]string, error)
+}
+
 // These are the component configuration types
 // supported by the Manager.
 const (
@@ -129,6 +139,10 @@ type Manager struct {
 	// in JSON file
 	undefinedComps map[SectionType]map[string]bool
 
+	// map of components which are only written to the JSON
+	// file when it defines them.
+	optionalComps map[SectionType]map[string]bool
+
 	// if a config has been loaded from disk, track the path
 	// so it can be saved to the same place.
 	path    string
@@ -143,6 +157,7 @@ func NewManager() *Manager {
 		ctx:            ctx,
 		cancel:         cancel,
 		undefinedComps: make(map[SectionType]map[string]bool),
+		optionalComps:  make(map[SectionType]map[string]bool),
 		sections:       make(map[SectionType]Section),
 	}
 
@@ -308,6 +323,22 @@ func (cfg *Manager) RegisterComponent(t SectionType, ccfg ComponentConfig) {
 	}
 }
 
+// RegisterOptionalComponent registers a component like RegisterComponent,
+// for components which are disabled unless configured. Their configuration
+// is loaded when the JSON file defines it, but it is not written to the
+// files generated from defaults, so that users add it to opt-in.
+func (cfg *Manager) RegisterOptionalComponent(t SectionType, ccfg ComponentConfig) {
+	cfg.RegisterComponent(t, ccfg)
+	if t == Cluster {
+		return
+	}
+	_, ok := cfg.optionalComps[t]
+	if !ok {
+		cfg.optionalComps[t] = make(map[string]bool)
+	}
+	cfg.optionalComps[t][ccfg.ConfigKey()] = true
+}
+
 // Validate checks that all the registered components in this
 // Manager have valid configurations. It also makes sure that
 // the main Cluster compoenent exists.
@@ -472,6 +503,53 @@ func (cfg *Manager) LoadJSON(bs []byte) error {
 	return cfg.Validate()
 }
 
+// Reload applies the runtime-changeable options from the given Manager to
+// the component configurations registered in this one. newCfg must have
+// the same components registered and must have been loaded already.
+// Component configurations implementing Reloadable decide which options
+// they can take, and for the rest any change requires a restart. Reload
+// returns the options ("component.key") which changed but were not applied.
+func (cfg *Manager) Reload(newCfg *Manager) ([]string, error) {
+	var restartOnly []string
+
+	reloadComp := func(name string, oldComp, newComp ComponentConfig) error {
+		if newComp == nil {
+			return nil
+		}
+		var keys []string
+		var err error
+		if r, ok := oldComp.(Reloadable); ok {
+			keys, err = r.Reload(newComp)
+		} else {
+			keys, err = ChangedKeys(oldComp, newComp)
+		}
+		if err != nil {
+			return fmt.Errorf("reloading %s: %w", name, err)
+		}
+		for _, k := range keys {
+			restartOnly = append(restartOnly, name+"."+k)
+		}
+		return nil
+	}
+
+	if cfg.clusterConfig != nil {
+		err := reloadComp("cluster", cfg.clusterConfig, newCfg.clusterConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, t := range SectionTypes() {
+		for name, comp := range cfg.sections[t] {
+			err := reloadComp(name, comp, newCfg.sections[t][name])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return restartOnly, nil
+}
+
 // SaveJSON saves the JSON representation of the Config to
 // the given path.
 func (cfg *Manager) SaveJSON(path string) error {
@@ -593,7 +671,7 @@ func (cfg *Manager) applyUpdateJSONConfigs(jcfg *jsonConfig, updateJSONConfigs f
 			continue
 		}
 		jsection := jcfg.getSection(t)
-		err := updateJSONConfigs(cfg.sections[t], jsection)
+		err := updateJSONConfigs(cfg.writtenSection(t), jsection)
 		if err != nil {
 			return err
 		}
@@ -602,10 +680,27 @@ func (cfg *Manager) applyUpdateJSONConfigs(jcfg *jsonConfig, updateJSONConfigs f
 	return nil
 }
 
+// writtenSection returns the components of the given section which are
+// written to JSON: all but the optional ones not defined in the loaded JSON.
+func (cfg *Manager) writtenSection(t SectionType) Section {
+	section := make(Section, len(cfg.sections[t]))
+	for k, v := range cfg.sections[t] {
+		if cfg.optionalComps[t][k] && (cfg.jsonCfg == nil || cfg.undefinedComps[t][k]) {
+			continue
+		}
+		section[k] = v
+	}
+	return section
+}
+
 // IsLoadedFromJSON tells whether the given component belonging to
 // the given section type is present in the cluster JSON
-// config or not.
+// config or not. Optional components are never present unless
+// a JSON config has been loaded.
 func (cfg *Manager) IsLoadedFromJSON(t SectionType, name string) bool {
+	if cfg.optionalComps[t][name] && cfg.jsonCfg == nil {
+		return false
+	}
 	return !cfg.undefinedComps[t][name]
 }
 
@@ -126,6 +126,52 @@ func TestManager_ToJSON(t *testing.T) {
 	}
 }
 
+type optionalMockCfg struct {
+	mockCfg
+}
+
+func (m *optionalMockCfg) ConfigKey() string {
+	return "optional"
+}
+
+func TestManager_OptionalComponent(t *testing.T) {
+	cfgMgr := setupConfigManager()
+	cfgMgr.RegisterOptionalComponent(Informer, &optionalMockCfg{})
+	err := cfgMgr.Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfgMgr.IsLoadedFromJSON(Informer, "optional") {
+		t.Error("optional components are not loaded by default")
+	}
+	got, err := cfgMgr.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, mockJSON) {
+		t.Errorf("optional components should not be written by default: %s", got)
+	}
+
+	withOptional := bytes.Replace(mockJSON, []byte(`"informer": {`), []byte(`"informer": {
+    "optional": {
+      "a": "b"
+    },`), 1)
+	err = cfgMgr.LoadJSON(withOptional)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfgMgr.IsLoadedFromJSON(Informer, "optional") {
+		t.Error("the optional component should be loaded")
+	}
+	got, err = cfgMgr.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(got, []byte(`"optional"`)) {
+		t.Errorf("the optional component should be written once configured: %s", got)
+	}
+}
+
 func TestLoadFromHTTPSourceRedirect(t *testing.T) {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
@@ -1,9 +1,11 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 	"time"
 )
@@ -52,6 +54,43 @@ func DefaultJSONMarshal(v interface{}) ([]byte, error) {
 	return bs, nil
 }
 
+// ChangedKeys returns the sorted list of top-level JSON keys whose values
+// differ between the JSON representations of two configurations.
+func ChangedKeys(a, b ComponentConfig) ([]string, error) {
+	toMap := func(c ComponentConfig) (map[string]json.RawMessage, error) {
+		raw, err := c.ToJSON()
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[string]json.RawMessage)
+		err = json.Unmarshal(raw, &m)
+		return m, err
+	}
+
+	aMap, err := toMap(a)
+	if err != nil {
+		return nil, err
+	}
+	bMap, err := toMap(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for k, v := range aMap {
+		if w, ok := bMap[k]; !ok || !bytes.Equal(v, w) {
+			keys = append(keys, k)
+		}
+	}
+	for k := range bMap {
+		if _, ok := aMap[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
 // SetIfNotDefault sets dest to the value of src if src is not the default
 // value of the type.
 // dest must be a pointer.
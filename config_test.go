@@ -38,7 +38,8 @@ var testingClusterCfg = []byte(`{
     "monitor_ping_interval": "1s",
     "peer_watch_interval": "1s",
     "disable_repinning": false,
-    "mdns_interval": "0s"
+    "mdns_interval": "0s",
+    "tombstone_retention": "1h"
 }`)
 
 var testingRaftCfg = []byte(`{
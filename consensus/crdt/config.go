@@ -26,6 +26,8 @@ var (
 	DefaultTrustedPeers         = []peer.ID{}
 	DefaultTrustAll             = true
 	DefaultBatchingMaxQueueSize = 50000
+	DefaultShutdownDrainTimeout = 10 * time.Second
+	DefaultPinCommitTimeout     = time.Duration(0)
 )
 
 // BatchingConfig configures parameters for batching multiple pins in a single
@@ -78,6 +80,18 @@ type Config struct {
 	// All keys written to the datastore will be namespaced with this prefix
 	DatastoreNamespace string
 
+	// ShutdownDrainTimeout is how long Shutdown waits for the pending
+	// batched updates to be committed and for the last updates to reach
+	// the other peers before closing. New updates are rejected meanwhile.
+	// 0 commits the pending batched updates without waiting for them to
+	// propagate.
+	ShutdownDrainTimeout time.Duration
+
+	// PinCommitTimeout bounds how long LogPin and LogUnpin wait for an
+	// update to be committed to the local state and broadcast, when
+	// batching is disabled. 0 means no limit.
+	PinCommitTimeout time.Duration
+
 	// Tracing enables propagation of contexts across binary boundaries.
 	Tracing bool
 }
@@ -89,10 +103,12 @@ type batchingConfigJSON struct {
 }
 
 type jsonConfig struct {
-	ClusterName         string             `json:"cluster_name"`
-	TrustedPeers        []string           `json:"trusted_peers"`
-	Batching            batchingConfigJSON `json:"batching"`
-	RebroadcastInterval string             `json:"rebroadcast_interval,omitempty"`
+	ClusterName          string             `json:"cluster_name"`
+	TrustedPeers         []string           `json:"trusted_peers"`
+	Batching             batchingConfigJSON `json:"batching"`
+	RebroadcastInterval  string             `json:"rebroadcast_interval,omitempty"`
+	ShutdownDrainTimeout string             `json:"shutdown_drain_timeout,omitempty"`
+	PinCommitTimeout     string             `json:"pin_commit_timeout,omitempty"`
 
 	PeersetMetric      string `json:"peerset_metric,omitempty"`
 	DatastoreNamespace string `json:"datastore_namespace,omitempty"`
@@ -120,6 +136,14 @@ func (cfg *Config) Validate() error {
 	if cfg.Batching.MaxQueueSize <= 0 {
 		return errors.New("crdt.batching.max_queue_size is invalid")
 	}
+
+	if cfg.ShutdownDrainTimeout < 0 {
+		return errors.New("crdt.shutdown_drain_timeout is invalid")
+	}
+
+	if cfg.PinCommitTimeout < 0 {
+		return errors.New("crdt.pin_commit_timeout is invalid")
+	}
 	return nil
 }
 
@@ -165,6 +189,8 @@ func (cfg *Config) applyJSONConfig(jcfg *jsonConfig) error {
 		"crdt",
 		&config.DurationOpt{Duration: jcfg.RebroadcastInterval, Dst: &cfg.RebroadcastInterval, Name: "rebroadcast_interval"},
 		&config.DurationOpt{Duration: jcfg.Batching.MaxBatchAge, Dst: &cfg.Batching.MaxBatchAge, Name: "max_batch_age"},
+		&config.DurationOpt{Duration: jcfg.ShutdownDrainTimeout, Dst: &cfg.ShutdownDrainTimeout, Name: "shutdown_drain_timeout"},
+		&config.DurationOpt{Duration: jcfg.PinCommitTimeout, Dst: &cfg.PinCommitTimeout, Name: "pin_commit_timeout"},
 	)
 	return cfg.Validate()
 }
@@ -210,6 +236,14 @@ func (cfg *Config) toJSONConfig() *jsonConfig {
 		jcfg.RebroadcastInterval = cfg.RebroadcastInterval.String()
 	}
 
+	if cfg.ShutdownDrainTimeout != DefaultShutdownDrainTimeout {
+		jcfg.ShutdownDrainTimeout = cfg.ShutdownDrainTimeout.String()
+	}
+
+	if cfg.PinCommitTimeout != DefaultPinCommitTimeout {
+		jcfg.PinCommitTimeout = cfg.PinCommitTimeout.String()
+	}
+
 	return jcfg
 }
 
@@ -221,6 +255,8 @@ func (cfg *Config) Default() error {
 	cfg.DatastoreNamespace = DefaultDatastoreNamespace
 	cfg.TrustedPeers = DefaultTrustedPeers
 	cfg.TrustAll = DefaultTrustAll
+	cfg.ShutdownDrainTimeout = DefaultShutdownDrainTimeout
+	cfg.PinCommitTimeout = DefaultPinCommitTimeout
 	cfg.Batching = BatchingConfig{
 		MaxBatchSize: 0,
 		MaxBatchAge:  0,
@@ -2,15 +2,22 @@ package crdt
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/observations"
 	"github.com/ipfs/ipfs-cluster/pstoremgr"
+	"github.com/ipfs/ipfs-cluster/rpcutil"
 	"github.com/ipfs/ipfs-cluster/state"
 	"github.com/ipfs/ipfs-cluster/state/dsstate"
 
@@ -18,8 +25,10 @@ import (
 	namespace "github.com/ipfs/go-datastore/namespace"
 	query "github.com/ipfs/go-datastore/query"
 	crdt "github.com/ipfs/go-ds-crdt"
+	pb "github.com/ipfs/go-ds-crdt/pb"
 	dshelp "github.com/ipfs/go-ipfs-ds-help"
 	logging "github.com/ipfs/go-log/v2"
+	merkledag "github.com/ipfs/go-merkledag"
 	host "github.com/libp2p/go-libp2p-core/host"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	peerstore "github.com/libp2p/go-libp2p-core/peerstore"
@@ -27,8 +36,11 @@ import (
 	rpc "github.com/libp2p/go-libp2p-gorpc"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	multihash "github.com/multiformats/go-multihash"
+	proto "google.golang.org/protobuf/proto"
 
 	ipfslite "github.com/hsanjuan/ipfs-lite"
+	ipld "github.com/ipfs/go-ipld-format"
+	stats "go.opencensus.io/stats"
 	trace "go.opencensus.io/trace"
 )
 
@@ -36,14 +48,26 @@ var logger = logging.Logger("crdt")
 
 var (
 	blocksNs   = "b" // blockstore namespace
+	headsNs    = "h" // heads namespace used by go-ds-crdt
+	metadataNs = "m" // pin metadata index namespace
 	connMgrTag = "crdt"
 )
 
+// drainCheckInterval is how often we check whether our last updates have
+// propagated to the other peers when shutting down.
+var drainCheckInterval = 500 * time.Millisecond
+
+// dagStatsDelay is how long after a merge the DAG stats are recorded, as
+// go-ds-crdt updates the heads after calling the hooks. Merges in a row are
+// sampled once.
+var dagStatsDelay = 100 * time.Millisecond
+
 // Common variables for the module.
 var (
-	ErrNoLeader            = errors.New("crdt consensus component does not provide a leader")
+	ErrNoLeader            = fmt.Errorf("crdt: %w", api.ErrLeaderless)
 	ErrRmPeer              = errors.New("crdt consensus component cannot remove peers")
 	ErrMaxQueueSizeReached = errors.New("batching max_queue_size reached. Too many operations are waiting to be batched. Try increasing the max_queue_size or adjusting the batching options")
+	ErrShuttingDown        = errors.New("crdt consensus component is shutting down")
 )
 
 // wraps pins so that they can be batched.
@@ -72,7 +96,9 @@ type Consensus struct {
 
 	state         state.State
 	batchingState state.BatchingState
+	metadataIndex *dsstate.MetadataIndex
 	crdt          *crdt.Datastore
+	broadcaster   *crdt.PubSubBroadcaster
 	ipfs          *ipfslite.Peer
 
 	dht    routing.Routing
@@ -83,6 +109,28 @@ type Consensus struct {
 	stateReady  chan struct{}
 	readyCh     chan struct{}
 	batchItemCh chan batchItem
+	// closing drainCh makes the batch worker commit any pending items
+	// and exit, closing batchDone.
+	drainCh   chan struct{}
+	batchDone chan struct{}
+	// number of items in the batch being built, accessed atomically.
+	batchCurSize int64
+	// receives a signal when deltas are merged.
+	mergeCh chan struct{}
+	// receives the heads broadcast by other peers, whose highest height
+	// is kept in remoteHeight (accessed atomically).
+	remoteHeadCh chan cid.Cid
+	remoteHeight uint64
+
+	// closing is set when Shutdown starts, after which LogPin and
+	// LogUnpin reject new updates. closingLock is held for reading while
+	// an update is being submitted.
+	closingLock sync.RWMutex
+	closing     bool
+
+	// gcMux is held for reading by DAG merges and local updates, which
+	// add blocks before the heads point to them, and for writing by GC.
+	gcMux sync.RWMutex
 
 	shutdownLock sync.RWMutex
 	shutdown     bool
@@ -139,6 +187,11 @@ func New(
 		readyCh:     make(chan struct{}, 1),
 		stateReady:  make(chan struct{}, 1),
 		batchItemCh: make(chan batchItem, cfg.Batching.MaxQueueSize),
+		drainCh:     make(chan struct{}),
+		batchDone:   make(chan struct{}),
+		mergeCh:     make(chan struct{}, 1),
+
+		remoteHeadCh: make(chan cid.Cid, 64),
 	}
 
 	go css.setup()
@@ -196,11 +249,15 @@ func (css *Consensus) setup() {
 		logger.Errorf("error creating broadcaster: %s", err)
 		return
 	}
+	css.broadcaster = broadcaster
 
 	opts := crdt.DefaultOptions()
 	opts.RebroadcastInterval = css.config.RebroadcastInterval
 	opts.DAGSyncerTimeout = 2 * time.Minute
 	opts.Logger = logger
+	css.metadataIndex = dsstate.NewMetadataIndex(
+		namespace.Wrap(css.store, css.namespace.ChildString(metadataNs)),
+	)
 	opts.PutHook = func(k ds.Key, v []byte) {
 		ctx, span := trace.StartSpan(css.ctx, "crdt/PutHook")
 		defer span.End()
@@ -211,6 +268,11 @@ func (css *Consensus) setup() {
 			logger.Error(err)
 			return
 		}
+		css.notifyMerge()
+
+		if err := css.metadataIndex.Update(ctx, pin.Cid, pin.Metadata); err != nil {
+			logger.Error(err)
+		}
 
 		// TODO: tracing for this context
 		err = css.rpcClient.CallContext(
@@ -242,6 +304,11 @@ func (css *Consensus) setup() {
 		}
 
 		pin := api.PinCid(c)
+		css.notifyMerge()
+
+		if err := css.metadataIndex.Update(ctx, c, nil); err != nil {
+			logger.Error(err)
+		}
 
 		err = css.rpcClient.CallContext(
 			ctx,
@@ -260,8 +327,8 @@ func (css *Consensus) setup() {
 	crdt, err := crdt.New(
 		css.store,
 		css.namespace,
-		css.ipfs,
-		broadcaster,
+		&gcSyncer{Peer: css.ipfs, mux: &css.gcMux},
+		&headsBroadcaster{Broadcaster: broadcaster, received: css.learnHeads},
 		opts,
 	)
 	if err != nil {
@@ -283,6 +350,9 @@ func (css *Consensus) setup() {
 		logger.Errorf("error creating cluster state datastore: %s", err)
 		return
 	}
+	// The put and delete hooks index the pins, including those written
+	// by this peer.
+	clusterState.UseMetadataIndex(css.metadataIndex)
 	css.state = clusterState
 
 	batchingState, err := dsstate.NewBatching(
@@ -294,6 +364,7 @@ func (css *Consensus) setup() {
 		logger.Errorf("error creating cluster state batching datastore: %s", err)
 		return
 	}
+	batchingState.UseMetadataIndex(css.metadataIndex)
 	css.batchingState = batchingState
 
 	if css.config.TrustAll {
@@ -309,6 +380,10 @@ func (css *Consensus) setup() {
 		go css.batchWorker()
 	}
 
+	css.recordDAGStats(css.ctx)
+	go css.dagStatsWorker()
+	go css.syncLagWorker()
+
 	// notifies State() it is safe to return
 	close(css.stateReady)
 	css.readyCh <- struct{}{}
@@ -327,6 +402,8 @@ func (css *Consensus) Shutdown(ctx context.Context) error {
 
 	logger.Info("stopping Consensus component")
 
+	css.drain(ctx)
+
 	css.cancel()
 
 	// Only close crdt after cancelling the context, otherwise
@@ -344,6 +421,109 @@ func (css *Consensus) Shutdown(ctx context.Context) error {
 	return nil
 }
 
+// drain stops accepting new updates and commits the batched ones. Then,
+// when ShutdownDrainTimeout is set, it broadcasts the current heads and
+// waits until the peers that can be reached report the same state as this
+// peer. ShutdownDrainTimeout bounds the whole process.
+func (css *Consensus) drain(ctx context.Context) {
+	ctx, span := trace.StartSpan(ctx, "consensus/drain")
+	defer span.End()
+
+	// Wait for the updates being submitted, so that no update is
+	// queued after the batch is flushed.
+	css.closingLock.Lock()
+	css.closing = true
+	css.closingLock.Unlock()
+
+	if timeout := css.config.ShutdownDrainTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	select {
+	case <-css.stateReady:
+	default:
+		return // nothing to drain
+	}
+
+	if css.config.batchingEnabled() {
+		close(css.drainCh)
+		select {
+		case <-css.batchDone:
+		case <-ctx.Done():
+			pending := int64(len(css.batchItemCh)) + atomic.LoadInt64(&css.batchCurSize)
+			logger.Errorf("timed out committing the pending batch on shutdown: %d updates were not committed", pending)
+			return
+		}
+	}
+
+	if css.config.ShutdownDrainTimeout <= 0 {
+		return
+	}
+
+	if err := css.Reconcile(ctx); err != nil {
+		logger.Warnf("error broadcasting the heads on shutdown: %s", err)
+		return
+	}
+
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+	for !css.propagated(ctx) {
+		select {
+		case <-ctx.Done():
+			logger.Warn("timed out waiting for the last updates to propagate")
+			return
+		case <-ticker.C:
+		}
+	}
+	logger.Debug("last updates propagated")
+}
+
+// propagated returns true when all the peers that answer report the same
+// state digest as this peer.
+func (css *Consensus) propagated(ctx context.Context) bool {
+	var self api.StateDigest
+	err := css.rpcClient.CallContext(ctx, "", "Cluster", "StateDigestLocal", struct{}{}, &self)
+	if err != nil {
+		logger.Debugf("cannot get our state digest: %s", err)
+		return true // we cannot tell
+	}
+
+	peers, err := css.Peers(ctx)
+	if err != nil {
+		logger.Debugf("cannot list peers: %s", err)
+		return true
+	}
+	others := make([]peer.ID, 0, len(peers))
+	for _, p := range peers {
+		if p != css.host.ID() {
+			others = append(others, p)
+		}
+	}
+
+	lenOthers := len(others)
+	digests := make([]*api.StateDigest, lenOthers)
+	ifaces := make([]interface{}, lenOthers)
+	for i := range digests {
+		digests[i] = &api.StateDigest{}
+		ifaces[i] = digests[i]
+	}
+
+	ctxs, cancels := rpcutil.CtxsWithTimeout(ctx, lenOthers, drainCheckInterval*4)
+	defer rpcutil.MultiCancel(cancels)
+
+	errs := css.rpcClient.MultiCall(ctxs, others, "Cluster", "StateDigestLocal", struct{}{}, ifaces)
+	for i, err := range errs {
+		// peers that do not answer (i.e. shutting down as well) are
+		// not waited for.
+		if err == nil && digests[i].Digest != self.Digest {
+			return false
+		}
+	}
+	return true
+}
+
 // SetClient gives the component the ability to communicate and
 // leaves it ready to use.
 func (css *Consensus) SetClient(c *rpc.Client) {
@@ -407,7 +587,14 @@ func (css *Consensus) LogPin(ctx context.Context, pin *api.Pin) error {
 	ctx, span := trace.StartSpan(ctx, "consensus/LogPin")
 	defer span.End()
 
+	css.closingLock.RLock()
+	if css.closing {
+		css.closingLock.RUnlock()
+		return fmt.Errorf("error pinning: %w", ErrShuttingDown)
+	}
+
 	if css.config.batchingEnabled() {
+		defer css.closingLock.RUnlock()
 		select {
 		case css.batchItemCh <- batchItem{
 			ctx:   ctx,
@@ -419,8 +606,11 @@ func (css *Consensus) LogPin(ctx context.Context, pin *api.Pin) error {
 			return fmt.Errorf("error pinning: %w", ErrMaxQueueSizeReached)
 		}
 	}
+	css.closingLock.RUnlock()
 
-	return css.state.Add(ctx, pin)
+	return css.commitUpdate(ctx, "LogPin", func() error {
+		return css.state.Add(ctx, pin)
+	})
 }
 
 // LogUnpin removes a pin from the shared state.
@@ -428,7 +618,14 @@ func (css *Consensus) LogUnpin(ctx context.Context, pin *api.Pin) error {
 	ctx, span := trace.StartSpan(ctx, "consensus/LogUnpin")
 	defer span.End()
 
+	css.closingLock.RLock()
+	if css.closing {
+		css.closingLock.RUnlock()
+		return fmt.Errorf("error unpinning: %w", ErrShuttingDown)
+	}
+
 	if css.config.batchingEnabled() {
+		defer css.closingLock.RUnlock()
 		select {
 		case css.batchItemCh <- batchItem{
 			ctx:   ctx,
@@ -440,8 +637,40 @@ func (css *Consensus) LogUnpin(ctx context.Context, pin *api.Pin) error {
 			return fmt.Errorf("error unpinning: %w", ErrMaxQueueSizeReached)
 		}
 	}
+	css.closingLock.RUnlock()
+
+	return css.commitUpdate(ctx, "LogUnpin", func() error {
+		return css.state.Rm(ctx, pin.Cid)
+	})
+}
+
+// commitUpdate applies an unbatched update with f, waiting for it for
+// PinCommitTimeout at most or until ctx is cancelled. go-ds-crdt offers no
+// way to interrupt an update, which is then still applied and broadcast.
+func (css *Consensus) commitUpdate(ctx context.Context, method string, f func() error) error {
+	if css.config.PinCommitTimeout <= 0 {
+		return css.updateDAG(f)
+	}
 
-	return css.state.Rm(ctx, pin.Cid)
+	ctx, cancel := context.WithTimeout(ctx, css.config.PinCommitTimeout)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- css.updateDAG(f)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return ctx.Err()
+		}
+		err := fmt.Errorf("%w: %s did not complete in %s", api.ErrTimeout, method, css.config.PinCommitTimeout)
+		logger.Error(err)
+		return err
+	}
 }
 
 // Launched in setup as a goroutine.
@@ -460,6 +689,9 @@ func (css *Consensus) batchWorker() {
 		select {
 		case <-css.ctx.Done():
 			return
+		case <-css.drainCh:
+			css.drainBatch(batchCurSize)
+			return
 		case batchItem := <-css.batchItemCh:
 			// First item in batch. Start the timer
 			if batchCurSize == 0 {
@@ -469,9 +701,13 @@ func (css *Consensus) batchWorker() {
 			// Add/Rm from state
 			var err error
 			if batchItem.isPin {
-				err = css.batchingState.Add(batchItem.ctx, batchItem.pin)
+				err = css.updateDAG(func() error {
+					return css.batchingState.Add(batchItem.ctx, batchItem.pin)
+				})
 			} else {
-				err = css.batchingState.Rm(batchItem.ctx, batchItem.pin.Cid)
+				err = css.updateDAG(func() error {
+					return css.batchingState.Rm(batchItem.ctx, batchItem.pin.Cid)
+				})
 			}
 			if err != nil {
 				logger.Errorf("error batching: %s (%s, isPin: %s)", err, batchItem.pin.Cid, batchItem.isPin)
@@ -479,12 +715,13 @@ func (css *Consensus) batchWorker() {
 			}
 
 			batchCurSize++
+			atomic.StoreInt64(&css.batchCurSize, int64(batchCurSize))
 
 			if batchCurSize < maxSize {
 				continue
 			}
 
-			if err := css.batchingState.Commit(css.ctx); err != nil {
+			if err := css.commitBatch(); err != nil {
 				logger.Errorf("error commiting batch after reaching max size: %s", err)
 				continue
 			}
@@ -496,10 +733,11 @@ func (css *Consensus) batchWorker() {
 				<-batchTimer.C
 			}
 			batchCurSize = 0
+			atomic.StoreInt64(&css.batchCurSize, 0)
 
 		case <-batchTimer.C:
 			// Commit
-			if err := css.batchingState.Commit(css.ctx); err != nil {
+			if err := css.commitBatch(); err != nil {
 				logger.Errorf("error commiting batch after reaching max age: %s", err)
 				continue
 			}
@@ -507,8 +745,54 @@ func (css *Consensus) batchWorker() {
 			// timer is expired at this point, it will have to be
 			// reset.
 			batchCurSize = 0
+			atomic.StoreInt64(&css.batchCurSize, 0)
+		}
+	}
+}
+
+// commitBatch commits the current batch. See updateDAG.
+func (css *Consensus) commitBatch() error {
+	return css.updateDAG(func() error {
+		return css.batchingState.Commit(css.ctx)
+	})
+}
+
+// drainBatch commits the items waiting in the queue along with the given
+// number of items already in the current batch, and closes batchDone.
+func (css *Consensus) drainBatch(batchCurSize int) {
+	defer close(css.batchDone)
+
+	for pending := true; pending; {
+		select {
+		case batchItem := <-css.batchItemCh:
+			var err error
+			if batchItem.isPin {
+				err = css.updateDAG(func() error {
+					return css.batchingState.Add(batchItem.ctx, batchItem.pin)
+				})
+			} else {
+				err = css.updateDAG(func() error {
+					return css.batchingState.Rm(batchItem.ctx, batchItem.pin.Cid)
+				})
+			}
+			if err != nil {
+				logger.Errorf("error batching: %s (%s, isPin: %s)", err, batchItem.pin.Cid, batchItem.isPin)
+				continue
+			}
+			batchCurSize++
+		default:
+			pending = false
 		}
 	}
+
+	if batchCurSize == 0 {
+		return
+	}
+	if err := css.commitBatch(); err != nil {
+		logger.Errorf("error commiting batch on shutdown: %s", err)
+		return
+	}
+	logger.Infof("batch commit (shutdown): %d items", batchCurSize)
 }
 
 // Peers returns the current known peerset. It uses
@@ -556,6 +840,280 @@ func (css *Consensus) Peers(ctx context.Context) ([]peer.ID, error) {
 // component to be usable.
 func (css *Consensus) WaitForSync(ctx context.Context) error { return nil }
 
+// Reconcile broadcasts the current heads of the CRDT DAG, as a regular
+// rebroadcast would, so that peers which diverged from us fetch and merge
+// the branches they are missing.
+func (css *Consensus) Reconcile(ctx context.Context) error {
+	ctx, span := trace.StartSpan(ctx, "consensus/Reconcile")
+	defer span.End()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-css.ctx.Done():
+		return css.ctx.Err()
+	case <-css.stateReady:
+	}
+
+	heads, err := css.heads(ctx)
+	if err != nil {
+		return err
+	}
+	if len(heads) == 0 {
+		return nil
+	}
+
+	bcast := &pb.CRDTBroadcast{}
+	for _, h := range heads {
+		bcast.Heads = append(bcast.Heads, &pb.Head{Cid: h.Bytes()})
+	}
+	data, err := proto.Marshal(bcast)
+	if err != nil {
+		return err
+	}
+	logger.Infof("rebroadcasting %d heads to reconcile the shared state", len(heads))
+	return css.broadcaster.Broadcast(data)
+}
+
+// Digest returns a hash of the current heads of the CRDT DAG. Replicas which
+// merged the same DAG have the same heads, and therefore the same state, so
+// this does not need to list the state.
+func (css *Consensus) Digest(ctx context.Context) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-css.ctx.Done():
+		return "", css.ctx.Err()
+	case <-css.stateReady:
+	}
+
+	heads, err := css.heads(ctx)
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(heads, func(i, j int) bool {
+		return heads[i].KeyString() < heads[j].KeyString()
+	})
+	h := sha256.New()
+	for _, c := range heads {
+		h.Write(c.Bytes())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// heads returns the current heads of the CRDT DAG as stored by go-ds-crdt.
+func (css *Consensus) heads(ctx context.Context) ([]cid.Cid, error) {
+	prefix := css.namespace.ChildString(headsNs).String()
+	results, err := css.store.Query(ctx, query.Query{
+		Prefix:   prefix,
+		KeysOnly: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var heads []cid.Cid
+	for r := range results.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		headKey := ds.NewKey(strings.TrimPrefix(r.Key, prefix))
+		head, err := dshelp.DsKeyToCidV1(headKey, cid.DagProtobuf)
+		if err != nil {
+			return nil, err
+		}
+		heads = append(heads, head)
+	}
+	return heads, nil
+}
+
+// gcSyncer is the DAGSyncer given to go-ds-crdt. Each session, used to
+// fetch and merge a branch of the DAG, holds the GC lock for reading until
+// it is finished, so that GC does not remove blocks which are being merged.
+type gcSyncer struct {
+	*ipfslite.Peer
+	mux *sync.RWMutex
+}
+
+// Session returns a NodeGetter for a DAG merge which lasts until ctx is
+// cancelled.
+func (cs *gcSyncer) Session(ctx context.Context) ipld.NodeGetter {
+	cs.mux.RLock()
+	go func() {
+		<-ctx.Done()
+		cs.mux.RUnlock()
+	}()
+	return cs.Peer.Session(ctx)
+}
+
+// updateDAG runs f, which updates the state and may add new deltas to the
+// DAG, so that it does not run at the same time as GC.
+func (css *Consensus) updateDAG(f func() error) error {
+	css.gcMux.RLock()
+	defer css.gcMux.RUnlock()
+	return f()
+}
+
+// Compact runs GC. The history of the CRDT DAG is not compacted:
+// go-ds-crdt cannot collapse the deltas reachable from the heads into a
+// snapshot, and it needs them to find where the branches broadcast by
+// other peers join the DAG, while peers joining the cluster fetch them to
+// rebuild the state.
+func (css *Consensus) Compact(ctx context.Context) error {
+	return css.GC(ctx)
+}
+
+// GC deletes the blocks in the CRDT blockstore which cannot be reached from
+// the current heads. These are left behind by syncs which failed half way,
+// and go-ds-crdt would otherwise consider them as already merged. DAG
+// merges and local updates wait while GC runs, and GC waits for those in
+// progress, so no block that is being merged is removed.
+func (css *Consensus) GC(ctx context.Context) error {
+	ctx, span := trace.StartSpan(ctx, "consensus/GC")
+	defer span.End()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-css.ctx.Done():
+		return css.ctx.Err()
+	case <-css.stateReady:
+	}
+
+	css.gcMux.Lock()
+	defer css.gcMux.Unlock()
+
+	bs := css.ipfs.BlockStore()
+
+	// List the blocks before walking the DAG so that anything added in
+	// the meantime is kept.
+	keys, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		return err
+	}
+	var all []cid.Cid
+	for k := range keys {
+		all = append(all, k)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	heads, err := css.heads(ctx)
+	if err != nil {
+		return err
+	}
+
+	reachable := make(map[string]struct{})
+	pending := heads
+	for len(pending) > 0 {
+		c := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if _, ok := reachable[string(c.Hash())]; ok {
+			continue
+		}
+		blk, err := bs.Get(ctx, c)
+		if err != nil {
+			return fmt.Errorf("error reading DAG block %s (is the DAG still syncing?): %w", c, err)
+		}
+		nd, err := merkledag.DecodeProtobufBlock(blk)
+		if err != nil {
+			return fmt.Errorf("error decoding DAG block %s: %w", c, err)
+		}
+		reachable[string(c.Hash())] = struct{}{}
+		for _, l := range nd.Links() {
+			pending = append(pending, l.Cid)
+		}
+	}
+
+	removed := 0
+	for _, c := range all {
+		if _, ok := reachable[string(c.Hash())]; ok {
+			continue
+		}
+		if err := bs.DeleteBlock(ctx, c); err != nil {
+			return err
+		}
+		removed++
+	}
+	logger.Infof("garbage-collected the CRDT blockstore: removed %d unreachable blocks, kept %d", removed, len(all)-removed)
+	return nil
+}
+
+// dagStats returns the number of heads of the CRDT DAG and the height of the
+// highest one, which go-ds-crdt stores as their values.
+func (css *Consensus) dagStats(ctx context.Context) (int, uint64, error) {
+	results, err := css.store.Query(ctx, query.Query{
+		Prefix: css.namespace.ChildString(headsNs).String(),
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	defer results.Close()
+
+	var heads int
+	var maxHeight uint64
+	for r := range results.Next() {
+		if r.Error != nil {
+			return 0, 0, r.Error
+		}
+		heads++
+		height, n := binary.Uvarint(r.Value)
+		if n <= 0 {
+			return 0, 0, fmt.Errorf("error decoding the height of head %s", r.Key)
+		}
+		if height > maxHeight {
+			maxHeight = height
+		}
+	}
+	return heads, maxHeight, nil
+}
+
+// notifyMerge signals the dagStatsWorker that deltas were merged.
+func (css *Consensus) notifyMerge() {
+	select {
+	case css.mergeCh <- struct{}{}:
+	default:
+	}
+}
+
+// dagStatsWorker records the DAG stats after deltas are merged. Launched in
+// setup as a goroutine.
+func (css *Consensus) dagStatsWorker() {
+	for {
+		select {
+		case <-css.ctx.Done():
+			return
+		case <-css.mergeCh:
+		}
+
+		select {
+		case <-css.ctx.Done():
+			return
+		case <-time.After(dagStatsDelay):
+		}
+		css.recordDAGStats(css.ctx)
+	}
+}
+
+// recordDAGStats records the number of heads, the height of the highest head
+// and the number of pending batched updates.
+func (css *Consensus) recordDAGStats(ctx context.Context) {
+	heads, maxHeight, err := css.dagStats(ctx)
+	if err != nil {
+		logger.Warn(err)
+		return
+	}
+	pending := int64(len(css.batchItemCh)) + atomic.LoadInt64(&css.batchCurSize)
+	stats.Record(
+		ctx,
+		observations.CRDTHeads.M(int64(heads)),
+		observations.CRDTMaxHeadHeight.M(int64(maxHeight)),
+		observations.CRDTPendingDeltas.M(pending),
+	)
+}
+
 // AddPeer is a no-op as we do not need to do peerset management with
 // Merkle-CRDTs. Therefore adding a peer to the peerset means doing nothing.
 func (css *Consensus) AddPeer(ctx context.Context, pid peer.ID) error {
@@ -581,6 +1139,12 @@ func (css *Consensus) State(ctx context.Context) (state.ReadOnly, error) {
 	}
 }
 
+// GetLinearizable returns the same as State. Updates are not ordered in
+// CRDT mode, so there is no committed state to wait for.
+func (css *Consensus) GetLinearizable(ctx context.Context) (state.ReadOnly, error) {
+	return css.State(ctx)
+}
+
 // Clean deletes all crdt-consensus datas from the datastore.
 func (css *Consensus) Clean(ctx context.Context) error {
 	return Clean(ctx, css.config, css.store)
@@ -614,7 +1178,7 @@ func Clean(ctx context.Context, cfg *Config, store ds.Datastore) error {
 	return nil
 }
 
-// Leader returns ErrNoLeader.
+// Leader returns ErrNoLeader, which wraps api.ErrLeaderless.
 func (css *Consensus) Leader(ctx context.Context) (peer.ID, error) {
 	return "", ErrNoLeader
 }
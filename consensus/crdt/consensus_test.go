@@ -2,16 +2,23 @@ package crdt
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/datastore/inmem"
+	"github.com/ipfs/ipfs-cluster/observations"
+	"github.com/ipfs/ipfs-cluster/state"
 	"github.com/ipfs/ipfs-cluster/test"
 
 	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	pb "github.com/ipfs/go-ds-crdt/pb"
 	ipns "github.com/ipfs/go-ipns"
+	merkledag "github.com/ipfs/go-merkledag"
 	libp2p "github.com/libp2p/go-libp2p"
 	host "github.com/libp2p/go-libp2p-core/host"
 	peerstore "github.com/libp2p/go-libp2p-core/peerstore"
@@ -20,6 +27,9 @@ import (
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	record "github.com/libp2p/go-libp2p-record"
 	routedhost "github.com/libp2p/go-libp2p/p2p/host/routed"
+	multihash "github.com/multiformats/go-multihash"
+	"go.opencensus.io/stats/view"
+	proto "google.golang.org/protobuf/proto"
 )
 
 func makeTestingHost(t *testing.T) (host.Host, *pubsub.PubSub, *dual.DHT) {
@@ -66,12 +76,16 @@ func testingConsensus(t *testing.T, idn int) *Consensus {
 }
 
 func testingConsensusWithCfg(t *testing.T, idn int, cfg *Config) *Consensus {
+	return testingConsensusWithStore(t, idn, cfg, inmem.New())
+}
+
+func testingConsensusWithStore(t *testing.T, idn int, cfg *Config, store ds.Datastore) *Consensus {
 	h, psub, dht := makeTestingHost(t)
 
 	cfg.DatastoreNamespace = fmt.Sprintf("crdttest-%d", idn)
 	cfg.hostShutdown = true
 
-	cc, err := New(h, dht, psub, cfg, inmem.New())
+	cc, err := New(h, dht, psub, cfg, store)
 	if err != nil {
 		t.Fatal("cannot create Consensus:", err)
 	}
@@ -134,6 +148,46 @@ func TestConsensusPin(t *testing.T) {
 	}
 }
 
+// slowDatastore delays every write by the delay set, as a datastore which
+// cannot keep up would, so that committing updates is slow.
+type slowDatastore struct {
+	ds.Datastore
+	delay int64 // time.Duration, updated atomically
+}
+
+func (sds *slowDatastore) Put(ctx context.Context, key ds.Key, value []byte) error {
+	time.Sleep(time.Duration(atomic.LoadInt64(&sds.delay)))
+	return sds.Datastore.Put(ctx, key, value)
+}
+
+func TestConsensusPinCommitTimeout(t *testing.T) {
+	ctx := context.Background()
+	cfg := &Config{}
+	cfg.Default()
+	cfg.PinCommitTimeout = 100 * time.Millisecond
+	store := &slowDatastore{Datastore: inmem.New()}
+	cc := testingConsensusWithStore(t, 1, cfg, store)
+	defer clean(t, cc)
+	defer cc.Shutdown(ctx)
+
+	atomic.StoreInt64(&store.delay, int64(500*time.Millisecond))
+	err := cc.LogPin(ctx, testPin(test.Cid1))
+	if !errors.Is(err, api.ErrTimeout) {
+		t.Fatal("expected a timeout error:", err)
+	}
+	atomic.StoreInt64(&store.delay, 0)
+
+	// The update is not interrupted and makes it to the state.
+	time.Sleep(time.Second)
+	st, err := cc.State(ctx)
+	if err != nil {
+		t.Fatal("error getting state:", err)
+	}
+	if _, err := st.Get(ctx, test.Cid1); err != nil {
+		t.Error("the pin should be in the state:", err)
+	}
+}
+
 func TestConsensusUnpin(t *testing.T) {
 	ctx := context.Background()
 	cc := testingConsensus(t, 1)
@@ -191,6 +245,53 @@ func TestConsensusUpdate(t *testing.T) {
 	}
 }
 
+func TestConsensusPinsByMetadata(t *testing.T) {
+	ctx := context.Background()
+	cc := testingConsensus(t, 1)
+	defer clean(t, cc)
+	defer cc.Shutdown(ctx)
+
+	byMetadata := func(value string) []*api.Pin {
+		time.Sleep(250 * time.Millisecond)
+		st, err := cc.State(ctx)
+		if err != nil {
+			t.Fatal("error getting state:", err)
+		}
+		pins, err := st.(state.MetadataIndexer).PinsByMetadata(ctx, "project", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pins
+	}
+
+	pin := testPin(test.Cid1)
+	pin.Metadata = map[string]string{"project": "a"}
+	if err := cc.LogPin(ctx, pin); err != nil {
+		t.Fatal(err)
+	}
+	if pins := byMetadata("a"); len(pins) != 1 || !pins[0].Cid.Equals(test.Cid1) {
+		t.Fatalf("expected the pin to be found by its metadata; got %v", pins)
+	}
+
+	pin.Metadata = map[string]string{"project": "b"}
+	if err := cc.LogPin(ctx, pin); err != nil {
+		t.Fatal(err)
+	}
+	if pins := byMetadata("a"); len(pins) != 0 {
+		t.Errorf("the old metadata should not be indexed; got %v", pins)
+	}
+	if pins := byMetadata("b"); len(pins) != 1 {
+		t.Errorf("the new metadata should be indexed; got %v", pins)
+	}
+
+	if err := cc.LogUnpin(ctx, pin); err != nil {
+		t.Fatal(err)
+	}
+	if pins := byMetadata("b"); len(pins) != 0 {
+		t.Errorf("unpinned pins should not be indexed; got %v", pins)
+	}
+}
+
 func TestConsensusAddRmPeer(t *testing.T) {
 	ctx := context.Background()
 	cc := testingConsensus(t, 1)
@@ -316,6 +417,18 @@ func TestPeers(t *testing.T) {
 	}
 }
 
+func TestConsensusLeader(t *testing.T) {
+	ctx := context.Background()
+	cc := testingConsensus(t, 1)
+	defer clean(t, cc)
+	defer cc.Shutdown(ctx)
+
+	_, err := cc.Leader(ctx)
+	if !errors.Is(err, api.ErrLeaderless) {
+		t.Errorf("expected a leaderless error: %s", err)
+	}
+}
+
 func TestOfflineState(t *testing.T) {
 	ctx := context.Background()
 	cc := testingConsensus(t, 1)
@@ -425,3 +538,310 @@ func TestBatching(t *testing.T) {
 		t.Error("expected 5 items pinned")
 	}
 }
+
+func TestShutdownDrainsBatch(t *testing.T) {
+	ctx := context.Background()
+	cfg := &Config{}
+	cfg.Default()
+	cfg.Batching.MaxBatchSize = 100
+	cfg.Batching.MaxBatchAge = time.Hour
+
+	cc := testingConsensusWithCfg(t, 1, cfg)
+	defer clean(t, cc)
+	defer cc.Shutdown(ctx)
+
+	for _, c := range []cid.Cid{test.Cid1, test.Cid2} {
+		err := cc.LogPin(ctx, testPin(c))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := cc.Shutdown(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cc.LogPin(ctx, testPin(test.Cid3))
+	if !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("updates should be rejected after shutdown: %v", err)
+	}
+
+	offlineState, err := OfflineState(cc.config, cc.store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pins, err := offlineState.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 2 {
+		t.Errorf("the batched pins should have been committed on shutdown: %d pins", len(pins))
+	}
+}
+
+func TestConsensusReconcile(t *testing.T) {
+	ctx := context.Background()
+	cc := testingConsensus(t, 1)
+	defer clean(t, cc)
+	defer cc.Shutdown(ctx)
+
+	err := cc.LogPin(ctx, testPin(test.Cid1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(250 * time.Millisecond)
+
+	heads, err := cc.heads(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(heads) != 1 {
+		t.Fatalf("expected 1 head, got %d", len(heads))
+	}
+
+	err = cc.Reconcile(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDAGStats(t *testing.T) {
+	ctx := context.Background()
+	err := view.Register(observations.CRDTHeadsView)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(observations.CRDTHeadsView)
+
+	cc := testingConsensus(t, 1)
+	cc2 := testingConsensus(t, 2)
+	defer clean(t, cc)
+	defer clean(t, cc2)
+	defer cc.Shutdown(ctx)
+	defer cc2.Shutdown(ctx)
+
+	// The peers are not connected yet, so the deltas of each one make a
+	// branch.
+	for i, c := range []*Consensus{cc, cc2} {
+		for _, ci := range []cid.Cid{test.Cid1, test.Cid2, test.Cid3} {
+			p := testPin(ci)
+			p.Name = fmt.Sprintf("peer%d", i)
+			if err := c.LogPin(ctx, p); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	heads, height, err := cc.dagStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if heads != 1 || height != 3 {
+		t.Fatalf("expected 1 head with height 3; got %d heads, height %d", heads, height)
+	}
+
+	cc.host.Peerstore().AddAddrs(cc2.host.ID(), cc2.host.Addrs(), peerstore.PermanentAddrTTL)
+	_, err = cc.host.Network().DialPeer(ctx, cc2.host.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	cc.Trust(ctx, cc2.host.ID())
+	cc2.Trust(ctx, cc.host.ID())
+	if err := cc.Reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := cc2.Reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+
+	for _, c := range []*Consensus{cc, cc2} {
+		heads, _, err := c.dagStats(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if heads != 2 {
+			t.Errorf("expected 2 heads after merging the branches; got %d", heads)
+		}
+	}
+
+	rows, err := view.RetrieveData(observations.CRDTHeadsView.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 row; got %d", len(rows))
+	}
+	if v := rows[0].Data.(*view.LastValueData).Value; v != 2 {
+		t.Errorf("the heads gauge should be 2; got %f", v)
+	}
+}
+
+func TestGC(t *testing.T) {
+	ctx := context.Background()
+	cc := testingConsensus(t, 1)
+	defer clean(t, cc)
+	defer cc.Shutdown(ctx)
+
+	countBlocks := func() int {
+		keys, err := cc.ipfs.BlockStore().AllKeysChan(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for range keys {
+			n++
+		}
+		return n
+	}
+
+	var cids []cid.Cid
+	for i := 0; i < 20; i++ {
+		h, err := multihash.Sum([]byte(fmt.Sprintf("gc-%d", i)), multihash.SHA2_256, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := cid.NewCidV1(cid.Raw, h)
+		if err := cc.LogPin(ctx, testPin(c)); err != nil {
+			t.Fatal(err)
+		}
+		cids = append(cids, c)
+	}
+
+	// Blocks from a sync which did not complete.
+	for i := 0; i < 5; i++ {
+		nd := merkledag.NodeWithData([]byte(fmt.Sprintf("orphan-%d", i)))
+		if err := cc.ipfs.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before := countBlocks()
+	if err := cc.GC(ctx); err != nil {
+		t.Fatal(err)
+	}
+	after := countBlocks()
+	if after != before-5 {
+		t.Errorf("expected 5 blocks to be removed; before: %d, after: %d", before, after)
+	}
+
+	st, err := cc.State(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cids {
+		if ok, _ := st.Has(ctx, c); !ok {
+			t.Errorf("%s should still be pinned after GC", c)
+		}
+	}
+
+	// Running GC again does not remove anything, and new deltas are
+	// still written on top of the heads.
+	if err := cc.GC(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := countBlocks(); n != after {
+		t.Errorf("second GC should not remove blocks; got %d, expected %d", n, after)
+	}
+	if err := cc.LogUnpin(ctx, api.PinCid(cids[0])); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := st.Has(ctx, cids[0]); ok {
+		t.Error("unpin after GC should have been applied")
+	}
+
+	// GC waits for the DAG merges in progress.
+	sessionCtx, cancel := context.WithCancel(ctx)
+	syncer := &gcSyncer{Peer: cc.ipfs, mux: &cc.gcMux}
+	syncer.Session(sessionCtx)
+	done := make(chan error, 1)
+	go func() {
+		done <- cc.GC(ctx)
+	}()
+	select {
+	case <-done:
+		t.Fatal("GC should wait for the merge session to finish")
+	case <-time.After(200 * time.Millisecond):
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("GC should run once the merge session finishes")
+	}
+}
+
+func TestConsensusSyncLag(t *testing.T) {
+	ctx := context.Background()
+	cc := testingConsensus(t, 1)
+	defer clean(t, cc)
+	defer cc.Shutdown(ctx)
+
+	for _, c := range []cid.Cid{test.Cid1, test.Cid2, test.Cid3} {
+		if err := cc.LogPin(ctx, testPin(c)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lag, err := cc.SyncLag(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lag != 0 {
+		t.Fatal("an up to date peer should have no lag: ", lag)
+	}
+
+	_, local, err := cc.dagStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Induce lag: a peer broadcasts a head 10 deltas ahead of ours.
+	data, err := proto.Marshal(&pb.Delta{Priority: local + 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd := merkledag.NodeWithData(data)
+	if err := cc.ipfs.Add(ctx, nd); err != nil {
+		t.Fatal(err)
+	}
+	bcast, err := proto.Marshal(&pb.CRDTBroadcast{
+		Heads: []*pb.Head{{Cid: nd.Cid().Bytes()}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc.learnHeads(bcast)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		lag, err = cc.SyncLag(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lag == 10 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a lag of 10, got %d", lag)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// Heads below ours do not lower the lag.
+	data, _ = proto.Marshal(&pb.Delta{Priority: 1})
+	low := merkledag.NodeWithData(data)
+	cc.ipfs.Add(ctx, low)
+	bcast, _ = proto.Marshal(&pb.CRDTBroadcast{
+		Heads: []*pb.Head{{Cid: low.Cid().Bytes()}},
+	})
+	cc.learnHeads(bcast)
+	time.Sleep(200 * time.Millisecond)
+	if lag, _ := cc.SyncLag(ctx); lag != 10 {
+		t.Errorf("lag should still be 10, got %d", lag)
+	}
+}
@@ -0,0 +1,136 @@
+package crdt
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	crdt "github.com/ipfs/go-ds-crdt"
+	pb "github.com/ipfs/go-ds-crdt/pb"
+	merkledag "github.com/ipfs/go-merkledag"
+	proto "google.golang.org/protobuf/proto"
+)
+
+// remoteHeadTimeout bounds how long we try to fetch a head broadcast by
+// another peer to learn its height.
+var remoteHeadTimeout = 30 * time.Second
+
+// maxSeenHeads bounds the number of broadcast heads remembered to avoid
+// fetching them again on every rebroadcast.
+const maxSeenHeads = 1000
+
+// headsBroadcaster wraps the broadcaster used by go-ds-crdt to learn about
+// the heads broadcast by other peers.
+type headsBroadcaster struct {
+	crdt.Broadcaster
+	received func([]byte)
+}
+
+// Next returns the next broadcast received, after passing it to received.
+func (hb *headsBroadcaster) Next() ([]byte, error) {
+	data, err := hb.Broadcaster.Next()
+	if err == nil {
+		hb.received(data)
+	}
+	return data, err
+}
+
+// learnHeads queues the heads in a broadcast for the syncLagWorker. Heads
+// are dropped when the worker is busy: they are broadcast again.
+func (css *Consensus) learnHeads(data []byte) {
+	bcast := &pb.CRDTBroadcast{}
+	if err := proto.Unmarshal(data, bcast); err != nil {
+		return // go-ds-crdt logs it
+	}
+	for _, h := range bcast.Heads {
+		c, err := cid.Cast(h.Cid)
+		if err != nil {
+			continue
+		}
+		select {
+		case css.remoteHeadCh <- c:
+		default:
+		}
+	}
+}
+
+// syncLagWorker obtains the height of the heads broadcast by other peers
+// and keeps the highest one. Launched in setup as a goroutine.
+func (css *Consensus) syncLagWorker() {
+	seen := make(map[cid.Cid]struct{})
+	for {
+		var c cid.Cid
+		select {
+		case <-css.ctx.Done():
+			return
+		case c = <-css.remoteHeadCh:
+		}
+		if _, ok := seen[c]; ok {
+			continue
+		}
+
+		height, err := css.headHeight(css.ctx, c)
+		if err != nil {
+			logger.Debugf("cannot obtain the height of broadcast head %s: %s", c, err)
+			continue
+		}
+		if len(seen) >= maxSeenHeads {
+			seen = make(map[cid.Cid]struct{})
+		}
+		seen[c] = struct{}{}
+
+		for {
+			remote := atomic.LoadUint64(&css.remoteHeight)
+			if height <= remote || atomic.CompareAndSwapUint64(&css.remoteHeight, remote, height) {
+				break
+			}
+		}
+	}
+}
+
+// headHeight returns the priority of the delta in the given head, which
+// go-ds-crdt uses as its height in the DAG.
+func (css *Consensus) headHeight(ctx context.Context, c cid.Cid) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, remoteHeadTimeout)
+	defer cancel()
+
+	nd, err := css.ipfs.Get(ctx, c)
+	if err != nil {
+		return 0, err
+	}
+	pnd, ok := nd.(*merkledag.ProtoNode)
+	if !ok {
+		return 0, errors.New("head is not a ProtoNode")
+	}
+	delta := &pb.Delta{}
+	if err := proto.Unmarshal(pnd.Data(), delta); err != nil {
+		return 0, err
+	}
+	return delta.GetPriority(), nil
+}
+
+// SyncLag returns how many deltas this peer is behind the highest head
+// broadcast by the cluster peers, comparing its height with that of the
+// highest head of our DAG. It is 0 when the peer is up to date or has not
+// learned about any remote heads yet.
+func (css *Consensus) SyncLag(ctx context.Context) (uint64, error) {
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-css.ctx.Done():
+		return 0, css.ctx.Err()
+	case <-css.stateReady:
+	}
+
+	_, local, err := css.dagStats(ctx)
+	if err != nil {
+		return 0, err
+	}
+	remote := atomic.LoadUint64(&css.remoteHeight)
+	if remote <= local {
+		return 0, nil
+	}
+	return remote - local, nil
+}
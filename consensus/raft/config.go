@@ -28,6 +28,9 @@ var (
 	DefaultCommitRetries        = 1
 	DefaultNetworkTimeout       = 10 * time.Second
 	DefaultCommitRetryDelay     = 200 * time.Millisecond
+	DefaultPinCommitTimeout     = time.Duration(0)
+	DefaultPeerChangeTimeout    = time.Duration(0)
+	DefaultLogCommitTimeout     = time.Duration(0)
 	DefaultBackupsRotate        = 6
 	DefaultDatastoreNamespace   = "/r" // from "/raft"
 )
@@ -59,6 +62,18 @@ type Config struct {
 	CommitRetries int
 	// How long to wait between retries
 	CommitRetryDelay time.Duration
+	// PinCommitTimeout bounds how long LogPin and LogUnpin take,
+	// including the redirections to the leader and the retries. 0 means
+	// no limit.
+	PinCommitTimeout time.Duration
+	// PeerChangeTimeout bounds how long AddPeer and RmPeer take. 0 means
+	// no limit.
+	PeerChangeTimeout time.Duration
+	// LogCommitTimeout bounds how long LogPin and LogUnpin wait for an
+	// operation to be committed to the Raft log by the leader. 0 means
+	// no limit. Raft may still apply an operation after the timeout, so
+	// it is not retried then.
+	LogCommitTimeout time.Duration
 	// BackupsRotate specifies the maximum number of Raft's DataFolder
 	// copies that we keep as backups (renaming) after cleanup.
 	BackupsRotate int
@@ -100,6 +115,12 @@ type jsonConfig struct {
 	// How long to wait between commit retries
 	CommitRetryDelay string `json:"commit_retry_delay"`
 
+	// How long to wait for pin and unpin operations, peer changes and
+	// single commits to the log before failing them
+	PinCommitTimeout  string `json:"pin_commit_timeout,omitempty"`
+	PeerChangeTimeout string `json:"peer_change_timeout,omitempty"`
+	LogCommitTimeout  string `json:"log_commit_timeout,omitempty"`
+
 	// BackupsRotate specifies the maximum number of Raft's DataFolder
 	// copies that we keep as backups (renaming) after cleanup.
 	BackupsRotate int `json:"backups_rotate"`
@@ -172,6 +193,18 @@ func (cfg *Config) Validate() error {
 		return errors.New("commit_retry_delay is invalid")
 	}
 
+	if cfg.PinCommitTimeout < 0 {
+		return errors.New("pin_commit_timeout is invalid")
+	}
+
+	if cfg.PeerChangeTimeout < 0 {
+		return errors.New("peer_change_timeout is invalid")
+	}
+
+	if cfg.LogCommitTimeout < 0 {
+		return errors.New("log_commit_timeout is invalid")
+	}
+
 	if cfg.BackupsRotate <= 0 {
 		return errors.New("backups_rotate should be larger than 0")
 	}
@@ -208,6 +241,9 @@ func (cfg *Config) applyJSONConfig(jcfg *jsonConfig) error {
 	waitForLeaderTimeout := parseDuration(jcfg.WaitForLeaderTimeout)
 	networkTimeout := parseDuration(jcfg.NetworkTimeout)
 	commitRetryDelay := parseDuration(jcfg.CommitRetryDelay)
+	pinCommitTimeout := parseDuration(jcfg.PinCommitTimeout)
+	peerChangeTimeout := parseDuration(jcfg.PeerChangeTimeout)
+	logCommitTimeout := parseDuration(jcfg.LogCommitTimeout)
 	heartbeatTimeout := parseDuration(jcfg.HeartbeatTimeout)
 	electionTimeout := parseDuration(jcfg.ElectionTimeout)
 	commitTimeout := parseDuration(jcfg.CommitTimeout)
@@ -223,6 +259,9 @@ func (cfg *Config) applyJSONConfig(jcfg *jsonConfig) error {
 	config.SetIfNotDefault(networkTimeout, &cfg.NetworkTimeout)
 	cfg.CommitRetries = jcfg.CommitRetries
 	config.SetIfNotDefault(commitRetryDelay, &cfg.CommitRetryDelay)
+	config.SetIfNotDefault(pinCommitTimeout, &cfg.PinCommitTimeout)
+	config.SetIfNotDefault(peerChangeTimeout, &cfg.PeerChangeTimeout)
+	config.SetIfNotDefault(logCommitTimeout, &cfg.LogCommitTimeout)
 	config.SetIfNotDefault(jcfg.BackupsRotate, &cfg.BackupsRotate)
 
 	// Raft values
@@ -268,6 +307,15 @@ func (cfg *Config) toJSONConfig() *jsonConfig {
 		jcfg.DatastoreNamespace = cfg.DatastoreNamespace
 		// otherwise leave empty so it gets omitted.
 	}
+	if cfg.PinCommitTimeout != DefaultPinCommitTimeout {
+		jcfg.PinCommitTimeout = cfg.PinCommitTimeout.String()
+	}
+	if cfg.PeerChangeTimeout != DefaultPeerChangeTimeout {
+		jcfg.PeerChangeTimeout = cfg.PeerChangeTimeout.String()
+	}
+	if cfg.LogCommitTimeout != DefaultLogCommitTimeout {
+		jcfg.LogCommitTimeout = cfg.LogCommitTimeout.String()
+	}
 	return jcfg
 }
 
@@ -279,6 +327,9 @@ func (cfg *Config) Default() error {
 	cfg.NetworkTimeout = DefaultNetworkTimeout
 	cfg.CommitRetries = DefaultCommitRetries
 	cfg.CommitRetryDelay = DefaultCommitRetryDelay
+	cfg.PinCommitTimeout = DefaultPinCommitTimeout
+	cfg.PeerChangeTimeout = DefaultPeerChangeTimeout
+	cfg.LogCommitTimeout = DefaultLogCommitTimeout
 	cfg.BackupsRotate = DefaultBackupsRotate
 	cfg.DatastoreNamespace = DefaultDatastoreNamespace
 	cfg.RaftConfig = hraft.DefaultConfig()
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"testing"
+	"time"
 
 	hraft "github.com/hashicorp/raft"
 )
@@ -100,6 +101,12 @@ func TestDefault(t *testing.T) {
 		t.Fatal("expected error validating")
 	}
 
+	cfg.Default()
+	cfg.PinCommitTimeout = -time.Second
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
 	cfg.Default()
 	cfg.BackupsRotate = 0
 
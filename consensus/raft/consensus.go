@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strconv"
 	"sync"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 	"github.com/ipfs/ipfs-cluster/state/dsstate"
 
 	ds "github.com/ipfs/go-datastore"
+	namespace "github.com/ipfs/go-datastore/namespace"
 	logging "github.com/ipfs/go-log/v2"
 	consensus "github.com/libp2p/go-libp2p-consensus"
 	host "github.com/libp2p/go-libp2p-core/host"
@@ -82,6 +84,11 @@ func NewConsensus(
 	if err != nil {
 		return nil, err
 	}
+	// the index lives next to the state namespace, so that its keys are
+	// not listed as pins.
+	state.SetMetadataIndex(dsstate.NewMetadataIndex(
+		namespace.Wrap(store, ds.NewKey(cfg.DatastoreNamespace+"-metadata")),
+	))
 	consensus := libp2praft.NewOpLog(state, baseOp)
 	raft, err := newRaftWrapper(host, cfg, consensus.FSM(), staging)
 	if err != nil {
@@ -239,6 +246,36 @@ func (cc *Consensus) Trust(ctx context.Context, pid peer.ID) error { return nil
 // Distrust is a no-op.
 func (cc *Consensus) Distrust(ctx context.Context, pid peer.ID) error { return nil }
 
+// Reconcile is a no-op. The Raft log is authoritative and peers which were
+// partitioned away catch up with the leader on their own once they reach it.
+func (cc *Consensus) Reconcile(ctx context.Context) error { return nil }
+
+// Digest returns the index of the last log entry applied to the state. Peers
+// which applied the same log entries have the same state.
+func (cc *Consensus) Digest(ctx context.Context) (string, error) {
+	cc.shutdownLock.RLock()
+	defer cc.shutdownLock.RUnlock()
+	if cc.shutdown {
+		return "", errors.New("consensus is shutdown")
+	}
+	return strconv.FormatUint(cc.raft.raft.AppliedIndex(), 10), nil
+}
+
+// Compact takes a snapshot of the current state, which lets Raft truncate
+// the log entries it covers. Every peer snapshots its own log, so this does
+// not need to go through the leader.
+func (cc *Consensus) Compact(ctx context.Context) error {
+	_, span := trace.StartSpan(ctx, "consensus/Compact")
+	defer span.End()
+
+	cc.shutdownLock.RLock()
+	defer cc.shutdownLock.RUnlock()
+	if cc.shutdown {
+		return errors.New("consensus is shutdown")
+	}
+	return cc.raft.Snapshot()
+}
+
 func (cc *Consensus) op(ctx context.Context, pin *api.Pin, t LogOpType) *LogOp {
 	return &LogOp{
 		Cid:  pin,
@@ -249,14 +286,17 @@ func (cc *Consensus) op(ctx context.Context, pin *api.Pin, t LogOpType) *LogOp {
 // returns true if the operation was redirected to the leader
 // note that if the leader just dissappeared, the rpc call will
 // fail because we haven't heard that it's gone.
-func (cc *Consensus) redirectToLeader(method string, arg interface{}) (bool, error) {
-	ctx, span := trace.StartSpan(cc.ctx, "consensus/redirectToLeader")
+func (cc *Consensus) redirectToLeader(ctx context.Context, method string, arg interface{}) (bool, error) {
+	ctx, span := trace.StartSpan(ctx, "consensus/redirectToLeader")
 	defer span.End()
 
 	var finalErr error
 
 	// Retry redirects
 	for i := 0; i <= cc.config.CommitRetries; i++ {
+		if ctx.Err() != nil {
+			return true, ctxError(ctx, method)
+		}
 		logger.Debugf("redirect try %d", i)
 		leader, err := cc.Leader(ctx)
 
@@ -273,7 +313,7 @@ func (cc *Consensus) redirectToLeader(method string, arg interface{}) (bool, err
 			// means we timed out waiting for a leader
 			// we don't retry in this case
 			if err != nil {
-				return false, fmt.Errorf("timed out waiting for leader: %s", err)
+				return false, fmt.Errorf("%w: timed out waiting for one: %s", api.ErrNotLeader, err)
 			}
 			leader, err = peer.Decode(pidstr)
 			if err != nil {
@@ -297,7 +337,7 @@ func (cc *Consensus) redirectToLeader(method string, arg interface{}) (bool, err
 		)
 		if finalErr != nil {
 			logger.Errorf("retrying to redirect request to leader: %s", finalErr)
-			time.Sleep(2 * cc.config.RaftConfig.HeartbeatTimeout)
+			sleep(ctx, 2*cc.config.RaftConfig.HeartbeatTimeout)
 			continue
 		}
 		break
@@ -331,10 +371,14 @@ func (cc *Consensus) commit(ctx context.Context, op *LogOp, rpcOp string, redire
 				i, finalErr)
 		}
 
+		if ctx.Err() != nil {
+			return ctxError(ctx, rpcOp)
+		}
+
 		// try to send it to the leader
 		// redirectToLeader has it's own retry loop. If this fails
 		// we're done here.
-		ok, err := cc.redirectToLeader(rpcOp, redirectArg)
+		ok, err := cc.redirectToLeader(ctx, rpcOp, redirectArg)
 		if err != nil || ok {
 			return err
 		}
@@ -342,9 +386,12 @@ func (cc *Consensus) commit(ctx context.Context, op *LogOp, rpcOp string, redire
 		// Being here means we are the LEADER. We can commit.
 
 		// now commit the changes to our state
-		cc.shutdownLock.RLock() // do not shut down while committing
-		_, finalErr = cc.consensus.CommitOp(op)
-		cc.shutdownLock.RUnlock()
+		finalErr = cc.commitOp(ctx, op)
+		if ctx.Err() != nil || errors.Is(finalErr, api.ErrTimeout) {
+			// The operation may still be committed, so it
+			// cannot be retried.
+			return finalErr
+		}
 		if finalErr != nil {
 			goto RETRY
 		}
@@ -358,17 +405,73 @@ func (cc *Consensus) commit(ctx context.Context, op *LogOp, rpcOp string, redire
 		break
 
 	RETRY:
-		time.Sleep(cc.config.CommitRetryDelay)
+		sleep(ctx, cc.config.CommitRetryDelay)
 	}
 	return finalErr
 }
 
+// commitOp commits op to the Raft log, waiting for it for LogCommitTimeout
+// at most. Raft offers no way to abandon an entry which has been submitted,
+// so when the wait is over, the operation may still be applied later.
+func (cc *Consensus) commitOp(ctx context.Context, op *LogOp) error {
+	ctx, cancel := withTimeout(ctx, cc.config.LogCommitTimeout)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		cc.shutdownLock.RLock() // do not shut down while committing
+		defer cc.shutdownLock.RUnlock()
+		_, err := cc.consensus.CommitOp(op)
+		errCh <- err
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		err := ctxError(ctx, "log commit")
+		logger.Error(err)
+		return err
+	}
+}
+
+// withTimeout returns a context with the given timeout, or just a
+// cancellable one when the timeout is 0.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// ctxError returns the error for an operation which was given up because
+// ctx is done. It wraps api.ErrTimeout when its deadline expired.
+func ctxError(ctx context.Context, method string) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %s did not complete in time", api.ErrTimeout, method)
+	}
+	return ctx.Err()
+}
+
+// sleep waits for the given time or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
 // LogPin submits a Cid to the shared state of the cluster. It will forward
 // the operation to the leader if this is not it.
 func (cc *Consensus) LogPin(ctx context.Context, pin *api.Pin) error {
 	ctx, span := trace.StartSpan(ctx, "consensus/LogPin")
 	defer span.End()
 
+	ctx, cancel := withTimeout(ctx, cc.config.PinCommitTimeout)
+	defer cancel()
+
 	op := cc.op(ctx, pin, LogOpPin)
 	err := cc.commit(ctx, op, "LogPin", pin)
 	if err != nil {
@@ -382,6 +485,9 @@ func (cc *Consensus) LogUnpin(ctx context.Context, pin *api.Pin) error {
 	ctx, span := trace.StartSpan(ctx, "consensus/LogUnpin")
 	defer span.End()
 
+	ctx, cancel := withTimeout(ctx, cc.config.PinCommitTimeout)
+	defer cancel()
+
 	op := cc.op(ctx, pin, LogOpUnpin)
 	err := cc.commit(ctx, op, "LogUnpin", pin)
 	if err != nil {
@@ -396,13 +502,19 @@ func (cc *Consensus) AddPeer(ctx context.Context, pid peer.ID) error {
 	ctx, span := trace.StartSpan(ctx, "consensus/AddPeer")
 	defer span.End()
 
+	ctx, cancel := withTimeout(ctx, cc.config.PeerChangeTimeout)
+	defer cancel()
+
 	var finalErr error
 	for i := 0; i <= cc.config.CommitRetries; i++ {
 		logger.Debugf("attempt #%d: AddPeer %s", i, pid.Pretty())
 		if finalErr != nil {
 			logger.Errorf("retrying to add peer. Attempt #%d failed: %s", i, finalErr)
 		}
-		ok, err := cc.redirectToLeader("AddPeer", pid)
+		if ctx.Err() != nil {
+			return ctxError(ctx, "AddPeer")
+		}
+		ok, err := cc.redirectToLeader(ctx, "AddPeer", pid)
 		if err != nil || ok {
 			return err
 		}
@@ -411,8 +523,12 @@ func (cc *Consensus) AddPeer(ctx context.Context, pid peer.ID) error {
 		finalErr = cc.raft.AddPeer(ctx, peer.Encode(pid))
 
 		cc.shutdownLock.RUnlock()
+		if ctx.Err() != nil {
+			// The change may still be applied: do not retry.
+			return finalErr
+		}
 		if finalErr != nil {
-			time.Sleep(cc.config.CommitRetryDelay)
+			sleep(ctx, cc.config.CommitRetryDelay)
 			continue
 		}
 		logger.Infof("peer added to Raft: %s", pid.Pretty())
@@ -427,13 +543,19 @@ func (cc *Consensus) RmPeer(ctx context.Context, pid peer.ID) error {
 	ctx, span := trace.StartSpan(ctx, "consensus/RmPeer")
 	defer span.End()
 
+	ctx, cancel := withTimeout(ctx, cc.config.PeerChangeTimeout)
+	defer cancel()
+
 	var finalErr error
 	for i := 0; i <= cc.config.CommitRetries; i++ {
 		logger.Debugf("attempt #%d: RmPeer %s", i, pid.Pretty())
 		if finalErr != nil {
 			logger.Errorf("retrying to remove peer. Attempt #%d failed: %s", i, finalErr)
 		}
-		ok, err := cc.redirectToLeader("RmPeer", pid)
+		if ctx.Err() != nil {
+			return ctxError(ctx, "RmPeer")
+		}
+		ok, err := cc.redirectToLeader(ctx, "RmPeer", pid)
 		if err != nil || ok {
 			return err
 		}
@@ -441,8 +563,12 @@ func (cc *Consensus) RmPeer(ctx context.Context, pid peer.ID) error {
 		cc.shutdownLock.RLock() // do not shutdown while committing
 		finalErr = cc.raft.RemovePeer(ctx, peer.Encode(pid))
 		cc.shutdownLock.RUnlock()
+		if ctx.Err() != nil {
+			// The change may still be applied: do not retry.
+			return finalErr
+		}
 		if finalErr != nil {
-			time.Sleep(cc.config.CommitRetryDelay)
+			sleep(ctx, cc.config.CommitRetryDelay)
 			continue
 		}
 		logger.Infof("peer removed from Raft: %s", pid.Pretty())
@@ -475,6 +601,56 @@ func (cc *Consensus) State(ctx context.Context) (state.ReadOnly, error) {
 	return state, nil
 }
 
+// GetLinearizable returns the state once it reflects every update committed
+// before the call, unlike State, which may be behind the leader on
+// followers. The leader is asked for its read index, which costs a round of
+// consensus, and the local state is read once it has caught up to it.
+func (cc *Consensus) GetLinearizable(ctx context.Context) (state.ReadOnly, error) {
+	ctx, span := trace.StartSpan(ctx, "consensus/GetLinearizable")
+	defer span.End()
+
+	leader, err := cc.Leader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", api.ErrNotLeader, err)
+	}
+
+	var index uint64
+	if leader == cc.host.ID() {
+		index, err = cc.ReadIndex(ctx)
+	} else {
+		err = cc.rpcClient.CallContext(
+			ctx,
+			leader,
+			"Consensus",
+			"ReadIndex",
+			struct{}{},
+			&index,
+		)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error obtaining the read index from the leader: %w", err)
+	}
+
+	if err := cc.raft.WaitForIndex(ctx, index); err != nil {
+		return nil, err
+	}
+	return cc.State(ctx)
+}
+
+// ReadIndex returns the index which the state of any peer must have applied
+// to reflect every update committed so far. It only works on the leader.
+func (cc *Consensus) ReadIndex(ctx context.Context) (uint64, error) {
+	ctx, span := trace.StartSpan(ctx, "consensus/ReadIndex")
+	defer span.End()
+
+	cc.shutdownLock.RLock()
+	defer cc.shutdownLock.RUnlock()
+	if cc.shutdown {
+		return 0, errors.New("consensus is shutdown")
+	}
+	return cc.raft.ReadIndex(ctx)
+}
+
 // Leader returns the peerID of the Leader of the
 // cluster. It returns an error when there is no leader.
 func (cc *Consensus) Leader(ctx context.Context) (peer.ID, error) {
@@ -2,8 +2,10 @@ package raft
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -13,9 +15,11 @@ import (
 	"github.com/ipfs/ipfs-cluster/test"
 
 	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
 	libp2p "github.com/libp2p/go-libp2p"
 	host "github.com/libp2p/go-libp2p-core/host"
 	peerstore "github.com/libp2p/go-libp2p-core/peerstore"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
 )
 
 func cleanRaft(idn int) {
@@ -40,16 +44,21 @@ func makeTestingHost(t *testing.T) host.Host {
 }
 
 func testingConsensus(t *testing.T, idn int) *Consensus {
+	cfg := &Config{}
+	cfg.Default()
+
+	return testingConsensusWithCfg(t, idn, cfg, inmem.New())
+}
+
+func testingConsensusWithCfg(t *testing.T, idn int, cfg *Config, store ds.Datastore) *Consensus {
 	ctx := context.Background()
 	cleanRaft(idn)
 	h := makeTestingHost(t)
 
-	cfg := &Config{}
-	cfg.Default()
 	cfg.DataFolder = fmt.Sprintf("raftFolderFromTests-%d", idn)
 	cfg.hostShutdown = true
 
-	cc, err := NewConsensus(h, cfg, inmem.New(), false)
+	cc, err := NewConsensus(h, cfg, store, false)
 	if err != nil {
 		t.Fatal("cannot create Consensus:", err)
 	}
@@ -108,6 +117,80 @@ func TestConsensusPin(t *testing.T) {
 	}
 }
 
+// slowDatastore delays every write by the delay set, as a datastore which
+// cannot keep up would, so that applying operations to the state is slow.
+type slowDatastore struct {
+	ds.Datastore
+	delay int64 // time.Duration, updated atomically
+}
+
+func (sds *slowDatastore) Put(ctx context.Context, key ds.Key, value []byte) error {
+	time.Sleep(time.Duration(atomic.LoadInt64(&sds.delay)))
+	return sds.Datastore.Put(ctx, key, value)
+}
+
+func TestConsensusPinCommitTimeout(t *testing.T) {
+	ctx := context.Background()
+	cfg := &Config{}
+	cfg.Default()
+	cfg.PinCommitTimeout = 100 * time.Millisecond
+	store := &slowDatastore{Datastore: inmem.New()}
+	cc := testingConsensusWithCfg(t, 1, cfg, store)
+	defer cleanRaft(1)
+	defer cc.Shutdown(ctx)
+
+	atomic.StoreInt64(&store.delay, int64(500*time.Millisecond))
+	err := cc.LogPin(ctx, testPin(test.Cid1))
+	if !errors.Is(err, api.ErrTimeout) {
+		t.Fatal("expected a timeout error:", err)
+	}
+	atomic.StoreInt64(&store.delay, 0)
+
+	// The operation is not interrupted and makes it to the state.
+	time.Sleep(time.Second)
+	st, err := cc.State(ctx)
+	if err != nil {
+		t.Fatal("error getting state:", err)
+	}
+	if _, err := st.Get(ctx, test.Cid1); err != nil {
+		t.Error("the pin should be in the state:", err)
+	}
+}
+
+func TestConsensusLogCommitTimeout(t *testing.T) {
+	ctx := context.Background()
+	cfg := &Config{}
+	cfg.Default()
+	cfg.LogCommitTimeout = 100 * time.Millisecond
+	cfg.CommitRetries = 3
+	cfg.CommitRetryDelay = time.Second
+	store := &slowDatastore{Datastore: inmem.New()}
+	cc := testingConsensusWithCfg(t, 1, cfg, store)
+	defer cleanRaft(1)
+	defer cc.Shutdown(ctx)
+
+	atomic.StoreInt64(&store.delay, int64(500*time.Millisecond))
+	start := time.Now()
+	err := cc.LogPin(ctx, testPin(test.Cid1))
+	if !errors.Is(err, api.ErrTimeout) {
+		t.Fatal("expected a timeout error:", err)
+	}
+	// The commit may still land, so it is not retried.
+	if time.Since(start) >= cfg.CommitRetryDelay {
+		t.Error("the commit should not have been retried")
+	}
+	atomic.StoreInt64(&store.delay, 0)
+
+	time.Sleep(time.Second)
+	st, err := cc.State(ctx)
+	if err != nil {
+		t.Fatal("error getting state:", err)
+	}
+	if _, err := st.Get(ctx, test.Cid1); err != nil {
+		t.Error("the pin should be in the state:", err)
+	}
+}
+
 func TestConsensusUnpin(t *testing.T) {
 	ctx := context.Background()
 	cc := testingConsensus(t, 1)
@@ -326,3 +409,83 @@ func TestRaftLatestSnapshot(t *testing.T) {
 		t.Fatal("Latest snapshot not read")
 	}
 }
+
+// readIndexRPC provides the Consensus.ReadIndex endpoint between the
+// testing peers.
+type readIndexRPC struct {
+	cc *Consensus
+}
+
+func (rpcapi *readIndexRPC) ReadIndex(ctx context.Context, in struct{}, out *uint64) error {
+	index, err := rpcapi.cc.ReadIndex(ctx)
+	*out = index
+	return err
+}
+
+func TestConsensusGetLinearizable(t *testing.T) {
+	ctx := context.Background()
+	cc := testingConsensus(t, 1)
+	cc2 := testingConsensus(t, 2)
+	defer cleanRaft(1)
+	defer cleanRaft(2)
+	defer cc.Shutdown(ctx)
+	defer cc2.Shutdown(ctx)
+
+	for _, c := range []*Consensus{cc, cc2} {
+		srv := rpc.NewServer(c.host, "/raft-test/rpc")
+		if err := srv.RegisterName("Consensus", &readIndexRPC{cc: c}); err != nil {
+			t.Fatal(err)
+		}
+		c.rpcClient = rpc.NewClientWithServer(c.host, "/raft-test/rpc", srv)
+	}
+
+	cc.host.Peerstore().AddAddrs(cc2.host.ID(), cc2.host.Addrs(), peerstore.PermanentAddrTTL)
+	cc2.host.Peerstore().AddAddrs(cc.host.ID(), cc.host.Addrs(), peerstore.PermanentAddrTTL)
+	if err := cc.AddPeer(ctx, cc2.host.ID()); err != nil {
+		t.Fatal(err)
+	}
+
+	wctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	if err := cc2.raft.WaitForPeer(wctx, cc.host.ID().Pretty(), false); err != nil {
+		t.Fatal(err)
+	}
+	leaderID, err := cc.raft.WaitForLeader(wctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leader, follower := cc, cc2
+	if leaderID == cc2.host.ID().Pretty() {
+		leader, follower = cc2, cc
+	}
+
+	st, err := follower.GetLinearizable(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := st.Has(ctx, test.Cid1); ok {
+		t.Fatal("the pin should not be in the state before it is committed")
+	}
+
+	if err := leader.LogPin(ctx, testPin(test.Cid1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// No waiting: the read has to reflect the commit right away.
+	st, err = follower.GetLinearizable(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := st.Has(ctx, test.Cid1); !ok {
+		t.Error("a linearizable read on the follower should reflect the commit")
+	}
+
+	st, err = leader.GetLinearizable(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := st.Has(ctx, test.Cid1); !ok {
+		t.Error("a linearizable read on the leader should reflect the commit")
+	}
+}
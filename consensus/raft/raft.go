@@ -38,6 +38,9 @@ var RaftLogCacheSize = 512
 var waitForUpdatesShutdownTimeout = 5 * time.Second
 var waitForUpdatesInterval = 400 * time.Millisecond
 
+// How often we check whether a read index has been applied.
+var waitForIndexInterval = 10 * time.Millisecond
+
 // How many times to retry snapshotting when shutting down
 var maxShutdownSnapshotRetries = 5
 
@@ -327,6 +330,35 @@ func (rw *raftWrapper) WaitForUpdates(ctx context.Context) error {
 	}
 }
 
+// ReadIndex returns an index at which the local state reflects every entry
+// committed before the call. The barrier only succeeds on the leader, which
+// verifies its leadership by committing it.
+func (rw *raftWrapper) ReadIndex(ctx context.Context) (uint64, error) {
+	_, span := trace.StartSpan(ctx, "consensus/raft/ReadIndex")
+	defer span.End()
+
+	future := rw.raft.Barrier(rw.config.NetworkTimeout)
+	if err := future.Error(); err != nil {
+		return 0, err
+	}
+	return rw.raft.AppliedIndex(), nil
+}
+
+// WaitForIndex holds until Raft has applied the log up to the given index.
+func (rw *raftWrapper) WaitForIndex(ctx context.Context, index uint64) error {
+	ctx, span := trace.StartSpan(ctx, "consensus/raft/WaitForIndex")
+	defer span.End()
+
+	for rw.raft.AppliedIndex() < index {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(waitForIndexInterval):
+		}
+	}
+	return nil
+}
+
 func (rw *raftWrapper) WaitForPeer(ctx context.Context, pid string, depart bool) error {
 	ctx, span := trace.StartSpan(ctx, "consensus/raft/WaitForPeer")
 	defer span.End()
@@ -456,9 +488,9 @@ func (rw *raftWrapper) AddPeer(ctx context.Context, peer string) error {
 		hraft.ServerID(peer),
 		hraft.ServerAddress(peer),
 		0,
-		0,
-	) // TODO: Extra cfg value?
-	err = future.Error()
+		enqueueTimeout(ctx),
+	)
+	err = waitFuture(ctx, future)
 	if err != nil {
 		logger.Error("raft cannot add peer: ", err)
 	}
@@ -488,9 +520,9 @@ func (rw *raftWrapper) RemovePeer(ctx context.Context, peer string) error {
 	rmFuture := rw.raft.RemoveServer(
 		hraft.ServerID(peer),
 		0,
-		0,
-	) // TODO: Extra cfg value?
-	err = rmFuture.Error()
+		enqueueTimeout(ctx),
+	)
+	err = waitFuture(ctx, rmFuture)
 	if err != nil {
 		logger.Error("raft cannot remove peer: ", err)
 		return err
@@ -499,6 +531,36 @@ func (rw *raftWrapper) RemovePeer(ctx context.Context, peer string) error {
 	return nil
 }
 
+// enqueueTimeout returns how long Raft may wait to start an operation
+// before giving up on it, so that it is not started after the deadline of
+// ctx. 0 means no limit.
+func enqueueTimeout(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	if d := time.Until(deadline); d > 0 {
+		return d
+	}
+	return time.Nanosecond
+}
+
+// waitFuture waits for the operation of the given future until ctx is done.
+// An operation which Raft has started is not abandoned then, and may still
+// be applied.
+func waitFuture(ctx context.Context, f hraft.Future) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- f.Error()
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctxError(ctx, "raft operation")
+	}
+}
+
 // Leader returns Raft's leader. It may be an empty string if
 // there is no leader or it is unknown.
 func (rw *raftWrapper) Leader(ctx context.Context) string {
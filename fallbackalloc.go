@@ -0,0 +1,74 @@
+package ipfscluster
+
+import (
+	"context"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+)
+
+// FallbackAllocator is a PinAllocator made of an ordered chain of
+// allocators. When allocating, Cluster tries them in sequence, using the
+// metrics of each of them, until one provides enough allocations to satisfy
+// the replication factor of the pin. It allows placement policies to
+// degrade gracefully: a strict allocator (i.e. one balancing by
+// "tag:region") can be followed by less strict ones (i.e. one using only
+// "freespace").
+//
+// Used directly as a PinAllocator, it behaves as the first allocator in the
+// chain.
+type FallbackAllocator struct {
+	allocators []PinAllocator
+}
+
+// NewFallbackAllocator returns a FallbackAllocator which tries the primary
+// allocator first and then the given fallbacks, in order. Fallbacks which are
+// FallbackAllocators themselves contribute their whole chain.
+func NewFallbackAllocator(primary PinAllocator, fallbacks ...PinAllocator) *FallbackAllocator {
+	allocators := append([]PinAllocator{}, allocatorChain(primary)...)
+	for _, f := range fallbacks {
+		allocators = append(allocators, allocatorChain(f)...)
+	}
+	return &FallbackAllocator{
+		allocators: allocators,
+	}
+}
+
+// SetClient sets the rpc.Client of all the allocators in the chain.
+func (fa *FallbackAllocator) SetClient(c *rpc.Client) {
+	for _, a := range fa.allocators {
+		a.SetClient(c)
+	}
+}
+
+// Shutdown shuts down all the allocators in the chain.
+func (fa *FallbackAllocator) Shutdown(ctx context.Context) error {
+	for _, a := range fa.allocators {
+		if err := a.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Allocate calls Allocate on the first allocator of the chain.
+func (fa *FallbackAllocator) Allocate(ctx context.Context, c cid.Cid, current, candidates, priority api.MetricsSet) ([]peer.ID, error) {
+	return fa.allocators[0].Allocate(ctx, c, current, candidates, priority)
+}
+
+// Metrics returns the metrics used by the first allocator of the chain.
+func (fa *FallbackAllocator) Metrics() []string {
+	return fa.allocators[0].Metrics()
+}
+
+// allocatorChain returns the allocators to try, in order, when allocating
+// with the given allocator.
+func allocatorChain(alloc PinAllocator) []PinAllocator {
+	if fa, ok := alloc.(*FallbackAllocator); ok {
+		return fa.allocators
+	}
+	return []PinAllocator{alloc}
+}
@@ -3,9 +3,14 @@ package disk
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ipfs/ipfs-cluster/config"
+
+	humanize "github.com/dustin/go-humanize"
 	"github.com/kelseyhightower/envconfig"
 )
 
@@ -25,11 +30,23 @@ type Config struct {
 
 	MetricTTL  time.Duration
 	MetricType MetricType
+	// InodesPath is a path in the filesystem holding the IPFS
+	// repository, whose available inodes are reported by the "inodes"
+	// metric type.
+	InodesPath string
+	// MinFreeSpace and MinFreeSpacePercent set a floor, in bytes or as
+	// a percentage of the repository StorageMax, under which the
+	// "freespace" metric is invalid, so that the peer is not used for
+	// new allocations. Only one of them can be set.
+	MinFreeSpace        uint64
+	MinFreeSpacePercent float64
 }
 
 type jsonConfig struct {
-	MetricTTL  string `json:"metric_ttl"`
-	MetricType string `json:"metric_type"`
+	MetricTTL    string `json:"metric_ttl"`
+	MetricType   string `json:"metric_type"`
+	InodesPath   string `json:"inodes_path,omitempty"`
+	MinFreeSpace string `json:"min_free_space,omitempty"`
 }
 
 // ConfigKey returns a human-friendly identifier for this type of Metric.
@@ -41,6 +58,9 @@ func (cfg *Config) ConfigKey() string {
 func (cfg *Config) Default() error {
 	cfg.MetricTTL = DefaultMetricTTL
 	cfg.MetricType = DefaultMetricType
+	cfg.InodesPath = ""
+	cfg.MinFreeSpace = 0
+	cfg.MinFreeSpacePercent = 0
 	return nil
 }
 
@@ -67,6 +87,18 @@ func (cfg *Config) Validate() error {
 	if cfg.MetricType.String() == "" {
 		return errors.New("disk.metric_type is invalid")
 	}
+
+	if cfg.MetricType == MetricInodes && cfg.InodesPath == "" {
+		return errors.New("disk.inodes_path is required by the inodes metric_type")
+	}
+
+	if cfg.MinFreeSpacePercent < 0 || cfg.MinFreeSpacePercent >= 100 {
+		return errors.New("disk.min_free_space percentage should be between 0 and 100")
+	}
+
+	if cfg.MinFreeSpace > 0 && cfg.MinFreeSpacePercent > 0 {
+		return errors.New("disk.min_free_space cannot be set both in bytes and percent")
+	}
 	return nil
 }
 
@@ -94,9 +126,26 @@ func (cfg *Config) applyJSONConfig(jcfg *jsonConfig) error {
 		cfg.MetricType = MetricRepoSize
 	case "freespace":
 		cfg.MetricType = MetricFreeSpace
+	case "inodes":
+		cfg.MetricType = MetricInodes
 	default:
 		return errors.New("disk.metric_type is invalid")
 	}
+	cfg.InodesPath = jcfg.InodesPath
+
+	cfg.MinFreeSpace = 0
+	cfg.MinFreeSpacePercent = 0
+	if minFree := strings.TrimSpace(jcfg.MinFreeSpace); minFree != "" {
+		var err error
+		if strings.HasSuffix(minFree, "%") {
+			cfg.MinFreeSpacePercent, err = strconv.ParseFloat(strings.TrimSuffix(minFree, "%"), 64)
+		} else {
+			cfg.MinFreeSpace, err = humanize.ParseBytes(minFree)
+		}
+		if err != nil {
+			return fmt.Errorf("error parsing disk.min_free_space: %s", err)
+		}
+	}
 
 	return cfg.Validate()
 }
@@ -111,10 +160,19 @@ func (cfg *Config) ToJSON() (raw []byte, err error) {
 }
 
 func (cfg *Config) toJSONConfig() *jsonConfig {
-	return &jsonConfig{
+	jcfg := &jsonConfig{
 		MetricTTL:  cfg.MetricTTL.String(),
 		MetricType: cfg.MetricType.String(),
+		InodesPath: cfg.InodesPath,
+	}
+
+	switch {
+	case cfg.MinFreeSpacePercent > 0:
+		jcfg.MinFreeSpace = strconv.FormatFloat(cfg.MinFreeSpacePercent, 'f', -1, 64) + "%"
+	case cfg.MinFreeSpace > 0:
+		jcfg.MinFreeSpace = strconv.FormatUint(cfg.MinFreeSpace, 10)
 	}
+	return jcfg
 }
 
 // ToDisplayJSON returns JSON config as a string.
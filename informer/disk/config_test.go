@@ -49,6 +49,46 @@ func TestLoadJSON(t *testing.T) {
 		t.Error("reposize should be a valid type")
 	}
 
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.MetricType = "inodes"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error without inodes_path")
+	}
+	j.InodesPath = "/"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil || cfg.MetricType != MetricInodes {
+		t.Error("inodes should be a valid type")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.MinFreeSpace = "10GB"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil || cfg.MinFreeSpace != 10000000000 {
+		t.Error("expected min_free_space in bytes")
+	}
+	j.MinFreeSpace = "5%"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil || cfg.MinFreeSpacePercent != 5 || cfg.MinFreeSpace != 0 {
+		t.Error("expected min_free_space in percent")
+	}
+	j.MinFreeSpace = "120%"
+	tst, _ = json.Marshal(j)
+	if cfg.LoadJSON(tst) == nil {
+		t.Error("expected error with a percentage over 100")
+	}
+	j.MinFreeSpace = "lots"
+	tst, _ = json.Marshal(j)
+	if cfg.LoadJSON(tst) == nil {
+		t.Error("expected error parsing min_free_space")
+	}
+
 }
 
 func TestToJSON(t *testing.T) {
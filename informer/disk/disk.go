@@ -23,6 +23,9 @@ const (
 	MetricFreeSpace MetricType = iota
 	// MetricRepoSize provides the used space reported by IPFS
 	MetricRepoSize
+	// MetricInodes provides the available inodes in the filesystem
+	// holding the IPFS repository.
+	MetricInodes
 )
 
 // String returns a string representation for MetricType.
@@ -32,6 +35,8 @@ func (t MetricType) String() string {
 		return "freespace"
 	case MetricRepoSize:
 		return "reposize"
+	case MetricInodes:
+		return "inodes"
 	}
 	return ""
 }
@@ -85,6 +90,15 @@ func (disk *Informer) Shutdown(ctx context.Context) error {
 	return nil
 }
 
+// minFreeSpace returns the configured free space floor in bytes for a
+// repository with the given StorageMax.
+func (disk *Informer) minFreeSpace(total uint64) uint64 {
+	if disk.config.MinFreeSpacePercent > 0 {
+		return uint64(float64(total) * disk.config.MinFreeSpacePercent / 100)
+	}
+	return disk.config.MinFreeSpace
+}
+
 // GetMetrics returns the metric obtained by this Informer. It must always
 // return at least one metric.
 func (disk *Informer) GetMetrics(ctx context.Context) []*api.Metric {
@@ -102,9 +116,35 @@ func (disk *Informer) GetMetrics(ctx context.Context) []*api.Metric {
 		}}
 	}
 
-	var repoStat api.IPFSRepoStat
-	var metric uint64
+	metric, capacity, valid := disk.value(ctx, rpcClient)
+	m := &api.Metric{
+		Name:          disk.Name(),
+		Value:         fmt.Sprintf("%d", metric),
+		Valid:         valid,
+		Weight:        int64(metric),
+		Partitionable: false,
+		Capacity:      capacity,
+	}
+
+	m.SetTTL(disk.config.MetricTTL)
+	return []*api.Metric{m}
+}
 
+// value returns the value of the configured metric type, the capacity of
+// the repository for freespace metrics (0 otherwise) and whether the value
+// is valid.
+func (disk *Informer) value(ctx context.Context, rpcClient *rpc.Client) (uint64, uint64, bool) {
+	if disk.config.MetricType == MetricInodes {
+		inodes, err := freeInodes(disk.config.InodesPath)
+		if err != nil {
+			logger.Error(err)
+			return inodes, 0, false
+		}
+		return inodes, 0, true
+	}
+
+	var repoStat api.IPFSRepoStat
+	var metric, capacity uint64
 	valid := true
 
 	err := rpcClient.CallContext(
@@ -123,24 +163,19 @@ func (disk *Informer) GetMetrics(ctx context.Context) []*api.Metric {
 		case MetricFreeSpace:
 			size := repoStat.RepoSize
 			total := repoStat.StorageMax
+			capacity = total
 			if size < total {
 				metric = total - size
 			} else { // Make sure we don't underflow
 				metric = 0
 			}
+			if floor := disk.minFreeSpace(total); metric < floor {
+				logger.Warnf("free space (%d) is under min_free_space (%d): metric invalid", metric, floor)
+				valid = false
+			}
 		case MetricRepoSize:
 			metric = repoStat.RepoSize
 		}
 	}
-
-	m := &api.Metric{
-		Name:          disk.Name(),
-		Value:         fmt.Sprintf("%d", metric),
-		Valid:         valid,
-		Weight:        int64(metric),
-		Partitionable: false,
-	}
-
-	m.SetTTL(disk.config.MetricTTL)
-	return []*api.Metric{m}
+	return metric, capacity, valid
 }
@@ -82,6 +82,9 @@ func TestFreeSpace(t *testing.T) {
 	if m.Value != "98000" {
 		t.Error("bad metric value")
 	}
+	if m.Capacity != 100000 {
+		t.Error("bad capacity")
+	}
 }
 
 func TestRepoSize(t *testing.T) {
@@ -125,3 +128,64 @@ func TestWithErrors(t *testing.T) {
 		t.Errorf("metric should be invalid")
 	}
 }
+
+func TestInodes(t *testing.T) {
+	ctx := context.Background()
+	cfg := &Config{}
+	cfg.Default()
+	cfg.MetricType = MetricInodes
+	cfg.InodesPath = t.TempDir()
+
+	inf, err := NewInformer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inf.Shutdown(ctx)
+	inf.SetClient(test.NewMockRPCClient(t))
+	m := getMetrics(t, inf)
+	if m.Name != "inodes" {
+		t.Error("metric should be named inodes")
+	}
+	if !m.Valid {
+		t.Skip("inode counts not available:", cfg.InodesPath)
+	}
+	if m.Weight <= 0 {
+		t.Error("expected some available inodes")
+	}
+
+	inf.config.InodesPath = "/this/path/does/not/exist"
+	m = getMetrics(t, inf)
+	if m.Valid {
+		t.Error("metric should be invalid")
+	}
+}
+
+func TestMinFreeSpace(t *testing.T) {
+	ctx := context.Background()
+	cfg := &Config{}
+	cfg.Default()
+	// the mock reports 98000 bytes free out of 100000.
+	cfg.MinFreeSpace = 99000
+
+	inf, err := NewInformer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inf.Shutdown(ctx)
+	inf.SetClient(test.NewMockRPCClient(t))
+	m := getMetrics(t, inf)
+	if m.Valid || m.Value != "98000" {
+		t.Error("metric should be invalid under min_free_space")
+	}
+
+	inf.config.MinFreeSpace = 0
+	inf.config.MinFreeSpacePercent = 99
+	if m := getMetrics(t, inf); m.Valid {
+		t.Error("metric should be invalid under min_free_space percent")
+	}
+
+	inf.config.MinFreeSpacePercent = 1
+	if m := getMetrics(t, inf); !m.Valid {
+		t.Error("metric should be valid over min_free_space percent")
+	}
+}
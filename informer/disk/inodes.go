@@ -0,0 +1,24 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package disk
+
+import (
+	"errors"
+	"syscall"
+)
+
+// freeInodes returns the number of inodes available in the filesystem
+// holding the given path.
+func freeInodes(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	// Some filesystems (i.e. btrfs) do not have a fixed number of
+	// inodes and report none.
+	if st.Files == 0 {
+		return 0, errors.New("the filesystem does not report inode counts")
+	}
+	return uint64(st.Ffree), nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package disk
+
+import "errors"
+
+// freeInodes is not supported in this platform.
+func freeInodes(path string) (uint64, error) {
+	return 0, errors.New("inode counts are not supported in this platform")
+}
@@ -12,9 +12,18 @@ import (
 const configKey = "numpin"
 const envConfigKey = "cluster_numpin"
 
+// Modes of the Informer.
+const (
+	// ModeCount counts the pins in IPFS.
+	ModeCount = "count"
+	// ModeSize sums the sizes of the pins allocated to this peer.
+	ModeSize = "size"
+)
+
 // These are the default values for a Config.
 const (
 	DefaultMetricTTL = 10 * time.Second
+	DefaultMode      = ModeCount
 )
 
 // Config allows to initialize an Informer.
@@ -22,10 +31,17 @@ type Config struct {
 	config.Saver
 
 	MetricTTL time.Duration
+	// Mode selects what the informer measures: the number of pins in
+	// IPFS (ModeCount), published as "numpin", or the total size of the
+	// pins allocated to this peer in the shared state (ModeSize),
+	// published as "pinsize". Sizes are only known once the pins'
+	// root blocks are available locally.
+	Mode string
 }
 
 type jsonConfig struct {
 	MetricTTL string `json:"metric_ttl"`
+	Mode      string `json:"mode,omitempty"`
 }
 
 // ConfigKey returns a human-friendly identifier for this
@@ -37,6 +53,7 @@ func (cfg *Config) ConfigKey() string {
 // Default initializes this Config with sensible values.
 func (cfg *Config) Default() error {
 	cfg.MetricTTL = DefaultMetricTTL
+	cfg.Mode = DefaultMode
 	return nil
 }
 
@@ -60,6 +77,12 @@ func (cfg *Config) Validate() error {
 		return errors.New("disk.metric_ttl is invalid")
 	}
 
+	switch cfg.Mode {
+	case ModeCount, ModeSize:
+	default:
+		return errors.New("numpin.mode is invalid")
+	}
+
 	return nil
 }
 
@@ -79,6 +102,7 @@ func (cfg *Config) LoadJSON(raw []byte) error {
 func (cfg *Config) applyJSONConfig(jcfg *jsonConfig) error {
 	t, _ := time.ParseDuration(jcfg.MetricTTL)
 	cfg.MetricTTL = t
+	config.SetIfNotDefault(jcfg.Mode, &cfg.Mode)
 
 	return cfg.Validate()
 }
@@ -93,6 +117,7 @@ func (cfg *Config) ToJSON() ([]byte, error) {
 func (cfg *Config) toJSONConfig() *jsonConfig {
 	return &jsonConfig{
 		MetricTTL: cfg.MetricTTL.String(),
+		Mode:      cfg.Mode,
 	}
 }
 
@@ -29,6 +29,21 @@ func TestLoadJSON(t *testing.T) {
 	if err == nil {
 		t.Error("expected error decoding metric_ttl")
 	}
+
+	json.Unmarshal(cfgJSON, j)
+	j.Mode = ModeSize
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil || cfg.Mode != ModeSize {
+		t.Error("expected mode to be parsed")
+	}
+
+	j.Mode = "bytes"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error decoding mode")
+	}
 }
 
 func TestToJSON(t *testing.T) {
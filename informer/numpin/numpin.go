@@ -1,26 +1,47 @@
 // Package numpin implements an ipfs-cluster informer which determines how many
-// items this peer is pinning and returns it as api.Metric
+// items this peer is pinning, or how big they are, and returns it as
+// api.Metric
 package numpin
 
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/ipfs/ipfs-cluster/api"
 
+	cid "github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log/v2"
 	rpc "github.com/libp2p/go-libp2p-gorpc"
 
 	"go.opencensus.io/trace"
 )
 
+var logger = logging.Logger("numpin")
+
 // MetricName specifies the name of our metric
 var MetricName = "numpin"
 
+// SizeMetricName is the name of the metric produced in ModeSize.
+var SizeMetricName = "pinsize"
+
 // Informer is a simple object to implement the ipfscluster.Informer
 // and Component interfaces
 type Informer struct {
 	config    *Config
 	rpcClient *rpc.Client
+
+	// DAG sizes by cid, kept across calls in ModeSize, and the allocated
+	// cids whose size is not known yet. These are looked up in the
+	// background, one by one, when lookupCh receives a signal.
+	sizesMu  sync.Mutex
+	sizes    map[cid.Cid]uint64
+	missing  []cid.Cid
+	lookupCh chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
 // NewInformer returns an initialized Informer.
@@ -30,8 +51,13 @@ func NewInformer(cfg *Config) (*Informer, error) {
 		return nil, err
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Informer{
-		config: cfg,
+		config:   cfg,
+		sizes:    make(map[cid.Cid]uint64),
+		lookupCh: make(chan struct{}, 1),
+		ctx:      ctx,
+		cancel:   cancel,
 	}, nil
 }
 
@@ -39,6 +65,10 @@ func NewInformer(cfg *Config) (*Informer, error) {
 // contacting other components in the cluster.
 func (npi *Informer) SetClient(c *rpc.Client) {
 	npi.rpcClient = c
+	if npi.config.Mode == ModeSize {
+		npi.wg.Add(1)
+		go npi.lookupSizes(c)
+	}
 }
 
 // Shutdown is called on cluster shutdown. We just invalidate
@@ -47,12 +77,17 @@ func (npi *Informer) Shutdown(ctx context.Context) error {
 	_, span := trace.StartSpan(ctx, "informer/numpin/Shutdown")
 	defer span.End()
 
+	npi.cancel()
+	npi.wg.Wait()
 	npi.rpcClient = nil
 	return nil
 }
 
 // Name returns the name of this informer
 func (npi *Informer) Name() string {
+	if npi.config.Mode == ModeSize {
+		return SizeMetricName
+	}
 	return MetricName
 }
 
@@ -69,6 +104,18 @@ func (npi *Informer) GetMetrics(ctx context.Context) []*api.Metric {
 		}}
 	}
 
+	var m *api.Metric
+	if npi.config.Mode == ModeSize {
+		m = npi.sizeMetric(ctx)
+	} else {
+		m = npi.numpinMetric(ctx)
+	}
+	m.SetTTL(npi.config.MetricTTL)
+	return []*api.Metric{m}
+}
+
+// numpinMetric returns the number of items pinned in IPFS.
+func (npi *Informer) numpinMetric(ctx context.Context) *api.Metric {
 	pinMap := make(map[string]api.IPFSPinStatus)
 
 	// make use of the RPC API to obtain information
@@ -84,13 +131,113 @@ func (npi *Informer) GetMetrics(ctx context.Context) []*api.Metric {
 
 	valid := err == nil
 
-	m := &api.Metric{
+	return &api.Metric{
 		Name:          MetricName,
 		Value:         fmt.Sprintf("%d", len(pinMap)),
 		Valid:         valid,
 		Partitionable: false,
 	}
+}
 
-	m.SetTTL(npi.config.MetricTTL)
-	return []*api.Metric{m}
+// sizeMetric returns the total size of the pins allocated to this peer in
+// the shared state. Lower totals weigh more, so that allocators prefer the
+// peers that hold fewer bytes. Sizes never change for a cid, so they are
+// only looked up once, by lookupSizes. Pins whose size is not known yet
+// are left out.
+func (npi *Informer) sizeMetric(ctx context.Context) *api.Metric {
+	var pins []*api.Pin
+	err := npi.rpcClient.CallContext(
+		ctx,
+		"",
+		"Cluster",
+		"Pins",
+		struct{}{},
+		&pins,
+	)
+	valid := err == nil
+	if err != nil {
+		logger.Error(err)
+	}
+
+	self := npi.rpcClient.ID()
+
+	npi.sizesMu.Lock()
+	defer npi.sizesMu.Unlock()
+
+	// Sizes of the pins no longer allocated to us are dropped.
+	sizes := make(map[cid.Cid]uint64, len(pins))
+	var total uint64
+	var missing []cid.Cid
+	for _, pin := range pins {
+		if pin.Type == api.MetaType || pin.Type == api.ClusterDAGType || pin.IsRemotePin(self) {
+			continue
+		}
+		size, ok := npi.sizes[pin.Cid]
+		if !ok {
+			missing = append(missing, pin.Cid)
+			continue
+		}
+		sizes[pin.Cid] = size
+		total += size
+	}
+	npi.sizes = sizes
+	npi.missing = missing
+	if len(missing) > 0 {
+		logger.Debugf("the size of %d allocated pins is not known yet", len(missing))
+		select {
+		case npi.lookupCh <- struct{}{}:
+		default:
+		}
+	}
+
+	return &api.Metric{
+		Name:          SizeMetricName,
+		Value:         fmt.Sprintf("%d", total),
+		Valid:         valid,
+		Weight:        -int64(total),
+		Partitionable: false,
+	}
+}
+
+// lookupSizes obtains the sizes of the pins that sizeMetric could not
+// account for, until the informer is shut down. The lookups are offline:
+// pins whose blocks are not available locally are tried again after the
+// next metric.
+func (npi *Informer) lookupSizes(rpcClient *rpc.Client) {
+	defer npi.wg.Done()
+
+	for {
+		select {
+		case <-npi.ctx.Done():
+			return
+		case <-npi.lookupCh:
+		}
+
+		npi.sizesMu.Lock()
+		missing := npi.missing
+		npi.missing = nil
+		npi.sizesMu.Unlock()
+
+		for _, c := range missing {
+			var size uint64
+			err := rpcClient.CallContext(
+				npi.ctx,
+				"",
+				"IPFSConnector",
+				"DAGSize",
+				c,
+				&size,
+			)
+			if npi.ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				logger.Debugf("cannot get the size of %s: %s", c, err)
+				continue
+			}
+			npi.sizesMu.Lock()
+			npi.sizes[c] = size
+			npi.sizesMu.Unlock()
+		}
+	}
 }
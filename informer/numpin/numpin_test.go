@@ -2,10 +2,17 @@ package numpin
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
 
+	cid "github.com/ipfs/go-cid"
+	libp2p "github.com/libp2p/go-libp2p"
+	host "github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
 	rpc "github.com/libp2p/go-libp2p-gorpc"
 )
 
@@ -60,3 +67,107 @@ func Test(t *testing.T) {
 		t.Error("bad metric value")
 	}
 }
+
+// mockCluster serves pins allocated to self, which is set to the peer ID of
+// the host of the rpc client.
+type mockCluster struct {
+	self peer.ID
+}
+
+var dagSizes = map[cid.Cid]uint64{
+	test.Cid1: 100,
+	test.Cid2: 2000,
+	test.Cid3: 30000,
+}
+
+func (mock *mockService) DAGSize(ctx context.Context, in cid.Cid, out *uint64) error {
+	size, ok := dagSizes[in]
+	if !ok {
+		return errors.New("size unknown")
+	}
+	*out = size
+	return nil
+}
+
+func (mock *mockCluster) Pins(ctx context.Context, in struct{}, out *[]*api.Pin) error {
+	everywhere := api.PinOptions{ReplicationFactorMin: -1, ReplicationFactorMax: -1}
+	allocated := api.PinOptions{ReplicationFactorMin: 1, ReplicationFactorMax: 1}
+
+	pinTo := func(c cid.Cid, opts api.PinOptions, p peer.ID) *api.Pin {
+		pin := api.PinWithOpts(c, opts)
+		if p != "" {
+			pin.Allocations = []peer.ID{p}
+		}
+		return pin
+	}
+	*out = []*api.Pin{
+		pinTo(test.Cid1, allocated, mock.self),
+		pinTo(test.Cid2, everywhere, ""),
+		pinTo(test.Cid3, allocated, test.PeerID1),
+		pinTo(test.Cid4, allocated, mock.self), // unknown size
+	}
+	return nil
+}
+
+func mockRPCClientWithHost(t *testing.T, h host.Host) *rpc.Client {
+	s := rpc.NewServer(h, "mock")
+	c := rpc.NewClientWithServer(h, "mock", s)
+	err := s.RegisterName("IPFSConnector", &mockService{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.RegisterName("Cluster", &mockCluster{self: h.ID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestSizeMode(t *testing.T) {
+	ctx := context.Background()
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	cfg := &Config{}
+	cfg.Default()
+	cfg.Mode = ModeSize
+	inf, err := NewInformer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inf.Name() != SizeMetricName {
+		t.Error("unexpected informer name: ", inf.Name())
+	}
+	inf.SetClient(mockRPCClientWithHost(t, h))
+	defer inf.Shutdown(ctx)
+
+	// Sizes are looked up in the background after the first metric.
+	var m *api.Metric
+	for i := 0; i < 50; i++ {
+		metrics := inf.GetMetrics(ctx)
+		if len(metrics) != 1 {
+			t.Fatal("expected 1 metric")
+		}
+		m = metrics[0]
+		if !m.Valid || m.Name != SizeMetricName {
+			t.Fatal("expected a valid pinsize metric: ", m)
+		}
+		if m.Value == "2100" {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	// Cid1 is allocated to us and Cid2 everywhere. Cid3 is allocated
+	// elsewhere and the size of Cid4 is unknown.
+	if m.Value != "2100" || m.GetWeight() != -2100 {
+		t.Errorf("unexpected metric value %s and weight %d", m.Value, m.GetWeight())
+	}
+	inf.sizesMu.Lock()
+	defer inf.sizesMu.Unlock()
+	if len(inf.sizes) != 2 {
+		t.Error("expected the known sizes to be cached: ", inf.sizes)
+	}
+}
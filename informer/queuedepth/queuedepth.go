@@ -0,0 +1,98 @@
+// Package queuedepth implements an ipfs-cluster informer which reports how
+// many pin and unpin operations are pending in the pin tracker of this peer,
+// so that allocators can avoid the peers which are busy.
+package queuedepth
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	logging "github.com/ipfs/go-log/v2"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+
+	"go.opencensus.io/trace"
+)
+
+var logger = logging.Logger("queuedepth")
+
+// MetricName specifies the name of our metric
+var MetricName = "queuedepth"
+
+// Informer is a simple object to implement the ipfscluster.Informer
+// and Component interfaces
+type Informer struct {
+	config    *Config
+	rpcClient *rpc.Client
+}
+
+// NewInformer returns an initialized Informer.
+func NewInformer(cfg *Config) (*Informer, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Informer{
+		config: cfg,
+	}, nil
+}
+
+// SetClient provides us with an rpc.Client which allows
+// contacting other components in the cluster.
+func (qdi *Informer) SetClient(c *rpc.Client) {
+	qdi.rpcClient = c
+}
+
+// Shutdown is called on cluster shutdown. We just invalidate
+// any metrics from this point.
+func (qdi *Informer) Shutdown(ctx context.Context) error {
+	_, span := trace.StartSpan(ctx, "informer/queuedepth/Shutdown")
+	defer span.End()
+
+	qdi.rpcClient = nil
+	return nil
+}
+
+// Name returns the name of this informer
+func (qdi *Informer) Name() string {
+	return MetricName
+}
+
+// GetMetrics asks the PinTracker for the number of queued or ongoing
+// operations. Deeper queues weigh less, so that allocators prefer the peers
+// with less pending work. It must always return at least one metric.
+func (qdi *Informer) GetMetrics(ctx context.Context) []*api.Metric {
+	ctx, span := trace.StartSpan(ctx, "informer/queuedepth/GetMetric")
+	defer span.End()
+
+	if qdi.rpcClient == nil {
+		return []*api.Metric{{
+			Valid: false,
+		}}
+	}
+
+	var depth int
+	err := qdi.rpcClient.CallContext(
+		ctx,
+		"",
+		"PinTracker",
+		"QueueDepth",
+		struct{}{},
+		&depth,
+	)
+	if err != nil {
+		logger.Error(err)
+	}
+
+	m := &api.Metric{
+		Name:          MetricName,
+		Value:         strconv.Itoa(depth),
+		Valid:         err == nil,
+		Weight:        -int64(depth),
+		Partitionable: false,
+	}
+	m.SetTTL(qdi.config.MetricTTL)
+	return []*api.Metric{m}
+}
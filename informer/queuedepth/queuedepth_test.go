@@ -0,0 +1,39 @@
+package queuedepth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+func Test(t *testing.T) {
+	ctx := context.Background()
+	cfg := &Config{}
+	cfg.Default()
+	inf, err := NewInformer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := inf.GetMetrics(ctx)
+	if len(metrics) != 1 {
+		t.Fatal("expected 1 metric")
+	}
+	if metrics[0].Valid {
+		t.Error("metric should be invalid")
+	}
+
+	// The mock tracker has 3 pending operations.
+	inf.SetClient(test.NewMockRPCClient(t))
+	metrics = inf.GetMetrics(ctx)
+	if len(metrics) != 1 {
+		t.Fatal("expected 1 metric")
+	}
+	m := metrics[0]
+	if !m.Valid || m.Name != MetricName {
+		t.Fatal("expected a valid queuedepth metric: ", m)
+	}
+	if m.Value != "3" || m.GetWeight() != -3 {
+		t.Errorf("unexpected metric value %s and weight %d", m.Value, m.GetWeight())
+	}
+}
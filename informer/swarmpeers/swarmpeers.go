@@ -0,0 +1,100 @@
+// Package swarmpeers implements an ipfs-cluster informer which reports how
+// many peers the IPFS daemon of this peer is connected to. Poorly connected
+// daemons tend to fetch content slowly, so allocators can use it to prefer
+// the peers with better connectivity.
+package swarmpeers
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	logging "github.com/ipfs/go-log/v2"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+
+	"go.opencensus.io/trace"
+)
+
+var logger = logging.Logger("swarmpeers")
+
+// MetricName specifies the name of our metric
+var MetricName = "swarmpeers"
+
+// Informer is a simple object to implement the ipfscluster.Informer
+// and Component interfaces
+type Informer struct {
+	config    *Config
+	rpcClient *rpc.Client
+}
+
+// NewInformer returns an initialized Informer.
+func NewInformer(cfg *Config) (*Informer, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Informer{
+		config: cfg,
+	}, nil
+}
+
+// SetClient provides us with an rpc.Client which allows
+// contacting other components in the cluster.
+func (spi *Informer) SetClient(c *rpc.Client) {
+	spi.rpcClient = c
+}
+
+// Shutdown is called on cluster shutdown. We just invalidate
+// any metrics from this point.
+func (spi *Informer) Shutdown(ctx context.Context) error {
+	_, span := trace.StartSpan(ctx, "informer/swarmpeers/Shutdown")
+	defer span.End()
+
+	spi.rpcClient = nil
+	return nil
+}
+
+// Name returns the name of this informer
+func (spi *Informer) Name() string {
+	return MetricName
+}
+
+// GetMetrics asks the IPFS connector for the swarm peers of the daemon.
+// Better connected peers weigh more. The metric is invalid when the daemon
+// cannot be contacted. It must always return at least one metric.
+func (spi *Informer) GetMetrics(ctx context.Context) []*api.Metric {
+	ctx, span := trace.StartSpan(ctx, "informer/swarmpeers/GetMetric")
+	defer span.End()
+
+	if spi.rpcClient == nil {
+		return []*api.Metric{{
+			Valid: false,
+		}}
+	}
+
+	var swarmPeers []peer.ID
+	err := spi.rpcClient.CallContext(
+		ctx,
+		"",
+		"IPFSConnector",
+		"SwarmPeers",
+		struct{}{},
+		&swarmPeers,
+	)
+	if err != nil {
+		logger.Error(err)
+	}
+
+	m := &api.Metric{
+		Name:          MetricName,
+		Value:         strconv.Itoa(len(swarmPeers)),
+		Valid:         err == nil,
+		Weight:        int64(len(swarmPeers)),
+		Partitionable: false,
+	}
+	m.SetTTL(spi.config.MetricTTL)
+	return []*api.Metric{m}
+}
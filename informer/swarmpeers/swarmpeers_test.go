@@ -0,0 +1,73 @@
+package swarmpeers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/test"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+)
+
+type mockService struct {
+	fail bool
+}
+
+func mockRPCClient(t *testing.T, fail bool) *rpc.Client {
+	s := rpc.NewServer(nil, "mock")
+	c := rpc.NewClientWithServer(nil, "mock", s)
+	err := s.RegisterName("IPFSConnector", &mockService{fail: fail})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (mock *mockService) SwarmPeers(ctx context.Context, in struct{}, out *[]peer.ID) error {
+	if mock.fail {
+		return errors.New("ipfs is down")
+	}
+	*out = []peer.ID{test.PeerID1, test.PeerID2, test.PeerID3}
+	return nil
+}
+
+func Test(t *testing.T) {
+	ctx := context.Background()
+	cfg := &Config{}
+	cfg.Default()
+	inf, err := NewInformer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := inf.GetMetrics(ctx)
+	if len(metrics) != 1 {
+		t.Fatal("expected 1 metric")
+	}
+	if metrics[0].Valid {
+		t.Error("metric should be invalid")
+	}
+
+	inf.SetClient(mockRPCClient(t, false))
+	metrics = inf.GetMetrics(ctx)
+	if len(metrics) != 1 {
+		t.Fatal("expected 1 metric")
+	}
+	m := metrics[0]
+	if !m.Valid || m.Name != MetricName {
+		t.Fatal("expected a valid swarmpeers metric: ", m)
+	}
+	if m.Value != "3" || m.GetWeight() != 3 {
+		t.Errorf("unexpected metric value %s and weight %d", m.Value, m.GetWeight())
+	}
+
+	inf.SetClient(mockRPCClient(t, true))
+	metrics = inf.GetMetrics(ctx)
+	if len(metrics) != 1 {
+		t.Fatal("expected 1 metric")
+	}
+	if metrics[0].Valid {
+		t.Error("metric should be invalid when the connector fails")
+	}
+}
@@ -0,0 +1,105 @@
+// Package synclag implements an ipfs-cluster informer which reports how many
+// deltas the CRDT consensus of this peer is behind the highest head
+// broadcast by the other peers, so that operators can tell how far behind
+// followers are.
+package synclag
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	logging "github.com/ipfs/go-log/v2"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+
+	"go.opencensus.io/trace"
+)
+
+var logger = logging.Logger("synclag")
+
+// MetricName specifies the name of our metric
+var MetricName = "synclag"
+
+// Informer is a simple object to implement the ipfscluster.Informer
+// and Component interfaces
+type Informer struct {
+	config    *Config
+	rpcClient *rpc.Client
+}
+
+// NewInformer returns an initialized Informer.
+func NewInformer(cfg *Config) (*Informer, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Informer{
+		config: cfg,
+	}, nil
+}
+
+// SetClient provides us with an rpc.Client which allows
+// contacting other components in the cluster.
+func (sli *Informer) SetClient(c *rpc.Client) {
+	sli.rpcClient = c
+}
+
+// Shutdown is called on cluster shutdown. We just invalidate
+// any metrics from this point.
+func (sli *Informer) Shutdown(ctx context.Context) error {
+	_, span := trace.StartSpan(ctx, "informer/synclag/Shutdown")
+	defer span.End()
+
+	sli.rpcClient = nil
+	return nil
+}
+
+// Name returns the name of this informer
+func (sli *Informer) Name() string {
+	return MetricName
+}
+
+// GetMetrics asks the consensus component for the sync lag of this peer.
+// The metric is invalid when the lag is over MaxLag. Lagging peers weigh
+// less. It must always return at least one metric.
+func (sli *Informer) GetMetrics(ctx context.Context) []*api.Metric {
+	ctx, span := trace.StartSpan(ctx, "informer/synclag/GetMetric")
+	defer span.End()
+
+	if sli.rpcClient == nil {
+		return []*api.Metric{{
+			Valid: false,
+		}}
+	}
+
+	var lag uint64
+	err := sli.rpcClient.CallContext(
+		ctx,
+		"",
+		"Consensus",
+		"SyncLag",
+		struct{}{},
+		&lag,
+	)
+	if err != nil {
+		logger.Error(err)
+	}
+
+	valid := err == nil
+	if max := sli.config.MaxLag; valid && max > 0 && lag > max {
+		logger.Warnf("sync lag (%d) is over max_lag (%d): metric invalid", lag, max)
+		valid = false
+	}
+
+	m := &api.Metric{
+		Name:          MetricName,
+		Value:         strconv.FormatUint(lag, 10),
+		Valid:         valid,
+		Weight:        -int64(lag),
+		Partitionable: false,
+	}
+	m.SetTTL(sli.config.MetricTTL)
+	return []*api.Metric{m}
+}
@@ -0,0 +1,63 @@
+package synclag
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+func Test(t *testing.T) {
+	ctx := context.Background()
+	cfg := &Config{}
+	cfg.Default()
+	inf, err := NewInformer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := inf.GetMetrics(ctx)
+	if len(metrics) != 1 {
+		t.Fatal("expected 1 metric")
+	}
+	if metrics[0].Valid {
+		t.Error("metric should be invalid")
+	}
+
+	// The mock consensus is 5 deltas behind.
+	inf.SetClient(test.NewMockRPCClient(t))
+	metrics = inf.GetMetrics(ctx)
+	if len(metrics) != 1 {
+		t.Fatal("expected 1 metric")
+	}
+	m := metrics[0]
+	if !m.Valid || m.Name != MetricName {
+		t.Fatal("expected a valid synclag metric: ", m)
+	}
+	if m.Value != "5" || m.GetWeight() != -5 {
+		t.Errorf("unexpected metric value %s and weight %d", m.Value, m.GetWeight())
+	}
+}
+
+func TestMaxLag(t *testing.T) {
+	ctx := context.Background()
+	cfg := &Config{}
+	cfg.Default()
+	cfg.MaxLag = 4
+	inf, err := NewInformer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inf.SetClient(test.NewMockRPCClient(t))
+	m := inf.GetMetrics(ctx)[0]
+	if m.Valid {
+		t.Error("metric should be invalid when over max_lag")
+	}
+	if m.Value != "5" {
+		t.Error("the lag should still be reported: ", m.Value)
+	}
+
+	inf.config.MaxLag = 5
+	if m := inf.GetMetrics(ctx)[0]; !m.Valid {
+		t.Error("metric should be valid under max_lag")
+	}
+}
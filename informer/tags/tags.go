@@ -63,23 +63,36 @@ func (tags *Informer) Shutdown(ctx context.Context) error {
 }
 
 // GetMetrics returns one metric for each tag defined in the configuration.
-// The metric name is set as "tags:<tag_name>". When no tags are defined,
-// a single invalid metric is returned.
+// The metric name is set as "tags:<tag_name>". All the metrics carry all
+// the tags in their Tags. When no tags are defined, a single invalid metric
+// is returned.
 func (tags *Informer) GetMetrics(ctx context.Context) []*api.Metric {
 	// Note we could potentially extend the tag:value syntax to include manual weights
 	// ie: { "region": "us:100", ... }
 	// This would potentially allow to always give priority to peers of a certain group
 
+	metrics := tags.metrics()
+	for _, m := range metrics {
+		m.SetTTL(tags.config.MetricTTL)
+	}
+	return metrics
+}
+
+// metrics builds the metrics for the configured tags.
+func (tags *Informer) metrics() []*api.Metric {
 	if len(tags.config.Tags) == 0 {
 		logger.Debug("no tags defined in tags informer")
-		m := &api.Metric{
+		return []*api.Metric{{
 			Name:          "tag:none",
 			Value:         "",
 			Valid:         false,
 			Partitionable: true,
-		}
-		m.SetTTL(tags.config.MetricTTL)
-		return []*api.Metric{m}
+		}}
+	}
+
+	allTags := make(map[string]string, len(tags.config.Tags))
+	for n, v := range tags.config.Tags {
+		allTags[n] = v
 	}
 
 	metrics := make([]*api.Metric, 0, len(tags.config.Tags))
@@ -89,8 +102,8 @@ func (tags *Informer) GetMetrics(ctx context.Context) []*api.Metric {
 			Value:         v,
 			Valid:         true,
 			Partitionable: true,
+			Tags:          allTags,
 		}
-		m.SetTTL(tags.config.MetricTTL)
 		metrics = append(metrics, m)
 	}
 
@@ -24,4 +24,9 @@ func Test(t *testing.T) {
 	if len(m) != 2 {
 		t.Error("there should be 2 metrics")
 	}
+	for _, mt := range m {
+		if len(mt.Tags) != 2 || mt.Tags["x"] != "y" {
+			t.Errorf("metric should carry all tags: %+v", mt.Tags)
+		}
+	}
 }
@@ -0,0 +1,88 @@
+package ipfscluster
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// informerIntervalTolerance is the relative change in a numeric metric
+// value below which the value is considered unchanged.
+var informerIntervalTolerance = 0.01
+
+// informerInterval chooses how often the metrics of an informer are
+// published. The interval halves every time a metric value changes and
+// doubles every time all of them stay the same, within [min, max].
+type informerInterval struct {
+	min     time.Duration
+	max     time.Duration
+	current time.Duration
+	last    map[string]string
+}
+
+func newInformerInterval(min, max time.Duration) *informerInterval {
+	return &informerInterval{
+		min:     min,
+		max:     max,
+		current: min,
+	}
+}
+
+// next records the values of the given metrics and returns the interval
+// until they should be published again. The first metrics are published at
+// the minimum interval.
+func (ival *informerInterval) next(metrics []*api.Metric) time.Duration {
+	values := make(map[string]string, len(metrics))
+	for _, m := range metrics {
+		values[m.Name] = m.Value
+	}
+
+	// values are compared with the last ones that changed so that slow
+	// drifts are noticed eventually.
+	switch {
+	case ival.last == nil:
+		ival.last = values
+	case valuesChanged(ival.last, values):
+		ival.current /= 2
+		ival.last = values
+	default:
+		ival.current *= 2
+	}
+
+	if ival.current < ival.min {
+		ival.current = ival.min
+	}
+	if ival.current > ival.max {
+		ival.current = ival.max
+	}
+	return ival.current
+}
+
+func valuesChanged(last, values map[string]string) bool {
+	if len(last) != len(values) {
+		return true
+	}
+	for name, v := range values {
+		prev, ok := last[name]
+		if !ok {
+			return true
+		}
+		if v == prev {
+			continue
+		}
+
+		// numeric values only change when they move more than the
+		// tolerance.
+		fv, err1 := strconv.ParseFloat(v, 64)
+		fprev, err2 := strconv.ParseFloat(prev, 64)
+		if err1 != nil || err2 != nil {
+			return true
+		}
+		if math.Abs(fv-fprev) > informerIntervalTolerance*math.Max(math.Abs(fprev), 1) {
+			return true
+		}
+	}
+	return false
+}
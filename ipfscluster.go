@@ -8,6 +8,7 @@ package ipfscluster
 
 import (
 	"context"
+	"time"
 
 	"github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/state"
@@ -43,8 +44,14 @@ type Consensus interface {
 	AddPeer(context.Context, peer.ID) error
 	RmPeer(context.Context, peer.ID) error
 	State(context.Context) (state.ReadOnly, error)
+	// GetLinearizable is like State, but the returned state reflects
+	// every update committed before the call, at the cost of asking
+	// the consensus leader, when there is one.
+	GetLinearizable(context.Context) (state.ReadOnly, error)
 	// Provide a node which is responsible to perform
 	// specific tasks which must only run in 1 cluster peer.
+	// Leaderless components return an error wrapping
+	// api.ErrLeaderless.
 	Leader(context.Context) (peer.ID, error)
 	// Only returns when the consensus state has all log
 	// updates applied to it.
@@ -62,6 +69,16 @@ type Consensus interface {
 	Trust(context.Context, peer.ID) error
 	// Distrust removes a peer from the "trusted" set.
 	Distrust(context.Context, peer.ID) error
+	// Reconcile triggers the mechanisms to converge the shared state
+	// with that of other peers, when the consensus has any.
+	Reconcile(context.Context) error
+	// Digest returns a short fingerprint of the shared state as seen
+	// by this peer, which peers compare to tell whether they agree on
+	// it. It should be cheap to obtain.
+	Digest(context.Context) (string, error)
+	// Compact removes the consensus data which is no longer needed to
+	// reproduce the shared state. It is safe to call on a running peer.
+	Compact(context.Context) error
 }
 
 // API is a component which offers an API for Cluster. This is
@@ -76,7 +93,7 @@ type IPFSConnector interface {
 	Component
 	ID(context.Context) (*api.IPFSID, error)
 	Pin(context.Context, *api.Pin) error
-	Unpin(context.Context, cid.Cid) error
+	Unpin(context.Context, *api.Pin) error
 	PinLsCid(context.Context, *api.Pin) (api.IPFSPinStatus, error)
 	PinLs(ctx context.Context, typeFilter string) (map[string]api.IPFSPinStatus, error)
 	// ConnectSwarms make sure this peer's IPFS daemon is connected to
@@ -94,10 +111,33 @@ type IPFSConnector interface {
 	RepoGC(context.Context) (*api.RepoGC, error)
 	// Resolve returns a cid given a path.
 	Resolve(context.Context, string) (cid.Cid, error)
+	// ResolveMFS returns the cid of the given path in the MFS (files
+	// API) of the IPFS daemon.
+	ResolveMFS(context.Context, string) (cid.Cid, error)
 	// BlockPut directly adds a block of data to the IPFS repo.
 	BlockPut(context.Context, *api.NodeWithMeta) error
 	// BlockGet retrieves the raw data of an IPFS block.
 	BlockGet(context.Context, cid.Cid) ([]byte, error)
+	// BlockHas returns whether the IPFS daemon has the given block
+	// locally, without fetching it from the network.
+	BlockHas(context.Context, cid.Cid) (bool, error)
+	// SupportsCodec returns whether the IPFS daemon supports the given
+	// IPLD codec.
+	SupportsCodec(context.Context, uint64) (bool, error)
+	// DAGSize returns the cumulative size of the DAG under the given
+	// CID, without fetching anything.
+	DAGSize(context.Context, cid.Cid) (uint64, error)
+	// MissingRefs walks the DAG under the given CID without fetching
+	// anything and returns the first block found which the IPFS daemon
+	// does not have, if any. An empty result means the DAG is complete.
+	MissingRefs(context.Context, cid.Cid) ([]cid.Cid, error)
+	// Provide announces to the DHT that the IPFS daemon provides the
+	// given CID and the blocks under it.
+	Provide(context.Context, cid.Cid) error
+	// FindProviders asks the content routing of the IPFS daemon for up
+	// to the given number of peers providing the given CID, not counting
+	// the daemon itself.
+	FindProviders(context.Context, cid.Cid, int) ([]peer.ID, error)
 }
 
 // Peered represents a component which needs to be aware of the peers
@@ -130,6 +170,46 @@ type PinTracker interface {
 	Recover(context.Context, cid.Cid) (*api.PinInfo, error)
 }
 
+// QoSPinTracker is implemented by PinTrackers which apply the queueing and
+// retry settings of the QoS classes (see Config.QoSClasses).
+type QoSPinTracker interface {
+	// SetQoSClasses provides the QoS classes, by name.
+	SetQoSClasses(map[string]*api.QoSClass)
+}
+
+// ProgressPinTracker is implemented by PinTrackers which report the
+// progress of ongoing pins in their status.
+type ProgressPinTracker interface {
+	// SetPinProgress records how many blocks an ongoing pin of the
+	// given item has fetched.
+	SetPinProgress(context.Context, cid.Cid, int)
+}
+
+// SLAPinTracker is implemented by PinTrackers which check that pins are
+// pinned before their deadline (see api.PinOptions.PinDeadline).
+type SLAPinTracker interface {
+	// SLABreaches returns the items which were pinned after their
+	// deadline or which are not pinned yet and their deadline has
+	// passed.
+	SLABreaches(context.Context) []*api.PinSLABreach
+}
+
+// StatusCidsPinTracker is implemented by PinTrackers which can report the
+// status of several Cids at once more efficiently than one by one.
+type StatusCidsPinTracker interface {
+	// StatusCids returns the status of the given Cids, in the same
+	// order.
+	StatusCids(context.Context, []cid.Cid) []*api.PinInfo
+}
+
+// QueueDepthPinTracker is implemented by PinTrackers which report how much
+// work they have pending.
+type QueueDepthPinTracker interface {
+	// QueueDepth returns the number of operations which are queued or
+	// in progress.
+	QueueDepth(context.Context) int
+}
+
 // Informer provides Metric information from a peer. The metrics produced by
 // informers are then passed to a PinAllocator which will use them to
 // determine where to pin content. The metric is agnostic to the rest of
@@ -142,6 +222,14 @@ type Informer interface {
 	GetMetrics(context.Context) []*api.Metric
 }
 
+// AlertSink forwards the alerts recorded by a Cluster peer to an external
+// system, i.e. to notify operators.
+type AlertSink interface {
+	// Alert queues an alert for delivery. It must not block.
+	Alert(context.Context, *api.Alert)
+	Shutdown(context.Context) error
+}
+
 // PinAllocator decides where to pin certain content. In order to make such
 // decision, it receives the pin arguments, the peers which are currently
 // allocated to the content and metrics available for all peers which could
@@ -174,16 +262,36 @@ type PeerMonitor interface {
 	// PublishMetric sends a metric to the rest of the peers.
 	// How to send it, and to who, is to be decided by the implementation.
 	PublishMetric(context.Context, *api.Metric) error
+	// PublishMetrics sends several metrics to the rest of the peers at
+	// once, like PublishMetric does with one.
+	PublishMetrics(context.Context, []*api.Metric) error
 	// LatestMetrics returns a map with the latest metrics of matching
 	// name for the current cluster peers. The result should only contain
 	// one metric per peer at most.
 	LatestMetrics(ctx context.Context, name string) []*api.Metric
+	// MetricsAt returns the metrics of matching name which were valid
+	// for each peer at the given time, as far as the retained metrics
+	// allow to tell.
+	MetricsAt(ctx context.Context, name string, t time.Time) []*api.Metric
+	// PeerMetricAll returns all the metrics of matching name retained
+	// for the given peer, the most recent first. Expired metrics which
+	// have not been removed yet are included and flagged as Stale.
+	PeerMetricAll(ctx context.Context, pid peer.ID, name string) []*api.Metric
 	// MetricNames returns a list of metric names.
 	MetricNames(ctx context.Context) []string
+	// PeerLeft informs the monitor that the given peer is leaving the
+	// cluster, so that it can stop relying on its metrics.
+	PeerLeft(ctx context.Context, pid peer.ID) error
 	// Alerts delivers alerts generated when this peer monitor detects
 	// a problem (i.e. metrics not arriving as expected). Alerts can be used
-	// to trigger self-healing measures or re-pinnings of content.
+	// to trigger self-healing measures or re-pinnings of content. Once
+	// a metric which triggered an alert arrives again, an alert with
+	// Recovered set is delivered.
 	Alerts() <-chan *api.Alert
+	// RecentAlerts returns the alerts delivered on the Alerts channel
+	// which were triggered after the given time and are still retained,
+	// the most recent first.
+	RecentAlerts(ctx context.Context, since time.Time) []*api.Alert
 }
 
 // Tracer implements Component as a way
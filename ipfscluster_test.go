@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"math/rand"
 	"mime/multipart"
+	"net"
 	"os"
 	"path/filepath"
 	"sort"
@@ -20,6 +21,7 @@ import (
 	"github.com/ipfs/ipfs-cluster/allocator/balanced"
 	"github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/api/rest"
+	"github.com/ipfs/ipfs-cluster/api/rest/client"
 	"github.com/ipfs/ipfs-cluster/consensus/crdt"
 	"github.com/ipfs/ipfs-cluster/consensus/raft"
 	"github.com/ipfs/ipfs-cluster/datastore/badger"
@@ -34,6 +36,7 @@ import (
 	"github.com/ipfs/ipfs-cluster/test"
 	"github.com/ipfs/ipfs-cluster/version"
 
+	cid "github.com/ipfs/go-cid"
 	ds "github.com/ipfs/go-datastore"
 	libp2p "github.com/libp2p/go-libp2p"
 	crypto "github.com/libp2p/go-libp2p-core/crypto"
@@ -228,7 +231,7 @@ func createComponents(
 	if consensus == "raft" {
 		peersF = cons.Peers
 	}
-	mon, err := pubsubmon.New(ctx, psmonCfg, pubsub, peersF)
+	mon, err := pubsubmon.New(ctx, psmonCfg, pubsub, host, peersF, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -281,7 +284,7 @@ func makeConsensus(t *testing.T, store ds.Datastore, h host.Host, psub *pubsub.P
 }
 
 func createCluster(t *testing.T, host host.Host, dht *dual.DHT, clusterCfg *Config, store ds.Datastore, consensus Consensus, apis []API, ipfs IPFSConnector, tracker PinTracker, mon PeerMonitor, alloc PinAllocator, inf Informer, tracer Tracer) *Cluster {
-	cl, err := NewCluster(context.Background(), host, dht, clusterCfg, store, consensus, apis, ipfs, tracker, mon, alloc, []Informer{inf}, tracer)
+	cl, err := NewCluster(context.Background(), host, dht, clusterCfg, store, consensus, apis, ipfs, tracker, mon, alloc, []Informer{inf}, nil, tracer)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -895,6 +898,46 @@ func TestClustersStatusAll(t *testing.T) {
 	runF(t, clusters, f)
 }
 
+func TestClustersStatusCids(t *testing.T) {
+	ctx := context.Background()
+	clusters, mock := createClusters(t)
+	defer shutdownClusters(t, clusters, mock)
+	clusters[0].Pin(ctx, test.Cid1, api.PinOptions{Name: "test"})
+	pinDelay()
+
+	f := func(t *testing.T, c *Cluster) {
+		cids := []cid.Cid{test.Cid2, test.Cid1, test.Cid2}
+		statuses, err := c.StatusCids(ctx, cids)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(statuses) != len(cids) {
+			t.Fatalf("expected %d statuses, got %d", len(cids), len(statuses))
+		}
+		for i, gpi := range statuses {
+			if !gpi.Cid.Equals(cids[i]) {
+				t.Errorf("%d: expected %s, got %s", i, cids[i], gpi.Cid)
+			}
+			if len(gpi.PeerMap) != nClusters {
+				t.Errorf("%s: expected the status from every peer", gpi.Cid)
+			}
+			expected := api.TrackerStatusUnpinned
+			if gpi.Cid.Equals(test.Cid1) {
+				expected = api.TrackerStatusPinned
+				if gpi.Name != "test" {
+					t.Error("globalPinInfo should have the name")
+				}
+			}
+			for p, pinfo := range gpi.PeerMap {
+				if pinfo.Status != expected {
+					t.Errorf("%s: %s: expected %s, got %s", gpi.Cid, p, expected, pinfo.Status)
+				}
+			}
+		}
+	}
+	runF(t, clusters, f)
+}
+
 func TestClustersStatusAllWithErrors(t *testing.T) {
 	ctx := context.Background()
 	clusters, mock := createClusters(t)
@@ -1247,6 +1290,119 @@ func TestClustersReplicationOverall(t *testing.T) {
 
 // This test checks that we pin with ReplicationFactorMax when
 // we can
+func TestClustersDedupAwareAllocation(t *testing.T) {
+	ctx := context.Background()
+	if nClusters < 3 {
+		t.Skip("Need at least 3 peers")
+	}
+
+	clusters, mock := createClusters(t)
+	defer shutdownClusters(t, clusters, mock)
+	clusters[0].config.DedupAwareAllocation = true
+
+	ttlDelay()
+
+	// Only the last peer has the block.
+	h := test.Cid3
+	holder := clusters[nClusters-1]
+	mock[nClusters-1].BlockStore[h.String()] = []byte("data")
+
+	pin, err := clusters[0].Pin(ctx, h, api.PinOptions{
+		ReplicationFactorMin: 1,
+		ReplicationFactorMax: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pin.Allocations) != 1 || pin.Allocations[0] != holder.id {
+		t.Error("expected the item to be allocated to the peer holding it")
+	}
+}
+
+func TestClustersSplitBrain(t *testing.T) {
+	ctx := context.Background()
+	clusters, mock := createClusters(t)
+	defer shutdownClusters(t, clusters, mock)
+
+	_, err := clusters[0].Pin(ctx, test.Cid1, api.PinOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinDelay()
+
+	for _, c := range clusters {
+		if fp := c.checkSplitBrain(ctx, ""); fp != "" {
+			t.Errorf("%s: unexpected divergence: %s", c.id, fp)
+		}
+	}
+}
+
+func TestClustersCapacityAdmission(t *testing.T) {
+	ctx := context.Background()
+	clusters, mock := createClusters(t)
+	defer shutdownClusters(t, clusters, mock)
+	clusters[0].config.CapacityAdmission = true
+
+	ttlDelay()
+
+	opts := api.PinOptions{
+		ReplicationFactorMin: 1,
+		ReplicationFactorMax: 1,
+	}
+	_, err := clusters[0].Pin(ctx, test.HugeCid, opts)
+	if api.KindOf(err) != api.ErrorKindNoSpace {
+		t.Fatalf("expected the pin to be rejected for lack of space: %v", err)
+	}
+
+	_, err = clusters[0].Pin(ctx, test.Cid1, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClustersReadOnlyPeer(t *testing.T) {
+	ctx := context.Background()
+	if nClusters < 3 {
+		t.Skip("Need at least 3 peers")
+	}
+
+	clusters, mock := createClusters(t)
+	defer shutdownClusters(t, clusters, mock)
+	readOnly := clusters[nClusters-1]
+	readOnly.config.ReadOnly = true
+	for _, c := range clusters {
+		c.config.ReplicationFactorMin = 1
+		c.config.ReplicationFactorMax = nClusters
+	}
+
+	// Wait for the read-only peer to announce it.
+	time.Sleep(2 * readOnly.config.MonitorPingInterval)
+
+	for _, h := range []cid.Cid{test.Cid1, test.Cid2, test.Cid3} {
+		_, err := clusters[0].Pin(ctx, h, api.PinOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	pinDelay()
+
+	pins, err := clusters[0].Pins(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 3 {
+		t.Fatal("expected 3 pins")
+	}
+	for _, p := range pins {
+		if len(p.Allocations) != nClusters-1 {
+			t.Errorf("%s should be allocated to all the other peers: %s", p.Cid, p.Allocations)
+		}
+		if containsPeer(p.Allocations, readOnly.id) {
+			t.Errorf("%s should not be allocated to the read-only peer", p.Cid)
+		}
+	}
+}
+
 func TestClustersReplicationFactorMax(t *testing.T) {
 	ctx := context.Background()
 	if nClusters < 3 {
@@ -1346,6 +1502,81 @@ func TestClustersReplicationFactorMaxLower(t *testing.T) {
 	}
 }
 
+// This test checks that updating the replication factor of a pin keeps its
+// allocations and only pins on the newly allocated peer.
+func TestClustersUpdateReplicationFactor(t *testing.T) {
+	ctx := context.Background()
+	if nClusters < 4 {
+		t.Skip("Need at least 4 peers")
+	}
+
+	clusters, mock := createClusters(t)
+	defer shutdownClusters(t, clusters, mock)
+
+	ttlDelay()
+
+	h := test.Cid1
+	opts := api.PinOptions{
+		ReplicationFactorMin: 2,
+		ReplicationFactorMax: 2,
+	}
+	_, err := clusters[0].Pin(ctx, h, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pinDelay()
+
+	p1, err := clusters[0].PinGet(ctx, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p1.Allocations) != 2 {
+		t.Fatal("allocations should be 2")
+	}
+
+	pinsBefore := make([]int, nClusters)
+	for i, m := range mock {
+		pinsBefore[i] = m.GetCount("pin/add")
+	}
+
+	opts.ReplicationFactorMin = 3
+	opts.ReplicationFactorMax = 3
+	_, err = clusters[0].Update(ctx, h, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pinDelay()
+
+	p2, err := clusters[0].PinGet(ctx, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p2.Allocations) != 3 {
+		t.Fatal("allocations should have been increased to 3")
+	}
+	for _, p := range p1.Allocations {
+		if !containsPeer(p2.Allocations, p) {
+			t.Errorf("%s should still be allocated", p)
+		}
+	}
+
+	newPins := 0
+	for i, c := range clusters {
+		if mock[i].GetCount("pin/add") == pinsBefore[i] {
+			continue
+		}
+		newPins++
+		if containsPeer(p1.Allocations, c.id) {
+			t.Errorf("%s was allocated already and should not have pinned again", c.id)
+		}
+	}
+	if newPins != 1 {
+		t.Errorf("expected a single peer to pin; got %d", newPins)
+	}
+}
+
 // This test checks that when not all nodes are available,
 // we pin in as many as we can aiming for ReplicationFactorMax
 func TestClustersReplicationFactorInBetween(t *testing.T) {
@@ -2164,3 +2395,85 @@ func TestClusterAlerts(t *testing.T) {
 		t.Error("expected at least one alert")
 	}
 }
+
+func TestClustersDeletedPins(t *testing.T) {
+	ctx := context.Background()
+	clusters, mock := createClusters(t)
+	defer shutdownClusters(t, clusters, mock)
+
+	_, err := clusters[0].Pin(ctx, test.Cid1, api.PinOptions{Name: "deleted"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinDelay()
+	if _, err := clusters[0].unpin(ctx, test.Cid1, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every peer gathers the tombstone recorded by the peer which
+	// handled the unpin.
+	for _, c := range clusters {
+		tombstones, err := c.DeletedPins(ctx, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tombstones) != 1 {
+			t.Fatalf("%s: expected 1 tombstone, got %d", c.id, len(tombstones))
+		}
+		ts := tombstones[0]
+		if !ts.Cid.Equals(test.Cid1) || ts.UnpinnedBy != "alice" || ts.Peer != clusters[0].id {
+			t.Errorf("%s: unexpected tombstone: %+v", c.id, ts)
+		}
+	}
+}
+
+func TestClusterRecentAlerts(t *testing.T) {
+	ctx := context.Background()
+	clusters, mock := createClusters(t)
+	defer shutdownClusters(t, clusters, mock)
+
+	if len(clusters) < 2 {
+		t.Skip("need at least 2 nodes for this test")
+	}
+
+	ttlDelay()
+	start := time.Now()
+	clusters[1].Shutdown(ctx)
+	ttlDelay()
+
+	// The alerts are read through the REST API of the first peer.
+	addrs, err := clusters[0].apis[0].(*rest.API).HTTPAddresses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, err := net.SplitHostPort(addrs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := client.NewDefaultClient(&client.Config{Host: host, Port: port})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alerts, err := c.RecentAlerts(ctx, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, alrt := range alerts {
+		if alrt.Peer == clusters[1].id {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected an alert for the peer which went down: %v", alerts)
+	}
+
+	alerts, err = c.RecentAlerts(ctx, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 0 {
+		t.Errorf("expected no alerts triggered in the future: %v", alerts)
+	}
+}
@@ -0,0 +1,119 @@
+package ipfshttp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/observations"
+
+	"go.opencensus.io/stats"
+)
+
+// ErrCircuitOpen is returned for requests which are not sent to the IPFS
+// daemon because the last ones failed.
+var ErrCircuitOpen = errors.New("IPFS daemon unavailable: too many consecutive failed requests")
+
+// States of a breaker, as recorded in the observations.IPFSCircuitBreaker
+// metric.
+const (
+	breakerClosed   = 0
+	breakerHalfOpen = 1
+	breakerOpen     = 2
+)
+
+// breaker counts the consecutive failed requests to the IPFS daemon. Once
+// they reach the threshold it opens: requests fail fast with ErrCircuitOpen
+// until the cooldown expires and then a single request is let through to
+// probe the daemon. Its result closes the breaker or opens it again.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// allow returns ErrCircuitOpen when a request should not be sent.
+func (b *breaker) allow(ctx context.Context) error {
+	if b.threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerHalfOpen:
+		return ErrCircuitOpen
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		logger.Info("probing the IPFS daemon after repeated failures")
+		b.setState(ctx, breakerHalfOpen)
+	}
+	return nil
+}
+
+// done records the result of a request let through by allow.
+func (b *breaker) done(ctx context.Context, err error) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		if b.state != breakerClosed {
+			logger.Info("the IPFS daemon is reachable again")
+		}
+		b.failures = 0
+		b.setState(ctx, breakerClosed)
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		if b.state == breakerClosed {
+			logger.Errorf(
+				"%d consecutive failed requests to IPFS: failing fast for %s",
+				b.failures,
+				b.cooldown,
+			)
+		}
+		b.openedAt = time.Now()
+		b.setState(ctx, breakerOpen)
+	}
+}
+
+// cancel records that a request let through by allow was cancelled before
+// it could tell whether the daemon is up, so that the next one probes it.
+func (b *breaker) cancel(ctx context.Context) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen {
+		b.setState(ctx, breakerOpen)
+	}
+}
+
+func (b *breaker) setState(ctx context.Context, state int) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	stats.Record(ctx, observations.IPFSCircuitBreaker.M(int64(state)))
+}
@@ -24,7 +24,23 @@ const (
 	DefaultPinTimeout         = 2 * time.Minute
 	DefaultUnpinTimeout       = 3 * time.Hour
 	DefaultRepoGCTimeout      = 24 * time.Hour
+	DefaultRefsTimeout        = time.Hour
 	DefaultUnpinDisable       = false
+	// circuit breaker
+	DefaultFailureThreshold = 5
+	DefaultFailureCooldown  = 10 * time.Second
+	DefaultNodeSelection    = NodeSelectionFailover
+)
+
+// Policies to select which of the NodeAddrs daemons requests are sent to.
+const (
+	// NodeSelectionFailover sends requests to the first daemon and, when
+	// they fail, to the next ones in order.
+	NodeSelectionFailover = "failover"
+	// NodeSelectionRoundRobin sends the requests about a CID to the
+	// daemon chosen by its hash, and any others to the next daemon,
+	// failing over to the following ones.
+	NodeSelectionRoundRobin = "round-robin"
 )
 
 // Config is used to initialize a Connector and allows to customize
@@ -35,6 +51,13 @@ type Config struct {
 	// Host/Port for the IPFS daemon.
 	NodeAddr ma.Multiaddr
 
+	// NodeAddrs, when set, are used instead of NodeAddr to talk to
+	// several IPFS daemons, as chosen by NodeSelection.
+	NodeAddrs []ma.Multiaddr
+	// NodeSelection is the policy used to choose among NodeAddrs:
+	// NodeSelectionFailover or NodeSelectionRoundRobin.
+	NodeSelection string
+
 	// ConnectSwarmsDelay specifies how long to wait after startup before
 	// attempting to open connections from this peer's IPFS daemon to the
 	// IPFS daemons of other peers.
@@ -51,9 +74,22 @@ type Config struct {
 
 	// RepoGC Operation timeout
 	RepoGCTimeout time.Duration
+
+	// RefsTimeout bounds the walks of a whole DAG looking for missing
+	// blocks, as done when verifying pins.
+	RefsTimeout time.Duration
 	// Disables the unpin operation and returns an error.
 	UnpinDisable bool
 
+	// FailureThreshold is the number of consecutive failed requests to
+	// the IPFS daemon after which requests fail fast, without reaching
+	// the daemon, for FailureCooldown. A single request is then let
+	// through to probe it. 0 disables this behaviour.
+	FailureThreshold int
+	// FailureCooldown is how long requests fail fast once
+	// FailureThreshold is reached.
+	FailureCooldown time.Duration
+
 	// Tracing flag used to skip tracing specific paths when not enabled.
 	Tracing bool
 }
@@ -65,7 +101,13 @@ type jsonConfig struct {
 	PinTimeout         string `json:"pin_timeout"`
 	UnpinTimeout       string `json:"unpin_timeout"`
 	RepoGCTimeout      string `json:"repogc_timeout"`
+	RefsTimeout        string `json:"refs_timeout"`
 	UnpinDisable       bool   `json:"unpin_disable,omitempty"`
+	FailureThreshold   *int   `json:"failure_threshold"`
+	FailureCooldown    string `json:"failure_cooldown"`
+
+	NodeMultiaddresses []string `json:"node_multiaddresses,omitempty"`
+	NodeSelection      string   `json:"node_selection"`
 }
 
 // ConfigKey provides a human-friendly identifier for this type of Config.
@@ -77,12 +119,17 @@ func (cfg *Config) ConfigKey() string {
 func (cfg *Config) Default() error {
 	node, _ := ma.NewMultiaddr(DefaultNodeAddr)
 	cfg.NodeAddr = node
+	cfg.NodeAddrs = nil
+	cfg.NodeSelection = DefaultNodeSelection
 	cfg.ConnectSwarmsDelay = DefaultConnectSwarmsDelay
 	cfg.IPFSRequestTimeout = DefaultIPFSRequestTimeout
 	cfg.PinTimeout = DefaultPinTimeout
 	cfg.UnpinTimeout = DefaultUnpinTimeout
 	cfg.RepoGCTimeout = DefaultRepoGCTimeout
+	cfg.RefsTimeout = DefaultRefsTimeout
 	cfg.UnpinDisable = DefaultUnpinDisable
+	cfg.FailureThreshold = DefaultFailureThreshold
+	cfg.FailureCooldown = DefaultFailureCooldown
 
 	return nil
 }
@@ -111,6 +158,12 @@ func (cfg *Config) Validate() error {
 		err = errors.New("ipfshttp.node_multiaddress not set")
 	}
 
+	switch cfg.NodeSelection {
+	case NodeSelectionFailover, NodeSelectionRoundRobin:
+	default:
+		err = errors.New("ipfshttp.node_selection invalid")
+	}
+
 	if cfg.ConnectSwarmsDelay < 0 {
 		err = errors.New("ipfshttp.connect_swarms_delay is invalid")
 	}
@@ -131,6 +184,18 @@ func (cfg *Config) Validate() error {
 		err = errors.New("ipfshttp.repogc_timeout invalid")
 	}
 
+	if cfg.RefsTimeout < 0 {
+		err = errors.New("ipfshttp.refs_timeout invalid")
+	}
+
+	if cfg.FailureThreshold < 0 {
+		err = errors.New("ipfshttp.failure_threshold invalid")
+	}
+
+	if cfg.FailureCooldown < 0 {
+		err = errors.New("ipfshttp.failure_cooldown invalid")
+	}
+
 	return err
 
 }
@@ -156,7 +221,21 @@ func (cfg *Config) applyJSONConfig(jcfg *jsonConfig) error {
 	}
 
 	cfg.NodeAddr = nodeAddr
+
+	cfg.NodeAddrs = nil
+	for _, addr := range jcfg.NodeMultiaddresses {
+		nodeAddr, err := ma.NewMultiaddr(addr)
+		if err != nil {
+			return fmt.Errorf("error parsing node_multiaddresses: %s", err)
+		}
+		cfg.NodeAddrs = append(cfg.NodeAddrs, nodeAddr)
+	}
+	config.SetIfNotDefault(jcfg.NodeSelection, &cfg.NodeSelection)
+
 	cfg.UnpinDisable = jcfg.UnpinDisable
+	if jcfg.FailureThreshold != nil {
+		cfg.FailureThreshold = *jcfg.FailureThreshold
+	}
 
 	err = config.ParseDurations(
 		"ipfshttp",
@@ -165,6 +244,8 @@ func (cfg *Config) applyJSONConfig(jcfg *jsonConfig) error {
 		&config.DurationOpt{Duration: jcfg.PinTimeout, Dst: &cfg.PinTimeout, Name: "pin_timeout"},
 		&config.DurationOpt{Duration: jcfg.UnpinTimeout, Dst: &cfg.UnpinTimeout, Name: "unpin_timeout"},
 		&config.DurationOpt{Duration: jcfg.RepoGCTimeout, Dst: &cfg.RepoGCTimeout, Name: "repogc_timeout"},
+		&config.DurationOpt{Duration: jcfg.RefsTimeout, Dst: &cfg.RefsTimeout, Name: "refs_timeout"},
+		&config.DurationOpt{Duration: jcfg.FailureCooldown, Dst: &cfg.FailureCooldown, Name: "failure_cooldown"},
 	)
 	if err != nil {
 		return err
@@ -196,16 +277,31 @@ func (cfg *Config) toJSONConfig() (jcfg *jsonConfig, err error) {
 
 	// Set all configuration fields
 	jcfg.NodeMultiaddress = cfg.NodeAddr.String()
+	for _, addr := range cfg.NodeAddrs {
+		jcfg.NodeMultiaddresses = append(jcfg.NodeMultiaddresses, addr.String())
+	}
+	jcfg.NodeSelection = cfg.NodeSelection
 	jcfg.ConnectSwarmsDelay = cfg.ConnectSwarmsDelay.String()
 	jcfg.IPFSRequestTimeout = cfg.IPFSRequestTimeout.String()
 	jcfg.PinTimeout = cfg.PinTimeout.String()
 	jcfg.UnpinTimeout = cfg.UnpinTimeout.String()
 	jcfg.RepoGCTimeout = cfg.RepoGCTimeout.String()
+	jcfg.RefsTimeout = cfg.RefsTimeout.String()
 	jcfg.UnpinDisable = cfg.UnpinDisable
+	jcfg.FailureThreshold = &cfg.FailureThreshold
+	jcfg.FailureCooldown = cfg.FailureCooldown.String()
 
 	return
 }
 
+// nodeAddrs returns the addresses of all the IPFS daemons.
+func (cfg *Config) nodeAddrs() []ma.Multiaddr {
+	if len(cfg.NodeAddrs) > 0 {
+		return cfg.NodeAddrs
+	}
+	return []ma.Multiaddr{cfg.NodeAddr}
+}
+
 // ToDisplayJSON returns JSON config as a string.
 func (cfg *Config) ToDisplayJSON() ([]byte, error) {
 	jcfg, err := cfg.toJSONConfig()
@@ -14,7 +14,10 @@ var cfgJSON = []byte(`
 	"ipfs_request_timeout": "5m0s",
 	"pin_timeout": "2m",
 	"unpin_timeout": "3h",
-	"repogc_timeout": "24h"
+	"repogc_timeout": "24h",
+	"refs_timeout": "1h",
+	"failure_threshold": 3,
+	"failure_cooldown": "30s"
 }
 `)
 
@@ -24,15 +27,50 @@ func TestLoadJSON(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	if cfg.FailureThreshold != 3 || cfg.FailureCooldown != 30*time.Second {
+		t.Error("failure_threshold and failure_cooldown not loaded")
+	}
 
 	j := &jsonConfig{}
 	json.Unmarshal(cfgJSON, j)
-	j.NodeMultiaddress = "abc"
+	j.FailureThreshold = nil
 	tst, _ := json.Marshal(j)
 	err = cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.FailureThreshold != DefaultFailureThreshold {
+		t.Error("a missing failure_threshold should keep the default")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.NodeMultiaddress = "abc"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
 	if err == nil {
 		t.Error("expected error in node_multiaddress")
 	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.NodeMultiaddresses = []string{"/ip4/127.0.0.1/tcp/5001", "/ip4/127.0.0.1/tcp/5002"}
+	j.NodeSelection = NodeSelectionRoundRobin
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.NodeAddrs) != 2 || cfg.NodeSelection != NodeSelectionRoundRobin {
+		t.Error("node_multiaddresses and node_selection not loaded")
+	}
+
+	j.NodeSelection = "random"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error in node_selection")
+	}
 }
 
 func TestToJSON(t *testing.T) {
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -14,6 +15,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ipfs/ipfs-cluster/api"
@@ -46,6 +48,14 @@ var logger = logging.Logger("ipfshttp")
 // only the 10th will trigger a SendInformerMetrics call.
 var updateMetricMod = 10
 
+// pinProgressReportInterval is how often the progress of a pin is reported
+// to the pin tracker, at most.
+var pinProgressReportInterval = time.Second
+
+// ErrUnsupportedCodec is returned when trying to pin a CID with a codec which
+// the IPFS daemon does not support.
+var ErrUnsupportedCodec = errors.New("the IPFS daemon does not support the CID codec")
+
 // Connector implements the IPFSConnector interface
 // and provides a component which  is used to perform
 // on-demand requests against the configured IPFS daemom
@@ -54,17 +64,28 @@ type Connector struct {
 	ctx    context.Context
 	cancel func()
 
-	config   *Config
-	nodeAddr string
+	config *Config
+	// addresses of the IPFS daemons and a counter to choose
+	// among them with NodeSelectionRoundRobin for requests which are
+	// not about a CID.
+	nodeAddrs []string
+	nextNode  uint64
 
 	rpcClient *rpc.Client
 	rpcReady  chan struct{}
 
-	client *http.Client // client to ipfs daemon
+	client  *http.Client // client to ipfs daemon
+	breaker *breaker
 
 	updateMetricMutex sync.Mutex
 	updateMetricCount int
 
+	// codecs supported by the daemon, fetched on first use. nil when
+	// the daemon cannot tell.
+	codecs        map[uint64]struct{}
+	codecsFetched bool
+	codecsMux     sync.Mutex
+
 	shutdownLock sync.Mutex
 	shutdown     bool
 	wg           sync.WaitGroup
@@ -107,6 +128,22 @@ type ipfsRepoGCResp struct {
 	Error string
 }
 
+type ipfsRefsResp struct {
+	Ref string
+	Err string
+}
+
+// ipfsRoutingResp is one of the events streamed by "dht/findprovs".
+type ipfsRoutingResp struct {
+	Type      int
+	Responses []struct {
+		ID string
+	}
+}
+
+// routingProvider is the type of the routing events which carry providers.
+const routingProvider = 4
+
 type ipfsPinsResp struct {
 	Pins     []string
 	Progress int
@@ -121,10 +158,34 @@ type ipfsBlockPutResp struct {
 	Size int
 }
 
+type ipfsFilesStatResp struct {
+	Hash           string
+	CumulativeSize uint64
+}
+
 type ipfsPeer struct {
 	Peer string
 }
 
+type ipfsCodec struct {
+	Code uint64
+	Name string
+}
+
+type ipfsLink struct {
+	Name string
+	Hash string
+}
+
+type ipfsLsObject struct {
+	Hash  string
+	Links []ipfsLink
+}
+
+type ipfsLsResp struct {
+	Objects []ipfsLsObject
+}
+
 // NewConnector creates the component and leaves it ready to be started
 func NewConnector(cfg *Config) (*Connector, error) {
 	err := cfg.Validate()
@@ -132,22 +193,25 @@ func NewConnector(cfg *Config) (*Connector, error) {
 		return nil, err
 	}
 
-	nodeMAddr := cfg.NodeAddr
-	// dns multiaddresses need to be resolved first
-	if madns.Matches(nodeMAddr) {
-		ctx, cancel := context.WithTimeout(context.Background(), DNSTimeout)
-		defer cancel()
-		resolvedAddrs, err := madns.Resolve(ctx, cfg.NodeAddr)
+	var nodeAddrs []string
+	for _, nodeMAddr := range cfg.nodeAddrs() {
+		// dns multiaddresses need to be resolved first
+		if madns.Matches(nodeMAddr) {
+			ctx, cancel := context.WithTimeout(context.Background(), DNSTimeout)
+			defer cancel()
+			resolvedAddrs, err := madns.Resolve(ctx, nodeMAddr)
+			if err != nil {
+				logger.Error(err)
+				return nil, err
+			}
+			nodeMAddr = resolvedAddrs[0]
+		}
+
+		_, nodeAddr, err := manet.DialArgs(nodeMAddr)
 		if err != nil {
-			logger.Error(err)
 			return nil, err
 		}
-		nodeMAddr = resolvedAddrs[0]
-	}
-
-	_, nodeAddr, err := manet.DialArgs(nodeMAddr)
-	if err != nil {
-		return nil, err
+		nodeAddrs = append(nodeAddrs, nodeAddr)
 	}
 
 	c := &http.Client{} // timeouts are handled by context timeouts
@@ -164,12 +228,13 @@ func NewConnector(cfg *Config) (*Connector, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	ipfs := &Connector{
-		ctx:      ctx,
-		config:   cfg,
-		cancel:   cancel,
-		nodeAddr: nodeAddr,
-		rpcReady: make(chan struct{}, 1),
-		client:   c,
+		ctx:       ctx,
+		config:    cfg,
+		cancel:    cancel,
+		nodeAddrs: nodeAddrs,
+		rpcReady:  make(chan struct{}, 1),
+		client:    c,
+		breaker:   newBreaker(cfg.FailureThreshold, cfg.FailureCooldown),
 	}
 
 	go ipfs.run()
@@ -309,6 +374,16 @@ func (ipfs *Connector) Pin(ctx context.Context, pin *api.Pin) error {
 
 	hash := pin.Cid
 	maxDepth := pin.MaxDepth
+	selective := selectivePin(pin)
+
+	if ok, err := ipfs.SupportsCodec(ctx, hash.Type()); err == nil && !ok {
+		return fmt.Errorf("%w: %s", ErrUnsupportedCodec, codecName(hash.Type()))
+	}
+	if selective {
+		// the root is pinned directly. Included links get pinned
+		// on their own.
+		maxDepth = 0
+	}
 
 	pinStatus, err := ipfs.PinLsCid(ctx, pin)
 	if err != nil {
@@ -350,8 +425,10 @@ func (ipfs *Connector) Pin(ctx context.Context, pin *api.Pin) error {
 
 	// If we have a pin-update, and the old object
 	// is pinned recursively, then do pin/update.
-	// Otherwise do a normal pin.
-	if from := pin.PinUpdate; from != cid.Undef {
+	// Otherwise do a normal pin. pin/update would pin the full
+	// DAG, so it is not used when links are excluded, nor when both
+	// CIDs are handled by different daemons.
+	if from := pin.PinUpdate; from != cid.Undef && !selective && ipfs.cidNode(from) == ipfs.cidNode(pin.Cid) {
 		fromPin := api.PinWithOpts(from, pin.PinOptions)
 		pinStatus, _ := ipfs.PinLsCid(ctx, fromPin)
 		if pinStatus.IsPinned(-1) { // pinned recursively.
@@ -364,17 +441,26 @@ func (ipfs *Connector) Pin(ctx context.Context, pin *api.Pin) error {
 
 	// Pin request and timeout if there is no progress
 	outPins := make(chan int)
+	timedOut := make(chan struct{})
 	go func() {
-		var lastProgress int
+		var lastProgress, reported int
 		lastProgressTime := time.Now()
 
 		ticker := time.NewTicker(ipfs.config.PinTimeout)
 		defer ticker.Stop()
+		reportTicker := time.NewTicker(pinProgressReportInterval)
+		defer reportTicker.Stop()
 		for {
 			select {
+			case <-reportTicker.C:
+				if lastProgress > reported {
+					reported = lastProgress
+					ipfs.reportPinProgress(ctx, hash, reported)
+				}
 			case <-ticker.C:
 				if time.Since(lastProgressTime) > ipfs.config.PinTimeout {
 					// timeout request
+					close(timedOut)
 					cancelRequest()
 					return
 				}
@@ -393,8 +479,20 @@ func (ipfs *Connector) Pin(ctx context.Context, pin *api.Pin) error {
 		}
 	}()
 
-	err = ipfs.pinProgress(ctx, hash, maxDepth, outPins)
+	if selective {
+		err = ipfs.pinSelected(ctx, pin, outPins)
+	} else {
+		err = ipfs.pinProgress(ctx, hash, maxDepth, outPins)
+	}
 	if err != nil {
+		select {
+		case <-timedOut:
+			return fmt.Errorf("%w: no progress pinning %s for %s", api.ErrTimeout, hash, ipfs.config.PinTimeout)
+		default:
+		}
+		if outOfSpace(err) {
+			return fmt.Errorf("%w: %s", api.ErrPeerFull, err)
+		}
 		return err
 	}
 
@@ -403,6 +501,24 @@ func (ipfs *Connector) Pin(ctx context.Context, pin *api.Pin) error {
 	return nil
 }
 
+// reportPinProgress lets the pin tracker know how many blocks of the given
+// item have been fetched. It is called at most every
+// pinProgressReportInterval for every pin. Daemons which do not report
+// progress never get here.
+func (ipfs *Connector) reportPinProgress(ctx context.Context, c cid.Cid, blocks int) {
+	err := ipfs.rpcClient.CallContext(
+		ctx,
+		"",
+		"PinTracker",
+		"SetPinProgress",
+		&api.PinProgress{Cid: c, Blocks: blocks},
+		&struct{}{},
+	)
+	if err != nil {
+		logger.Debugf("error reporting the pin progress of %s: %s", c, err)
+	}
+}
+
 // pinProgress pins an item and sends fetched node's progress on a
 // channel. Blocks until done or error. pinProgress will always close the out
 // channel.  pinProgress will not block on sending to the channel if it is full.
@@ -414,7 +530,7 @@ func (ipfs *Connector) pinProgress(ctx context.Context, hash cid.Cid, maxDepth a
 
 	pinArgs := pinArgs(maxDepth)
 	path := fmt.Sprintf("pin/add?arg=%s&%s&progress=true", hash, pinArgs)
-	res, err := ipfs.doPostCtx(ctx, ipfs.client, ipfs.apiURL(), path, "", nil)
+	res, err := ipfs.doPostCidCtx(ctx, hash, path, "", nil)
 	if err != nil {
 		return err
 	}
@@ -449,12 +565,124 @@ func (ipfs *Connector) pinProgress(ctx context.Context, hash cid.Cid, maxDepth a
 	}
 }
 
+// selectivePin returns true when a recursive pin excludes some of its links.
+func selectivePin(pin *api.Pin) bool {
+	return pin.MaxDepth < 0 && len(pin.ExcludeLinks) > 0
+}
+
+// pinSelected pins the root of the given pin directly and follows its links,
+// pinning recursively those that are not excluded by the pin options.
+// Excluded links are left unpinned. As with pinProgress, progress is sent on
+// the out channel, which is always closed.
+func (ipfs *Connector) pinSelected(ctx context.Context, pin *api.Pin, out chan<- int) error {
+	defer close(out)
+
+	ctx, span := trace.StartSpan(ctx, "ipfsconn/ipfshttp/pinSelected")
+	defer span.End()
+
+	var fetched int
+	pinOne := func(c cid.Cid, maxDepth api.PinDepth) error {
+		progress := make(chan int)
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- ipfs.pinProgress(ctx, c, maxDepth, progress)
+		}()
+
+		var last int
+		for p := range progress {
+			last = p
+			select {
+			case out <- fetched + p:
+			default:
+			}
+		}
+		fetched += last
+		return <-errCh
+	}
+
+	return ipfs.pinLinks(ctx, pin, pin.Cid, "", pinOne)
+}
+
+// pinLinks directly pins the node with the given cid and then handles its
+// links: excluded ones are skipped, those which may have excluded links below
+// are walked into and the rest are pinned recursively.
+func (ipfs *Connector) pinLinks(ctx context.Context, pin *api.Pin, c cid.Cid, prefix string, pinOne func(cid.Cid, api.PinDepth) error) error {
+	err := pinOne(c, 0)
+	if err != nil {
+		return err
+	}
+
+	links, err := ipfs.links(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	for l, names := range links {
+		for _, name := range names {
+			linkPath := name
+			if prefix != "" {
+				linkPath = prefix + "/" + name
+			}
+
+			switch {
+			case pin.ExcludesLink(linkPath):
+				logger.Debugf("%s: not pinning excluded link %s", pin.Cid, linkPath)
+			case pin.ExcludesBelow(linkPath):
+				err = ipfs.pinLinks(ctx, pin, l, linkPath, pinOne)
+			default:
+				err = pinOne(l, -1)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// links returns the links of the node with the given cid, indexed by cid,
+// along with the names each of them is linked with. Unnamed links have an
+// empty name.
+func (ipfs *Connector) links(ctx context.Context, c cid.Cid) (map[cid.Cid][]string, error) {
+	ctx, span := trace.StartSpan(ctx, "ipfsconn/ipfshttp/links")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, ipfs.config.IPFSRequestTimeout)
+	defer cancel()
+
+	path := fmt.Sprintf("ls?arg=%s&resolve-type=false&size=false", c)
+	body, err := ipfs.postCtx(ctx, path, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var res ipfsLsResp
+	err = json.Unmarshal(body, &res)
+	if err != nil {
+		logger.Error("parsing ls response")
+		logger.Error(string(body))
+		return nil, err
+	}
+
+	links := make(map[cid.Cid][]string)
+	for _, obj := range res.Objects {
+		for _, l := range obj.Links {
+			lc, err := cid.Decode(l.Hash)
+			if err != nil {
+				return nil, err
+			}
+			links[lc] = append(links[lc], l.Name)
+		}
+	}
+	return links, nil
+}
+
 func (ipfs *Connector) pinUpdate(ctx context.Context, from, to cid.Cid) error {
 	ctx, span := trace.StartSpan(ctx, "ipfsconn/ipfshttp/pinUpdate")
 	defer span.End()
 
 	path := fmt.Sprintf("pin/update?arg=%s&arg=%s&unpin=false", from, to)
-	_, err := ipfs.postCtx(ctx, path, "", nil)
+	_, err := ipfs.postCidCtx(ctx, to, path, "", nil)
 	if err != nil {
 		return err
 	}
@@ -464,8 +692,9 @@ func (ipfs *Connector) pinUpdate(ctx context.Context, from, to cid.Cid) error {
 }
 
 // Unpin performs an unpin request against the configured IPFS
-// daemon.
-func (ipfs *Connector) Unpin(ctx context.Context, hash cid.Cid) error {
+// daemon. For pins which exclude links, the links pinned along with the
+// root are unpinned too.
+func (ipfs *Connector) Unpin(ctx context.Context, pin *api.Pin) error {
 	ctx, span := trace.StartSpan(ctx, "ipfsconn/ipfshttp/Unpin")
 	defer span.End()
 
@@ -475,14 +704,25 @@ func (ipfs *Connector) Unpin(ctx context.Context, hash cid.Cid) error {
 
 	defer ipfs.updateInformerMetric(ctx)
 
+	hash := pin.Cid
 	path := fmt.Sprintf("pin/rm?arg=%s", hash)
 
 	ctx, cancel := context.WithTimeout(ctx, ipfs.config.UnpinTimeout)
 	defer cancel()
 
+	// Items pinned with excluded links are pinned directly and their
+	// included links carry pins of their own, which need removing too.
+	if selectivePin(pin) {
+		defer func() {
+			if err := ipfs.unpinLinks(ctx, pin, hash, ""); err != nil {
+				logger.Errorf("error unpinning the links of %s: %s", hash, err)
+			}
+		}()
+	}
+
 	// We will call unpin in any case, if the CID is not pinned,
 	// then we ignore the error (although this is a bit flaky).
-	_, err := ipfs.postCtx(ctx, path, "", nil)
+	_, err := ipfs.postCidCtx(ctx, hash, path, "", nil)
 	if err != nil {
 		ipfsErr, ok := err.(ipfsError)
 		if !ok || ipfsErr.Message != ipfspinner.ErrNotPinned.Error() {
@@ -497,6 +737,65 @@ func (ipfs *Connector) Unpin(ctx context.Context, hash cid.Cid) error {
 	return nil
 }
 
+// unpinLinks removes the pins that pinLinks set on the links below the node
+// with the given cid, following the ExcludeLinks of the pin in the same way.
+// Excluded links were not pinned by it and are left untouched, as are the
+// links which are part of the shared state on their own right.
+func (ipfs *Connector) unpinLinks(ctx context.Context, pin *api.Pin, c cid.Cid, prefix string) error {
+	ctx, span := trace.StartSpan(ctx, "ipfsconn/ipfshttp/unpinLinks")
+	defer span.End()
+
+	links, err := ipfs.links(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	for l, names := range links {
+		var linkPaths []string
+		for _, name := range names {
+			linkPath := name
+			if prefix != "" {
+				linkPath = prefix + "/" + name
+			}
+			if !pin.ExcludesLink(linkPath) {
+				linkPaths = append(linkPaths, linkPath)
+			}
+		}
+		if len(linkPaths) == 0 {
+			continue
+		}
+
+		err := ipfs.rpcClient.CallContext(
+			ctx,
+			"",
+			"Cluster",
+			"PinGet",
+			l,
+			&api.Pin{},
+		)
+		if err == nil { // a cluster pin
+			continue
+		}
+
+		_, err = ipfs.postCidCtx(ctx, l, fmt.Sprintf("pin/rm?arg=%s", l), "", nil)
+		if err != nil {
+			ipfsErr, ok := err.(ipfsError)
+			if !ok || ipfsErr.Message != ipfspinner.ErrNotPinned.Error() {
+				return err
+			}
+		}
+		for _, linkPath := range linkPaths {
+			if !pin.ExcludesBelow(linkPath) {
+				continue
+			}
+			if err := ipfs.unpinLinks(ctx, pin, l, linkPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // PinLs performs a "pin ls --type typeFilter" request against the configured
 // IPFS daemon and returns a map of cid strings and their status.
 func (ipfs *Connector) PinLs(ctx context.Context, typeFilter string) (map[string]api.IPFSPinStatus, error) {
@@ -538,8 +837,11 @@ func (ipfs *Connector) PinLsCid(ctx context.Context, pin *api.Pin) (api.IPFSPinS
 	defer cancel()
 
 	pinType := pin.MaxDepth.ToPinMode().String()
+	if selectivePin(pin) {
+		pinType = api.PinModeDirect.String()
+	}
 	lsPath := fmt.Sprintf("pin/ls?arg=%s&type=%s", pin.Cid, pinType)
-	body, err := ipfs.postCtx(ctx, lsPath, "", nil)
+	body, err := ipfs.postCidCtx(ctx, pin.Cid, lsPath, "", nil)
 	if body == nil && err != nil { // Network error, daemon down
 		return api.IPFSPinStatusError, err
 	}
@@ -568,8 +870,48 @@ func (ipfs *Connector) PinLsCid(ctx context.Context, pin *api.Pin) (api.IPFSPinS
 	return api.IPFSPinStatusError, errors.New("expected to find the pin in the response")
 }
 
-func (ipfs *Connector) doPostCtx(ctx context.Context, client *http.Client, apiURL, path string, contentType string, postBody io.Reader) (*http.Response, error) {
+// doPostCtx makes a POST request against the IPFS daemons, in the order given
+// by apiURLs. Requests without a body are sent to the next daemon when one
+// cannot be reached or responds with a server error.
+func (ipfs *Connector) doPostCtx(ctx context.Context, path string, contentType string, postBody io.Reader) (*http.Response, error) {
+	return ipfs.doPostCidCtx(ctx, cid.Undef, path, contentType, postBody)
+}
+
+// doPostCidCtx is like doPostCtx for requests about the given CID, which are
+// sent first to the daemon that handles it (see apiURLs).
+func (ipfs *Connector) doPostCidCtx(ctx context.Context, c cid.Cid, path string, contentType string, postBody io.Reader) (*http.Response, error) {
 	logger.Debugf("posting %s", path)
+	if err := ipfs.breaker.allow(ctx); err != nil {
+		return nil, err
+	}
+
+	var res *http.Response
+	var err error
+	urls := ipfs.apiURLs(c)
+	for i, apiURL := range urls {
+		res, err = ipfs.postURL(ctx, apiURL, path, contentType, postBody)
+		last := i == len(urls)-1 || postBody != nil
+		if last || ctx.Err() != nil {
+			break
+		}
+		if err == nil {
+			if res.StatusCode < http.StatusInternalServerError {
+				break
+			}
+			res.Body.Close()
+		}
+		logger.Warnf("request to %s failed: trying the next IPFS daemon", apiURL)
+	}
+
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		ipfs.breaker.cancel(ctx)
+	} else {
+		ipfs.breaker.done(ctx, err)
+	}
+	return res, err
+}
+
+func (ipfs *Connector) postURL(ctx context.Context, apiURL, path string, contentType string, postBody io.Reader) (*http.Response, error) {
 	urlstr := fmt.Sprintf("%s/%s", apiURL, path)
 
 	req, err := http.NewRequest("POST", urlstr, postBody)
@@ -616,7 +958,12 @@ func checkResponse(path string, res *http.Response) ([]byte, error) {
 // the ipfs daemon, reads the full body of the response and
 // returns it after checking for errors.
 func (ipfs *Connector) postCtx(ctx context.Context, path string, contentType string, postBody io.Reader) ([]byte, error) {
-	res, err := ipfs.doPostCtx(ctx, ipfs.client, ipfs.apiURL(), path, contentType, postBody)
+	return ipfs.postCidCtx(ctx, cid.Undef, path, contentType, postBody)
+}
+
+// postCidCtx is like postCtx for requests about the given CID.
+func (ipfs *Connector) postCidCtx(ctx context.Context, c cid.Cid, path string, contentType string, postBody io.Reader) ([]byte, error) {
+	res, err := ipfs.doPostCidCtx(ctx, c, path, contentType, postBody)
 	if err != nil {
 		return nil, err
 	}
@@ -635,10 +982,39 @@ func (ipfs *Connector) postCtx(ctx context.Context, path string, contentType str
 	return body, nil
 }
 
-// apiURL is a short-hand for building the url of the IPFS
-// daemon API.
-func (ipfs *Connector) apiURL() string {
-	return fmt.Sprintf("http://%s/api/v0", ipfs.nodeAddr)
+// apiURLs returns the urls of the IPFS daemons API in the order in which
+// requests about the given CID, or about none when undefined, should try
+// them.
+func (ipfs *Connector) apiURLs(c cid.Cid) []string {
+	first := ipfs.cidNode(c)
+	if first < 0 {
+		n := atomic.AddUint64(&ipfs.nextNode, 1) - 1
+		first = int(n % uint64(len(ipfs.nodeAddrs)))
+	}
+
+	urls := make([]string, 0, len(ipfs.nodeAddrs))
+	for i := range ipfs.nodeAddrs {
+		addr := ipfs.nodeAddrs[(first+i)%len(ipfs.nodeAddrs)]
+		urls = append(urls, fmt.Sprintf("http://%s/api/v0", addr))
+	}
+	return urls
+}
+
+// cidNode returns the index in nodeAddrs of the daemon which handles the
+// given CID. With NodeSelectionRoundRobin, it is chosen by the hash of the
+// CID, so that all the requests about it reach the same daemon while it
+// works. It returns -1 for an undefined CID, and 0 with
+// NodeSelectionFailover.
+func (ipfs *Connector) cidNode(c cid.Cid) int {
+	if ipfs.config.NodeSelection != NodeSelectionRoundRobin {
+		return 0
+	}
+	if !c.Defined() {
+		return -1
+	}
+	h := fnv.New32a()
+	h.Write(c.Hash())
+	return int(h.Sum32() % uint32(len(ipfs.nodeAddrs)))
 }
 
 // ConnectSwarms requests the ipfs addresses of other peers and
@@ -764,7 +1140,7 @@ func (ipfs *Connector) RepoGC(ctx context.Context) (*api.RepoGC, error) {
 	ctx, cancel := context.WithTimeout(ctx, ipfs.config.RepoGCTimeout)
 	defer cancel()
 
-	res, err := ipfs.doPostCtx(ctx, ipfs.client, ipfs.apiURL(), "repo/gc?stream-errors=true", "", nil)
+	res, err := ipfs.doPostCtx(ctx, "repo/gc?stream-errors=true", "", nil)
 	if err != nil {
 		logger.Error(err)
 		return nil, err
@@ -831,6 +1207,29 @@ func (ipfs *Connector) Resolve(ctx context.Context, path string) (cid.Cid, error
 	return ci, err
 }
 
+// ResolveMFS returns the CID of the given MFS path, as reported by "files
+// stat".
+func (ipfs *Connector) ResolveMFS(ctx context.Context, path string) (cid.Cid, error) {
+	ctx, span := trace.StartSpan(ctx, "ipfsconn/ipfshttp/ResolveMFS")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, ipfs.config.IPFSRequestTimeout)
+	defer cancel()
+	res, err := ipfs.postCtx(ctx, "files/stat?arg="+url.QueryEscape(path), "", nil)
+	if err != nil {
+		logger.Error(err)
+		return cid.Undef, err
+	}
+
+	var stat ipfsFilesStatResp
+	err = json.Unmarshal(res, &stat)
+	if err != nil {
+		logger.Error("could not unmarshal response: " + err.Error())
+		return cid.Undef, err
+	}
+	return cid.Decode(stat.Hash)
+}
+
 // SwarmPeers returns the peers currently connected to this ipfs daemon.
 func (ipfs *Connector) SwarmPeers(ctx context.Context) ([]peer.ID, error) {
 	ctx, span := trace.StartSpan(ctx, "ipfsconn/ipfshttp/SwarmPeers")
@@ -943,7 +1342,256 @@ func (ipfs *Connector) BlockGet(ctx context.Context, c cid.Cid) ([]byte, error)
 	ctx, cancel := context.WithTimeout(ctx, ipfs.config.IPFSRequestTimeout)
 	defer cancel()
 	url := "block/get?arg=" + c.String()
-	return ipfs.postCtx(ctx, url, "", nil)
+	return ipfs.postCidCtx(ctx, c, url, "", nil)
+}
+
+// BlockHas returns whether the IPFS daemon has the given block in its
+// local repository. The lookup is performed offline, so it never triggers
+// a network fetch.
+func (ipfs *Connector) BlockHas(ctx context.Context, c cid.Cid) (bool, error) {
+	ctx, span := trace.StartSpan(ctx, "ipfsconn/ipfshttp/BlockHas")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, ipfs.config.IPFSRequestTimeout)
+	defer cancel()
+	url := "block/stat?offline=true&arg=" + c.String()
+	_, err := ipfs.postCidCtx(ctx, c, url, "", nil)
+	if err != nil {
+		if ipfsErr, ok := err.(ipfsError); ok && strings.Contains(ipfsErr.Message, "not found") {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Provide announces to the DHT that the IPFS daemon provides the given CID
+// and every block under it, as "dht/provide --recursive" does.
+func (ipfs *Connector) Provide(ctx context.Context, c cid.Cid) error {
+	ctx, span := trace.StartSpan(ctx, "ipfsconn/ipfshttp/Provide")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, ipfs.config.IPFSRequestTimeout)
+	defer cancel()
+	_, err := ipfs.postCtx(ctx, "dht/provide?recursive=true&arg="+c.String(), "", nil)
+	return err
+}
+
+// FindProviders runs "dht/findprovs" for the given CID and returns up to n
+// providers other than the IPFS daemon itself. The query is bounded by
+// IPFSRequestTimeout: the providers found until then are returned.
+func (ipfs *Connector) FindProviders(ctx context.Context, c cid.Cid, n int) ([]peer.ID, error) {
+	ctx, span := trace.StartSpan(ctx, "ipfsconn/ipfshttp/FindProviders")
+	defer span.End()
+
+	self, err := ipfs.ID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ipfs.config.IPFSRequestTimeout)
+	defer cancel()
+
+	// The daemon may find itself, so ask for one more.
+	path := fmt.Sprintf("dht/findprovs?num-providers=%d&arg=%s", n+1, c)
+	res, err := ipfs.doPostCtx(ctx, path, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	_, err = checkResponse(path, res)
+	if err != nil {
+		return nil, err
+	}
+
+	providers := []peer.ID{}
+	seen := map[peer.ID]struct{}{self.ID: {}}
+	dec := json.NewDecoder(res.Body)
+	for len(providers) < n {
+		var ev ipfsRoutingResp
+		if err := dec.Decode(&ev); err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				break
+			}
+			return nil, err
+		}
+		if ev.Type != routingProvider {
+			continue
+		}
+		for _, r := range ev.Responses {
+			p, err := peer.Decode(r.ID)
+			if err != nil {
+				continue
+			}
+			if _, ok := seen[p]; ok {
+				continue
+			}
+			seen[p] = struct{}{}
+			providers = append(providers, p)
+		}
+	}
+	if len(providers) > n {
+		providers = providers[:n]
+	}
+	return providers, nil
+}
+
+// MissingRefs walks "refs -r" offline from the given CID and returns the
+// first block under it which the IPFS daemon does not have. IPFS aborts the
+// whole walk at the first missing block, so at most one is returned and
+// others may be missing too. The walk is bounded by RefsTimeout.
+func (ipfs *Connector) MissingRefs(ctx context.Context, c cid.Cid) ([]cid.Cid, error) {
+	ctx, span := trace.StartSpan(ctx, "ipfsconn/ipfshttp/MissingRefs")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, ipfs.config.RefsTimeout)
+	defer cancel()
+
+	path := "refs?offline=true&recursive=true&unique=true&arg=" + c.String()
+	res, err := ipfs.doPostCidCtx(ctx, c, path, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	_, err = checkResponse(path, res)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := []cid.Cid{}
+	dec := json.NewDecoder(res.Body)
+	for {
+		var ref ipfsRefsResp
+		if err := dec.Decode(&ref); err != nil {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			default:
+				if err == io.EOF {
+					return missing, nil
+				}
+				return nil, err
+			}
+		}
+		if ref.Err == "" {
+			continue
+		}
+		mc, ok := missingRef(ref.Err)
+		if !ok {
+			return nil, fmt.Errorf("refs: %s", ref.Err)
+		}
+		return append(missing, mc), nil
+	}
+}
+
+// missingRef extracts the CID of the missing block from a "refs" error, as
+// in "block was not found locally (offline): ipld: could not find <cid>".
+func missingRef(msg string) (cid.Cid, bool) {
+	if !strings.Contains(msg, "not found") && !strings.Contains(msg, "could not find") {
+		return cid.Undef, false
+	}
+	fields := strings.Fields(msg)
+	for i := len(fields) - 1; i >= 0; i-- {
+		if c, err := cid.Decode(strings.Trim(fields[i], `"():,`)); err == nil {
+			return c, true
+		}
+	}
+	return cid.Undef, false
+}
+
+// DAGSize returns the cumulative size of the DAG under the given CID, as
+// reported by "files stat". For dag-pb items, only the root block is needed
+// to tell. The lookup is performed offline, so it fails when the daemon does
+// not have it.
+func (ipfs *Connector) DAGSize(ctx context.Context, c cid.Cid) (uint64, error) {
+	ctx, span := trace.StartSpan(ctx, "ipfsconn/ipfshttp/DAGSize")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, ipfs.config.IPFSRequestTimeout)
+	defer cancel()
+	res, err := ipfs.postCidCtx(ctx, c, "files/stat?offline=true&arg=/ipfs/"+c.String(), "", nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var stat ipfsFilesStatResp
+	err = json.Unmarshal(res, &stat)
+	if err != nil {
+		return 0, err
+	}
+	return stat.CumulativeSize, nil
+}
+
+// SupportsCodec returns whether the IPFS daemon supports the given IPLD
+// codec, as reported by "cid codecs --supported". The list is fetched once.
+// Daemons which cannot provide it are assumed to support every codec.
+func (ipfs *Connector) SupportsCodec(ctx context.Context, codec uint64) (bool, error) {
+	ctx, span := trace.StartSpan(ctx, "ipfsconn/ipfshttp/SupportsCodec")
+	defer span.End()
+
+	ipfs.codecsMux.Lock()
+	defer ipfs.codecsMux.Unlock()
+
+	if !ipfs.codecsFetched {
+		codecs, err := ipfs.supportedCodecs(ctx)
+		if err != nil {
+			return false, err
+		}
+		ipfs.codecs = codecs
+		ipfs.codecsFetched = true
+	}
+
+	if ipfs.codecs == nil {
+		return true, nil
+	}
+	_, ok := ipfs.codecs[codec]
+	return ok, nil
+}
+
+func (ipfs *Connector) supportedCodecs(ctx context.Context) (map[uint64]struct{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, ipfs.config.IPFSRequestTimeout)
+	defer cancel()
+
+	body, err := ipfs.postCtx(ctx, "cid/codecs?supported=true", "", nil)
+	if err != nil {
+		if _, ok := err.(ipfsError); ok {
+			// An older daemon. Assume anything goes.
+			logger.Debugf("cannot list the codecs supported by IPFS: %s", err)
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var res []ipfsCodec
+	err = json.Unmarshal(body, &res)
+	if err != nil {
+		logger.Error("parsing cid/codecs response")
+		logger.Error(string(body))
+		return nil, err
+	}
+
+	codecs := make(map[uint64]struct{}, len(res))
+	for _, c := range res {
+		codecs[c.Code] = struct{}{}
+	}
+	return codecs, nil
+}
+
+// outOfSpace returns true for errors reporting that the IPFS repository is
+// full.
+func outOfSpace(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "no space left on device") ||
+		strings.Contains(msg, "storage limit")
+}
+
+func codecName(codec uint64) string {
+	if name, ok := cid.CodecToStr[codec]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%x", codec)
 }
 
 // // FetchRefs asks IPFS to download blocks recursively to the given depth.
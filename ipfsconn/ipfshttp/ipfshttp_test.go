@@ -3,11 +3,18 @@ package ipfshttp
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	cid "github.com/ipfs/go-cid"
 	logging "github.com/ipfs/go-log/v2"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
 	ma "github.com/multiformats/go-multiaddr"
 
 	merkledag "github.com/ipfs/go-merkledag"
@@ -100,8 +107,107 @@ func TestPin(t *testing.T) {
 	ipfs.config.PinTimeout = 5 * time.Second
 	c4 := test.SlowCid1
 	err = ipfs.Pin(ctx, api.PinCid(c4))
-	if err == nil {
-		t.Error("expected error pinning cid")
+	if !errors.Is(err, api.ErrTimeout) {
+		t.Error("expected a timeout error pinning cid:", err)
+	}
+
+	gitCid := cid.NewCidV1(cid.GitRaw, test.Cid1.Hash())
+	err = ipfs.Pin(ctx, api.PinCid(gitCid))
+	if !errors.Is(err, ErrUnsupportedCodec) {
+		t.Error("expected an unsupported codec error:", err)
+	}
+}
+
+func TestPinMaxDepth(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown(ctx)
+
+	pin := api.PinWithOpts(test.Cid1, api.PinOptions{MaxDepth: 2})
+	err := ipfs.Pin(ctx, pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	depth, err := mock.PinDepth(test.Cid1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth != 2 {
+		t.Errorf("expected ipfs to receive max-depth 2; got %d", depth)
+	}
+
+	pinSt, err := ipfs.PinLsCid(ctx, pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pinSt.IsPinned(pin.MaxDepth) {
+		t.Error("cid should have been pinned with a max-depth")
+	}
+}
+
+// progressTracker records the pin progress reports.
+type progressTracker struct {
+	mu      sync.Mutex
+	reports []int
+}
+
+func (pt *progressTracker) SetPinProgress(ctx context.Context, in *api.PinProgress, out *struct{}) error {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	if !in.Cid.Equals(test.ProgressCid) {
+		return errors.New("unexpected cid")
+	}
+	pt.reports = append(pt.reports, in.Blocks)
+	return nil
+}
+
+func TestPinProgress(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown(ctx)
+
+	pt := &progressTracker{}
+	s := rpc.NewServer(nil, "mock")
+	if err := s.RegisterName("PinTracker", pt); err != nil {
+		t.Fatal(err)
+	}
+	ipfs.SetClient(rpc.NewClientWithServer(nil, "mock", s))
+	defer func(interval time.Duration) { pinProgressReportInterval = interval }(pinProgressReportInterval)
+	pinProgressReportInterval = 10 * time.Millisecond
+
+	if err := ipfs.Pin(ctx, api.PinCid(test.ProgressCid)); err != nil {
+		t.Fatal(err)
+	}
+
+	reports := func() []int {
+		pt.mu.Lock()
+		defer pt.mu.Unlock()
+		return append([]int{}, pt.reports...)
+	}
+
+	max := 0
+	for _, r := range reports() {
+		if r > max {
+			max = r
+		}
+	}
+	if max != 5 {
+		t.Errorf("expected 5 blocks to be reported; got %v", reports())
+	}
+
+	// No progress is reported when the daemon does not stream it.
+	pt.mu.Lock()
+	pt.reports = nil
+	pt.mu.Unlock()
+	if err := ipfs.Pin(ctx, api.PinCid(test.Cid1)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if r := reports(); len(r) != 0 {
+		t.Errorf("expected no progress reports; got %v", r)
 	}
 }
 
@@ -139,18 +245,77 @@ func TestPinUpdate(t *testing.T) {
 	}
 }
 
+func TestPinExcludeLinks(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown(ctx)
+
+	pin := api.PinCid(test.Cid1)
+	pin.ExcludeLinks = []string{"thumbs"}
+	err := ipfs.Pin(ctx, pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pinSt, err := ipfs.PinLsCid(ctx, pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pinSt != api.IPFSPinStatusDirect {
+		t.Error("the root should have been pinned directly")
+	}
+
+	pinSt, _ = ipfs.PinLsCid(ctx, api.PinCid(test.Cid5))
+	if !pinSt.IsPinned(-1) {
+		t.Error("included link should have been pinned recursively")
+	}
+
+	for _, c := range []cid.Cid{test.Cid3, test.NotFoundCid} {
+		pinSt, _ = ipfs.PinLsCid(ctx, api.PinCid(c))
+		if !pinSt.IsPinned(-1) {
+			t.Error("unnamed link should have been pinned recursively:", c)
+		}
+	}
+
+	pinSt, _ = ipfs.PinLsCid(ctx, api.PinCid(test.CidResolved))
+	if pinSt != api.IPFSPinStatusUnpinned {
+		t.Error("excluded link should not have been pinned")
+	}
+
+	// The excluded link is pinned on its own, outside of the pin.
+	err = ipfs.Pin(ctx, api.PinCid(test.CidResolved))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ipfs.Unpin(ctx, pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pinSt, _ = ipfs.PinLsCid(ctx, api.PinCid(test.Cid5))
+	if pinSt != api.IPFSPinStatusUnpinned {
+		t.Error("included link should have been unpinned")
+	}
+	pinSt, _ = ipfs.PinLsCid(ctx, api.PinCid(test.CidResolved))
+	if !pinSt.IsPinned(-1) {
+		t.Error("excluded link pinned on its own should have been left pinned")
+	}
+}
+
 func TestIPFSUnpin(t *testing.T) {
 	ctx := context.Background()
 	ipfs, mock := testIPFSConnector(t)
 	defer mock.Close()
 	defer ipfs.Shutdown(ctx)
 	c := test.Cid1
-	err := ipfs.Unpin(ctx, c)
+	err := ipfs.Unpin(ctx, api.PinCid(c))
 	if err != nil {
 		t.Error("expected success unpinning non-pinned cid")
 	}
 	ipfs.Pin(ctx, api.PinCid(c))
-	err = ipfs.Unpin(ctx, c)
+	err = ipfs.Unpin(ctx, api.PinCid(c))
 	if err != nil {
 		t.Error("expected success unpinning pinned cid")
 	}
@@ -167,7 +332,7 @@ func TestIPFSUnpinDisabled(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = ipfs.Unpin(ctx, test.Cid1)
+	err = ipfs.Unpin(ctx, api.PinCid(test.Cid1))
 	if err == nil {
 		t.Fatal("pin should be disabled")
 	}
@@ -312,6 +477,127 @@ func TestBlockPut(t *testing.T) {
 	}
 }
 
+func TestProvide(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown(ctx)
+
+	err := ipfs.Pin(ctx, api.PinCid(test.Cid1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ipfs.Provide(ctx, test.Cid1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = ipfs.Provide(ctx, test.Cid2)
+	if err == nil {
+		t.Error("expected an error providing a cid the daemon does not have")
+	}
+}
+
+func TestDAGSize(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown(ctx)
+
+	size, err := ipfs.DAGSize(ctx, test.Cid1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 1000 {
+		t.Errorf("unexpected size: %d", size)
+	}
+
+	size, err = ipfs.DAGSize(ctx, test.HugeCid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 20000000000 {
+		t.Errorf("unexpected size: %d", size)
+	}
+}
+
+func TestMissingRefs(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown(ctx)
+
+	missing, err := ipfs.MissingRefs(ctx, test.Cid1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 0 {
+		t.Error("expected no missing blocks:", missing)
+	}
+
+	missing, err = ipfs.MissingRefs(ctx, test.DegradedCid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 1 || !missing[0].Equals(test.Cid2) {
+		t.Error("expected Cid2 to be missing:", missing)
+	}
+}
+
+func TestFindProviders(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown(ctx)
+
+	providers, err := ipfs.FindProviders(ctx, test.Cid1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(providers) != 1 || providers[0] != test.PeerID2 {
+		t.Error("expected one provider other than the daemon:", providers)
+	}
+
+	providers, err = ipfs.FindProviders(ctx, test.DegradedCid, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(providers) != 0 {
+		t.Error("the daemon should not count as a provider:", providers)
+	}
+}
+
+func TestBlockHas(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown(ctx)
+
+	has, err := ipfs.BlockHas(ctx, test.Cid4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has {
+		t.Error("should not have the block before putting it")
+	}
+
+	err = ipfs.BlockPut(ctx, &api.NodeWithMeta{
+		Data: []byte(test.Cid4Data),
+		Cid:  test.Cid4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	has, err = ipfs.BlockHas(ctx, test.Cid4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !has {
+		t.Error("should have the block after putting it")
+	}
+}
+
 func TestBlockGet(t *testing.T) {
 	ctx := context.Background()
 	ipfs, mock := testIPFSConnector(t)
@@ -388,6 +674,21 @@ func TestResolve(t *testing.T) {
 	}
 }
 
+func TestResolveMFS(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer mock.Close()
+	defer ipfs.Shutdown(ctx)
+
+	c, err := ipfs.ResolveMFS(ctx, api.MFSPath(test.PathMFS1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Equals(test.CidMFS) {
+		t.Errorf("expected %s, found %s", test.CidMFS, c)
+	}
+}
+
 func TestConfigKey(t *testing.T) {
 	ctx := context.Background()
 	ipfs, mock := testIPFSConnector(t)
@@ -461,3 +762,117 @@ func TestRepoGC(t *testing.T) {
 		t.Errorf("expected different error, expected: %s, found: %s\n", merkledag.ErrLinkNotFound, res.Keys[4].Error)
 	}
 }
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	ipfs, mock := testIPFSConnector(t)
+	defer ipfs.Shutdown(ctx)
+	ipfs.breaker = newBreaker(2, 300*time.Millisecond)
+
+	mock.Close()
+	for i := 0; i < 2; i++ {
+		_, err := ipfs.ID(ctx)
+		if err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expected a request error; got %v", err)
+		}
+	}
+
+	_, err := ipfs.ID(ctx)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected requests to fail fast; got %v", err)
+	}
+
+	// Bring the daemon back. The next request after the cooldown probes
+	// it and closes the breaker.
+	mock = test.NewIpfsMock(t)
+	defer mock.Close()
+	ipfs.nodeAddrs = []string{fmt.Sprintf("%s:%d", mock.Addr, mock.Port)}
+
+	time.Sleep(400 * time.Millisecond)
+	if _, err := ipfs.ID(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ipfs.breaker.state != breakerClosed {
+		t.Error("expected the breaker to close after a successful probe")
+	}
+	if _, err := ipfs.ID(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNodeFailover(t *testing.T) {
+	ctx := context.Background()
+	mock := test.NewIpfsMock(t)
+	defer mock.Close()
+
+	// The primary daemon answers every request with an error.
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"Message": "broken daemon", "Code": 0}`))
+	}))
+	defer primary.Close()
+
+	cfg := &Config{}
+	cfg.Default()
+	cfg.NodeAddrs = []ma.Multiaddr{
+		ma.StringCast("/ip4/127.0.0.1/tcp/" + primary.URL[strings.LastIndex(primary.URL, ":")+1:]),
+		ma.StringCast(fmt.Sprintf("/ip4/%s/tcp/%d", mock.Addr, mock.Port)),
+	}
+	cfg.ConnectSwarmsDelay = 0
+	ipfs, err := NewConnector(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipfs.SetClient(test.NewMockRPCClient(t))
+	defer ipfs.Shutdown(ctx)
+
+	pin := api.PinCid(test.Cid1)
+	if err := ipfs.Pin(ctx, pin); err != nil {
+		t.Fatal("expected the pin to fail over to the second daemon:", err)
+	}
+	st, err := ipfs.PinLsCid(ctx, pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.IsPinned(-1) {
+		t.Error("cid should have been pinned")
+	}
+
+	// Errors from the last daemon are returned.
+	mock.Close()
+	if _, err := ipfs.ID(ctx); err == nil {
+		t.Error("expected an error when no daemon works")
+	}
+}
+
+func TestNodeRoundRobin(t *testing.T) {
+	ipfs := &Connector{
+		config:    &Config{NodeSelection: NodeSelectionRoundRobin},
+		nodeAddrs: []string{"a:1", "b:2", "c:3"},
+	}
+
+	for i, first := range []string{"a:1", "b:2", "c:3", "a:1"} {
+		urls := ipfs.apiURLs(cid.Undef)
+		if len(urls) != 3 {
+			t.Fatalf("expected all daemons to be tried; got %v", urls)
+		}
+		if !strings.Contains(urls[0], first) {
+			t.Errorf("request %d: expected %s to go first; got %v", i, first, urls)
+		}
+	}
+
+	// Requests about a CID always go first to the same daemon.
+	first := ipfs.apiURLs(test.Cid1)[0]
+	for i := 0; i < 3; i++ {
+		if urls := ipfs.apiURLs(test.Cid1); urls[0] != first || len(urls) != 3 {
+			t.Errorf("expected %s to go first for the cid; got %v", first, urls)
+		}
+	}
+
+	ipfs.config.NodeSelection = NodeSelectionFailover
+	for _, c := range []cid.Cid{cid.Undef, test.Cid1, test.Cid2} {
+		if urls := ipfs.apiURLs(c); !strings.Contains(urls[0], "a:1") {
+			t.Errorf("expected the primary to go first; got %v", urls)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package ipfscluster
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state"
+
+	cid "github.com/ipfs/go-cid"
+	"go.opencensus.io/trace"
+)
+
+// ipnsName returns the given path when it is an /ipns/ path, or an empty
+// string otherwise.
+func ipnsName(path string) string {
+	if strings.HasPrefix(path, "/ipns/") {
+		return path
+	}
+	return ""
+}
+
+// watchIPNS re-resolves, every IPNSResolveInterval, the IPNS names of the
+// pins made from them.
+func (c *Cluster) watchIPNS() {
+	interval := c.config.IPNSResolveInterval
+	if interval <= 0 || c.followerMode() {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			if c.InMaintenance() {
+				logger.Debug("maintenance mode: skipping IPNS re-resolution")
+				continue
+			}
+			c.resolveIPNS(c.ctx)
+		}
+	}
+}
+
+// resolveIPNS re-resolves the IPNS names of the pins for which this peer is
+// the closest among the trusted peers, so that every name is followed by a
+// single peer.
+func (c *Cluster) resolveIPNS(ctx context.Context) {
+	ctx, span := trace.StartSpan(ctx, "cluster/resolveIPNS")
+	defer span.End()
+
+	cState, err := c.consensus.State(ctx)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	pins, err := cState.List(ctx)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	distance, err := c.distances(ctx, "")
+	if err != nil {
+		return
+	}
+
+	for _, p := range pins {
+		if ctx.Err() != nil {
+			return
+		}
+		if p.IPNSName == "" || !distance.isClosest(p.Cid) {
+			continue
+		}
+		err := c.resolveIPNSPin(ctx, cState, p)
+		if err != nil {
+			logger.Errorf("error following %s: %s", p.IPNSName, err)
+		}
+	}
+}
+
+// resolveIPNSPin resolves the IPNS name of the given pin and moves the pin
+// to the CID it points to (see followPin).
+func (c *Cluster) resolveIPNSPin(ctx context.Context, cState state.ReadOnly, pin *api.Pin) error {
+	ci, err := c.ipfs.Resolve(ctx, pin.IPNSName)
+	if err != nil {
+		return err
+	}
+	return c.followPin(ctx, cState, pin, pin.IPNSName, ci)
+}
+
+// followPin handles the given pin, made from the given IPNS name or MFS path,
+// now resolving to the given CID. When it is a new CID, it pins the new CID
+// with the options and allocations of the given pin. When the new CID is
+// pinned already, it only records the name or path in that pin.
+//
+// The given pin is only unpinned once the new CID is pinned on all its
+// allocations, so that the content is not lost when the new CID cannot be
+// fetched. Until then, the given pin keeps the name or path and every
+// re-resolution checks again.
+func (c *Cluster) followPin(ctx context.Context, cState state.ReadOnly, pin *api.Pin, from string, ci cid.Cid) error {
+	if ci.Equals(pin.Cid) {
+		return nil
+	}
+
+	logger.Infof("%s now points to %s (was %s)", from, ci, pin.Cid)
+	newPin, err := cState.Get(ctx, ci)
+	switch err {
+	case nil:
+		if newPin.IPNSName == pin.IPNSName &&
+			newPin.MFSPath == pin.MFSPath &&
+			newPin.MFSPeer == pin.MFSPeer {
+			break // followed already, waiting for it to be pinned
+		}
+		newPin.IPNSName = pin.IPNSName
+		newPin.MFSPath = pin.MFSPath
+		newPin.MFSPeer = pin.MFSPeer
+		newPin.Timestamp = time.Now()
+		err = c.consensus.LogPin(ctx, newPin)
+	case state.ErrNotFound:
+		// Like PinUpdate, so that the peers only fetch what changed.
+		updated := *pin
+		newPin = &updated
+		newPin.Cid = ci
+		newPin.PinUpdate = pin.Cid
+		newPin.CreatedAt = time.Now()
+		newPin.Timestamp = time.Now()
+		err = c.consensus.LogPin(ctx, newPin)
+	}
+	if err != nil {
+		return err
+	}
+
+	gpi, err := c.Status(ctx, ci)
+	if err != nil {
+		return err
+	}
+	if rpl := gpi.Replication(newPin.Allocations); !rpl.Complete() {
+		logger.Infof("%s: keeping %s until %s is pinned (%s)", from, pin.Cid, ci, rpl)
+		return nil
+	}
+	// The old CID no longer follows the name or path.
+	_, err = c.Unpin(ctx, pin.Cid)
+	return err
+}
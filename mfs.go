@@ -0,0 +1,97 @@
+package ipfscluster
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"go.opencensus.io/trace"
+)
+
+// pinMFS pins the CID of the given path in the MFS of our IPFS daemon. The
+// pin remembers the path and this peer, which is the only one able to follow
+// it (see watchMFS).
+func (c *Cluster) pinMFS(ctx context.Context, mfsPath string, opts api.PinOptions) (*api.Pin, error) {
+	ci, err := c.ipfs.ResolveMFS(ctx, mfsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pin := api.PinWithOpts(ci, opts)
+	pin.MFSPath = mfsPath
+	pin.MFSPeer = c.id
+	result, changed, err := c.pin(ctx, pin, []peer.ID{})
+	if err == nil && changed {
+		c.watchCommit(result)
+	}
+	return result, err
+}
+
+// watchMFS re-resolves, every MFSResolveInterval, the MFS paths of the pins
+// made from them by this peer.
+func (c *Cluster) watchMFS() {
+	interval := c.config.MFSResolveInterval
+	if interval <= 0 || c.followerMode() {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			if c.InMaintenance() {
+				logger.Debug("maintenance mode: skipping MFS re-resolution")
+				continue
+			}
+			c.resolveMFS(c.ctx)
+		}
+	}
+}
+
+// resolveMFS re-resolves the MFS paths of the pins made from them by this
+// peer, as other peers cannot see the MFS of our IPFS daemon.
+func (c *Cluster) resolveMFS(ctx context.Context) {
+	ctx, span := trace.StartSpan(ctx, "cluster/resolveMFS")
+	defer span.End()
+
+	cState, err := c.consensus.State(ctx)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	pins, err := cState.List(ctx)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	for _, p := range pins {
+		if ctx.Err() != nil {
+			return
+		}
+		if p.MFSPath == "" || p.MFSPeer != c.id {
+			continue
+		}
+		err := c.resolveMFSPin(ctx, cState, p)
+		if err != nil {
+			logger.Errorf("error following MFS path %s: %s", p.MFSPath, err)
+		}
+	}
+}
+
+// resolveMFSPin resolves the MFS path of the given pin and moves the pin to
+// the CID it points to (see followPin).
+func (c *Cluster) resolveMFSPin(ctx context.Context, cState state.ReadOnly, pin *api.Pin) error {
+	ci, err := c.ipfs.ResolveMFS(ctx, pin.MFSPath)
+	if err != nil {
+		return err
+	}
+	return c.followPin(ctx, cState, pin, "MFS path "+pin.MFSPath, ci)
+}
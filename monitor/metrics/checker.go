@@ -40,6 +40,13 @@ type Checker struct {
 
 	failedPeersMu sync.Mutex
 	failedPeers   map[peer.ID]map[string]int
+	// alerted keeps the metrics which triggered an alert until they
+	// recover.
+	alerted map[peer.ID]map[string]struct{}
+	// misses counts the consecutive checks which found each metric
+	// failed, until a fresh one is received.
+	misses         map[peer.ID]map[string]int
+	alertThreshold int
 }
 
 // NewChecker creates a Checker using the given
@@ -50,25 +57,75 @@ type Checker struct {
 // A value between 2.0 and 4.0 is suggested for the threshold.
 func NewChecker(ctx context.Context, metrics *Store, threshold float64) *Checker {
 	return &Checker{
-		ctx:         ctx,
-		alertCh:     make(chan *api.Alert, AlertChannelCap),
-		metrics:     metrics,
-		threshold:   threshold,
-		failedPeers: make(map[peer.ID]map[string]int),
+		ctx:            ctx,
+		alertCh:        make(chan *api.Alert, AlertChannelCap),
+		metrics:        metrics,
+		threshold:      threshold,
+		failedPeers:    make(map[peer.ID]map[string]int),
+		alerted:        make(map[peer.ID]map[string]struct{}),
+		misses:         make(map[peer.ID]map[string]int),
+		alertThreshold: 1,
 	}
 }
 
-// CheckPeers will trigger alerts based on the latest metrics from the given peerset
-// when they have expired and no alert has been sent before.
+// SetAlertThreshold sets how many consecutive checks (CheckPeers or
+// CheckAll) must find a metric failed before alerting about it, so that
+// brief absences do not cause alerts. The count restarts with every fresh
+// metric (see Recovered). The default, 1, alerts on the first check.
+func (mc *Checker) SetAlertThreshold(n int) {
+	if n < 1 {
+		n = 1
+	}
+	mc.failedPeersMu.Lock()
+	defer mc.failedPeersMu.Unlock()
+	mc.alertThreshold = n
+}
+
+// missed counts a check which found the given metric failed and returns
+// whether AlertThreshold consecutive checks did.
+func (mc *Checker) missed(pid peer.ID, metricName string) bool {
+	mc.failedPeersMu.Lock()
+	defer mc.failedPeersMu.Unlock()
+
+	if _, ok := mc.misses[pid]; !ok {
+		mc.misses[pid] = make(map[string]int)
+	}
+	mc.misses[pid][metricName]++
+	return mc.misses[pid][metricName] >= mc.alertThreshold
+}
+
+// belowAlertThreshold returns whether fewer than AlertThreshold consecutive
+// checks found the given metric failed.
+func (mc *Checker) belowAlertThreshold(pid peer.ID, metricName string) bool {
+	mc.failedPeersMu.Lock()
+	defer mc.failedPeersMu.Unlock()
+
+	return mc.alertThreshold > 1 && mc.misses[pid][metricName] < mc.alertThreshold
+}
+
+// clearMisses forgets the checks which found the given metric failed.
+// failedPeersMu must be held.
+func (mc *Checker) clearMisses(pid peer.ID, metricName string) {
+	delete(mc.misses[pid], metricName)
+	if len(mc.misses[pid]) == 0 {
+		delete(mc.misses, pid)
+	}
+}
+
+// CheckPeers will trigger alerts based on the latest metrics from the given
+// peerset when they have expired in AlertThreshold consecutive checks and no
+// alert has been sent before.
 func (mc *Checker) CheckPeers(peers []peer.ID) error {
 	for _, name := range mc.metrics.MetricNames() {
 		for _, peer := range peers {
-			for _, metric := range mc.metrics.PeerMetricAll(name, peer) {
-				if mc.FailedMetric(metric.Name, peer) {
-					err := mc.alert(peer, metric.Name)
-					if err != nil {
-						return err
-					}
+			metrics := mc.metrics.PeerMetricAll(name, peer)
+			if len(metrics) == 0 || !mc.FailedMetric(name, peer) || !mc.missed(peer, name) {
+				continue
+			}
+			for _, metric := range metrics {
+				_, err := mc.alert(peer, metric.Name)
+				if err != nil {
+					return err
 				}
 			}
 		}
@@ -77,11 +134,11 @@ func (mc *Checker) CheckPeers(peers []peer.ID) error {
 }
 
 // CheckAll will trigger alerts for all latest metrics when they have expired
-// and no alert has been sent before.
+// in AlertThreshold consecutive checks and no alert has been sent before.
 func (mc *Checker) CheckAll() error {
 	for _, metric := range mc.metrics.AllMetrics() {
-		if mc.FailedMetric(metric.Name, metric.Peer) {
-			err := mc.alert(metric.Peer, metric.Name)
+		if mc.FailedMetric(metric.Name, metric.Peer) && mc.missed(metric.Peer, metric.Name) {
+			_, err := mc.alert(metric.Peer, metric.Name)
 			if err != nil {
 				return err
 			}
@@ -91,7 +148,51 @@ func (mc *Checker) CheckAll() error {
 	return nil
 }
 
-func (mc *Checker) alert(pid peer.ID, metricName string) error {
+// Sweep removes the failed metrics from the Store, sending the alerts which
+// CheckPeers would have sent for them first. Metrics which have not been
+// found failed by AlertThreshold checks yet are kept. When a peerset is
+// given, the expired metrics of other peers are removed without alerting.
+func (mc *Checker) Sweep(peers []peer.ID) error {
+	var peerSet map[peer.ID]struct{}
+	if peers != nil {
+		peerSet = make(map[peer.ID]struct{}, len(peers))
+		for _, p := range peers {
+			peerSet[p] = struct{}{}
+		}
+	}
+
+	for _, metric := range mc.metrics.AllMetrics() {
+		if peerSet != nil {
+			if _, ok := peerSet[metric.Peer]; !ok {
+				if metric.Expired() {
+					mc.metrics.RemovePeerMetrics(metric.Peer, metric.Name)
+					mc.failedPeersMu.Lock()
+					mc.clearMisses(metric.Peer, metric.Name)
+					mc.failedPeersMu.Unlock()
+				}
+				continue
+			}
+		}
+		if !mc.FailedMetric(metric.Name, metric.Peer) || mc.belowAlertThreshold(metric.Peer, metric.Name) {
+			continue
+		}
+		for {
+			removed, err := mc.alert(metric.Peer, metric.Name)
+			if err != nil {
+				return err
+			}
+			if removed {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// alert sends an alert for the given metric or, when MaxAlertThreshold
+// alerts were sent for it already, removes it from the Store and returns
+// true.
+func (mc *Checker) alert(pid peer.ID, metricName string) (bool, error) {
 	mc.failedPeersMu.Lock()
 	defer mc.failedPeersMu.Unlock()
 
@@ -111,11 +212,12 @@ func (mc *Checker) alert(pid peer.ID, metricName string) error {
 	// and clean up failedPeers when no failed metrics are left.
 	if failedMetrics[metricName] >= MaxAlertThreshold {
 		mc.metrics.RemovePeerMetrics(pid, metricName)
+		mc.clearMisses(pid, metricName)
 		delete(failedMetrics, metricName)
 		if len(mc.failedPeers[pid]) == 0 {
 			delete(mc.failedPeers, pid)
 		}
-		return nil
+		return true, nil
 	}
 
 	failedMetrics[metricName]++
@@ -131,13 +233,62 @@ func (mc *Checker) alert(pid peer.ID, metricName string) error {
 			[]tag.Mutator{tag.Upsert(observations.RemotePeerKey, pid.Pretty())},
 			observations.Alerts.M(1),
 		)
+	default:
+		return false, ErrAlertChannelFull
+	}
+
+	if _, ok := mc.alerted[pid]; !ok {
+		mc.alerted[pid] = make(map[string]struct{})
+	}
+	mc.alerted[pid][metricName] = struct{}{}
+	return false, nil
+}
+
+// Recovered should be called with every logged metric. When the metric is
+// valid, it restarts the count of checks which found it failed and, if an
+// alert was sent for its name and peer, it sends an alert with Recovered set,
+// once, so that subscribers can clear their own state about the failure.
+func (mc *Checker) Recovered(m *api.Metric) error {
+	if m.Discard() {
+		return nil
+	}
+
+	mc.failedPeersMu.Lock()
+	defer mc.failedPeersMu.Unlock()
+
+	mc.clearMisses(m.Peer, m.Name)
+
+	alertedMetrics, ok := mc.alerted[m.Peer]
+	if !ok {
+		return nil
+	}
+	if _, ok := alertedMetrics[m.Name]; !ok {
+		return nil
+	}
+
+	alrt := &api.Alert{
+		Metric:      *m,
+		TriggeredAt: time.Now(),
+		Recovered:   true,
+	}
+	select {
+	case mc.alertCh <- alrt:
 	default:
 		return ErrAlertChannelFull
 	}
+
+	delete(alertedMetrics, m.Name)
+	if len(alertedMetrics) == 0 {
+		delete(mc.alerted, m.Peer)
+	}
+	delete(mc.failedPeers[m.Peer], m.Name)
+	if len(mc.failedPeers[m.Peer]) == 0 {
+		delete(mc.failedPeers, m.Peer)
+	}
 	return nil
 }
 
-// Alerts returns a channel which gets notified by CheckPeers.
+// Alerts returns a channel which gets notified by CheckPeers and Recovered.
 func (mc *Checker) Alerts() <-chan *api.Alert {
 	return mc.alertCh
 }
@@ -146,7 +297,23 @@ func (mc *Checker) Alerts() <-chan *api.Alert {
 // peersF to obtain a peerset. It can be stopped by cancelling the context.
 // Usually you want to launch this in a goroutine.
 func (mc *Checker) Watch(ctx context.Context, peersF func(context.Context) ([]peer.ID, error), interval time.Duration) {
+	mc.WatchAndSweep(ctx, peersF, interval, 0)
+}
+
+// WatchAndSweep works like Watch and, when sweepInterval is larger than 0,
+// additionally triggers a Sweep on that interval, so that failed metrics are
+// removed shortly after they expire regardless of the check interval.
+func (mc *Checker) WatchAndSweep(ctx context.Context, peersF func(context.Context) ([]peer.ID, error), interval, sweepInterval time.Duration) {
 	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var sweepC <-chan time.Time
+	if sweepInterval > 0 {
+		sweepTicker := time.NewTicker(sweepInterval)
+		defer sweepTicker.Stop()
+		sweepC = sweepTicker.C
+	}
+
 	for {
 		select {
 		case <-ticker.C:
@@ -159,8 +326,17 @@ func (mc *Checker) Watch(ctx context.Context, peersF func(context.Context) ([]pe
 			} else {
 				mc.CheckAll()
 			}
+		case <-sweepC:
+			var peers []peer.ID
+			if peersF != nil {
+				var err error
+				peers, err = peersF(ctx)
+				if err != nil {
+					continue
+				}
+			}
+			mc.Sweep(peers)
 		case <-ctx.Done():
-			ticker.Stop()
 			return
 		}
 	}
@@ -190,14 +366,15 @@ func (mc *Checker) failed(metric string, pid peer.ID) (float64, []float64, float
 	}
 	// The latest metric has expired
 
-	pmtrs := mc.metrics.PeerMetricAll(metric, pid)
+	// Arrival intervals count refreshed duplicates, which are not
+	// kept as separate metrics (see Store.SetDeduplicate).
+	dv := mc.metrics.Distribution(metric, pid)
 	// Not enough values for accrual and metric expired. Peer failed.
-	if len(pmtrs) < accrualMetricsNum {
+	if len(dv)+1 < accrualMetricsNum {
 		return 0.0, nil, 0.0, true
 	}
 
-	v := time.Now().UnixNano() - latest.ReceivedAt
-	dv := mc.metrics.Distribution(metric, pid)
+	v := time.Since(mc.metrics.PeerLastReceived(metric, pid)).Nanoseconds()
 	phiv := phi(float64(v), dv)
 	return float64(v), dv, phiv, phiv >= mc.threshold
 }
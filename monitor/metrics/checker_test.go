@@ -180,6 +180,44 @@ func TestChecker_Failed(t *testing.T) {
 	})
 }
 
+func TestChecker_failedDeduplicate(t *testing.T) {
+	metrics := NewStore()
+	metrics.SetDeduplicate(true)
+	checker := NewChecker(context.Background(), metrics, 2.0)
+
+	for i := 0; i < 10; i++ {
+		if i > 0 {
+			time.Sleep(40 * time.Millisecond)
+		}
+		metr := &api.Metric{
+			Name:  "ping",
+			Peer:  test.PeerID1,
+			Value: "1",
+			Valid: true,
+		}
+		metr.SetTTL(10 * time.Millisecond)
+		metrics.Add(metr)
+	}
+
+	if n := len(metrics.PeerMetricAll("ping", test.PeerID1)); n != 1 {
+		t.Fatal("duplicated pings should be refreshed:", n)
+	}
+	if n := len(metrics.Distribution("ping", test.PeerID1)); n != 9 {
+		t.Fatal("refreshes should count as arrivals:", n)
+	}
+
+	// The last ping expired, but the next one is not late yet.
+	time.Sleep(15 * time.Millisecond)
+	if _, _, phiv, failed := checker.failed("ping", test.PeerID1); failed {
+		t.Error("the peer should not be failed yet, phi:", phiv)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if !checker.FailedMetric("ping", test.PeerID1) {
+		t.Error("the peer should be failed")
+	}
+}
+
 func TestChecker_alert(t *testing.T) {
 	t.Run("remove peer from store after alert", func(t *testing.T) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
@@ -222,6 +260,138 @@ func TestChecker_alert(t *testing.T) {
 	})
 }
 
+func TestChecker_Sweep(t *testing.T) {
+	metrics := NewStore()
+	checker := NewChecker(context.Background(), metrics, 2.0)
+
+	for _, p := range []peer.ID{test.PeerID1, test.PeerID2} {
+		metr := &api.Metric{
+			Name:  "ping",
+			Peer:  p,
+			Value: "1",
+			Valid: true,
+		}
+		metr.SetTTL(0)
+		metrics.Add(metr)
+	}
+	valid := &api.Metric{
+		Name:  "ping",
+		Peer:  test.PeerID3,
+		Value: "1",
+		Valid: true,
+	}
+	valid.SetTTL(time.Minute)
+	metrics.Add(valid)
+
+	err := checker.Sweep([]peer.ID{test.PeerID1, test.PeerID3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(metrics.AllMetrics()) != 1 || metrics.PeerLatest("ping", test.PeerID3) == nil {
+		t.Error("only the valid metric should be left")
+	}
+
+	select {
+	case a := <-checker.Alerts():
+		if a.Peer != test.PeerID1 {
+			t.Error("expected an alert for the peer in the peerset")
+		}
+	default:
+		t.Fatal("expected an alert before removing the metric")
+	}
+	select {
+	case a := <-checker.Alerts():
+		t.Errorf("unexpected alert: %+v", a)
+	default:
+	}
+}
+
+func TestChecker_AlertThreshold(t *testing.T) {
+	metrics := NewStore()
+	checker := NewChecker(context.Background(), metrics, 2.0)
+	checker.SetAlertThreshold(3)
+
+	newMetric := func(ttl time.Duration) *api.Metric {
+		metr := &api.Metric{
+			Name:  "ping",
+			Peer:  test.PeerID1,
+			Value: "1",
+			Valid: true,
+		}
+		metr.SetTTL(ttl)
+		return metr
+	}
+
+	expectAlert := func(t *testing.T, expected bool) {
+		t.Helper()
+		select {
+		case a := <-checker.Alerts():
+			if !expected {
+				t.Errorf("unexpected alert: %+v", a)
+			}
+		default:
+			if expected {
+				t.Error("an alert should have been triggered")
+			}
+		}
+	}
+
+	metrics.Add(newMetric(0))
+	for i := 0; i < 2; i++ {
+		if err := checker.CheckPeers([]peer.ID{test.PeerID1}); err != nil {
+			t.Fatal(err)
+		}
+		expectAlert(t, false)
+	}
+
+	// Sweeping before the threshold is reached keeps the metric.
+	if err := checker.Sweep(nil); err != nil {
+		t.Fatal(err)
+	}
+	if metrics.PeerLatest("ping", test.PeerID1) == nil {
+		t.Fatal("the metric should not have been swept")
+	}
+
+	// A fresh metric restarts the count.
+	fresh := newMetric(time.Minute)
+	metrics.Add(fresh)
+	if err := checker.Recovered(fresh); err != nil {
+		t.Fatal(err)
+	}
+	expectAlert(t, false)
+
+	metrics.Add(newMetric(0))
+	for i := 0; i < 2; i++ {
+		if err := checker.CheckPeers([]peer.ID{test.PeerID1}); err != nil {
+			t.Fatal(err)
+		}
+		expectAlert(t, false)
+	}
+	if err := checker.CheckPeers([]peer.ID{test.PeerID1}); err != nil {
+		t.Fatal(err)
+	}
+	expectAlert(t, true)
+
+	// Sweeping the expired metric of a peer which left the peerset
+	// forgets its misses.
+	left := newMetric(0)
+	left.Peer = test.PeerID2
+	metrics.Add(left)
+	if err := checker.CheckPeers([]peer.ID{test.PeerID2}); err != nil {
+		t.Fatal(err)
+	}
+	if checker.misses[test.PeerID2]["ping"] != 1 {
+		t.Fatal("the check should count a miss")
+	}
+	if err := checker.Sweep([]peer.ID{test.PeerID1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := checker.misses[test.PeerID2]; ok {
+		t.Error("the misses of swept metrics should be forgotten")
+	}
+}
+
 //////////////////
 // HELPER TESTS //
 //////////////////
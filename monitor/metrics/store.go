@@ -3,6 +3,7 @@ package metrics
 import (
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/ipfs/ipfs-cluster/api"
 
@@ -14,14 +15,24 @@ type PeerMetrics map[peer.ID]*Window
 
 // Store can be used to store and access metrics.
 type Store struct {
-	mux    sync.RWMutex
-	byName map[string]PeerMetrics
+	mux           sync.RWMutex
+	byName        map[string]PeerMetrics
+	windowCap     int
+	decayHalfLife time.Duration
+	deduplicate   bool
 }
 
 // NewStore can be used to create a Store.
 func NewStore() *Store {
+	return NewStoreWithWindowCap(DefaultWindowCap)
+}
+
+// NewStoreWithWindowCap creates a Store which retains up to windowCap
+// metrics of each name for every peer.
+func NewStoreWithWindowCap(windowCap int) *Store {
 	return &Store{
-		byName: make(map[string]PeerMetrics),
+		byName:    make(map[string]PeerMetrics),
+		windowCap: windowCap,
 	}
 }
 
@@ -41,13 +52,36 @@ func (mtrs *Store) Add(m *api.Metric) {
 	if !ok {
 		// We always lock the outer map, so we can use unsafe
 		// Window.
-		window = NewWindow(DefaultWindowCap)
+		window = NewWindow(mtrs.windowCap)
 		mbyp[peer] = window
 	}
 
+	if mtrs.deduplicate && window.Refresh(m) {
+		return
+	}
+
 	window.Add(m)
 }
 
+// SetDecayHalfLife makes LatestValid and PeerMetrics return decay-weighted
+// values (see Window.Decayed). 0 disables it.
+func (mtrs *Store) SetDecayHalfLife(halfLife time.Duration) {
+	mtrs.mux.Lock()
+	mtrs.decayHalfLife = halfLife
+	mtrs.mux.Unlock()
+}
+
+// SetDeduplicate makes Add refresh the expiry of the last metric stored for
+// the same name and peer, instead of adding a new one, when both have the
+// same content (see Window.Refresh). Windows then hold only the changes of
+// value, while refreshes still count as arrivals for accrual failure
+// detection.
+func (mtrs *Store) SetDeduplicate(deduplicate bool) {
+	mtrs.mux.Lock()
+	mtrs.deduplicate = deduplicate
+	mtrs.mux.Unlock()
+}
+
 // RemovePeer removes all metrics related to a peer from the Store.
 func (mtrs *Store) RemovePeer(pid peer.ID) {
 	mtrs.mux.Lock()
@@ -65,8 +99,22 @@ func (mtrs *Store) RemovePeerMetrics(pid peer.ID, name string) {
 	mtrs.mux.Unlock()
 }
 
+// ExpirePeer makes the latest metrics of all types for a peer expire now,
+// while keeping them in the Store so that failure detection can act on them.
+func (mtrs *Store) ExpirePeer(pid peer.ID) {
+	now := time.Now()
+	mtrs.mux.RLock()
+	defer mtrs.mux.RUnlock()
+	for _, metrics := range mtrs.byName {
+		if window, ok := metrics[pid]; ok {
+			window.Expire(now)
+		}
+	}
+}
+
 // LatestValid returns all the last known valid metrics of a given type. A metric
-// is valid if it has not expired.
+// is valid if it has not expired. Values are decay-weighted when a decay
+// half-life is set.
 func (mtrs *Store) LatestValid(name string) []*api.Metric {
 	mtrs.mux.RLock()
 	defer mtrs.mux.RUnlock()
@@ -83,6 +131,35 @@ func (mtrs *Store) LatestValid(name string) []*api.Metric {
 		if err != nil || m.Discard() {
 			continue
 		}
+		if mtrs.decayHalfLife > 0 {
+			m, _ = window.Decayed(mtrs.decayHalfLife)
+		}
+		metrics = append(metrics, m)
+	}
+
+	sortedMetrics := api.MetricSlice(metrics)
+	sort.Stable(sortedMetrics)
+	return sortedMetrics
+}
+
+// At returns, for every peer, the metric of the given type which was valid at
+// the given time, as long as it is still retained in the peer's window. See
+// Window.At().
+func (mtrs *Store) At(name string, t time.Time) []*api.Metric {
+	mtrs.mux.RLock()
+	defer mtrs.mux.RUnlock()
+
+	byPeer, ok := mtrs.byName[name]
+	if !ok {
+		return []*api.Metric{}
+	}
+
+	metrics := make([]*api.Metric, 0, len(byPeer))
+	for _, window := range byPeer {
+		m, err := window.At(t)
+		if err != nil {
+			continue
+		}
 		metrics = append(metrics, m)
 	}
 
@@ -91,6 +168,21 @@ func (mtrs *Store) LatestValid(name string) []*api.Metric {
 	return sortedMetrics
 }
 
+// Stats returns, for every peer, the statistics of the valid metrics of the
+// given type retained in its window. See Window.Stats().
+func (mtrs *Store) Stats(name string) map[peer.ID]api.MetricStats {
+	mtrs.mux.RLock()
+	defer mtrs.mux.RUnlock()
+
+	stats := make(map[peer.ID]api.MetricStats)
+	for p, window := range mtrs.byName[name] {
+		if st, ok := window.Stats(); ok {
+			stats[p] = st
+		}
+	}
+	return stats
+}
+
 // AllMetrics returns the latest metrics for all peers and metrics types.  It
 // may return expired metrics.
 func (mtrs *Store) AllMetrics() []*api.Metric {
@@ -112,7 +204,8 @@ func (mtrs *Store) AllMetrics() []*api.Metric {
 }
 
 // PeerMetrics returns the latest metrics for a given peer ID for
-// all known metrics types. It may return expired metrics.
+// all known metrics types. It may return expired metrics. Values are
+// decay-weighted when a decay half-life is set.
 func (mtrs *Store) PeerMetrics(pid peer.ID) []*api.Metric {
 	mtrs.mux.RLock()
 	defer mtrs.mux.RUnlock()
@@ -128,11 +221,49 @@ func (mtrs *Store) PeerMetrics(pid peer.ID) []*api.Metric {
 		if err != nil || !metric.Valid {
 			continue
 		}
+		if mtrs.decayHalfLife > 0 {
+			metric, _ = window.Decayed(mtrs.decayHalfLife)
+		}
 		result = append(result, metric)
 	}
 	return result
 }
 
+// LastReceived returns, for every peer, when the most recent of its metrics
+// (of any type, expired or not) was received, counting refreshes.
+func (mtrs *Store) LastReceived() map[peer.ID]time.Time {
+	mtrs.mux.RLock()
+	defer mtrs.mux.RUnlock()
+
+	last := make(map[peer.ID]time.Time)
+	for _, byPeer := range mtrs.byName {
+		for pid, window := range byPeer {
+			ts := window.LastReceived()
+			if ts.IsZero() {
+				continue
+			}
+			if ts.After(last[pid]) {
+				last[pid] = ts
+			}
+		}
+	}
+	return last
+}
+
+// PeerLastReceived returns when a particular metric for a particular peer
+// was last received, counting refreshes. It returns the zero time if there
+// are none.
+func (mtrs *Store) PeerLastReceived(name string, pid peer.ID) time.Time {
+	mtrs.mux.RLock()
+	defer mtrs.mux.RUnlock()
+
+	window, ok := mtrs.byName[name][pid]
+	if !ok {
+		return time.Time{}
+	}
+	return window.LastReceived()
+}
+
 // PeerMetricAll returns all of a particular metrics for a
 // particular peer.
 func (mtrs *Store) PeerMetricAll(name string, pid peer.ID) []*api.Metric {
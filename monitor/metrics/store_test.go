@@ -53,3 +53,131 @@ func TestRemovePeer(t *testing.T) {
 		t.Errorf("there should be no peer metrics; got: %v", pmtrs)
 	}
 }
+
+func TestExpirePeer(t *testing.T) {
+	store := NewStore()
+
+	metr := &api.Metric{
+		Name:  "test",
+		Peer:  test.PeerID1,
+		Value: "1",
+		Valid: true,
+	}
+	metr.SetTTL(time.Minute)
+	store.Add(metr)
+
+	store.ExpirePeer(test.PeerID1)
+	if latest := store.LatestValid("test"); len(latest) != 0 {
+		t.Errorf("expected no valid metrics; got: %v", latest)
+	}
+	if pmtrs := store.PeerMetrics(test.PeerID1); len(pmtrs) != 1 {
+		t.Errorf("expired metrics should be kept; got: %v", pmtrs)
+	}
+	if metr.Expired() {
+		t.Error("the original metric should not be modified")
+	}
+}
+
+func TestStoreStats(t *testing.T) {
+	store := NewStoreWithWindowCap(2)
+
+	for _, v := range []string{"1", "2", "3"} {
+		metr := &api.Metric{
+			Name:  "test",
+			Peer:  test.PeerID1,
+			Value: v,
+			Valid: true,
+		}
+		metr.SetTTL(time.Minute)
+		store.Add(metr)
+	}
+
+	stats := store.Stats("test")
+	st, ok := stats[test.PeerID1]
+	if !ok || len(stats) != 1 {
+		t.Fatal("expected stats for one peer")
+	}
+	if st.Samples != 2 || st.Min != 2 || st.Max != 3 {
+		t.Errorf("only 2 metrics should be retained: %+v", st)
+	}
+
+	if len(store.Stats("other")) != 0 {
+		t.Error("expected no stats")
+	}
+}
+
+func TestStoreDecayHalfLife(t *testing.T) {
+	store := NewStore()
+	base := time.Now().Add(-time.Minute)
+
+	for i, v := range []string{"10", "40"} {
+		metr := &api.Metric{
+			Name:  "test",
+			Peer:  test.PeerID1,
+			Value: v,
+			Valid: true,
+		}
+		metr.SetTTL(time.Hour)
+		store.Add(metr)
+		metr.ReceivedAt = base.Add(time.Duration(i) * time.Minute).UnixNano()
+	}
+
+	if latest := store.LatestValid("test"); len(latest) != 1 || latest[0].Value != "40" {
+		t.Errorf("expected the last value; got: %v", latest)
+	}
+
+	// 10 is two half-lives older than 40: (40 + 10/4) / 1.25
+	store.SetDecayHalfLife(30 * time.Second)
+	if latest := store.LatestValid("test"); len(latest) != 1 || latest[0].Value != "34" {
+		t.Errorf("expected a decayed value; got: %v", latest)
+	}
+	if pmtrs := store.PeerMetrics(test.PeerID1); len(pmtrs) != 1 || pmtrs[0].Value != "34" {
+		t.Errorf("expected a decayed value; got: %v", pmtrs)
+	}
+}
+
+func TestStoreDeduplicate(t *testing.T) {
+	store := NewStore()
+	store.SetDeduplicate(true)
+
+	add := func(v string, ttl time.Duration) *api.Metric {
+		metr := &api.Metric{
+			Name:  "test",
+			Peer:  test.PeerID1,
+			Value: v,
+			Valid: true,
+		}
+		metr.SetTTL(ttl)
+		store.Add(metr)
+		return metr
+	}
+
+	first := add("5", time.Minute)
+	add("5", time.Minute)
+	last := add("5", time.Hour)
+
+	all := store.PeerMetricAll("test", test.PeerID1)
+	if len(all) != 1 {
+		t.Fatalf("expected a single entry; got %d", len(all))
+	}
+	if all[0].Expire != last.Expire {
+		t.Error("the entry should expire with the last duplicate")
+	}
+	if all[0].ReceivedAt != first.ReceivedAt {
+		t.Error("the entry should keep the time it was first received")
+	}
+	if !store.LastReceived()[test.PeerID1].After(time.Unix(0, first.ReceivedAt)) {
+		t.Error("refreshing should count as receiving a metric")
+	}
+
+	add("6", time.Minute)
+	if all := store.PeerMetricAll("test", test.PeerID1); len(all) != 2 || all[0].Value != "6" {
+		t.Errorf("a new value should be added; got: %v", all)
+	}
+
+	store.SetDeduplicate(false)
+	add("6", time.Minute)
+	if all := store.PeerMetricAll("test", test.PeerID1); len(all) != 3 {
+		t.Errorf("duplicates should be added when disabled; got: %v", all)
+	}
+}
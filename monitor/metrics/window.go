@@ -6,6 +6,9 @@ package metrics
 import (
 	"container/ring"
 	"errors"
+	"math"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
@@ -22,6 +25,11 @@ var ErrNoMetrics = errors.New("no metrics have been added to this window")
 type Window struct {
 	wMu    sync.RWMutex
 	window *ring.Ring
+	// arrivals holds when metrics were added or refreshed, for accrual
+	// failure detection.
+	arrivals *ring.Ring
+	// lastReceived is when a metric was last added or refreshed.
+	lastReceived int64
 }
 
 // NewWindow creates an instance with the given
@@ -33,10 +41,19 @@ func NewWindow(windowCap int) *Window {
 
 	w := ring.New(windowCap)
 	return &Window{
-		window: w,
+		window:   w,
+		arrivals: ring.New(windowCap),
 	}
 }
 
+// arrive records that a metric was received at the given time. It must be
+// called with the lock held.
+func (mw *Window) arrive(ts int64) {
+	mw.arrivals.Value = ts
+	mw.arrivals = mw.arrivals.Next()
+	mw.lastReceived = ts
+}
+
 // Add adds a new metric to the window. If the window capacity
 // has been reached, the oldest metric (by the time it was added),
 // will be discarded. Add leaves the cursor on the next spot,
@@ -47,9 +64,62 @@ func (mw *Window) Add(m *api.Metric) {
 	mw.wMu.Lock()
 	mw.window.Value = m
 	mw.window = mw.window.Next()
+	mw.arrive(m.ReceivedAt)
 	mw.wMu.Unlock()
 }
 
+// Refresh makes the last metric added expire when the given one does,
+// instead of adding it, when both have the same content: value, validity,
+// weight, partitionability and tags. It returns false and leaves the window
+// untouched otherwise. The last metric is replaced by a modified copy and
+// keeps the time it was received, but the refresh counts as an arrival for
+// Distribution and LastReceived.
+func (mw *Window) Refresh(m *api.Metric) bool {
+	mw.wMu.Lock()
+	defer mw.wMu.Unlock()
+
+	prevRing := mw.window.Prev()
+	last, ok := prevRing.Value.(*api.Metric)
+	if !ok || last == nil || !sameContent(last, m) {
+		return false
+	}
+	refreshed := *last
+	refreshed.Expire = m.Expire
+	prevRing.Value = &refreshed
+	mw.arrive(time.Now().UnixNano())
+	return true
+}
+
+// sameContent returns whether both metrics carry the same information,
+// regardless of when they were sent and received.
+func sameContent(a, b *api.Metric) bool {
+	if a.Value != b.Value ||
+		a.Valid != b.Valid ||
+		a.Weight != b.Weight ||
+		a.Partitionable != b.Partitionable ||
+		len(a.Tags) != len(b.Tags) {
+		return false
+	}
+	for k, v := range a.Tags {
+		if bv, ok := b.Tags[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// LastReceived returns when a metric was last added to the window or
+// refreshed. It returns the zero time if no metrics were added.
+func (mw *Window) LastReceived() time.Time {
+	mw.wMu.RLock()
+	defer mw.wMu.RUnlock()
+
+	if mw.lastReceived == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, mw.lastReceived)
+}
+
 // Latest returns the last metric added. It returns an error
 // if no metrics were added.
 func (mw *Window) Latest() (*api.Metric, error) {
@@ -73,6 +143,22 @@ func (mw *Window) Latest() (*api.Metric, error) {
 	return last, nil
 }
 
+// Expire makes the last metric added expire at the given time, unless it
+// expires earlier already. The metric is replaced by a modified copy.
+func (mw *Window) Expire(t time.Time) {
+	mw.wMu.Lock()
+	defer mw.wMu.Unlock()
+
+	prevRing := mw.window.Prev()
+	last, ok := prevRing.Value.(*api.Metric)
+	if !ok || last == nil || last.Expire <= t.UnixNano() {
+		return
+	}
+	expired := *last
+	expired.Expire = t.UnixNano()
+	prevRing.Value = &expired
+}
+
 // All returns all the metrics in the window, in the inverse order
 // they were Added. That is, result[0] will be the last added
 // metric.
@@ -92,18 +178,171 @@ func (mw *Window) All() []*api.Metric {
 	return values
 }
 
-// Distribution returns the deltas between all the current
-// values contained in the current window. This will
-// only return values if the api.Metric.Type() is "ping",
-// which are used for accural failure detection.
-func (mw *Window) Distribution() []float64 {
+// At returns the metric which was valid at the given time: the last valid
+// metric received before t which had not expired by then. When the value of
+// that metric and the next one in the window are numeric, the returned
+// metric is a copy whose value (and weight) is linearly interpolated between
+// both. It returns ErrNoMetrics if the window holds no such metric.
+func (mw *Window) At(t time.Time) (*api.Metric, error) {
+	ts := t.UnixNano()
 	ms := mw.All()
-	dist := make([]float64, 0, len(ms)-1)
+
+	// ms[i] is younger than ms[i+1]
+	for i, m := range ms {
+		if m.ReceivedAt > ts {
+			continue
+		}
+		if !m.Valid || m.Expire <= ts {
+			return nil, ErrNoMetrics
+		}
+		if i == 0 {
+			return m, nil
+		}
+		return interpolate(m, ms[i-1], ts), nil
+	}
+	return nil, ErrNoMetrics
+}
+
+// interpolate returns a copy of m with its value and weight set to those
+// expected at the given time between metrics m and next, as long as their
+// values are numeric. It returns m otherwise.
+func interpolate(m, next *api.Metric, ts int64) *api.Metric {
+	if !next.Valid || next.ReceivedAt <= m.ReceivedAt {
+		return m
+	}
+	v1, err := strconv.ParseFloat(m.Value, 64)
+	if err != nil {
+		return m
+	}
+	v2, err := strconv.ParseFloat(next.Value, 64)
+	if err != nil {
+		return m
+	}
+
+	frac := float64(ts-m.ReceivedAt) / float64(next.ReceivedAt-m.ReceivedAt)
+	v := v1 + (v2-v1)*frac
+
+	im := *m
+	if _, err := strconv.ParseUint(m.Value, 10, 64); err == nil {
+		im.Value = strconv.FormatUint(uint64(v), 10)
+	} else {
+		im.Value = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	im.Weight = m.Weight + int64(float64(next.Weight-m.Weight)*frac)
+	return &im
+}
+
+// Decayed returns the last metric added or, when its value is numeric and
+// halfLife is larger than 0, a copy whose value (and weight) is the average
+// of the valid numeric metrics in the window, expired or not, weighted by
+// their age relative to the last one: their contribution halves every
+// halfLife. It returns an error if no metrics were added.
+func (mw *Window) Decayed(halfLife time.Duration) (*api.Metric, error) {
+	ms := mw.All()
+	if len(ms) == 0 {
+		return nil, ErrNoMetrics
+	}
+	latest := ms[0]
+	if halfLife <= 0 || !latest.Valid {
+		return latest, nil
+	}
+	if _, err := strconv.ParseFloat(latest.Value, 64); err != nil {
+		return latest, nil
+	}
+
+	var sum, weightSum, total float64
+	// ms[i] is younger than ms[i+1]
+	for _, m := range ms {
+		if !m.Valid {
+			continue
+		}
+		v, err := strconv.ParseFloat(m.Value, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		age := float64(latest.ReceivedAt - m.ReceivedAt)
+		w := math.Exp2(-age / float64(halfLife))
+		sum += w * v
+		weightSum += w * float64(m.GetWeight())
+		total += w
+	}
+	if total == 0 {
+		return latest, nil
+	}
+
+	dm := *latest
+	avg := sum / total
+	if _, err := strconv.ParseUint(latest.Value, 10, 64); err == nil {
+		dm.Value = strconv.FormatUint(uint64(math.Round(avg)), 10)
+	} else {
+		dm.Value = strconv.FormatFloat(avg, 'f', -1, 64)
+	}
+	dm.Weight = int64(math.Round(weightSum / total))
+	return &dm, nil
+}
+
+// Stats returns the statistics of the valid, non-expired metrics in the
+// window. Values which are not finite numbers only count for Latest. It
+// returns false when there are no such metrics.
+func (mw *Window) Stats() (api.MetricStats, bool) {
+	var stats api.MetricStats
+	var values []float64
+	found := false
+
+	// ms[i] is younger than ms[i+1]
+	for _, m := range mw.All() {
+		if m.Discard() {
+			continue
+		}
+		if !found {
+			stats.Latest = m.Value
+			found = true
+		}
+		v, err := strconv.ParseFloat(m.Value, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		values = append(values, v)
+	}
+	if len(values) == 0 {
+		return stats, found
+	}
+
+	sort.Float64s(values)
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	stats.Samples = len(values)
+	stats.Min = values[0]
+	stats.Max = values[len(values)-1]
+	stats.Avg = sum / float64(len(values))
+	// nearest-rank percentile
+	stats.P95 = values[int(math.Ceil(0.95*float64(len(values))))-1]
+	return stats, true
+}
+
+// Distribution returns the deltas between the times the metrics in the
+// window arrived, refreshes included, from the most recent one. They are
+// used for accrual failure detection.
+func (mw *Window) Distribution() []float64 {
+	var ts []int64
+	mw.wMu.RLock()
+	mw.arrivals.Do(func(v interface{}) {
+		if t, ok := v.(int64); ok {
+			// append younger values to older values
+			ts = append([]int64{t}, ts...)
+		}
+	})
+	mw.wMu.RUnlock()
+
+	if len(ts) == 0 {
+		return []float64{}
+	}
+	dist := make([]float64, 0, len(ts)-1)
 	// the last value can't be used to calculate a delta
-	for i, v := range ms[:len(ms)-1] {
-		// All() provides an order slice, where ms[i] is younger than ms[i+1]
-		delta := v.ReceivedAt - ms[i+1].ReceivedAt
-		dist = append(dist, float64(delta))
+	for i, t := range ts[:len(ts)-1] {
+		dist = append(dist, float64(t-ts[i+1]))
 	}
 
 	return dist
@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"testing"
 	"time"
@@ -223,6 +224,172 @@ func BenchmarkWindow_Latest(b *testing.B) {
 	})
 }
 
+func TestWindow_At(t *testing.T) {
+	mw := NewWindow(4)
+	base := time.Now().Add(-time.Minute)
+
+	m1 := makeMetric("100")
+	m1.Weight = 100
+	mw.Add(m1)
+	m1.ReceivedAt = base.UnixNano()
+	m1.Expire = base.Add(30 * time.Second).UnixNano()
+
+	m2 := makeMetric("200")
+	m2.Weight = 200
+	mw.Add(m2)
+	m2.ReceivedAt = base.Add(10 * time.Second).UnixNano()
+
+	_, err := mw.At(base.Add(-time.Second))
+	if err != ErrNoMetrics {
+		t.Error("expected ErrNoMetrics before the first metric")
+	}
+
+	metr, err := mw.At(base.Add(5 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metr.Value != "150" || metr.Weight != 150 {
+		t.Errorf("expected interpolated value. Got: %s (weight %d)", metr.Value, metr.Weight)
+	}
+	if m1.Value != "100" {
+		t.Error("the stored metric should not be modified")
+	}
+
+	metr, err = mw.At(base.Add(11 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metr != m2 {
+		t.Error("expected the latest metric")
+	}
+
+	_, err = mw.At(time.Now().Add(time.Hour))
+	if err != ErrNoMetrics {
+		t.Error("expected ErrNoMetrics once the latest metric expired")
+	}
+
+	m3 := makeMetric("abc")
+	mw.Add(m3)
+	m3.ReceivedAt = time.Now().Add(-time.Second).UnixNano()
+	metr, err = mw.At(time.Now().Add(-2 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metr != m2 {
+		t.Error("non-numeric values should not be interpolated")
+	}
+}
+
+func TestWindow_Decayed(t *testing.T) {
+	mw := NewWindow(4)
+	if _, err := mw.Decayed(time.Second); err != ErrNoMetrics {
+		t.Error("expected ErrNoMetrics")
+	}
+
+	base := time.Now().Add(-time.Minute)
+
+	m1 := makeMetric("100")
+	m1.Weight = 100
+	mw.Add(m1)
+	m1.ReceivedAt = base.UnixNano()
+
+	m2 := makeMetric("200")
+	m2.Weight = 200
+	mw.Add(m2)
+	m2.ReceivedAt = base.Add(10 * time.Second).UnixNano()
+
+	metr, err := mw.Decayed(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metr != m2 {
+		t.Error("expected the latest metric without a half-life")
+	}
+
+	// m1 is one half-life older than m2: (200 + 100/2) / 1.5
+	metr, err = mw.Decayed(10 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metr.Value != "167" || metr.Weight != 167 {
+		t.Errorf("expected decayed value. Got: %s (weight %d)", metr.Value, metr.Weight)
+	}
+	if metr.ReceivedAt != m2.ReceivedAt || m2.Value != "200" {
+		t.Error("expected an unmodified copy of the latest metric")
+	}
+
+	m3 := makeMetric("1.5")
+	mw.Add(m3)
+	m3.ReceivedAt = base.Add(20 * time.Second).UnixNano()
+	// (1.5 + 200/2 + 100/4) / 1.75
+	metr, _ = mw.Decayed(10 * time.Second)
+	if v, _ := strconv.ParseFloat(metr.Value, 64); math.Abs(v-126.5/1.75) > 1e-9 {
+		t.Errorf("expected float decayed value. Got: %s", metr.Value)
+	}
+
+	m4 := makeMetric("abc")
+	mw.Add(m4)
+	metr, _ = mw.Decayed(10 * time.Second)
+	if metr != m4 {
+		t.Error("non-numeric values should not be decayed")
+	}
+}
+
+func TestWindow_Stats(t *testing.T) {
+	t.Run("empty window", func(t *testing.T) {
+		mw := NewWindow(4)
+		if _, ok := mw.Stats(); ok {
+			t.Error("expected no stats")
+		}
+	})
+
+	t.Run("numeric values", func(t *testing.T) {
+		mw := NewWindow(25)
+		for i := 1; i <= 20; i++ {
+			mw.Add(makeMetric(strconv.Itoa(i)))
+		}
+		invalid := makeMetric("1000")
+		invalid.Valid = false
+		mw.Add(invalid)
+		expired := makeMetric("1000")
+		expired.Expire = time.Now().Add(-time.Second).UnixNano()
+		mw.Add(expired)
+
+		st, ok := mw.Stats()
+		if !ok {
+			t.Fatal("expected stats")
+		}
+		if st.Samples != 20 || st.Min != 1 || st.Max != 20 || st.Avg != 10.5 || st.P95 != 19 {
+			t.Errorf("unexpected stats: %+v", st)
+		}
+		if st.Latest != "20" {
+			t.Error("expected the latest valid value")
+		}
+	})
+
+	t.Run("non-numeric values", func(t *testing.T) {
+		mw := NewWindow(4)
+		mw.Add(makeMetric("5"))
+		mw.Add(makeMetric("NaN"))
+		mw.Add(makeMetric("abc"))
+
+		st, ok := mw.Stats()
+		if !ok {
+			t.Fatal("expected stats")
+		}
+		if st.Samples != 1 || st.Avg != 5 || st.Latest != "abc" {
+			t.Errorf("unexpected stats: %+v", st)
+		}
+
+		mw = NewWindow(4)
+		mw.Add(makeMetric("abc"))
+		st, ok = mw.Stats()
+		if !ok || st.Samples != 0 || st.Latest != "abc" {
+			t.Errorf("unexpected stats: %+v", st)
+		}
+	})
+}
+
 func TestWindow_All(t *testing.T) {
 	t.Run("empty window", func(t *testing.T) {
 		mw := NewWindow(4)
@@ -0,0 +1,75 @@
+package pubsubmon
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// alertHistory retains the last alerts delivered by the monitor, up to size
+// alerts and, when maxAge is set, for maxAge since they were triggered. It
+// is not persisted. A nil alertHistory records nothing.
+type alertHistory struct {
+	mu     sync.Mutex
+	alerts []*api.Alert // oldest first
+	size   int
+	maxAge time.Duration
+}
+
+func newAlertHistory(size int, maxAge time.Duration) *alertHistory {
+	if size <= 0 {
+		return nil
+	}
+	return &alertHistory{
+		size:   size,
+		maxAge: maxAge,
+	}
+}
+
+// add records an alert.
+func (h *alertHistory) add(alrt *api.Alert) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.alerts = append(h.alerts, alrt)
+	if extra := len(h.alerts) - h.size; extra > 0 {
+		h.alerts = append(h.alerts[:0], h.alerts[extra:]...)
+	}
+	h.trim(time.Now())
+}
+
+// trim removes the alerts older than maxAge. h.mu must be held.
+func (h *alertHistory) trim(now time.Time) {
+	if h.maxAge <= 0 {
+		return
+	}
+	i := 0
+	for i < len(h.alerts) && now.Sub(h.alerts[i].TriggeredAt) > h.maxAge {
+		i++
+	}
+	if i > 0 {
+		h.alerts = append(h.alerts[:0], h.alerts[i:]...)
+	}
+}
+
+// since returns the retained alerts triggered after the given time, the most
+// recent first.
+func (h *alertHistory) since(t time.Time) []*api.Alert {
+	if h == nil {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.trim(time.Now())
+
+	var alerts []*api.Alert
+	for i := len(h.alerts) - 1; i >= 0 && h.alerts[i].TriggeredAt.After(t); i-- {
+		alerts = append(alerts, h.alerts[i])
+	}
+	return alerts
+}
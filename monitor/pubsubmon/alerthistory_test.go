@@ -0,0 +1,48 @@
+package pubsubmon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+func makeAlert(name string, triggeredAt time.Time) *api.Alert {
+	return &api.Alert{
+		Metric:      api.Metric{Name: name},
+		TriggeredAt: triggeredAt,
+	}
+}
+
+func TestAlertHistory(t *testing.T) {
+	now := time.Now()
+
+	h := newAlertHistory(3, 0)
+	for i, name := range []string{"a", "b", "c", "d"} {
+		h.add(makeAlert(name, now.Add(time.Duration(i-4)*time.Second)))
+	}
+	alerts := h.since(time.Time{})
+	if len(alerts) != 3 {
+		t.Fatalf("expected 3 alerts; got %d", len(alerts))
+	}
+	if alerts[0].Name != "d" || alerts[2].Name != "b" {
+		t.Error("expected the most recent alerts first")
+	}
+	if alerts := h.since(now.Add(-2500 * time.Millisecond)); len(alerts) != 2 {
+		t.Errorf("expected 2 alerts since 2.5s ago; got %d", len(alerts))
+	}
+
+	h = newAlertHistory(10, time.Minute)
+	h.add(makeAlert("old", now.Add(-2*time.Minute)))
+	h.add(makeAlert("new", now))
+	alerts = h.since(time.Time{})
+	if len(alerts) != 1 || alerts[0].Name != "new" {
+		t.Errorf("expected old alerts to be trimmed: %v", alerts)
+	}
+
+	h = newAlertHistory(0, time.Minute)
+	h.add(makeAlert("a", now))
+	if len(h.since(time.Time{})) != 0 {
+		t.Error("a disabled history should not retain alerts")
+	}
+}
@@ -0,0 +1,102 @@
+package pubsubmon
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/golang/snappy"
+)
+
+// compressedPrefix precedes compressed messages, followed by a byte giving
+// the compression format and by the compressed message, which is a single
+// metric or a batch. Like batchPrefix, it starts with 0xc1 so that it is
+// never mistaken for a msgpack-encoded metric.
+var compressedPrefix = []byte{0xc1, 2}
+
+// Compression format bytes.
+const (
+	formatGzip   byte = 1
+	formatSnappy byte = 2
+)
+
+// maxDecompressedSize bounds the size of decompressed messages, which only
+// carry a few metrics, so that small messages cannot expand into large
+// allocations.
+const maxDecompressedSize = 4 << 20
+
+// compressionFormats maps the values of MetricCompression to their format
+// byte.
+var compressionFormats = map[string]byte{
+	"gzip":   formatGzip,
+	"snappy": formatSnappy,
+}
+
+// compressMessage returns the given message compressed with the given
+// MetricCompression, or the message itself when it is not set or when
+// compressing does not make it smaller.
+func compressMessage(compression string, msg []byte) ([]byte, error) {
+	format, ok := compressionFormats[compression]
+	if !ok {
+		return msg, nil
+	}
+
+	b := bytes.NewBuffer(append(append([]byte{}, compressedPrefix...), format))
+	switch format {
+	case formatGzip:
+		w := gzip.NewWriter(b)
+		if _, err := w.Write(msg); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	case formatSnappy:
+		b.Write(snappy.Encode(nil, msg))
+	}
+
+	if b.Len() >= len(msg) {
+		return msg, nil
+	}
+	return b.Bytes(), nil
+}
+
+// decompressMessage returns the message carried by a message starting with
+// compressedPrefix.
+func decompressMessage(data []byte) ([]byte, error) {
+	data = data[len(compressedPrefix):]
+	if len(data) == 0 {
+		return nil, errors.New("compressed message without format")
+	}
+
+	switch format := data[0]; format {
+	case formatGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data[1:]))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		msg, err := ioutil.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(msg) > maxDecompressedSize {
+			return nil, errors.New("decompressed message too large")
+		}
+		return msg, nil
+	case formatSnappy:
+		n, err := snappy.DecodedLen(data[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n > maxDecompressedSize {
+			return nil, errors.New("decompressed message too large")
+		}
+		return snappy.Decode(nil, data[1:])
+	default:
+		return nil, fmt.Errorf("unknown compression format %d", format)
+	}
+}
@@ -0,0 +1,166 @@
+package pubsubmon
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	gocodec "github.com/ugorji/go/codec"
+)
+
+// realisticBatch returns the message that a peer publishes with the default
+// informers and a few tags.
+func realisticBatch(t testing.TB) []byte {
+	metrics := []*api.Metric{
+		{
+			Name:   "freespace",
+			Peer:   test.PeerID1,
+			Value:  "98000000000",
+			Weight: 98000000000,
+			Valid:  true,
+			Tags:   map[string]string{"capacity": "100000000000"},
+		},
+		{
+			Name:          "tag:group",
+			Peer:          test.PeerID1,
+			Value:         "default",
+			Valid:         true,
+			Partitionable: true,
+			Tags:          map[string]string{"group": "default", "region": "eu-west"},
+		},
+		{
+			Name:  "queuedepth",
+			Peer:  test.PeerID1,
+			Value: "12",
+			Valid: true,
+		},
+		{
+			Name:  "swarmpeers",
+			Peer:  test.PeerID1,
+			Value: "250",
+			Valid: true,
+		},
+	}
+	for _, m := range metrics {
+		m.SetTTL(30 * time.Second)
+	}
+
+	b := bytes.NewBuffer(append([]byte{}, batchPrefix...))
+	if err := gocodec.NewEncoder(b, msgpackHandle).Encode(metrics); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestCompressMessage(t *testing.T) {
+	msg := realisticBatch(t)
+
+	for _, compression := range []string{"gzip", "snappy"} {
+		t.Run(compression, func(t *testing.T) {
+			compressed, err := compressMessage(compression, msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(compressed, compressedPrefix) {
+				t.Fatal("expected a compressed message")
+			}
+			if len(compressed) >= len(msg) {
+				t.Errorf("compressed message is not smaller: %d >= %d", len(compressed), len(msg))
+			}
+			decompressed, err := decompressMessage(compressed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decompressed, msg) {
+				t.Error("round-trip changed the message")
+			}
+		})
+	}
+
+	uncompressed, err := compressMessage("", msg)
+	if err != nil || !bytes.Equal(uncompressed, msg) {
+		t.Error("messages should not be compressed by default")
+	}
+
+	// Compression is skipped when it does not help.
+	tiny := []byte{0x80}
+	compressed, err := compressMessage("gzip", tiny)
+	if err != nil || !bytes.Equal(compressed, tiny) {
+		t.Error("tiny messages should not be compressed")
+	}
+
+	_, err = decompressMessage(append(append([]byte{}, compressedPrefix...), 99))
+	if err == nil {
+		t.Error("expected an error with an unknown format")
+	}
+}
+
+func TestPeerMonitorMixedCompression(t *testing.T) {
+	ctx := context.Background()
+	pm, host, shutdown := testPeerMonitorWithConfig(t, nil, func(cfg *Config) {
+		cfg.MetricCompression = "snappy"
+	})
+	defer shutdown()
+	pm2, host2, shutdown2 := testPeerMonitor(t)
+	defer shutdown2()
+
+	time.Sleep(200 * time.Millisecond)
+
+	err := host.Connect(ctx, peer.AddrInfo{ID: host2.ID(), Addrs: host2.Addrs()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	mf := newMetricFactory()
+	batch := benchmarkMetrics(10)
+	if err := pm.PublishMetrics(ctx, batch); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm2.PublishMetric(ctx, mf.newMetric("uncompressed", test.PeerID2)); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	for _, m := range []*Monitor{pm, pm2} {
+		for _, sent := range batch {
+			if len(m.LatestMetrics(ctx, sent.Name)) != 1 {
+				t.Errorf("expected the compressed %s metric", sent.Name)
+			}
+		}
+		if len(m.LatestMetrics(ctx, "uncompressed")) != 1 {
+			t.Error("expected the uncompressed metric")
+		}
+	}
+}
+
+// BenchmarkCompressMessage reports the size of a realistic metrics message
+// with every compression format.
+func BenchmarkCompressMessage(b *testing.B) {
+	msg := realisticBatch(b)
+	for _, compression := range []string{"", "gzip", "snappy"} {
+		name := compression
+		if name == "" {
+			name = "none"
+		}
+		b.Run(name, func(b *testing.B) {
+			var compressed []byte
+			var err error
+			for i := 0; i < b.N; i++ {
+				compressed, err = compressMessage(compression, msg)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(compressed)), "bytes/msg")
+			b.ReportMetric(float64(len(compressed))/float64(len(msg)), "ratio")
+		})
+	}
+}
@@ -3,10 +3,16 @@ package pubsubmon
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
+	"strconv"
 	"time"
 
 	"github.com/ipfs/ipfs-cluster/config"
+	"github.com/ipfs/ipfs-cluster/monitor/metrics"
 	"github.com/kelseyhightower/envconfig"
+
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
 )
 
 const configKey = "pubsubmon"
@@ -14,10 +20,76 @@ const envConfigKey = "cluster_pubsubmon"
 
 // Default values for this Config.
 const (
-	DefaultCheckInterval    = 15 * time.Second
-	DefaultFailureThreshold = 3.0
+	DefaultCheckInterval      = 15 * time.Second
+	DefaultFailureThreshold   = 3.0
+	DefaultAlertThreshold     = 1
+	DefaultExpireOnPeerLeave  = true
+	DefaultCleanupInterval    = 2 * time.Second
+	DefaultPersistMetrics     = false
+	DefaultStrictMetricPeer   = false
+	DefaultDeduplicateMetrics = false
+	DefaultTopic              = "monitor.metrics"
+	DefaultMetricRateLimit    = 0
+	DefaultMetricBurst        = 100
+	DefaultMetricCompression  = ""
+	DefaultAlertHistorySize   = 100
+	DefaultAlertHistoryAge    = 24 * time.Hour
+
+	DefaultReconnectInterval   = 0
+	DefaultReconnectMaxBackoff = 5 * time.Minute
+	DefaultReconnectMaxDials   = 8
+
+	DefaultGossipSubFloodPublish = true
+)
+
+// Limits for the GossipSub parameters.
+const (
+	minGossipSubHeartbeatInterval = 10 * time.Millisecond
+	maxGossipSubHeartbeatInterval = time.Minute
+	maxGossipSubHistoryLength     = 1000
 )
 
+var zero float64
+
+// DefaultMetricConstraints require the metrics produced by the informers
+// included in cluster to be non-negative numbers.
+var DefaultMetricConstraints = map[string]MetricConstraint{
+	"freespace": {Numeric: true, Min: &zero},
+	"numpin":    {Numeric: true, Min: &zero},
+}
+
+// MetricConstraint describes the values accepted for a metric. Received
+// metrics which do not satisfy the constraint for their name are marked as
+// invalid, so that they are not used for allocations.
+type MetricConstraint struct {
+	// Numeric requires the value to be a finite number. It is implied
+	// when Min or Max are set.
+	Numeric bool `json:"numeric"`
+	// Min is the lowest allowed value, when set.
+	Min *float64 `json:"min,omitempty"`
+	// Max is the highest allowed value, when set.
+	Max *float64 `json:"max,omitempty"`
+}
+
+// Check returns an error describing why the given metric value does not
+// satisfy the constraint, or nil.
+func (mc MetricConstraint) Check(value string) error {
+	if !mc.Numeric && mc.Min == nil && mc.Max == nil {
+		return nil
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Errorf("value %q is not a finite number", value)
+	}
+	if mc.Min != nil && v < *mc.Min {
+		return fmt.Errorf("value %s is lower than %g", value, *mc.Min)
+	}
+	if mc.Max != nil && v > *mc.Max {
+		return fmt.Errorf("value %s is higher than %g", value, *mc.Max)
+	}
+	return nil
+}
+
 // Config allows to initialize a Monitor and customize some parameters.
 type Config struct {
 	config.Saver
@@ -27,11 +99,122 @@ type Config struct {
 	// The greater the threshold value the more leniency is granted.
 	// A value between 2.0 and 4.0 is suggested for the threshold.
 	FailureThreshold float64
+	// AlertThreshold is the number of consecutive checks (every
+	// CheckInterval) which must find a metric failed before alerting
+	// about it, so that brief absences are tolerated. A single fresh
+	// metric restarts the count.
+	AlertThreshold int
+	// MetricConstraints holds, by metric name, the values that are
+	// accepted for received metrics.
+	MetricConstraints map[string]MetricConstraint
+	// ExpireOnPeerLeave makes the metrics of peers leaving the cluster
+	// expire as soon as they leave, rather than when their TTL runs out.
+	ExpireOnPeerLeave bool
+	// WindowCap is the number of metrics of each name retained for
+	// every peer. They are used for failure detection and MetricStats.
+	WindowCap int
+	// DecayHalfLife makes LatestMetrics return, for numeric metrics, the
+	// average of the values in the window weighted by their age, so that
+	// the contribution of older metrics halves every DecayHalfLife. 0
+	// returns the last values as they are.
+	DecayHalfLife time.Duration
+	// DeduplicateMetrics makes a received metric which is identical to
+	// the last one stored for the same name and peer (same value, weight
+	// and tags) refresh its expiry, instead of taking a new slot in the
+	// window. Windows then hold only the changes of value. Failure
+	// detection still accounts for every metric received.
+	DeduplicateMetrics bool
+	// CleanupInterval specifies how often the stored metrics are swept
+	// to remove those which expired and are considered failed (alerting
+	// about them first if needed), independently of CheckInterval.
+	CleanupInterval time.Duration
+	// PersistMetrics saves the last known metrics of every peer on
+	// shutdown and reloads them on start, so that allocations can be
+	// made before peers publish their metrics again.
+	PersistMetrics bool
+	// StrictMetricPeer drops received metrics which are about a peer
+	// other than the one that published them. It can only be enabled
+	// once no peer relays metrics about others.
+	StrictMetricPeer bool
+	// ReconnectInterval enables dialing, at this interval, the peers in
+	// the peerset which are not connected to the metrics topic, rather
+	// than waiting for pubsub to discover them. Peers which cannot be
+	// dialed are retried with exponential backoff up to
+	// ReconnectMaxBackoff. 0 disables it.
+	ReconnectInterval   time.Duration
+	ReconnectMaxBackoff time.Duration
+	// ReconnectMaxDials limits the concurrent dials.
+	ReconnectMaxDials int
+	// MetricRateLimit is the number of metrics per second accepted from
+	// every publishing peer, on average. Peers can exceed it in bursts
+	// of up to MetricBurst metrics, like when they start. Metrics over
+	// the limit are dropped. 0 disables the limit.
+	MetricRateLimit float64
+	MetricBurst     int
+	// MetricCompression compresses the metric messages published by
+	// this peer with "gzip" or "snappy", when it makes them smaller.
+	// Peers decode compressed messages regardless of their own setting,
+	// but peers in versions without support for compression ignore
+	// them, so it should only be enabled once all peers are upgraded.
+	// Empty (default) publishes uncompressed messages.
+	MetricCompression string
+	// AlertHistorySize is the number of alerts retained to be returned
+	// by RecentAlerts, and AlertHistoryAge how long they are retained
+	// (0 for as long as there is room). A size of 0 disables the
+	// history.
+	AlertHistorySize int
+	AlertHistoryAge  time.Duration
+	// Topic is the pubsub topic on which metrics are published and
+	// received. Clusters sharing a libp2p network should use different
+	// topics so that they do not see each other's metrics (the CRDT
+	// consensus topic is given by its cluster_name instead). All the
+	// peers in a cluster must use the same topic.
+	Topic string
+	// GossipSubHeartbeatInterval, GossipSubHistoryLength and
+	// GossipSubFloodPublish tune the pubsub router shared by the
+	// monitor and the CRDT consensus (see GossipSubOptions). Shorter
+	// heartbeats discover peers and repair the mesh faster at the cost
+	// of more traffic. The history length is the number of heartbeats
+	// during which received messages are remembered for gossip. Flood
+	// publishing sends our own messages to every known peer in the
+	// topic rather than only to the mesh. The heartbeat interval and
+	// history length default to those of the GossipSub implementation.
+	GossipSubHeartbeatInterval time.Duration
+	GossipSubHistoryLength     int
+	GossipSubFloodPublish      bool
 }
 
 type jsonConfig struct {
-	CheckInterval    string   `json:"check_interval"`
-	FailureThreshold *float64 `json:"failure_threshold"`
+	CheckInterval      string                      `json:"check_interval"`
+	FailureThreshold   *float64                    `json:"failure_threshold"`
+	AlertThreshold     int                         `json:"alert_threshold,omitempty"`
+	MetricConstraints  map[string]MetricConstraint `json:"metric_constraints,omitempty"`
+	ExpireOnPeerLeave  *bool                       `json:"expire_on_peer_leave"`
+	WindowCap          int                         `json:"window_cap"`
+	DecayHalfLife      string                      `json:"decay_half_life"`
+	DeduplicateMetrics bool                        `json:"deduplicate_metrics,omitempty"`
+	CleanupInterval    string                      `json:"cleanup_interval"`
+	PersistMetrics     bool                        `json:"persist_metrics"`
+
+	StrictMetricPeer bool `json:"strict_metric_peer,omitempty"`
+
+	ReconnectInterval   string `json:"reconnect_interval,omitempty"`
+	ReconnectMaxBackoff string `json:"reconnect_max_backoff,omitempty"`
+	ReconnectMaxDials   int    `json:"reconnect_max_dials,omitempty"`
+
+	Topic string `json:"topic,omitempty"`
+
+	MetricRateLimit float64 `json:"metric_rate_limit,omitempty"`
+	MetricBurst     int     `json:"metric_burst,omitempty"`
+
+	MetricCompression string `json:"metric_compression,omitempty"`
+
+	AlertHistorySize *int   `json:"alert_history_size,omitempty"`
+	AlertHistoryAge  string `json:"alert_history_age,omitempty"`
+
+	GossipSubHeartbeatInterval string `json:"gossipsub_heartbeat_interval,omitempty"`
+	GossipSubHistoryLength     int    `json:"gossipsub_history_length,omitempty"`
+	GossipSubFloodPublish      *bool  `json:"gossipsub_flood_publish,omitempty"`
 }
 
 // ConfigKey provides a human-friendly identifier for this type of Config.
@@ -43,6 +226,27 @@ func (cfg *Config) ConfigKey() string {
 func (cfg *Config) Default() error {
 	cfg.CheckInterval = DefaultCheckInterval
 	cfg.FailureThreshold = DefaultFailureThreshold
+	cfg.AlertThreshold = DefaultAlertThreshold
+	cfg.MetricConstraints = DefaultMetricConstraints
+	cfg.ExpireOnPeerLeave = DefaultExpireOnPeerLeave
+	cfg.WindowCap = metrics.DefaultWindowCap
+	cfg.DecayHalfLife = 0
+	cfg.DeduplicateMetrics = DefaultDeduplicateMetrics
+	cfg.CleanupInterval = DefaultCleanupInterval
+	cfg.PersistMetrics = DefaultPersistMetrics
+	cfg.StrictMetricPeer = DefaultStrictMetricPeer
+	cfg.ReconnectInterval = DefaultReconnectInterval
+	cfg.ReconnectMaxBackoff = DefaultReconnectMaxBackoff
+	cfg.ReconnectMaxDials = DefaultReconnectMaxDials
+	cfg.Topic = PubsubTopic
+	cfg.MetricRateLimit = DefaultMetricRateLimit
+	cfg.MetricBurst = DefaultMetricBurst
+	cfg.MetricCompression = DefaultMetricCompression
+	cfg.AlertHistorySize = DefaultAlertHistorySize
+	cfg.AlertHistoryAge = DefaultAlertHistoryAge
+	cfg.GossipSubHeartbeatInterval = pubsub.GossipSubHeartbeatInterval
+	cfg.GossipSubHistoryLength = pubsub.GossipSubHistoryLength
+	cfg.GossipSubFloodPublish = DefaultGossipSubFloodPublish
 	return nil
 }
 
@@ -70,9 +274,92 @@ func (cfg *Config) Validate() error {
 		return errors.New("pubsubmon.failure_threshold too low")
 	}
 
+	if cfg.AlertThreshold < 1 {
+		return errors.New("pubsubmon.alert_threshold too low")
+	}
+
+	if cfg.WindowCap < 2 {
+		return errors.New("pubsubmon.window_cap should be at least 2")
+	}
+
+	if cfg.DecayHalfLife < 0 {
+		return errors.New("pubsubmon.decay_half_life is invalid")
+	}
+
+	if cfg.CleanupInterval <= 0 {
+		return errors.New("pubsubmon.cleanup_interval too low")
+	}
+
+	if cfg.ReconnectInterval < 0 {
+		return errors.New("pubsubmon.reconnect_interval is invalid")
+	}
+
+	if cfg.ReconnectInterval > 0 && cfg.ReconnectMaxBackoff < cfg.ReconnectInterval {
+		return errors.New("pubsubmon.reconnect_max_backoff should be at least reconnect_interval")
+	}
+
+	if cfg.ReconnectMaxDials <= 0 {
+		return errors.New("pubsubmon.reconnect_max_dials too low")
+	}
+
+	if cfg.Topic == "" {
+		return errors.New("pubsubmon.topic is empty")
+	}
+
+	if cfg.MetricRateLimit < 0 || math.IsNaN(cfg.MetricRateLimit) || math.IsInf(cfg.MetricRateLimit, 0) {
+		return errors.New("pubsubmon.metric_rate_limit is invalid")
+	}
+
+	if cfg.MetricBurst <= 0 {
+		return errors.New("pubsubmon.metric_burst too low")
+	}
+
+	if _, ok := compressionFormats[cfg.MetricCompression]; !ok && cfg.MetricCompression != "" {
+		return errors.New("pubsubmon.metric_compression is invalid")
+	}
+
+	if cfg.AlertHistorySize < 0 {
+		return errors.New("pubsubmon.alert_history_size is invalid")
+	}
+
+	if cfg.AlertHistoryAge < 0 {
+		return errors.New("pubsubmon.alert_history_age is invalid")
+	}
+
+	for _, mc := range cfg.MetricConstraints {
+		if mc.Min != nil && mc.Max != nil && *mc.Min > *mc.Max {
+			return errors.New("pubsubmon.metric_constraints is invalid")
+		}
+	}
+
+	if cfg.GossipSubHeartbeatInterval < minGossipSubHeartbeatInterval ||
+		cfg.GossipSubHeartbeatInterval > maxGossipSubHeartbeatInterval {
+		return fmt.Errorf("pubsubmon.gossipsub_heartbeat_interval should be between %s and %s", minGossipSubHeartbeatInterval, maxGossipSubHeartbeatInterval)
+	}
+
+	// GossipSub advertises the messages seen in the last
+	// GossipSubHistoryGossip heartbeats, which must be remembered.
+	if cfg.GossipSubHistoryLength < pubsub.GossipSubHistoryGossip ||
+		cfg.GossipSubHistoryLength > maxGossipSubHistoryLength {
+		return fmt.Errorf("pubsubmon.gossipsub_history_length should be between %d and %d", pubsub.GossipSubHistoryGossip, maxGossipSubHistoryLength)
+	}
+
 	return nil
 }
 
+// GossipSubOptions returns the options with which the cluster pubsub
+// instance should be created to apply the GossipSub parameters of this
+// configuration.
+func (cfg *Config) GossipSubOptions() []pubsub.Option {
+	params := pubsub.DefaultGossipSubParams()
+	params.HeartbeatInterval = cfg.GossipSubHeartbeatInterval
+	params.HistoryLength = cfg.GossipSubHistoryLength
+	return []pubsub.Option{
+		pubsub.WithGossipSubParams(params),
+		pubsub.WithFloodPublish(cfg.GossipSubFloodPublish),
+	}
+}
+
 // LoadJSON sets the fields of this Config to the values defined by the JSON
 // representation of it, as generated by ToJSON.
 func (cfg *Config) LoadJSON(raw []byte) error {
@@ -94,6 +381,41 @@ func (cfg *Config) applyJSONConfig(jcfg *jsonConfig) error {
 	if jcfg.FailureThreshold != nil {
 		cfg.FailureThreshold = *jcfg.FailureThreshold
 	}
+	config.SetIfNotDefault(jcfg.AlertThreshold, &cfg.AlertThreshold)
+	if jcfg.MetricConstraints != nil {
+		cfg.MetricConstraints = jcfg.MetricConstraints
+	}
+	if jcfg.ExpireOnPeerLeave != nil {
+		cfg.ExpireOnPeerLeave = *jcfg.ExpireOnPeerLeave
+	}
+	config.SetIfNotDefault(jcfg.WindowCap, &cfg.WindowCap)
+	cfg.PersistMetrics = jcfg.PersistMetrics
+	cfg.StrictMetricPeer = jcfg.StrictMetricPeer
+	cfg.DeduplicateMetrics = jcfg.DeduplicateMetrics
+	config.SetIfNotDefault(jcfg.ReconnectMaxDials, &cfg.ReconnectMaxDials)
+	config.SetIfNotDefault(jcfg.Topic, &cfg.Topic)
+	cfg.MetricRateLimit = jcfg.MetricRateLimit
+	config.SetIfNotDefault(jcfg.MetricBurst, &cfg.MetricBurst)
+	cfg.MetricCompression = jcfg.MetricCompression
+	if jcfg.AlertHistorySize != nil {
+		cfg.AlertHistorySize = *jcfg.AlertHistorySize
+	}
+	config.SetIfNotDefault(jcfg.GossipSubHistoryLength, &cfg.GossipSubHistoryLength)
+	if jcfg.GossipSubFloodPublish != nil {
+		cfg.GossipSubFloodPublish = *jcfg.GossipSubFloodPublish
+	}
+	err := config.ParseDurations(
+		"pubsubmon",
+		&config.DurationOpt{Duration: jcfg.DecayHalfLife, Dst: &cfg.DecayHalfLife, Name: "decay_half_life"},
+		&config.DurationOpt{Duration: jcfg.CleanupInterval, Dst: &cfg.CleanupInterval, Name: "cleanup_interval"},
+		&config.DurationOpt{Duration: jcfg.ReconnectInterval, Dst: &cfg.ReconnectInterval, Name: "reconnect_interval"},
+		&config.DurationOpt{Duration: jcfg.ReconnectMaxBackoff, Dst: &cfg.ReconnectMaxBackoff, Name: "reconnect_max_backoff"},
+		&config.DurationOpt{Duration: jcfg.GossipSubHeartbeatInterval, Dst: &cfg.GossipSubHeartbeatInterval, Name: "gossipsub_heartbeat_interval"},
+		&config.DurationOpt{Duration: jcfg.AlertHistoryAge, Dst: &cfg.AlertHistoryAge, Name: "alert_history_age"},
+	)
+	if err != nil {
+		return err
+	}
 
 	return cfg.Validate()
 }
@@ -106,10 +428,54 @@ func (cfg *Config) ToJSON() ([]byte, error) {
 }
 
 func (cfg *Config) toJSONConfig() *jsonConfig {
-	return &jsonConfig{
-		CheckInterval:    cfg.CheckInterval.String(),
-		FailureThreshold: &cfg.FailureThreshold,
+	jcfg := &jsonConfig{
+		CheckInterval:      cfg.CheckInterval.String(),
+		FailureThreshold:   &cfg.FailureThreshold,
+		MetricConstraints:  cfg.MetricConstraints,
+		ExpireOnPeerLeave:  &cfg.ExpireOnPeerLeave,
+		WindowCap:          cfg.WindowCap,
+		DecayHalfLife:      cfg.DecayHalfLife.String(),
+		DeduplicateMetrics: cfg.DeduplicateMetrics,
+		CleanupInterval:    cfg.CleanupInterval.String(),
+		PersistMetrics:     cfg.PersistMetrics,
+		StrictMetricPeer:   cfg.StrictMetricPeer,
+	}
+	if cfg.AlertThreshold != DefaultAlertThreshold {
+		jcfg.AlertThreshold = cfg.AlertThreshold
+	}
+	if cfg.ReconnectInterval > 0 {
+		jcfg.ReconnectInterval = cfg.ReconnectInterval.String()
+	}
+	if cfg.ReconnectMaxBackoff != DefaultReconnectMaxBackoff {
+		jcfg.ReconnectMaxBackoff = cfg.ReconnectMaxBackoff.String()
+	}
+	if cfg.ReconnectMaxDials != DefaultReconnectMaxDials {
+		jcfg.ReconnectMaxDials = cfg.ReconnectMaxDials
+	}
+	if cfg.Topic != DefaultTopic {
+		jcfg.Topic = cfg.Topic
+	}
+	jcfg.MetricRateLimit = cfg.MetricRateLimit
+	if cfg.MetricBurst != DefaultMetricBurst {
+		jcfg.MetricBurst = cfg.MetricBurst
+	}
+	jcfg.MetricCompression = cfg.MetricCompression
+	if cfg.AlertHistorySize != DefaultAlertHistorySize {
+		jcfg.AlertHistorySize = &cfg.AlertHistorySize
+	}
+	if cfg.AlertHistoryAge != DefaultAlertHistoryAge {
+		jcfg.AlertHistoryAge = cfg.AlertHistoryAge.String()
+	}
+	if cfg.GossipSubHeartbeatInterval != pubsub.GossipSubHeartbeatInterval {
+		jcfg.GossipSubHeartbeatInterval = cfg.GossipSubHeartbeatInterval.String()
+	}
+	if cfg.GossipSubHistoryLength != pubsub.GossipSubHistoryLength {
+		jcfg.GossipSubHistoryLength = cfg.GossipSubHistoryLength
+	}
+	if cfg.GossipSubFloodPublish != DefaultGossipSubFloodPublish {
+		jcfg.GossipSubFloodPublish = &cfg.GossipSubFloodPublish
 	}
+	return jcfg
 }
 
 // ToDisplayJSON returns JSON config as a string.
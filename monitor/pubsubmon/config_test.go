@@ -10,7 +10,13 @@ import (
 var cfgJSON = []byte(`
 {
       "check_interval": "15s",
-      "failure_threshold": 3.0
+      "failure_threshold": 3.0,
+      "metric_constraints": {
+            "freespace": {
+                  "numeric": true,
+                  "min": 0
+            }
+      }
 }
 `)
 
@@ -30,6 +36,148 @@ func TestLoadJSON(t *testing.T) {
 	if err == nil {
 		t.Error("expected error decoding check_interval")
 	}
+
+	json.Unmarshal(cfgJSON, j)
+	j.DecayHalfLife = "1m"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DecayHalfLife != time.Minute {
+		t.Error("expected decay_half_life to be parsed")
+	}
+
+	json.Unmarshal(cfgJSON, j)
+	j.StrictMetricPeer = true
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.StrictMetricPeer {
+		t.Error("expected strict_metric_peer to be parsed")
+	}
+
+	json.Unmarshal(cfgJSON, j)
+	j.DeduplicateMetrics = true
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.DeduplicateMetrics {
+		t.Error("expected deduplicate_metrics to be parsed")
+	}
+
+	json.Unmarshal(cfgJSON, j)
+	j.ReconnectInterval = "10s"
+	j.ReconnectMaxBackoff = "1m"
+	j.ReconnectMaxDials = 2
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ReconnectInterval != 10*time.Second || cfg.ReconnectMaxBackoff != time.Minute || cfg.ReconnectMaxDials != 2 {
+		t.Error("expected the reconnect options to be parsed")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.Topic = "other-cluster.metrics"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Topic != "other-cluster.metrics" {
+		t.Error("expected topic to be parsed")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.MetricRateLimit = 2.5
+	j.MetricBurst = 10
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MetricRateLimit != 2.5 || cfg.MetricBurst != 10 {
+		t.Error("expected the metric rate limit options to be parsed")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.MetricCompression = "gzip"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MetricCompression != "gzip" {
+		t.Error("expected metric_compression to be parsed")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	noHistory := 0
+	j.AlertHistorySize = &noHistory
+	j.AlertHistoryAge = "1h"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AlertHistorySize != 0 || cfg.AlertHistoryAge != time.Hour {
+		t.Error("expected the alert history options to be parsed")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.AlertThreshold = 3
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AlertThreshold != 3 {
+		t.Error("expected alert_threshold to be parsed")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	noFlood := false
+	j.GossipSubHeartbeatInterval = "500ms"
+	j.GossipSubHistoryLength = 10
+	j.GossipSubFloodPublish = &noFlood
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.GossipSubHeartbeatInterval != 500*time.Millisecond ||
+		cfg.GossipSubHistoryLength != 10 ||
+		cfg.GossipSubFloodPublish {
+		t.Error("expected the gossipsub options to be parsed")
+	}
+
+	j.GossipSubHeartbeatInterval = "1ms"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with a too short gossipsub_heartbeat_interval")
+	}
+
+	j = &jsonConfig{}
+	json.Unmarshal(cfgJSON, j)
+	j.ReconnectInterval = "10m"
+	tst, _ = json.Marshal(j)
+	err = cfg.LoadJSON(tst)
+	if err == nil {
+		t.Error("expected error with a reconnect_interval over reconnect_max_backoff")
+	}
 }
 
 func TestToJSON(t *testing.T) {
@@ -52,12 +200,106 @@ func TestDefault(t *testing.T) {
 	if cfg.Validate() != nil {
 		t.Fatal("error validating")
 	}
+	if cfg.PersistMetrics {
+		t.Error("persist_metrics should be disabled by default")
+	}
+	if cfg.StrictMetricPeer {
+		t.Error("strict_metric_peer should be disabled by default")
+	}
+	if cfg.DeduplicateMetrics {
+		t.Error("deduplicate_metrics should be disabled by default")
+	}
+	if cfg.ReconnectInterval != 0 {
+		t.Error("the reconnector should be disabled by default")
+	}
+	if cfg.Topic != "monitor.metrics" {
+		t.Error("the default topic should not change:", cfg.Topic)
+	}
 
 	cfg.CheckInterval = 0
 	cfg.FailureThreshold = -0.1
 	if cfg.Validate() == nil {
 		t.Fatal("expected error validating")
 	}
+
+	cfg.Default()
+	cfg.AlertThreshold = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.WindowCap = 1
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.DecayHalfLife = -time.Second
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.CleanupInterval = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.ReconnectInterval = -time.Second
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.ReconnectMaxDials = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.Topic = ""
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.MetricRateLimit = -1
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.MetricRateLimit = 10
+	cfg.MetricBurst = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.MetricCompression = "lz4"
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.AlertHistoryAge = -time.Second
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.GossipSubHeartbeatInterval = 2 * time.Minute
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+
+	cfg.Default()
+	cfg.GossipSubHistoryLength = 1
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
 }
 
 func TestApplyEnvVars(t *testing.T) {
@@ -73,3 +315,33 @@ func TestApplyEnvVars(t *testing.T) {
 		t.Fatal("failed to override failure_threshold with env var")
 	}
 }
+
+func TestMetricConstraintCheck(t *testing.T) {
+	min := 0.0
+	max := 10.0
+	mc := MetricConstraint{Min: &min, Max: &max}
+
+	for _, v := range []string{"0", "5", "10"} {
+		if err := mc.Check(v); err != nil {
+			t.Errorf("%s should be valid: %s", v, err)
+		}
+	}
+	for _, v := range []string{"-1", "11", "NaN", "+Inf", "abc", ""} {
+		if err := mc.Check(v); err == nil {
+			t.Errorf("%s should be invalid", v)
+		}
+	}
+
+	if err := (MetricConstraint{}).Check("abc"); err != nil {
+		t.Error("an empty constraint should accept anything")
+	}
+
+	cfg := &Config{}
+	cfg.Default()
+	cfg.MetricConstraints = map[string]MetricConstraint{
+		"test": {Min: &max, Max: &min},
+	}
+	if cfg.Validate() == nil {
+		t.Error("expected error validating")
+	}
+}
@@ -0,0 +1,100 @@
+package pubsubmon
+
+import (
+	"context"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	gocodec "github.com/ugorji/go/codec"
+)
+
+// metricsNamespace is the datastore namespace under which
+// DatastoreMetricsStore keeps the metrics.
+var metricsNamespace = ds.NewKey("/pubsubmon/metrics")
+
+// MetricsStore persists the last known metrics of every peer, so that a
+// Monitor with PersistMetrics enabled can reload them when it is created
+// instead of starting empty.
+type MetricsStore interface {
+	// SaveMetrics replaces the stored metrics with the given ones.
+	SaveMetrics(ctx context.Context, metrics []*api.Metric) error
+	// LoadMetrics returns the stored metrics.
+	LoadMetrics(ctx context.Context) ([]*api.Metric, error)
+}
+
+// DatastoreMetricsStore is a MetricsStore backed by a go-datastore, usually
+// the cluster peer datastore.
+type DatastoreMetricsStore struct {
+	dstore ds.Datastore
+}
+
+// NewDatastoreMetricsStore returns a MetricsStore which keeps the metrics
+// in the given datastore.
+func NewDatastoreMetricsStore(dstore ds.Datastore) *DatastoreMetricsStore {
+	return &DatastoreMetricsStore{dstore: dstore}
+}
+
+func metricKey(m *api.Metric) ds.Key {
+	return metricsNamespace.ChildString(peer.Encode(m.Peer)).ChildString(m.Name)
+}
+
+// SaveMetrics replaces the stored metrics with the given ones.
+func (dms *DatastoreMetricsStore) SaveMetrics(ctx context.Context, metrics []*api.Metric) error {
+	results, err := dms.dstore.Query(ctx, query.Query{
+		Prefix:   metricsNamespace.String(),
+		KeysOnly: true,
+	})
+	if err != nil {
+		return err
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := dms.dstore.Delete(ctx, ds.NewKey(e.Key)); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range metrics {
+		var b []byte
+		enc := gocodec.NewEncoderBytes(&b, msgpackHandle)
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+		if err := dms.dstore.Put(ctx, metricKey(m), b); err != nil {
+			return err
+		}
+	}
+	return dms.dstore.Sync(ctx, metricsNamespace)
+}
+
+// LoadMetrics returns the stored metrics.
+func (dms *DatastoreMetricsStore) LoadMetrics(ctx context.Context) ([]*api.Metric, error) {
+	results, err := dms.dstore.Query(ctx, query.Query{
+		Prefix: metricsNamespace.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var metrics []*api.Metric
+	for r := range results.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		m := &api.Metric{}
+		dec := gocodec.NewDecoderBytes(r.Value, msgpackHandle)
+		if err := dec.Decode(m); err != nil {
+			logger.Errorf("error decoding stored metric %s: %s", r.Key, err)
+			continue
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
@@ -0,0 +1,53 @@
+package pubsubmon
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/datastore/inmem"
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+func TestPersistMetrics(t *testing.T) {
+	ctx := context.Background()
+	mstore := NewDatastoreMetricsStore(inmem.New())
+	mf := newMetricFactory()
+
+	pm, _, shutdown := testPeerMonitorWithStore(t, mstore)
+	m := mf.newMetric("test", test.PeerID1)
+	m.SetTTL(time.Minute)
+	pm.LogMetric(ctx, m)
+	shutdown()
+
+	saved, err := mstore.LoadMetrics(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 1 || saved[0].Value != m.Value || saved[0].Expire != m.Expire {
+		t.Fatalf("expected the metric to be saved on shutdown; got %v", saved)
+	}
+
+	// Add an expired metric, which should not be reloaded.
+	expired := mf.newMetric("test", test.PeerID2)
+	expired.SetTTL(0)
+	err = mstore.SaveMetrics(ctx, []*api.Metric{saved[0], expired})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pm, _, shutdown = testPeerMonitorWithStore(t, mstore)
+	defer shutdown()
+
+	latest := pm.LatestMetrics(ctx, "test")
+	if len(latest) != 1 {
+		t.Fatalf("expected 1 reloaded metric; got %v", latest)
+	}
+	if latest[0].Peer != test.PeerID1 || latest[0].Value != m.Value || latest[0].Expire != m.Expire {
+		t.Errorf("reloaded metric differs: %+v", latest[0])
+	}
+	if len(pm.metrics.PeerMetrics(test.PeerID2)) != 0 {
+		t.Error("expired metrics should not be reloaded")
+	}
+}
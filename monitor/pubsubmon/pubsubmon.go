@@ -11,23 +11,35 @@ import (
 
 	"github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/monitor/metrics"
+	"github.com/ipfs/ipfs-cluster/observations"
 
 	logging "github.com/ipfs/go-log/v2"
+	host "github.com/libp2p/go-libp2p-core/host"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	rpc "github.com/libp2p/go-libp2p-gorpc"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	gocodec "github.com/ugorji/go/codec"
 
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
 	"go.opencensus.io/trace"
 )
 
 var logger = logging.Logger("monitor")
 
-// PubsubTopic specifies the topic used to publish Cluster metrics.
-var PubsubTopic = "monitor.metrics"
+// PubsubTopic specifies the default topic used to publish Cluster metrics.
+//
+// Deprecated: set the Topic in the Config instead.
+var PubsubTopic = DefaultTopic
 
 var msgpackHandle = &gocodec.MsgpackHandle{}
 
+// batchPrefix precedes the messages carrying several metrics, followed by
+// their msgpack-encoded slice. It starts with 0xc1, which is never used in
+// msgpack, so that messages carrying a single metric are not mistaken for
+// batches. The second byte is the version of the batch format.
+var batchPrefix = []byte{0xc1, 1}
+
 // Monitor is a component in charge of monitoring peers, logging
 // metrics and detecting failures
 type Monitor struct {
@@ -43,9 +55,22 @@ type Monitor struct {
 
 	metrics *metrics.Store
 	checker *metrics.Checker
+	mstore  MetricsStore
+	// limiter is nil when MetricRateLimit is not set.
+	limiter *rateLimiter
+
+	// alerts from the checker are dispatched to alertCh and to the
+	// channels returned by AlertsForMetric.
+	alertCh     chan *api.Alert
+	alertSubsMu sync.RWMutex
+	alertSubs   map[string][]chan *api.Alert
+	// alertHistory is nil when AlertHistorySize is 0.
+	alertHistory *alertHistory
 
 	config *Config
 
+	decodeWarningOnce sync.Once
+
 	shutdownLock sync.Mutex
 	shutdown     bool
 	wg           sync.WaitGroup
@@ -55,26 +80,55 @@ type Monitor struct {
 // that do not belong to a given peerset.
 type PeersFunc func(context.Context) ([]peer.ID, error)
 
-// New creates a new PubSub monitor, using the given host, config and
+// New creates a new PubSub monitor, using the given config, pubsub, host and
 // PeersFunc. The PeersFunc can be nil. In this case, no metric filtering is
-// done based on peers (any peer is considered part of the peerset).
+// done based on peers (any peer is considered part of the peerset). When
+// PersistMetrics is enabled, the last known metrics are reloaded from the
+// given MetricsStore, which can be nil otherwise, and saved to it on
+// Shutdown. The host is used to dial missing peers when ReconnectInterval is
+// set, and can be nil otherwise.
 func New(
 	ctx context.Context,
 	cfg *Config,
 	psub *pubsub.PubSub,
+	h host.Host,
 	peers PeersFunc,
+	mstore MetricsStore,
 ) (*Monitor, error) {
 	err := cfg.Validate()
 	if err != nil {
 		return nil, err
 	}
+	if !cfg.PersistMetrics {
+		mstore = nil
+	}
 
 	ctx, cancel := context.WithCancel(ctx)
 
-	mtrs := metrics.NewStore()
+	mtrs := metrics.NewStoreWithWindowCap(cfg.WindowCap)
+	mtrs.SetDecayHalfLife(cfg.DecayHalfLife)
+	mtrs.SetDeduplicate(cfg.DeduplicateMetrics)
+	if mstore != nil {
+		loaded, err := mstore.LoadMetrics(ctx)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		n := 0
+		for _, m := range loaded {
+			// Expire is kept, so expired metrics are ignored.
+			if m.Discard() {
+				continue
+			}
+			mtrs.Add(m)
+			n++
+		}
+		logger.Infof("reloaded %d stored metrics", n)
+	}
 	checker := metrics.NewChecker(ctx, mtrs, cfg.FailureThreshold)
+	checker.SetAlertThreshold(cfg.AlertThreshold)
 
-	topic, err := psub.Join(PubsubTopic)
+	topic, err := psub.Join(cfg.Topic)
 	if err != nil {
 		cancel()
 		return nil, err
@@ -97,32 +151,105 @@ func New(
 
 		metrics: mtrs,
 		checker: checker,
+		mstore:  mstore,
 		config:  cfg,
+
+		alertCh:   make(chan *api.Alert, metrics.AlertChannelCap),
+		alertSubs: make(map[string][]chan *api.Alert),
+
+		alertHistory: newAlertHistory(cfg.AlertHistorySize, cfg.AlertHistoryAge),
+	}
+	if cfg.MetricRateLimit > 0 {
+		mon.limiter = newRateLimiter(cfg.MetricRateLimit, cfg.MetricBurst)
 	}
 
+	mon.wg.Add(1)
+	go mon.dispatchAlerts()
+	if cfg.ReconnectInterval > 0 && h != nil {
+		r := &reconnector{
+			host:       h,
+			topic:      topic,
+			peers:      mon.monitoredPeers,
+			interval:   cfg.ReconnectInterval,
+			maxBackoff: cfg.ReconnectMaxBackoff,
+			maxDials:   cfg.ReconnectMaxDials,
+			backoff:    make(map[peer.ID]*peerBackoff),
+		}
+		mon.wg.Add(1)
+		go func() {
+			defer mon.wg.Done()
+			r.run(ctx)
+		}()
+	}
 	go mon.run()
 	return mon, nil
 }
 
+// monitoredPeers returns the peerset or, without PeersFunc, the peers which
+// have sent metrics.
+func (mon *Monitor) monitoredPeers(ctx context.Context) ([]peer.ID, error) {
+	if mon.peers != nil {
+		return mon.peers(ctx)
+	}
+	seen := make(map[peer.ID]struct{})
+	var peers []peer.ID
+	for _, m := range mon.metrics.AllMetrics() {
+		if _, ok := seen[m.Peer]; !ok {
+			seen[m.Peer] = struct{}{}
+			peers = append(peers, m.Peer)
+		}
+	}
+	return peers, nil
+}
+
 func (mon *Monitor) run() {
 	select {
 	case <-mon.rpcReady:
 		go mon.logFromPubsub()
-		go mon.checker.Watch(mon.ctx, mon.peers, mon.config.CheckInterval)
+		go mon.checker.WatchAndSweep(mon.ctx, mon.peers, mon.config.CheckInterval, mon.config.CleanupInterval)
+		go mon.recordStaleness()
 	case <-mon.ctx.Done():
 	}
 }
 
+// dispatchAlerts delivers the alerts sent by the checker to the Alerts
+// channel and to the AlertsForMetric channels for their metric, and records
+// them in the alert history. Channels which are full miss the alert, so that
+// a slow consumer does not block the others.
+func (mon *Monitor) dispatchAlerts() {
+	defer mon.wg.Done()
+
+	for {
+		select {
+		case <-mon.ctx.Done():
+			return
+		case alrt := <-mon.checker.Alerts():
+			mon.alertHistory.add(alrt)
+
+			select {
+			case mon.alertCh <- alrt:
+			default:
+				logger.Errorf("alerts channel is full: dropping %s alert for %s", alrt.Name, alrt.Peer)
+			}
+
+			mon.alertSubsMu.RLock()
+			for _, ch := range mon.alertSubs[alrt.Name] {
+				select {
+				case ch <- alrt:
+				default:
+					logger.Warnf("%s alerts channel is full: dropping alert for %s", alrt.Name, alrt.Peer)
+				}
+			}
+			mon.alertSubsMu.RUnlock()
+		}
+	}
+}
+
 // logFromPubsub logs metrics received in the subscribed topic.
 func (mon *Monitor) logFromPubsub() {
 	ctx, span := trace.StartSpan(mon.ctx, "monitor/pubsub/logFromPubsub")
 	defer span.End()
 
-	decodeWarningPrinted := false
-	// Previous versions use multicodec with the following header, which
-	// we need to remove.
-	multicodecPrefix := append([]byte{byte(9)}, []byte("/msgpack\n")...)
-
 	for {
 		select {
 		case <-ctx.Done():
@@ -132,39 +259,86 @@ func (mon *Monitor) logFromPubsub() {
 			if err != nil { // context cancelled enters here
 				continue
 			}
+			mon.handleMessage(ctx, msg.GetFrom(), msg.GetData())
+		}
+	}
+}
+
+// handleMessage decodes the metrics in a pubsub message published by the
+// given peer and logs them, dropping those which were logged already.
+func (mon *Monitor) handleMessage(ctx context.Context, from peer.ID, data []byte) {
+	// Previous versions use multicodec with the following header, which
+	// we need to remove.
+	multicodecPrefix := append([]byte{byte(9)}, []byte("/msgpack\n")...)
+
+	if bytes.HasPrefix(data, compressedPrefix) {
+		msg, err := decompressMessage(data)
+		if err != nil {
+			logger.Error(err)
+			stats.Record(ctx, observations.PubsubDecodeErrors.M(1))
+			return
+		}
+		data = msg
+	}
 
-			data := msg.GetData()
-			buf := bytes.NewBuffer(data)
-			dec := gocodec.NewDecoder(buf, msgpackHandle)
-			metric := api.Metric{}
+	var metrics []*api.Metric
+	switch {
+	case bytes.HasPrefix(data, batchPrefix):
+		dec := gocodec.NewDecoderBytes(data[len(batchPrefix):], msgpackHandle)
+		if err := dec.Decode(&metrics); err != nil {
+			logger.Error(err)
+			stats.Record(ctx, observations.PubsubDecodeErrors.M(1))
+			return
+		}
+	default:
+		metric := api.Metric{}
+		dec := gocodec.NewDecoderBytes(data, msgpackHandle)
+		err := dec.Decode(&metric)
+		if err != nil && bytes.HasPrefix(data, multicodecPrefix) {
+			dec := gocodec.NewDecoderBytes(data[len(multicodecPrefix):], msgpackHandle)
 			err = dec.Decode(&metric)
-			if err != nil {
-				if bytes.HasPrefix(data, multicodecPrefix) {
-					buf := bytes.NewBuffer(data[len(multicodecPrefix):])
-					dec := gocodec.NewDecoder(buf, msgpackHandle)
-					err = dec.Decode(&metric)
-					if err != nil {
-						logger.Error(err)
-						continue
-					}
-					// managed to decode an older version metric. Warn about it once.
-					if !decodeWarningPrinted {
-						logger.Warning("Peers in versions <= v0.13.3 detected. These peers will not receive metrics from this or other newer peers. Please upgrade them.")
-						decodeWarningPrinted = true
-					}
-				} else {
-					logger.Error(err)
-					continue
-				}
+			if err == nil {
+				// managed to decode an older version metric. Warn about it once.
+				mon.decodeWarningOnce.Do(func() {
+					logger.Warning("Peers in versions <= v0.13.3 detected. These peers will not receive metrics from this or other newer peers. Please upgrade them.")
+				})
 			}
+		}
+		if err != nil {
+			logger.Error(err)
+			stats.Record(ctx, observations.PubsubDecodeErrors.M(1))
+			return
+		}
+		metrics = []*api.Metric{&metric}
+	}
 
-			debug("recieved", &metric)
+	for _, metric := range metrics {
+		debug("recieved", metric)
+		nameTag := tag.Upsert(observations.MetricNameKey, metric.Name)
+		stats.RecordWithTags(ctx, []tag.Mutator{nameTag}, observations.PubsubMessagesReceived.M(1))
 
-			err = mon.LogMetric(ctx, &metric)
-			if err != nil {
-				logger.Error(err)
-				continue
-			}
+		if mon.limiter != nil && !mon.limiter.allow(from, time.Now()) {
+			debug("rate-limited", metric)
+			stats.RecordWithTags(ctx, []tag.Mutator{nameTag}, observations.PubsubMessagesRateLimited.M(1))
+			continue
+		}
+
+		if mon.config.StrictMetricPeer && metric.Peer != from {
+			logger.Warnf("dropping %s metric about %s published by %s", metric.Name, metric.Peer, from)
+			stats.RecordWithTags(ctx, []tag.Mutator{nameTag}, observations.PubsubMessagesDropped.M(1))
+			continue
+		}
+
+		if latest := mon.metrics.PeerLatest(metric.Name, metric.Peer); latest != nil &&
+			latest.Expire == metric.Expire && latest.Value == metric.Value {
+			debug("duplicate", metric)
+			stats.RecordWithTags(ctx, []tag.Mutator{nameTag}, observations.PubsubMessagesDropped.M(1))
+			continue
+		}
+
+		if err := mon.LogMetric(ctx, metric); err != nil {
+			logger.Error(err)
+			stats.RecordWithTags(ctx, []tag.Mutator{nameTag}, observations.PubsubMessagesDropped.M(1))
 		}
 	}
 }
@@ -196,16 +370,40 @@ func (mon *Monitor) Shutdown(ctx context.Context) error {
 
 	mon.wg.Wait()
 	mon.shutdown = true
+
+	if mon.mstore != nil {
+		var latest []*api.Metric
+		for _, m := range mon.metrics.AllMetrics() {
+			if !m.Expired() {
+				latest = append(latest, m)
+			}
+		}
+		if err := mon.mstore.SaveMetrics(ctx, latest); err != nil {
+			logger.Errorf("error saving metrics: %s", err)
+			return err
+		}
+	}
 	return nil
 }
 
-// LogMetric stores a metric so it can later be retrieved.
+// LogMetric stores a metric so it can later be retrieved. Metrics whose
+// values do not satisfy the configured constraints are stored as invalid.
 func (mon *Monitor) LogMetric(ctx context.Context, m *api.Metric) error {
 	_, span := trace.StartSpan(ctx, "monitor/pubsub/LogMetric")
 	defer span.End()
 
+	if mc, ok := mon.config.MetricConstraints[m.Name]; ok && m.Valid {
+		if err := mc.Check(m.Value); err != nil {
+			logger.Warnf("marking %s metric from %s as invalid: %s", m.Name, m.Peer, err)
+			m.Valid = false
+		}
+	}
+
 	mon.metrics.Add(m)
 	debug("logged", m)
+	if err := mon.checker.Recovered(m); err != nil {
+		logger.Error(err)
+	}
 	return nil
 }
 
@@ -230,7 +428,7 @@ func (mon *Monitor) PublishMetric(ctx context.Context, m *api.Metric) error {
 
 	debug("publish", m)
 
-	err = mon.topic.Publish(ctx, b.Bytes())
+	err = mon.publish(ctx, b.Bytes())
 	if err != nil {
 		logger.Error(err)
 		return err
@@ -239,12 +437,68 @@ func (mon *Monitor) PublishMetric(ctx context.Context, m *api.Metric) error {
 	return nil
 }
 
+// PublishMetrics broadcasts several metrics to all current cluster peers in
+// a single message. Peers in versions without support for batches cannot
+// decode it and ignore it.
+func (mon *Monitor) PublishMetrics(ctx context.Context, metrics []*api.Metric) error {
+	ctx, span := trace.StartSpan(ctx, "monitor/pubsub/PublishMetrics")
+	defer span.End()
+
+	batch := make([]*api.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		if m.Discard() {
+			logger.Warnf("discarding invalid metric: %+v", m)
+			continue
+		}
+		batch = append(batch, m)
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+
+	b := bytes.NewBuffer(append([]byte{}, batchPrefix...))
+	enc := gocodec.NewEncoder(b, msgpackHandle)
+	err := enc.Encode(batch)
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	for _, m := range batch {
+		debug("publish", m)
+	}
+
+	err = mon.publish(ctx, b.Bytes())
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// publish publishes the given message on the metrics topic, compressed
+// according to MetricCompression.
+func (mon *Monitor) publish(ctx context.Context, msg []byte) error {
+	msg, err := compressMessage(mon.config.MetricCompression, msg)
+	if err != nil {
+		return err
+	}
+	return mon.topic.Publish(ctx, msg)
+}
+
 // LatestMetrics returns last known VALID metrics of a given type. A metric
 // is only valid if it has not expired and belongs to a current cluster peer.
+// Numeric values are decay-weighted when DecayHalfLife is set. The
+// StalenessMetricName metrics are derived from the stored ones instead.
 func (mon *Monitor) LatestMetrics(ctx context.Context, name string) []*api.Metric {
 	ctx, span := trace.StartSpan(ctx, "monitor/pubsub/LatestMetrics")
 	defer span.End()
 
+	if name == StalenessMetricName {
+		return mon.staleness(ctx, time.Now())
+	}
+
 	latest := mon.metrics.LatestValid(name)
 
 	if mon.peers == nil {
@@ -261,10 +515,139 @@ func (mon *Monitor) LatestMetrics(ctx context.Context, name string) []*api.Metri
 	return metrics.PeersetFilter(latest, peers)
 }
 
+// MetricsAt returns the metrics of a given type which were valid at the given
+// time, interpolating numeric values between the retained ones. Since they
+// are historical, metrics from peers which are no longer part of the peerset
+// are included.
+func (mon *Monitor) MetricsAt(ctx context.Context, name string, t time.Time) []*api.Metric {
+	_, span := trace.StartSpan(ctx, "monitor/pubsub/MetricsAt")
+	defer span.End()
+
+	return mon.metrics.At(name, t)
+}
+
+// PeerMetricAll returns the window of metrics of a given type held for a
+// peer, the most recent first. Expired metrics which have not been removed
+// yet are included, flagged as Stale. It is meant for debugging allocation
+// decisions.
+func (mon *Monitor) PeerMetricAll(ctx context.Context, pid peer.ID, name string) []*api.Metric {
+	_, span := trace.StartSpan(ctx, "monitor/pubsub/PeerMetricAll")
+	defer span.End()
+
+	window := mon.metrics.PeerMetricAll(name, pid)
+	all := make([]*api.Metric, 0, len(window))
+	for _, m := range window {
+		cp := *m
+		cp.Stale = m.Expired()
+		all = append(all, &cp)
+	}
+	return all
+}
+
+// MetricStats returns, for every current cluster peer, the minimum, maximum,
+// average and 95th percentile of the valid metrics of the given type held in
+// its window (see Config.WindowCap). They can be used to smooth out spikes in
+// metric values.
+func (mon *Monitor) MetricStats(ctx context.Context, name string) map[peer.ID]api.MetricStats {
+	ctx, span := trace.StartSpan(ctx, "monitor/pubsub/MetricStats")
+	defer span.End()
+
+	stats := mon.metrics.Stats(name)
+
+	if mon.peers == nil {
+		return stats
+	}
+
+	peers, err := mon.peers(ctx)
+	if err != nil {
+		return map[peer.ID]api.MetricStats{}
+	}
+	inPeerset := make(map[peer.ID]bool, len(peers))
+	for _, p := range peers {
+		inPeerset[p] = true
+	}
+	for p := range stats {
+		if !inPeerset[p] {
+			delete(stats, p)
+		}
+	}
+	return stats
+}
+
+// PeerLeft is called when the given peer leaves the cluster. When
+// ExpireOnPeerLeave is set, its metrics expire immediately so that they are
+// no longer used for allocations and failure detection kicks in.
+func (mon *Monitor) PeerLeft(ctx context.Context, pid peer.ID) error {
+	_, span := trace.StartSpan(ctx, "monitor/pubsub/PeerLeft")
+	defer span.End()
+
+	if !mon.config.ExpireOnPeerLeave {
+		return nil
+	}
+
+	logger.Debugf("expiring metrics from %s, which left the cluster", pid)
+	mon.metrics.ExpirePeer(pid)
+	return nil
+}
+
 // Alerts returns a channel on which alerts are sent when the
 // monitor detects a failure.
 func (mon *Monitor) Alerts() <-chan *api.Alert {
-	return mon.checker.Alerts()
+	return mon.alertCh
+}
+
+// RecentAlerts returns the alerts retained in the alert history which were
+// triggered after the given time, the most recent first, so that consumers
+// can learn about the alerts sent before they started reading the Alerts
+// channel.
+func (mon *Monitor) RecentAlerts(ctx context.Context, since time.Time) []*api.Alert {
+	_, span := trace.StartSpan(ctx, "monitor/pubsub/RecentAlerts")
+	defer span.End()
+
+	return mon.alertHistory.since(since)
+}
+
+// AlertsForMetric returns a new channel on which only the alerts for the
+// given metric are sent. Alerts keep being sent on the Alerts channel too.
+// The channel is closed, and no longer receives alerts, once the given
+// context is done or the monitor shuts down.
+func (mon *Monitor) AlertsForMetric(ctx context.Context, name string) <-chan *api.Alert {
+	ch := make(chan *api.Alert, metrics.AlertChannelCap)
+	mon.alertSubsMu.Lock()
+	mon.alertSubs[name] = append(mon.alertSubs[name], ch)
+	mon.alertSubsMu.Unlock()
+
+	mon.wg.Add(1)
+	go func() {
+		defer mon.wg.Done()
+		select {
+		case <-ctx.Done():
+		case <-mon.ctx.Done():
+		}
+		mon.unsubscribeAlerts(name, ch)
+	}()
+	return ch
+}
+
+// unsubscribeAlerts removes and closes a channel returned by
+// AlertsForMetric.
+func (mon *Monitor) unsubscribeAlerts(name string, ch chan *api.Alert) {
+	mon.alertSubsMu.Lock()
+	defer mon.alertSubsMu.Unlock()
+
+	subs := mon.alertSubs[name]
+	for i, sub := range subs {
+		if sub == ch {
+			subs = append(subs[:i], subs[i+1:]...)
+			break
+		}
+	}
+	if len(subs) == 0 {
+		delete(mon.alertSubs, name)
+	} else {
+		mon.alertSubs[name] = subs
+	}
+	close(ch)
 }
 
 // MetricNames lists all metric names.
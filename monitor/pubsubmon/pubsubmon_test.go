@@ -1,6 +1,7 @@
 package pubsubmon
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 
@@ -10,12 +11,16 @@ import (
 	"time"
 
 	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/monitor/metrics"
+	"github.com/ipfs/ipfs-cluster/observations"
 	"github.com/ipfs/ipfs-cluster/test"
 
 	libp2p "github.com/libp2p/go-libp2p"
 	host "github.com/libp2p/go-libp2p-core/host"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	gocodec "github.com/ugorji/go/codec"
+	"go.opencensus.io/stats/view"
 )
 
 func init() {
@@ -59,7 +64,15 @@ func peers(ctx context.Context) ([]peer.ID, error) {
 	return []peer.ID{test.PeerID1, test.PeerID2, test.PeerID3}, nil
 }
 
-func testPeerMonitor(t *testing.T) (*Monitor, host.Host, func()) {
+func testPeerMonitor(t testing.TB) (*Monitor, host.Host, func()) {
+	return testPeerMonitorWithStore(t, nil)
+}
+
+func testPeerMonitorWithStore(t testing.TB, mstore MetricsStore) (*Monitor, host.Host, func()) {
+	return testPeerMonitorWithConfig(t, mstore, func(*Config) {})
+}
+
+func testPeerMonitorWithConfig(t testing.TB, mstore MetricsStore, cfgFn func(*Config)) (*Monitor, host.Host, func()) {
 	ctx := context.Background()
 	h, err := libp2p.New(
 		libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
@@ -68,11 +81,21 @@ func testPeerMonitor(t *testing.T) (*Monitor, host.Host, func()) {
 		t.Fatal(err)
 	}
 
+	cfg := &Config{}
+	cfg.Default()
+	cfg.CheckInterval = 2 * time.Second
+	cfg.CleanupInterval = time.Second
+	cfg.PersistMetrics = mstore != nil
+	cfgFn(cfg)
+
+	opts := []pubsub.Option{
+		pubsub.WithMessageSigning(true),
+		pubsub.WithStrictSignatureVerification(true),
+	}
 	psub, err := pubsub.NewGossipSub(
 		ctx,
 		h,
-		pubsub.WithMessageSigning(true),
-		pubsub.WithStrictSignatureVerification(true),
+		append(opts, cfg.GossipSubOptions()...)...,
 	)
 	if err != nil {
 		h.Close()
@@ -80,10 +103,7 @@ func testPeerMonitor(t *testing.T) (*Monitor, host.Host, func()) {
 	}
 
 	mock := test.NewMockRPCClientWithHost(t, h)
-	cfg := &Config{}
-	cfg.Default()
-	cfg.CheckInterval = 2 * time.Second
-	mon, err := New(ctx, cfg, psub, peers)
+	mon, err := New(ctx, cfg, psub, h, peers, mstore)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -228,6 +248,125 @@ func TestPeerMonitorLogMetric(t *testing.T) {
 	}
 }
 
+func TestPeerMonitorPeerMetricAll(t *testing.T) {
+	ctx := context.Background()
+	pm, _, shutdown := testPeerMonitor(t)
+	defer shutdown()
+	mf := newMetricFactory()
+
+	expired := mf.newMetric("test", test.PeerID1)
+	expired.SetTTL(-time.Second)
+	pm.LogMetric(ctx, expired)
+	for i := 0; i < 3; i++ {
+		pm.LogMetric(ctx, mf.newMetric("test", test.PeerID1))
+	}
+	pm.LogMetric(ctx, mf.newMetric("test", test.PeerID2))
+
+	all := pm.PeerMetricAll(ctx, test.PeerID1, "test")
+	if len(all) != 4 {
+		t.Fatalf("expected the 4 metrics in the window: %+v", all)
+	}
+	for i, m := range all {
+		if m.Value != fmt.Sprintf("%d", 3-i) {
+			t.Errorf("expected the most recent metrics first: %+v", all)
+		}
+		if m.Stale != (i == 3) {
+			t.Errorf("only the expired metric should be stale: %+v", m)
+		}
+	}
+
+	if len(pm.PeerMetricAll(ctx, test.PeerID3, "test")) != 0 {
+		t.Error("expected no metrics for a peer which sent none")
+	}
+}
+
+func TestPeerMonitorStaleness(t *testing.T) {
+	ctx := context.Background()
+	pm, _, shutdown := testPeerMonitor(t)
+	defer shutdown()
+	mf := newMetricFactory()
+
+	pm.LogMetric(ctx, mf.newMetric("test", test.PeerID1))
+	pm.LogMetric(ctx, mf.newMetric("test2", test.PeerID2))
+
+	staleness := func() map[peer.ID]float64 {
+		values := make(map[peer.ID]float64)
+		for _, m := range pm.LatestMetrics(ctx, StalenessMetricName) {
+			v, err := strconv.ParseFloat(m.Value, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			values[m.Peer] = v
+		}
+		return values
+	}
+
+	first := staleness()
+	if len(first) != 2 {
+		t.Fatal("there should be a staleness metric for every peer")
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	pm.LogMetric(ctx, mf.newMetric("test", test.PeerID2))
+
+	second := staleness()
+	if second[test.PeerID1] < first[test.PeerID1]+0.5 {
+		t.Error("staleness of a silent peer should grow")
+	}
+	if second[test.PeerID2] >= 0.5 {
+		t.Error("staleness should be reset when a metric is received")
+	}
+}
+
+func TestPeerMonitorMetricStats(t *testing.T) {
+	ctx := context.Background()
+	pm, _, shutdown := testPeerMonitor(t)
+	defer shutdown()
+	mf := newMetricFactory()
+
+	for i := 0; i < 4; i++ {
+		pm.LogMetric(ctx, mf.newMetric("test", test.PeerID1))
+	}
+	pm.LogMetric(ctx, mf.newMetric("test", test.PeerID2))
+
+	stats := pm.MetricStats(ctx, "test")
+	if len(stats) != 2 {
+		t.Fatal("expected stats for 2 peers")
+	}
+	st := stats[test.PeerID1]
+	if st.Samples != 4 || st.Min != 0 || st.Max != 3 || st.Avg != 1.5 || st.P95 != 3 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+	if st.Latest != "3" {
+		t.Error("expected the latest value to be 3")
+	}
+
+	if len(pm.MetricStats(ctx, "testbad")) != 0 {
+		t.Error("expected no stats")
+	}
+}
+
+func TestPeerMonitorLogInvalidMetric(t *testing.T) {
+	ctx := context.Background()
+	pm, _, shutdown := testPeerMonitor(t)
+	defer shutdown()
+
+	m := &api.Metric{
+		Name:  "freespace",
+		Peer:  test.PeerID1,
+		Value: "-10",
+		Valid: true,
+	}
+	m.SetTTL(5 * time.Second)
+	pm.LogMetric(ctx, m)
+	if m.Valid {
+		t.Error("negative freespace should have been marked invalid")
+	}
+	if len(pm.LatestMetrics(ctx, "freespace")) != 0 {
+		t.Error("invalid metrics should not be returned")
+	}
+}
+
 func TestPeerMonitorPublishMetric(t *testing.T) {
 	ctx := context.Background()
 	pm, host, shutdown := testPeerMonitor(t)
@@ -284,6 +423,334 @@ func TestPeerMonitorPublishMetric(t *testing.T) {
 	checkMetric(t, pm2)
 }
 
+func TestPeerMonitorGossipSubParams(t *testing.T) {
+	ctx := context.Background()
+
+	// The first heartbeat happens right away and the next ones only
+	// every minute, so peers connected later are not added to the
+	// mesh. Only flood-publishing delivers the metrics to them.
+	published := func(t *testing.T, floodPublish bool) bool {
+		cfgFn := func(cfg *Config) {
+			cfg.GossipSubHeartbeatInterval = time.Minute
+			cfg.GossipSubFloodPublish = floodPublish
+		}
+		pm, host, shutdown := testPeerMonitorWithConfig(t, nil, cfgFn)
+		defer shutdown()
+		pm2, host2, shutdown2 := testPeerMonitorWithConfig(t, nil, cfgFn)
+		defer shutdown2()
+
+		time.Sleep(500 * time.Millisecond)
+
+		err := host.Connect(ctx, peer.AddrInfo{ID: host2.ID(), Addrs: host2.Addrs()})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; len(pm.topic.ListPeers()) == 0; i++ {
+			if i > 50 {
+				t.Fatal("the peers did not learn about each other's subscriptions")
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		mf := newMetricFactory()
+		err = pm.PublishMetric(ctx, mf.newMetric("test", test.PeerID1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(500 * time.Millisecond)
+		return len(pm2.LatestMetrics(ctx, "test")) == 1
+	}
+
+	if !published(t, true) {
+		t.Error("expected the metric to be flood-published")
+	}
+	if published(t, false) {
+		t.Error("expected the metric not to reach peers outside the mesh")
+	}
+}
+
+func TestPeerMonitorTopic(t *testing.T) {
+	ctx := context.Background()
+	pm, host, shutdown := testPeerMonitor(t)
+	defer shutdown()
+
+	pm2, host2, shutdown2 := testPeerMonitorWithConfig(t, nil, func(cfg *Config) {
+		cfg.Topic = "other-cluster.metrics"
+	})
+	defer shutdown2()
+
+	err := host.Connect(
+		context.Background(),
+		peer.AddrInfo{
+			ID:    host2.ID(),
+			Addrs: host2.Addrs(),
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	mf := newMetricFactory()
+	err = pm.PublishMetric(ctx, mf.newMetric("test", test.PeerID1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pm2.PublishMetric(ctx, mf.newMetric("test2", test.PeerID2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	if len(pm.LatestMetrics(ctx, "test")) != 1 || len(pm2.LatestMetrics(ctx, "test2")) != 1 {
+		t.Fatal("expected the metrics published on each topic")
+	}
+	if len(pm2.LatestMetrics(ctx, "test")) != 0 || len(pm.LatestMetrics(ctx, "test2")) != 0 {
+		t.Error("metrics should not be received from another topic")
+	}
+}
+
+func TestPeerMonitorPublishMetrics(t *testing.T) {
+	ctx := context.Background()
+	pm, host, shutdown := testPeerMonitor(t)
+	defer shutdown()
+
+	pm2, host2, shutdown2 := testPeerMonitor(t)
+	defer shutdown2()
+
+	time.Sleep(200 * time.Millisecond)
+
+	err := host.Connect(
+		context.Background(),
+		peer.AddrInfo{
+			ID:    host2.ID(),
+			Addrs: host2.Addrs(),
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	mf := newMetricFactory()
+	invalid := mf.newMetric("invalid", test.PeerID1)
+	invalid.Valid = false
+	batch := []*api.Metric{
+		mf.newMetric("test", test.PeerID1),
+		mf.newMetric("test", test.PeerID2),
+		mf.newMetric("other", test.PeerID1),
+		invalid,
+	}
+	err = pm.PublishMetrics(ctx, batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// single metrics are still understood
+	err = pm.PublishMetric(ctx, mf.newMetric("single", test.PeerID3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	for _, m := range []*Monitor{pm, pm2} {
+		if n := len(m.LatestMetrics(ctx, "test")); n != 2 {
+			t.Errorf("expected 2 test metrics; got %d", n)
+		}
+		other := m.LatestMetrics(ctx, "other")
+		if len(other) != 1 || other[0].Value != batch[2].Value {
+			t.Errorf("expected the other metric; got %v", other)
+		}
+		if len(m.LatestMetrics(ctx, "single")) != 1 {
+			t.Error("expected the single metric")
+		}
+		if len(m.metrics.PeerMetricAll("invalid", test.PeerID1)) != 0 {
+			t.Error("invalid metrics should not be published")
+		}
+	}
+}
+
+func benchmarkMetrics(n int) []*api.Metric {
+	mf := newMetricFactory()
+	metrics := make([]*api.Metric, n)
+	for i := range metrics {
+		metrics[i] = mf.newMetric("bench"+strconv.Itoa(i), test.PeerID1)
+	}
+	return metrics
+}
+
+// BenchmarkPublishMetric and BenchmarkPublishMetrics compare publishing 50
+// metrics one by one and in a batch.
+func BenchmarkPublishMetric(b *testing.B) {
+	ctx := context.Background()
+	pm, _, shutdown := testPeerMonitor(b)
+	defer shutdown()
+	metrics := benchmarkMetrics(50)
+
+	b.ResetTimer()
+	msgs := 0
+	for i := 0; i < b.N; i++ {
+		for _, m := range metrics {
+			if err := pm.PublishMetric(ctx, m); err != nil {
+				b.Fatal(err)
+			}
+			msgs++
+		}
+	}
+	b.ReportMetric(float64(msgs)/float64(b.N), "msgs/op")
+}
+
+func BenchmarkPublishMetrics(b *testing.B) {
+	ctx := context.Background()
+	pm, _, shutdown := testPeerMonitor(b)
+	defer shutdown()
+	metrics := benchmarkMetrics(50)
+
+	b.ResetTimer()
+	msgs := 0
+	for i := 0; i < b.N; i++ {
+		if err := pm.PublishMetrics(ctx, metrics); err != nil {
+			b.Fatal(err)
+		}
+		msgs++
+	}
+	b.ReportMetric(float64(msgs)/float64(b.N), "msgs/op")
+}
+
+func viewCount(t *testing.T, v *view.View) int64 {
+	rows, err := view.RetrieveData(v.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	for _, r := range rows {
+		count += r.Data.(*view.CountData).Value
+	}
+	return count
+}
+
+func TestPeerMonitorMessageCounters(t *testing.T) {
+	ctx := context.Background()
+	pm, _, shutdown := testPeerMonitor(t)
+	defer shutdown()
+
+	views := []*view.View{
+		observations.PubsubMessagesReceivedView,
+		observations.PubsubMessagesDroppedView,
+		observations.PubsubDecodeErrorsView,
+	}
+	if err := view.Register(views...); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(views...)
+
+	pm.handleMessage(ctx, test.PeerID1, []byte("corrupt"))
+	if n := viewCount(t, observations.PubsubDecodeErrorsView); n != 1 {
+		t.Errorf("expected 1 decode error; got %d", n)
+	}
+
+	var b bytes.Buffer
+	metric := newMetricFactory().newMetric("test", test.PeerID1)
+	if err := gocodec.NewEncoder(&b, msgpackHandle).Encode(metric); err != nil {
+		t.Fatal(err)
+	}
+	pm.handleMessage(ctx, test.PeerID1, b.Bytes())
+	pm.handleMessage(ctx, test.PeerID1, b.Bytes())
+	if n := viewCount(t, observations.PubsubMessagesReceivedView); n != 2 {
+		t.Errorf("expected 2 received metrics; got %d", n)
+	}
+	if n := viewCount(t, observations.PubsubMessagesDroppedView); n != 1 {
+		t.Errorf("expected the duplicate to be dropped; got %d", n)
+	}
+	if n := len(pm.metrics.PeerMetricAll("test", test.PeerID1)); n != 1 {
+		t.Errorf("expected 1 logged metric; got %d", n)
+	}
+}
+
+func TestPeerMonitorMetricRateLimit(t *testing.T) {
+	ctx := context.Background()
+	pm, _, shutdown := testPeerMonitorWithConfig(t, nil, func(cfg *Config) {
+		cfg.MetricRateLimit = 0.1
+		cfg.MetricBurst = 5
+	})
+	defer shutdown()
+
+	views := []*view.View{
+		observations.PubsubMessagesDroppedView,
+		observations.PubsubMessagesRateLimitedView,
+	}
+	if err := view.Register(views...); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(views...)
+
+	mf := newMetricFactory()
+	publish := func(p peer.ID) {
+		var b bytes.Buffer
+		if err := gocodec.NewEncoder(&b, msgpackHandle).Encode(mf.newMetric("test", p)); err != nil {
+			t.Fatal(err)
+		}
+		pm.handleMessage(ctx, p, b.Bytes())
+	}
+
+	// The burst is accepted and the rest dropped.
+	for i := 0; i < 20; i++ {
+		publish(test.PeerID1)
+	}
+	if n := viewCount(t, observations.PubsubMessagesRateLimitedView); n != 15 {
+		t.Errorf("expected 15 rate-limited metrics; got %d", n)
+	}
+	if n := viewCount(t, observations.PubsubMessagesDroppedView); n != 0 {
+		t.Errorf("expected rate-limited metrics to be counted apart; got %d", n)
+	}
+	if n := len(pm.metrics.PeerMetricAll("test", test.PeerID1)); n != 5 {
+		t.Errorf("expected 5 logged metrics; got %d", n)
+	}
+
+	// Other peers are not affected.
+	publish(test.PeerID2)
+	if n := len(pm.metrics.PeerMetricAll("test", test.PeerID2)); n != 1 {
+		t.Error("the metric from another peer should be logged")
+	}
+}
+
+func TestPeerMonitorStrictMetricPeer(t *testing.T) {
+	ctx := context.Background()
+	pm, _, shutdown := testPeerMonitor(t)
+	defer shutdown()
+
+	var b bytes.Buffer
+	metric := newMetricFactory().newMetric("test", test.PeerID1)
+	if err := gocodec.NewEncoder(&b, msgpackHandle).Encode(metric); err != nil {
+		t.Fatal(err)
+	}
+
+	pm.config.StrictMetricPeer = true
+	pm.handleMessage(ctx, test.PeerID2, b.Bytes())
+	if n := len(pm.metrics.PeerMetricAll("test", test.PeerID1)); n != 0 {
+		t.Fatal("a metric published by another peer should be dropped")
+	}
+	pm.handleMessage(ctx, test.PeerID1, b.Bytes())
+	if n := len(pm.metrics.PeerMetricAll("test", test.PeerID1)); n != 1 {
+		t.Fatal("a metric published by its peer should be logged")
+	}
+
+	pm.config.StrictMetricPeer = false
+	metric = newMetricFactory().newMetric("test", test.PeerID3)
+	b.Reset()
+	if err := gocodec.NewEncoder(&b, msgpackHandle).Encode(metric); err != nil {
+		t.Fatal(err)
+	}
+	pm.handleMessage(ctx, test.PeerID2, b.Bytes())
+	if n := len(pm.metrics.PeerMetricAll("test", test.PeerID3)); n != 1 {
+		t.Error("metrics about other peers are accepted unless StrictMetricPeer is set")
+	}
+}
+
 func TestPeerMonitorAlerts(t *testing.T) {
 	ctx := context.Background()
 	pm, _, shutdown := testPeerMonitor(t)
@@ -312,6 +779,151 @@ func TestPeerMonitorAlerts(t *testing.T) {
 	}
 }
 
+func TestPeerMonitorRecentAlerts(t *testing.T) {
+	ctx := context.Background()
+	pm, _, shutdown := testPeerMonitor(t)
+	defer shutdown()
+	mf := newMetricFactory()
+
+	start := time.Now()
+	mtr := mf.newMetric("test", test.PeerID1)
+	mtr.SetTTL(0)
+	pm.LogMetric(ctx, mtr)
+
+	// Nobody reads the Alerts channel: the alert is retrieved from the
+	// history after the fact.
+	deadline := time.Now().Add(5 * time.Second)
+	var alerts []*api.Alert
+	for len(alerts) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("should have recorded an alert by now")
+		}
+		time.Sleep(100 * time.Millisecond)
+		alerts = pm.RecentAlerts(ctx, time.Time{})
+	}
+	if alerts[0].Name != "test" || alerts[0].Peer != test.PeerID1 {
+		t.Errorf("unexpected alert: %+v", alerts[0])
+	}
+
+	if len(pm.RecentAlerts(ctx, start)) == 0 {
+		t.Error("expected the alert triggered after start")
+	}
+	if len(pm.RecentAlerts(ctx, time.Now())) != 0 {
+		t.Error("expected no alerts triggered after now")
+	}
+}
+
+func TestPeerMonitorAlertsForMetric(t *testing.T) {
+	ctx := context.Background()
+	pm, _, shutdown := testPeerMonitor(t)
+	defer shutdown()
+	mf := newMetricFactory()
+
+	subCtx, cancel := context.WithCancel(ctx)
+	pingCh := pm.AlertsForMetric(subCtx, "ping")
+	// never read and only fits one alert: it must not block the rest.
+	alertChannelCap := metrics.AlertChannelCap
+	metrics.AlertChannelCap = 1
+	pm.AlertsForMetric(ctx, "freespace")
+	metrics.AlertChannelCap = alertChannelCap
+
+	for _, p := range []peer.ID{test.PeerID1, test.PeerID3} {
+		mtr := mf.newMetric("freespace", p)
+		mtr.SetTTL(0)
+		pm.LogMetric(ctx, mtr)
+	}
+	mtr := mf.newMetric("ping", test.PeerID2)
+	mtr.SetTTL(0)
+	pm.LogMetric(ctx, mtr)
+
+	timeout := time.NewTimer(time.Second * 5)
+	select {
+	case <-timeout.C:
+		t.Fatal("should have thrown an alert by now")
+	case alrt := <-pingCh:
+		if alrt.Name != "ping" || alrt.Peer != test.PeerID2 {
+			t.Errorf("unexpected alert: %+v", alrt)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-timeout.C:
+			t.Fatal("Alerts should deliver all alerts")
+		case <-pm.Alerts():
+		}
+	}
+
+	select {
+	case alrt := <-pingCh:
+		t.Errorf("unexpected alert: %+v", alrt)
+	default:
+	}
+
+	// Cancelling the context unsubscribes.
+	cancel()
+	select {
+	case <-timeout.C:
+		t.Fatal("expected the channel to be closed")
+	case _, ok := <-pingCh:
+		if ok {
+			t.Error("expected the channel to be closed")
+		}
+	}
+	pm.alertSubsMu.RLock()
+	if len(pm.alertSubs["ping"]) != 0 {
+		t.Error("expected the subscription to be removed")
+	}
+	pm.alertSubsMu.RUnlock()
+}
+
+func TestPeerMonitorAlertsRecovered(t *testing.T) {
+	ctx := context.Background()
+	pm, _, shutdown := testPeerMonitor(t)
+	defer shutdown()
+	mf := newMetricFactory()
+
+	mtr := mf.newMetric("test", test.PeerID1)
+	mtr.SetTTL(0)
+	pm.LogMetric(ctx, mtr)
+	timeout := time.NewTimer(time.Second * 5)
+
+	select {
+	case <-timeout.C:
+		t.Fatal("should have thrown an alert by now")
+	case alrt := <-pm.Alerts():
+		if alrt.Recovered {
+			t.Fatal("first alert should not be a recovery")
+		}
+	}
+
+	mtr = mf.newMetric("test", test.PeerID1)
+	mtr.SetTTL(time.Minute)
+	pm.LogMetric(ctx, mtr)
+
+	select {
+	case <-timeout.C:
+		t.Fatal("should have sent a recovery alert by now")
+	case alrt := <-pm.Alerts():
+		if !alrt.Recovered {
+			t.Error("expected a recovery alert")
+		}
+		if alrt.Name != "test" || alrt.Peer != test.PeerID1 {
+			t.Error("recovery alert should be for test and TestPeerID1")
+		}
+	}
+
+	// only the first valid metric after the alert recovers.
+	mtr = mf.newMetric("test", test.PeerID1)
+	mtr.SetTTL(time.Minute)
+	pm.LogMetric(ctx, mtr)
+	select {
+	case alrt := <-pm.Alerts():
+		t.Errorf("unexpected alert: %+v", alrt)
+	case <-time.After(time.Second):
+	}
+}
+
 func TestMetricsGetsDeleted(t *testing.T) {
 	ctx := context.Background()
 
@@ -319,18 +931,40 @@ func TestMetricsGetsDeleted(t *testing.T) {
 	defer shutdown()
 	mf := newMetricFactory()
 
-	pm.LogMetric(ctx, mf.newMetric("test", test.PeerID1))
+	m := mf.newMetric("test", test.PeerID1)
+	pm.LogMetric(ctx, m)
 	metrics := pm.metrics.PeerMetrics(test.PeerID1)
 	if len(metrics) == 0 {
 		t.Error("expected metrics")
 	}
 
-	// TODO: expiry time + checkInterval is 7 sec
-	// Why does it need 9 or more?
-	time.Sleep(9 * time.Second)
+	// metrics are deleted by the first sweep after they expire.
+	time.Sleep(time.Until(time.Unix(0, m.Expire)) + pm.config.CleanupInterval + 200*time.Millisecond)
 
 	metrics = pm.metrics.PeerMetrics(test.PeerID1)
 	if len(metrics) > 0 {
 		t.Error("expected no metrics")
 	}
 }
+
+func TestPeerMonitorPeerLeft(t *testing.T) {
+	ctx := context.Background()
+	pm, _, shutdown := testPeerMonitor(t)
+	defer shutdown()
+
+	mf := newMetricFactory()
+	pm.LogMetric(ctx, mf.newMetric("test", test.PeerID1))
+	pm.LogMetric(ctx, mf.newMetric("test", test.PeerID2))
+
+	pm.PeerLeft(ctx, test.PeerID1)
+	latest := pm.LatestMetrics(ctx, "test")
+	if len(latest) != 1 || latest[0].Peer != test.PeerID2 {
+		t.Errorf("expected only the metric from %s; got: %v", test.PeerID2, latest)
+	}
+
+	pm.config.ExpireOnPeerLeave = false
+	pm.PeerLeft(ctx, test.PeerID2)
+	if len(pm.LatestMetrics(ctx, "test")) != 1 {
+		t.Error("metrics should not expire when expire_on_peer_leave is disabled")
+	}
+}
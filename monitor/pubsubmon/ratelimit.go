@@ -0,0 +1,72 @@
+package pubsubmon
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// rateLimiter keeps a token bucket for every peer publishing metrics. Each
+// bucket holds up to burst tokens and is refilled at rate tokens per
+// second. Every received metric takes a token, and metrics arriving at an
+// empty bucket are dropped.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[peer.ID]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[peer.ID]*tokenBucket),
+	}
+}
+
+// allow takes a token from the bucket of the given peer, returning false
+// when there are none left.
+func (rl *rateLimiter) allow(p peer.ID, now time.Time) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	b, ok := rl.buckets[p]
+	if !ok {
+		rl.prune(now)
+		b = &tokenBucket{tokens: rl.burst, last: now}
+		rl.buckets[p] = b
+	}
+	rl.refill(b, now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (rl *rateLimiter) refill(b *tokenBucket, now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(rl.burst, b.tokens+elapsed*rl.rate)
+		b.last = now
+	}
+}
+
+// prune removes the buckets which are full again, as they are no different
+// from new ones, so that peers which are gone are forgotten.
+func (rl *rateLimiter) prune(now time.Time) {
+	for p, b := range rl.buckets {
+		rl.refill(b, now)
+		if b.tokens >= rl.burst {
+			delete(rl.buckets, p)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package pubsubmon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl := newRateLimiter(2, 3)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if !rl.allow(test.PeerID1, now) {
+			t.Fatal("the burst should be allowed")
+		}
+	}
+	if rl.allow(test.PeerID1, now) {
+		t.Fatal("the bucket should be empty")
+	}
+
+	// Two tokens per second.
+	now = now.Add(500 * time.Millisecond)
+	if !rl.allow(test.PeerID1, now) {
+		t.Fatal("a token should have been refilled")
+	}
+	if rl.allow(test.PeerID1, now) {
+		t.Fatal("only one token should have been refilled")
+	}
+
+	// Refilling does not go over the burst.
+	now = now.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		if !rl.allow(test.PeerID1, now) {
+			t.Fatal("the burst should be allowed again")
+		}
+	}
+	if rl.allow(test.PeerID1, now) {
+		t.Fatal("the bucket should be empty")
+	}
+
+	// Full buckets are pruned when new peers arrive.
+	if !rl.allow(test.PeerID2, now.Add(time.Minute)) {
+		t.Fatal("a new peer should be allowed")
+	}
+	if _, ok := rl.buckets[test.PeerID1]; ok {
+		t.Error("the full bucket should have been pruned")
+	}
+}
@@ -0,0 +1,119 @@
+package pubsubmon
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	host "github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+)
+
+// reconnector dials the peers in the peerset which are not connected to the
+// metrics topic, so that metrics reach them without waiting for pubsub to
+// discover them. Peers which cannot be dialed are retried with exponential
+// backoff, from ReconnectInterval up to ReconnectMaxBackoff.
+type reconnector struct {
+	host       host.Host
+	topic      *pubsub.Topic
+	peers      PeersFunc
+	interval   time.Duration
+	maxBackoff time.Duration
+	maxDials   int
+
+	// only accessed from run().
+	backoff map[peer.ID]*peerBackoff
+}
+
+type peerBackoff struct {
+	delay time.Duration
+	next  time.Time
+}
+
+func (r *reconnector) run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reconnect(ctx)
+		}
+	}
+}
+
+// reconnect dials, at most maxDials at a time, the missing peers whose
+// backoff expired.
+func (r *reconnector) reconnect(ctx context.Context) {
+	peers, err := r.peers(ctx)
+	if err != nil {
+		logger.Debugf("reconnector: error listing peers: %s", err)
+		return
+	}
+
+	inTopic := make(map[peer.ID]struct{})
+	for _, p := range r.topic.ListPeers() {
+		inTopic[p] = struct{}{}
+	}
+
+	var missing []peer.ID
+	now := time.Now()
+	for _, p := range peers {
+		if _, ok := inTopic[p]; ok || p == r.host.ID() {
+			delete(r.backoff, p)
+			continue
+		}
+		if b, ok := r.backoff[p]; ok && now.Before(b.next) {
+			continue
+		}
+		missing = append(missing, p)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := make(map[peer.ID]bool)
+	sem := make(chan struct{}, r.maxDials)
+dial:
+	for _, p := range missing {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break dial
+		}
+		wg.Add(1)
+		go func(p peer.ID) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := r.host.Connect(ctx, peer.AddrInfo{ID: p})
+			if err != nil {
+				logger.Debugf("reconnector: error dialing %s: %s", p, err)
+			}
+			mu.Lock()
+			failed[p] = err != nil
+			mu.Unlock()
+		}(p)
+	}
+	wg.Wait()
+
+	for p, fail := range failed {
+		// Peers dialed successfully may take a moment to join the
+		// topic: check them again on the next round.
+		if !fail {
+			delete(r.backoff, p)
+			continue
+		}
+		b, ok := r.backoff[p]
+		if !ok {
+			b = &peerBackoff{delay: r.interval / 2}
+			r.backoff[p] = b
+		}
+		b.delay *= 2
+		if b.delay > r.maxBackoff {
+			b.delay = r.maxBackoff
+		}
+		b.next = now.Add(b.delay)
+	}
+}
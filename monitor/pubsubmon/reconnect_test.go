@@ -0,0 +1,127 @@
+package pubsubmon
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/test"
+
+	libp2p "github.com/libp2p/go-libp2p"
+	host "github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+)
+
+func reconnectTestHost(t *testing.T) host.Host {
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func reconnectTestMonitor(t *testing.T, h host.Host, reconnect time.Duration, peersF PeersFunc) *Monitor {
+	ctx := context.Background()
+	psub, err := pubsub.NewGossipSub(ctx, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{}
+	cfg.Default()
+	cfg.ReconnectInterval = reconnect
+	cfg.ReconnectMaxBackoff = time.Second
+	mon, err := New(ctx, cfg, psub, h, peersF, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mon.SetClient(test.NewMockRPCClientWithHost(t, h))
+	t.Cleanup(func() { mon.Shutdown(ctx) })
+	return mon
+}
+
+// metricConvergence returns how long it takes for a metric published by one
+// of two unconnected peers, which know each others addresses, to reach the
+// other one, up to the given timeout.
+func metricConvergence(t *testing.T, reconnect, timeout time.Duration) time.Duration {
+	ctx := context.Background()
+	h1 := reconnectTestHost(t)
+	h2 := reconnectTestHost(t)
+	peersF := func(ctx context.Context) ([]peer.ID, error) {
+		return []peer.ID{h1.ID(), h2.ID()}, nil
+	}
+	pm1 := reconnectTestMonitor(t, h1, reconnect, peersF)
+	pm2 := reconnectTestMonitor(t, h2, 0, peersF)
+	h1.Peerstore().AddAddrs(h2.ID(), h2.Addrs(), peerstore.PermanentAddrTTL)
+
+	mf := newMetricFactory()
+	start := time.Now()
+	for time.Since(start) < timeout {
+		if err := pm2.PublishMetric(ctx, mf.newMetric("test", h2.ID())); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		if len(pm1.LatestMetrics(ctx, "test")) > 0 {
+			return time.Since(start)
+		}
+	}
+	return timeout
+}
+
+func TestReconnector(t *testing.T) {
+	timeout := 3 * time.Second
+
+	without := metricConvergence(t, 0, timeout)
+	if without < timeout {
+		t.Fatal("unconnected peers should not receive metrics without the reconnector")
+	}
+
+	with := metricConvergence(t, 100*time.Millisecond, timeout)
+	if with >= timeout {
+		t.Fatal("the reconnector should have connected the peers")
+	}
+	t.Logf("metrics converged in %s with the reconnector", with)
+}
+
+func TestReconnectorBackoff(t *testing.T) {
+	ctx := context.Background()
+	missing := peer.ID("missing")
+	h := reconnectTestHost(t)
+	pm := reconnectTestMonitor(t, h, 0, nil)
+	r := &reconnector{
+		host:  h,
+		topic: pm.topic,
+		peers: func(ctx context.Context) ([]peer.ID, error) {
+			return []peer.ID{missing}, nil
+		},
+		interval:   100 * time.Millisecond,
+		maxBackoff: 300 * time.Millisecond,
+		maxDials:   1,
+		backoff:    make(map[peer.ID]*peerBackoff),
+	}
+
+	for _, expected := range []time.Duration{100, 200, 300, 300} {
+		// Force the retry.
+		if b, ok := r.backoff[missing]; ok {
+			b.next = time.Time{}
+		}
+		r.reconnect(ctx)
+		b, ok := r.backoff[missing]
+		if !ok {
+			t.Fatal("expected the failed dial to be backed off")
+		}
+		if b.delay != expected*time.Millisecond {
+			t.Errorf("expected a %dms backoff; got %s", expected, b.delay)
+		}
+	}
+
+	// Not retried before the backoff expires.
+	next := r.backoff[missing].next
+	r.reconnect(ctx)
+	if !r.backoff[missing].next.Equal(next) {
+		t.Error("the peer should not be dialed before its backoff expires")
+	}
+}
@@ -0,0 +1,86 @@
+package pubsubmon
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/observations"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// StalenessMetricName is the name of the metrics derived by the monitor
+// with the age, in seconds, of the most recent metric received from every
+// peer. They are computed when requested (see LatestMetrics) and never
+// published.
+const StalenessMetricName = "staleness"
+
+// staleness returns a StalenessMetricName metric for every current cluster
+// peer which has sent metrics.
+func (mon *Monitor) staleness(ctx context.Context, now time.Time) []*api.Metric {
+	last := mon.metrics.LastReceived()
+
+	if mon.peers != nil {
+		peers, err := mon.peers(ctx)
+		if err != nil {
+			return []*api.Metric{}
+		}
+		inPeerset := make(map[peer.ID]struct{}, len(peers))
+		for _, p := range peers {
+			inPeerset[p] = struct{}{}
+		}
+		for p := range last {
+			if _, ok := inPeerset[p]; !ok {
+				delete(last, p)
+			}
+		}
+	}
+
+	metrics := make([]*api.Metric, 0, len(last))
+	for p, ts := range last {
+		age := now.Sub(ts)
+		if age < 0 {
+			age = 0
+		}
+		m := &api.Metric{
+			Name:       StalenessMetricName,
+			Peer:       p,
+			Value:      strconv.FormatFloat(age.Seconds(), 'f', 3, 64),
+			Valid:      true,
+			ReceivedAt: now.UnixNano(),
+		}
+		m.SetTTL(mon.config.CheckInterval)
+		metrics = append(metrics, m)
+	}
+	sort.Stable(api.MetricSlice(metrics))
+	return metrics
+}
+
+// recordStaleness records the staleness of every peer every CheckInterval,
+// so that it can be exported as a gauge.
+func (mon *Monitor) recordStaleness() {
+	ticker := time.NewTicker(mon.config.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-mon.ctx.Done():
+			return
+		case <-ticker.C:
+			for _, m := range mon.staleness(mon.ctx, time.Now()) {
+				v, _ := strconv.ParseFloat(m.Value, 64)
+				stats.RecordWithTags(
+					mon.ctx,
+					[]tag.Mutator{tag.Upsert(observations.RemotePeerKey, m.Peer.Pretty())},
+					observations.PeerStaleness.M(v),
+				)
+			}
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/config"
+	"github.com/kelseyhightower/envconfig"
+)
+
+const configKey = "webhook"
+const envConfigKey = "cluster_webhook"
+
+// Default values for this Config.
+const (
+	DefaultURL          = ""
+	DefaultTimeout      = 10 * time.Second
+	DefaultMaxRetries   = 3
+	DefaultRetryBackoff = time.Second
+	DefaultQueueSize    = 100
+)
+
+// Config allows to initialize a Sink and customize some parameters.
+type Config struct {
+	config.Saver
+
+	// URL is the endpoint which receives the alerts as JSON POST
+	// requests. Alerts are not sent when empty.
+	URL string
+	// Secret, when set, is used to sign the body of every request with
+	// HMAC-SHA256. The signature is sent in the X-Cluster-Signature
+	// header.
+	Secret string
+	// Timeout limits the duration of every request.
+	Timeout time.Duration
+	// MaxRetries is the number of times a failed delivery is retried
+	// before the alert is dropped.
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry. It doubles on
+	// every following one.
+	RetryBackoff time.Duration
+	// QueueSize is the number of alerts waiting for delivery after
+	// which new alerts are dropped.
+	QueueSize int
+}
+
+type jsonConfig struct {
+	URL          string `json:"url"`
+	Secret       string `json:"secret,omitempty" hidden:"true"`
+	Timeout      string `json:"timeout"`
+	MaxRetries   int    `json:"max_retries"`
+	RetryBackoff string `json:"retry_backoff"`
+	QueueSize    int    `json:"queue_size"`
+}
+
+// ConfigKey provides a human-friendly identifier for this type of Config.
+func (cfg *Config) ConfigKey() string {
+	return configKey
+}
+
+// Default sets the fields of this Config to sensible values.
+func (cfg *Config) Default() error {
+	cfg.URL = DefaultURL
+	cfg.Secret = ""
+	cfg.Timeout = DefaultTimeout
+	cfg.MaxRetries = DefaultMaxRetries
+	cfg.RetryBackoff = DefaultRetryBackoff
+	cfg.QueueSize = DefaultQueueSize
+	return nil
+}
+
+// ApplyEnvVars fills in any Config fields found
+// as environment variables.
+func (cfg *Config) ApplyEnvVars() error {
+	jcfg := cfg.toJSONConfig()
+
+	err := envconfig.Process(envConfigKey, jcfg)
+	if err != nil {
+		return err
+	}
+
+	return cfg.applyJSONConfig(jcfg)
+}
+
+// Validate checks that the fields of this Config have working values,
+// at least in appearance.
+func (cfg *Config) Validate() error {
+	if cfg.URL != "" {
+		u, err := url.Parse(cfg.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("webhook.url is invalid")
+		}
+	}
+
+	if cfg.Timeout <= 0 {
+		return errors.New("webhook.timeout is invalid")
+	}
+
+	if cfg.MaxRetries < 0 {
+		return errors.New("webhook.max_retries is invalid")
+	}
+
+	if cfg.RetryBackoff <= 0 {
+		return errors.New("webhook.retry_backoff is invalid")
+	}
+
+	if cfg.QueueSize <= 0 {
+		return errors.New("webhook.queue_size is invalid")
+	}
+
+	return nil
+}
+
+// LoadJSON sets the fields of this Config to the values defined by the JSON
+// representation of it, as generated by ToJSON.
+func (cfg *Config) LoadJSON(raw []byte) error {
+	jcfg := &jsonConfig{}
+	err := json.Unmarshal(raw, jcfg)
+	if err != nil {
+		logger.Error("Error unmarshaling webhook config")
+		return err
+	}
+
+	cfg.Default()
+
+	return cfg.applyJSONConfig(jcfg)
+}
+
+func (cfg *Config) applyJSONConfig(jcfg *jsonConfig) error {
+	cfg.URL = jcfg.URL
+	cfg.Secret = jcfg.Secret
+	config.SetIfNotDefault(jcfg.MaxRetries, &cfg.MaxRetries)
+	config.SetIfNotDefault(jcfg.QueueSize, &cfg.QueueSize)
+
+	err := config.ParseDurations(
+		cfg.ConfigKey(),
+		&config.DurationOpt{Duration: jcfg.Timeout, Dst: &cfg.Timeout, Name: "timeout"},
+		&config.DurationOpt{Duration: jcfg.RetryBackoff, Dst: &cfg.RetryBackoff, Name: "retry_backoff"},
+	)
+	if err != nil {
+		return err
+	}
+
+	return cfg.Validate()
+}
+
+// ToJSON generates a human-friendly JSON representation of this Config.
+func (cfg *Config) ToJSON() ([]byte, error) {
+	jcfg := cfg.toJSONConfig()
+
+	return config.DefaultJSONMarshal(jcfg)
+}
+
+func (cfg *Config) toJSONConfig() *jsonConfig {
+	return &jsonConfig{
+		URL:          cfg.URL,
+		Secret:       cfg.Secret,
+		Timeout:      cfg.Timeout.String(),
+		MaxRetries:   cfg.MaxRetries,
+		RetryBackoff: cfg.RetryBackoff.String(),
+		QueueSize:    cfg.QueueSize,
+	}
+}
+
+// ToDisplayJSON returns JSON config as a string.
+func (cfg *Config) ToDisplayJSON() ([]byte, error) {
+	return config.DisplayJSON(cfg.toJSONConfig())
+}
@@ -0,0 +1,216 @@
+// Package webhook implements an alert sink for IPFS Cluster which POSTs the
+// alerts as JSON to a configured URL.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/observations"
+
+	logging "github.com/ipfs/go-log/v2"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+
+	"go.opencensus.io/stats"
+)
+
+var logger = logging.Logger("webhook")
+
+// SignatureHeader carries the hex-encoded HMAC-SHA256 of the request body,
+// prefixed by "sha256=", when a Secret is configured.
+const SignatureHeader = "X-Cluster-Signature"
+
+// Sink delivers alerts to a webhook. Alerts are queued and POSTed one by one
+// from a dedicated goroutine, retrying with exponential backoff when the
+// requests fail. Alerts for the same peer, metric and expiry are only
+// delivered once.
+type Sink struct {
+	ctx    context.Context
+	cancel func()
+
+	config *Config
+	client *http.Client
+	queue  chan *api.Alert
+
+	// sent keeps the last alert queued for every peer and metric.
+	sentMux sync.Mutex
+	sent    map[alertKey]sentAlert
+
+	dropped uint64
+
+	shutdownLock sync.Mutex
+	shutdown     bool
+	wg           sync.WaitGroup
+}
+
+// New creates a new webhook Sink and starts delivering the alerts it is
+// given.
+func New(cfg *Config) (*Sink, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.URL == "" {
+		return nil, errors.New("webhook.url is not set")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &Sink{
+		ctx:    ctx,
+		cancel: cancel,
+		config: cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		queue:  make(chan *api.Alert, cfg.QueueSize),
+		sent:   make(map[alertKey]sentAlert),
+	}
+
+	s.wg.Add(1)
+	go s.run()
+	return s, nil
+}
+
+type alertKey struct {
+	peer string
+	name string
+}
+
+type sentAlert struct {
+	expire    int64
+	recovered bool
+}
+
+// Alert queues an alert for delivery. It does not block: the alert is
+// dropped when the queue is full. Alerts which were already queued (same
+// peer, metric and expiry) are skipped.
+func (s *Sink) Alert(ctx context.Context, alrt *api.Alert) {
+	key := alertKey{
+		peer: peer.Encode(alrt.Peer),
+		name: alrt.Name,
+	}
+	sent := sentAlert{
+		expire:    alrt.Expire,
+		recovered: alrt.Recovered,
+	}
+
+	s.sentMux.Lock()
+	defer s.sentMux.Unlock()
+	if last, ok := s.sent[key]; ok && last == sent {
+		logger.Debugf("skipping duplicate alert %s for %s", alrt.Name, alrt.Peer)
+		return
+	}
+
+	select {
+	case s.queue <- alrt:
+		s.sent[key] = sent
+	default:
+		s.drop(alrt, errors.New("queue is full"))
+	}
+}
+
+// Dropped returns the number of alerts which could not be delivered.
+func (s *Sink) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func (s *Sink) drop(alrt *api.Alert, err error) {
+	atomic.AddUint64(&s.dropped, 1)
+	stats.Record(s.ctx, observations.AlertsDropped.M(1))
+	logger.Errorf("dropping alert %s for %s: %s", alrt.Name, alrt.Peer, err)
+}
+
+func (s *Sink) run() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case alrt := <-s.queue:
+			err := s.deliver(alrt)
+			if err != nil {
+				s.drop(alrt, err)
+			}
+		}
+	}
+}
+
+// deliver POSTs an alert, retrying up to MaxRetries times.
+func (s *Sink) deliver(alrt *api.Alert) error {
+	body, err := json.Marshal(alrt)
+	if err != nil {
+		return err
+	}
+
+	backoff := s.config.RetryBackoff
+	for i := 0; ; i++ {
+		err = s.post(body)
+		if err == nil || i >= s.config.MaxRetries {
+			return err
+		}
+		logger.Debugf("delivering alert failed (retrying in %s): %s", backoff, err)
+		select {
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (s *Sink) post(body []byte) error {
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, s.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.config.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign([]byte(s.config.Secret), body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of the body with the given
+// secret, as sent in the SignatureHeader.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Shutdown stops delivering alerts. Queued alerts are discarded.
+func (s *Sink) Shutdown(ctx context.Context) error {
+	s.shutdownLock.Lock()
+	defer s.shutdownLock.Unlock()
+
+	if s.shutdown {
+		logger.Debug("webhook sink already shut down")
+		return nil
+	}
+
+	logger.Info("stopping webhook sink")
+	s.cancel()
+	s.wg.Wait()
+	s.shutdown = true
+	return nil
+}
@@ -0,0 +1,171 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/test"
+)
+
+func testAlert() *api.Alert {
+	return &api.Alert{
+		Metric: api.Metric{
+			Name:   "ping",
+			Peer:   test.PeerID1,
+			Expire: time.Now().UnixNano(),
+			Valid:  true,
+		},
+		TriggeredAt: time.Now(),
+	}
+}
+
+func testSink(t *testing.T, url string, cfgFn func(*Config)) *Sink {
+	cfg := &Config{}
+	cfg.Default()
+	cfg.URL = url
+	cfg.RetryBackoff = 10 * time.Millisecond
+	if cfgFn != nil {
+		cfgFn(cfg)
+	}
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+	return s
+}
+
+func TestNew(t *testing.T) {
+	cfg := &Config{}
+	cfg.Default()
+	_, err := New(cfg)
+	if err == nil {
+		t.Error("expected an error without url")
+	}
+}
+
+func TestSinkDeliver(t *testing.T) {
+	ctx := context.Background()
+	received := make(chan *api.Alert, 1)
+	var failures int32 = 2
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if sig := r.Header.Get(SignatureHeader); sig != "sha256="+Sign([]byte("secret"), body) {
+			t.Errorf("unexpected signature: %s", sig)
+		}
+		alrt := &api.Alert{}
+		if err := json.Unmarshal(body, alrt); err != nil {
+			t.Error(err)
+		}
+		received <- alrt
+	}))
+	defer srv.Close()
+
+	s := testSink(t, srv.URL, func(cfg *Config) {
+		cfg.Secret = "secret"
+	})
+	s.Alert(ctx, testAlert())
+
+	select {
+	case alrt := <-received:
+		if alrt.Name != "ping" || alrt.Peer != test.PeerID1 {
+			t.Errorf("unexpected alert: %+v", alrt)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("alert not delivered")
+	}
+	if s.Dropped() != 0 {
+		t.Errorf("expected no dropped alerts: %d", s.Dropped())
+	}
+}
+
+func TestSinkDrop(t *testing.T) {
+	ctx := context.Background()
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	s := testSink(t, srv.URL, func(cfg *Config) {
+		cfg.MaxRetries = 2
+	})
+	s.Alert(ctx, testAlert())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Dropped() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the alert to be dropped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Errorf("expected 3 delivery attempts: %d", n)
+	}
+}
+
+func TestSinkQueueFull(t *testing.T) {
+	ctx := context.Background()
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer srv.Close()
+	defer close(block)
+
+	s := testSink(t, srv.URL, func(cfg *Config) {
+		cfg.QueueSize = 1
+	})
+	// The first alert is being delivered and the second is queued.
+	for i := 0; i < 3; i++ {
+		alrt := testAlert()
+		alrt.Expire = int64(i)
+		s.Alert(ctx, alrt)
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if s.Dropped() != 1 {
+		t.Errorf("expected 1 dropped alert: %d", s.Dropped())
+	}
+}
+
+func TestSinkDuplicates(t *testing.T) {
+	ctx := context.Background()
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer srv.Close()
+
+	s := testSink(t, srv.URL, nil)
+	alrt := testAlert()
+	s.Alert(ctx, alrt)
+	s.Alert(ctx, alrt)
+	recovered := *alrt
+	recovered.Recovered = true
+	s.Alert(ctx, &recovered)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&requests) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the alerts to be delivered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("expected the duplicate alert to be skipped: %d requests", n)
+	}
+}
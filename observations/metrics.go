@@ -26,6 +26,7 @@ var (
 var (
 	HostKey       = makeKey("host")
 	RemotePeerKey = makeKey("remote_peer")
+	MetricNameKey = makeKey("metric_name")
 )
 
 // metrics
@@ -38,6 +39,26 @@ var (
 	Peers = stats.Int64("cluster/peers", "Number of cluster peers", stats.UnitDimensionless)
 	// Alerts is the number of alerts that have been sent due to peers not sending "ping" heartbeats in time.
 	Alerts = stats.Int64("cluster/alerts", "Number of alerts triggered", stats.UnitDimensionless)
+	// AlertsDropped counts the alerts which could not be delivered to an alert sink.
+	AlertsDropped = stats.Int64("cluster/alerts_dropped", "Number of alerts not delivered", stats.UnitDimensionless)
+	// PubsubMessagesReceived counts the metrics received by the pubsub monitor.
+	PubsubMessagesReceived = stats.Int64("pubsubmon/messages_received", "Number of metrics received", stats.UnitDimensionless)
+	// PubsubMessagesDropped counts the received metrics which were not logged (i.e. duplicates).
+	PubsubMessagesDropped = stats.Int64("pubsubmon/messages_dropped", "Number of received metrics dropped", stats.UnitDimensionless)
+	// PubsubMessagesRateLimited counts the received metrics which were not logged because their publisher exceeded the metric rate limit.
+	PubsubMessagesRateLimited = stats.Int64("pubsubmon/messages_rate_limited", "Number of received metrics dropped by the rate limit", stats.UnitDimensionless)
+	// PubsubDecodeErrors counts the pubsub monitor messages which could not be decoded.
+	PubsubDecodeErrors = stats.Int64("pubsubmon/decode_errors", "Number of messages which could not be decoded", stats.UnitDimensionless)
+	// CRDTHeads is the number of heads of the CRDT DAG. More than one means that it has branches to be merged.
+	CRDTHeads = stats.Int64("crdt/heads", "Number of CRDT DAG heads", stats.UnitDimensionless)
+	// CRDTMaxHeadHeight is the height of the highest head of the CRDT DAG.
+	CRDTMaxHeadHeight = stats.Int64("crdt/max_head_height", "Height of the highest CRDT DAG head", stats.UnitDimensionless)
+	// CRDTPendingDeltas counts the batched updates not yet committed to the CRDT DAG.
+	CRDTPendingDeltas = stats.Int64("crdt/pending_deltas", "Number of batched updates waiting to be committed", stats.UnitDimensionless)
+	// PeerStaleness is the age of the most recent metric received from every peer.
+	PeerStaleness = stats.Float64("pubsubmon/peer_staleness", "Seconds since the last metric from the peer was received", stats.UnitSeconds)
+	// IPFSCircuitBreaker is the state of the IPFS connector circuit breaker: 0 when requests reach the daemon, 1 when a single request probes it and 2 when requests fail fast.
+	IPFSCircuitBreaker = stats.Int64("ipfs/circuit_breaker", "State of the IPFS connector circuit breaker", stats.UnitDimensionless)
 )
 
 // views, which is just the aggregation of the metrics
@@ -66,11 +87,81 @@ var (
 		Aggregation: messageCountDistribution,
 	}
 
+	AlertsDroppedView = &view.View{
+		Measure:     AlertsDropped,
+		TagKeys:     []tag.Key{HostKey},
+		Aggregation: view.Count(),
+	}
+
+	PubsubMessagesReceivedView = &view.View{
+		Measure:     PubsubMessagesReceived,
+		TagKeys:     []tag.Key{HostKey, MetricNameKey},
+		Aggregation: view.Count(),
+	}
+
+	PubsubMessagesDroppedView = &view.View{
+		Measure:     PubsubMessagesDropped,
+		TagKeys:     []tag.Key{HostKey, MetricNameKey},
+		Aggregation: view.Count(),
+	}
+
+	PubsubMessagesRateLimitedView = &view.View{
+		Measure:     PubsubMessagesRateLimited,
+		TagKeys:     []tag.Key{HostKey, MetricNameKey},
+		Aggregation: view.Count(),
+	}
+
+	PubsubDecodeErrorsView = &view.View{
+		Measure:     PubsubDecodeErrors,
+		TagKeys:     []tag.Key{HostKey},
+		Aggregation: view.Count(),
+	}
+
+	CRDTHeadsView = &view.View{
+		Measure:     CRDTHeads,
+		TagKeys:     []tag.Key{HostKey},
+		Aggregation: view.LastValue(),
+	}
+
+	CRDTMaxHeadHeightView = &view.View{
+		Measure:     CRDTMaxHeadHeight,
+		TagKeys:     []tag.Key{HostKey},
+		Aggregation: view.LastValue(),
+	}
+
+	CRDTPendingDeltasView = &view.View{
+		Measure:     CRDTPendingDeltas,
+		TagKeys:     []tag.Key{HostKey},
+		Aggregation: view.LastValue(),
+	}
+
+	PeerStalenessView = &view.View{
+		Measure:     PeerStaleness,
+		TagKeys:     []tag.Key{HostKey, RemotePeerKey},
+		Aggregation: view.LastValue(),
+	}
+
+	IPFSCircuitBreakerView = &view.View{
+		Measure:     IPFSCircuitBreaker,
+		TagKeys:     []tag.Key{HostKey},
+		Aggregation: view.LastValue(),
+	}
+
 	DefaultViews = []*view.View{
 		PinsView,
 		TrackerPinsView,
 		PeersView,
 		AlertsView,
+		AlertsDroppedView,
+		PubsubMessagesReceivedView,
+		PubsubMessagesDroppedView,
+		PubsubMessagesRateLimitedView,
+		PubsubDecodeErrorsView,
+		CRDTHeadsView,
+		CRDTMaxHeadHeightView,
+		CRDTPendingDeltasView,
+		PeerStalenessView,
+		IPFSCircuitBreakerView,
 	}
 )
 
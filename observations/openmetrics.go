@@ -0,0 +1,162 @@
+package observations
+
+import (
+	"sort"
+	"strings"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/metric/metricproducer"
+	"go.opencensus.io/trace"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// exemplarGatherer wraps a Gatherer and attaches the exemplars recorded by
+// OpenCensus for distributions to the buckets of the corresponding
+// Prometheus histograms. Only exemplars carrying a trace SpanContext are
+// used, and they are labeled with the trace ID. Exemplars are only part of
+// the exposition when the scraper negotiates the OpenMetrics format.
+type exemplarGatherer struct {
+	prom.Gatherer
+	namespace string
+}
+
+func (eg *exemplarGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := eg.Gatherer.Gather()
+	if err != nil {
+		return mfs, err
+	}
+
+	exemplars := eg.readExemplars()
+	if len(exemplars) == 0 {
+		return mfs, nil
+	}
+
+	for _, mf := range mfs {
+		if mf.GetType() != dto.MetricType_HISTOGRAM {
+			continue
+		}
+		for _, m := range mf.Metric {
+			byBound, ok := exemplars[seriesKey(mf.GetName(), m.GetLabel())]
+			if !ok {
+				continue
+			}
+			for _, b := range m.GetHistogram().GetBucket() {
+				if ex, ok := byBound[b.GetUpperBound()]; ok {
+					b.Exemplar = ex
+				}
+			}
+		}
+	}
+	return mfs, nil
+}
+
+// readExemplars returns the exemplars with trace information for every
+// distribution known to OpenCensus, indexed by series and bucket bound.
+func (eg *exemplarGatherer) readExemplars() map[string]map[float64]*dto.Exemplar {
+	exemplars := make(map[string]map[float64]*dto.Exemplar)
+	for _, producer := range metricproducer.GlobalManager().GetAll() {
+		for _, metric := range producer.Read() {
+			if metric.Descriptor.Type != metricdata.TypeCumulativeDistribution {
+				continue
+			}
+			name := sanitize(metric.Descriptor.Name)
+			if eg.namespace != "" {
+				name = eg.namespace + "_" + name
+			}
+			for _, ts := range metric.TimeSeries {
+				labels := make([]*dto.LabelPair, 0, len(ts.LabelValues))
+				for i, lv := range ts.LabelValues {
+					if i >= len(metric.Descriptor.LabelKeys) {
+						break
+					}
+					k := sanitize(metric.Descriptor.LabelKeys[i].Key)
+					v := lv.Value
+					labels = append(labels, &dto.LabelPair{Name: &k, Value: &v})
+				}
+				key := seriesKey(name, labels)
+				for _, point := range ts.Points {
+					dist, ok := point.Value.(*metricdata.Distribution)
+					if !ok || dist.BucketOptions == nil {
+						continue
+					}
+					for i, bound := range dist.BucketOptions.Bounds {
+						if i >= len(dist.Buckets) {
+							break
+						}
+						ex := toPromExemplar(dist.Buckets[i].Exemplar)
+						if ex == nil {
+							continue
+						}
+						if exemplars[key] == nil {
+							exemplars[key] = make(map[float64]*dto.Exemplar)
+						}
+						exemplars[key][bound] = ex
+					}
+				}
+			}
+		}
+	}
+	return exemplars
+}
+
+func toPromExemplar(ex *metricdata.Exemplar) *dto.Exemplar {
+	if ex == nil {
+		return nil
+	}
+	sc, ok := ex.Attachments[metricdata.AttachmentKeySpanContext].(trace.SpanContext)
+	if !ok {
+		return nil
+	}
+	name := "trace_id"
+	traceID := sc.TraceID.String()
+	value := ex.Value
+	return &dto.Exemplar{
+		Label:     []*dto.LabelPair{{Name: &name, Value: &traceID}},
+		Value:     &value,
+		Timestamp: timestamppb.New(ex.Timestamp),
+	}
+}
+
+// seriesKey identifies a metric series by its name and its labels.
+func seriesKey(name string, labels []*dto.LabelPair) string {
+	pairs := make([]string, 0, len(labels))
+	for _, l := range labels {
+		pairs = append(pairs, l.GetName()+"="+l.GetValue())
+	}
+	sort.Strings(pairs)
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// PrometheusName converts the given name to a valid Prometheus metric or
+// label name.
+func PrometheusName(s string) string {
+	return sanitize(s)
+}
+
+// sanitize converts OpenCensus names to valid Prometheus names in the same
+// way the OpenCensus Prometheus exporter does.
+func sanitize(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+	if len(s) > 100 {
+		s = s[:100]
+	}
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+	if s[0] >= '0' && s[0] <= '9' {
+		s = "_" + s
+	}
+	if s[0] == '_' {
+		s = "key" + s
+	}
+	return s
+}
@@ -0,0 +1,78 @@
+package observations
+
+import (
+	"context"
+	"testing"
+
+	"contrib.go.opencensus.io/exporter/prometheus"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+)
+
+func TestExemplarGatherer(t *testing.T) {
+	ctx := context.Background()
+	m := stats.Float64("test/latency", "test latency", stats.UnitMilliseconds)
+	v := &view.View{
+		Measure:     m,
+		TagKeys:     []tag.Key{HostKey},
+		Aggregation: view.Distribution(1, 10, 100),
+	}
+	if err := view.Register(v); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(v)
+
+	registry := prom.NewRegistry()
+	_, err := prometheus.NewExporter(prometheus.Options{
+		Namespace: "test",
+		Registry:  registry,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sc := trace.SpanContext{TraceID: trace.TraceID{1, 2, 3}}
+	err = stats.RecordWithOptions(ctx,
+		stats.WithTags(tag.Upsert(HostKey, "a")),
+		stats.WithMeasurements(m.M(5)),
+		stats.WithAttachments(metricdata.Attachments{
+			metricdata.AttachmentKeySpanContext: sc,
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eg := &exemplarGatherer{Gatherer: registry, namespace: "test"}
+	mfs, err := eg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, mf := range mfs {
+		if mf.GetName() != "test_test_latency" {
+			continue
+		}
+		for _, b := range mf.Metric[0].GetHistogram().GetBucket() {
+			ex := b.GetExemplar()
+			if ex == nil {
+				continue
+			}
+			if b.GetUpperBound() != 10 {
+				t.Errorf("exemplar in the wrong bucket: %f", b.GetUpperBound())
+			}
+			if ex.GetLabel()[0].GetValue() != sc.TraceID.String() {
+				t.Error("unexpected trace_id in exemplar")
+			}
+			found = true
+		}
+	}
+	if !found {
+		t.Error("expected an exemplar")
+	}
+}
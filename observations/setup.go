@@ -5,6 +5,7 @@ import (
 	"expvar"
 	"net/http"
 	"net/http/pprof"
+	"sync"
 
 	rpc "github.com/libp2p/go-libp2p-gorpc"
 	manet "github.com/multiformats/go-multiaddr/net"
@@ -14,12 +15,28 @@ import (
 	ocgorpc "github.com/lanzafame/go-libp2p-ocgorpc"
 	prom "github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opencensus.io/plugin/ochttp"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/trace"
 	"go.opencensus.io/zpages"
 )
 
+var (
+	gathererMux sync.RWMutex
+	// gatherer provides the stats collected by this process, once
+	// SetupMetrics has enabled them.
+	gatherer prom.Gatherer
+)
+
+// Gatherer returns the Prometheus gatherer providing the stats of this
+// process, or nil when stats collection is not enabled.
+func Gatherer() prom.Gatherer {
+	gathererMux.RLock()
+	defer gathererMux.RUnlock()
+	return gatherer
+}
+
 // SetupMetrics configures and starts stats tooling,
 // if enabled.
 func SetupMetrics(cfg *MetricsConfig) error {
@@ -67,8 +84,9 @@ func setupMetrics(cfg *MetricsConfig) error {
 	goCollector := collectors.NewGoCollector()
 	procCollector := collectors.NewProcessCollector(collectors.ProcessCollectorOpts{})
 	registry.MustRegister(goCollector, procCollector)
+	namespace := "ipfscluster"
 	pe, err := prometheus.NewExporter(prometheus.Options{
-		Namespace: "ipfscluster",
+		Namespace: namespace,
 		Registry:  registry,
 	})
 	if err != nil {
@@ -109,10 +127,19 @@ func setupMetrics(cfg *MetricsConfig) error {
 	if err != nil {
 		return err
 	}
+	eg := &exemplarGatherer{Gatherer: registry, namespace: namespace}
+	gathererMux.Lock()
+	gatherer = eg
+	gathererMux.Unlock()
 	go func() {
 		mux := http.NewServeMux()
 		zpages.Handle(mux, "/debug")
-		mux.Handle("/metrics", pe)
+		// The OpenMetrics format (which includes exemplars) is
+		// used when requested in the Accept header.
+		mux.Handle("/metrics", promhttp.HandlerFor(
+			eg,
+			promhttp.HandlerOpts{EnableOpenMetrics: true},
+		))
 		mux.Handle("/debug/vars", expvar.Handler())
 		mux.HandleFunc("/debug/pprof/", pprof.Index)
 		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
@@ -0,0 +1,155 @@
+package ipfscluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	"go.opencensus.io/trace"
+)
+
+var (
+	// opLogMaxWait is the longest OpLog waits for new operations.
+	opLogMaxWait = time.Minute
+	// opLogDefaultLimit is the number of operations returned by OpLog
+	// when no limit is given.
+	opLogDefaultLimit = 1000
+)
+
+// opLog keeps the last operations committed to the shared state in a ring
+// buffer of OpLogSize entries. A nil opLog records nothing.
+type opLog struct {
+	mu      sync.RWMutex
+	ops     []*api.Operation
+	last    uint64
+	updated chan struct{} // closed and replaced on every new operation
+}
+
+func newOpLog(size int) *opLog {
+	if size <= 0 {
+		return nil
+	}
+	return &opLog{
+		ops:     make([]*api.Operation, size),
+		updated: make(chan struct{}),
+	}
+}
+
+// recordPin records an OperationPin or, for items pinned before, an
+// OperationUpdate.
+func (l *opLog) recordPin(pin *api.Pin) {
+	opType := api.OperationPin
+	if !pin.CreatedAt.IsZero() && pin.Timestamp.After(pin.CreatedAt) {
+		opType = api.OperationUpdate
+	}
+	l.record(opType, pin.Cid, pin)
+}
+
+// recordUnpin records an OperationUnpin.
+func (l *opLog) recordUnpin(c cid.Cid) {
+	l.record(api.OperationUnpin, c, nil)
+}
+
+func (l *opLog) record(opType api.OperationType, c cid.Cid, pin *api.Pin) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.last++
+	l.ops[l.last%uint64(len(l.ops))] = &api.Operation{
+		Seq:       l.last,
+		Type:      opType,
+		Cid:       c,
+		Pin:       pin,
+		Timestamp: time.Now(),
+	}
+	close(l.updated)
+	l.updated = make(chan struct{})
+}
+
+// after returns up to limit operations following the given sequence number,
+// which is not included, the first and last sequence numbers retained, and a
+// channel which is closed when a new operation is recorded. It returns an
+// error when some of the requested operations are no longer retained.
+func (l *opLog) after(seq uint64, limit int) ([]*api.Operation, uint64, uint64, <-chan struct{}, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	first := uint64(1)
+	if size := uint64(len(l.ops)); l.last > size {
+		first = l.last - size + 1
+	}
+	if seq+1 < first {
+		return nil, first, l.last, nil, fmt.Errorf(
+			"%w: the operation log starts at %d",
+			api.ErrExpired,
+			first,
+		)
+	}
+
+	var ops []*api.Operation
+	for s := seq + 1; s <= l.last && len(ops) < limit; s++ {
+		ops = append(ops, l.ops[s%uint64(len(l.ops))])
+	}
+	return ops, first, l.last, l.updated, nil
+}
+
+// OpLog returns the operations committed to the shared state, as seen by
+// this peer, after the given sequence number (the operation with that number
+// is not included). When there are none, it waits up to the given duration
+// (at most a minute) for new ones. It allows external consumers to mirror
+// the pinset: they can fetch the current pinset and follow the log from the
+// Last sequence number at that time, passing the Seq of the last operation
+// received on every request.
+//
+// The log is only kept in memory: it starts empty, and is numbered from 1
+// again, every time the peer starts. Consumers must start over when the
+// InstanceID of the peer changes, or when an error of ErrorKindExpired is
+// returned as they fell behind.
+func (c *Cluster) OpLog(ctx context.Context, after uint64, limit int, wait time.Duration) (*api.OpLogPage, error) {
+	_, span := trace.StartSpan(ctx, "cluster/OpLog")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	if c.oplog == nil {
+		return nil, errors.New("the operation log is disabled (oplog_size is 0)")
+	}
+	if limit <= 0 {
+		limit = opLogDefaultLimit
+	}
+	if wait > opLogMaxWait {
+		wait = opLogMaxWait
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	for {
+		ops, first, last, updated, err := c.oplog.after(after, limit)
+		if err != nil {
+			return nil, err
+		}
+		if len(ops) == 0 {
+			select {
+			case <-updated:
+				continue
+			case <-ctx.Done():
+			}
+		}
+		return &api.OpLogPage{
+			Peer:       c.id,
+			InstanceID: c.instanceID,
+			First:      first,
+			Last:       last,
+			Operations: ops,
+		}, nil
+	}
+}
@@ -0,0 +1,81 @@
+package ipfscluster
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// Pin ownership: the identity an API client authenticates with is recorded as
+// the owner of the pins it creates (api.OwnerMetaKey). When
+// EnforcePinOwnership is set, only the owner of a pin and the
+// AdminIdentities may update or unpin it. API components mark the context
+// of the requests of their clients with api.WithClientIdentity, so the
+// requests of other peers and the operations of the cluster itself (i.e.
+// repinning) are not restricted.
+
+func (c *Cluster) isAdmin(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, admin := range c.config.AdminIdentities {
+		if admin == id {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPinOwner returns api.ErrForbidden when pin ownership is enforced and
+// ctx is the context of a request from an API client which may not modify
+// the given existing pin, if any.
+func (c *Cluster) checkPinOwner(ctx context.Context, existing *api.Pin) error {
+	if existing == nil || !c.config.EnforcePinOwnership || !api.IsClientRequest(ctx) {
+		return nil
+	}
+
+	id := api.ClientIdentity(ctx)
+	owner := existing.Metadata[api.OwnerMetaKey]
+	if (owner == "" || owner != id) && !c.isAdmin(id) {
+		logger.Debugf("%q cannot modify pin %s owned by %q", id, existing.Cid, owner)
+		return fmt.Errorf("%s: %w", existing.Cid, api.ErrForbidden)
+	}
+	return nil
+}
+
+// setPinOwner sets the owner in the metadata of a pin requested by an API
+// client: the owner of the existing pin, if any, or the client itself.
+// Admins may set a different owner explicitly.
+func (c *Cluster) setPinOwner(ctx context.Context, pin *api.Pin, existing *api.Pin) {
+	if !api.IsClientRequest(ctx) {
+		return
+	}
+
+	id := api.ClientIdentity(ctx)
+	var owner string
+	if existing != nil {
+		owner = existing.Metadata[api.OwnerMetaKey]
+	}
+	if owner == "" {
+		owner = id
+	}
+	if explicit := pin.Metadata[api.OwnerMetaKey]; explicit != "" && c.isAdmin(id) {
+		owner = explicit
+	}
+	if owner == pin.Metadata[api.OwnerMetaKey] {
+		return
+	}
+
+	// The metadata may be shared with the caller.
+	meta := make(map[string]string, len(pin.Metadata)+1)
+	for k, v := range pin.Metadata {
+		meta[k] = v
+	}
+	if owner == "" {
+		delete(meta, api.OwnerMetaKey)
+	} else {
+		meta[api.OwnerMetaKey] = owner
+	}
+	pin.Metadata = meta
+}
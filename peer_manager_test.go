@@ -502,6 +502,92 @@ func TestClustersPeerRemoveReallocsPins(t *testing.T) {
 	}
 }
 
+func TestClustersPeerRemoveRebalance(t *testing.T) {
+	ctx := context.Background()
+	clusters, mocks := createClusters(t)
+	defer shutdownClusters(t, clusters, mocks)
+
+	if len(clusters) < 3 {
+		t.Skip("test needs at least 3 clusters")
+	}
+
+	checkInterval := rebalanceCheckInterval
+	rebalanceCheckInterval = 100 * time.Millisecond
+	defer func() { rebalanceCheckInterval = checkInterval }()
+
+	rf := nClusters - 1
+	for _, c := range clusters {
+		c.config.ReplicationFactorMin = rf
+		c.config.ReplicationFactorMax = rf
+		c.config.DisableRepinning = true
+		c.config.RebalanceOnPeerRemoval = true
+	}
+
+	prefix := test.Cid1.Prefix()
+	for i := 0; i < nClusters; i++ {
+		h, err := prefix.Sum(randomBytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = clusters[0].Pin(ctx, h, api.PinOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ttlDelay()
+	}
+	pinDelay()
+
+	// Remove the last peer, issuing the request from another one. crdt
+	// moves the pins but errors removing the peer.
+	removedID := clusters[nClusters-1].id
+	err := clusters[1].PeerRemove(ctx, removedID)
+	if err != nil && consensus != "crdt" {
+		t.Fatal(err)
+	}
+	if err == nil {
+		// The pins were pinned on their new allocations before
+		// the peer was removed.
+		leader := clusters[1]
+		if pid, err := leader.consensus.Leader(ctx); err == nil {
+			for _, c := range clusters {
+				if c.id == pid {
+					leader = c
+				}
+			}
+		}
+		pins, err := leader.Pins(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pin := range pins {
+			gpi, err := leader.Status(ctx, pin.Cid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !gpi.Replication(pin.Allocations).Complete() {
+				t.Errorf("%s should be pinned on its new allocations", pin.Cid)
+			}
+		}
+	}
+
+	delay()
+	pins, err := clusters[0].Pins(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != nClusters {
+		t.Fatal("expected all the pins in the state")
+	}
+	for _, pin := range pins {
+		if containsPeer(pin.Allocations, removedID) {
+			t.Errorf("%s should not be allocated to the removed peer", pin.Cid)
+		}
+		if len(pin.Allocations) != rf {
+			t.Errorf("%s should be allocated to %d peers: %s", pin.Cid, rf, pin.Allocations)
+		}
+	}
+}
+
 func TestClustersPeerJoin(t *testing.T) {
 	ctx := context.Background()
 	clusters, mocks, boot := peerManagerClusters(t)
@@ -715,3 +801,46 @@ func TestClustersPeerRejoin(t *testing.T) {
 		t.Error("re-joined cluster should have original pin")
 	}
 }
+
+func TestClustersMDNSDiscovery(t *testing.T) {
+	if consensus == "raft" {
+		t.Skip("raft peers must be added to the peerset to be monitored")
+	}
+	ctx := context.Background()
+
+	hosts, pubsubs, dhts := createHosts(t, testingClusterSecret, 2)
+	clusters := make([]*Cluster, 2)
+	mocks := make([]*test.IpfsMock, 2)
+	for i := range clusters {
+		clusterCfg, store, cons, apis, ipfs, tracker, mon, alloc, inf, tracer, mock := createComponents(t, hosts[i], pubsubs[i], dhts[i], i, false)
+		clusterCfg.MDNSInterval = time.Second
+		clusters[i] = createCluster(t, hosts[i], dhts[i], clusterCfg, store, cons, apis, ipfs, tracker, mon, alloc, inf, tracer)
+		mocks[i] = mock
+	}
+	defer shutdownClusters(t, clusters, mocks)
+	for _, c := range clusters {
+		<-c.Ready()
+	}
+
+	// Without bootstrapping, every peer should find the other one and
+	// receive its metrics.
+	knows := func(c *Cluster, pid peer.ID) bool {
+		for _, m := range c.monitor.LatestMetrics(ctx, pingMetricName) {
+			if m.Peer == pid && !m.Expired() {
+				return true
+			}
+		}
+		return false
+	}
+	timer := time.NewTimer(30 * time.Second)
+	defer timer.Stop()
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for !knows(clusters[0], clusters[1].id) || !knows(clusters[1], clusters[0].id) {
+		select {
+		case <-timer.C:
+			t.Fatal("peers did not discover each other")
+		case <-ticker.C:
+		}
+	}
+}
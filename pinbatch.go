@@ -0,0 +1,169 @@
+package ipfscluster
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+
+	trace "go.opencensus.io/trace"
+)
+
+// errBatchFailed is reported for the items of an atomic batch which were not
+// pinned because another one failed.
+var errBatchFailed = errors.New("not pinned: another pin of the batch failed")
+
+// PinBatch pins the items of a batch one by one, like Pin, and reports the
+// result of each of them.
+//
+// When the batch is Atomic, all the pins are validated first, as with the
+// DryRun option, and none is committed unless they all are valid. Since
+// every pin is committed to the consensus separately, a pin failing once
+// others have been committed makes these roll back to their previous state:
+// they are unpinned, or re-pinned with their former options.
+func (c *Cluster) PinBatch(ctx context.Context, batch *api.PinBatch) (*api.PinBatchResult, error) {
+	_, span := trace.StartSpan(ctx, "cluster/PinBatch")
+	defer span.End()
+	ctx = api.CopyClientIdentity(trace.NewContext(c.ctx, span), ctx)
+
+	if c.followerMode() {
+		return nil, errFollowerMode
+	}
+
+	if len(batch.Pins) == 0 {
+		return nil, errors.New("the pin batch is empty")
+	}
+
+	result := &api.PinBatchResult{
+		Items: make([]api.PinBatchItem, len(batch.Pins)),
+	}
+	seen := make(map[cid.Cid]struct{}, len(batch.Pins))
+	for i, p := range batch.Pins {
+		item := &result.Items[i]
+		item.Cid = p.Cid
+		switch _, dup := seen[p.Cid]; {
+		case p.Cid == cid.Undef:
+			item.Error = "bad pin object"
+		case dup:
+			item.Error = "the cid is repeated in the batch"
+		case p.PinUpdate != cid.Undef || p.DryRun:
+			item.Error = "the pin-update and dry-run options cannot be used in a batch"
+		}
+		seen[p.Cid] = struct{}{}
+	}
+
+	if batch.Atomic {
+		for i, p := range batch.Pins {
+			item := &result.Items[i]
+			if item.Error != "" {
+				continue
+			}
+			dryRun := api.PinWithOpts(p.Cid, p.PinOptions)
+			dryRun.DryRun = true
+			if _, _, err := c.pin(ctx, dryRun, []peer.ID{}); err != nil {
+				item.Error = err.Error()
+			}
+		}
+		if countBatchFailures(result) > 0 {
+			failBatch(result)
+			return result, nil
+		}
+	}
+
+	// previous holds the pins replaced by the committed ones, or nil.
+	previous := make([]*api.Pin, len(batch.Pins))
+	changed := make([]bool, len(batch.Pins))
+	for i, p := range batch.Pins {
+		item := &result.Items[i]
+		if item.Error != "" {
+			continue
+		}
+
+		existing, err := c.PinGet(ctx, p.Cid)
+		if err != nil && err != state.ErrNotFound {
+			item.Error = err.Error()
+		} else {
+			previous[i] = existing
+			item.Pin, changed[i], err = c.pin(ctx, api.PinWithOpts(p.Cid, p.PinOptions), []peer.ID{})
+			if err != nil {
+				item.Pin = nil
+				item.Error = err.Error()
+			}
+		}
+
+		if item.Error != "" && batch.Atomic {
+			c.rollbackPinBatch(ctx, result, previous)
+			failBatch(result)
+			return result, nil
+		}
+	}
+
+	for i, item := range result.Items {
+		if item.Pin != nil {
+			if changed[i] {
+				c.watchCommit(item.Pin)
+			}
+			result.Pinned++
+		}
+	}
+	result.Failed = countBatchFailures(result)
+	logger.Infof("pin batch: %d pins committed, %d failed", result.Pinned, result.Failed)
+	return result, nil
+}
+
+// rollbackPinBatch reverts the pins of the batch which have been committed,
+// in reverse order.
+func (c *Cluster) rollbackPinBatch(ctx context.Context, result *api.PinBatchResult, previous []*api.Pin) {
+	result.RolledBack = true
+	for i := len(result.Items) - 1; i >= 0; i-- {
+		item := &result.Items[i]
+		if item.Pin == nil {
+			continue
+		}
+
+		var err error
+		if previous[i] != nil {
+			err = c.consensus.LogPin(ctx, previous[i])
+		} else {
+			err = c.consensus.LogUnpin(ctx, item.Pin)
+		}
+		if err != nil {
+			// The pin stays committed.
+			logger.Errorf("pin batch: rolling back %s: %s", item.Cid, err)
+			continue
+		}
+		item.Pin = nil
+		item.Error = "rolled back: another pin of the batch failed"
+	}
+}
+
+// failBatch counts the results of a failed atomic batch, reporting
+// errBatchFailed for the items which were not attempted.
+func failBatch(result *api.PinBatchResult) {
+	for i := range result.Items {
+		item := &result.Items[i]
+		if item.Pin != nil {
+			result.Pinned++
+			continue
+		}
+		if item.Error == "" {
+			item.Error = errBatchFailed.Error()
+		}
+	}
+	result.Failed = countBatchFailures(result)
+	logger.Warnf("pin batch failed: %d pins committed, %d failed", result.Pinned, result.Failed)
+}
+
+func countBatchFailures(result *api.PinBatchResult) int {
+	n := 0
+	for _, item := range result.Items {
+		if item.Error != "" {
+			n++
+		}
+	}
+	return n
+}
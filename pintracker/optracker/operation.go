@@ -67,6 +67,9 @@ type Operation struct {
 	priority     bool
 	error        string
 	ts           time.Time
+	created      time.Time
+	finished     time.Time
+	progress     int
 }
 
 // NewOperation creates a new Operation.
@@ -75,6 +78,7 @@ func NewOperation(ctx context.Context, pin *api.Pin, typ OperationType, ph Phase
 	defer span.End()
 
 	ctx, cancel := context.WithCancel(ctx)
+	now := time.Now()
 	return &Operation{
 		ctx:    ctx,
 		cancel: cancel,
@@ -84,7 +88,8 @@ func NewOperation(ctx context.Context, pin *api.Pin, typ OperationType, ph Phase
 		phase:        ph,
 		attemptCount: 0,
 		priority:     false,
-		ts:           time.Now(),
+		ts:           now,
+		created:      now,
 		error:        "",
 	}
 }
@@ -147,6 +152,11 @@ func (op *Operation) SetPhase(ph Phase) {
 	{
 		op.phase = ph
 		op.ts = time.Now()
+		if ph == PhaseDone || ph == PhaseError {
+			op.finished = op.ts
+		} else {
+			op.finished = time.Time{}
+		}
 	}
 	op.mu.Unlock()
 	span.End()
@@ -205,11 +215,20 @@ func (op *Operation) SetError(err error) {
 		op.phase = PhaseError
 		op.error = err.Error()
 		op.ts = time.Now()
+		op.finished = op.ts
 	}
 	op.mu.Unlock()
 	span.End()
 }
 
+// SetReason attaches a message explaining why the operation is in its
+// current phase, without changing it.
+func (op *Operation) SetReason(reason string) {
+	op.mu.Lock()
+	op.error = reason
+	op.mu.Unlock()
+}
+
 // Type returns the operation Type.
 func (op *Operation) Type() OperationType {
 	return op.opType
@@ -230,6 +249,42 @@ func (op *Operation) Timestamp() time.Time {
 	return ts
 }
 
+// Progress returns how many blocks the operation has fetched, as reported
+// by IPFS.
+func (op *Operation) Progress() int {
+	op.mu.RLock()
+	defer op.mu.RUnlock()
+	return op.progress
+}
+
+// SetProgress records how many blocks the operation has fetched. Reports
+// lower than the current progress are ignored, as they may arrive out of
+// order.
+func (op *Operation) SetProgress(blocks int) {
+	op.mu.Lock()
+	if blocks > op.progress {
+		op.progress = blocks
+	}
+	op.mu.Unlock()
+}
+
+// Since returns the time when this operation was created.
+func (op *Operation) Since() time.Time {
+	// created is never modified.
+	return op.created
+}
+
+// Duration returns how long the operation took from its creation until it
+// was done or failed, or 0 when it has not finished.
+func (op *Operation) Duration() time.Duration {
+	op.mu.RLock()
+	defer op.mu.RUnlock()
+	if op.finished.IsZero() {
+		return 0
+	}
+	return op.finished.Sub(op.created)
+}
+
 // Cancelled returns whether the context for this
 // operation has been cancelled.
 func (op *Operation) Cancelled() bool {
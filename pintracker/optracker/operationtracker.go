@@ -23,6 +23,11 @@ import (
 
 var logger = logging.Logger("optracker")
 
+// maxPinDurations is how many pin durations the OperationTracker keeps at
+// most. Past it, the duration of an arbitrary item is forgotten for every
+// new one.
+var maxPinDurations = 100000
+
 // OperationTracker tracks and manages all inflight Operations.
 type OperationTracker struct {
 	ctx      context.Context // parent context for all ops
@@ -31,6 +36,10 @@ type OperationTracker struct {
 
 	mu         sync.RWMutex
 	operations map[cid.Cid]*Operation
+	// durations keeps how long the last successful pin of each item
+	// took, as its operation is cleaned once done, up to
+	// maxPinDurations items.
+	durations map[cid.Cid]time.Duration
 }
 
 func (opt *OperationTracker) String() string {
@@ -58,6 +67,7 @@ func NewOperationTracker(ctx context.Context, pid peer.ID, peerName string) *Ope
 		pid:        pid,
 		peerName:   peerName,
 		operations: make(map[cid.Cid]*Operation),
+		durations:  make(map[cid.Cid]time.Duration),
 	}
 }
 
@@ -100,10 +110,41 @@ func (opt *OperationTracker) Clean(ctx context.Context, op *Operation) {
 	defer opt.mu.Unlock()
 	op2, ok := opt.operations[op.Cid()]
 	if ok && op == op2 { // same pointer
+		opt.unsafeRecordDuration(op)
 		delete(opt.operations, op.Cid())
 	}
 }
 
+// unsafeRecordDuration keeps the duration of a finished pin operation which
+// is about to be cleaned, and forgets it when the item is unpinned.
+func (opt *OperationTracker) unsafeRecordDuration(op *Operation) {
+	switch op.Type() {
+	case OperationPin:
+		if op.Phase() != PhaseDone {
+			return
+		}
+		if _, ok := opt.durations[op.Cid()]; !ok && len(opt.durations) >= maxPinDurations {
+			for c := range opt.durations {
+				delete(opt.durations, c)
+				break
+			}
+		}
+		opt.durations[op.Cid()] = op.Duration()
+	case OperationUnpin:
+		if op.Phase() == PhaseDone {
+			delete(opt.durations, op.Cid())
+		}
+	}
+}
+
+// PinDuration returns how long the last successful pin operation for the
+// given Cid took, or 0 when it is not known.
+func (opt *OperationTracker) PinDuration(ctx context.Context, c cid.Cid) time.Duration {
+	opt.mu.RLock()
+	defer opt.mu.RUnlock()
+	return opt.durations[c]
+}
+
 // Status returns the TrackerStatus associated to the last operation known
 // with the given Cid. It returns false if we are not tracking any operation
 // for the given Cid.
@@ -140,6 +181,18 @@ func (opt *OperationTracker) SetError(ctx context.Context, c cid.Cid, err error)
 	}
 }
 
+// SetProgress records the progress of the ongoing pin operation for the
+// given Cid, if any.
+func (opt *OperationTracker) SetProgress(ctx context.Context, c cid.Cid, blocks int) {
+	opt.mu.RLock()
+	defer opt.mu.RUnlock()
+	op, ok := opt.operations[c]
+	if !ok || op.Type() != OperationPin || op.Phase() != PhaseInProgress {
+		return
+	}
+	op.SetProgress(blocks)
+}
+
 func (opt *OperationTracker) unsafePinInfo(ctx context.Context, op *Operation) api.PinInfo {
 	if op == nil {
 		return api.PinInfo{
@@ -159,12 +212,15 @@ func (opt *OperationTracker) unsafePinInfo(ctx context.Context, op *Operation) a
 		Cid:  op.Cid(),
 		Peer: opt.pid,
 		PinInfoShort: api.PinInfoShort{
-			PeerName:     opt.peerName,
-			Status:       op.ToTrackerStatus(),
-			TS:           op.Timestamp(),
-			AttemptCount: op.AttemptCount(),
-			PriorityPin:  op.PriorityPin(),
-			Error:        op.Error(),
+			PeerName:      opt.peerName,
+			Status:        op.ToTrackerStatus(),
+			TS:            op.Timestamp(),
+			Since:         op.Since(),
+			Duration:      op.Duration(),
+			BlocksFetched: op.Progress(),
+			AttemptCount:  op.AttemptCount(),
+			PriorityPin:   op.PriorityPin(),
+			Error:         op.Error(),
 		},
 	}
 }
@@ -215,12 +271,57 @@ func (opt *OperationTracker) GetAll(ctx context.Context) []*api.PinInfo {
 	return pinfos
 }
 
+// Pending returns the number of operations which are queued or in progress.
+func (opt *OperationTracker) Pending(ctx context.Context) int {
+	opt.mu.RLock()
+	defer opt.mu.RUnlock()
+	n := 0
+	for _, op := range opt.operations {
+		if ph := op.Phase(); ph == PhaseQueued || ph == PhaseInProgress {
+			n++
+		}
+	}
+	return n
+}
+
+// PendingOperations returns the operations which are queued or in progress.
+func (opt *OperationTracker) PendingOperations(ctx context.Context) []*Operation {
+	opt.mu.RLock()
+	defer opt.mu.RUnlock()
+	var ops []*Operation
+	for _, op := range opt.operations {
+		if ph := op.Phase(); ph == PhaseQueued || ph == PhaseInProgress {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+// PastDeadline returns the ongoing pin operations for pins with a Deadline
+// before the given time.
+func (opt *OperationTracker) PastDeadline(ctx context.Context, now time.Time) []*Operation {
+	opt.mu.RLock()
+	defer opt.mu.RUnlock()
+	var ops []*Operation
+	for _, op := range opt.operations {
+		if op.Type() != OperationPin || op.Phase() == PhaseDone {
+			continue
+		}
+		deadline := op.Pin().PinDeadline
+		if !deadline.IsZero() && deadline.Before(now) {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
 // CleanAllDone deletes any operation from the tracker that is in PhaseDone.
 func (opt *OperationTracker) CleanAllDone(ctx context.Context) {
 	opt.mu.Lock()
 	defer opt.mu.Unlock()
 	for _, op := range opt.operations {
 		if op.Phase() == PhaseDone {
+			opt.unsafeRecordDuration(op)
 			delete(opt.operations, op.Cid())
 		}
 	}
@@ -106,6 +106,32 @@ func TestOperationTracker_Clean(t *testing.T) {
 	})
 }
 
+func TestOperationTracker_PinDuration(t *testing.T) {
+	defer func(max int) {
+		maxPinDurations = max
+	}(maxPinDurations)
+	maxPinDurations = 2
+
+	ctx := context.Background()
+	opt := testOperationTracker(t)
+	for _, c := range []cid.Cid{test.Cid1, test.Cid2, test.Cid3} {
+		op := opt.TrackNewOperation(ctx, api.PinCid(c), OperationPin, PhaseDone)
+		opt.Clean(ctx, op)
+	}
+	if len(opt.durations) != 2 {
+		t.Errorf("expected 2 pin durations to be kept; got %d", len(opt.durations))
+	}
+	if _, ok := opt.durations[test.Cid3]; !ok {
+		t.Error("the last pin duration should be kept")
+	}
+
+	op := opt.TrackNewOperation(ctx, api.PinCid(test.Cid3), OperationUnpin, PhaseDone)
+	opt.Clean(ctx, op)
+	if _, ok := opt.durations[test.Cid3]; ok {
+		t.Error("the pin duration should be forgotten on unpin")
+	}
+}
+
 func TestOperationTracker_Status(t *testing.T) {
 	ctx := context.Background()
 	opt := testOperationTracker(t)
@@ -190,6 +216,21 @@ func TestOperationTracker_GetAll(t *testing.T) {
 	}
 }
 
+func TestOperationTracker_Pending(t *testing.T) {
+	ctx := context.Background()
+	opt := testOperationTracker(t)
+	opt.TrackNewOperation(ctx, api.PinCid(test.Cid1), OperationPin, PhaseQueued)
+	opt.TrackNewOperation(ctx, api.PinCid(test.Cid2), OperationUnpin, PhaseInProgress)
+	opt.TrackNewOperation(ctx, api.PinCid(test.Cid3), OperationPin, PhaseDone)
+	opt.TrackNewOperation(ctx, api.PinCid(test.Cid4), OperationPin, PhaseError)
+	if n := opt.Pending(ctx); n != 2 {
+		t.Errorf("expected 2 pending operations; got %d", n)
+	}
+	if ops := opt.PendingOperations(ctx); len(ops) != 2 {
+		t.Errorf("expected 2 pending operations; got %d", len(ops))
+	}
+}
+
 func TestOperationTracker_OpContext(t *testing.T) {
 	ctx := context.Background()
 	opt := testOperationTracker(t)
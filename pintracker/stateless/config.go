@@ -3,6 +3,7 @@ package stateless
 import (
 	"encoding/json"
 	"errors"
+	"math"
 	"time"
 
 	"github.com/kelseyhightower/envconfig"
@@ -19,6 +20,14 @@ const (
 	DefaultConcurrentPins        = 10
 	DefaultPriorityPinMaxAge     = 24 * time.Hour
 	DefaultPriorityPinMaxRetries = 5
+	DefaultUnpinnedGracePeriod   = 0
+	DefaultPriorityMetadataKey   = ""
+	DefaultMaxPinRetries         = 0
+	DefaultPinRetryInitialDelay  = 5 * time.Second
+	DefaultPinRetryMaxDelay      = 5 * time.Minute
+	DefaultReconcileConcurrency  = 1
+	DefaultReconcileRate         = 0
+	DefaultShutdownDrainTimeout  = 0
 )
 
 // Config allows to initialize a Monitor and customize some parameters.
@@ -40,6 +49,47 @@ type Config struct {
 	// PriorityPinMaxRetries specifies the maximum amount of retries that
 	// a pin can have before it is moved to a non-prioritary queue.
 	PriorityPinMaxRetries int
+
+	// UnpinnedGracePeriod specifies for how long items that should be
+	// pinned but are not pinned in IPFS (i.e. after a manual GC) are
+	// automatically re-pinned before they are reported as
+	// unexpectedly unpinned. 0 disables the grace period.
+	UnpinnedGracePeriod time.Duration
+
+	// PriorityMetadataKey names the pin metadata key which holds the
+	// priority of a pin, as an integer. Queued pins with higher
+	// priorities are processed first, before priority pins. Pins without
+	// it have priority 0. Empty disables it.
+	PriorityMetadataKey string
+
+	// MaxPinRetries is how many times a pin which failed because of an
+	// IPFS error is automatically retried before it is left in error.
+	// Timeouts and cancellations are not retried. 0 disables retries.
+	MaxPinRetries int
+	// PinRetryInitialDelay is how long to wait before the first retry.
+	// The delay doubles on every retry.
+	PinRetryInitialDelay time.Duration
+	// PinRetryMaxDelay caps the delay between retries.
+	PinRetryMaxDelay time.Duration
+
+	// ReconcileConcurrency and ReconcileRate throttle the pass that
+	// checks every tracked item against IPFS and recovers those in error
+	// (RecoverAll), which runs when the peer starts and then every
+	// pin_recover_interval. ReconcileConcurrency is how many items are
+	// checked in parallel. ReconcileRate is the number of items checked
+	// per second. 0 disables the limit. If the pass which runs when the
+	// peer starts is interrupted by a restart, the next start resumes it
+	// where it stopped.
+	ReconcileConcurrency int
+	ReconcileRate        float64
+
+	// ShutdownDrainTimeout is how long Shutdown waits for the pin and
+	// unpin operations in progress to finish. No new operations are
+	// started meanwhile. Operations still queued or in progress when it
+	// expires are cancelled and persisted to the peer datastore, to be
+	// queued again when the peer starts. 0, the default, does not wait
+	// and cancels them right away.
+	ShutdownDrainTimeout time.Duration
 }
 
 type jsonConfig struct {
@@ -47,6 +97,16 @@ type jsonConfig struct {
 	ConcurrentPins        int    `json:"concurrent_pins"`
 	PriorityPinMaxAge     string `json:"priority_pin_max_age"`
 	PriorityPinMaxRetries int    `json:"priority_pin_max_retries"`
+	UnpinnedGracePeriod   string `json:"unpinned_grace_period"`
+	PriorityMetadataKey   string `json:"priority_metadata_key"`
+	MaxPinRetries         int    `json:"max_pin_retries"`
+	PinRetryInitialDelay  string `json:"pin_retry_initial_delay"`
+	PinRetryMaxDelay      string `json:"pin_retry_max_delay"`
+
+	ReconcileConcurrency int     `json:"reconcile_concurrency,omitempty"`
+	ReconcileRate        float64 `json:"reconcile_rate,omitempty"`
+
+	ShutdownDrainTimeout string `json:"shutdown_drain_timeout,omitempty"`
 }
 
 // ConfigKey provides a human-friendly identifier for this type of Config.
@@ -60,6 +120,14 @@ func (cfg *Config) Default() error {
 	cfg.ConcurrentPins = DefaultConcurrentPins
 	cfg.PriorityPinMaxAge = DefaultPriorityPinMaxAge
 	cfg.PriorityPinMaxRetries = DefaultPriorityPinMaxRetries
+	cfg.UnpinnedGracePeriod = DefaultUnpinnedGracePeriod
+	cfg.PriorityMetadataKey = DefaultPriorityMetadataKey
+	cfg.MaxPinRetries = DefaultMaxPinRetries
+	cfg.PinRetryInitialDelay = DefaultPinRetryInitialDelay
+	cfg.PinRetryMaxDelay = DefaultPinRetryMaxDelay
+	cfg.ReconcileConcurrency = DefaultReconcileConcurrency
+	cfg.ReconcileRate = DefaultReconcileRate
+	cfg.ShutdownDrainTimeout = DefaultShutdownDrainTimeout
 	return nil
 }
 
@@ -95,6 +163,34 @@ func (cfg *Config) Validate() error {
 		return errors.New("statelesstracker.priority_pin_max_retries is too low")
 	}
 
+	if cfg.UnpinnedGracePeriod < 0 {
+		return errors.New("statelesstracker.unpinned_grace_period is invalid")
+	}
+
+	if cfg.MaxPinRetries < 0 {
+		return errors.New("statelesstracker.max_pin_retries is invalid")
+	}
+
+	if cfg.PinRetryInitialDelay <= 0 {
+		return errors.New("statelesstracker.pin_retry_initial_delay is too low")
+	}
+
+	if cfg.PinRetryMaxDelay < cfg.PinRetryInitialDelay {
+		return errors.New("statelesstracker.pin_retry_max_delay cannot be lower than pin_retry_initial_delay")
+	}
+
+	if cfg.ReconcileConcurrency <= 0 {
+		return errors.New("statelesstracker.reconcile_concurrency is too low")
+	}
+
+	if cfg.ReconcileRate < 0 || math.IsNaN(cfg.ReconcileRate) || math.IsInf(cfg.ReconcileRate, 0) {
+		return errors.New("statelesstracker.reconcile_rate is invalid")
+	}
+
+	if cfg.ShutdownDrainTimeout < 0 {
+		return errors.New("statelesstracker.shutdown_drain_timeout is invalid")
+	}
+
 	return nil
 }
 
@@ -122,12 +218,36 @@ func (cfg *Config) applyJSONConfig(jcfg *jsonConfig) error {
 			Dst:      &cfg.PriorityPinMaxAge,
 			Name:     "priority_pin_max_age",
 		},
+		&config.DurationOpt{
+			Duration: jcfg.UnpinnedGracePeriod,
+			Dst:      &cfg.UnpinnedGracePeriod,
+			Name:     "unpinned_grace_period",
+		},
+		&config.DurationOpt{
+			Duration: jcfg.PinRetryInitialDelay,
+			Dst:      &cfg.PinRetryInitialDelay,
+			Name:     "pin_retry_initial_delay",
+		},
+		&config.DurationOpt{
+			Duration: jcfg.PinRetryMaxDelay,
+			Dst:      &cfg.PinRetryMaxDelay,
+			Name:     "pin_retry_max_delay",
+		},
+		&config.DurationOpt{
+			Duration: jcfg.ShutdownDrainTimeout,
+			Dst:      &cfg.ShutdownDrainTimeout,
+			Name:     "shutdown_drain_timeout",
+		},
 	)
 	if err != nil {
 		return err
 	}
 
 	config.SetIfNotDefault(jcfg.PriorityPinMaxRetries, &cfg.PriorityPinMaxRetries)
+	config.SetIfNotDefault(jcfg.PriorityMetadataKey, &cfg.PriorityMetadataKey)
+	config.SetIfNotDefault(jcfg.MaxPinRetries, &cfg.MaxPinRetries)
+	config.SetIfNotDefault(jcfg.ReconcileConcurrency, &cfg.ReconcileConcurrency)
+	cfg.ReconcileRate = jcfg.ReconcileRate
 
 	return cfg.Validate()
 }
@@ -144,10 +264,22 @@ func (cfg *Config) toJSONConfig() *jsonConfig {
 		ConcurrentPins:        cfg.ConcurrentPins,
 		PriorityPinMaxAge:     cfg.PriorityPinMaxAge.String(),
 		PriorityPinMaxRetries: cfg.PriorityPinMaxRetries,
+		UnpinnedGracePeriod:   cfg.UnpinnedGracePeriod.String(),
+		PriorityMetadataKey:   cfg.PriorityMetadataKey,
+		MaxPinRetries:         cfg.MaxPinRetries,
+		PinRetryInitialDelay:  cfg.PinRetryInitialDelay.String(),
+		PinRetryMaxDelay:      cfg.PinRetryMaxDelay.String(),
+		ReconcileRate:         cfg.ReconcileRate,
+	}
+	if cfg.ReconcileConcurrency != DefaultReconcileConcurrency {
+		jCfg.ReconcileConcurrency = cfg.ReconcileConcurrency
 	}
 	if cfg.MaxPinQueueSize != DefaultMaxPinQueueSize {
 		jCfg.MaxPinQueueSize = cfg.MaxPinQueueSize
 	}
+	if cfg.ShutdownDrainTimeout != DefaultShutdownDrainTimeout {
+		jCfg.ShutdownDrainTimeout = cfg.ShutdownDrainTimeout.String()
+	}
 
 	return jCfg
 }
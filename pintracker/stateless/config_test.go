@@ -12,7 +12,15 @@ var cfgJSON = []byte(`
 	"max_pin_queue_size": 4092,
 	"concurrent_pins": 2,
 	"priority_pin_max_age": "240h",
-	"priority_pin_max_retries": 4
+	"priority_pin_max_retries": 4,
+	"unpinned_grace_period": "1m",
+	"priority_metadata_key": "priority",
+	"max_pin_retries": 3,
+	"pin_retry_initial_delay": "2s",
+	"pin_retry_max_delay": "1m",
+	"reconcile_concurrency": 4,
+	"reconcile_rate": 50,
+	"shutdown_drain_timeout": "30s"
 }
 `)
 
@@ -43,6 +51,21 @@ func TestLoadJSON(t *testing.T) {
 	if cfg.PriorityPinMaxRetries != 2 {
 		t.Error("expected 2 max retries")
 	}
+	if cfg.UnpinnedGracePeriod != time.Minute {
+		t.Error("expected 1m grace period")
+	}
+	if cfg.PriorityMetadataKey != "priority" {
+		t.Error("expected the priority metadata key to be loaded")
+	}
+	if cfg.MaxPinRetries != 3 || cfg.PinRetryInitialDelay != 2*time.Second || cfg.PinRetryMaxDelay != time.Minute {
+		t.Error("expected the pin retry options to be loaded")
+	}
+	if cfg.ReconcileConcurrency != 4 || cfg.ReconcileRate != 50 {
+		t.Error("expected the reconcile options to be loaded")
+	}
+	if cfg.ShutdownDrainTimeout != 30*time.Second {
+		t.Error("expected 30s shutdown drain timeout")
+	}
 }
 
 func TestToJSON(t *testing.T) {
@@ -75,6 +98,26 @@ func TestDefault(t *testing.T) {
 	if cfg.Validate() == nil {
 		t.Fatal("expected error validating")
 	}
+	cfg.PriorityPinMaxRetries = 3
+	cfg.UnpinnedGracePeriod = -time.Second
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+	cfg.UnpinnedGracePeriod = 0
+	cfg.ReconcileConcurrency = 0
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+	cfg.ReconcileConcurrency = 1
+	cfg.ReconcileRate = -1
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
+	cfg.ReconcileRate = 0
+	cfg.ShutdownDrainTimeout = -time.Second
+	if cfg.Validate() == nil {
+		t.Fatal("expected error validating")
+	}
 }
 
 func TestApplyEnvVars(t *testing.T) {
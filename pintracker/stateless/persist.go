@@ -0,0 +1,199 @@
+package stateless
+
+import (
+	"context"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/pintracker/optracker"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+)
+
+// pendingNamespace is the datastore namespace under which the operations
+// left pending at shutdown are kept until the peer starts again.
+var pendingNamespace = ds.NewKey("/stateless/pending")
+
+// reconcileCursorKey is where the reconcile pass in progress records the
+// last item such that it and all those before it have been checked, so that
+// a pass interrupted by a restart resumes after it.
+var reconcileCursorKey = ds.NewKey("/stateless/reconcile/cursor")
+
+// selectiveNamespace is the datastore namespace under which the pins which
+// exclude links are kept, so that the links they pinned can be unpinned
+// after a restart too.
+var selectiveNamespace = ds.NewKey("/stateless/selective")
+
+func pendingKey(typ optracker.OperationType, p *api.Pin) ds.Key {
+	return pendingNamespace.ChildString(typ.String()).ChildString(p.Cid.String())
+}
+
+// savePending stores the pin and unpin operations which are queued or in
+// progress, so that they are replayed when the peer starts again.
+func (spt *Tracker) savePending(ctx context.Context) {
+	if spt.store == nil {
+		return
+	}
+
+	n := 0
+	for _, op := range spt.optracker.PendingOperations(ctx) {
+		typ := op.Type()
+		if typ != optracker.OperationPin && typ != optracker.OperationUnpin {
+			continue
+		}
+		v, err := op.Pin().ProtoMarshal()
+		if err != nil {
+			logger.Errorf("error encoding pending operation for %s: %s", op.Cid(), err)
+			continue
+		}
+		if err := spt.store.Put(ctx, pendingKey(typ, op.Pin()), v); err != nil {
+			logger.Errorf("error persisting pending operation for %s: %s", op.Cid(), err)
+			continue
+		}
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	if err := spt.store.Sync(ctx, pendingNamespace); err != nil {
+		logger.Error(err)
+	}
+	logger.Infof("shutdown: %d pending operations persisted. They will resume when the peer starts", n)
+}
+
+// saveSelective stores the given pin which excludes links, or removes it
+// when forget is set.
+func (spt *Tracker) saveSelective(ctx context.Context, pin *api.Pin, forget bool) {
+	if spt.store == nil {
+		return
+	}
+	key := selectiveNamespace.ChildString(pin.Cid.String())
+	if forget {
+		if err := spt.store.Delete(ctx, key); err != nil {
+			logger.Error(err)
+		}
+		return
+	}
+	v, err := pin.ProtoMarshal()
+	if err != nil {
+		logger.Errorf("error encoding pin %s: %s", pin.Cid, err)
+		return
+	}
+	if err := spt.store.Put(ctx, key, v); err != nil {
+		logger.Errorf("error persisting pin %s: %s", pin.Cid, err)
+	}
+}
+
+// loadSelective returns the stored pin which excludes links for the given
+// cid, or nil.
+func (spt *Tracker) loadSelective(ctx context.Context, c cid.Cid) *api.Pin {
+	if spt.store == nil {
+		return nil
+	}
+	v, err := spt.store.Get(ctx, selectiveNamespace.ChildString(c.String()))
+	if err != nil {
+		if err != ds.ErrNotFound {
+			logger.Error(err)
+		}
+		return nil
+	}
+	pin := &api.Pin{}
+	if err := pin.ProtoUnmarshal(v); err != nil {
+		logger.Errorf("error decoding pin %s: %s", c, err)
+		return nil
+	}
+	return pin
+}
+
+// loadReconcileCursor returns the cursor left by an interrupted reconcile
+// pass, or an empty string.
+func (spt *Tracker) loadReconcileCursor(ctx context.Context) string {
+	if spt.store == nil {
+		return ""
+	}
+	v, err := spt.store.Get(ctx, reconcileCursorKey)
+	if err != nil {
+		if err != ds.ErrNotFound {
+			logger.Error(err)
+		}
+		return ""
+	}
+	return string(v)
+}
+
+// saveReconcileCursor records the reconcile cursor. An empty cursor removes
+// it, once a pass completes.
+func (spt *Tracker) saveReconcileCursor(ctx context.Context, cursor string) {
+	if spt.store == nil {
+		return
+	}
+	var err error
+	if cursor == "" {
+		err = spt.store.Delete(ctx, reconcileCursorKey)
+	} else {
+		err = spt.store.Put(ctx, reconcileCursorKey, []byte(cursor))
+	}
+	if err != nil {
+		logger.Errorf("error persisting the reconcile cursor: %s", err)
+	}
+}
+
+// replayPending queues again the operations persisted on shutdown, unless
+// the shared state no longer wants them: pins which are not in the state
+// anymore are dropped, as are unpins of items which are allocated to this
+// peer again.
+func (spt *Tracker) replayPending(ctx context.Context) {
+	results, err := spt.store.Query(ctx, query.Query{
+		Prefix: pendingNamespace.String(),
+	})
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	st, err := spt.getState(ctx)
+	if err != nil {
+		logger.Errorf("cannot replay pending operations: %s", err)
+		return
+	}
+
+	pinKey := pendingNamespace.ChildString(optracker.OperationPin.String())
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+		key := ds.NewKey(e.Key)
+		pin := &api.Pin{}
+		if err := pin.ProtoUnmarshal(e.Value); err != nil {
+			logger.Errorf("error decoding pending operation %s: %s", key, err)
+		} else {
+			current, err := st.Get(ctx, pin.Cid)
+			wanted := err == nil && !current.IsRemotePin(spt.peerID)
+			switch {
+			case pinKey.IsAncestorOf(key) && wanted:
+				err = spt.Track(ctx, current)
+			case !pinKey.IsAncestorOf(key) && !wanted:
+				spt.keepSelective(ctx, pin)
+				err = spt.Untrack(ctx, pin.Cid)
+			default:
+				err = nil
+			}
+			if err != nil {
+				logger.Errorf("error replaying pending operation %s: %s", key, err)
+			}
+		}
+		if err := spt.store.Delete(ctx, key); err != nil {
+			logger.Error(err)
+		}
+	}
+	logger.Infof("replayed %d operations left pending at shutdown", len(entries))
+}
@@ -0,0 +1,126 @@
+package stateless
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+
+	"github.com/ipfs/ipfs-cluster/pintracker/optracker"
+)
+
+// queuedOp is an operation waiting in an opQueue.
+type queuedOp struct {
+	op *optracker.Operation
+	// priority orders the operations: higher first.
+	priority int
+	// operations flagged as priority pins go before the rest with the
+	// same priority.
+	priorityPin bool
+	// seq keeps the operations with the same priority in FIFO order.
+	seq uint64
+}
+
+type opHeap []*queuedOp
+
+func (h opHeap) Len() int { return len(h) }
+
+func (h opHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	if h[i].priorityPin != h[j].priorityPin {
+		return h[i].priorityPin
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h opHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *opHeap) Push(x interface{}) { *h = append(*h, x.(*queuedOp)) }
+
+func (h *opHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// opQueue is a bounded priority queue of operations. Pushing to a full
+// queue waits for a worker to pop an operation, or fails.
+type opQueue struct {
+	mu    sync.Mutex
+	items opHeap
+	seq   uint64
+
+	// a token per taken slot, and a token per operation ready to be
+	// popped.
+	slots chan struct{}
+	ready chan struct{}
+}
+
+func newOpQueue(size int) *opQueue {
+	return &opQueue{
+		slots: make(chan struct{}, size),
+		ready: make(chan struct{}, size),
+	}
+}
+
+// push adds the operation to the queue, waiting for a free slot until
+// either context is done.
+func (q *opQueue) push(ctx, opCtx context.Context, op *optracker.Operation, priority int, priorityPin bool) error {
+	select {
+	case q.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-opCtx.Done():
+		return opCtx.Err()
+	}
+	q.add(op, priority, priorityPin)
+	return nil
+}
+
+// tryPush adds the operation to the queue, or returns ErrFullQueue when it
+// is full.
+func (q *opQueue) tryPush(op *optracker.Operation, priority int, priorityPin bool) error {
+	select {
+	case q.slots <- struct{}{}:
+	default:
+		return ErrFullQueue
+	}
+	q.add(op, priority, priorityPin)
+	return nil
+}
+
+func (q *opQueue) add(op *optracker.Operation, priority int, priorityPin bool) {
+	q.mu.Lock()
+	q.seq++
+	heap.Push(&q.items, &queuedOp{
+		op:          op,
+		priority:    priority,
+		priorityPin: priorityPin,
+		seq:         q.seq,
+	})
+	q.mu.Unlock()
+	q.ready <- struct{}{}
+}
+
+// pop returns the operation with the highest priority, waiting for one
+// until the context is cancelled.
+func (q *opQueue) pop(ctx context.Context) (*optracker.Operation, bool) {
+	// select picks randomly when both are ready.
+	if ctx.Err() != nil {
+		return nil, false
+	}
+	select {
+	case <-q.ready:
+	case <-ctx.Done():
+		return nil, false
+	}
+	q.mu.Lock()
+	item := heap.Pop(&q.items).(*queuedOp)
+	q.mu.Unlock()
+	<-q.slots
+	return item.op, true
+}
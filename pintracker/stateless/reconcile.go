@@ -0,0 +1,151 @@
+package stateless
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// reconcileCursorInterval is how many items are checked by a reconcile pass
+// between writes of its cursor to the datastore.
+var reconcileCursorInterval = 100
+
+// reconcile recovers the given items, using up to ReconcileConcurrency
+// workers and starting no more than ReconcileRate items per second, since
+// every item costs at least one call to the IPFS daemon. It stops on the
+// first error, returning the items recovered until then, and on shutdown.
+//
+// Items are checked in CID order. When resume is set and the tracker has a
+// datastore, the pass starts after the cursor left by an earlier resumable
+// pass and persists its own progress every reconcileCursorInterval items and
+// when it is interrupted by a shutdown. The cursor is removed once such a
+// pass checks every item without errors. Other passes neither read nor
+// write the cursor and always check every item.
+func (spt *Tracker) reconcile(ctx context.Context, statuses []*api.PinInfo, resume bool) ([]*api.PinInfo, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Cid.KeyString() < statuses[j].Cid.KeyString()
+	})
+	var cursor string
+	if resume {
+		cursor = spt.loadReconcileCursor(ctx)
+	}
+	if cursor != "" {
+		skip := sort.Search(len(statuses), func(i int) bool {
+			return statuses[i].Cid.KeyString() > cursor
+		})
+		logger.Infof("resuming the interrupted reconcile pass: %d items left", len(statuses)-skip)
+		statuses = statuses[skip:]
+	}
+
+	// checked marks the items done. Items up to next-1 are all done.
+	checked := make([]bool, len(statuses))
+	next := 0
+	var cursorMu sync.Mutex
+	markChecked := func(i int) {
+		cursorMu.Lock()
+		defer cursorMu.Unlock()
+		checked[i] = true
+		prev := next
+		for next < len(checked) && checked[next] {
+			next++
+		}
+		if resume && next/reconcileCursorInterval > prev/reconcileCursorInterval {
+			spt.saveReconcileCursor(ctx, statuses[next-1].Cid.KeyString())
+		}
+	}
+
+	var tick <-chan time.Time
+	if spt.config.ReconcileRate > 0 {
+		interval := time.Duration(float64(time.Second) / spt.config.ReconcileRate)
+		if interval <= 0 {
+			// Rates above one item per nanosecond are as good as
+			// no limit.
+			interval = time.Nanosecond
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	results := make([]*api.PinInfo, len(statuses))
+	var errMu sync.Mutex
+	var firstErr error
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < spt.config.ReconcileConcurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				r, err := spt.recoverWithPinInfo(ctx, statuses[i], true)
+				if err != nil {
+					errMu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errMu.Unlock()
+					cancel()
+					continue
+				}
+				results[i] = r
+				markChecked(i)
+			}
+		}()
+	}
+
+dispatch:
+	for i := range statuses {
+		// Break out if we shutdown. We might be going through
+		// a very long list of statuses.
+		if tick != nil {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				break dispatch
+			case <-spt.ctx.Done():
+				break dispatch
+			}
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break dispatch
+		case <-spt.ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	// An aborted pass keeps the cursor as last saved: the items after it
+	// are checked again by the next resumable pass.
+	switch {
+	case !resume || firstErr != nil:
+	case next == len(statuses):
+		spt.saveReconcileCursor(context.Background(), "")
+	case next > 0:
+		spt.saveReconcileCursor(context.Background(), statuses[next-1].Cid.KeyString())
+	}
+
+	if err := spt.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	resp := make([]*api.PinInfo, 0, len(results))
+	for _, r := range results {
+		if r != nil {
+			resp = append(resp, r)
+		}
+	}
+	if firstErr != nil {
+		return resp, firstErr
+	}
+	return resp, ctx.Err()
+}
@@ -0,0 +1,114 @@
+package stateless
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/pintracker/optracker"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// maxSLABreaches limits the number of breaches remembered for items which
+// have been pinned. The oldest are forgotten first.
+const maxSLABreaches = 1000
+
+// slaBreaches remembers the items which were pinned after their deadline.
+type slaBreaches struct {
+	mu       sync.Mutex
+	breaches map[cid.Cid]*api.PinSLABreach
+	order    []cid.Cid
+}
+
+func newSLABreaches() *slaBreaches {
+	return &slaBreaches{
+		breaches: make(map[cid.Cid]*api.PinSLABreach),
+	}
+}
+
+func (sla *slaBreaches) add(b *api.PinSLABreach) {
+	sla.mu.Lock()
+	defer sla.mu.Unlock()
+
+	if _, ok := sla.breaches[b.Cid]; !ok {
+		sla.order = append(sla.order, b.Cid)
+	}
+	sla.breaches[b.Cid] = b
+	for len(sla.order) > maxSLABreaches {
+		delete(sla.breaches, sla.order[0])
+		sla.order = sla.order[1:]
+	}
+}
+
+func (sla *slaBreaches) remove(c cid.Cid) {
+	sla.mu.Lock()
+	defer sla.mu.Unlock()
+
+	if _, ok := sla.breaches[c]; !ok {
+		return
+	}
+	delete(sla.breaches, c)
+	for i, ci := range sla.order {
+		if ci.Equals(c) {
+			sla.order = append(sla.order[:i], sla.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func (sla *slaBreaches) list() []*api.PinSLABreach {
+	sla.mu.Lock()
+	defer sla.mu.Unlock()
+
+	out := make([]*api.PinSLABreach, 0, len(sla.order))
+	for _, c := range sla.order {
+		out = append(out, sla.breaches[c])
+	}
+	return out
+}
+
+func (spt *Tracker) slaBreach(pin *api.Pin, pinnedAt time.Time) *api.PinSLABreach {
+	return &api.PinSLABreach{
+		Cid:      pin.Cid,
+		Name:     pin.Name,
+		Peer:     spt.peerID,
+		PeerName: spt.peerName,
+		Deadline: pin.PinDeadline,
+		PinnedAt: pinnedAt,
+	}
+}
+
+// checkDeadline records whether a pin operation which just finished met the
+// deadline of its pin.
+func (spt *Tracker) checkDeadline(op *optracker.Operation, now time.Time) {
+	if op.Type() != optracker.OperationPin {
+		return
+	}
+	pin := op.Pin()
+	deadline := pin.PinDeadline
+	if deadline.IsZero() || !now.After(deadline) {
+		spt.slaBreaches.remove(pin.Cid)
+		return
+	}
+	logger.Warnf("%s was pinned %s after its deadline", pin.Cid, now.Sub(deadline))
+	spt.slaBreaches.add(spt.slaBreach(pin, now))
+}
+
+// SLABreaches returns the items which were pinned after their deadline,
+// along with those which are not pinned yet and whose deadline has passed.
+func (spt *Tracker) SLABreaches(ctx context.Context) []*api.PinSLABreach {
+	var breaches []*api.PinSLABreach
+	pending := make(map[cid.Cid]struct{})
+	for _, op := range spt.optracker.PastDeadline(ctx, time.Now()) {
+		pending[op.Cid()] = struct{}{}
+		breaches = append(breaches, spt.slaBreach(op.Pin(), time.Time{}))
+	}
+	for _, b := range spt.slaBreaches.list() {
+		if _, ok := pending[b.Cid]; !ok {
+			breaches = append(breaches, b)
+		}
+	}
+	return breaches
+}
@@ -6,6 +6,9 @@ package stateless
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,6 +17,7 @@ import (
 	"github.com/ipfs/ipfs-cluster/state"
 
 	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
 	logging "github.com/ipfs/go-log/v2"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	rpc "github.com/libp2p/go-libp2p-gorpc"
@@ -31,6 +35,32 @@ var (
 	errUnexpectedlyUnpinned = errors.New("the item should be pinned but it is not")
 )
 
+// dependencyRetryInterval is how long pin operations wait before checking
+// again whether the item they depend on has been pinned.
+var dependencyRetryInterval = 10 * time.Second
+
+// dependencyWaitTimeout is how long pin operations wait for the item they
+// depend on to be pinned before they fail.
+var dependencyWaitTimeout = time.Hour
+
+// availabilityRetryInterval is how long pinned items whose QoS class checks
+// availability wait before checking again whether all their blocks are
+// available.
+var availabilityRetryInterval = 30 * time.Second
+
+// maxAvailabilityChecks is how many times the availability of a pinned item
+// is checked before it is left in error.
+var maxAvailabilityChecks = 10
+
+// fullQueueTimeout is how long operations wait for room in a full queue
+// before they are left in error with ErrFullQueue.
+var fullQueueTimeout = 5 * time.Second
+
+// unpinnedCheckInterval is how often, with an UnpinnedGracePeriod, the
+// items which should be pinned are looked up in IPFS to re-pin those which
+// are not.
+var unpinnedCheckInterval = time.Minute
+
 // Tracker uses the optracker.OperationTracker to manage
 // transitioning shared ipfs-cluster state (Pins) to the local IPFS node.
 type Tracker struct {
@@ -46,13 +76,34 @@ type Tracker struct {
 
 	getState func(ctx context.Context) (state.ReadOnly, error)
 
+	// keeps the operations left pending at shutdown. Can be nil.
+	store ds.Datastore
+
 	rpcClient *rpc.Client
 	rpcReady  chan struct{}
 
-	priorityPinCh chan *optracker.Operation
-	pinCh         chan *optracker.Operation
-	unpinCh       chan *optracker.Operation
+	pinQueue   *opQueue
+	unpinQueue *opQueue
 
+	// tracks when items were first seen unexpectedly unpinned.
+	unpinnedMu    sync.Mutex
+	unpinnedSince map[cid.Cid]time.Time
+
+	qosMu      sync.RWMutex
+	qosClasses map[string]*api.QoSClass
+
+	// pins which exclude links, kept when they are tracked and when the
+	// shared state is walked, as unpinning them needs their options.
+	selectiveMu sync.Mutex
+	selective   map[cid.Cid]*api.Pin
+
+	slaBreaches *slaBreaches
+
+	// cancelled on shutdown to stop the workers from starting new
+	// operations while the ones in progress are drained.
+	workCtx    context.Context
+	stopWork   context.CancelFunc
+	workers    sync.WaitGroup
 	shutdownMu sync.Mutex
 	shutdown   bool
 	wg         sync.WaitGroup
@@ -71,55 +122,176 @@ func New(cfg *Config, pid peer.ID, peerName string, getState func(ctx context.Co
 		getState:      getState,
 		optracker:     optracker.NewOperationTracker(ctx, pid, peerName),
 		rpcReady:      make(chan struct{}, 1),
-		priorityPinCh: make(chan *optracker.Operation, cfg.MaxPinQueueSize),
-		pinCh:         make(chan *optracker.Operation, cfg.MaxPinQueueSize),
-		unpinCh:       make(chan *optracker.Operation, cfg.MaxPinQueueSize),
+		pinQueue:      newOpQueue(cfg.MaxPinQueueSize),
+		unpinQueue:    newOpQueue(cfg.MaxPinQueueSize),
+		unpinnedSince: make(map[cid.Cid]time.Time),
+		selective:     make(map[cid.Cid]*api.Pin),
+		slaBreaches:   newSLABreaches(),
 	}
+	spt.workCtx, spt.stopWork = context.WithCancel(ctx)
 
+	spt.workers.Add(spt.config.ConcurrentPins + 1)
 	for i := 0; i < spt.config.ConcurrentPins; i++ {
-		go spt.opWorker(spt.pin, spt.priorityPinCh, spt.pinCh)
+		go spt.opWorker(spt.pin, spt.pinQueue)
 	}
-	go spt.opWorker(spt.unpin, spt.unpinCh, nil)
+	go spt.opWorker(spt.unpin, spt.unpinQueue)
 	return spt
 }
 
-// receives a pin Function (pin or unpin) and channels.  Used for both pinning
-// and unpinning.
-func (spt *Tracker) opWorker(pinF func(*optracker.Operation) error, prioCh, normalCh chan *optracker.Operation) {
+// SetDatastore makes the tracker persist the operations left pending at
+// shutdown to the given datastore, and replay them when it starts again. It
+// must be called before SetClient.
+func (spt *Tracker) SetDatastore(store ds.Datastore) {
+	spt.store = store
+}
+
+// SetQoSClasses sets the QoS classes which pins can be tagged with. The
+// tracker applies their priority and retry settings.
+func (spt *Tracker) SetQoSClasses(classes map[string]*api.QoSClass) {
+	spt.qosMu.Lock()
+	defer spt.qosMu.Unlock()
+	spt.qosClasses = classes
+}
 
-	var op *optracker.Operation
+// qosClass returns the QoS class with the given name, or an empty class
+// with the default settings.
+func (spt *Tracker) qosClass(name string) *api.QoSClass {
+	spt.qosMu.RLock()
+	defer spt.qosMu.RUnlock()
+	if qc, ok := spt.qosClasses[name]; ok {
+		return qc
+	}
+	return &api.QoSClass{}
+}
 
+// receives a pin Function (pin or unpin) and a queue.  Used for both pinning
+// and unpinning.
+func (spt *Tracker) opWorker(pinF func(*optracker.Operation) error, q *opQueue) {
+	defer spt.workers.Done()
 	for {
-		// Process the priority channel first.
-		select {
-		case op = <-prioCh:
-			goto APPLY_OP
-		case <-spt.ctx.Done():
+		op, ok := q.pop(spt.workCtx)
+		if !ok {
 			return
-		default:
 		}
 
-		// Then process things on the other channels.
-		// Block if there are no things to process.
+		if op.Type() == optracker.OperationPin && !spt.dependencyPinned(op) {
+			if time.Since(op.Since()) > dependencyWaitTimeout {
+				err := fmt.Errorf("dependency %s was not pinned after %s", op.Pin().DependsOn, dependencyWaitTimeout)
+				logger.Errorf("%s: %s", op.Cid(), err)
+				op.SetError(err)
+				continue
+			}
+			logger.Debugf("%s is waiting for dependency %s", op.Cid(), op.Pin().DependsOn)
+			spt.requeueAfter(op, dependencyRetryInterval)
+			continue
+		}
+		if clean := spt.applyPinF(pinF, op); clean {
+			spt.optracker.Clean(op.Context(), op)
+		}
+	}
+}
+
+// dependencyPinned returns true if the operation's pin does not depend on
+// any other item, or if this peer has pinned that item. Dependencies which
+// are no longer part of the pinset, or which are not allocated to this
+// peer, are considered satisfied.
+func (spt *Tracker) dependencyPinned(op *optracker.Operation) bool {
+	dep := op.Pin().DependsOn
+	if dep == cid.Undef {
+		return true
+	}
+
+	ctx, span := trace.StartSpan(op.Context(), "tracker/stateless/dependencyPinned")
+	defer span.End()
+
+	st, err := spt.getState(ctx)
+	if err != nil {
+		logger.Error(err)
+		return false
+	}
+	depPin, err := st.Get(ctx, dep)
+	if err == state.ErrNotFound {
+		logger.Warnf("%s depends on %s, which is not in the pinset anymore", op.Cid(), dep)
+		return true
+	}
+	if err != nil {
+		logger.Error(err)
+		return false
+	}
+	if depPin.IsRemotePin(spt.peerID) {
+		return true
+	}
+	return spt.Status(ctx, dep).Status == api.TrackerStatusPinned
+}
+
+// opPriority returns the priority of the operations for the given pin: the
+// integer value of its PriorityMetadataKey metadata, or 0.
+func (spt *Tracker) opPriority(pin *api.Pin) int {
+	if spt.config.PriorityMetadataKey == "" {
+		return 0
+	}
+	v, ok := pin.Metadata[spt.config.PriorityMetadataKey]
+	if !ok {
+		return 0
+	}
+	prio, err := strconv.Atoi(v)
+	if err != nil {
+		logger.Debugf("%s: ignoring invalid priority %q: %s", pin.Cid, v, err)
+		return 0
+	}
+	return prio
+}
+
+// requeueAfter puts a pin operation back in the pin queue after the given
+// delay, unless it is cancelled in the meantime. It is not queued as a
+// priority pin.
+func (spt *Tracker) requeueAfter(op *optracker.Operation, delay time.Duration) {
+	op.SetPhase(optracker.PhaseQueued)
+	go func() {
 		select {
-		case op = <-prioCh:
-			goto APPLY_OP
-		case op = <-normalCh:
-			goto APPLY_OP
+		case <-time.After(delay):
+		case <-op.Context().Done():
+			return
 		case <-spt.ctx.Done():
 			return
 		}
-
-		// apply operations that came from some channel
-	APPLY_OP:
-		if clean := applyPinF(pinF, op); clean {
-			spt.optracker.Clean(op.Context(), op)
+		if err := spt.pinQueue.tryPush(op, spt.opPriority(op.Pin()), false); err != nil {
+			op.SetError(err)
+			op.Cancel()
 		}
+	}()
+}
+
+// retryDelay returns how long to wait before retrying a pin operation
+// which failed with the given error, or false when it should not be retried.
+func (spt *Tracker) retryDelay(op *optracker.Operation, err error) (time.Duration, bool) {
+	if op.Type() != optracker.OperationPin {
+		return 0, false
+	}
+	retries := op.AttemptCount() - 1
+	if retries >= spt.config.MaxPinRetries {
+		return 0, false
+	}
+	// Do not retry timeouts and cancellations. Errors coming through
+	// RPC lose their type.
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		strings.Contains(err.Error(), context.Canceled.Error()) ||
+		strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		return 0, false
+	}
+
+	delay := spt.config.PinRetryInitialDelay
+	for i := 0; i < retries && delay < spt.config.PinRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > spt.config.PinRetryMaxDelay {
+		delay = spt.config.PinRetryMaxDelay
 	}
+	return delay, true
 }
 
 // applyPinF returns true if the operation can be considered "DONE".
-func applyPinF(pinF func(*optracker.Operation) error, op *optracker.Operation) bool {
+func (spt *Tracker) applyPinF(pinF func(*optracker.Operation) error, op *optracker.Operation) bool {
 	if op.Cancelled() {
 		// operation was cancelled. Move on.
 		// This saves some time, but not 100% needed.
@@ -134,12 +306,26 @@ func applyPinF(pinF func(*optracker.Operation) error, op *optracker.Operation) b
 			// we were cancelled. Move on.
 			return false
 		}
+		if delay, ok := spt.retryDelay(op, err); ok {
+			logger.Warnf("error pinning %s (attempt %d), retrying in %s: %s", op.Cid(), op.AttemptCount(), delay, err)
+			spt.requeueAfter(op, delay)
+			return false
+		}
 		op.SetError(err)
 		op.Cancel()
 		return false
 	}
+	if spt.checksAvailability(op) {
+		// Checked outside the worker, which can take the next
+		// operation.
+		op.SetPhase(optracker.PhaseQueued)
+		spt.wg.Add(1)
+		go spt.watchAvailability(op)
+		return false
+	}
 	op.SetPhase(optracker.PhaseDone)
 	op.Cancel()
+	spt.checkDeadline(op, time.Now())
 	return true // this tells the opWorker to clean the operation from the tracker.
 }
 
@@ -162,6 +348,85 @@ func (spt *Tracker) pin(op *optracker.Operation) error {
 	return nil
 }
 
+// checksAvailability returns true when the QoS class of a pin operation asks
+// to check the availability of the item. Only recursive pins are checked.
+func (spt *Tracker) checksAvailability(op *optracker.Operation) bool {
+	pin := op.Pin()
+	if op.Type() != optracker.OperationPin || pin.MaxDepth >= 0 {
+		return false
+	}
+	return spt.qosClass(pin.QoSClass).CheckAvailability
+}
+
+// watchAvailability checks, every availabilityRetryInterval, the
+// availability of an item which was pinned, and completes the operation
+// when it is available. The item stays queued, with the reason, in the
+// meantime, and is left in error after maxAvailabilityChecks.
+func (spt *Tracker) watchAvailability(op *optracker.Operation) {
+	defer spt.wg.Done()
+
+	for i := 1; ; i++ {
+		err := spt.checkAvailability(op)
+		if op.Cancelled() {
+			return
+		}
+		if err == nil {
+			op.SetPhase(optracker.PhaseDone)
+			op.Cancel()
+			spt.checkDeadline(op, time.Now())
+			spt.optracker.Clean(op.Context(), op)
+			return
+		}
+		if i >= maxAvailabilityChecks {
+			logger.Errorf("%s is pinned but was not available after %d checks: %s", op.Cid(), i, err)
+			op.SetError(fmt.Errorf("not available after %d checks: %w", i, err))
+			op.Cancel()
+			return
+		}
+		logger.Infof("%s is pinned but not available yet, checking again in %s: %s", op.Cid(), availabilityRetryInterval, err)
+		op.SetReason(err.Error())
+
+		select {
+		case <-time.After(availabilityRetryInterval):
+		case <-op.Context().Done():
+			return
+		case <-spt.ctx.Done():
+			return
+		}
+	}
+}
+
+// checkAvailability returns an error when the content routing of the IPFS
+// daemon finds fewer than the MinProviders of the QoS class of a pin
+// operation providing the item, not counting the daemon itself.
+func (spt *Tracker) checkAvailability(op *optracker.Operation) error {
+	pin := op.Pin()
+	ctx, span := trace.StartSpan(op.Context(), "tracker/stateless/checkAvailability")
+	defer span.End()
+
+	min := spt.qosClass(pin.QoSClass).MinProviders
+	if min <= 0 {
+		min = 1
+	}
+
+	var providers []peer.ID
+	err := spt.rpcClient.CallContext(
+		ctx,
+		"",
+		"IPFSConnector",
+		"FindProviders",
+		&api.FindProvidersRequest{Cid: pin.Cid, Count: min},
+		&providers,
+	)
+	if err != nil {
+		return fmt.Errorf("error checking availability: %w", err)
+	}
+	if len(providers) < min {
+		return fmt.Errorf("%d of %d providers found", len(providers), min)
+	}
+	return nil
+}
+
 func (spt *Tracker) unpin(op *optracker.Operation) error {
 	ctx, span := trace.StartSpan(op.Context(), "tracker/stateless/unpin")
 	defer span.End()
@@ -181,7 +446,11 @@ func (spt *Tracker) unpin(op *optracker.Operation) error {
 	return nil
 }
 
-// Enqueue puts a new operation on the queue, unless ongoing exists.
+// Enqueue puts a new operation on the queue, unless ongoing exists. When the
+// queue is full, it waits for room for up to fullQueueTimeout, or until the
+// context is cancelled, since it is called while the consensus applies
+// updates. The operation is then left in error so that it is recovered
+// later.
 func (spt *Tracker) enqueue(ctx context.Context, c *api.Pin, typ optracker.OperationType) error {
 	ctx, span := trace.StartSpan(ctx, "tracker/stateless/enqueue")
 	defer span.End()
@@ -192,30 +461,35 @@ func (spt *Tracker) enqueue(ctx context.Context, c *api.Pin, typ optracker.Opera
 		return nil // the operation exists and must be queued already.
 	}
 
-	var ch chan *optracker.Operation
+	q := spt.unpinQueue
+	isPriorityPin := false
 
 	switch typ {
 	case optracker.OperationPin:
-		isPriorityPin := time.Now().Before(c.Timestamp.Add(spt.config.PriorityPinMaxAge)) &&
+		q = spt.pinQueue
+		isPriorityPin = time.Now().Before(c.Timestamp.Add(spt.config.PriorityPinMaxAge)) &&
 			op.AttemptCount() <= spt.config.PriorityPinMaxRetries
+		switch spt.qosClass(c.QoSClass).Priority {
+		case api.QoSPriorityHigh:
+			isPriorityPin = true
+		case api.QoSPriorityLow:
+			isPriorityPin = false
+		}
 		op.SetPriorityPin(isPriorityPin)
+	}
 
-		if isPriorityPin {
-			ch = spt.priorityPinCh
-		} else {
-			ch = spt.pinCh
-		}
-	case optracker.OperationUnpin:
-		ch = spt.unpinCh
+	if err := q.tryPush(op, spt.opPriority(c), isPriorityPin); err == nil {
+		return nil
 	}
 
-	select {
-	case ch <- op:
-	default:
-		err := ErrFullQueue
+	logger.Warnf("the operation queue is full, waiting to queue %s", c.Cid)
+	pushCtx, cancel := context.WithTimeout(ctx, fullQueueTimeout)
+	defer cancel()
+	if err := q.push(pushCtx, op.Context(), op, spt.opPriority(c), isPriorityPin); err != nil {
+		err = fmt.Errorf("%w: %s", ErrFullQueue, err)
 		op.SetError(err)
 		op.Cancel()
-		logger.Error(err.Error())
+		logger.Errorf("%s: %s", c.Cid, err)
 		return err
 	}
 	return nil
@@ -226,13 +500,25 @@ func (spt *Tracker) enqueue(ctx context.Context, c *api.Pin, typ optracker.Opera
 func (spt *Tracker) SetClient(c *rpc.Client) {
 	spt.rpcClient = c
 	spt.rpcReady <- struct{}{}
+
+	if spt.store != nil {
+		spt.wg.Add(1)
+		go func() {
+			defer spt.wg.Done()
+			spt.replayPending(spt.workCtx)
+		}()
+	}
+
+	if spt.config.UnpinnedGracePeriod > 0 {
+		spt.wg.Add(1)
+		go spt.watchUnpinned()
+	}
 }
 
 // Shutdown finishes the services provided by the StatelessPinTracker
 // and cancels any active context.
 func (spt *Tracker) Shutdown(ctx context.Context) error {
 	ctx, span := trace.StartSpan(ctx, "tracker/stateless/Shutdown")
-	_ = ctx
 	defer span.End()
 
 	spt.shutdownMu.Lock()
@@ -244,6 +530,7 @@ func (spt *Tracker) Shutdown(ctx context.Context) error {
 	}
 
 	logger.Info("stopping StatelessPinTracker")
+	spt.drain(ctx)
 	spt.cancel()
 	close(spt.rpcReady)
 	spt.wg.Wait()
@@ -251,6 +538,32 @@ func (spt *Tracker) Shutdown(ctx context.Context) error {
 	return nil
 }
 
+// drain stops the workers from starting new operations, waits up to
+// ShutdownDrainTimeout for the ones in progress to finish and persists the
+// ones left.
+func (spt *Tracker) drain(ctx context.Context) {
+	spt.stopWork()
+	defer spt.savePending(ctx)
+	if spt.config.ShutdownDrainTimeout <= 0 {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		spt.workers.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(spt.config.ShutdownDrainTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		logger.Warn("shutdown: timed out waiting for operations in progress")
+	case <-ctx.Done():
+	}
+}
+
 // Track tells the StatelessPinTracker to start managing a Cid,
 // possibly triggering Pin operations on the IPFS daemon.
 func (spt *Tracker) Track(ctx context.Context, c *api.Pin) error {
@@ -265,6 +578,7 @@ func (spt *Tracker) Track(ctx context.Context, c *api.Pin) error {
 	if c.Type == api.MetaType {
 		return nil
 	}
+	spt.keepSelective(ctx, c)
 
 	// Trigger unpin whenever something remote is tracked
 	// Note, IPFSConn checks with pin/ls before triggering
@@ -289,6 +603,18 @@ func (spt *Tracker) Track(ctx context.Context, c *api.Pin) error {
 	return spt.enqueue(ctx, c, optracker.OperationPin)
 }
 
+// SetPinProgress records how many blocks the ongoing pin of the given item
+// has fetched, so that it shows in its status.
+func (spt *Tracker) SetPinProgress(ctx context.Context, c cid.Cid, blocks int) {
+	spt.optracker.SetProgress(ctx, c, blocks)
+}
+
+// QueueDepth returns the number of pin and unpin operations which are
+// queued or in progress.
+func (spt *Tracker) QueueDepth(ctx context.Context) int {
+	return spt.optracker.Pending(ctx)
+}
+
 // Untrack tells the StatelessPinTracker to stop managing a Cid.
 // If the Cid is pinned locally, it will be unpinned.
 func (spt *Tracker) Untrack(ctx context.Context, c cid.Cid) error {
@@ -296,7 +622,44 @@ func (spt *Tracker) Untrack(ctx context.Context, c cid.Cid) error {
 	defer span.End()
 
 	logger.Debugf("untracking %s", c)
-	return spt.enqueue(ctx, api.PinCid(c), optracker.OperationUnpin)
+	spt.clearUnpinned(c)
+	spt.slaBreaches.remove(c)
+	return spt.enqueue(ctx, spt.unpinnedPin(ctx, c), optracker.OperationUnpin)
+}
+
+// keepSelective keeps the given pin when it excludes links, or forgets it
+// otherwise. Kept pins are persisted to the datastore, when set, so that
+// they survive a restart.
+func (spt *Tracker) keepSelective(ctx context.Context, pin *api.Pin) {
+	spt.selectiveMu.Lock()
+	defer spt.selectiveMu.Unlock()
+	kept, ok := spt.selective[pin.Cid]
+	if len(pin.ExcludeLinks) > 0 {
+		spt.selective[pin.Cid] = pin
+		if !ok || !kept.Equals(pin) {
+			spt.saveSelective(ctx, pin, false)
+		}
+		return
+	}
+	delete(spt.selective, pin.Cid)
+	spt.saveSelective(ctx, pin, true)
+}
+
+// unpinnedPin returns the pin to unpin for the given cid: the one kept
+// when it excludes links, so that the links it pinned are unpinned too.
+func (spt *Tracker) unpinnedPin(ctx context.Context, c cid.Cid) *api.Pin {
+	spt.selectiveMu.Lock()
+	defer spt.selectiveMu.Unlock()
+	pin, ok := spt.selective[c]
+	if !ok {
+		pin = spt.loadSelective(ctx, c)
+	}
+	if pin == nil {
+		return api.PinCid(c)
+	}
+	delete(spt.selective, c)
+	spt.saveSelective(ctx, pin, true)
+	return pin
 }
 
 // StatusAll returns information for all Cids pinned to the local IPFS node.
@@ -334,6 +697,39 @@ func (spt *Tracker) Status(ctx context.Context, c cid.Cid) *api.PinInfo {
 	ctx, span := trace.StartSpan(ctx, "tracker/stateless/Status")
 	defer span.End()
 
+	return spt.status(ctx, c, spt.getState)
+}
+
+// InProgress returns whether an operation is queued or in progress for the
+// given Cid, as known by the operation tracker, without asking IPFS.
+func (spt *Tracker) InProgress(ctx context.Context, c cid.Cid) bool {
+	status, ok := spt.optracker.Status(ctx, c)
+	return ok && status.Match(api.TrackerStatusQueued|api.TrackerStatusPinning|api.TrackerStatusUnpinning)
+}
+
+// StatusCids returns the information for the given Cids, in the same order,
+// in a single pass which obtains the shared state only once.
+func (spt *Tracker) StatusCids(ctx context.Context, cids []cid.Cid) []*api.PinInfo {
+	ctx, span := trace.StartSpan(ctx, "tracker/stateless/StatusCids")
+	defer span.End()
+
+	var st state.ReadOnly
+	var stErr error
+	getState := func(ctx context.Context) (state.ReadOnly, error) {
+		if st == nil && stErr == nil {
+			st, stErr = spt.getState(ctx)
+		}
+		return st, stErr
+	}
+
+	pinfos := make([]*api.PinInfo, len(cids))
+	for i, c := range cids {
+		pinfos[i] = spt.status(ctx, c, getState)
+	}
+	return pinfos
+}
+
+func (spt *Tracker) status(ctx context.Context, c cid.Cid, getState func(context.Context) (state.ReadOnly, error)) *api.PinInfo {
 	// check if c has an inflight operation or errorred operation in optracker
 	if oppi, ok := spt.optracker.GetExists(ctx, c); ok {
 		// if it does return the status of the operation
@@ -354,7 +750,7 @@ func (spt *Tracker) Status(ctx context.Context, c cid.Cid) *api.PinInfo {
 	// check global state to see if cluster should even be caring about
 	// the provided cid
 	var gpin *api.Pin
-	st, err := spt.getState(ctx)
+	st, err := getState(ctx)
 	if err != nil {
 		logger.Error(err)
 		addError(pinInfo, err)
@@ -406,39 +802,130 @@ func (spt *Tracker) Status(ctx context.Context, c cid.Cid) *api.PinInfo {
 	ipfsStatus := ips.ToTrackerStatus()
 	switch ipfsStatus {
 	case api.TrackerStatusUnpinned:
-		// The item is in the state but not in IPFS:
+		// The item is in the state but not in IPFS. It is
+		// re-pinned if we are within the grace period.
+		if spt.inUnpinnedGrace(c) {
+			pinInfo.Status = api.TrackerStatusPinQueued
+			return pinInfo
+		}
 		// PinError. Should be pinned.
 		pinInfo.Status = api.TrackerStatusPinError
 		pinInfo.Error = errUnexpectedlyUnpinned.Error()
 	default:
 		pinInfo.Status = ipfsStatus
+		pinInfo.Duration = spt.optracker.PinDuration(ctx, c)
 	}
 	return pinInfo
 }
 
-// RecoverAll attempts to recover all items tracked by this peer.
-func (spt *Tracker) RecoverAll(ctx context.Context) ([]*api.PinInfo, error) {
-	ctx, span := trace.StartSpan(ctx, "tracker/stateless/RecoverAll")
-	defer span.End()
+// watchUnpinned regularly re-pins the items which are unexpectedly
+// unpinned during the UnpinnedGracePeriod.
+func (spt *Tracker) watchUnpinned() {
+	defer spt.wg.Done()
 
-	statuses := spt.StatusAll(ctx, api.TrackerStatusUndefined)
-	resp := make([]*api.PinInfo, 0)
-	for _, st := range statuses {
-		// Break out if we shutdown. We might be going through
-		// a very long list of statuses.
+	ticker := time.NewTicker(unpinnedCheckInterval)
+	defer ticker.Stop()
+	for {
 		select {
-		case <-spt.ctx.Done():
-			return nil, spt.ctx.Err()
-		default:
-			r, err := spt.recoverWithPinInfo(ctx, st)
-			if err != nil {
-				return resp, err
+		case <-spt.workCtx.Done():
+			return
+		case <-ticker.C:
+			if err := spt.repinUnpinned(spt.workCtx); err != nil {
+				logger.Error(err)
 			}
-			resp = append(resp, r)
 		}
+	}
+}
+
+// repinUnpinned enqueues a new pin operation for the items allocated to
+// this peer which are not pinned in IPFS, as long as UnpinnedGracePeriod
+// has not passed since we first noticed. Only the items found unpinned are
+// remembered.
+func (spt *Tracker) repinUnpinned(ctx context.Context) error {
+	st, err := spt.getState(ctx)
+	if err != nil {
+		return err
+	}
+	statePins, err := st.List(ctx)
+	if err != nil {
+		return err
+	}
+	localpis, err := spt.ipfsStatusAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	unpinned := make(map[cid.Cid]time.Time)
+	var repins []*api.Pin
+	spt.unpinnedMu.Lock()
+	for _, p := range statePins {
+		if p.Type == api.MetaType || p.IsRemotePin(spt.peerID) {
+			continue
+		}
+		if _, ok := localpis[p.Cid]; ok {
+			continue
+		}
+		since, ok := spt.unpinnedSince[p.Cid]
+		if !ok {
+			since = now
+		}
+		unpinned[p.Cid] = since
+		if now.Sub(since) <= spt.config.UnpinnedGracePeriod {
+			repins = append(repins, p)
+		}
+	}
+	spt.unpinnedSince = unpinned
+	spt.unpinnedMu.Unlock()
 
+	for _, p := range repins {
+		logger.Infof("%s is unexpectedly unpinned. Re-pinning", p.Cid)
+		if err := spt.enqueue(ctx, p, optracker.OperationPin); err != nil {
+			return err
+		}
 	}
-	return resp, nil
+	return nil
+}
+
+// inUnpinnedGrace returns whether an item was found unexpectedly unpinned
+// less than UnpinnedGracePeriod ago, in which case it is being re-pinned.
+func (spt *Tracker) inUnpinnedGrace(c cid.Cid) bool {
+	spt.unpinnedMu.Lock()
+	defer spt.unpinnedMu.Unlock()
+	since, ok := spt.unpinnedSince[c]
+	return ok && time.Since(since) <= spt.config.UnpinnedGracePeriod
+}
+
+// clearUnpinned forgets about an item previously seen unexpectedly
+// unpinned.
+func (spt *Tracker) clearUnpinned(c cid.Cid) {
+	spt.unpinnedMu.Lock()
+	delete(spt.unpinnedSince, c)
+	spt.unpinnedMu.Unlock()
+}
+
+// RecoverAll attempts to recover all items tracked by this peer. Pins which
+// used up the MaxRetries of their QoS class are not retried. The items are
+// checked against IPFS as allowed by the ReconcileConcurrency and
+// ReconcileRate options. Every tracked item is checked.
+func (spt *Tracker) RecoverAll(ctx context.Context) ([]*api.PinInfo, error) {
+	ctx, span := trace.StartSpan(ctx, "tracker/stateless/RecoverAll")
+	defer span.End()
+
+	statuses := spt.StatusAll(ctx, api.TrackerStatusUndefined)
+	return spt.reconcile(ctx, statuses, false)
+}
+
+// ResumeRecoverAll works like RecoverAll but, for the pass which runs when
+// the peer starts, skips the items already checked by an earlier such pass
+// that was interrupted, and persists its own progress so that it can be
+// resumed in turn.
+func (spt *Tracker) ResumeRecoverAll(ctx context.Context) ([]*api.PinInfo, error) {
+	ctx, span := trace.StartSpan(ctx, "tracker/stateless/ResumeRecoverAll")
+	defer span.End()
+
+	statuses := spt.StatusAll(ctx, api.TrackerStatusUndefined)
+	return spt.reconcile(ctx, statuses, true)
 }
 
 // Recover will trigger pinning or unpinning for items in
@@ -450,18 +937,28 @@ func (spt *Tracker) Recover(ctx context.Context, c cid.Cid) (*api.PinInfo, error
 	// Check if we have a status in the operation tracker
 	pi, ok := spt.optracker.GetExists(ctx, c)
 	if ok {
-		return spt.recoverWithPinInfo(ctx, pi)
+		return spt.recoverWithPinInfo(ctx, pi, false)
 	}
 	// Get a status by checking against IPFS and use that.
-	return spt.recoverWithPinInfo(ctx, spt.Status(ctx, c))
+	return spt.recoverWithPinInfo(ctx, spt.Status(ctx, c), false)
 }
 
-func (spt *Tracker) recoverWithPinInfo(ctx context.Context, pi *api.PinInfo) (*api.PinInfo, error) {
+// recoverWithPinInfo restarts the operation for an item in error. With
+// limitRetries, pins which used up the retries of their QoS class are left
+// in error.
+func (spt *Tracker) recoverWithPinInfo(ctx context.Context, pi *api.PinInfo, limitRetries bool) (*api.PinInfo, error) {
 	var err error
 	switch pi.Status {
 	case api.TrackerStatusPinError, api.TrackerStatusUnexpectedlyUnpinned:
+		pin := api.PinCid(pi.Cid)
+		pin.QoSClass = spt.pinQoSClass(ctx, pi.Cid)
+		qc := spt.qosClass(pin.QoSClass)
+		if limitRetries && qc.MaxRetries > 0 && pi.AttemptCount > qc.MaxRetries {
+			logger.Debugf("%s: no retries left for QoS class %s", pi.Cid, pin.QoSClass)
+			break
+		}
 		logger.Infof("Restarting pin operation for %s", pi.Cid)
-		err = spt.enqueue(ctx, api.PinCid(pi.Cid), optracker.OperationPin)
+		err = spt.enqueue(ctx, pin, optracker.OperationPin)
 	case api.TrackerStatusUnpinError:
 		logger.Infof("Restarting unpin operation for %s", pi.Cid)
 		err = spt.enqueue(ctx, api.PinCid(pi.Cid), optracker.OperationUnpin)
@@ -473,22 +970,52 @@ func (spt *Tracker) recoverWithPinInfo(ctx context.Context, pi *api.PinInfo) (*a
 	return spt.Status(ctx, pi.Cid), nil
 }
 
+// pinQoSClass returns the QoS class of the given item in the shared state,
+// when QoS classes are defined.
+func (spt *Tracker) pinQoSClass(ctx context.Context, c cid.Cid) string {
+	spt.qosMu.RLock()
+	noClasses := len(spt.qosClasses) == 0
+	spt.qosMu.RUnlock()
+	if noClasses {
+		return ""
+	}
+
+	st, err := spt.getState(ctx)
+	if err != nil {
+		logger.Error(err)
+		return ""
+	}
+	pin, err := st.Get(ctx, c)
+	if err != nil {
+		return ""
+	}
+	return pin.QoSClass
+}
+
 func (spt *Tracker) ipfsStatusAll(ctx context.Context) (map[cid.Cid]*api.PinInfo, error) {
 	ctx, span := trace.StartSpan(ctx, "tracker/stateless/ipfsStatusAll")
 	defer span.End()
 
-	var ipsMap map[string]api.IPFSPinStatus
-	err := spt.rpcClient.CallContext(
-		ctx,
-		"",
-		"IPFSConnector",
-		"PinLs",
-		"recursive",
-		&ipsMap,
-	)
-	if err != nil {
-		logger.Error(err)
-		return nil, err
+	// Direct pins are listed too: besides those pinned in direct mode,
+	// the roots of the pins which exclude links are pinned directly.
+	ipsMap := make(map[string]api.IPFSPinStatus)
+	for _, typeFilter := range []string{"recursive", "direct"} {
+		var m map[string]api.IPFSPinStatus
+		err := spt.rpcClient.CallContext(
+			ctx,
+			"",
+			"IPFSConnector",
+			"PinLs",
+			typeFilter,
+			&m,
+		)
+		if err != nil {
+			logger.Error(err)
+			return nil, err
+		}
+		for k, ips := range m {
+			ipsMap[k] = ips
+		}
 	}
 	pins := make(map[cid.Cid]*api.PinInfo, len(ipsMap))
 	for cidstr, ips := range ipsMap {
@@ -548,7 +1075,8 @@ func (spt *Tracker) localStatus(ctx context.Context, incExtra bool, filter api.T
 
 	var localpis map[cid.Cid]*api.PinInfo
 	// Only query IPFS if we want to status for pinned items
-	if filter.Match(api.TrackerStatusPinned | api.TrackerStatusUnexpectedlyUnpinned) {
+	ipfsChecked := filter.Match(api.TrackerStatusPinned | api.TrackerStatusUnexpectedlyUnpinned)
+	if ipfsChecked {
 		localpis, err = spt.ipfsStatusAll(ctx)
 		if err != nil {
 			logger.Error(err)
@@ -558,6 +1086,9 @@ func (spt *Tracker) localStatus(ctx context.Context, incExtra bool, filter api.T
 
 	pininfos := make(map[cid.Cid]*api.PinInfo, len(statePins))
 	for _, p := range statePins {
+		if len(p.ExcludeLinks) > 0 {
+			spt.keepSelective(ctx, p)
+		}
 		ipfsInfo, pinnedInIpfs := localpis[p.Cid]
 		// base pinInfo object - status to be filled.
 		pinInfo := api.PinInfo{
@@ -588,6 +1119,7 @@ func (spt *Tracker) localStatus(ctx context.Context, incExtra bool, filter api.T
 		case pinnedInIpfs: // always false unless filter matches TrackerStatusPinnned
 			ipfsInfo.Name = p.Name
 			ipfsInfo.TS = p.Timestamp
+			ipfsInfo.Duration = spt.optracker.PinDuration(ctx, p.Cid)
 			pininfos[p.Cid] = ipfsInfo
 		default:
 			// report as UNEXPECTEDLY_UNPINNED for this peer.
@@ -595,7 +1127,13 @@ func (spt *Tracker) localStatus(ctx context.Context, incExtra bool, filter api.T
 			// has more info for this (an ongoing pinning
 			// operation). Otherwise, it means something should be
 			// pinned and it is not known by IPFS. Should be
-			// handled to "recover".
+			// handled to "recover". During the grace period, it
+			// is re-pinned (see watchUnpinned).
+			if ipfsChecked && spt.inUnpinnedGrace(p.Cid) {
+				pinInfo.Status = api.TrackerStatusPinQueued
+				pininfos[p.Cid] = &pinInfo
+				continue
+			}
 
 			pinInfo.Status = api.TrackerStatusUnexpectedlyUnpinned
 			pinInfo.Error = errUnexpectedlyUnpinned.Error()
@@ -3,17 +3,25 @@ package stateless
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/datastore/inmem"
+	"github.com/ipfs/ipfs-cluster/pintracker/optracker"
 	"github.com/ipfs/ipfs-cluster/state"
 	"github.com/ipfs/ipfs-cluster/state/dsstate"
 	"github.com/ipfs/ipfs-cluster/test"
 
 	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	peer "github.com/libp2p/go-libp2p-core/peer"
 	rpc "github.com/libp2p/go-libp2p-gorpc"
+	multihash "github.com/multiformats/go-multihash"
 )
 
 var (
@@ -85,6 +93,15 @@ func (mock *mockIPFS) PinLsCid(ctx context.Context, in *api.Pin, out *api.IPFSPi
 	return nil
 }
 
+// FindProviders finds another provider for everything but DegradedCid.
+func (mock *mockIPFS) FindProviders(ctx context.Context, in *api.FindProvidersRequest, out *[]peer.ID) error {
+	*out = []peer.ID{}
+	if !in.Cid.Equals(test.DegradedCid) {
+		*out = append(*out, test.PeerID2)
+	}
+	return nil
+}
+
 func mockRPCClient(t testing.TB) *rpc.Client {
 	t.Helper()
 
@@ -174,6 +191,45 @@ func TestUntrackTrack(t *testing.T) {
 	}
 }
 
+func TestUntrackSelective(t *testing.T) {
+	ctx := context.Background()
+	opts := pinOpts
+	opts.ExcludeLinks = []string{"thumbs"}
+	pin := api.PinWithOpts(test.Cid1, opts)
+	spt := testStatelessPinTracker(t, pin)
+	defer spt.Shutdown(ctx)
+
+	// Walking the shared state keeps the pins which exclude links.
+	spt.StatusAll(ctx, api.TrackerStatusUndefined)
+
+	unpinned := spt.unpinnedPin(ctx, test.Cid1)
+	if len(unpinned.ExcludeLinks) != 1 {
+		t.Error("the unpin should carry the excluded links:", unpinned)
+	}
+	if unpinned = spt.unpinnedPin(ctx, test.Cid1); len(unpinned.ExcludeLinks) != 0 {
+		t.Error("the pin should have been forgotten")
+	}
+
+	// Kept pins survive a restart when there is a datastore.
+	store := inmem.New()
+	cfg := &Config{}
+	cfg.Default()
+	spt2 := New(cfg, test.PeerID1, test.PeerName1, getStateFunc(t, pin))
+	spt2.SetDatastore(store)
+	spt2.keepSelective(ctx, pin)
+	spt2.Shutdown(ctx)
+
+	spt3 := New(cfg, test.PeerID1, test.PeerName1, getStateFunc(t))
+	spt3.SetDatastore(store)
+	defer spt3.Shutdown(ctx)
+	if unpinned = spt3.unpinnedPin(ctx, test.Cid1); len(unpinned.ExcludeLinks) != 1 {
+		t.Error("the unpin should carry the excluded links after a restart:", unpinned)
+	}
+	if unpinned = spt3.unpinnedPin(ctx, test.Cid1); len(unpinned.ExcludeLinks) != 0 {
+		t.Error("the persisted pin should have been forgotten")
+	}
+}
+
 func TestTrackUntrackWithCancel(t *testing.T) {
 	ctx := context.Background()
 	spt := testStatelessPinTracker(t)
@@ -474,6 +530,115 @@ func TestStatus(t *testing.T) {
 	}
 }
 
+func TestStatusCids(t *testing.T) {
+	ctx := context.Background()
+
+	spt := testStatelessPinTracker(t, api.PinWithOpts(test.Cid1, pinOpts))
+	defer spt.Shutdown(ctx)
+
+	cids := []cid.Cid{test.Cid1, test.Cid3, test.Cid1}
+	expected := []api.TrackerStatus{
+		api.TrackerStatusPinned,
+		api.TrackerStatusUnpinned,
+		api.TrackerStatusPinned,
+	}
+	pinfos := spt.StatusCids(ctx, cids)
+	if len(pinfos) != len(cids) {
+		t.Fatalf("expected %d statuses, got %d", len(cids), len(pinfos))
+	}
+	for i, pi := range pinfos {
+		if !pi.Cid.Equals(cids[i]) || pi.Status != expected[i] {
+			t.Errorf("%d: expected %s %s, got %s %s", i, cids[i], expected[i], pi.Cid, pi.Status)
+		}
+	}
+}
+
+func TestUnpinnedGracePeriod(t *testing.T) {
+	ctx := context.Background()
+
+	defer func(d time.Duration) { unpinnedCheckInterval = d }(unpinnedCheckInterval)
+	unpinnedCheckInterval = 100 * time.Millisecond
+
+	normalPin := api.PinWithOpts(test.Cid4, pinOpts)
+	cfg := &Config{}
+	cfg.Default()
+	cfg.UnpinnedGracePeriod = time.Second
+	spt := New(cfg, test.PeerID1, test.PeerName1, getStateFunc(t, normalPin))
+	spt.SetClient(mockRPCClient(t))
+	defer spt.Shutdown(ctx)
+
+	// Cid4 is not pinned in IPFS. During the grace period
+	// it is re-pinned instead of reported as error.
+	time.Sleep(300 * time.Millisecond)
+	st := spt.Status(ctx, test.Cid4)
+	if st.Status == api.TrackerStatusPinError {
+		t.Error("cid4 should not be in error during the grace period")
+	}
+
+	for _, pi := range spt.StatusAll(ctx, api.TrackerStatusUndefined) {
+		if pi.Status == api.TrackerStatusUnexpectedlyUnpinned {
+			t.Error("cid4 should not be unexpectedly unpinned during the grace period")
+		}
+	}
+
+	time.Sleep(1200 * time.Millisecond)
+
+	st = spt.Status(ctx, test.Cid4)
+	if st.Status != api.TrackerStatusPinError {
+		t.Error("cid4 should be in pin_error after the grace period")
+	}
+}
+
+func TestPinDependency(t *testing.T) {
+	ctx := context.Background()
+	dependencyRetryInterval = 100 * time.Millisecond
+	dependencyWaitTimeout = time.Second
+	defer func() {
+		dependencyRetryInterval = 10 * time.Second
+		dependencyWaitTimeout = time.Hour
+	}()
+
+	// Cid5 is not pinned yet, so Cid4 waits. Cid1 is pinned, so Cid2
+	// proceeds.
+	optsCid5 := pinOpts
+	optsCid5.DependsOn = test.Cid5
+	optsCid1 := pinOpts
+	optsCid1.DependsOn = test.Cid1
+	pinCid4 := api.PinWithOpts(test.Cid4, optsCid5)
+	pinCid2 := api.PinWithOpts(test.Cid2, optsCid1)
+
+	spt := testStatelessPinTracker(t,
+		api.PinWithOpts(test.Cid1, pinOpts),
+		api.PinWithOpts(test.Cid5, pinOpts),
+		pinCid4,
+		pinCid2,
+	)
+	defer spt.Shutdown(ctx)
+
+	err := spt.Track(ctx, pinCid4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = spt.Track(ctx, pinCid2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	if st := spt.Status(ctx, test.Cid4); st.Status != api.TrackerStatusPinQueued {
+		t.Errorf("cid4 should be waiting for its dependency: %s", st.Status)
+	}
+	if st := spt.Status(ctx, test.Cid2); st.Status != api.TrackerStatusPinned {
+		t.Errorf("cid2 should be pinned: %s", st.Status)
+	}
+
+	time.Sleep(time.Second)
+	if st := spt.Status(ctx, test.Cid4); st.Status != api.TrackerStatusPinError {
+		t.Errorf("cid4 should fail after waiting too long for its dependency: %s", st.Status)
+	}
+}
+
 // Test
 func TestAttemptCountAndPriority(t *testing.T) {
 	ctx := context.Background()
@@ -543,6 +708,368 @@ func TestAttemptCountAndPriority(t *testing.T) {
 	}
 }
 
+func TestQoSClasses(t *testing.T) {
+	ctx := context.Background()
+
+	opts := pinOpts
+	opts.QoSClass = "bulk"
+	errPin := api.PinWithOpts(pinErrCid, opts)
+
+	spt := testStatelessPinTracker(t, errPin)
+	defer spt.Shutdown(ctx)
+	spt.SetQoSClasses(map[string]*api.QoSClass{
+		"bulk": {
+			Priority:   api.QoSPriorityLow,
+			MaxRetries: 1,
+		},
+	})
+
+	err := spt.Track(ctx, errPin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond) // let the pin be applied
+	st := spt.Status(ctx, pinErrCid)
+	if st.AttemptCount != 1 || st.PriorityPin {
+		t.Errorf("errPin should have 1 attempt and not be priority: %+v", st)
+	}
+
+	// Retry 1
+	_, err = spt.RecoverAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond) // let the pin be applied
+	st = spt.Status(ctx, pinErrCid)
+	if st.AttemptCount != 2 {
+		t.Errorf("errPin should have 2 attempts: %+v", st)
+	}
+
+	// No retries left
+	_, err = spt.RecoverAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	st = spt.Status(ctx, pinErrCid)
+	if st.AttemptCount != 2 || st.Status != api.TrackerStatusPinError {
+		t.Errorf("errPin should not have been retried: %+v", st)
+	}
+
+	// Explicit recovers are not limited
+	_, err = spt.Recover(ctx, pinErrCid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	st = spt.Status(ctx, pinErrCid)
+	if st.AttemptCount != 3 {
+		t.Errorf("errPin should have 3 attempts: %+v", st)
+	}
+}
+
+func TestCheckAvailability(t *testing.T) {
+	ctx := context.Background()
+	defer func(d time.Duration, n int) {
+		availabilityRetryInterval = d
+		maxAvailabilityChecks = n
+	}(availabilityRetryInterval, maxAvailabilityChecks)
+	availabilityRetryInterval = 100 * time.Millisecond
+	maxAvailabilityChecks = 5
+
+	opts := pinOpts
+	opts.QoSClass = "critical"
+	unavailablePin := api.PinWithOpts(test.DegradedCid, opts)
+	availablePin := api.PinWithOpts(test.Cid1, opts)
+
+	spt := testStatelessPinTracker(t, unavailablePin, availablePin)
+	defer spt.Shutdown(ctx)
+	spt.SetQoSClasses(map[string]*api.QoSClass{
+		"critical": {
+			CheckAvailability: true,
+		},
+	})
+
+	if err := spt.Track(ctx, unavailablePin); err != nil {
+		t.Fatal(err)
+	}
+	if err := spt.Track(ctx, availablePin); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(250 * time.Millisecond)
+
+	st := spt.Status(ctx, test.DegradedCid)
+	if st.Status != api.TrackerStatusPinQueued {
+		t.Errorf("an item without providers should stay queued: %s", st.Status)
+	}
+	if !strings.Contains(st.Error, "0 of 1 providers found") {
+		t.Errorf("expected the reason in the error: %q", st.Error)
+	}
+	if st.AttemptCount != 1 {
+		t.Errorf("the item should not be pinned again: %+v", st)
+	}
+
+	if st := spt.Status(ctx, test.Cid1); st.Status != api.TrackerStatusPinned {
+		t.Errorf("an available item should be pinned: %s", st.Status)
+	}
+
+	time.Sleep(400 * time.Millisecond)
+	st = spt.Status(ctx, test.DegradedCid)
+	if st.Status != api.TrackerStatusPinError {
+		t.Errorf("an item which stays unavailable should be left in error: %s", st.Status)
+	}
+	if !strings.Contains(st.Error, "not available after 5 checks") {
+		t.Errorf("expected the reason in the error: %q", st.Error)
+	}
+}
+
+func TestStatusTiming(t *testing.T) {
+	ctx := context.Background()
+	slowPin := api.PinWithOpts(test.SlowCid1, pinOpts)
+	errPin := api.PinWithOpts(pinErrCid, pinOpts)
+	spt := testStatelessPinTracker(t, slowPin, errPin)
+	defer spt.Shutdown(ctx)
+
+	if err := spt.Track(ctx, slowPin); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	st := spt.Status(ctx, test.SlowCid1)
+	if st.Status != api.TrackerStatusPinning {
+		t.Fatalf("expected pinning; got %s", st.Status)
+	}
+	if st.Since.IsZero() || time.Since(st.Since) < 200*time.Millisecond {
+		t.Errorf("the pin should have been ongoing for 200ms at least; since: %s", st.Since)
+	}
+	if st.Duration != 0 {
+		t.Errorf("an ongoing pin should have no duration: %s", st.Duration)
+	}
+
+	spt.SetPinProgress(ctx, test.SlowCid1, 3)
+	spt.SetPinProgress(ctx, test.SlowCid1, 2) // out of order
+	if st := spt.Status(ctx, test.SlowCid1); st.BlocksFetched != 3 {
+		t.Errorf("expected 3 blocks fetched; got %d", st.BlocksFetched)
+	}
+
+	if err := spt.Track(ctx, errPin); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+	st = spt.Status(ctx, pinErrCid)
+	if st.Status != api.TrackerStatusPinError {
+		t.Fatalf("expected pin_error; got %s", st.Status)
+	}
+	// queued behind the slow pin.
+	if st.Duration < 500*time.Millisecond {
+		t.Errorf("the failed pin should have taken 500ms at least: %s", st.Duration)
+	}
+
+	// The duration of successful pins is kept once they are done.
+	if d := spt.optracker.PinDuration(ctx, test.SlowCid1); d < 200*time.Millisecond {
+		t.Errorf("the slow pin should have taken 200ms at least: %s", d)
+	}
+}
+
+// flakyIPFS fails to pin the first failures times.
+type flakyIPFS struct {
+	mockIPFS
+
+	mu       sync.Mutex
+	failures int
+	attempts int
+	pinned   bool
+}
+
+func (mock *flakyIPFS) Pin(ctx context.Context, in *api.Pin, out *struct{}) error {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	mock.attempts++
+	if mock.attempts <= mock.failures {
+		return errors.New("ipfs is having a bad day")
+	}
+	mock.pinned = true
+	return nil
+}
+
+func (mock *flakyIPFS) PinLsCid(ctx context.Context, in *api.Pin, out *api.IPFSPinStatus) error {
+	mock.mu.Lock()
+	defer mock.mu.Unlock()
+	*out = api.IPFSPinStatusUnpinned
+	if mock.pinned {
+		*out = api.IPFSPinStatusRecursive
+	}
+	return nil
+}
+
+func TestPinRetries(t *testing.T) {
+	ctx := context.Background()
+	pin := api.PinWithOpts(test.Cid4, pinOpts)
+
+	cfg := &Config{}
+	cfg.Default()
+	cfg.ConcurrentPins = 1
+	cfg.MaxPinRetries = 3
+	cfg.PinRetryInitialDelay = 100 * time.Millisecond
+	cfg.PinRetryMaxDelay = 150 * time.Millisecond
+	spt := New(cfg, test.PeerID1, test.PeerName1, getStateFunc(t, pin))
+	defer spt.Shutdown(ctx)
+
+	ipfs := &flakyIPFS{failures: 3}
+	s := rpc.NewServer(nil, "mock")
+	if err := s.RegisterName("IPFSConnector", ipfs); err != nil {
+		t.Fatal(err)
+	}
+	spt.SetClient(rpc.NewClientWithServer(nil, "mock", s))
+
+	if err := spt.Track(ctx, pin); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	st := spt.Status(ctx, test.Cid4)
+	if st.Status != api.TrackerStatusPinQueued || st.AttemptCount != 1 {
+		t.Errorf("the pin should be queued for a retry after 1 attempt: %+v", st)
+	}
+
+	// Retries after 100ms, 150ms and 150ms.
+	time.Sleep(time.Second)
+	st = spt.Status(ctx, test.Cid4)
+	if st.Status != api.TrackerStatusPinned {
+		t.Errorf("the pin should have been pinned after retrying: %+v", st)
+	}
+	ipfs.mu.Lock()
+	attempts := ipfs.attempts
+	ipfs.mu.Unlock()
+	if attempts != 4 {
+		t.Errorf("expected 4 attempts; got %d", attempts)
+	}
+
+	// One more failure than retries leaves it in error.
+	ipfs.mu.Lock()
+	ipfs.failures, ipfs.attempts, ipfs.pinned = 4, 0, false
+	ipfs.mu.Unlock()
+	if err := spt.Track(ctx, pin); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+	st = spt.Status(ctx, test.Cid4)
+	if st.Status != api.TrackerStatusPinError || st.AttemptCount != 4 {
+		t.Errorf("the pin should be in error after 4 attempts: %+v", st)
+	}
+}
+
+// recordingIPFS records the order in which items are pinned.
+type recordingIPFS struct {
+	mockIPFS
+
+	mu     sync.Mutex
+	pinned []cid.Cid
+}
+
+func (mock *recordingIPFS) Pin(ctx context.Context, in *api.Pin, out *struct{}) error {
+	err := mock.mockIPFS.Pin(ctx, in, out)
+	mock.mu.Lock()
+	mock.pinned = append(mock.pinned, in.Cid)
+	mock.mu.Unlock()
+	return err
+}
+
+func TestPinQueuePriority(t *testing.T) {
+	ctx := context.Background()
+
+	cfg := &Config{}
+	cfg.Default()
+	cfg.ConcurrentPins = 1
+	cfg.PriorityPinMaxAge = 10 * time.Second
+	cfg.MaxPinQueueSize = 5
+	cfg.PriorityMetadataKey = "priority"
+	spt := New(cfg, test.PeerID1, test.PeerName1, getStateFunc(t))
+	defer spt.Shutdown(ctx)
+
+	ipfs := &recordingIPFS{}
+	s := rpc.NewServer(nil, "mock")
+	if err := s.RegisterName("IPFSConnector", ipfs); err != nil {
+		t.Fatal(err)
+	}
+	spt.SetClient(rpc.NewClientWithServer(nil, "mock", s))
+
+	makePin := func(c cid.Cid, priority string, recent bool) *api.Pin {
+		p := api.PinWithOpts(c, pinOpts)
+		if priority != "" {
+			p.Metadata = map[string]string{"priority": priority}
+		}
+		if !recent {
+			p.Timestamp = time.Now().Add(-time.Hour)
+		}
+		return p
+	}
+
+	// Keep the only worker busy while the rest is queued.
+	if err := spt.Track(ctx, makePin(test.SlowCid1, "", false)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	pins := []*api.Pin{
+		makePin(test.Cid1, "", false),
+		makePin(test.Cid2, "5", false),
+		makePin(test.Cid4, "", true),
+		makePin(test.Cid5, "10", false),
+		makePin(test.HugeCid, "-1", false),
+	}
+	for _, p := range pins {
+		if err := spt.Track(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(timeout time.Duration) {
+		fullQueueTimeout = timeout
+	}(fullQueueTimeout)
+
+	// The queue is full: the next one is left in error when no room is
+	// made in time.
+	fullQueueTimeout = 100 * time.Millisecond
+	if err := spt.Track(ctx, makePin(test.NotFoundCid, "-5", false)); !errors.Is(err, ErrFullQueue) {
+		t.Fatal("expected a full queue error:", err)
+	}
+	if st := spt.Status(ctx, test.NotFoundCid); st.Status != api.TrackerStatusPinError {
+		t.Errorf("expected the item to be in error: %s", st.Status)
+	}
+
+	// Otherwise it waits for the worker to make room.
+	fullQueueTimeout = 5 * time.Second
+	start := time.Now()
+	if err := spt.Track(ctx, makePin(test.Cid3, "-5", false)); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 500*time.Millisecond {
+		t.Error("queuing to a full queue should have waited for room")
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	expected := []cid.Cid{
+		test.SlowCid1,
+		test.Cid5,    // priority 10
+		test.Cid2,    // priority 5
+		test.Cid4,    // priority pin
+		test.Cid1,    // no priority
+		test.HugeCid, // priority -1
+		test.Cid3,    // priority -5
+	}
+	ipfs.mu.Lock()
+	defer ipfs.mu.Unlock()
+	if len(ipfs.pinned) != len(expected) {
+		t.Fatalf("expected %d pins; got %v", len(expected), ipfs.pinned)
+	}
+	for i, c := range expected {
+		if !ipfs.pinned[i].Equals(c) {
+			t.Errorf("pin %d: expected %s; got %s", i, c, ipfs.pinned[i])
+		}
+	}
+}
+
 func BenchmarkTracker_localStatus(b *testing.B) {
 	tracker := testStatelessPinTracker(b)
 	ctx := context.Background()
@@ -551,3 +1078,334 @@ func BenchmarkTracker_localStatus(b *testing.B) {
 		tracker.localStatus(ctx, true, api.TrackerStatusUndefined)
 	}
 }
+
+func TestSLABreaches(t *testing.T) {
+	ctx := context.Background()
+	slowPin := api.PinWithOpts(test.SlowCid1, pinOpts)
+	slowPin.PinDeadline = time.Now().Add(200 * time.Millisecond)
+	fastPin := api.PinWithOpts(test.Cid4, pinOpts)
+	fastPin.PinDeadline = time.Now().Add(time.Minute)
+	spt := testStatelessPinTracker(t, slowPin, fastPin)
+	defer spt.Shutdown(ctx)
+
+	if err := spt.Track(ctx, slowPin); err != nil {
+		t.Fatal(err)
+	}
+	if err := spt.Track(ctx, fastPin); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(400 * time.Millisecond)
+	breaches := spt.SLABreaches(ctx)
+	if len(breaches) != 1 || !breaches[0].Cid.Equals(test.SlowCid1) {
+		t.Fatalf("expected the slow pin to breach its deadline: %+v", breaches)
+	}
+	if !breaches[0].PinnedAt.IsZero() || breaches[0].Peer != test.PeerID1 {
+		t.Errorf("unexpected breach while pinning: %+v", breaches[0])
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	breaches = spt.SLABreaches(ctx)
+	if len(breaches) != 1 || !breaches[0].Cid.Equals(test.SlowCid1) {
+		t.Fatalf("expected the slow pin to breach its deadline: %+v", breaches)
+	}
+	if breaches[0].PinnedAt.Before(breaches[0].Deadline) {
+		t.Errorf("expected the slow pin to be pinned after its deadline: %+v", breaches[0])
+	}
+
+	if err := spt.Untrack(ctx, test.SlowCid1); err != nil {
+		t.Fatal(err)
+	}
+	if breaches := spt.SLABreaches(ctx); len(breaches) != 0 {
+		t.Errorf("expected no breaches after untracking: %+v", breaches)
+	}
+}
+
+// reconcileIPFS reports all the given pins as pinned and tracks how many
+// PinLsCid calls run at the same time.
+type reconcileIPFS struct {
+	mockIPFS
+	pins []*api.Pin
+
+	mu      sync.Mutex
+	current int
+	max     int
+	calls   int
+}
+
+func (mock *reconcileIPFS) PinLs(ctx context.Context, in string, out *map[string]api.IPFSPinStatus) error {
+	m := make(map[string]api.IPFSPinStatus, len(mock.pins))
+	for _, p := range mock.pins {
+		m[p.Cid.String()] = api.IPFSPinStatusRecursive
+	}
+	*out = m
+	return nil
+}
+
+func (mock *reconcileIPFS) PinLsCid(ctx context.Context, in *api.Pin, out *api.IPFSPinStatus) error {
+	mock.mu.Lock()
+	mock.calls++
+	mock.current++
+	if mock.current > mock.max {
+		mock.max = mock.current
+	}
+	mock.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	mock.mu.Lock()
+	mock.current--
+	mock.mu.Unlock()
+	*out = api.IPFSPinStatusRecursive
+	return nil
+}
+
+func TestRecoverAllThrottled(t *testing.T) {
+	ctx := context.Background()
+
+	var pins []*api.Pin
+	for i := 0; i < 20; i++ {
+		h, err := multihash.Sum([]byte(fmt.Sprintf("reconcile-%d", i)), multihash.SHA2_256, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pins = append(pins, api.PinWithOpts(cid.NewCidV1(cid.Raw, h), pinOpts))
+	}
+
+	newTracker := func(t *testing.T, concurrency int, rate float64, store ds.Datastore) (*Tracker, *reconcileIPFS) {
+		cfg := &Config{}
+		cfg.Default()
+		cfg.ReconcileConcurrency = concurrency
+		cfg.ReconcileRate = rate
+		spt := New(cfg, test.PeerID1, test.PeerName1, getStateFunc(t, pins...))
+		spt.SetDatastore(store)
+
+		mock := &reconcileIPFS{pins: pins}
+		s := rpc.NewServer(nil, "mock")
+		err := s.RegisterName("IPFSConnector", mock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spt.SetClient(rpc.NewClientWithServer(nil, "mock", s))
+		return spt, mock
+	}
+
+	t.Run("concurrency", func(t *testing.T) {
+		spt, mock := newTracker(t, 3, 0, nil)
+		defer spt.Shutdown(ctx)
+
+		resp, err := spt.RecoverAll(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp) != len(pins) || mock.calls != len(pins) {
+			t.Errorf("expected %d items to be checked, got %d (%d calls)", len(pins), len(resp), mock.calls)
+		}
+		if mock.max > 3 {
+			t.Errorf("expected no more than 3 concurrent connector calls, got %d", mock.max)
+		}
+		for _, pi := range resp {
+			if pi.Status != api.TrackerStatusPinned {
+				t.Errorf("%s should be pinned: %s", pi.Cid, pi.Status)
+			}
+		}
+	})
+
+	t.Run("rate", func(t *testing.T) {
+		spt, mock := newTracker(t, 4, 100, nil)
+		defer spt.Shutdown(ctx)
+
+		start := time.Now()
+		resp, err := spt.RecoverAll(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp) != len(pins) {
+			t.Errorf("expected %d items to be checked, got %d", len(pins), len(resp))
+		}
+		// 20 items at 100 per second.
+		if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+			t.Errorf("the pass should have been throttled: took %s", elapsed)
+		}
+		if mock.max > 4 {
+			t.Errorf("expected no more than 4 concurrent connector calls, got %d", mock.max)
+		}
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		defer func(i int) { reconcileCursorInterval = i }(reconcileCursorInterval)
+		reconcileCursorInterval = 1
+		store := inmem.New()
+
+		// Interrupt a slow pass after a few items.
+		spt, _ := newTracker(t, 1, 10, store)
+		tctx, cancel := context.WithTimeout(ctx, 550*time.Millisecond)
+		defer cancel()
+		first, err := spt.ResumeRecoverAll(tctx)
+		if err == nil {
+			t.Fatal("expected the pass to be interrupted")
+		}
+		spt.Shutdown(ctx)
+		if len(first) == 0 || len(first) == len(pins) {
+			t.Fatalf("expected only some items to be checked: %d", len(first))
+		}
+
+		// Passes other than the resumable one check every item and
+		// leave the cursor alone.
+		spt, mock := newTracker(t, 1, 0, store)
+		defer spt.Shutdown(ctx)
+		full, err := spt.RecoverAll(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(full) != len(pins) || mock.calls != len(pins) {
+			t.Errorf("expected a full pass, got %d items (%d calls)", len(full), mock.calls)
+		}
+
+		// The resumable pass continues after them.
+		mock.calls = 0
+		second, err := spt.ResumeRecoverAll(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(first)+len(second) != len(pins) || mock.calls != len(second) {
+			t.Errorf("expected the remaining %d items to be checked, got %d (%d calls)", len(pins)-len(first), len(second), mock.calls)
+		}
+		checked := make(map[cid.Cid]struct{})
+		for _, pi := range first {
+			checked[pi.Cid] = struct{}{}
+		}
+		for _, pi := range second {
+			if _, ok := checked[pi.Cid]; ok {
+				t.Errorf("%s was checked again", pi.Cid)
+			}
+		}
+
+		// The completed pass removed the cursor.
+		third, err := spt.ResumeRecoverAll(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(third) != len(pins) {
+			t.Errorf("expected a full pass after completing one, got %d items", len(third))
+		}
+	})
+}
+
+func TestShutdownDrain(t *testing.T) {
+	ctx := context.Background()
+
+	slowPin := api.PinWithOpts(test.SlowCid1, pinOpts)
+	queuedPin := api.PinWithOpts(test.Cid4, pinOpts)
+	getState := getStateFunc(t, slowPin, queuedPin)
+
+	cfg := &Config{}
+	cfg.Default()
+	cfg.ConcurrentPins = 1
+	cfg.ShutdownDrainTimeout = 5 * time.Second
+	store := inmem.New()
+	spt := New(cfg, test.PeerID1, test.PeerName1, getState)
+	spt.SetDatastore(store)
+	spt.SetClient(mockRPCClient(t))
+
+	err := spt.Track(ctx, slowPin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	err = spt.Track(ctx, queuedPin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = spt.Shutdown(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = spt.Shutdown(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The slow pin was in progress and finished.
+	if pi, ok := spt.optracker.GetExists(ctx, test.SlowCid1); ok {
+		t.Errorf("the slow pin should have completed: %s", pi.Status)
+	}
+	// The other one was not started.
+	if st, _ := spt.optracker.Status(ctx, test.Cid4); st != api.TrackerStatusPinQueued {
+		t.Errorf("expected %s to be left queued: %s", test.Cid4, st)
+	}
+
+	// It was persisted.
+	key := pendingKey(optracker.OperationPin, queuedPin)
+	if ok, _ := store.Has(ctx, key); !ok {
+		t.Fatalf("%s should have been persisted", test.Cid4)
+	}
+	if ok, _ := store.Has(ctx, pendingKey(optracker.OperationPin, slowPin)); ok {
+		t.Error("completed operations should not be persisted")
+	}
+
+	// A new tracker on the same datastore replays it.
+	spt = New(cfg, test.PeerID1, test.PeerName1, getState)
+	spt.SetDatastore(store)
+	spt.SetClient(mockRPCClient(t))
+	defer spt.Shutdown(ctx)
+
+	for i := 0; i < 50; i++ {
+		if ok, _ := store.Has(ctx, key); !ok {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if ok, _ := store.Has(ctx, key); ok {
+		t.Fatal("the pending operation should have been replayed")
+	}
+}
+
+func TestReplayPendingUnpin(t *testing.T) {
+	ctx := context.Background()
+
+	store := inmem.New()
+	pin := api.PinWithOpts(test.SlowCid1, pinOpts)
+	v, err := pin.ProtoMarshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Put(ctx, pendingKey(optracker.OperationUnpin, pin), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repinned := api.PinWithOpts(test.Cid2, pinOpts)
+	v, err = repinned.ProtoMarshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Put(ctx, pendingKey(optracker.OperationUnpin, repinned), v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cid2 was pinned again while the peer was stopped.
+	cfg := &Config{}
+	cfg.Default()
+	spt := New(cfg, test.PeerID1, test.PeerName1, getStateFunc(t, repinned))
+	spt.SetDatastore(store)
+	spt.rpcClient = mockRPCClient(t)
+	defer spt.Shutdown(ctx)
+
+	spt.replayPending(ctx)
+	if st, _ := spt.optracker.Status(ctx, test.SlowCid1); st != api.TrackerStatusUnpinQueued && st != api.TrackerStatusUnpinning {
+		t.Errorf("the unpin of %s should have been queued: %s", test.SlowCid1, st)
+	}
+	if _, ok := spt.optracker.GetExists(ctx, test.Cid2); ok {
+		t.Errorf("the unpin of %s should have been dropped", test.Cid2)
+	}
+	results, err := store.Query(ctx, query.Query{Prefix: pendingNamespace.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := results.Rest()
+	if len(entries) != 0 {
+		t.Error("replayed operations should be removed from the datastore")
+	}
+}
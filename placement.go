@@ -0,0 +1,213 @@
+package ipfscluster
+
+import (
+	"context"
+	"sort"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"go.opencensus.io/trace"
+)
+
+// placementPlan carries the placement rules of a pin along with the tags of
+// the peers they are evaluated against.
+type placementPlan struct {
+	rules api.Placement
+	tags  map[peer.ID]map[string]string
+}
+
+// newPlacementPlan parses the given placement expression and fetches the tag
+// metrics of the peers for the tags it uses. It returns nil when there are no
+// rules.
+func (c *Cluster) newPlacementPlan(ctx context.Context, expr string) (*placementPlan, error) {
+	ctx, span := trace.StartSpan(ctx, "cluster/newPlacementPlan")
+	defer span.End()
+
+	rules, err := api.ParsePlacement(expr)
+	if err != nil || len(rules) == 0 {
+		return nil, err
+	}
+
+	plan := &placementPlan{
+		rules: rules,
+		tags:  make(map[peer.ID]map[string]string),
+	}
+	// All peers publish a ping metric, even those without tags.
+	for _, m := range c.monitor.LatestMetrics(ctx, pingMetricName) {
+		plan.tags[m.Peer] = make(map[string]string)
+	}
+	for _, tag := range rules.Tags() {
+		for _, m := range c.monitor.LatestMetrics(ctx, "tag:"+tag) {
+			if _, ok := plan.tags[m.Peer]; !ok {
+				plan.tags[m.Peer] = make(map[string]string)
+			}
+			plan.tags[m.Peer][tag] = m.Value
+		}
+	}
+	return plan, nil
+}
+
+// disallowed returns the peers which do not satisfy the require and exclude
+// rules.
+func (plan *placementPlan) disallowed() []peer.ID {
+	var peers []peer.ID
+	for p, tags := range plan.tags {
+		if !plan.rules.Allows(tags) {
+			peers = append(peers, p)
+		}
+	}
+	return peers
+}
+
+// preferred returns the allowed peers matching the prefer rules.
+func (plan *placementPlan) preferred() []peer.ID {
+	var peers []peer.ID
+	for p, tags := range plan.tags {
+		if plan.rules.Allows(tags) && plan.rules.Prefers(tags) {
+			peers = append(peers, p)
+		}
+	}
+	return peers
+}
+
+// selectPeers picks up to wanted peers from the candidates, which are sorted
+// by preference, so that along with the current allocations none of the
+// per-value maximums is exceeded and all of them share the value of the tags
+// of the same rules (see sameValue). Candidates needed to reach the per-value
+// minimums are picked first. Minimums which cannot be reached are logged as
+// warnings and do not prevent the allocation.
+func (plan *placementPlan) selectPeers(current, candidates []peer.ID, wanted int) []peer.ID {
+	same := make(map[string]string)
+	for _, r := range plan.rules {
+		if r.Kind == api.PlacementSame {
+			same[r.Tag] = plan.sameValue(r.Tag, same, current, candidates, wanted)
+		}
+	}
+	return plan.selectWithSame(current, candidates, wanted, same, true)
+}
+
+// selectWithSame is selectPeers with the values of the tags of the same
+// rules already chosen. Warnings are only logged when warn is set.
+func (plan *placementPlan) selectWithSame(current, candidates []peer.ID, wanted int, same map[string]string, warn bool) []peer.ID {
+	counts := make(map[string]map[string]int)
+	for _, tag := range plan.rules.Tags() {
+		counts[tag] = make(map[string]int)
+	}
+	add := func(p peer.ID) {
+		for tag := range counts {
+			counts[tag][plan.tags[p][tag]]++
+		}
+	}
+
+	fits := func(p peer.ID) bool {
+		for _, r := range plan.rules {
+			if r.Kind == api.PlacementMaxPer && counts[r.Tag][plan.tags[p][r.Tag]] >= r.N {
+				return false
+			}
+		}
+		for tag, v := range same {
+			if pv, ok := plan.tags[p][tag]; !ok || pv != v {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, p := range current {
+		add(p)
+	}
+
+	var selected []peer.ID
+	picked := make(map[peer.ID]bool)
+	pick := func(p peer.ID) {
+		selected = append(selected, p)
+		picked[p] = true
+		add(p)
+	}
+
+	for _, r := range plan.rules {
+		if r.Kind != api.PlacementMinPer {
+			continue
+		}
+		for _, v := range plan.values(r.Tag) {
+			for _, p := range candidates {
+				if len(selected) >= wanted || counts[r.Tag][v] >= r.N {
+					break
+				}
+				if !picked[p] && plan.tags[p][r.Tag] == v && fits(p) {
+					pick(p)
+				}
+			}
+			if warn && counts[r.Tag][v] < r.N {
+				logger.Warnf(
+					"placement rule %s cannot be satisfied for %s=%s: %d replicas",
+					r, r.Tag, v, counts[r.Tag][v],
+				)
+			}
+		}
+	}
+
+	for _, p := range candidates {
+		if len(selected) >= wanted {
+			break
+		}
+		if !picked[p] && fits(p) {
+			pick(p)
+		}
+	}
+	return selected
+}
+
+// sameValue returns the value of the given tag which all the allocations
+// should share, along with the values already chosen for other tags: that of
+// the current allocations when they have it, or else the first one, in order
+// of preference of the candidates, with which the wanted allocations can be
+// selected. When there is none, it returns the one with which most can.
+func (plan *placementPlan) sameValue(tag string, same map[string]string, current, candidates []peer.ID, wanted int) string {
+	for _, p := range current {
+		if v, ok := plan.tags[p][tag]; ok {
+			return v
+		}
+	}
+
+	best := ""
+	bestN := -1
+	seen := make(map[string]bool)
+	for _, p := range candidates {
+		v, ok := plan.tags[p][tag]
+		if !ok || seen[v] {
+			continue
+		}
+		seen[v] = true
+
+		trial := map[string]string{tag: v}
+		for t, tv := range same {
+			trial[t] = tv
+		}
+		n := len(plan.selectWithSame(current, candidates, wanted, trial, false))
+		if n >= wanted {
+			return v
+		}
+		if n > bestN {
+			best, bestN = v, n
+		}
+	}
+	return best
+}
+
+// values returns the sorted values of the given tag among the allowed peers.
+func (plan *placementPlan) values(tag string) []string {
+	seen := make(map[string]bool)
+	var values []string
+	for _, tags := range plan.tags {
+		v, ok := tags[tag]
+		if !ok || seen[v] || !plan.rules.Allows(tags) {
+			continue
+		}
+		seen[v] = true
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	return values
+}
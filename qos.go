@@ -0,0 +1,174 @@
+package ipfscluster
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"go.opencensus.io/trace"
+)
+
+// Names of the alerts recorded for pins of QoS classes with Alert set.
+const (
+	qosPinErrorAlertName    = "qos_pin_error"
+	qosReplicaLostAlertName = "qos_replica_lost"
+)
+
+// qosClass returns the QoS class with the given name, or an empty class
+// with the default settings.
+func (c *Cluster) qosClass(name string) *api.QoSClass {
+	if qc, ok := c.config.QoSClasses[name]; ok {
+		return qc
+	}
+	return &api.QoSClass{}
+}
+
+// qosAlerts returns true when any of the QoS classes has Alert set.
+func (c *Cluster) qosAlerts() bool {
+	for _, qc := range c.config.QoSClasses {
+		if qc.Alert {
+			return true
+		}
+	}
+	return false
+}
+
+type qosAlertKey struct {
+	name string
+	peer peer.ID
+	cid  cid.Cid
+}
+
+// recordQoSAlert records an alert about the given pin and peer, unless it
+// was recorded already and not cleared since.
+func (c *Cluster) recordQoSAlert(name string, p peer.ID, pin *api.Pin) {
+	key := qosAlertKey{name: name, peer: p, cid: pin.Cid}
+	c.qosAlertedMux.Lock()
+	_, ok := c.qosAlerted[key]
+	c.qosAlerted[key] = struct{}{}
+	c.qosAlertedMux.Unlock()
+	if ok {
+		return
+	}
+
+	c.recordAlert(&api.Alert{
+		Metric: api.Metric{
+			Name:  name,
+			Peer:  p,
+			Value: pin.Cid.String(),
+			Valid: true,
+		},
+		TriggeredAt: time.Now(),
+	})
+}
+
+// clearQoSAlerts forgets the alerts with the given name and peer, except
+// those about the items to keep, so that they are recorded again when the
+// problem happens again.
+func (c *Cluster) clearQoSAlerts(name string, p peer.ID, keep map[cid.Cid]struct{}) {
+	c.qosAlertedMux.Lock()
+	defer c.qosAlertedMux.Unlock()
+	for key := range c.qosAlerted {
+		if key.name != name || key.peer != p {
+			continue
+		}
+		if _, ok := keep[key.cid]; !ok {
+			delete(c.qosAlerted, key)
+		}
+	}
+}
+
+// reallocateFromDownPeer re-allocates the given pins away from a peer that
+// went down, as their QoS classes say: right away or, for classes with a
+// ReallocationDelay, only if the peer is still down when it expires.
+func (c *Cluster) reallocateFromDownPeer(p peer.ID, pins []*api.Pin) {
+	delayed := make(map[time.Duration][]*api.Pin)
+	for _, pin := range pins {
+		qc := c.qosClass(pin.QoSClass)
+		if qc.Alert {
+			c.recordQoSAlert(qosReplicaLostAlertName, p, pin)
+		}
+		if qc.ReallocationDelay <= 0 {
+			c.reallocate(p, pin)
+			continue
+		}
+		delayed[qc.ReallocationDelay] = append(delayed[qc.ReallocationDelay], pin)
+	}
+
+	for delay, pins := range delayed {
+		c.wg.Add(1)
+		go c.reallocateAfter(delay, p, pins)
+	}
+}
+
+// reallocateAfter waits for the given delay and re-allocates the given pins
+// away from the given peer, unless it came back or they were re-allocated
+// in the meantime.
+func (c *Cluster) reallocateAfter(delay time.Duration, p peer.ID, pins []*api.Pin) {
+	defer c.wg.Done()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-c.ctx.Done():
+		return
+	case <-timer.C:
+	}
+
+	ctx, span := trace.StartSpan(c.ctx, "cluster/reallocateAfter")
+	defer span.End()
+
+	for _, m := range c.monitor.LatestMetrics(ctx, pingMetricName) {
+		if m.Peer == p && !m.Expired() {
+			logger.Infof("%s is back: not re-allocating %d delayed pins", p, len(pins))
+			return
+		}
+	}
+
+	cState, err := c.consensus.State(ctx)
+	if err != nil {
+		logger.Warn(err)
+		return
+	}
+	for _, pin := range pins {
+		current, err := cState.Get(ctx, pin.Cid)
+		if err != nil || !containsPeer(current.Allocations, p) {
+			continue
+		}
+		c.reallocate(p, current)
+	}
+}
+
+// alertQoSErrors records alerts for the pins in error on this peer whose QoS
+// class has Alert set. Pins are alerted about once while they stay in
+// error.
+func (c *Cluster) alertQoSErrors(ctx context.Context) {
+	ctx, span := trace.StartSpan(ctx, "cluster/alertQoSErrors")
+	defer span.End()
+
+	if !c.qosAlerts() {
+		return
+	}
+
+	cState, err := c.consensus.State(ctx)
+	if err != nil {
+		logger.Warn(err)
+		return
+	}
+	inError := make(map[cid.Cid]struct{})
+	for _, pi := range c.tracker.StatusAll(ctx, api.TrackerStatusPinError) {
+		pin, err := cState.Get(ctx, pi.Cid)
+		if err != nil {
+			continue
+		}
+		if c.qosClass(pin.QoSClass).Alert {
+			inError[pin.Cid] = struct{}{}
+			c.recordQoSAlert(qosPinErrorAlertName, c.id, pin)
+		}
+	}
+	c.clearQoSAlerts(qosPinErrorAlertName, c.id, inError)
+}
@@ -0,0 +1,233 @@
+package ipfscluster
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"go.opencensus.io/trace"
+)
+
+var (
+	// reallocationSlotWindow is how often the reallocation slots rotate
+	// among peers when there are fewer slots than peers. A reallocation
+	// holds its slot until it finishes or the window it was started in
+	// ends, so a slot is free by the time it moves to another peer.
+	reallocationSlotWindow = 10 * time.Minute
+	// reallocationCheckInterval is how often we check whether in-flight
+	// reallocations have finished.
+	reallocationCheckInterval = 5 * time.Second
+	// maxQueuedReallocations is the maximum number of reallocations
+	// waiting for a slot in a peer. Further ones are dropped until the
+	// queue drains.
+	maxQueuedReallocations = 10000
+)
+
+type reallocation struct {
+	from peer.ID
+	pin  *api.Pin
+}
+
+// reallocationShare returns how many of the cluster-wide reallocation slots
+// belong to the given peer. Slots are spread evenly over the sorted list of
+// peers and, when there are more peers than slots, the remainder rotates
+// every reallocationSlotWindow, so that every peer gets to make progress and
+// the sum of the shares never exceeds total.
+func reallocationShare(total int, peers []peer.ID, self peer.ID, now time.Time) int {
+	n := len(peers)
+	if n == 0 {
+		return total
+	}
+
+	sorted := make([]string, n)
+	for i, p := range peers {
+		sorted[i] = string(p)
+	}
+	sort.Strings(sorted)
+	idx := sort.SearchStrings(sorted, string(self))
+	if idx == n || sorted[idx] != string(self) {
+		return 0
+	}
+
+	share := total / n
+	rest := total % n
+	offset := int((now.UnixNano() / int64(reallocationSlotWindow)) % int64(n))
+	if (idx-offset+n)%n < rest {
+		share++
+	}
+	return share
+}
+
+// reallocationWindowEnd returns when the slot window containing the given
+// time ends.
+func reallocationWindowEnd(now time.Time) time.Time {
+	w := int64(reallocationSlotWindow)
+	return time.Unix(0, (now.UnixNano()/w+1)*w)
+}
+
+// reallocate re-allocates the given pin away from the given peer, queuing
+// the operation when MaxConcurrentReallocations is set. Pins of QoS classes
+// with high priority are queued before the rest. Pins already queued or
+// being re-allocated are ignored.
+func (c *Cluster) reallocate(p peer.ID, pin *api.Pin) {
+	if c.config.reloadable().MaxConcurrentReallocations <= 0 {
+		c.repinFromPeer(c.ctx, p, pin)
+		return
+	}
+
+	isHigh := func(pin *api.Pin) bool {
+		return c.qosClass(pin.QoSClass).Priority == api.QoSPriorityHigh
+	}
+
+	c.reallocMux.Lock()
+	if _, ok := c.reallocating[pin.Cid]; ok {
+		c.reallocMux.Unlock()
+		return
+	}
+	if len(c.reallocQueue) >= maxQueuedReallocations {
+		c.reallocMux.Unlock()
+		logger.Errorf("reallocation queue is full: not re-allocating %s away from %s", pin.Cid, p)
+		return
+	}
+	c.reallocating[pin.Cid] = struct{}{}
+	i := len(c.reallocQueue)
+	if isHigh(pin) {
+		i = 0
+		for i < len(c.reallocQueue) && isHigh(c.reallocQueue[i].pin) {
+			i++
+		}
+	}
+	c.reallocQueue = append(c.reallocQueue, reallocation{})
+	copy(c.reallocQueue[i+1:], c.reallocQueue[i:])
+	c.reallocQueue[i] = reallocation{from: p, pin: pin}
+	c.reallocMux.Unlock()
+
+	select {
+	case c.reallocCh <- struct{}{}:
+	default:
+	}
+}
+
+// watchReallocations launches queued reallocations as long as in-flight
+// ones do not exceed this peer's share of MaxConcurrentReallocations and
+// the peer is not in maintenance mode.
+func (c *Cluster) watchReallocations() {
+	inflightDone := make(chan struct{})
+	inflight := 0
+
+	ticker := time.NewTicker(reallocationCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-c.reallocCh:
+		case <-inflightDone:
+			inflight--
+		case <-ticker.C:
+		}
+
+		for !c.InMaintenance() {
+			slots := c.reallocationSlots(c.ctx)
+			if inflight >= slots {
+				break
+			}
+
+			c.reallocMux.Lock()
+			if len(c.reallocQueue) == 0 {
+				c.reallocMux.Unlock()
+				break
+			}
+			r := c.reallocQueue[0]
+			c.reallocQueue = c.reallocQueue[1:]
+			c.reallocMux.Unlock()
+
+			inflight++
+			deadline := reallocationWindowEnd(time.Now())
+			go func() {
+				c.runReallocation(c.ctx, r, deadline)
+				c.reallocMux.Lock()
+				delete(c.reallocating, r.pin.Cid)
+				c.reallocMux.Unlock()
+				select {
+				case inflightDone <- struct{}{}:
+				case <-c.ctx.Done():
+				}
+			}()
+		}
+	}
+}
+
+// reallocationSlots returns this peer's current share of the cluster-wide
+// reallocation limit.
+func (c *Cluster) reallocationSlots(ctx context.Context) int {
+	peers, err := c.consensus.Peers(ctx)
+	if err != nil {
+		logger.Error(err)
+		return 0
+	}
+	return reallocationShare(
+		c.config.reloadable().MaxConcurrentReallocations,
+		peers,
+		c.id,
+		time.Now(),
+	)
+}
+
+// runReallocation re-allocates an item and waits until it is pinned on all
+// its new allocations, it fails, or the deadline expires.
+func (c *Cluster) runReallocation(ctx context.Context, r reallocation, deadline time.Time) {
+	ctx, span := trace.StartSpan(ctx, "cluster/runReallocation")
+	defer span.End()
+
+	pin, ok := c.repinFromPeer(ctx, r.from, r.pin)
+	if !ok || len(pin.Allocations) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	ticker := time.NewTicker(reallocationCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				logger.Warnf("reallocation of %s is taking too long. Releasing its slot", pin.Cid)
+			}
+			return
+		case <-ticker.C:
+			gpi, err := c.Status(ctx, pin.Cid)
+			if err != nil {
+				logger.Error(err)
+				continue
+			}
+			if reallocationFinished(pin.Allocations, gpi) {
+				return
+			}
+		}
+	}
+}
+
+// reallocationFinished returns true when all the allocated peers have
+// either pinned the item, failed to do so or cannot be contacted.
+func reallocationFinished(allocs []peer.ID, gpi *api.GlobalPinInfo) bool {
+	for _, p := range allocs {
+		pi, ok := gpi.PeerMap[peer.Encode(p)]
+		if !ok {
+			return false
+		}
+		switch pi.Status {
+		case api.TrackerStatusPinned, api.TrackerStatusPinError, api.TrackerStatusClusterError:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,167 @@
+package ipfscluster
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"go.opencensus.io/trace"
+)
+
+// reprovideConcurrency is how many items are announced at the same time.
+var reprovideConcurrency = 8
+
+// watchReprovide announces the items allocated to this peer to the DHT when
+// the peer starts and every ReprovideInterval, following the
+// ReprovideStrategy.
+func (c *Cluster) watchReprovide() {
+	if c.config.ReprovideStrategy == ReprovideNone {
+		return
+	}
+
+	ticker := time.NewTicker(c.config.ReprovideInterval)
+	defer ticker.Stop()
+
+	now := time.Now()
+	for {
+		if c.InMaintenance() {
+			logger.Debug("maintenance mode: skipping reprovide")
+		} else {
+			c.reprovide(c.ctx, now)
+		}
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case now = <-ticker.C:
+		}
+	}
+}
+
+// reprovide announces the items which this peer is designated to reprovide
+// at the given time. It returns how many were announced.
+func (c *Cluster) reprovide(ctx context.Context, now time.Time) int {
+	ctx, span := trace.StartSpan(ctx, "cluster/reprovide")
+	defer span.End()
+
+	cState, err := c.consensus.State(ctx)
+	if err != nil {
+		logger.Error(err)
+		return 0
+	}
+	pins, err := cState.List(ctx)
+	if err != nil {
+		logger.Error(err)
+		return 0
+	}
+
+	var peers []peer.ID
+	var alive map[peer.ID]struct{}
+	if c.config.ReprovideStrategy == ReprovideRotate {
+		alive = c.alivePeers(ctx)
+	}
+	epoch := now.UnixNano() / int64(c.config.ReprovideInterval)
+
+	var n int64
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, reprovideConcurrency)
+	for _, p := range pins {
+		if ctx.Err() != nil {
+			break
+		}
+		if p.Type != api.DataType || p.IsRemotePin(c.id) {
+			continue
+		}
+
+		if c.config.ReprovideStrategy == ReprovideRotate {
+			candidates := p.Allocations
+			if len(candidates) == 0 { // pinned everywhere
+				if peers == nil {
+					peers, err = c.consensus.Peers(ctx)
+					if err != nil {
+						logger.Error(err)
+						break
+					}
+				}
+				candidates = peers
+			}
+			candidates = livePeers(candidates, alive)
+			if !containsPeer(reprovidePeers(p.Cid, candidates, c.config.ReprovidePeers, epoch), c.id) {
+				continue
+			}
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(ci cid.Cid) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := c.ipfs.Provide(ctx, ci); err != nil {
+				logger.Debugf("reprovide: %s: %s", ci, err)
+				return
+			}
+			atomic.AddInt64(&n, 1)
+		}(p.Cid)
+	}
+	wg.Wait()
+	logger.Infof("reprovide: announced %d items", n)
+	return int(n)
+}
+
+// alivePeers returns the peers whose last ping metric has not expired, and
+// this peer.
+func (c *Cluster) alivePeers(ctx context.Context) map[peer.ID]struct{} {
+	alive := map[peer.ID]struct{}{c.id: {}}
+	for _, m := range c.monitor.LatestMetrics(ctx, pingMetricName) {
+		if !m.Expired() {
+			alive[m.Peer] = struct{}{}
+		}
+	}
+	return alive
+}
+
+// livePeers returns the candidates which are alive, or all of them when
+// none is.
+func livePeers(candidates []peer.ID, alive map[peer.ID]struct{}) []peer.ID {
+	live := make([]peer.ID, 0, len(candidates))
+	for _, p := range candidates {
+		if _, ok := alive[p]; ok {
+			live = append(live, p)
+		}
+	}
+	if len(live) == 0 {
+		return candidates
+	}
+	return live
+}
+
+// reprovidePeers returns the n peers among the candidates which are
+// designated to reprovide the given CID during the given epoch. Every peer
+// computes the same choice from the shared state, and the designated peers
+// shift by one every epoch.
+func reprovidePeers(c cid.Cid, candidates []peer.ID, n int, epoch int64) []peer.ID {
+	if n >= len(candidates) {
+		return candidates
+	}
+
+	sorted := make([]peer.ID, len(candidates))
+	copy(sorted, candidates)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	h := fnv.New64a()
+	h.Write(c.Bytes())
+	start := (h.Sum64() + uint64(epoch)) % uint64(len(sorted))
+
+	designated := make([]peer.ID, 0, n)
+	for i := 0; i < n; i++ {
+		designated = append(designated, sorted[(start+uint64(i))%uint64(len(sorted))])
+	}
+	return designated
+}
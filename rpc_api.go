@@ -2,6 +2,8 @@ package ipfscluster
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/state"
@@ -73,7 +75,7 @@ func newRPCServer(c *Cluster) (*rpc.Server, error) {
 	if err != nil {
 		return nil, err
 	}
-	pt := &PinTrackerRPCAPI{c.tracker}
+	pt := &PinTrackerRPCAPI{c.tracker, c.oplog}
 	err = s.RegisterName(RPCServiceID(pt), pt)
 	if err != nil {
 		return nil, err
@@ -124,6 +126,7 @@ type ClusterRPCAPI struct {
 // peer API for the PinTracker component.
 type PinTrackerRPCAPI struct {
 	tracker PinTracker
+	oplog   *opLog
 }
 
 // IPFSConnectorRPCAPI is a go-libp2p-gorpc service which provides the
@@ -170,7 +173,7 @@ func (rpcapi *ClusterRPCAPI) Pin(ctx context.Context, in *api.Pin, out *api.Pin)
 
 // Unpin runs Cluster.Unpin().
 func (rpcapi *ClusterRPCAPI) Unpin(ctx context.Context, in *api.Pin, out *api.Pin) error {
-	pin, err := rpcapi.c.Unpin(ctx, in.Cid)
+	pin, err := rpcapi.c.unpin(ctx, in.Cid, api.ClientIdentity(ctx))
 	if err != nil {
 		return err
 	}
@@ -190,7 +193,17 @@ func (rpcapi *ClusterRPCAPI) PinPath(ctx context.Context, in *api.PinPath, out *
 
 // UnpinPath resolves path into a cid and runs Cluster.Unpin().
 func (rpcapi *ClusterRPCAPI) UnpinPath(ctx context.Context, in *api.PinPath, out *api.Pin) error {
-	pin, err := rpcapi.c.UnpinPath(ctx, in.Path)
+	pin, err := rpcapi.c.unpinPath(ctx, in.Path, api.ClientIdentity(ctx))
+	if err != nil {
+		return err
+	}
+	*out = *pin
+	return nil
+}
+
+// Update runs Cluster.Update().
+func (rpcapi *ClusterRPCAPI) Update(ctx context.Context, in *api.Pin, out *api.Pin) error {
+	pin, err := rpcapi.c.Update(ctx, in.Cid, in.PinOptions)
 	if err != nil {
 		return err
 	}
@@ -218,6 +231,26 @@ func (rpcapi *ClusterRPCAPI) PinGet(ctx context.Context, in cid.Cid, out *api.Pi
 	return nil
 }
 
+// PinsLinearizable runs Cluster.PinsLinearizable().
+func (rpcapi *ClusterRPCAPI) PinsLinearizable(ctx context.Context, in struct{}, out *[]*api.Pin) error {
+	cidList, err := rpcapi.c.PinsLinearizable(ctx)
+	if err != nil {
+		return err
+	}
+	*out = cidList
+	return nil
+}
+
+// PinGetLinearizable runs Cluster.PinGetLinearizable().
+func (rpcapi *ClusterRPCAPI) PinGetLinearizable(ctx context.Context, in cid.Cid, out *api.Pin) error {
+	pin, err := rpcapi.c.PinGetLinearizable(ctx, in)
+	if err != nil {
+		return err
+	}
+	*out = *pin
+	return nil
+}
+
 // Version runs Cluster.Version().
 func (rpcapi *ClusterRPCAPI) Version(ctx context.Context, in struct{}, out *api.Version) error {
 	*out = api.Version{
@@ -289,6 +322,96 @@ func (rpcapi *ClusterRPCAPI) Status(ctx context.Context, in cid.Cid, out *api.Gl
 	return nil
 }
 
+// StatusCids runs Cluster.StatusCids().
+func (rpcapi *ClusterRPCAPI) StatusCids(ctx context.Context, in []cid.Cid, out *[]*api.GlobalPinInfo) error {
+	pinfos, err := rpcapi.c.StatusCids(ctx, in)
+	if err != nil {
+		return err
+	}
+	*out = pinfos
+	return nil
+}
+
+// PinReceipt runs Cluster.PinReceipt().
+func (rpcapi *ClusterRPCAPI) PinReceipt(ctx context.Context, in cid.Cid, out *api.PinReceipt) error {
+	receipt, err := rpcapi.c.PinReceipt(ctx, in)
+	if err != nil {
+		return err
+	}
+	*out = *receipt
+	return nil
+}
+
+// DeletedPins runs Cluster.DeletedPins().
+func (rpcapi *ClusterRPCAPI) DeletedPins(ctx context.Context, in time.Time, out *[]*api.Tombstone) error {
+	tombstones, err := rpcapi.c.DeletedPins(ctx, in)
+	if err != nil {
+		return err
+	}
+	*out = tombstones
+	return nil
+}
+
+// DeletedPinsLocal runs Cluster.DeletedPinsLocal().
+func (rpcapi *ClusterRPCAPI) DeletedPinsLocal(ctx context.Context, in time.Time, out *[]*api.Tombstone) error {
+	tombstones, err := rpcapi.c.DeletedPinsLocal(ctx, in)
+	if err != nil {
+		return err
+	}
+	*out = tombstones
+	return nil
+}
+
+// AllocationsAudit runs Cluster.AllocationsAudit().
+func (rpcapi *ClusterRPCAPI) AllocationsAudit(ctx context.Context, in struct{}, out *[]*api.AllocationDecision) error {
+	decisions, err := rpcapi.c.AllocationsAudit(ctx)
+	if err != nil {
+		return err
+	}
+	*out = decisions
+	return nil
+}
+
+// OpLog runs Cluster.OpLog().
+func (rpcapi *ClusterRPCAPI) OpLog(ctx context.Context, in *api.OpLogRequest, out *api.OpLogPage) error {
+	page, err := rpcapi.c.OpLog(ctx, in.After, in.Limit, in.Wait)
+	if err != nil {
+		return err
+	}
+	*out = *page
+	return nil
+}
+
+// StateDigestLocal runs Cluster.stateDigest().
+func (rpcapi *ClusterRPCAPI) StateDigestLocal(ctx context.Context, in struct{}, out *api.StateDigest) error {
+	digest, err := rpcapi.c.stateDigest(ctx)
+	if err != nil {
+		return err
+	}
+	*out = *digest
+	return nil
+}
+
+// PinsDiff runs Cluster.PinsDiff().
+func (rpcapi *ClusterRPCAPI) PinsDiff(ctx context.Context, in peer.ID, out *api.PinsDiff) error {
+	diff, err := rpcapi.c.PinsDiff(ctx, in)
+	if err != nil {
+		return err
+	}
+	*out = *diff
+	return nil
+}
+
+// BlockHolders runs Cluster.BlockHolders().
+func (rpcapi *ClusterRPCAPI) BlockHolders(ctx context.Context, in *api.BlockHoldersRequest, out *[]peer.ID) error {
+	holders, err := rpcapi.c.BlockHolders(ctx, in.Cid, in.All)
+	if err != nil {
+		return err
+	}
+	*out = holders
+	return nil
+}
+
 // StatusLocal runs Cluster.StatusLocal().
 func (rpcapi *ClusterRPCAPI) StatusLocal(ctx context.Context, in cid.Cid, out *api.PinInfo) error {
 	pinfo := rpcapi.c.StatusLocal(ctx, in)
@@ -316,6 +439,16 @@ func (rpcapi *ClusterRPCAPI) RecoverAllLocal(ctx context.Context, in struct{}, o
 	return nil
 }
 
+// Sync runs Cluster.Sync().
+func (rpcapi *ClusterRPCAPI) Sync(ctx context.Context, in struct{}, out *api.SyncSummary) error {
+	summary, err := rpcapi.c.Sync(ctx)
+	if err != nil {
+		return err
+	}
+	*out = *summary
+	return nil
+}
+
 // Recover runs Cluster.Recover().
 func (rpcapi *ClusterRPCAPI) Recover(ctx context.Context, in cid.Cid, out *api.GlobalPinInfo) error {
 	pinfo, err := rpcapi.c.Recover(ctx, in)
@@ -336,10 +469,30 @@ func (rpcapi *ClusterRPCAPI) RecoverLocal(ctx context.Context, in cid.Cid, out *
 	return nil
 }
 
+// Verify runs Cluster.Verify().
+func (rpcapi *ClusterRPCAPI) Verify(ctx context.Context, in cid.Cid, out *api.GlobalPinInfo) error {
+	pinfo, err := rpcapi.c.Verify(ctx, in)
+	if err != nil {
+		return err
+	}
+	*out = *pinfo
+	return nil
+}
+
+// VerifyLocal runs Cluster.VerifyLocal().
+func (rpcapi *ClusterRPCAPI) VerifyLocal(ctx context.Context, in cid.Cid, out *api.PinInfo) error {
+	pinfo, err := rpcapi.c.VerifyLocal(ctx, in)
+	if err != nil {
+		return err
+	}
+	*out = *pinfo
+	return nil
+}
+
 // BlockAllocate returns allocations for blocks. This is used in the adders.
 // It's different from pin allocations when ReplicationFactor < 0.
 func (rpcapi *ClusterRPCAPI) BlockAllocate(ctx context.Context, in *api.Pin, out *[]peer.ID) error {
-	if rpcapi.c.config.FollowerMode {
+	if rpcapi.c.followerMode() {
 		return errFollowerMode
 	}
 
@@ -353,6 +506,12 @@ func (rpcapi *ClusterRPCAPI) BlockAllocate(ctx context.Context, in *api.Pin, out
 		return err
 	}
 
+	// Validated by setupPin.
+	if len(in.UserAllocations) > 0 {
+		*out = in.UserAllocations
+		return nil
+	}
+
 	// Return the current peer list.
 	if in.ReplicationFactorMin < 0 {
 		// Returned metrics are Valid and belong to current
@@ -373,8 +532,10 @@ func (rpcapi *ClusterRPCAPI) BlockAllocate(ctx context.Context, in *api.Pin, out
 		existing,
 		in.ReplicationFactorMin,
 		in.ReplicationFactorMax,
-		[]peer.ID{},        // blacklist
-		in.UserAllocations, // prio list
+		[]peer.ID{}, // blacklist
+		nil,         // prio list
+		in.EffectivePlacement(),
+		false,
 	)
 
 	if err != nil {
@@ -405,9 +566,50 @@ func (rpcapi *ClusterRPCAPI) RepoGCLocal(ctx context.Context, in struct{}, out *
 	return nil
 }
 
+// SLABreaches runs Cluster.SLABreaches().
+func (rpcapi *ClusterRPCAPI) SLABreaches(ctx context.Context, in struct{}, out *[]*api.PinSLABreach) error {
+	breaches, err := rpcapi.c.SLABreaches(ctx)
+	if err != nil {
+		return err
+	}
+	*out = breaches
+	return nil
+}
+
+// PinBatch runs Cluster.PinBatch().
+func (rpcapi *ClusterRPCAPI) PinBatch(ctx context.Context, in *api.PinBatch, out *api.PinBatchResult) error {
+	result, err := rpcapi.c.PinBatch(ctx, in)
+	if err != nil {
+		return err
+	}
+	*out = *result
+	return nil
+}
+
+// UnpinFilter runs Cluster.UnpinFilter().
+func (rpcapi *ClusterRPCAPI) UnpinFilter(ctx context.Context, in *api.UnpinFilter, out *api.UnpinFilterResult) error {
+	result, err := rpcapi.c.UnpinFilter(ctx, in)
+	if err != nil {
+		return err
+	}
+	*out = *result
+	return nil
+}
+
+// SetMaintenance runs Cluster.SetMaintenance().
+func (rpcapi *ClusterRPCAPI) SetMaintenance(ctx context.Context, in bool, out *struct{}) error {
+	return rpcapi.c.SetMaintenance(ctx, in)
+}
+
+// SetMaintenanceLocal runs Cluster.SetMaintenanceLocal().
+func (rpcapi *ClusterRPCAPI) SetMaintenanceLocal(ctx context.Context, in bool, out *struct{}) error {
+	rpcapi.c.SetMaintenanceLocal(ctx, in)
+	return nil
+}
+
 // SendInformerMetric runs Cluster.sendInformerMetric().
 func (rpcapi *ClusterRPCAPI) SendInformerMetrics(ctx context.Context, in struct{}, out *struct{}) error {
-	_, err := rpcapi.c.sendInformerMetrics(ctx, rpcapi.c.informers[0])
+	_, err := rpcapi.c.sendInformerMetrics(ctx, rpcapi.c.informers[0], nil)
 	if err != nil {
 		return err
 	}
@@ -426,21 +628,30 @@ func (rpcapi *ClusterRPCAPI) Alerts(ctx context.Context, in struct{}, out *[]api
 	return nil
 }
 
+// Health runs Cluster.Health().
+func (rpcapi *ClusterRPCAPI) Health(ctx context.Context, in struct{}, out *api.Health) error {
+	*out = *rpcapi.c.Health(ctx)
+	return nil
+}
+
 /*
    Tracker component methods
 */
 
-// Track runs PinTracker.Track().
+// Track records the pin in the operation log and runs PinTracker.Track().
 func (rpcapi *PinTrackerRPCAPI) Track(ctx context.Context, in *api.Pin, out *struct{}) error {
 	ctx, span := trace.StartSpan(ctx, "rpc/tracker/Track")
 	defer span.End()
+	rpcapi.oplog.recordPin(in)
 	return rpcapi.tracker.Track(ctx, in)
 }
 
-// Untrack runs PinTracker.Untrack().
+// Untrack records the unpin in the operation log and runs
+// PinTracker.Untrack().
 func (rpcapi *PinTrackerRPCAPI) Untrack(ctx context.Context, in *api.Pin, out *struct{}) error {
 	ctx, span := trace.StartSpan(ctx, "rpc/tracker/Untrack")
 	defer span.End()
+	rpcapi.oplog.recordUnpin(in.Cid)
 	return rpcapi.tracker.Untrack(ctx, in.Cid)
 }
 
@@ -461,6 +672,23 @@ func (rpcapi *PinTrackerRPCAPI) Status(ctx context.Context, in cid.Cid, out *api
 	return nil
 }
 
+// StatusCids runs PinTracker.StatusCids(), or PinTracker.Status() for every
+// Cid when the tracker does not provide it.
+func (rpcapi *PinTrackerRPCAPI) StatusCids(ctx context.Context, in []cid.Cid, out *[]*api.PinInfo) error {
+	ctx, span := trace.StartSpan(ctx, "rpc/tracker/StatusCids")
+	defer span.End()
+	if st, ok := rpcapi.tracker.(StatusCidsPinTracker); ok {
+		*out = st.StatusCids(ctx, in)
+		return nil
+	}
+	pinfos := make([]*api.PinInfo, len(in))
+	for i, c := range in {
+		pinfos[i] = rpcapi.tracker.Status(ctx, c)
+	}
+	*out = pinfos
+	return nil
+}
+
 // RecoverAll runs PinTracker.RecoverAll().f
 func (rpcapi *PinTrackerRPCAPI) RecoverAll(ctx context.Context, in struct{}, out *[]*api.PinInfo) error {
 	ctx, span := trace.StartSpan(ctx, "rpc/tracker/RecoverAll")
@@ -482,6 +710,42 @@ func (rpcapi *PinTrackerRPCAPI) Recover(ctx context.Context, in cid.Cid, out *ap
 	return err
 }
 
+// SetPinProgress runs PinTracker.SetPinProgress(), when the tracker reports
+// pin progress.
+func (rpcapi *PinTrackerRPCAPI) SetPinProgress(ctx context.Context, in *api.PinProgress, out *struct{}) error {
+	ctx, span := trace.StartSpan(ctx, "rpc/tracker/SetPinProgress")
+	defer span.End()
+	if pt, ok := rpcapi.tracker.(ProgressPinTracker); ok {
+		pt.SetPinProgress(ctx, in.Cid, in.Blocks)
+	}
+	return nil
+}
+
+// QueueDepth runs PinTracker.QueueDepth(), when the tracker reports it.
+func (rpcapi *PinTrackerRPCAPI) QueueDepth(ctx context.Context, in struct{}, out *int) error {
+	ctx, span := trace.StartSpan(ctx, "rpc/tracker/QueueDepth")
+	defer span.End()
+	qt, ok := rpcapi.tracker.(QueueDepthPinTracker)
+	if !ok {
+		return errors.New("the pin tracker does not report its queue depth")
+	}
+	*out = qt.QueueDepth(ctx)
+	return nil
+}
+
+// SLABreaches runs PinTracker.SLABreaches(), when the tracker checks pin
+// deadlines.
+func (rpcapi *PinTrackerRPCAPI) SLABreaches(ctx context.Context, in struct{}, out *[]*api.PinSLABreach) error {
+	ctx, span := trace.StartSpan(ctx, "rpc/tracker/SLABreaches")
+	defer span.End()
+	st, ok := rpcapi.tracker.(SLAPinTracker)
+	if !ok {
+		return errors.New("the pin tracker does not check pin deadlines")
+	}
+	*out = st.SLABreaches(ctx)
+	return nil
+}
+
 /*
    IPFS Connector component methods
 */
@@ -495,7 +759,7 @@ func (rpcapi *IPFSConnectorRPCAPI) Pin(ctx context.Context, in *api.Pin, out *st
 
 // Unpin runs IPFSConnector.Unpin().
 func (rpcapi *IPFSConnectorRPCAPI) Unpin(ctx context.Context, in *api.Pin, out *struct{}) error {
-	return rpcapi.ipfs.Unpin(ctx, in.Cid)
+	return rpcapi.ipfs.Unpin(ctx, in)
 }
 
 // PinLsCid runs IPFSConnector.PinLsCid().
@@ -563,6 +827,56 @@ func (rpcapi *IPFSConnectorRPCAPI) BlockGet(ctx context.Context, in cid.Cid, out
 	return nil
 }
 
+// SupportsCodec runs IPFSConnector.SupportsCodec().
+func (rpcapi *IPFSConnectorRPCAPI) SupportsCodec(ctx context.Context, in uint64, out *bool) error {
+	res, err := rpcapi.ipfs.SupportsCodec(ctx, in)
+	if err != nil {
+		return err
+	}
+	*out = res
+	return nil
+}
+
+// DAGSize runs IPFSConnector.DAGSize().
+func (rpcapi *IPFSConnectorRPCAPI) DAGSize(ctx context.Context, in cid.Cid, out *uint64) error {
+	size, err := rpcapi.ipfs.DAGSize(ctx, in)
+	if err != nil {
+		return err
+	}
+	*out = size
+	return nil
+}
+
+// MissingRefs runs IPFSConnector.MissingRefs().
+func (rpcapi *IPFSConnectorRPCAPI) MissingRefs(ctx context.Context, in cid.Cid, out *[]cid.Cid) error {
+	missing, err := rpcapi.ipfs.MissingRefs(ctx, in)
+	if err != nil {
+		return err
+	}
+	*out = missing
+	return nil
+}
+
+// FindProviders runs IPFSConnector.FindProviders().
+func (rpcapi *IPFSConnectorRPCAPI) FindProviders(ctx context.Context, in *api.FindProvidersRequest, out *[]peer.ID) error {
+	providers, err := rpcapi.ipfs.FindProviders(ctx, in.Cid, in.Count)
+	if err != nil {
+		return err
+	}
+	*out = providers
+	return nil
+}
+
+// BlockHas runs IPFSConnector.BlockHas().
+func (rpcapi *IPFSConnectorRPCAPI) BlockHas(ctx context.Context, in cid.Cid, out *bool) error {
+	res, err := rpcapi.ipfs.BlockHas(ctx, in)
+	if err != nil {
+		return err
+	}
+	*out = res
+	return nil
+}
+
 // Resolve runs IPFSConnector.Resolve().
 func (rpcapi *IPFSConnectorRPCAPI) Resolve(ctx context.Context, in string, out *cid.Cid) error {
 	c, err := rpcapi.ipfs.Resolve(ctx, in)
@@ -605,6 +919,73 @@ func (rpcapi *ConsensusRPCAPI) RmPeer(ctx context.Context, in peer.ID, out *stru
 	return rpcapi.cons.RmPeer(ctx, in)
 }
 
+// Compact runs Consensus.Compact().
+func (rpcapi *ConsensusRPCAPI) Compact(ctx context.Context, in struct{}, out *struct{}) error {
+	ctx, span := trace.StartSpan(ctx, "rpc/consensus/Compact")
+	defer span.End()
+	return rpcapi.cons.Compact(ctx)
+}
+
+// readIndexer is implemented by consensus components with a leader which
+// can provide the read index for linearizable reads.
+type readIndexer interface {
+	ReadIndex(context.Context) (uint64, error)
+}
+
+// ReadIndex runs Consensus.ReadIndex(), when the consensus component has it.
+func (rpcapi *ConsensusRPCAPI) ReadIndex(ctx context.Context, in struct{}, out *uint64) error {
+	ctx, span := trace.StartSpan(ctx, "rpc/consensus/ReadIndex")
+	defer span.End()
+
+	ri, ok := rpcapi.cons.(readIndexer)
+	if !ok {
+		return errors.New("the consensus component does not provide read indexes")
+	}
+	index, err := ri.ReadIndex(ctx)
+	if err != nil {
+		return err
+	}
+	*out = index
+	return nil
+}
+
+// syncLagger is implemented by consensus components which can tell how far
+// behind the rest of the peers they are.
+type syncLagger interface {
+	SyncLag(context.Context) (uint64, error)
+}
+
+// SyncLag runs Consensus.SyncLag(), when the consensus component has it.
+func (rpcapi *ConsensusRPCAPI) SyncLag(ctx context.Context, in struct{}, out *uint64) error {
+	ctx, span := trace.StartSpan(ctx, "rpc/consensus/SyncLag")
+	defer span.End()
+
+	sl, ok := rpcapi.cons.(syncLagger)
+	if !ok {
+		return errors.New("the consensus component does not report its sync lag")
+	}
+	lag, err := sl.SyncLag(ctx)
+	if err != nil {
+		return err
+	}
+	*out = lag
+	return nil
+}
+
+// Leader runs Consensus.Leader(). Leaderless consensus components return
+// an error of kind api.ErrorKindLeaderless.
+func (rpcapi *ConsensusRPCAPI) Leader(ctx context.Context, in struct{}, out *peer.ID) error {
+	ctx, span := trace.StartSpan(ctx, "rpc/consensus/Leader")
+	defer span.End()
+
+	leader, err := rpcapi.cons.Leader(ctx)
+	if err != nil {
+		return err
+	}
+	*out = leader
+	return nil
+}
+
 // Peers runs Consensus.Peers().
 func (rpcapi *ConsensusRPCAPI) Peers(ctx context.Context, in struct{}, out *[]peer.ID) error {
 	peers, err := rpcapi.cons.Peers(ctx)
@@ -625,8 +1006,31 @@ func (rpcapi *PeerMonitorRPCAPI) LatestMetrics(ctx context.Context, in string, o
 	return nil
 }
 
+// PeerMetricAll runs PeerMonitor.PeerMetricAll().
+func (rpcapi *PeerMonitorRPCAPI) PeerMetricAll(ctx context.Context, in *api.PeerMetricRequest, out *[]*api.Metric) error {
+	*out = rpcapi.mon.PeerMetricAll(ctx, in.Peer, in.Name)
+	return nil
+}
+
+// MetricsAt runs PeerMonitor.MetricsAt().
+func (rpcapi *PeerMonitorRPCAPI) MetricsAt(ctx context.Context, in *api.MetricsAtRequest, out *[]*api.Metric) error {
+	*out = rpcapi.mon.MetricsAt(ctx, in.Name, in.Time)
+	return nil
+}
+
 // MetricNames runs PeerMonitor.MetricNames().
 func (rpcapi *PeerMonitorRPCAPI) MetricNames(ctx context.Context, in struct{}, out *[]string) error {
 	*out = rpcapi.mon.MetricNames(ctx)
 	return nil
 }
+
+// RecentAlerts runs PeerMonitor.RecentAlerts().
+func (rpcapi *PeerMonitorRPCAPI) RecentAlerts(ctx context.Context, in time.Time, out *[]*api.Alert) error {
+	*out = rpcapi.mon.RecentAlerts(ctx, in)
+	return nil
+}
+
+// PeerLeft runs PeerMonitor.PeerLeft().
+func (rpcapi *PeerMonitorRPCAPI) PeerLeft(ctx context.Context, in peer.ID, out *struct{}) error {
+	return rpcapi.mon.PeerLeft(ctx, in)
+}
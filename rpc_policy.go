@@ -7,62 +7,100 @@ package ipfscluster
 // without missing any endpoint.
 var DefaultRPCPolicy = map[string]RPCEndpointType{
 	// Cluster methods
+	"Cluster.Alerts":               RPCClosed,
+	"Cluster.AllocationsAudit":     RPCClosed,
 	"Cluster.BlockAllocate":        RPCClosed,
+	"Cluster.BlockHolders":         RPCClosed,
 	"Cluster.ConnectGraph":         RPCClosed,
+	"Cluster.DeletedPins":          RPCClosed,
+	"Cluster.DeletedPinsLocal":     RPCTrusted, // Called in broadcast from DeletedPins()
+	"Cluster.Health":               RPCClosed,
 	"Cluster.ID":                   RPCOpen,
 	"Cluster.Join":                 RPCClosed,
+	"Cluster.OpLog":                RPCClosed,
 	"Cluster.PeerAdd":              RPCOpen, // Used by Join()
 	"Cluster.PeerRemove":           RPCTrusted,
 	"Cluster.Peers":                RPCTrusted, // Used by ConnectGraph()
 	"Cluster.Pin":                  RPCClosed,
+	"Cluster.PinBatch":             RPCClosed,
 	"Cluster.PinGet":               RPCClosed,
+	"Cluster.PinGetLinearizable":   RPCClosed,
 	"Cluster.PinPath":              RPCClosed,
-	"Cluster.Pins":                 RPCClosed, // Used in stateless tracker, ipfsproxy, restapi
+	"Cluster.PinReceipt":           RPCClosed,
+	"Cluster.Pins":                 RPCTrusted, // Used in stateless tracker, ipfsproxy, restapi and by PinsDiff()
+	"Cluster.PinsDiff":             RPCClosed,
+	"Cluster.PinsLinearizable":     RPCClosed,
 	"Cluster.Recover":              RPCClosed,
 	"Cluster.RecoverAll":           RPCClosed,
 	"Cluster.RecoverAllLocal":      RPCTrusted,
 	"Cluster.RecoverLocal":         RPCTrusted,
 	"Cluster.RepoGC":               RPCClosed,
 	"Cluster.RepoGCLocal":          RPCTrusted,
+	"Cluster.SLABreaches":          RPCClosed,
 	"Cluster.SendInformerMetrics":  RPCClosed,
 	"Cluster.SendInformersMetrics": RPCClosed,
-	"Cluster.Alerts":               RPCClosed,
+	"Cluster.SetMaintenance":       RPCClosed,
+	"Cluster.SetMaintenanceLocal":  RPCTrusted, // Called in broadcast from SetMaintenance()
+	"Cluster.StateDigestLocal":     RPCTrusted, // Called in broadcast from checkSplitBrain() and crdt drain()
 	"Cluster.Status":               RPCClosed,
 	"Cluster.StatusAll":            RPCClosed,
 	"Cluster.StatusAllLocal":       RPCClosed,
+	"Cluster.StatusCids":           RPCClosed,
 	"Cluster.StatusLocal":          RPCClosed,
+	"Cluster.Sync":                 RPCClosed,
 	"Cluster.Unpin":                RPCClosed,
+	"Cluster.UnpinFilter":          RPCClosed,
 	"Cluster.UnpinPath":            RPCClosed,
+	"Cluster.Update":               RPCClosed,
+	"Cluster.Verify":               RPCClosed,
+	"Cluster.VerifyLocal":          RPCTrusted, // Called in broadcast from Verify()
 	"Cluster.Version":              RPCOpen,
 
 	// PinTracker methods
-	"PinTracker.Recover":    RPCTrusted, // Called in broadcast from Recover()
-	"PinTracker.RecoverAll": RPCClosed,  // Broadcast in RecoverAll unimplemented
-	"PinTracker.Status":     RPCTrusted,
-	"PinTracker.StatusAll":  RPCTrusted,
-	"PinTracker.Track":      RPCClosed,
-	"PinTracker.Untrack":    RPCClosed,
+	"PinTracker.QueueDepth":     RPCClosed,
+	"PinTracker.Recover":        RPCTrusted, // Called in broadcast from Recover()
+	"PinTracker.RecoverAll":     RPCClosed,  // Broadcast in RecoverAll unimplemented
+	"PinTracker.SLABreaches":    RPCTrusted, // Called in broadcast from SLABreaches()
+	"PinTracker.SetPinProgress": RPCClosed,
+	"PinTracker.Status":         RPCTrusted,
+	"PinTracker.StatusAll":      RPCTrusted,
+	"PinTracker.StatusCids":     RPCTrusted,
+	"PinTracker.Track":          RPCClosed,
+	"PinTracker.Untrack":        RPCClosed,
 
 	// IPFSConnector methods
-	"IPFSConnector.BlockGet":   RPCClosed,
-	"IPFSConnector.BlockPut":   RPCTrusted, // Called from Add()
-	"IPFSConnector.ConfigKey":  RPCClosed,
-	"IPFSConnector.Pin":        RPCClosed,
-	"IPFSConnector.PinLs":      RPCClosed,
-	"IPFSConnector.PinLsCid":   RPCClosed,
-	"IPFSConnector.RepoStat":   RPCTrusted, // Called in broadcast from proxy/repo/stat
-	"IPFSConnector.Resolve":    RPCClosed,
-	"IPFSConnector.SwarmPeers": RPCTrusted, // Called in ConnectGraph
-	"IPFSConnector.Unpin":      RPCClosed,
+	"IPFSConnector.BlockGet":      RPCClosed,
+	"IPFSConnector.BlockHas":      RPCTrusted, // Called in broadcast from BlockHolders()
+	"IPFSConnector.BlockPut":      RPCTrusted, // Called from Add()
+	"IPFSConnector.ConfigKey":     RPCClosed,
+	"IPFSConnector.DAGSize":       RPCClosed,
+	"IPFSConnector.FindProviders": RPCClosed,
+	"IPFSConnector.MissingRefs":   RPCClosed,
+	"IPFSConnector.Pin":           RPCClosed,
+	"IPFSConnector.PinLs":         RPCClosed,
+	"IPFSConnector.PinLsCid":      RPCClosed,
+	"IPFSConnector.RepoStat":      RPCTrusted, // Called in broadcast from proxy/repo/stat
+	"IPFSConnector.Resolve":       RPCClosed,
+	"IPFSConnector.SupportsCodec": RPCTrusted, // Called in broadcast from allocate()
+	"IPFSConnector.SwarmPeers":    RPCTrusted, // Called in ConnectGraph
+	"IPFSConnector.Unpin":         RPCClosed,
 
 	// Consensus methods
-	"Consensus.AddPeer":  RPCTrusted, // Called by Raft/redirect to leader
-	"Consensus.LogPin":   RPCTrusted, // Called by Raft/redirect to leader
-	"Consensus.LogUnpin": RPCTrusted, // Called by Raft/redirect to leader
-	"Consensus.Peers":    RPCClosed,
-	"Consensus.RmPeer":   RPCTrusted, // Called by Raft/redirect to leader
+	"Consensus.AddPeer":   RPCTrusted, // Called by Raft/redirect to leader
+	"Consensus.Compact":   RPCClosed,
+	"Consensus.Leader":    RPCClosed,
+	"Consensus.LogPin":    RPCTrusted, // Called by Raft/redirect to leader
+	"Consensus.LogUnpin":  RPCTrusted, // Called by Raft/redirect to leader
+	"Consensus.Peers":     RPCClosed,
+	"Consensus.ReadIndex": RPCTrusted, // Called by Raft followers for linearizable reads
+	"Consensus.RmPeer":    RPCTrusted, // Called by Raft/redirect to leader
+	"Consensus.SyncLag":   RPCClosed,
 
 	// PeerMonitor methods
 	"PeerMonitor.LatestMetrics": RPCClosed,
 	"PeerMonitor.MetricNames":   RPCClosed,
+	"PeerMonitor.MetricsAt":     RPCClosed,
+	"PeerMonitor.PeerLeft":      RPCTrusted, // Called in broadcast from PeerRemove() and Shutdown()
+	"PeerMonitor.PeerMetricAll": RPCClosed,
+	"PeerMonitor.RecentAlerts":  RPCClosed,
 }
@@ -24,20 +24,25 @@ func rpcTypeStr(t cluster.RPCEndpointType) string {
 }
 
 var comments = map[string]string{
-	"Cluster.PeerAdd":          "Used by Join()",
-	"Cluster.Peers":            "Used by ConnectGraph()",
-	"Cluster.Pins":             "Used in stateless tracker, ipfsproxy, restapi",
-	"PinTracker.Recover":       "Called in broadcast from Recover()",
-	"PinTracker.RecoverAll":    "Broadcast in RecoverAll unimplemented",
-	"Pintracker.Status":        "Called in broadcast from Status()",
-	"Pintracker.StatusAll":     "Called in broadcast from StatusAll()",
-	"IPFSConnector.BlockPut":   "Called from Add()",
-	"IPFSConnector.RepoStat":   "Called in broadcast from proxy/repo/stat",
-	"IPFSConnector.SwarmPeers": "Called in ConnectGraph",
-	"Consensus.AddPeer":        "Called by Raft/redirect to leader",
-	"Consensus.LogPin":         "Called by Raft/redirect to leader",
-	"Consensus.LogUnpin":       "Called by Raft/redirect to leader",
-	"Consensus.RmPeer":         "Called by Raft/redirect to leader",
+	"Cluster.PeerAdd":             "Used by Join()",
+	"Cluster.Peers":               "Used by ConnectGraph()",
+	"Cluster.Pins":                "Used in stateless tracker, ipfsproxy, restapi",
+	"Cluster.SetMaintenanceLocal": "Called in broadcast from SetMaintenance()",
+	"Cluster.StateDigestLocal":    "Called in broadcast from checkSplitBrain() and crdt drain()",
+	"PinTracker.Recover":          "Called in broadcast from Recover()",
+	"PinTracker.RecoverAll":       "Broadcast in RecoverAll unimplemented",
+	"Pintracker.Status":           "Called in broadcast from Status()",
+	"Pintracker.StatusAll":        "Called in broadcast from StatusAll()",
+	"IPFSConnector.BlockPut":      "Called from Add()",
+	"IPFSConnector.BlockHas":      "Called in broadcast from BlockHolders()",
+	"IPFSConnector.RepoStat":      "Called in broadcast from proxy/repo/stat",
+	"IPFSConnector.SupportsCodec": "Called in broadcast from allocate()",
+	"IPFSConnector.SwarmPeers":    "Called in ConnectGraph",
+	"Consensus.AddPeer":           "Called by Raft/redirect to leader",
+	"Consensus.LogPin":            "Called by Raft/redirect to leader",
+	"Consensus.LogUnpin":          "Called by Raft/redirect to leader",
+	"Consensus.RmPeer":            "Called by Raft/redirect to leader",
+	"PeerMonitor.PeerLeft":        "Called in broadcast from PeerRemove() and Shutdown()",
 }
 
 func main() {
@@ -0,0 +1,87 @@
+package rpcutil
+
+import (
+	"context"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+)
+
+// StatusPageSize is how many items StatusAllPaged asks the status of in a
+// single request.
+var StatusPageSize = 100
+
+// StatusAllPaged calls fn with the status of every item in the pinset which
+// matches the filter, like Cluster.StatusAll, as it is received. The status
+// is requested StatusPageSize items at a time, so the statuses of the whole
+// pinset are never held in memory. With local, only the status on the peer
+// itself is included, like Cluster.StatusAllLocal. Items which are no longer
+// in the pinset, like those being unpinned, are not included.
+//
+// It stops and returns the error when a request or fn fails, after the items
+// of the previous pages were passed to fn.
+func StatusAllPaged(ctx context.Context, client *rpc.Client, filter api.TrackerStatus, local bool, fn func(*api.GlobalPinInfo) error) error {
+	var pins []*api.Pin
+	err := client.CallContext(ctx, "", "Cluster", "Pins", struct{}{}, &pins)
+	if err != nil {
+		return err
+	}
+
+	for len(pins) > 0 {
+		n := StatusPageSize
+		if n <= 0 || n > len(pins) {
+			n = len(pins)
+		}
+		cids := make([]cid.Cid, n)
+		for i, p := range pins[:n] {
+			cids[i] = p.Cid
+		}
+		pins = pins[n:]
+
+		page, err := statusPage(ctx, client, cids, local)
+		if err != nil {
+			return err
+		}
+		for _, gpi := range page {
+			if !MatchesFilter(gpi, filter) {
+				continue
+			}
+			if err := fn(gpi); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func statusPage(ctx context.Context, client *rpc.Client, cids []cid.Cid, local bool) ([]*api.GlobalPinInfo, error) {
+	if !local {
+		var gpis []*api.GlobalPinInfo
+		err := client.CallContext(ctx, "", "Cluster", "StatusCids", cids, &gpis)
+		return gpis, err
+	}
+
+	var pinInfos []*api.PinInfo
+	err := client.CallContext(ctx, "", "PinTracker", "StatusCids", cids, &pinInfos)
+	if err != nil {
+		return nil, err
+	}
+	gpis := make([]*api.GlobalPinInfo, len(pinInfos))
+	for i, pi := range pinInfos {
+		gpis[i] = pi.ToGlobal()
+	}
+	return gpis, nil
+}
+
+// MatchesFilter returns true when the status of the item in any of the
+// peers matches the filter, like the items returned by StatusAll.
+func MatchesFilter(gpi *api.GlobalPinInfo, filter api.TrackerStatus) bool {
+	for _, pi := range gpi.PeerMap {
+		if pi.Status.Match(filter) {
+			return true
+		}
+	}
+	return false
+}
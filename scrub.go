@@ -0,0 +1,134 @@
+package ipfscluster
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"go.opencensus.io/trace"
+)
+
+// scrubAlertName is the name of the alerts recorded for replicas which fail
+// the integrity check.
+const scrubAlertName = "scrub_failed"
+
+// watchScrub checks, every ScrubInterval, that a sample of ScrubBatchSize
+// pins is present on the peers which report having pinned it.
+func (c *Cluster) watchScrub() {
+	interval := c.config.ScrubInterval
+	if interval <= 0 || c.followerMode() {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			if c.InMaintenance() {
+				logger.Debug("maintenance mode: skipping scrub")
+				continue
+			}
+			c.scrub(c.ctx)
+		}
+	}
+}
+
+// scrub checks a random sample of the pins for which this peer is the
+// closest among the trusted peers, so that every pin is checked by a single
+// peer.
+func (c *Cluster) scrub(ctx context.Context) {
+	ctx, span := trace.StartSpan(ctx, "cluster/scrub")
+	defer span.End()
+
+	cState, err := c.consensus.State(ctx)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	pins, err := cState.List(ctx)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	distance, err := c.distances(ctx, "")
+	if err != nil {
+		return
+	}
+
+	var sample []*api.Pin
+	for _, p := range pins {
+		if p.Type == api.DataType && distance.isClosest(p.Cid) {
+			sample = append(sample, p)
+		}
+	}
+	rand.Shuffle(len(sample), func(i, j int) {
+		sample[i], sample[j] = sample[j], sample[i]
+	})
+	if len(sample) > c.config.ScrubBatchSize {
+		sample = sample[:c.config.ScrubBatchSize]
+	}
+
+	for _, p := range sample {
+		if ctx.Err() != nil {
+			return
+		}
+		c.scrubPin(ctx, p)
+	}
+}
+
+// scrubPin verifies (see Verify) the given pin on the peers allocated to it,
+// and re-allocates the pin away from those which report it as pinned while
+// blocks of its DAG are missing (unless repinning is disabled). Peers which
+// cannot be checked are skipped. It returns the failed peers.
+func (c *Cluster) scrubPin(ctx context.Context, pin *api.Pin) []peer.ID {
+	ctx, span := trace.StartSpan(ctx, "cluster/scrubPin")
+	defer span.End()
+
+	gpi, err := c.Verify(ctx, pin.Cid)
+	if err != nil {
+		logger.Warnf("scrub: cannot verify %s: %s", pin.Cid, err)
+		return nil
+	}
+
+	var failed []peer.ID
+	for pidStr, pi := range gpi.PeerMap {
+		if pi.Status == api.TrackerStatusClusterError {
+			logger.Debugf("scrub: skipping %s, which could not verify %s: %s", pidStr, pin.Cid, pi.Error)
+			continue
+		}
+		if pi.Status != api.TrackerStatusPinDegraded {
+			continue
+		}
+		pid, err := peer.Decode(pidStr)
+		if err != nil {
+			continue
+		}
+		failed = append(failed, pid)
+	}
+
+	for _, p := range failed {
+		logger.Errorf("scrub: %s reports %s as pinned but blocks are missing", p, pin.Cid)
+		c.recordAlert(&api.Alert{
+			Metric: api.Metric{
+				Name:  scrubAlertName,
+				Peer:  p,
+				Value: pin.Cid.String(),
+				Valid: true,
+			},
+			TriggeredAt: time.Now(),
+		})
+
+		if c.config.reloadable().DisableRepinning || pin.IsPinEverywhere() {
+			continue
+		}
+		c.reallocate(p, pin)
+	}
+	return failed
+}
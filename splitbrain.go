@@ -0,0 +1,256 @@
+package ipfscluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/rpcutil"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+	"go.opencensus.io/trace"
+)
+
+// splitBrainAlertName is the name of the alerts recorded for peers whose
+// view of the shared state diverges from ours.
+const splitBrainAlertName = "split_brain"
+
+// watchSplitBrain compares, every SplitBrainCheckInterval, the view of the
+// shared state that this peer has with that of the rest.
+func (c *Cluster) watchSplitBrain() {
+	interval := c.config.SplitBrainCheckInterval
+	if interval <= 0 || c.followerMode() {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var suspect string
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			suspect = c.checkSplitBrain(c.ctx, suspect)
+		}
+	}
+}
+
+// checkSplitBrain asks all peers for their state digest and returns a
+// fingerprint of the divergences found. Since digests differ for a while
+// every time the state is updated, divergences are only reported, and
+// reconciliation triggered, when they match those found in the previous
+// check (given as suspect). Reconciliation is not triggered in maintenance
+// mode.
+func (c *Cluster) checkSplitBrain(ctx context.Context, suspect string) string {
+	ctx, span := trace.StartSpan(ctx, "cluster/checkSplitBrain")
+	defer span.End()
+
+	self, err := c.stateDigest(ctx)
+	if err != nil {
+		logger.Error(err)
+		return ""
+	}
+
+	diverged := divergedPeers(self, c.stateDigests(ctx))
+	if len(diverged) == 0 {
+		return ""
+	}
+
+	fingerprint := splitBrainFingerprint(self, diverged)
+	if fingerprint != suspect {
+		return fingerprint
+	}
+
+	for _, d := range diverged {
+		logger.Errorf(
+			"split brain: %s has state digest %s (leader %q) while we have %s (leader %q)",
+			d.Peer, d.Digest, d.Leader, self.Digest, self.Leader,
+		)
+		c.recordAlert(&api.Alert{
+			Metric: api.Metric{
+				Name:  splitBrainAlertName,
+				Peer:  d.Peer,
+				Value: d.Digest,
+				Valid: true,
+			},
+			TriggeredAt: time.Now(),
+		})
+	}
+
+	if c.InMaintenance() {
+		logger.Debug("maintenance mode: skipping Reconcile()")
+		return fingerprint
+	}
+	if err := c.consensus.Reconcile(ctx); err != nil {
+		logger.Errorf("reconciling the shared state: %s", err)
+	}
+	return fingerprint
+}
+
+// stateDigests returns the state digests of all the peers that answered.
+func (c *Cluster) stateDigests(ctx context.Context) []*api.StateDigest {
+	members, err := c.consensus.Peers(ctx)
+	if err != nil {
+		logger.Error(err)
+		return nil
+	}
+	lenMembers := len(members)
+
+	digests := make([]*api.StateDigest, lenMembers)
+	ifaces := make([]interface{}, lenMembers)
+	for i := range digests {
+		digests[i] = &api.StateDigest{}
+		ifaces[i] = digests[i]
+	}
+
+	ctxs, cancels := rpcutil.CtxsWithTimeout(ctx, lenMembers, 15*time.Second)
+	defer rpcutil.MultiCancel(cancels)
+
+	errs := c.rpcClient.MultiCall(
+		ctxs,
+		members,
+		"Cluster",
+		"StateDigestLocal",
+		struct{}{},
+		ifaces,
+	)
+
+	result := make([]*api.StateDigest, 0, lenMembers)
+	for i, err := range errs {
+		if err != nil {
+			if !rpc.IsAuthorizationError(err) {
+				logger.Debugf("error getting state digest from %s: %s", members[i], err)
+			}
+			continue
+		}
+		result = append(result, digests[i])
+	}
+	return result
+}
+
+// stateDigest returns the digest of the shared state as seen by this peer,
+// as given by the consensus component.
+func (c *Cluster) stateDigest(ctx context.Context) (*api.StateDigest, error) {
+	ctx, span := trace.StartSpan(ctx, "cluster/stateDigest")
+	defer span.End()
+
+	digest, err := c.consensus.Digest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Consensus components without a leader return an error.
+	leader, _ := c.consensus.Leader(ctx)
+
+	return &api.StateDigest{
+		Peer:   c.id,
+		Digest: digest,
+		Leader: leader,
+	}, nil
+}
+
+// PinsDiff compares the shared state as seen by this peer with the one seen
+// by the given peer. When the latter cannot be fetched, the diff comes back
+// empty with its Error set.
+func (c *Cluster) PinsDiff(ctx context.Context, pid peer.ID) (*api.PinsDiff, error) {
+	_, span := trace.StartSpan(ctx, "cluster/PinsDiff")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	local, err := c.Pins(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var remote []*api.Pin
+	err = c.rpcClient.CallContext(
+		ctx,
+		pid,
+		"Cluster",
+		"Pins",
+		struct{}{},
+		&remote,
+	)
+	if err != nil {
+		logger.Warnf("error fetching the pinset of %s: %s", pid, err)
+		return &api.PinsDiff{
+			Peer:    pid,
+			Added:   []*api.Pin{},
+			Removed: []*api.Pin{},
+			Changed: []*api.Pin{},
+			Error:   err.Error(),
+		}, nil
+	}
+
+	diff := diffPins(local, remote)
+	diff.Peer = pid
+	return diff, nil
+}
+
+// diffPins returns the pins added, removed or changed in remote with respect
+// to local, sorted by cid.
+func diffPins(local, remote []*api.Pin) *api.PinsDiff {
+	remoteByCid := make(map[string]*api.Pin, len(remote))
+	for _, p := range remote {
+		remoteByCid[p.Cid.KeyString()] = p
+	}
+
+	diff := &api.PinsDiff{
+		Added:   []*api.Pin{},
+		Removed: []*api.Pin{},
+		Changed: []*api.Pin{},
+	}
+	for _, p := range local {
+		key := p.Cid.KeyString()
+		rp, ok := remoteByCid[key]
+		if !ok {
+			diff.Removed = append(diff.Removed, p)
+			continue
+		}
+		delete(remoteByCid, key)
+		if !p.Equals(rp) {
+			diff.Changed = append(diff.Changed, rp)
+		}
+	}
+	for _, rp := range remoteByCid {
+		diff.Added = append(diff.Added, rp)
+	}
+
+	for _, pins := range [][]*api.Pin{diff.Added, diff.Removed, diff.Changed} {
+		sort.Slice(pins, func(i, j int) bool {
+			return pins[i].Cid.KeyString() < pins[j].Cid.KeyString()
+		})
+	}
+	return diff
+}
+
+// divergedPeers returns the digests of the peers whose state differs from
+// ours or, when we have a leader, which follow a different leader or none
+// (i.e. a stranded Raft minority).
+func divergedPeers(self *api.StateDigest, digests []*api.StateDigest) []*api.StateDigest {
+	var diverged []*api.StateDigest
+	for _, d := range digests {
+		if d.Peer == self.Peer {
+			continue
+		}
+		if d.Digest != self.Digest || (self.Leader != "" && d.Leader != self.Leader) {
+			diverged = append(diverged, d)
+		}
+	}
+	return diverged
+}
+
+func splitBrainFingerprint(self *api.StateDigest, diverged []*api.StateDigest) string {
+	parts := make([]string, 0, len(diverged))
+	for _, d := range diverged {
+		parts = append(parts, fmt.Sprintf("%s:%s:%s", peer.Encode(d.Peer), d.Digest, d.Leader))
+	}
+	sort.Strings(parts)
+	return self.Digest + "|" + strings.Join(parts, ",")
+}
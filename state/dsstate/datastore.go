@@ -4,7 +4,9 @@ package dsstate
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"sync"
 
 	"github.com/ipfs/ipfs-cluster/api"
 	"github.com/ipfs/ipfs-cluster/state"
@@ -21,6 +23,8 @@ import (
 
 var _ state.State = (*State)(nil)
 var _ state.BatchingState = (*BatchingState)(nil)
+var _ state.Iterator = (*State)(nil)
+var _ state.MetadataIndexer = (*State)(nil)
 
 var logger = logging.Logger("dsstate")
 
@@ -33,7 +37,16 @@ type State struct {
 	dsWrite     ds.Write
 	codecHandle codec.Handle
 	namespace   ds.Key
-	// version     int
+	index       *MetadataIndex
+	// indexUpdated is set when whoever writes the pins, and not the
+	// state, keeps the index up to date.
+	indexUpdated bool
+
+	// batching states index the pins written in a batch only once it is
+	// committed.
+	batching   bool
+	pendingMu  sync.Mutex
+	pendingIdx []cid.Cid
 }
 
 // DefaultHandle returns the codec handler of choice (Msgpack).
@@ -64,6 +77,22 @@ func New(dstore ds.Datastore, namespace string, handle codec.Handle) (*State, er
 	return st, nil
 }
 
+// SetMetadataIndex makes the state keep the given index up to date when
+// pins are added and removed, and use it in PinsByMetadata. Several states
+// on the same datastore can share an index.
+func (st *State) SetMetadataIndex(idx *MetadataIndex) {
+	st.index = idx
+	st.indexUpdated = false
+}
+
+// UseMetadataIndex makes the state use the given index in PinsByMetadata
+// without updating it, for indexes which are kept up to date by other means
+// (MetadataIndex.Update), so that pins are not indexed twice.
+func (st *State) UseMetadataIndex(idx *MetadataIndex) {
+	st.index = idx
+	st.indexUpdated = true
+}
+
 // Add adds a new Pin or replaces an existing one.
 func (st *State) Add(ctx context.Context, c *api.Pin) error {
 	_, span := trace.StartSpan(ctx, "state/dsstate/Add")
@@ -73,7 +102,11 @@ func (st *State) Add(ctx context.Context, c *api.Pin) error {
 	if err != nil {
 		return err
 	}
-	return st.dsWrite.Put(ctx, st.key(c.Cid), ps)
+	err = st.dsWrite.Put(ctx, st.key(c.Cid), ps)
+	if err != nil {
+		return err
+	}
+	return st.indexPin(ctx, c.Cid)
 }
 
 // Rm removes an existing Pin. It is a no-op when the
@@ -83,10 +116,10 @@ func (st *State) Rm(ctx context.Context, c cid.Cid) error {
 	defer span.End()
 
 	err := st.dsWrite.Delete(ctx, st.key(c))
-	if err == ds.ErrNotFound {
-		return nil
+	if err != nil && err != ds.ErrNotFound {
+		return err
 	}
-	return err
+	return st.indexPin(ctx, c)
 }
 
 // Get returns a Pin from the store and whether it
@@ -128,23 +161,33 @@ func (st *State) List(ctx context.Context) ([]*api.Pin, error) {
 	_, span := trace.StartSpan(ctx, "state/dsstate/List")
 	defer span.End()
 
+	var pins []*api.Pin
+	err := st.ForEach(ctx, func(p *api.Pin) error {
+		pins = append(pins, p)
+		return nil
+	})
+	return pins, err
+}
+
+// ForEach calls f with every Pin in the datastore, in no particular order,
+// holding only one of them in memory at a time. It stops at the first error
+// returned by f.
+func (st *State) ForEach(ctx context.Context, f func(*api.Pin) error) error {
 	q := query.Query{
 		Prefix: st.namespace.String(),
 	}
 
 	results, err := st.dsRead.Query(ctx, q)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer results.Close()
 
-	var pins []*api.Pin
-
 	total := 0
 	for r := range results.Next() {
 		if r.Error != nil {
 			logger.Errorf("error in query result: %s", r.Error)
-			return pins, r.Error
+			return r.Error
 		}
 		k := ds.NewKey(r.Key)
 		ci, err := st.unkey(k)
@@ -163,28 +206,98 @@ func (st *State) List(ctx context.Context) ([]*api.Pin, error) {
 			logger.Infof("Full pinset listing in progress: %d pins so far", total)
 		}
 		total++
-		pins = append(pins, p)
+		if err := f(p); err != nil {
+			return err
+		}
 	}
 	if total >= 500000 {
 		logger.Infof("Full pinset listing finished: %d pins", total)
 	}
+	return nil
+}
+
+// PinsByMetadata returns the pins whose metadata has the given value for
+// the given key. When the state has a MetadataIndex, it is used to find them
+// without listing all the pins.
+func (st *State) PinsByMetadata(ctx context.Context, key, value string) ([]*api.Pin, error) {
+	_, span := trace.StartSpan(ctx, "state/dsstate/PinsByMetadata")
+	defer span.End()
+
+	var pins []*api.Pin
+	if st.index == nil {
+		err := st.ForEach(ctx, func(p *api.Pin) error {
+			if v, ok := p.Metadata[key]; ok && v == value {
+				pins = append(pins, p)
+			}
+			return nil
+		})
+		return pins, err
+	}
+
+	if err := st.index.build(ctx, st); err != nil {
+		return nil, err
+	}
+	cids, err := st.index.cids(ctx, key, value)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range cids {
+		p, err := st.Get(ctx, c)
+		if err == state.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// skip entries which are stale because the pin is being
+		// updated.
+		if v, ok := p.Metadata[key]; !ok || v != value {
+			continue
+		}
+		pins = append(pins, p)
+	}
 	return pins, nil
 }
 
-// Migrate migrates an older state version to the current one.
-// This is a no-op for now.
+// indexPin updates the metadata index entries of the given cid, if the
+// state has an index, right away or when the batch is committed.
+func (st *State) indexPin(ctx context.Context, c cid.Cid) error {
+	if st.index == nil || st.indexUpdated {
+		return nil
+	}
+	if st.batching {
+		st.pendingMu.Lock()
+		st.pendingIdx = append(st.pendingIdx, c)
+		st.pendingMu.Unlock()
+		return nil
+	}
+	return st.index.reindex(ctx, st, c)
+}
+
+// Migrate reads a previous dump of the state, made with any supported
+// version, and adds it to the store in the current format. Unmarshal
+// already does this, so this is the same as calling it.
 func (st *State) Migrate(ctx context.Context, r io.Reader) error {
-	return nil
+	return st.Unmarshal(r)
 }
 
+// serialEntry is a key/value of a serialized state. The first entry is a
+// header which only carries the Version of the format: its key and value
+// are omitted so that it is not mistaken for an entry. Entries written
+// before versioning was introduced (version 1) have no header.
 type serialEntry struct {
-	Key   string `codec:"k"`
-	Value []byte `codec:"v"`
+	Key     string `codec:"k,omitempty"`
+	Value   []byte `codec:"v,omitempty"`
+	Version int    `codec:"ver,omitempty"`
 }
 
-// Marshal dumps the state to a writer. It does this by encoding every
-// key/value in the store. The keys are stored without the namespace part to
-// reduce the size of the snapshot.
+func (e *serialEntry) isHeader() bool {
+	return e.Key == "" && e.Version > 0
+}
+
+// Marshal dumps the state to a writer. It does this by encoding a header
+// with the format Version and then every key/value in the store. The keys
+// are stored without the namespace part to reduce the size of the snapshot.
 func (st *State) Marshal(w io.Writer) error {
 	q := query.Query{
 		Prefix: st.namespace.String(),
@@ -198,6 +311,12 @@ func (st *State) Marshal(w io.Writer) error {
 
 	enc := codec.NewEncoder(w, st.codecHandle)
 
+	err = enc.Encode(serialEntry{Version: Version})
+	if err != nil {
+		logger.Error(err)
+		return err
+	}
+
 	for r := range results.Next() {
 		if r.Error != nil {
 			logger.Errorf("error in query result: %s", r.Error)
@@ -222,21 +341,49 @@ func (st *State) Marshal(w io.Writer) error {
 // All the parsed key/values are added to the store. As of now,
 // Unmarshal does not empty the existing store from any values
 // before unmarshaling from the given reader.
+//
+// Dumps made with older versions of the format are upgraded by applying
+// the registered migrations in order. Dumps made with a newer version than
+// the one supported are rejected.
 func (st *State) Unmarshal(r io.Reader) error {
 	dec := codec.NewDecoder(r, st.codecHandle)
-	for {
+	version := 1
+	for first := true; ; first = false {
 		var entry serialEntry
 		if err := dec.Decode(&entry); err == io.EOF {
 			break
 		} else if err != nil {
 			return err
 		}
+		if first && entry.isHeader() {
+			version = entry.Version
+			if version > Version {
+				return fmt.Errorf("state version %d is newer than the supported version %d", version, Version)
+			}
+			continue
+		}
+		if version < Version {
+			if err := migrateEntry(version, &entry); err != nil {
+				return err
+			}
+		}
 		k := st.namespace.Child(ds.NewKey(entry.Key))
 		err := st.dsWrite.Put(context.Background(), k, entry.Value)
 		if err != nil {
 			logger.Error("error adding unmarshaled key to datastore:", err)
 			return err
 		}
+		if st.index == nil {
+			continue
+		}
+		c, err := st.unkey(k)
+		if err != nil {
+			logger.Warn("bad key (ignoring). key: ", k, "error: ", err)
+			continue
+		}
+		if err := st.indexPin(context.Background(), c); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -312,6 +459,7 @@ func NewBatching(dstore ds.Batching, namespace string, handle codec.Handle) (*Ba
 		dsWrite:     batch,
 		codecHandle: handle,
 		namespace:   ds.NewKey(namespace),
+		batching:    true,
 	}
 
 	bst := &BatchingState{}
@@ -324,5 +472,21 @@ func NewBatching(dstore ds.Batching, namespace string, handle codec.Handle) (*Ba
 func (bst *BatchingState) Commit(ctx context.Context) error {
 	_, span := trace.StartSpan(ctx, "state/dsstate/Commit")
 	defer span.End()
-	return bst.batch.Commit(ctx)
+	if err := bst.batch.Commit(ctx); err != nil {
+		return err
+	}
+
+	bst.pendingMu.Lock()
+	pending := bst.pendingIdx
+	bst.pendingIdx = nil
+	bst.pendingMu.Unlock()
+	if bst.index == nil {
+		return nil
+	}
+	for _, c := range pending {
+		if err := bst.index.reindex(ctx, bst.State, c); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -10,6 +10,7 @@ import (
 
 	cid "github.com/ipfs/go-cid"
 	peer "github.com/libp2p/go-libp2p-core/peer"
+	codec "github.com/ugorji/go/codec"
 )
 
 var testCid1, _ = cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmq")
@@ -19,8 +20,8 @@ var c = &api.Pin{
 	Cid:         testCid1,
 	Type:        api.DataType,
 	Allocations: []peer.ID{testPeerID1},
-	MaxDepth:    -1,
 	PinOptions: api.PinOptions{
+		MaxDepth:             -1,
 		ReplicationFactorMax: -1,
 		ReplicationFactorMin: -1,
 		Name:                 "test",
@@ -137,3 +138,82 @@ func TestMarshalUnmarshal(t *testing.T) {
 		t.Error("expected different cid")
 	}
 }
+
+func TestUnmarshalMigratesV1(t *testing.T) {
+	ctx := context.Background()
+	st := newState(t)
+	st.Add(ctx, c)
+
+	// version 1 dumps have no header.
+	buf := new(bytes.Buffer)
+	var v2 bytes.Buffer
+	err := st.Marshal(&v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := codec.NewDecoder(&v2, DefaultHandle())
+	enc := codec.NewEncoder(buf, DefaultHandle())
+	for {
+		var entry serialEntry
+		if err := dec.Decode(&entry); err != nil {
+			break
+		}
+		if !entry.isHeader() {
+			enc.Encode(entry)
+		}
+	}
+
+	migrated := 0
+	defer func(m Migration) { migrations[1] = m }(migrations[1])
+	migrations[1] = func(key string, value []byte) (string, []byte, error) {
+		migrated++
+		return migrateV1(key, value)
+	}
+
+	st2 := newState(t)
+	err = st2.Unmarshal(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated != 1 {
+		t.Errorf("expected the migration to run once; ran %d times", migrated)
+	}
+	get, err := st2.Get(ctx, c.Cid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if get.Name != c.Name {
+		t.Error("expected the migrated pin")
+	}
+}
+
+func TestMarshalHeader(t *testing.T) {
+	st := newState(t)
+	buf := new(bytes.Buffer)
+	err := st.Marshal(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var header map[string]interface{}
+	dec := codec.NewDecoder(buf, DefaultHandle())
+	if err := dec.Decode(&header); err != nil {
+		t.Fatal(err)
+	}
+	if len(header) != 1 || header["ver"] == nil {
+		t.Errorf("expected a header with the version only: %v", header)
+	}
+}
+
+func TestUnmarshalTooNew(t *testing.T) {
+	buf := new(bytes.Buffer)
+	enc := codec.NewEncoder(buf, DefaultHandle())
+	enc.Encode(serialEntry{Version: Version + 1})
+	enc.Encode(serialEntry{Key: "abc", Value: []byte("def")})
+
+	st := newState(t)
+	err := st.Unmarshal(buf)
+	if err == nil {
+		t.Fatal("expected an error loading a newer state version")
+	}
+}
@@ -0,0 +1,201 @@
+package dsstate
+
+import (
+	"context"
+	"encoding/base32"
+	"strings"
+	"sync"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/state"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	codec "github.com/ugorji/go/codec"
+)
+
+// Keys of the metadata index datastore.
+var (
+	// /e/<key>/<value>/<cid>: an entry per metadata key of each pin.
+	indexEntriesNs = ds.NewKey("/e")
+	// /p/<cid>: the indexed metadata of each pin.
+	indexPinsNs = ds.NewKey("/p")
+	// set once all the pins have been indexed.
+	indexReadyKey = ds.NewKey("/ready")
+)
+
+// MetadataIndex is a secondary index of the pins in a State by their
+// metadata keys and values, which allows finding the pins with some metadata
+// without listing the whole state. It is kept in its own datastore, which is
+// not replicated: every peer indexes its own copy of the state.
+//
+// States using an index keep it up to date with their Add and Rm calls. When
+// the pins are modified by other means (i.e. replicated changes applied by
+// the consensus layer), Update must be called with the new metadata.
+type MetadataIndex struct {
+	mu sync.Mutex
+	// serializes the reindexing of all the pins.
+	buildMu sync.Mutex
+	dstore  ds.Datastore
+}
+
+// NewMetadataIndex returns a MetadataIndex using the given datastore.
+func NewMetadataIndex(dstore ds.Datastore) *MetadataIndex {
+	return &MetadataIndex{dstore: dstore}
+}
+
+// keys and values are arbitrary strings: encode them so that they form a
+// single, non-empty, key component.
+func indexComponent(s string) string {
+	return "_" + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte(s))
+}
+
+func indexEntriesPrefix(key, value string) ds.Key {
+	return indexEntriesNs.ChildString(indexComponent(key)).ChildString(indexComponent(value))
+}
+
+func indexEntryKey(key, value string, c cid.Cid) ds.Key {
+	return indexEntriesPrefix(key, value).Child(cidToDsKey(c))
+}
+
+func indexPinKey(c cid.Cid) ds.Key {
+	return indexPinsNs.Child(cidToDsKey(c))
+}
+
+// Update replaces the indexed metadata of the given pin. Empty metadata
+// removes the pin from the index.
+func (idx *MetadataIndex) Update(ctx context.Context, c cid.Cid, metadata map[string]string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.update(ctx, c, metadata)
+}
+
+func (idx *MetadataIndex) update(ctx context.Context, c cid.Cid, metadata map[string]string) error {
+	var old map[string]string
+	v, err := idx.dstore.Get(ctx, indexPinKey(c))
+	switch err {
+	case nil:
+		dec := codec.NewDecoderBytes(v, DefaultHandle())
+		if err := dec.Decode(&old); err != nil {
+			return err
+		}
+	case ds.ErrNotFound:
+	default:
+		return err
+	}
+
+	if metadataEqual(old, metadata) {
+		return nil
+	}
+
+	for k, v := range old {
+		if nv, ok := metadata[k]; ok && nv == v {
+			continue
+		}
+		err := idx.dstore.Delete(ctx, indexEntryKey(k, v, c))
+		if err != nil && err != ds.ErrNotFound {
+			return err
+		}
+	}
+	for k, v := range metadata {
+		if ov, ok := old[k]; ok && ov == v {
+			continue
+		}
+		if err := idx.dstore.Put(ctx, indexEntryKey(k, v, c), nil); err != nil {
+			return err
+		}
+	}
+
+	if len(metadata) == 0 {
+		err := idx.dstore.Delete(ctx, indexPinKey(c))
+		if err != nil && err != ds.ErrNotFound {
+			return err
+		}
+		return nil
+	}
+	var b []byte
+	enc := codec.NewEncoderBytes(&b, DefaultHandle())
+	if err := enc.Encode(metadata); err != nil {
+		return err
+	}
+	return idx.dstore.Put(ctx, indexPinKey(c), b)
+}
+
+// reindex indexes the pin as it currently is in the given state.
+func (idx *MetadataIndex) reindex(ctx context.Context, st state.ReadOnly, c cid.Cid) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var metadata map[string]string
+	p, err := st.Get(ctx, c)
+	switch err {
+	case nil:
+		metadata = p.Metadata
+	case state.ErrNotFound:
+	default:
+		return err
+	}
+	return idx.update(ctx, c, metadata)
+}
+
+// build indexes all the pins in the state, unless it was done already.
+// Until then, the index may be missing pins which were stored before it
+// existed.
+func (idx *MetadataIndex) build(ctx context.Context, st *State) error {
+	idx.buildMu.Lock()
+	defer idx.buildMu.Unlock()
+
+	ready, err := idx.dstore.Has(ctx, indexReadyKey)
+	if err != nil || ready {
+		return err
+	}
+
+	logger.Info("indexing the metadata of all pins")
+	err = st.ForEach(ctx, func(p *api.Pin) error {
+		return idx.reindex(ctx, st, p.Cid)
+	})
+	if err != nil {
+		return err
+	}
+	return idx.dstore.Put(ctx, indexReadyKey, nil)
+}
+
+// cids returns the cids indexed with the given metadata key and value.
+func (idx *MetadataIndex) cids(ctx context.Context, key, value string) ([]cid.Cid, error) {
+	prefix := indexEntriesPrefix(key, value).String()
+	results, err := idx.dstore.Query(ctx, query.Query{
+		Prefix:   prefix,
+		KeysOnly: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var cids []cid.Cid
+	for r := range results.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		c, err := dsKeyToCid(ds.NewKey(strings.TrimPrefix(r.Key, prefix)))
+		if err != nil {
+			logger.Warn("bad metadata index key (ignoring). key: ", r.Key, "error: ", err)
+			continue
+		}
+		cids = append(cids, c)
+	}
+	return cids, nil
+}
+
+func metadataEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,198 @@
+package dsstate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/datastore/inmem"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+)
+
+var testCid2, _ = cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmma")
+var testCid3, _ = cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmb")
+
+func newIndexedState(t *testing.T) (*State, ds.Datastore) {
+	st := newState(t)
+	istore := inmem.New()
+	st.SetMetadataIndex(NewMetadataIndex(istore))
+	return st, istore
+}
+
+func metadataPin(c cid.Cid, metadata map[string]string) *api.Pin {
+	p := api.PinCid(c)
+	p.Metadata = metadata
+	return p
+}
+
+func indexKeys(t *testing.T, istore ds.Datastore) int {
+	results, err := istore.Query(context.Background(), query.Query{
+		Prefix:   indexEntriesNs.String(),
+		KeysOnly: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
+
+func checkPinsByMetadata(t *testing.T, st *State, key, value string, expected ...cid.Cid) {
+	t.Helper()
+	pins, err := st.PinsByMetadata(context.Background(), key, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != len(expected) {
+		t.Fatalf("%s=%s: expected %d pins; got %d", key, value, len(expected), len(pins))
+	}
+	for _, c := range expected {
+		found := false
+		for _, p := range pins {
+			if p.Cid.Equals(c) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s=%s: %s not found", key, value, c)
+		}
+	}
+}
+
+func TestPinsByMetadata(t *testing.T) {
+	ctx := context.Background()
+	st, istore := newIndexedState(t)
+
+	st.Add(ctx, metadataPin(testCid1, map[string]string{"project": "a", "tier": "1"}))
+	st.Add(ctx, metadataPin(testCid2, map[string]string{"project": "a/b"}))
+	st.Add(ctx, metadataPin(testCid3, nil))
+
+	checkPinsByMetadata(t, st, "project", "a", testCid1)
+	checkPinsByMetadata(t, st, "project", "a/b", testCid2)
+	checkPinsByMetadata(t, st, "tier", "1", testCid1)
+	checkPinsByMetadata(t, st, "project", "c")
+
+	// Updates replace the index entries.
+	st.Add(ctx, metadataPin(testCid1, map[string]string{"project": "c"}))
+	checkPinsByMetadata(t, st, "project", "a")
+	checkPinsByMetadata(t, st, "tier", "1")
+	checkPinsByMetadata(t, st, "project", "c", testCid1)
+	if n := indexKeys(t, istore); n != 2 {
+		t.Errorf("expected 2 index entries after the update; got %d", n)
+	}
+
+	// Removals delete them.
+	st.Rm(ctx, testCid1)
+	st.Rm(ctx, testCid2)
+	checkPinsByMetadata(t, st, "project", "c")
+	checkPinsByMetadata(t, st, "project", "a/b")
+	if n := indexKeys(t, istore); n != 0 {
+		t.Errorf("expected no index entries after removing the pins; got %d", n)
+	}
+
+	// The index keys are not listed as pins.
+	list, err := st.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Errorf("expected 1 pin; got %d", len(list))
+	}
+}
+
+func TestPinsByMetadataBuild(t *testing.T) {
+	ctx := context.Background()
+	st := newState(t)
+	st.Add(ctx, metadataPin(testCid1, map[string]string{"project": "a"}))
+
+	// Without index, the state is scanned.
+	checkPinsByMetadata(t, st, "project", "a", testCid1)
+
+	// Pins stored before the index are indexed on first use.
+	istore := inmem.New()
+	st.SetMetadataIndex(NewMetadataIndex(istore))
+	checkPinsByMetadata(t, st, "project", "a", testCid1)
+	if n := indexKeys(t, istore); n != 1 {
+		t.Errorf("expected 1 index entry; got %d", n)
+	}
+}
+
+func TestPinsByMetadataBatching(t *testing.T) {
+	ctx := context.Background()
+	store := dssync.MutexWrap(ds.NewMapDatastore())
+	bst, err := NewBatching(store, "", DefaultHandle())
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := NewMetadataIndex(inmem.New())
+	bst.SetMetadataIndex(idx)
+	st, err := New(store, "", DefaultHandle())
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.SetMetadataIndex(idx)
+
+	bst.Add(ctx, metadataPin(testCid1, map[string]string{"project": "a"}))
+	checkPinsByMetadata(t, st, "project", "a")
+	if err := bst.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	checkPinsByMetadata(t, st, "project", "a", testCid1)
+}
+
+func TestMetadataIndexUpdate(t *testing.T) {
+	ctx := context.Background()
+	st, istore := newIndexedState(t)
+
+	// Simulate a change applied underneath the state, then reported to
+	// the index.
+	p := metadataPin(testCid1, map[string]string{"project": "a"})
+	ps, err := p.ProtoMarshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.dsWrite.Put(ctx, st.key(p.Cid), ps); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.index.Update(ctx, p.Cid, p.Metadata); err != nil {
+		t.Fatal(err)
+	}
+	checkPinsByMetadata(t, st, "project", "a", testCid1)
+
+	if err := st.index.Update(ctx, p.Cid, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := indexKeys(t, istore); n != 0 {
+		t.Errorf("expected no index entries; got %d", n)
+	}
+}
+
+func TestUseMetadataIndex(t *testing.T) {
+	ctx := context.Background()
+	st := newState(t)
+	istore := inmem.New()
+	idx := NewMetadataIndex(istore)
+	st.UseMetadataIndex(idx)
+
+	// The state does not index the pins itself.
+	p := metadataPin(testCid1, map[string]string{"project": "a"})
+	st.Add(ctx, p)
+	if n := indexKeys(t, istore); n != 0 {
+		t.Errorf("expected no index entries; got %d", n)
+	}
+
+	if err := idx.Update(ctx, p.Cid, p.Metadata); err != nil {
+		t.Fatal(err)
+	}
+	if n := indexKeys(t, istore); n != 1 {
+		t.Errorf("expected 1 index entry; got %d", n)
+	}
+	checkPinsByMetadata(t, st, "project", "a", testCid1)
+}
@@ -0,0 +1,46 @@
+package dsstate
+
+import (
+	"fmt"
+)
+
+// Version is the version of the serialization format written by Marshal.
+// It must be increased, and a migration from the previous version
+// registered, whenever the format of the serialized entries changes.
+const Version = 2
+
+// A Migration upgrades a serialized state entry from the version it is
+// registered for to the next one. It may change both the key and the value
+// of the entry.
+type Migration func(key string, value []byte) (string, []byte, error)
+
+// migrations holds, for every version of the format, the Migration which
+// upgrades its entries to the following version. Unmarshal applies them in
+// order until the entries reach the current Version.
+var migrations = map[int]Migration{
+	1: migrateV1,
+}
+
+// Version 1 states did not carry a version header. Version 2 added it and
+// kept the entries as they were.
+func migrateV1(key string, value []byte) (string, []byte, error) {
+	return key, value, nil
+}
+
+// migrateEntry upgrades an entry serialized with the given version to the
+// current one.
+func migrateEntry(version int, entry *serialEntry) error {
+	for v := version; v < Version; v++ {
+		m, ok := migrations[v]
+		if !ok {
+			return fmt.Errorf("no migration registered for state version %d", v)
+		}
+		key, value, err := m(entry.Key, entry.Value)
+		if err != nil {
+			return fmt.Errorf("migrating state entry from version %d: %w", v, err)
+		}
+		entry.Key = key
+		entry.Value = value
+	}
+	return nil
+}
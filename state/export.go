@@ -0,0 +1,146 @@
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/ipfs-cluster/api"
+)
+
+// ExportVersion is the version of the streaming export format written by
+// Export.
+const ExportVersion = 1
+
+// exportMagic starts every streaming export, before the format version.
+var exportMagic = []byte("ipfs-cluster-state\n")
+
+// maxExportRecord bounds the size of a single record when importing.
+const maxExportRecord = 64 << 20
+
+// ErrExportVersion is returned when importing a streaming export written
+// with an unsupported version of the format.
+var ErrExportVersion = errors.New("unsupported state export version")
+
+// Iterator is implemented by states which can list their pins one by one,
+// without holding all of them in memory.
+type Iterator interface {
+	// ForEach calls f with every pin in the state, stopping at the first
+	// error.
+	ForEach(ctx context.Context, f func(*api.Pin) error) error
+}
+
+// Export writes all the pins in the state to w in the streaming export
+// format: a header with the format version followed by a gzip-compressed
+// sequence of length-prefixed, protobuf-encoded pins. States implementing
+// Iterator are exported without loading all the pins in memory.
+func Export(ctx context.Context, w io.Writer, st ReadOnly) error {
+	header := make([]byte, len(exportMagic)+binary.MaxVarintLen64)
+	n := copy(header, exportMagic)
+	n += binary.PutUvarint(header[n:], ExportVersion)
+	if _, err := w.Write(header[:n]); err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	bw := bufio.NewWriter(gz)
+	lenBuf := make([]byte, binary.MaxVarintLen64)
+	writePin := func(pin *api.Pin) error {
+		data, err := pin.ProtoMarshal()
+		if err != nil {
+			return err
+		}
+		n := binary.PutUvarint(lenBuf, uint64(len(data)))
+		if _, err := bw.Write(lenBuf[:n]); err != nil {
+			return err
+		}
+		_, err = bw.Write(data)
+		return err
+	}
+
+	var err error
+	if it, ok := st.(Iterator); ok {
+		err = it.ForEach(ctx, writePin)
+	} else {
+		var pins []*api.Pin
+		pins, err = st.List(ctx)
+		for i := 0; err == nil && i < len(pins); i++ {
+			err = writePin(pins[i])
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// IsExport returns true when r starts like a streaming export. It does not
+// consume any bytes.
+func IsExport(r *bufio.Reader) bool {
+	start, _ := r.Peek(len(exportMagic))
+	return bytes.Equal(start, exportMagic)
+}
+
+// Import reads a streaming export written by Export and calls f with every
+// pin in it, stopping at the first error. It returns ErrExportVersion when
+// the export was written with an unsupported version of the format.
+func Import(ctx context.Context, r io.Reader, f func(*api.Pin) error) error {
+	br := bufio.NewReader(r)
+	if !IsExport(br) {
+		return errors.New("not a streaming state export")
+	}
+	if _, err := br.Discard(len(exportMagic)); err != nil {
+		return err
+	}
+	version, err := binary.ReadUvarint(br)
+	if err != nil {
+		return err
+	}
+	if version != ExportVersion {
+		return fmt.Errorf("%w: %d (expected %d)", ErrExportVersion, version, ExportVersion)
+	}
+
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	records := bufio.NewReader(gz)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		size, err := binary.ReadUvarint(records)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if size > maxExportRecord {
+			return fmt.Errorf("state export record too large: %d bytes", size)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(records, data); err != nil {
+			return err
+		}
+
+		var pin api.Pin
+		if err := pin.ProtoUnmarshal(data); err != nil {
+			return err
+		}
+		if err := f(&pin); err != nil {
+			return err
+		}
+	}
+}
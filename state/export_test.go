@@ -0,0 +1,144 @@
+package state_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/datastore/inmem"
+	"github.com/ipfs/ipfs-cluster/state"
+	"github.com/ipfs/ipfs-cluster/state/dsstate"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	multihash "github.com/multiformats/go-multihash"
+)
+
+var testPeerID1, _ = peer.Decode("QmXZrtE5jQwXNqCJMfHUTQkvhQ4ZAnqMnmzFMJfLewuabc")
+
+func newState(t testing.TB, n int) *dsstate.State {
+	ctx := context.Background()
+	st, err := dsstate.New(inmem.New(), "", dsstate.DefaultHandle())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prefix := cid.Prefix{
+		Version:  1,
+		Codec:    cid.Raw,
+		MhType:   multihash.SHA2_256,
+		MhLength: -1,
+	}
+	for i := 0; i < n; i++ {
+		c, err := prefix.Sum([]byte(fmt.Sprintf("pin-%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pin := api.PinWithOpts(c, api.PinOptions{
+			ReplicationFactorMin: 1,
+			ReplicationFactorMax: 2,
+			Name:                 fmt.Sprintf("pin-%d", i),
+		})
+		pin.Allocations = []peer.ID{testPeerID1}
+		if err := st.Add(ctx, pin); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return st
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	st := newState(t, 100)
+
+	var buf bytes.Buffer
+	if err := state.Export(ctx, &buf, st); err != nil {
+		t.Fatal(err)
+	}
+
+	var imported []*api.Pin
+	err := state.Import(ctx, &buf, func(pin *api.Pin) error {
+		imported = append(imported, pin)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 100 {
+		t.Fatalf("expected 100 pins; got %d", len(imported))
+	}
+	for _, pin := range imported {
+		orig, err := st.Get(ctx, pin.Cid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !orig.Equals(pin) || len(pin.Allocations) != 1 {
+			t.Errorf("imported pin differs: %+v", pin)
+		}
+	}
+}
+
+func TestImportVersion(t *testing.T) {
+	ctx := context.Background()
+	var buf bytes.Buffer
+	if err := state.Export(ctx, &buf, newState(t, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewrite the version, right after the header.
+	data := buf.Bytes()
+	header := len("ipfs-cluster-state\n")
+	binary.PutUvarint(data[header:], state.ExportVersion+1)
+
+	err := state.Import(ctx, bytes.NewReader(data), func(*api.Pin) error { return nil })
+	if !errors.Is(err, state.ErrExportVersion) {
+		t.Errorf("expected ErrExportVersion; got %v", err)
+	}
+
+	err = state.Import(ctx, bytes.NewReader([]byte(`{"cid": "abc"}`)), func(*api.Pin) error { return nil })
+	if err == nil {
+		t.Error("expected an error importing something else")
+	}
+}
+
+// The JSON export lists the whole state before encoding it, while the
+// streaming export holds one pin at a time.
+func BenchmarkExportJSON(b *testing.B) {
+	ctx := context.Background()
+	st := newState(b, 10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		pins, err := st.List(ctx)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, pin := range pins {
+			if err := enc.Encode(pin); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkExportStream(b *testing.B) {
+	ctx := context.Background()
+	st := newState(b, 10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var buf bytes.Buffer
+		if err := state.Export(ctx, &buf, st); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -5,7 +5,6 @@ package state
 // State represents the shared state of the cluster
 import (
 	"context"
-	"errors"
 	"io"
 
 	"github.com/ipfs/ipfs-cluster/api"
@@ -14,7 +13,7 @@ import (
 )
 
 // ErrNotFound should be returned when a pin is not part of the state.
-var ErrNotFound = errors.New("pin is not part of the pinset")
+var ErrNotFound = api.ErrNotFound
 
 // State is a wrapper to the Cluster shared state so that Pin objects can
 // be easily read, written and queried. The state can be marshaled and
@@ -56,3 +55,11 @@ type BatchingState interface {
 	// Commit writes any batched operations.
 	Commit(context.Context) error
 }
+
+// MetadataIndexer is implemented by states which can look up pins by their
+// metadata.
+type MetadataIndexer interface {
+	// PinsByMetadata returns the pins with the given value for the given
+	// metadata key.
+	PinsByMetadata(ctx context.Context, key, value string) ([]*api.Pin, error)
+}
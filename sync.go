@@ -0,0 +1,209 @@
+package ipfscluster
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	"go.opencensus.io/trace"
+)
+
+// syncCheckInterval is how often Sync checks whether the operations it
+// queued have finished.
+var syncCheckInterval = 500 * time.Millisecond
+
+// syncRun is a Sync() in progress. The callers waiting for it share its
+// result. It is cancelled when all of them give up.
+type syncRun struct {
+	done    chan struct{}
+	cancel  func()
+	waiters int
+
+	summary *api.SyncSummary
+	err     error
+}
+
+// operationChecker is implemented by trackers which can tell whether an
+// operation is queued or in progress for an item from their own operation
+// state, without looking up the item in IPFS.
+type operationChecker interface {
+	InProgress(context.Context, cid.Cid) bool
+}
+
+// Sync performs a full state sync in this peer and returns when it is
+// complete, with a summary of the corrections made. It lets the consensus
+// catch up with other peers, runs the StateSync tasks and reconciles all
+// the items tracked with the IPFS daemon, as RecoverAllLocal does, waiting
+// for the operations this queues to finish.
+//
+// With the CRDT consensus, catching up only broadcasts the current heads so
+// that diverged peers exchange the branches they miss. It does not wait for
+// the updates from other peers to be fetched and applied, which happens in
+// the background, so they may only be reconciled by a later sync.
+//
+// Concurrent calls are coalesced: they wait for the sync already running
+// and get the same summary. A caller whose context is cancelled stops
+// waiting; the sync is cancelled when no caller waits for it anymore, and
+// later calls start a new one once it has stopped.
+func (c *Cluster) Sync(ctx context.Context) (*api.SyncSummary, error) {
+	_, span := trace.StartSpan(ctx, "cluster/Sync")
+	defer span.End()
+
+	c.syncingMux.Lock()
+	run := c.syncing
+	for run != nil && run.waiters == 0 {
+		// Cancelled and still stopping.
+		c.syncingMux.Unlock()
+		select {
+		case <-run.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		c.syncingMux.Lock()
+		run = c.syncing
+	}
+	if run == nil {
+		// The run outlives the caller which started it, so it
+		// gets its own span (see sync).
+		runCtx, cancel := context.WithCancel(c.ctx)
+		run = &syncRun{
+			done:   make(chan struct{}),
+			cancel: cancel,
+		}
+		c.syncing = run
+		go func() {
+			run.summary, run.err = c.sync(runCtx)
+			cancel()
+			c.syncingMux.Lock()
+			if c.syncing == run {
+				c.syncing = nil
+			}
+			c.syncingMux.Unlock()
+			close(run.done)
+		}()
+	}
+	run.waiters++
+	c.syncingMux.Unlock()
+
+	select {
+	case <-run.done:
+		return run.summary, run.err
+	case <-ctx.Done():
+		c.syncingMux.Lock()
+		run.waiters--
+		if run.waiters == 0 {
+			run.cancel()
+		}
+		c.syncingMux.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Cluster) sync(ctx context.Context) (*api.SyncSummary, error) {
+	ctx, span := trace.StartSpan(ctx, "cluster/sync")
+	defer span.End()
+
+	summary := &api.SyncSummary{
+		Peer:      c.id,
+		StartedAt: time.Now(),
+	}
+
+	if err := c.consensus.Reconcile(ctx); err != nil {
+		return nil, err
+	}
+	if err := c.consensus.WaitForSync(ctx); err != nil {
+		return nil, err
+	}
+
+	expired, err := c.stateSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	summary.ExpiredUnpinned = expired
+
+	// Only items in these states are acted upon by RecoverAll.
+	before := make(map[cid.Cid]api.TrackerStatus)
+	for _, pi := range c.tracker.StatusAll(ctx, api.TrackerStatusError|api.TrackerStatusUnexpectedlyUnpinned) {
+		before[pi.Cid] = pi.Status
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// RecoverAll always covers the whole pinset, unlike the periodic
+	// recovery which may resume where the previous pass stopped.
+	pInfos, err := c.tracker.RecoverAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var recovered []cid.Cid
+	for _, pi := range pInfos {
+		if pi == nil {
+			continue
+		}
+		if _, ok := before[pi.Cid]; ok {
+			recovered = append(recovered, pi.Cid)
+		}
+	}
+	if err := c.waitOperations(ctx, recovered); err != nil {
+		return nil, err
+	}
+
+	for _, ci := range recovered {
+		st := before[ci]
+		pi := c.tracker.Status(ctx, ci)
+		switch {
+		case pi.Status.Match(api.TrackerStatusError | api.TrackerStatusUnexpectedlyUnpinned):
+			summary.Failed = append(summary.Failed, pi.Cid)
+		case st == api.TrackerStatusUnpinError:
+			summary.Unpinned = append(summary.Unpinned, pi.Cid)
+		default:
+			summary.Repinned = append(summary.Repinned, pi.Cid)
+		}
+	}
+
+	summary.FinishedAt = time.Now()
+	logger.Infof(
+		"sync: %d expired items unpinned, %d repinned, %d unpinned, %d failed",
+		len(summary.ExpiredUnpinned),
+		len(summary.Repinned),
+		len(summary.Unpinned),
+		len(summary.Failed),
+	)
+	return summary, nil
+}
+
+// waitOperations waits until the tracker has no operation queued or in
+// progress for any of the given items, or until the context is done. Only
+// the items still pending are checked again.
+func (c *Cluster) waitOperations(ctx context.Context, cids []cid.Cid) error {
+	inProgress := func(ci cid.Cid) bool {
+		if oc, ok := c.tracker.(operationChecker); ok {
+			return oc.InProgress(ctx, ci)
+		}
+		return c.tracker.Status(ctx, ci).Status.Match(api.TrackerStatusQueued | api.TrackerStatusPinning | api.TrackerStatusUnpinning)
+	}
+
+	waiting := cids
+	ticker := time.NewTicker(syncCheckInterval)
+	defer ticker.Stop()
+	for {
+		var pending []cid.Cid
+		for _, ci := range waiting {
+			if inProgress(ci) {
+				pending = append(pending, ci)
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		waiting = pending
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -22,6 +22,17 @@ var (
 	// ErrorCid is meant to be used as a Cid which causes errors. i.e. the
 	// ipfs mock fails when pinning this CID.
 	ErrorCid, _ = cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmc")
+	// HugeCid is meant to be used as a Cid whose DAG is larger than the
+	// space available in the mocked IPFS daemons.
+	HugeCid, _ = cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmf")
+	// ProgressCid is pinned by the ipfs mock in a few steps, reporting
+	// progress.
+	ProgressCid, _ = cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmg")
+	// DegradedCid is walked by the ipfs mock as a DAG whose block Cid2 is
+	// missing.
+	DegradedCid, _ = cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmj")
+	// CidMFS is what every MFS path resolves to in the ipfs mock.
+	CidMFS, _ = cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmi")
 	// NotFoundCid is meant to be used as a CID that doesn't exist in the
 	// pinset.
 	NotFoundCid, _ = cid.Decode("bafyreiay3jpjk74dkckv2r74eyvf3lfnxujefay2rtuluintasq2zlapv4")
@@ -49,6 +60,7 @@ var (
 	PathIPNS2 = "/ipns/QmbmSAQNnfGcBAB8M8AsSPxd1TY7cpT9hZ398kXAScn2Ka/"
 	PathIPLD1 = "/ipld/QmaNJ5acV31sx8jq626qTpAWW4DXKw34aGhx53dECLvXbY"
 	PathIPLD2 = "/ipld/QmaNJ5acV31sx8jq626qTpAWW4DXKw34aGhx53dECLvXbY/"
+	PathMFS1  = "/mfs/site/www"
 
 	// NotFoundPath is meant to be used as a path that resolves into a CID that doesn't exist in the
 	// pinset.
@@ -56,4 +68,9 @@ var (
 	InvalidPath1 = "/invalidkeytype/QmaNJ5acV31sx8jq626qTpAWW4DXKw34aGhx53dECLvXbY/"
 	InvalidPath2 = "/ipfs/invalidhash"
 	InvalidPath3 = "/ipfs/"
+
+	// OwnedCid is part of the pinset of the RPC mock and is owned by
+	// PinOwner.
+	OwnedCid, _ = cid.Decode("QmP63DkAFEnDYNjDYBpyNDfttu1fvUw99x1brscPzpqmmh")
+	PinOwner    = "pinOwner"
 )
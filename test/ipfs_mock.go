@@ -89,6 +89,15 @@ type mockRefsResp struct {
 	Err string
 }
 
+type mockRoutingResp struct {
+	Type      int
+	Responses []mockRoutingPeer
+}
+
+type mockRoutingPeer struct {
+	ID string
+}
+
 type mockSwarmPeersResp struct {
 	Peers []mockIpfsPeer
 }
@@ -101,6 +110,35 @@ type mockBlockPutResp struct {
 	Key string
 }
 
+type mockBlockStatResp struct {
+	Key  string
+	Size int
+}
+
+type mockFilesStatResp struct {
+	Hash           string
+	CumulativeSize uint64
+}
+
+type mockCodec struct {
+	Code uint64
+	Name string
+}
+
+type mockLink struct {
+	Name string
+	Hash string
+}
+
+type mockLsObject struct {
+	Hash  string
+	Links []mockLink
+}
+
+type mockLsResp struct {
+	Objects []mockLsObject
+}
+
 type mockRepoGCResp struct {
 	Key   cid.Cid `json:",omitempty"`
 	Error string  `json:",omitempty"`
@@ -161,6 +199,16 @@ func (m *IpfsMock) GetCount(path string) int {
 	return m.reqCounts[path]
 }
 
+// PinDepth returns the max-depth with which an item was pinned, or an error
+// if it is not pinned.
+func (m *IpfsMock) PinDepth(c cid.Cid) (api.PinDepth, error) {
+	pin, err := m.pinMap.Get(context.Background(), c)
+	if err != nil {
+		return 0, err
+	}
+	return pin.MaxDepth, nil
+}
+
 // FIXME: what if IPFS API changes?
 func (m *IpfsMock) handler(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
@@ -196,9 +244,15 @@ func (m *IpfsMock) handler(w http.ResponseWriter, r *http.Request) {
 			goto ERROR
 		}
 		mode := extractMode(r.URL)
+		if r.URL.Query().Get("recursive") == "false" {
+			mode = api.PinModeDirect
+		}
 		opts := api.PinOptions{
 			Mode: mode,
 		}
+		if d, err := strconv.Atoi(r.URL.Query().Get("max-depth")); err == nil {
+			opts.MaxDepth = api.PinDepth(d)
+		}
 		pinObj := api.PinWithOpts(c, opts)
 		m.pinMap.Add(ctx, pinObj)
 		resp := mockPinResp{
@@ -212,6 +266,16 @@ func (m *IpfsMock) handler(w http.ResponseWriter, r *http.Request) {
 				j, _ := json.Marshal(resp)
 				w.Write(j)
 			}
+		} else if c.Equals(ProgressCid) {
+			for i := 1; i <= 5; i++ {
+				resp.Progress = i
+				j, _ := json.Marshal(resp)
+				w.Write(j)
+				if f, ok := w.(http.Flusher); ok {
+					f.Flush()
+				}
+				time.Sleep(100 * time.Millisecond)
+			}
 		} else {
 			j, _ := json.Marshal(resp)
 			w.Write(j)
@@ -395,6 +459,32 @@ func (m *IpfsMock) handler(w http.ResponseWriter, r *http.Request) {
 			goto ERROR
 		}
 		w.Write(data)
+	case "block/stat":
+		query := r.URL.Query()
+		arg, ok := query["arg"]
+		if !ok || len(arg) != 1 {
+			goto ERROR
+		}
+		c, err := cid.Decode(arg[0])
+		if err != nil {
+			goto ERROR
+		}
+		data, ok := m.BlockStore[arg[0]]
+		if !ok {
+			if _, err := m.pinMap.Get(ctx, c); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				resp := ipfsErr{0, "blockservice: key not found"}
+				j, _ := json.Marshal(resp)
+				w.Write(j)
+				return
+			}
+		}
+		resp := mockBlockStatResp{
+			Key:  c.String(),
+			Size: len(data),
+		}
+		j, _ := json.Marshal(resp)
+		w.Write(j)
 	case "repo/gc":
 		// It assumes `/repo/gc` with parameter `stream-errors=true`
 		enc := json.NewEncoder(w)
@@ -461,7 +551,13 @@ func (m *IpfsMock) handler(w http.ResponseWriter, r *http.Request) {
 			Ref: arg,
 		}
 		j, _ := json.Marshal(resp)
-		if arg == SlowCid1.String() {
+		if arg == DegradedCid.String() {
+			w.Write(j)
+			j, _ = json.Marshal(mockRefsResp{
+				Err: "block was not found locally (offline): ipld: could not find " + Cid2.String(),
+			})
+			w.Write(j)
+		} else if arg == SlowCid1.String() {
 			for i := 0; i <= 5; i++ {
 				time.Sleep(2 * time.Second)
 				w.Write(j)
@@ -469,6 +565,96 @@ func (m *IpfsMock) handler(w http.ResponseWriter, r *http.Request) {
 		} else {
 			w.Write(j)
 		}
+	case "dht/findprovs":
+		arg, ok := extractCid(r.URL)
+		if !ok {
+			goto ERROR
+		}
+		// The daemon itself provides everything. DegradedCid has
+		// no other providers.
+		j, _ := json.Marshal(mockRoutingResp{Type: 0})
+		w.Write(j)
+		j, _ = json.Marshal(mockRoutingResp{
+			Type:      4,
+			Responses: []mockRoutingPeer{{ID: PeerID1.Pretty()}},
+		})
+		w.Write(j)
+		if arg != DegradedCid.String() {
+			j, _ = json.Marshal(mockRoutingResp{
+				Type:      4,
+				Responses: []mockRoutingPeer{{ID: PeerID2.Pretty()}, {ID: PeerID3.Pretty()}},
+			})
+			w.Write(j)
+		}
+	case "cid/codecs":
+		codecs := []mockCodec{
+			{Code: cid.DagProtobuf, Name: "dag-pb"},
+			{Code: cid.Raw, Name: "raw"},
+			{Code: cid.DagCBOR, Name: "dag-cbor"},
+		}
+		j, _ := json.Marshal(codecs)
+		w.Write(j)
+	case "files/stat":
+		arg, ok := extractCid(r.URL)
+		if !ok {
+			goto ERROR
+		}
+		if !strings.HasPrefix(arg, "/ipfs/") { // an MFS path
+			j, _ := json.Marshal(mockFilesStatResp{Hash: CidMFS.String()})
+			w.Write(j)
+			break
+		}
+		arg = strings.TrimPrefix(arg, "/ipfs/")
+		resp := mockFilesStatResp{
+			Hash:           arg,
+			CumulativeSize: 1000,
+		}
+		if data, ok := m.BlockStore[arg]; ok {
+			resp.CumulativeSize = uint64(len(data))
+		}
+		if arg == HugeCid.String() {
+			resp.CumulativeSize = 20000000000 // 20 GB
+		}
+		j, _ := json.Marshal(resp)
+		w.Write(j)
+	case "dht/provide":
+		arg, ok := extractCid(r.URL)
+		if !ok {
+			goto ERROR
+		}
+		c, err := cid.Decode(arg)
+		if err != nil {
+			goto ERROR
+		}
+		if r.URL.Query().Get("recursive") != "true" {
+			goto ERROR
+		}
+		_, ok = m.BlockStore[arg]
+		if _, err := m.pinMap.Get(ctx, c); !ok && err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			resp := ipfsErr{0, "block " + arg + " not found locally, cannot provide"}
+			j, _ := json.Marshal(resp)
+			w.Write(j)
+			return
+		}
+		w.Write([]byte(`{"Type":4,"ID":"","Responses":null,"Extra":""}`))
+	case "ls":
+		arg, ok := extractCid(r.URL)
+		if !ok {
+			goto ERROR
+		}
+		obj := mockLsObject{Hash: arg}
+		// Cid1 is a directory with some links, two of them unnamed.
+		if arg == Cid1.String() {
+			obj.Links = []mockLink{
+				{Name: "docs", Hash: Cid5.String()},
+				{Name: "thumbs", Hash: CidResolved.String()},
+				{Hash: Cid3.String()},
+				{Hash: NotFoundCid.String()},
+			}
+		}
+		j, _ := json.Marshal(mockLsResp{Objects: []mockLsObject{obj}})
+		w.Write(j)
 	case "version":
 		w.Write([]byte("{\"Version\":\"m.o.c.k\"}"))
 	default:
@@ -2,7 +2,9 @@ package test
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
+	"fmt"
 	"strings"
 	"testing"
 	"time"
@@ -12,6 +14,7 @@ import (
 
 	cid "github.com/ipfs/go-cid"
 	gopath "github.com/ipfs/go-path"
+	crypto "github.com/libp2p/go-libp2p-core/crypto"
 	host "github.com/libp2p/go-libp2p-core/host"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	rpc "github.com/libp2p/go-libp2p-gorpc"
@@ -71,6 +74,9 @@ func (mock *mockCluster) Pin(ctx context.Context, in *api.Pin, out *api.Pin) err
 		return ErrBadCid
 	}
 	*out = *in
+	if len(in.UserAllocations) > 0 {
+		out.Allocations = in.UserAllocations
+	}
 	return nil
 }
 
@@ -85,7 +91,19 @@ func (mock *mockCluster) Unpin(ctx context.Context, in *api.Pin, out *api.Pin) e
 	return nil
 }
 
+func (mock *mockCluster) Update(ctx context.Context, in *api.Pin, out *api.Pin) error {
+	if in.Cid.Equals(NotFoundCid) {
+		return state.ErrNotFound
+	}
+	return mock.Pin(ctx, in, out)
+}
+
 func (mock *mockCluster) PinPath(ctx context.Context, in *api.PinPath, out *api.Pin) error {
+	if api.MFSPath(in.Path) != "" {
+		*out = *api.PinWithOpts(CidMFS, in.PinOptions)
+		return nil
+	}
+
 	p, err := gopath.ParsePath(in.Path)
 	if err != nil {
 		return err
@@ -124,14 +142,25 @@ func (mock *mockCluster) Pins(ctx context.Context, in struct{}, out *[]*api.Pin)
 		ReplicationFactorMax: -1,
 	}
 
+	pin2 := api.PinCid(Cid2)
+	pin2.Allocations = []peer.ID{PeerID1}
+
 	*out = []*api.Pin{
 		api.PinWithOpts(Cid1, opts),
-		api.PinCid(Cid2),
+		pin2,
 		api.PinWithOpts(Cid3, opts),
 	}
 	return nil
 }
 
+func (mock *mockCluster) PinsLinearizable(ctx context.Context, in struct{}, out *[]*api.Pin) error {
+	return mock.Pins(ctx, in, out)
+}
+
+func (mock *mockCluster) PinGetLinearizable(ctx context.Context, in cid.Cid, out *api.Pin) error {
+	return mock.PinGet(ctx, in, out)
+}
+
 func (mock *mockCluster) PinGet(ctx context.Context, in cid.Cid, out *api.Pin) error {
 	switch in.String() {
 	case ErrorCid.String():
@@ -147,8 +176,12 @@ func (mock *mockCluster) PinGet(ctx context.Context, in cid.Cid, out *api.Pin) e
 		p.ReplicationFactorMin = 1
 		p.ReplicationFactorMax = 1
 		*out = *p
+	case OwnedCid.String():
+		p := api.PinCid(in)
+		p.Metadata = map[string]string{api.OwnerMetaKey: PinOwner}
+		*out = *p
 	default:
-		return errors.New("not found")
+		return state.ErrNotFound
 	}
 	return nil
 }
@@ -163,6 +196,7 @@ func (mock *mockCluster) ID(ctx context.Context, in struct{}, out *api.ID) error
 		ID: PeerID1,
 		//PublicKey: pubkey,
 		Version: "0.0.mock",
+		Leader:  PeerID1,
 		IPFS: &api.IPFSID{
 			ID:        PeerID1,
 			Addresses: []api.Multiaddr{addr},
@@ -291,6 +325,34 @@ func (mock *mockCluster) Status(ctx context.Context, in cid.Cid, out *api.Global
 	return nil
 }
 
+// StatusCids reports the items in the mock pinset (Cid1, Cid2 and Cid3) as
+// StatusAll does, and the rest as unpinned.
+func (mock *mockCluster) StatusCids(ctx context.Context, in []cid.Cid, out *[]*api.GlobalPinInfo) error {
+	var all []*api.GlobalPinInfo
+	mock.StatusAll(ctx, api.TrackerStatusUndefined, &all)
+
+	gpis := make([]*api.GlobalPinInfo, len(in))
+	for i, c := range in {
+		status := api.TrackerStatusUnpinned
+		for _, gpi := range all {
+			if gpi.Cid.Equals(c) {
+				status = gpi.PeerMap[peer.Encode(PeerID1)].Status
+			}
+		}
+		gpis[i] = &api.GlobalPinInfo{
+			Cid: c,
+			PeerMap: map[string]*api.PinInfoShort{
+				peer.Encode(PeerID1): {
+					Status: status,
+					TS:     time.Now(),
+				},
+			},
+		}
+	}
+	*out = gpis
+	return nil
+}
+
 func (mock *mockCluster) StatusLocal(ctx context.Context, in cid.Cid, out *api.PinInfo) error {
 	return (&mockPinTracker{}).Status(ctx, in, out)
 }
@@ -303,6 +365,16 @@ func (mock *mockCluster) RecoverAllLocal(ctx context.Context, in struct{}, out *
 	return (&mockPinTracker{}).RecoverAll(ctx, in, out)
 }
 
+func (mock *mockCluster) Sync(ctx context.Context, in struct{}, out *api.SyncSummary) error {
+	*out = api.SyncSummary{
+		Peer:       PeerID1,
+		StartedAt:  time.Now().Add(-time.Second),
+		FinishedAt: time.Now(),
+		Repinned:   []cid.Cid{Cid1},
+	}
+	return nil
+}
+
 func (mock *mockCluster) Recover(ctx context.Context, in cid.Cid, out *api.GlobalPinInfo) error {
 	return mock.Status(ctx, in, out)
 }
@@ -311,6 +383,27 @@ func (mock *mockCluster) RecoverLocal(ctx context.Context, in cid.Cid, out *api.
 	return (&mockPinTracker{}).Recover(ctx, in, out)
 }
 
+func (mock *mockCluster) Verify(ctx context.Context, in cid.Cid, out *api.GlobalPinInfo) error {
+	var pinfo api.PinInfo
+	if err := mock.VerifyLocal(ctx, in, &pinfo); err != nil {
+		return err
+	}
+	*out = *pinfo.ToGlobal()
+	return nil
+}
+
+func (mock *mockCluster) VerifyLocal(ctx context.Context, in cid.Cid, out *api.PinInfo) error {
+	if err := (&mockPinTracker{}).Status(ctx, in, out); err != nil {
+		return err
+	}
+	if in.Equals(DegradedCid) {
+		out.Status = api.TrackerStatusPinDegraded
+		out.Error = "1 blocks are missing"
+		out.MissingBlocks = []cid.Cid{Cid2}
+	}
+	return nil
+}
+
 func (mock *mockCluster) BlockAllocate(ctx context.Context, in *api.Pin, out *[]peer.ID) error {
 	if in.ReplicationFactorMin > 1 {
 		return errors.New("replMin too high: can only mock-allocate to 1")
@@ -330,6 +423,191 @@ func (mock *mockCluster) RepoGC(ctx context.Context, in struct{}, out *api.Globa
 	return nil
 }
 
+func (mock *mockCluster) BlockHolders(ctx context.Context, in *api.BlockHoldersRequest, out *[]peer.ID) error {
+	if in.Cid.Equals(ErrorCid) {
+		return ErrBadCid
+	}
+	*out = []peer.ID{PeerID1}
+	return nil
+}
+
+func (mock *mockCluster) DeletedPinsLocal(ctx context.Context, in time.Time, out *[]*api.Tombstone) error {
+	return mock.DeletedPins(ctx, in, out)
+}
+
+func (mock *mockCluster) DeletedPins(ctx context.Context, in time.Time, out *[]*api.Tombstone) error {
+	t := &api.Tombstone{
+		Cid:        Cid1,
+		UnpinnedAt: time.Now().Add(-time.Minute),
+		UnpinnedBy: PinOwner,
+		Peer:       PeerID1,
+	}
+	if !t.UnpinnedAt.After(in) {
+		*out = []*api.Tombstone{}
+		return nil
+	}
+	*out = []*api.Tombstone{t}
+	return nil
+}
+
+func (mock *mockCluster) AllocationsAudit(ctx context.Context, in struct{}, out *[]*api.AllocationDecision) error {
+	*out = []*api.AllocationDecision{
+		{
+			Cid:                  Cid1,
+			ReplicationFactorMin: 1,
+			ReplicationFactorMax: 1,
+			Candidates: []*api.AllocationCandidate{
+				{Peer: PeerID1, Scores: map[string]int64{"numpin": 2}},
+				{Peer: PeerID2, Scores: map[string]int64{"numpin": 1}},
+			},
+			Allocations: []peer.ID{PeerID1},
+		},
+	}
+	return nil
+}
+
+func (mock *mockCluster) OpLog(ctx context.Context, in *api.OpLogRequest, out *api.OpLogPage) error {
+	if in.After > 10 {
+		return fmt.Errorf("%w: the operation log starts at 10", api.ErrExpired)
+	}
+	*out = api.OpLogPage{
+		Peer:       PeerID1,
+		InstanceID: "1",
+		First:      1,
+		Last:       2,
+		Operations: []*api.Operation{
+			{Seq: 1, Type: api.OperationPin, Cid: Cid1, Pin: api.PinCid(Cid1)},
+			{Seq: 2, Type: api.OperationUnpin, Cid: Cid1},
+		},
+	}
+	if in.After >= 2 {
+		out.Operations = nil
+	}
+	return nil
+}
+
+func (mock *mockCluster) StateDigestLocal(ctx context.Context, in struct{}, out *api.StateDigest) error {
+	*out = api.StateDigest{
+		Peer:   PeerID1,
+		Digest: "0000",
+	}
+	return nil
+}
+
+func (mock *mockCluster) PinsDiff(ctx context.Context, in peer.ID, out *api.PinsDiff) error {
+	if in == PeerID3 {
+		*out = api.PinsDiff{
+			Peer:    in,
+			Added:   []*api.Pin{},
+			Removed: []*api.Pin{},
+			Changed: []*api.Pin{},
+			Error:   "peer unreachable",
+		}
+		return nil
+	}
+	opts := api.PinOptions{
+		ReplicationFactorMin: -1,
+		ReplicationFactorMax: -1,
+	}
+	*out = api.PinsDiff{
+		Peer:    in,
+		Added:   []*api.Pin{api.PinWithOpts(Cid4, opts)},
+		Removed: []*api.Pin{api.PinWithOpts(Cid1, opts)},
+		Changed: []*api.Pin{},
+	}
+	return nil
+}
+
+func (mock *mockCluster) PinReceipt(ctx context.Context, in cid.Cid, out *api.PinReceipt) error {
+	if in.Equals(ErrorCid) {
+		return ErrBadCid
+	}
+	if in.Equals(NotFoundCid) {
+		return state.ErrNotFound
+	}
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		return err
+	}
+	receipt, err := api.NewPinReceipt(in, []peer.ID{PeerID1}, time.Now(), key)
+	if err != nil {
+		return err
+	}
+	*out = *receipt
+	return nil
+}
+
+func (mock *mockCluster) PinBatch(ctx context.Context, in *api.PinBatch, out *api.PinBatchResult) error {
+	if len(in.Pins) == 0 {
+		return errors.New("the pin batch is empty")
+	}
+	result := api.PinBatchResult{}
+	for _, p := range in.Pins {
+		item := api.PinBatchItem{Cid: p.Cid}
+		var pin api.Pin
+		if err := mock.Pin(ctx, p, &pin); err != nil {
+			item.Error = err.Error()
+			result.Failed++
+		} else {
+			item.Pin = &pin
+			result.Pinned++
+		}
+		result.Items = append(result.Items, item)
+	}
+	if in.Atomic && result.Failed > 0 {
+		for i := range result.Items {
+			if result.Items[i].Pin != nil {
+				result.Items[i].Pin = nil
+				result.Items[i].Error = "rolled back: another pin of the batch failed"
+			}
+		}
+		result.Pinned = 0
+		result.Failed = len(result.Items)
+		result.RolledBack = true
+	}
+	*out = result
+	return nil
+}
+
+func (mock *mockCluster) UnpinFilter(ctx context.Context, in *api.UnpinFilter, out *api.UnpinFilterResult) error {
+	if in.Empty() {
+		return errors.New("the unpin filter cannot be empty")
+	}
+	var pins []*api.Pin
+	_ = mock.Pins(ctx, struct{}{}, &pins)
+	result := api.UnpinFilterResult{Token: in.Token()}
+	for _, p := range pins {
+		if in.Match(p) {
+			result.Matched++
+		}
+	}
+	if in.Confirm == result.Token {
+		result.Unpinned = result.Matched
+	}
+	*out = result
+	return nil
+}
+
+func (mock *mockCluster) SetMaintenance(ctx context.Context, in bool, out *struct{}) error {
+	return nil
+}
+
+func (mock *mockCluster) SetMaintenanceLocal(ctx context.Context, in bool, out *struct{}) error {
+	return nil
+}
+
+func (mock *mockCluster) SLABreaches(ctx context.Context, in struct{}, out *[]*api.PinSLABreach) error {
+	var local []*api.PinSLABreach
+	(&mockPinTracker{}).SLABreaches(ctx, in, &local)
+	*out = append(local, &api.PinSLABreach{
+		Cid:      Cid2,
+		Peer:     PeerID2,
+		PeerName: PeerName2,
+		Deadline: time.Now().Add(-time.Minute),
+	})
+	return nil
+}
+
 func (mock *mockCluster) RepoGCLocal(ctx context.Context, in struct{}, out *api.RepoGC) error {
 	*out = api.RepoGC{
 		Peer: PeerID1,
@@ -359,6 +637,16 @@ func (mock *mockCluster) SendInformerMetrics(ctx context.Context, in struct{}, o
 	return nil
 }
 
+func (mock *mockCluster) Health(ctx context.Context, in struct{}, out *api.Health) error {
+	*out = api.Health{
+		Peer:     PeerID1,
+		Status:   api.HealthOK,
+		Leader:   PeerID1,
+		IsLeader: true,
+	}
+	return nil
+}
+
 func (mock *mockCluster) Alerts(ctx context.Context, in struct{}, out *[]api.Alert) error {
 	*out = []api.Alert{
 		api.Alert{
@@ -381,6 +669,28 @@ func (mock *mockPinTracker) Track(ctx context.Context, in *api.Pin, out *struct{
 	return nil
 }
 
+func (mock *mockPinTracker) SetPinProgress(ctx context.Context, in *api.PinProgress, out *struct{}) error {
+	return nil
+}
+
+func (mock *mockPinTracker) QueueDepth(ctx context.Context, in struct{}, out *int) error {
+	*out = 3
+	return nil
+}
+
+func (mock *mockPinTracker) SLABreaches(ctx context.Context, in struct{}, out *[]*api.PinSLABreach) error {
+	*out = []*api.PinSLABreach{
+		{
+			Cid:      Cid1,
+			Peer:     PeerID1,
+			PeerName: PeerName1,
+			Deadline: time.Now().Add(-time.Hour),
+			PinnedAt: time.Now().Add(-time.Minute),
+		},
+	}
+	return nil
+}
+
 func (mock *mockPinTracker) Untrack(ctx context.Context, in *api.Pin, out *struct{}) error {
 	return nil
 }
@@ -431,6 +741,35 @@ func (mock *mockPinTracker) Status(ctx context.Context, in cid.Cid, out *api.Pin
 	return nil
 }
 
+// StatusCids reports the items tracked by the mock (Cid1 and Cid3) as
+// StatusAll does, and the rest as unpinned.
+func (mock *mockPinTracker) StatusCids(ctx context.Context, in []cid.Cid, out *[]*api.PinInfo) error {
+	var all []*api.PinInfo
+	mock.StatusAll(ctx, api.TrackerStatusUndefined, &all)
+
+	pinfos := make([]*api.PinInfo, len(in))
+	for i, c := range in {
+		if c.Equals(ErrorCid) {
+			return ErrBadCid
+		}
+		pinfos[i] = &api.PinInfo{
+			Cid:  c,
+			Peer: PeerID1,
+			PinInfoShort: api.PinInfoShort{
+				Status: api.TrackerStatusUnpinned,
+				TS:     time.Now(),
+			},
+		}
+		for _, pi := range all {
+			if pi.Cid.Equals(c) {
+				pinfos[i] = pi
+			}
+		}
+	}
+	*out = pinfos
+	return nil
+}
+
 func (mock *mockPinTracker) RecoverAll(ctx context.Context, in struct{}, out *[]*api.PinInfo) error {
 	*out = make([]*api.PinInfo, 0)
 	return nil
@@ -450,6 +789,38 @@ func (mock *mockPinTracker) Recover(ctx context.Context, in cid.Cid, out *api.Pi
 
 /* PeerMonitor methods */
 
+// MetricsAt runs PeerMonitor.MetricsAt().
+func (mock *mockPeerMonitor) MetricsAt(ctx context.Context, in *api.MetricsAtRequest, out *[]*api.Metric) error {
+	m := &api.Metric{
+		Name:       in.Name,
+		Peer:       PeerID1,
+		Value:      "0",
+		Valid:      true,
+		ReceivedAt: in.Time.UnixNano(),
+	}
+	m.Expire = in.Time.Add(2 * time.Second).UnixNano()
+	*out = []*api.Metric{m}
+	return nil
+}
+
+// PeerMetricAll runs PeerMonitor.PeerMetricAll().
+func (mock *mockPeerMonitor) PeerMetricAll(ctx context.Context, in *api.PeerMetricRequest, out *[]*api.Metric) error {
+	var all []*api.Metric
+	for i := 2; i >= 0; i-- {
+		m := &api.Metric{
+			Name:  in.Name,
+			Peer:  in.Peer,
+			Value: fmt.Sprintf("%d", i),
+			Valid: true,
+		}
+		m.SetTTL(time.Duration(i-1) * time.Second)
+		m.Stale = m.Expired()
+		all = append(all, m)
+	}
+	*out = all
+	return nil
+}
+
 // LatestMetrics runs PeerMonitor.LatestMetrics().
 func (mock *mockPeerMonitor) LatestMetrics(ctx context.Context, in string, out *[]*api.Metric) error {
 	m := &api.Metric{
@@ -471,6 +842,30 @@ func (mock *mockPeerMonitor) MetricNames(ctx context.Context, in struct{}, out *
 	return nil
 }
 
+// RecentAlerts runs PeerMonitor.RecentAlerts().
+func (mock *mockPeerMonitor) RecentAlerts(ctx context.Context, in time.Time, out *[]*api.Alert) error {
+	alrt := &api.Alert{
+		Metric: api.Metric{
+			Name:   "ping",
+			Peer:   PeerID2,
+			Expire: time.Now().Add(-30 * time.Second).UnixNano(),
+			Valid:  true,
+		},
+		TriggeredAt: time.Now(),
+	}
+	if !alrt.TriggeredAt.After(in) {
+		*out = []*api.Alert{}
+		return nil
+	}
+	*out = []*api.Alert{alrt}
+	return nil
+}
+
+// PeerLeft runs PeerMonitor.PeerLeft().
+func (mock *mockPeerMonitor) PeerLeft(ctx context.Context, in peer.ID, out *struct{}) error {
+	return nil
+}
+
 /* IPFSConnector methods */
 
 func (mock *mockIPFSConnector) Pin(ctx context.Context, in *api.Pin, out *struct{}) error {
@@ -536,6 +931,45 @@ func (mock *mockIPFSConnector) BlockPut(ctx context.Context, in *api.NodeWithMet
 	return nil
 }
 
+func (mock *mockIPFSConnector) BlockHas(ctx context.Context, in cid.Cid, out *bool) error {
+	*out = !in.Equals(ErrorCid)
+	return nil
+}
+
+func (mock *mockIPFSConnector) MissingRefs(ctx context.Context, in cid.Cid, out *[]cid.Cid) error {
+	if in.Equals(DegradedCid) {
+		*out = []cid.Cid{Cid2}
+		return nil
+	}
+	*out = []cid.Cid{}
+	return nil
+}
+
+func (mock *mockIPFSConnector) FindProviders(ctx context.Context, in *api.FindProvidersRequest, out *[]peer.ID) error {
+	providers := []peer.ID{}
+	if !in.Cid.Equals(DegradedCid) {
+		providers = append(providers, PeerID2, PeerID3)
+	}
+	if len(providers) > in.Count {
+		providers = providers[:in.Count]
+	}
+	*out = providers
+	return nil
+}
+
+func (mock *mockIPFSConnector) DAGSize(ctx context.Context, in cid.Cid, out *uint64) error {
+	if in.Equals(ErrorCid) {
+		return ErrBadCid
+	}
+	*out = 1024
+	return nil
+}
+
+func (mock *mockIPFSConnector) SupportsCodec(ctx context.Context, in uint64, out *bool) error {
+	*out = in != cid.GitRaw
+	return nil
+}
+
 func (mock *mockIPFSConnector) Resolve(ctx context.Context, in string, out *cid.Cid) error {
 	switch in {
 	case ErrorCid.String(), "/ipfs/" + ErrorCid.String():
@@ -554,7 +988,17 @@ func (mock *mockConsensus) RmPeer(ctx context.Context, in peer.ID, out *struct{}
 	return errors.New("mock rpc cannot redirect")
 }
 
+func (mock *mockConsensus) Leader(ctx context.Context, in struct{}, out *peer.ID) error {
+	*out = PeerID1
+	return nil
+}
+
 func (mock *mockConsensus) Peers(ctx context.Context, in struct{}, out *[]peer.ID) error {
 	*out = []peer.ID{PeerID1, PeerID2, PeerID3}
 	return nil
 }
+
+func (mock *mockConsensus) SyncLag(ctx context.Context, in struct{}, out *uint64) error {
+	*out = 5
+	return nil
+}
@@ -0,0 +1,268 @@
+package ipfscluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ipfs/ipfs-cluster/api"
+	"github.com/ipfs/ipfs-cluster/rpcutil"
+
+	ds "github.com/ipfs/go-datastore"
+	query "github.com/ipfs/go-datastore/query"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	rpc "github.com/libp2p/go-libp2p-gorpc"
+	gocodec "github.com/ugorji/go/codec"
+	"go.opencensus.io/trace"
+)
+
+// tombstonesNamespace is the datastore namespace under which the tombstones
+// are kept, by unpin time.
+var tombstonesNamespace = ds.NewKey("/tombstones")
+
+var errTombstonesDisabled = errors.New("tombstones are disabled (tombstone_retention is 0)")
+
+// tombstonesPurgeInterval is how often the expired tombstones are removed
+// from the datastore, at most.
+var tombstonesPurgeInterval = time.Hour
+
+// tombstones keeps, in the peer datastore, a Tombstone for every item
+// unpinned through this peer during the last TombstoneRetention. They are
+// kept apart from the shared state, so pinning an item again does not
+// affect them. Each peer only stores the unpins it handled and
+// Cluster.DeletedPins gathers them from all peers. A nil tombstones records
+// nothing.
+type tombstones struct {
+	dstore    ds.Datastore
+	retention time.Duration
+	handle    gocodec.Handle
+}
+
+func newTombstones(dstore ds.Datastore, retention time.Duration) *tombstones {
+	if retention <= 0 {
+		return nil
+	}
+	return &tombstones{
+		dstore:    dstore,
+		retention: retention,
+		handle:    &gocodec.MsgpackHandle{},
+	}
+}
+
+// tombstoneKey sorts the tombstones by unpin time. The CID tells apart the
+// items unpinned at the same time.
+func tombstoneKey(t *api.Tombstone) ds.Key {
+	return tombstonesNamespace.
+		ChildString(fmt.Sprintf("%020d", t.UnpinnedAt.UnixNano())).
+		ChildString(t.Cid.String())
+}
+
+// record stores the given tombstone.
+func (ts *tombstones) record(ctx context.Context, t *api.Tombstone) error {
+	if ts == nil {
+		return nil
+	}
+
+	var b []byte
+	enc := gocodec.NewEncoderBytes(&b, ts.handle)
+	if err := enc.Encode(t); err != nil {
+		return err
+	}
+	return ts.dstore.Put(ctx, tombstoneKey(t), b)
+}
+
+// since returns the tombstones retained at the given time for the items
+// unpinned after the given time, the most recent first.
+func (ts *tombstones) since(ctx context.Context, since, now time.Time) ([]*api.Tombstone, error) {
+	entries, err := ts.query(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := now.Add(-ts.retention)
+	if since.Before(cutoff) {
+		since = cutoff
+	}
+
+	tombstones := []*api.Tombstone{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		t := &api.Tombstone{}
+		dec := gocodec.NewDecoderBytes(entries[i].Value, ts.handle)
+		if err := dec.Decode(t); err != nil {
+			logger.Errorf("error decoding tombstone %s: %s", entries[i].Key, err)
+			continue
+		}
+		if !t.UnpinnedAt.After(since) {
+			break
+		}
+		tombstones = append(tombstones, t)
+	}
+	return tombstones, nil
+}
+
+// query returns the stored tombstones sorted by unpin time.
+func (ts *tombstones) query(ctx context.Context, keysOnly bool) ([]query.Entry, error) {
+	results, err := ts.dstore.Query(ctx, query.Query{
+		Prefix:   tombstonesNamespace.String(),
+		KeysOnly: keysOnly,
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries, nil
+}
+
+// purge removes the tombstones which have been retained for longer than
+// TombstoneRetention at the given time.
+func (ts *tombstones) purge(ctx context.Context, now time.Time) error {
+	entries, err := ts.query(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	cutoff := now.Add(-ts.retention).UnixNano()
+	for _, e := range entries {
+		k := ds.NewKey(e.Key)
+		ns := k.Namespaces()
+		if len(ns) < 2 {
+			continue
+		}
+		unpinnedAt, err := strconv.ParseInt(ns[1], 10, 64)
+		if err != nil {
+			logger.Errorf("bad tombstone key %s: %s", k, err)
+			continue
+		}
+		if unpinnedAt > cutoff {
+			break
+		}
+		if err := ts.dstore.Delete(ctx, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watchTombstones purges the expired tombstones every
+// tombstonesPurgeInterval, or every TombstoneRetention when it is shorter.
+func (c *Cluster) watchTombstones() {
+	interval := c.config.TombstoneRetention
+	if interval <= 0 {
+		return
+	}
+	if interval > tombstonesPurgeInterval {
+		interval = tombstonesPurgeInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.tombstones.purge(c.ctx, time.Now()); err != nil {
+				logger.Errorf("error purging tombstones: %s", err)
+			}
+		}
+	}
+}
+
+// recordTombstone records that the given pin was unpinned at the request of
+// the given API client identity, if known.
+func (c *Cluster) recordTombstone(ctx context.Context, pin *api.Pin, unpinnedBy string) {
+	err := c.tombstones.record(ctx, &api.Tombstone{
+		Cid:        pin.Cid,
+		Name:       pin.Name,
+		UnpinnedAt: time.Now(),
+		UnpinnedBy: unpinnedBy,
+		Peer:       c.id,
+	})
+	if err != nil {
+		logger.Errorf("error recording tombstone for %s: %s", pin.Cid, err)
+	}
+}
+
+// DeletedPins returns the tombstones of the items unpinned through any
+// cluster peer after the given time, the most recent first. Tombstones are
+// retained for TombstoneRetention. The peer which handles an unpin request
+// records its tombstone, so they are gathered from every peer: the
+// tombstones of the peers which cannot be contacted are missing. Unpins
+// which do not come through the REST or gRPC APIs, like those from the IPFS
+// proxy or of expired items, have no UnpinnedBy.
+func (c *Cluster) DeletedPins(ctx context.Context, since time.Time) ([]*api.Tombstone, error) {
+	_, span := trace.StartSpan(ctx, "cluster/DeletedPins")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	if c.tombstones == nil {
+		return nil, errTombstonesDisabled
+	}
+
+	members := []peer.ID{c.id}
+	if !c.followerMode() {
+		var err error
+		members, err = c.consensus.Peers(ctx)
+		if err != nil {
+			logger.Error(err)
+			return nil, err
+		}
+	}
+
+	lenMembers := len(members)
+	replies := make([][]*api.Tombstone, lenMembers)
+	ifaceReplies := make([]interface{}, lenMembers)
+	for i := range replies {
+		ifaceReplies[i] = &replies[i]
+	}
+
+	ctxs, cancels := rpcutil.CtxsWithTimeout(ctx, lenMembers, 15*time.Second)
+	defer rpcutil.MultiCancel(cancels)
+
+	errs := c.rpcClient.MultiCall(
+		ctxs,
+		members,
+		"Cluster",
+		"DeletedPinsLocal",
+		since,
+		ifaceReplies,
+	)
+
+	tombstones := []*api.Tombstone{}
+	for i, r := range replies {
+		if e := errs[i]; e != nil {
+			if !rpc.IsAuthorizationError(e) {
+				logger.Warnf("error getting the tombstones of %s: %s", members[i], e)
+			}
+			continue
+		}
+		tombstones = append(tombstones, r...)
+	}
+	sort.SliceStable(tombstones, func(i, j int) bool {
+		return tombstones[i].UnpinnedAt.After(tombstones[j].UnpinnedAt)
+	})
+	return tombstones, nil
+}
+
+// DeletedPinsLocal returns the tombstones of the items unpinned through
+// this peer after the given time, the most recent first.
+func (c *Cluster) DeletedPinsLocal(ctx context.Context, since time.Time) ([]*api.Tombstone, error) {
+	_, span := trace.StartSpan(ctx, "cluster/DeletedPinsLocal")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	if c.tombstones == nil {
+		return nil, errTombstonesDisabled
+	}
+	return c.tombstones.since(ctx, since, time.Now())
+}
@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"math"
+
+	"github.com/ipfs/ipfs-cluster/api"
 
 	blake2b "golang.org/x/crypto/blake2b"
 
@@ -67,6 +70,18 @@ func containsPeer(list []peer.ID, peer peer.ID) bool {
 	return false
 }
 
+func metadataEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
 func minInt(x, y int) int {
 	if x < y {
 		return x
@@ -157,3 +172,65 @@ func peersSubtract(a []peer.ID, b []peer.ID) []peer.ID {
 
 	return result
 }
+
+// writeHint returns the peer of the valid metric with the largest weight, or
+// an empty ID. Ties go to the lowest peer ID so that all peers agree.
+func writeHint(metrics []*api.Metric) peer.ID {
+	var best *api.Metric
+	for _, m := range metrics {
+		if m.Discard() {
+			continue
+		}
+		if best == nil || m.GetWeight() > best.GetWeight() ||
+			(m.GetWeight() == best.GetWeight() && m.Peer < best.Peer) {
+			best = m
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.Peer
+}
+
+// maxWriteWeight is the share of the writes given by writeWeights to the
+// peer with the largest weight.
+const maxWriteWeight = 10
+
+// writeWeights returns the share of the writes that the peer of every valid
+// metric should take, indexed by encoded peer ID: the peer with the smallest
+// weight gets 1, the one with the largest gets maxWriteWeight and the others
+// are scaled linearly in between, so that no peer takes all the writes
+// however large its weight is. It returns nil without valid metrics.
+func writeWeights(metrics []*api.Metric) map[string]int64 {
+	var valid []*api.Metric
+	var min, max int64
+	for _, m := range metrics {
+		if m.Discard() {
+			continue
+		}
+		w := m.GetWeight()
+		if len(valid) == 0 || w < min {
+			min = w
+		}
+		if len(valid) == 0 || w > max {
+			max = w
+		}
+		valid = append(valid, m)
+	}
+	if len(valid) == 0 {
+		return nil
+	}
+
+	weights := make(map[string]int64, len(valid))
+	for _, m := range valid {
+		share := int64(1)
+		if max > min {
+			// Computed as floats, since the weights may be large
+			// (i.e. free space in bytes).
+			scaled := float64(m.GetWeight()-min) / float64(max-min) * (maxWriteWeight - 1)
+			share += int64(math.Round(scaled))
+		}
+		weights[peer.Encode(m.Peer)] = share
+	}
+	return weights
+}
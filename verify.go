@@ -0,0 +1,54 @@
+package ipfscluster
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/ipfs-cluster/api"
+
+	cid "github.com/ipfs/go-cid"
+	"go.opencensus.io/trace"
+)
+
+// Verify triggers a VerifyLocal operation for the given Cid on the peers
+// allocated to it. Walking a large DAG takes long, so peers are not given
+// the usual status timeout: each one is bounded by the refs_timeout of its
+// IPFS connector instead.
+func (c *Cluster) Verify(ctx context.Context, h cid.Cid) (*api.GlobalPinInfo, error) {
+	_, span := trace.StartSpan(ctx, "cluster/Verify")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	return c.globalPinInfoCid(ctx, "Cluster", "VerifyLocal", h, 0)
+}
+
+// VerifyLocal returns the status of the given Cid in this peer after
+// checking, when it is pinned, that the IPFS daemon has every block of its
+// DAG. Pins with missing blocks are reported as TrackerStatusPinDegraded,
+// along with the first missing block found, as IPFS stops the walk there.
+// Walking the whole DAG is costly, so this
+// only happens on request and the degraded status is not kept by the pin
+// tracker.
+func (c *Cluster) VerifyLocal(ctx context.Context, h cid.Cid) (*api.PinInfo, error) {
+	_, span := trace.StartSpan(ctx, "cluster/VerifyLocal")
+	defer span.End()
+	ctx = trace.NewContext(c.ctx, span)
+
+	pInfo := c.tracker.Status(ctx, h)
+	if pInfo.Status != api.TrackerStatusPinned {
+		return pInfo, nil
+	}
+
+	missing, err := c.ipfs.MissingRefs(ctx, h)
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+	if len(missing) > 0 {
+		logger.Warnf("verify: %s is pinned but block %s is missing", h, missing[0])
+		pInfo.Status = api.TrackerStatusPinDegraded
+		pInfo.Error = fmt.Sprintf("block %s is missing", missing[0])
+		pInfo.MissingBlocks = missing
+	}
+	return pInfo, nil
+}